@@ -16,6 +16,8 @@ import (
 	"path/filepath"
 	"seisami/app/internal/actions"
 	"seisami/app/internal/cloud"
+	"seisami/app/internal/e2e"
+	"seisami/app/internal/lan"
 	"seisami/app/internal/repo"
 	"seisami/app/internal/repo/sqlc/query"
 	"seisami/app/internal/sync_engine"
@@ -24,6 +26,7 @@ import (
 
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/emeraldls/portaudio"
@@ -63,7 +66,13 @@ type App struct {
 	currentBoardId  string
 	cloud           cloud.Cloud
 	syncEngine      *sync_engine.SyncEngine
+	syncScheduler   *sync_engine.Scheduler
 	syncWS          *cloud.SyncWebSocket
+	keyring         *e2e.Keyring
+	lanMu           sync.Mutex
+	lanHost         *lan.Host
+	lanDiscovery    *lan.Discovery
+	lanPeerStore    *lan.PeerStore
 }
 
 func dbPath() string {
@@ -87,6 +96,10 @@ func NewApp() *App {
 	if _, err := db.ExecContext(ctx, repo.Schema); err != nil {
 		log.Fatalf("unable to create tables: %v\n", err)
 	}
+
+	if err := repo.Migrate(ctx, db); err != nil {
+		log.Fatalf("unable to migrate tables: %v\n", err)
+	}
 	repo := repo.NewRepo(db, ctx)
 
 	return &App{
@@ -106,13 +119,60 @@ func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 	a.action = actions.NewAction(ctx, a.repository)
 
+	a.keyring = e2e.NewKeyring()
+	if key, err := a.repository.GetPrivateKey(); err != nil {
+		fmt.Printf("unable to load encryption key: %v\n", err)
+	} else if key != "" {
+		if err := a.keyring.Restore(key); err != nil {
+			fmt.Printf("unable to restore encryption key: %v\n", err)
+		}
+	}
+
 	cloudFuncs := cloud.NewCloudFuncs(a.repository, a.loginToken, a.ctx, a.cloudApiUrl)
+	cloudFuncs.SetKeyring(a.keyring)
 	a.cloud = cloudFuncs
 
-	syncEngine := sync_engine.NewSyncEngine(a.repository, cloudFuncs, a.ctx)
+	// the account, devices and keys stay with the cloud, only the op log goes through the team's storage
+	var syncCloud cloud.Cloud = cloudFuncs
+	syncEnabled := a.isAuthenticated
+	storage, err := a.openSyncBackend()
+	switch {
+	case err != nil:
+		fmt.Printf("sync is paused, unable to open sync storage: %v\n", err)
+		syncEnabled = func() bool { return false }
+	case storage != nil:
+		syncCloud = storage
+		syncEnabled = func() bool { return true }
+	}
+
+	syncEngine := sync_engine.NewSyncEngine(a.repository, syncCloud, a.ctx)
+	syncEngine.SetBatchConfig(getSyncBatchConfig())
+	syncEngine.SetKeyring(a.keyring)
 	a.syncEngine = syncEngine
 
-	a.syncWS = cloud.NewSyncWebSocket(ctx, a.cloudApiUrl, a.loginToken, func(tableName string) {
+	a.syncScheduler = sync_engine.NewScheduler(syncEngine, sync_engine.DefaultSchedulerConfig())
+	a.syncScheduler.SetEnabled(syncEnabled)
+	a.repository.OnOperationCreated(func(tableName types.TableName) {
+		a.syncScheduler.Trigger(tableName)
+	})
+	a.syncScheduler.Start(ctx)
+	go syncEngine.RunCompaction(ctx, sync_engine.CompactInterval)
+	if storage != nil {
+		go a.pollSyncStorage()
+		a.startLan()
+	}
+
+	if a.isAuthenticated() {
+		go a.registerDevice()
+	}
+
+	// the cloud keeps a socket per device, one without an id still connects and shares the user's signals
+	deviceID, err := a.repository.GetDeviceID()
+	if err != nil {
+		fmt.Printf("unable to get device id: %v\n", err)
+	}
+
+	a.syncWS = cloud.NewSyncWebSocket(ctx, a.cloudApiUrl, a.loginToken, deviceID, func(tableName string) {
 		fmt.Printf("Sync update received for table: %s\n", tableName)
 
 		var tableType types.TableName
@@ -129,21 +189,18 @@ func (a *App) startup(ctx context.Context) {
 			return
 		}
 
-		// Trigger sync for the specific table
-		go func() {
-			if err := syncEngine.SyncData(tableType, true); err != nil {
-				fmt.Printf("Error syncing %s: %v\n", tableName, err)
-			} else {
-				// Emit event to frontend that data was updated
-				runtime.EventsEmit(ctx, "sync:table_updated", map[string]string{
-					"table": tableName,
-				})
-			}
-		}()
+		a.syncScheduler.Trigger(tableType)
+	})
+	a.syncWS.OnBoardRemoved(func(boardID string) {
+		fmt.Printf("Access to board %s was removed, archiving it\n", boardID)
+		if err := a.syncEngine.ArchiveBoard(boardID); err != nil {
+			fmt.Println(err)
+		}
 	})
 
 	go a.handleMutations()
 	go a.appVersionCheck()
+	go a.purgeTombstones()
 
 	a.initPlatformSpecific()
 	fmt.Println("is user authenticated: ", a.isAuthenticated())
@@ -551,18 +608,216 @@ func (a *App) SetLoginToken(token string) {
 	if a.syncWS != nil {
 		a.syncWS.UpdateToken(token)
 	}
+
+	if a.syncScheduler != nil {
+		a.syncScheduler.Trigger()
+	}
+
+	go a.registerDevice()
+}
+
+// registerDevice names this install in the account's device list after the machine
+func (a *App) registerDevice() {
+	if resp := a.cloud.RegisterDevice(deviceName()); resp.Error != "" {
+		fmt.Printf("unable to register device: %s\n", resp.Error)
+	}
+}
+
+// ListDevices is every install signed in to the account, including revoked ones
+func (a *App) ListDevices() ([]types.Device, error) {
+	resp := a.cloud.ListDevices()
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+
+	devices, ok := resp.Data.([]types.Device)
+	if !ok {
+		return nil, fmt.Errorf("invalid response data type")
+	}
+
+	return devices, nil
+}
+
+// GetDeviceID is this install's device id, its board rooms are told it so the events sent there are this device's ops
+func (a *App) GetDeviceID() (string, error) {
+	return a.repository.GetDeviceID()
+}
+
+// RevokeDevice stops an install from syncing this account
+func (a *App) RevokeDevice(deviceID string) error {
+	if resp := a.cloud.RevokeDevice(deviceID); resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+
+	return nil
+}
+
+// EnableEncryption turns on end to end encryption on this device. the account's first device creates its keypair,
+// every other one unlocks it with the same passphrase
+func (a *App) EnableEncryption(passphrase string) error {
+	resp := a.cloud.GetUserKeys()
+	if resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+
+	if keys, ok := resp.Data.(types.UserKeys); ok {
+		if err := a.keyring.Unlock(keys, passphrase); err != nil {
+			return err
+		}
+	} else {
+		keys, err := a.keyring.Generate(passphrase)
+		if err != nil {
+			return err
+		}
+		if resp := a.cloud.PutUserKeys(keys); resp.Error != "" {
+			a.keyring.Lock()
+			return fmt.Errorf("%s", resp.Error)
+		}
+	}
+
+	// the device stays unlocked across restarts, the passphrase is only needed once per device
+	if err := a.repository.SetPrivateKey(a.keyring.PrivateKey()); err != nil {
+		return err
+	}
+
+	if a.syncScheduler != nil {
+		a.syncScheduler.Trigger()
+	}
+
+	return nil
+}
+
+func (a *App) IsEncryptionEnabled() bool {
+	return a.keyring.Unlocked()
 }
 
 func (a *App) ClearLoginToken() {
 	a.loginToken = ""
 	a.cloud.UpdateSessionToken("")
 
+	// the keys belong to the account, the next one to sign in here brings their own
+	a.keyring.Lock()
+	if err := a.repository.SetPrivateKey(""); err != nil {
+		fmt.Println(err)
+	}
+
 	if a.syncWS != nil {
 		a.syncWS.Disconnect()
 	}
 
 }
 
+// GetSyncStatus is the scheduler's current state, changes are also emitted as "sync:status"
+func (a *App) GetSyncStatus() sync_engine.SyncStatus {
+	if a.syncScheduler == nil {
+		return sync_engine.SyncStatus{State: sync_engine.SyncIdle}
+	}
+	return a.syncScheduler.Status()
+}
+
+// SyncNow skips the debounce and any pending backoff
+func (a *App) SyncNow() {
+	if a.syncScheduler != nil {
+		a.syncScheduler.SyncNow()
+	}
+}
+
+// ListTrash is every deleted board, column, card and transcription that can still be restored, newest first
+func (a *App) ListTrash() ([]types.TrashItem, error) {
+	return a.repository.ListTrash()
+}
+
+// RestoreFromTrash takes a record back out of the trash, the restore syncs to other devices like any other op
+func (a *App) RestoreFromTrash(tableName string, id string) error {
+	table, err := types.TableNameFromString(tableName)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+
+	return a.repository.InTx(func(tx repo.Repository) error {
+		var err error
+		switch table {
+		case types.BoardTable:
+			err = tx.RestoreBoard(id)
+		case types.ColumnTable:
+			err = tx.RestoreColumn(id)
+		case types.CardTable:
+			err = tx.RestoreCard(id)
+		case types.TranscriptionTable:
+			err = tx.RestoreTranscription(id)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateOperation(table, id, string(payload), types.RestoreOperation)
+		return err
+	})
+}
+
+// ListSyncConflicts is the journal of every conflict sync resolved, newest first
+func (a *App) ListSyncConflicts() ([]types.SyncConflict, error) {
+	return a.repository.ListSyncConflicts()
+}
+
+// ReapplyConflict brings back the losing version of a conflict as a new operation
+func (a *App) ReapplyConflict(conflictID string) error {
+	if a.syncEngine == nil {
+		return fmt.Errorf("sync engine not initialized")
+	}
+	return a.syncEngine.ReapplyConflictLoser(conflictID)
+}
+
+// PlanSync is a dry run of syncing tableName, it lists what would be pushed, pulled and deleted and which conflicts
+// would be journaled without changing anything
+func (a *App) PlanSync(tableName string) (types.SyncPlan, error) {
+	if a.syncEngine == nil {
+		return types.SyncPlan{}, fmt.Errorf("sync engine not initialized")
+	}
+
+	table, err := types.TableNameFromString(tableName)
+	if err != nil {
+		return types.SyncPlan{}, err
+	}
+
+	return a.syncEngine.Plan(table)
+}
+
+// purgeTombstones empties the trash of whatever outlived the retention window, once at startup and then daily
+func (a *App) purgeTombstones() {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		purged, err := a.repository.PurgeTombstones(time.Now().Add(-getTombstoneRetention()))
+		if err != nil {
+			fmt.Println(err)
+		} else if purged > 0 {
+			fmt.Printf("purged %d records from the trash\n", purged)
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AcceptBoardInvite joins the board an invite link was sent for, the board can be imported after
+func (a *App) AcceptBoardInvite(token string) error {
+	if resp := a.cloud.AcceptBoardInvite(token); resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+
+	return nil
+}
+
 func (a *App) ImportNewBoard(boardID string) error {
 
 	return a.syncEngine.ImportNewBoard(boardID)
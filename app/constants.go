@@ -1,6 +1,11 @@
 package main
 
-import "os"
+import (
+	"os"
+	"seisami/app/internal/sync_engine"
+	"strconv"
+	"time"
+)
 
 func getCloudApiUrl() string {
 	fixedCloudUrl := "https://cloud.seisami.hooklytics.com"
@@ -32,3 +37,27 @@ func getCollabServerAddr() string {
 	}
 	return defaultCollabServerAddr
 }
+
+// getSyncBatchConfig lets the chunk sizes used against /sync/batch be tuned without a rebuild
+func getSyncBatchConfig() sync_engine.BatchConfig {
+	cfg := sync_engine.DefaultBatchConfig()
+
+	if v, err := strconv.Atoi(os.Getenv("SYNC_PUSH_CHUNK_SIZE")); err == nil {
+		cfg.PushChunkSize = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SYNC_PULL_CHUNK_SIZE")); err == nil {
+		cfg.PullChunkSize = v
+	}
+
+	return cfg
+}
+
+// getTombstoneRetention is how long deleted records stay restorable before the purge job removes them for good
+func getTombstoneRetention() time.Duration {
+	days := 30
+	if v, err := strconv.Atoi(os.Getenv("TOMBSTONE_RETENTION_DAYS")); err == nil && v > 0 {
+		days = v
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -20,18 +20,24 @@ import {
 import { useBoardStore } from "~/stores/board-store";
 import { toast } from "sonner";
 import { ApiClient, BoardMetadata } from "~/lib/api-client";
-import { ImportNewBoard } from "../../wailsjs/go/main/App";
+import {
+  AcceptBoardInvite,
+  ImportNewBoard,
+} from "../../wailsjs/go/main/App";
 
 interface BoardImportDialogProps {
   open: boolean;
   onOpenChange: (open: boolean) => void;
   boardId?: string;
+  // inviteToken comes with invite links, the invite has to be accepted before the board can be read
+  inviteToken?: string;
 }
 
 export const BoardImportDialog = ({
   open,
   onOpenChange,
   boardId,
+  inviteToken,
 }: BoardImportDialogProps) => {
   const [isLoadingMetadata, setIsLoadingMetadata] = useState(false);
   const [isImporting, setIsImporting] = useState(false);
@@ -43,7 +49,7 @@ export const BoardImportDialog = ({
     if (open && boardId) {
       fetchBoardMetadata(boardId);
     }
-  }, [open, boardId]);
+  }, [open, boardId, inviteToken]);
 
   const fetchBoardMetadata = async (id: string) => {
     setIsLoadingMetadata(true);
@@ -51,6 +57,9 @@ export const BoardImportDialog = ({
     setMetadata(null);
 
     try {
+      if (inviteToken) {
+        await AcceptBoardInvite(inviteToken);
+      }
       const response = await ApiClient.getBoardMetadata(id);
       setMetadata(response.data);
     } catch (err) {
@@ -9,9 +9,24 @@ import {
 } from "./ui/dialog";
 import { Button } from "./ui/button";
 import { Input } from "./ui/input";
-import { Users, UserPlus, UserMinus, Mail, Crown, Loader2 } from "lucide-react";
-import { ApiClient, BoardMember } from "~/lib/api-client";
+import {
+  Users,
+  UserPlus,
+  UserMinus,
+  Mail,
+  Crown,
+  Loader2,
+  RotateCw,
+  X,
+  LogOut,
+} from "lucide-react";
+import {
+  ApiClient,
+  BoardMember,
+  BoardRole,
+} from "~/lib/api-client";
 import { useBoardStore } from "~/stores/board-store";
+import { useDesktopAuthStore } from "~/stores/auth-store";
 import { toast } from "sonner";
 import { Avatar, AvatarFallback } from "./ui/avatar";
 import {
@@ -24,16 +39,38 @@ import {
   AlertDialogHeader,
   AlertDialogTitle,
 } from "./ui/alert-dialog";
+import {
+  DropdownMenu,
+  DropdownMenuContent,
+  DropdownMenuItem,
+  DropdownMenuRadioGroup,
+  DropdownMenuRadioItem,
+  DropdownMenuSeparator,
+  DropdownMenuTrigger,
+} from "./ui/dropdown-menu";
 import { useQuery, useMutation, useQueryClient } from "@tanstack/react-query";
 import { format, parseISO } from "date-fns";
 
+const assignableRoles: { role: BoardRole; label: string }[] = [
+  { role: "viewer", label: "Viewer" },
+  { role: "commenter", label: "Commenter" },
+  { role: "editor", label: "Editor" },
+  { role: "admin", label: "Admin" },
+];
+
+const roleLabel = (role: BoardRole) =>
+  assignableRoles.find((r) => r.role === role)?.label ??
+  (role === "member" ? "Editor" : "Owner");
+
 export const BoardMembersPanel = () => {
   const [isOpen, setIsOpen] = useState(false);
   const [inviteEmail, setInviteEmail] = useState("");
   const [memberToRemove, setMemberToRemove] = useState<BoardMember | null>(
     null
   );
+  const [isLeaving, setIsLeaving] = useState(false);
   const { currentBoard } = useBoardStore();
+  const { userId } = useDesktopAuthStore();
   const queryClient = useQueryClient();
 
   const {
@@ -47,6 +84,15 @@ export const BoardMembersPanel = () => {
     enabled: !!currentBoard && isOpen,
   });
 
+  // only admins and the owner may see invitations, for everyone else the request is refused and the section stays
+  // hidden
+  const { data: invitations } = useQuery({
+    queryKey: ["boardInvitations", currentBoard?.id],
+    queryFn: () => ApiClient.getBoardInvitations(currentBoard!.id),
+    enabled: !!currentBoard && isOpen,
+    retry: false,
+  });
+
   const inviteMutation = useMutation({
     mutationFn: (email: string) =>
       ApiClient.inviteUserToBoard(email, currentBoard!.id),
@@ -55,7 +101,7 @@ export const BoardMembersPanel = () => {
       setInviteEmail("");
 
       queryClient.invalidateQueries({
-        queryKey: ["boardMembers", currentBoard?.id],
+        queryKey: ["boardInvitations", currentBoard?.id],
       });
     },
     onError: (error: Error) => {
@@ -79,6 +125,74 @@ export const BoardMembersPanel = () => {
     },
   });
 
+  const roleMutation = useMutation({
+    mutationFn: ({ userId, role }: { userId: string; role: BoardRole }) =>
+      ApiClient.setBoardMemberRole(currentBoard!.id, userId, role),
+    onSuccess: () => {
+      queryClient.invalidateQueries({
+        queryKey: ["boardMembers", currentBoard?.id],
+      });
+    },
+    onError: (error: Error) => {
+      toast.error(error.message || "Failed to change role");
+    },
+  });
+
+  const resendMutation = useMutation({
+    mutationFn: (invitationId: string) =>
+      ApiClient.resendBoardInvitation(currentBoard!.id, invitationId),
+    onSuccess: (response) => {
+      toast.success(`Invitation resent to ${response.data.email}`);
+      queryClient.invalidateQueries({
+        queryKey: ["boardInvitations", currentBoard?.id],
+      });
+    },
+    onError: (error: Error) => {
+      toast.error(error.message || "Failed to resend invitation");
+    },
+  });
+
+  const revokeMutation = useMutation({
+    mutationFn: (invitationId: string) =>
+      ApiClient.revokeBoardInvitation(currentBoard!.id, invitationId),
+    onSuccess: () => {
+      queryClient.invalidateQueries({
+        queryKey: ["boardInvitations", currentBoard?.id],
+      });
+    },
+    onError: (error: Error) => {
+      toast.error(error.message || "Failed to revoke invitation");
+    },
+  });
+
+  const transferMutation = useMutation({
+    mutationFn: (member: BoardMember) =>
+      ApiClient.transferBoardOwnership(currentBoard!.id, member.user_id),
+    onSuccess: (_, member) => {
+      toast.success(`${member.email} now owns this board`);
+      queryClient.invalidateQueries({
+        queryKey: ["boardMembers", currentBoard?.id],
+      });
+    },
+    onError: (error: Error) => {
+      toast.error(error.message || "Failed to transfer the board");
+    },
+  });
+
+  // the sync engine archives the board once the cloud confirms, see board:archived
+  const leaveMutation = useMutation({
+    mutationFn: () => ApiClient.leaveBoard(currentBoard!.id),
+    onSuccess: () => {
+      setIsLeaving(false);
+      setIsOpen(false);
+    },
+    onError: (error: Error) => {
+      toast.error(error.message || "Failed to leave the board");
+    },
+  });
+
+  const myRole = members?.data.find((m) => m.user_id === userId)?.role;
+
   const handleInvite = async () => {
     if (!inviteEmail.trim() || !currentBoard) return;
 
@@ -181,10 +295,58 @@ export const BoardMembersPanel = () => {
               </div>
               <p className="text-xs text-muted-foreground">
                 Invited members will have access to all transcriptions and cards
-                in this board
+                in this board once they accept
               </p>
             </div>
 
+            {!!invitations?.data.length && (
+              <div className="space-y-2">
+                <label className="text-sm font-medium">
+                  Pending Invitations ({invitations.data.length})
+                </label>
+                <div className="border rounded-lg divide-y max-h-[200px] overflow-y-auto">
+                  {invitations.data.map((invitation) => (
+                    <div
+                      key={invitation.id}
+                      className="flex items-center gap-3 p-3"
+                    >
+                      <Mail className="h-4 w-4 text-muted-foreground" />
+                      <div className="flex-1 min-w-0">
+                        <p className="text-sm font-medium truncate">
+                          {invitation.email}
+                        </p>
+                        <p className="text-xs text-muted-foreground">
+                          {roleLabel(invitation.role)} ·{" "}
+                          {invitation.expired
+                            ? "Expired"
+                            : `Expires ${formatDate(invitation.expires_at)}`}
+                        </p>
+                      </div>
+                      <Button
+                        variant="ghost"
+                        size="sm"
+                        onClick={() => resendMutation.mutate(invitation.id)}
+                        disabled={resendMutation.isPending}
+                      >
+                        <RotateCw className="h-4 w-4" />
+                        <span>Resend</span>
+                      </Button>
+                      <Button
+                        variant="ghost"
+                        size="sm"
+                        onClick={() => revokeMutation.mutate(invitation.id)}
+                        disabled={revokeMutation.isPending}
+                        className="text-destructive hover:text-destructive hover:bg-destructive/10"
+                      >
+                        <X className="h-4 w-4" />
+                        <span>Revoke</span>
+                      </Button>
+                    </div>
+                  ))}
+                </div>
+              </div>
+            )}
+
             <div className="space-y-2">
               <label className="text-sm font-medium">
                 Current Members ({members?.data.length})
@@ -227,6 +389,50 @@ export const BoardMembersPanel = () => {
                             Joined {formatDate(member.joined_at)}
                           </p>
                         </div>
+                        {member.role !== "owner" && (
+                          <DropdownMenu>
+                            <DropdownMenuTrigger asChild>
+                              <Button
+                                variant="outline"
+                                size="sm"
+                                disabled={roleMutation.isPending}
+                              >
+                                {roleLabel(member.role)}
+                              </Button>
+                            </DropdownMenuTrigger>
+                            <DropdownMenuContent align="end">
+                              <DropdownMenuRadioGroup
+                                value={member.role}
+                                onValueChange={(role) =>
+                                  roleMutation.mutate({
+                                    userId: member.user_id,
+                                    role: role as BoardRole,
+                                  })
+                                }
+                              >
+                                {assignableRoles.map(({ role, label }) => (
+                                  <DropdownMenuRadioItem key={role} value={role}>
+                                    {label}
+                                  </DropdownMenuRadioItem>
+                                ))}
+                              </DropdownMenuRadioGroup>
+                              {myRole === "owner" && (
+                                <>
+                                  <DropdownMenuSeparator />
+                                  <DropdownMenuItem
+                                    disabled={transferMutation.isPending}
+                                    onSelect={() =>
+                                      transferMutation.mutate(member)
+                                    }
+                                  >
+                                    <Crown className="h-4 w-4" />
+                                    Make owner
+                                  </DropdownMenuItem>
+                                </>
+                              )}
+                            </DropdownMenuContent>
+                          </DropdownMenu>
+                        )}
                         {member.role !== "owner" && (
                           <Button
                             variant="ghost"
@@ -244,10 +450,56 @@ export const BoardMembersPanel = () => {
                 </div>
               )}
             </div>
+
+            {myRole && myRole !== "owner" && (
+              <div className="flex justify-end">
+                <Button
+                  variant="ghost"
+                  size="sm"
+                  onClick={() => setIsLeaving(true)}
+                  className="text-destructive hover:text-destructive hover:bg-destructive/10"
+                >
+                  <LogOut className="h-4 w-4" />
+                  <span>Leave board</span>
+                </Button>
+              </div>
+            )}
           </div>
         </DialogContent>
       </Dialog>
 
+      <AlertDialog open={isLeaving} onOpenChange={setIsLeaving}>
+        <AlertDialogContent>
+          <AlertDialogHeader>
+            <AlertDialogTitle>Leave Board</AlertDialogTitle>
+            <AlertDialogDescription>
+              You will lose access to "{currentBoard.name}". Your local copy is
+              archived and stops syncing, someone on the board has to invite
+              you again to get it back.
+            </AlertDialogDescription>
+          </AlertDialogHeader>
+          <AlertDialogFooter>
+            <AlertDialogCancel disabled={leaveMutation.isPending}>
+              Cancel
+            </AlertDialogCancel>
+            <AlertDialogAction
+              onClick={() => leaveMutation.mutate()}
+              disabled={leaveMutation.isPending}
+              className="bg-destructive hover:bg-destructive/90"
+            >
+              {leaveMutation.isPending ? (
+                <>
+                  <Loader2 className="h-4 w-4 animate-spin" />
+                  <span>Leaving...</span>
+                </>
+              ) : (
+                "Leave"
+              )}
+            </AlertDialogAction>
+          </AlertDialogFooter>
+        </AlertDialogContent>
+      </AlertDialog>
+
       <AlertDialog
         open={!!memberToRemove}
         onOpenChange={(open) => !open && setMemberToRemove(null)}
@@ -1,55 +1,63 @@
-import { useEffect, useState } from "react";
 import { Avatar, AvatarFallback } from "~/components/ui/avatar";
 import {
   Popover,
   PopoverContent,
   PopoverTrigger,
 } from "~/components/ui/popover";
-import { wsService } from "~/lib/websocket-service";
+import { useCollaborationStore } from "~/stores/collab-store";
+import { useDesktopAuthStore } from "~/stores/auth-store";
+import type { Presence } from "~/types/types";
 
 interface ConnectedUsersProps {
   boardId: string;
 }
 
-const getInitials = (userId: string) => {
-  return userId.substring(0, 2).toUpperCase();
+const getInitials = (presence: Presence) => {
+  return (presence.name || presence.user_id).substring(0, 2).toUpperCase();
 };
 
-const getAvatarColor = (userId: string) => {
-  const colors = [
-    "bg-red-500",
-    "bg-blue-500",
-    "bg-green-500",
-    "bg-yellow-500",
-    "bg-purple-500",
-    "bg-pink-500",
-    "bg-indigo-500",
-    "bg-orange-500",
-  ];
-  const index = userId.charCodeAt(0) % colors.length;
-  return colors[index];
-};
+// one entry per user, someone on two devices counts as active and editing if either of them is
+const usePresenceByUser = (): Presence[] => {
+  const presence = useCollaborationStore((state) => state.presence);
 
-export const ConnectedUsers = ({ boardId }: ConnectedUsersProps) => {
-  const [connectedUsers, setConnectedUsers] = useState<string[]>([]);
+  const byUser = new Map<string, Presence>();
+  for (const entry of presence) {
+    const seen = byUser.get(entry.user_id);
+    if (!seen) {
+      byUser.set(entry.user_id, entry);
+      continue;
+    }
+    byUser.set(entry.user_id, {
+      ...seen,
+      name: seen.name || entry.name,
+      focus: seen.focus ?? entry.focus,
+      editing: seen.editing ?? entry.editing,
+      idle: seen.idle && entry.idle,
+    });
+  }
 
-  useEffect(() => {
-    const handleMessage = (message: any) => {
-      if (message.type === "user_joined" || message.type === "user_left") {
-        const users = message.users || [];
-        const uniqueUsers = Array.from(new Set(users)) as string[];
-        setConnectedUsers(uniqueUsers);
-      }
-    };
+  return Array.from(byUser.values());
+};
 
-    const unsubscribe = wsService.onMessage(handleMessage);
+const describePresence = (presence: Presence) => {
+  if (presence.idle) return "Idle";
+  if (presence.editing) {
+    return presence.editing.table === "cards"
+      ? "Editing a card"
+      : "Editing a column";
+  }
+  if (presence.focus) {
+    return presence.focus.table === "cards"
+      ? "Looking at a card"
+      : "Looking at a column";
+  }
+  return "Active now";
+};
 
-    return () => {
-      unsubscribe();
-    };
-  }, [boardId]);
+export const ConnectedUsers = ({ boardId }: ConnectedUsersProps) => {
+  const connectedUsers = usePresenceByUser();
 
-  if (connectedUsers.length === 0) {
+  if (!boardId || connectedUsers.length === 0) {
     return null;
   }
 
@@ -59,14 +67,16 @@ export const ConnectedUsers = ({ boardId }: ConnectedUsersProps) => {
   return (
     <div className="flex items-center gap-2">
       <div className="flex -space-x-2">
-        {displayUsers.map((userId) => (
-          <Popover key={userId}>
+        {displayUsers.map((presence) => (
+          <Popover key={presence.user_id}>
             <PopoverTrigger asChild>
               <Avatar
-                className={`h-8 w-8 border-2 border-background cursor-pointer hover:z-10 transition-transform hover:scale-110 bg-black`}
+                className={`h-8 w-8 border-2 border-background cursor-pointer hover:z-10 transition-transform hover:scale-110 bg-black ${
+                  presence.idle ? "opacity-50" : ""
+                }`}
               >
                 <AvatarFallback className=" text-xs text-black font-semibold">
-                  {getInitials(userId)}
+                  {getInitials(presence)}
                 </AvatarFallback>
               </Avatar>
             </PopoverTrigger>
@@ -75,21 +85,27 @@ export const ConnectedUsers = ({ boardId }: ConnectedUsersProps) => {
                 <div className="flex items-center gap-3">
                   <Avatar className={`h-10 w-10 `}>
                     <AvatarFallback className="font-semibold">
-                      {getInitials(userId)}
+                      {getInitials(presence)}
                     </AvatarFallback>
                   </Avatar>
                   <div>
-                    <p className="text-sm font-medium">User</p>
+                    <p className="text-sm font-medium">
+                      {presence.name || "User"}
+                    </p>
                     <p className="text-xs text-muted-foreground truncate">
-                      {userId}
+                      {presence.user_id}
                     </p>
                   </div>
                 </div>
                 <div className="pt-2 border-t">
                   <div className="flex items-center gap-2">
-                    <div className="h-2 w-2 rounded-full bg-green-500" />
+                    <div
+                      className={`h-2 w-2 rounded-full ${
+                        presence.idle ? "bg-yellow-500" : "bg-green-500"
+                      }`}
+                    />
                     <span className="text-xs text-muted-foreground">
-                      Active now
+                      {describePresence(presence)}
                     </span>
                   </div>
                 </div>
@@ -112,3 +128,39 @@ export const ConnectedUsers = ({ boardId }: ConnectedUsersProps) => {
     </div>
   );
 };
+
+interface CardPresenceProps {
+  cardId: string;
+}
+
+// CardPresence shows who else has a card open, the ones editing it get a ring
+export const CardPresence = ({ cardId }: CardPresenceProps) => {
+  const userId = useDesktopAuthStore((state) => state.userId);
+  const here = usePresenceByUser().filter(
+    (presence) =>
+      presence.user_id !== userId &&
+      (presence.focus?.id === cardId || presence.editing?.id === cardId)
+  );
+
+  if (here.length === 0) {
+    return null;
+  }
+
+  return (
+    <div className="flex -space-x-1">
+      {here.slice(0, 3).map((presence) => (
+        <Avatar
+          key={presence.user_id}
+          title={`${presence.name || "User"}: ${describePresence(presence)}`}
+          className={`h-5 w-5 border border-background ${
+            presence.editing?.id === cardId ? "ring-2 ring-primary" : ""
+          }`}
+        >
+          <AvatarFallback className="text-[9px] font-semibold">
+            {getInitials(presence)}
+          </AvatarFallback>
+        </Avatar>
+      ))}
+    </div>
+  );
+};
@@ -33,6 +33,7 @@ export const AppLayout = () => {
   const { token } = useDesktopAuthStore();
   const [importDialogOpen, setImportDialogOpen] = useState(false);
   const [boardIdToImport, setBoardIdToImport] = useState<string | undefined>();
+  const [inviteToImport, setInviteToImport] = useState<string | undefined>();
   const queryClient = useQueryClient();
   const { currentBoard } = useBoardStore();
   const {
@@ -157,13 +158,30 @@ export const AppLayout = () => {
     // Listen for board import deep link event
     const unsubscribeBoardImport = EventsOn(
       "board:import_request",
-      (data: { board_id: string }) => {
+      (data: { board_id: string; invite?: string }) => {
         console.log("Board import requested:", data.board_id);
         setBoardIdToImport(data.board_id);
+        setInviteToImport(data.invite || undefined);
         setImportDialogOpen(true);
       }
     );
 
+    // A shared board this account lost access to is archived by the sync engine
+    const unsubscribeBoardArchived = EventsOn(
+      "board:archived",
+      (data: { boardId: string }) => {
+        const { currentBoard, setCurrentBoard, fetchBoards } =
+          useBoardStore.getState();
+        if (currentBoard?.id === data.boardId) {
+          setCurrentBoard(null);
+        }
+        fetchBoards();
+        toast.info("You no longer have access to a shared board", {
+          description: "Its local copy was archived and stopped syncing.",
+        });
+      }
+    );
+
     // Global transcription event listeners
     const unsubscribeTranscription = EventsOn(
       "transcription",
@@ -411,6 +429,7 @@ export const AppLayout = () => {
       unsubscribeCloudSetupSuccess();
       unsubscribeCloudSetupFailed();
       unsubscribeBoardImport();
+      unsubscribeBoardArchived();
       unsubscribeTranscription();
       unsubscribeStructuredResponse();
       unsubscribeAudioBars();
@@ -497,6 +516,7 @@ export const AppLayout = () => {
         open={importDialogOpen}
         onOpenChange={setImportDialogOpen}
         boardId={boardIdToImport}
+        inviteToken={inviteToImport}
       />
       <ErrorListener />
     </>
@@ -1,6 +1,7 @@
 import axios, { AxiosInstance, AxiosRequestConfig } from "axios";
 import { useDesktopAuthStore } from "~/stores/auth-store";
 import { CLOUD_API_URL } from "./constants";
+import type { Presence } from "~/types/types";
 
 class ApiClientClass {
   private client: AxiosInstance;
@@ -76,13 +77,34 @@ class ApiClientClass {
 
 export const apiClient = new ApiClientClass();
 
+// member is what invites got before roles, it can do what an editor can
+export type BoardRole =
+  | "owner"
+  | "admin"
+  | "editor"
+  | "member"
+  | "commenter"
+  | "viewer";
+
 export interface BoardMember {
   user_id: string;
   email: string;
-  role: "owner" | "member";
+  role: BoardRole;
   joined_at: string;
 }
 
+export interface BoardInvitation {
+  id: string;
+  board_id: string;
+  board_name?: string;
+  email: string;
+  role: BoardRole;
+  created_at: string;
+  expires_at: string;
+  expired: boolean;
+  link?: string;
+}
+
 export interface BoardMetadata {
   id: string;
   name: string;
@@ -116,13 +138,38 @@ export interface NotificationsPaginatedResponse {
 }
 
 export const ApiClient = {
-  async inviteUserToBoard(email: string, boardId: string): Promise<void> {
+  async inviteUserToBoard(
+    email: string,
+    boardId: string
+  ): Promise<{ data: BoardInvitation; message: string }> {
     return apiClient.post("/board/invite", {
       email,
       board_id: boardId,
     });
   },
 
+  async getBoardInvitations(
+    boardId: string
+  ): Promise<{ data: BoardInvitation[]; message: string }> {
+    return apiClient.get(`/board/${boardId}/invitations`);
+  },
+
+  async revokeBoardInvitation(
+    boardId: string,
+    invitationId: string
+  ): Promise<void> {
+    return apiClient.delete(`/board/${boardId}/invitations/${invitationId}`);
+  },
+
+  async resendBoardInvitation(
+    boardId: string,
+    invitationId: string
+  ): Promise<{ data: BoardInvitation; message: string }> {
+    return apiClient.post(
+      `/board/${boardId}/invitations/${invitationId}/resend`
+    );
+  },
+
   async removeUserFromBoard(id: string, boardId: string): Promise<void> {
     return apiClient.post("/board/remove", {
       user_id: id,
@@ -130,6 +177,24 @@ export const ApiClient = {
     });
   },
 
+  async setBoardMemberRole(
+    boardId: string,
+    userId: string,
+    role: BoardRole
+  ): Promise<void> {
+    return apiClient.put(`/board/${boardId}/members/${userId}/role`, {
+      role,
+    });
+  },
+
+  async transferBoardOwnership(boardId: string, userId: string): Promise<void> {
+    return apiClient.post(`/board/${boardId}/transfer`, { user_id: userId });
+  },
+
+  async leaveBoard(boardId: string): Promise<void> {
+    return apiClient.post(`/board/${boardId}/leave`);
+  },
+
   async getBoardMembers(
     boardId: string
   ): Promise<{ data: BoardMember[]; message: string }> {
@@ -152,7 +217,7 @@ export const ApiClient = {
     return apiClient.post(`/notifications/${notificationId}/read`);
   },
 
-  async getConnectedUsers(boardId: string): Promise<{ data: string[] }> {
+  async getConnectedUsers(boardId: string): Promise<{ data: Presence[] }> {
     return apiClient.get(`/board/${boardId}/connected-users`);
   },
 
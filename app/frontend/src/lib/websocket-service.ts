@@ -5,28 +5,50 @@
 
 import { useDesktopAuthStore } from "~/stores/auth-store";
 import { WEBSOCKET_URL } from "./constants";
+import type { Presence, PresenceTarget } from "~/types/types";
+import { GetDeviceID, RecordEvent } from "../../wailsjs/go/main/App";
+
+// PROTOCOL_VERSION has to match the server's, it refuses envelopes of any other version
+export const PROTOCOL_VERSION = 1;
+
+// CollabMessage is an envelope, its id is also the id of the op the server stores it as
+export type CollabMessage = {
+  v: number;
+  id: string;
+  type: string;
+  data: unknown;
+  // the clock and fields of this device's copy of the op, the server stores the room's copy the same
+  hlc?: string;
+  fields?: string[];
+};
 
-export type CollabMessage =
+export type CollabResponse =
   | {
-      action: "create" | "join" | "leave" | "broadcast";
-      roomId?: string;
-      data?: string;
-      type?: string;
+      // an event another client sent, seq is where it landed in the server's op log
+      v: number;
+      id: string;
+      type: string;
+      from: string;
+      seq: number;
+      data: unknown;
     }
-  | Record<string, unknown>;
-
-export type CollabResponse =
   | {
-      status: "created" | "joined" | "left";
-      roomId: string;
+      v: number;
+      type: "ack" | "nack";
+      id?: string;
+      seq?: number;
+      error?: string;
     }
   | {
-      type: string;
-      from: string;
-      data: string;
+      type: "user_joined" | "user_left";
+      user_id: string;
+      users: string[];
+      presence: Presence[];
     }
   | {
-      error: string;
+      v: number;
+      type: "presence";
+      presence: Presence[];
     };
 
 type MessageHandler = (message: CollabResponse) => void;
@@ -47,6 +69,8 @@ class WebSocketService {
   private maxReconnectAttempts = 5;
   private reconnectDelay = 1000; // ms
   private isIntentionallyClosed = false;
+  // envelopes the server hasn't answered yet, they're sent again after a reconnect
+  private unacked: Map<string, CollabMessage> = new Map();
 
   constructor(url: string = WEBSOCKET_URL) {
     this.url = url;
@@ -70,9 +94,16 @@ class WebSocketService {
    * Connect to the WebSocket server
    */
   connect(): Promise<void> {
+    // the room is told which device this is so the events sent there are stored as its ops
+    return GetDeviceID()
+      .catch(() => null)
+      .then((deviceId) => this.open(deviceId));
+  }
+
+  private open(deviceId: string | null): Promise<void> {
     return new Promise((resolve, reject) => {
       try {
-        // Build WebSocket URL with auth token and board_id as query parameters
+        // Build WebSocket URL with auth token, board_id and device_id as query parameters
         const wsUrl = new URL(this.url);
         if (this.authToken) {
           wsUrl.searchParams.append("token", this.authToken);
@@ -80,6 +111,9 @@ class WebSocketService {
         if (this.boardId) {
           wsUrl.searchParams.append("board_id", this.boardId);
         }
+        if (deviceId) {
+          wsUrl.searchParams.append("device_id", deviceId);
+        }
 
         this.ws = new WebSocket(wsUrl.toString());
         this.isIntentionallyClosed = false;
@@ -87,6 +121,7 @@ class WebSocketService {
         this.ws.onopen = () => {
           console.log("WebSocket connected");
           this.reconnectAttempts = 0;
+          this.unacked.forEach((message) => this.sendMessage(message));
           this.connectionHandlers.forEach((handler) => handler());
           resolve();
         };
@@ -94,6 +129,13 @@ class WebSocketService {
         this.ws.onmessage = (event) => {
           try {
             const message: CollabResponse = JSON.parse(event.data);
+            if (
+              (message.type === "ack" || message.type === "nack") &&
+              "id" in message &&
+              message.id
+            ) {
+              this.unacked.delete(message.id);
+            }
             this.messageHandlers.forEach((handler) => handler(message));
           } catch (error) {
             console.error("Error parsing WebSocket message:", error);
@@ -137,6 +179,7 @@ class WebSocketService {
    */
   disconnect(): void {
     this.isIntentionallyClosed = true;
+    this.unacked.clear();
     if (this.ws) {
       this.ws.close();
       this.ws = null;
@@ -156,7 +199,10 @@ class WebSocketService {
       console.warn("WebSocket is not connected. Attempting to connect...");
       this.connect()
         .then(() => {
-          this.sendMessage(message);
+          // events still waiting for an ack were sent again as the socket opened
+          if (!this.unacked.has(message.id)) {
+            this.sendMessage(message);
+          }
         })
         .catch((error) => {
           console.error("Failed to reconnect and send message:", error);
@@ -169,31 +215,66 @@ class WebSocketService {
   }
 
   /**
-   * Create a new collaboration room
+   * Store an event's op on this device and send the event to everyone else on the board, resolves to the envelope id
+   * the ack will carry
    */
-  createRoom(): void {
-    this.send({ action: "create" });
-  }
+  async sendEvent(type: string, data: unknown): Promise<string> {
+    const id = crypto.randomUUID();
+    const stamp = await RecordEvent(type, JSON.stringify(data), id);
+
+    const message: CollabMessage = {
+      v: PROTOCOL_VERSION,
+      id,
+      type,
+      data,
+      hlc: stamp.hlc,
+      fields: stamp.fields || undefined,
+    };
 
-  /**
-   * Join an existing collaboration room
-   */
-  joinRoom(roomId: string): void {
-    this.send({ action: "join", roomId });
+    // without a session nothing is shared, the id still names the op stored locally
+    if (!this.authToken) {
+      return message.id;
+    }
+
+    this.unacked.set(message.id, message);
+    this.send(message);
+    return message.id;
   }
 
   /**
-   * Leave a collaboration room
+   * Say something in the board's room, a comment isn't stored so it isn't sent again after a reconnect
    */
-  leaveRoom(roomId: string): void {
-    this.send({ action: "leave", roomId });
+  sendComment(body: string, cardId?: string): void {
+    if (!this.isConnected()) {
+      return;
+    }
+
+    this.sendMessage({
+      v: PROTOCOL_VERSION,
+      id: crypto.randomUUID(),
+      type: "comment",
+      data: { body, card_id: cardId },
+    });
   }
 
   /**
-   * Broadcast a message to all clients in the room
+   * Send a presence heartbeat, it isn't stored so nothing waits for an ack
    */
-  broadcast(roomId: string, data: string): void {
-    this.send({ action: "broadcast", roomId, data });
+  sendPresence(presence: {
+    name?: string;
+    focus?: PresenceTarget | null;
+    editing?: PresenceTarget | null;
+  }): void {
+    if (!this.isConnected()) {
+      return;
+    }
+
+    this.sendMessage({
+      v: PROTOCOL_VERSION,
+      id: crypto.randomUUID(),
+      type: "presence",
+      data: presence,
+    });
   }
 
   /**
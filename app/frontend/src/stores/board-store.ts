@@ -9,7 +9,7 @@ import {
 } from "../../wailsjs/go/main/App";
 import { EventsEmit } from "../../wailsjs/runtime/runtime";
 import { useCollaborationStore } from "./collab-store";
-import { CollabMessage, wsService } from "~/lib/websocket-service";
+import { wsService } from "~/lib/websocket-service";
 
 // Helper interface for normalized board data used in components
 export interface NormalizedBoard {
@@ -118,25 +118,7 @@ export const useBoardStore = create<BoardState>()(
               updated_at: updatedAt,
             };
 
-            /*
-            msg := types.Message{
-							Action: "broadcast",
-							RoomID: roomID,
-							Data:   payload,
-							Type:   "board:data",
-						}
-            */
-
-            const msg: CollabMessage = {
-              action: "broadcast",
-              roomId: roomId,
-              data: JSON.stringify(payload),
-              type: "board:data",
-            };
-
-            wsService.send(msg);
-
-            EventsEmit("board:data", JSON.stringify(payload));
+            await wsService.sendEvent("board:data", payload);
 
             set((state) => ({
               boards: state.boards.map((b) =>
@@ -1,8 +1,15 @@
 import { create } from "zustand";
 import { toast } from "sonner";
 import { wsService, type CollabResponse } from "../lib/websocket-service";
+import { ApiClient } from "~/lib/api-client";
+import type { Presence, PresenceTarget } from "~/types/types";
 import { useDesktopAuthStore } from "./auth-store";
 
+// the server drops an editing state after 10s and focus after 30s without a heartbeat
+const HEARTBEAT_INTERVAL = 5000;
+// no heartbeats go out once the user stopped touching the app, the room then sees them go idle
+const ACTIVE_WINDOW = 60000;
+
 export type CollabStatus =
   | "disconnected"
   | "connected"
@@ -20,6 +27,11 @@ interface CollabState {
   lastError: string | null;
   isInitialized: boolean;
   eventUnsubscribers: Unsubscribe[];
+  presence: Presence[];
+  focus: PresenceTarget | null;
+  editing: PresenceTarget | null;
+  setFocus: (target: PresenceTarget | null) => void;
+  setEditing: (target: PresenceTarget | null) => void;
   initialize: (boardId: string) => void;
   reinitialize: (boardId: string) => void;
   teardown: () => void;
@@ -28,6 +40,11 @@ interface CollabState {
 
 const normalizeRoomId = (value: string) => value.trim();
 
+const sendHeartbeat = (focus: PresenceTarget | null, editing: PresenceTarget | null) => {
+  const { email } = useDesktopAuthStore.getState();
+  wsService.sendPresence({ name: email ?? undefined, focus, editing });
+};
+
 export const useCollaborationStore = create<CollabState>((set, get) => ({
   status: "disconnected",
   roomId: "",
@@ -35,6 +52,19 @@ export const useCollaborationStore = create<CollabState>((set, get) => ({
   lastError: null,
   isInitialized: false,
   eventUnsubscribers: [],
+  presence: [],
+  focus: null,
+  editing: null,
+
+  setFocus: (target: PresenceTarget | null) => {
+    set({ focus: target });
+    sendHeartbeat(target, get().editing);
+  },
+
+  setEditing: (target: PresenceTarget | null) => {
+    set({ editing: target });
+    sendHeartbeat(get().focus, target);
+  },
 
   reinitialize: (boardId: string) => {
     const state = get();
@@ -84,19 +114,41 @@ export const useCollaborationStore = create<CollabState>((set, get) => ({
       toast.success("Connected to collaboration", {
         description: "Real-time collaboration is active for this board",
       });
+
+      sendHeartbeat(get().focus, get().editing);
+      ApiClient.getConnectedUsers(boardId)
+        .then((res) => set({ presence: res.data ?? [] }))
+        .catch((error) => console.error("Failed to load presence", error));
     });
     unsubscribers.push(unsubConnect);
 
+    let lastActivity = Date.now();
+    const markActive = () => {
+      lastActivity = Date.now();
+    };
+    window.addEventListener("mousemove", markActive);
+    window.addEventListener("keydown", markActive);
+    const heartbeat = setInterval(() => {
+      if (Date.now() - lastActivity < ACTIVE_WINDOW) {
+        sendHeartbeat(get().focus, get().editing);
+      }
+    }, HEARTBEAT_INTERVAL);
+    unsubscribers.push(() => {
+      clearInterval(heartbeat);
+      window.removeEventListener("mousemove", markActive);
+      window.removeEventListener("keydown", markActive);
+    });
+
     const unsubMessage = wsService.onMessage((message: CollabResponse) => {
-      if ("type" in message && message.type === "message") {
-        console.log("Broadcast message:", message);
-        // Handle broadcast messages here
+      if ("presence" in message) {
+        set({ presence: message.presence ?? [] });
       }
 
-      if ("error" in message) {
-        const errorMsg = message.error;
-        set({ status: "error", lastError: errorMsg });
-        toast.error("Collaboration error", { description: errorMsg });
+      // the change is still saved locally and goes up with the next sync, only the room didn't hear of it
+      if (message.type === "nack" && "error" in message) {
+        const errorMsg = message.error ?? "Change was refused";
+        set({ lastError: errorMsg });
+        toast.error("Change wasn't shared", { description: errorMsg });
       }
     });
     unsubscribers.push(unsubMessage);
@@ -147,6 +199,9 @@ export const useCollaborationStore = create<CollabState>((set, get) => ({
       isInitialized: false,
       status: "disconnected",
       roomId: "",
+      presence: [],
+      focus: null,
+      editing: null,
     });
   },
 
@@ -96,3 +96,18 @@ export type WebSocketEvent =
   | { type: "card:data"; data: CardEventData }
   | { type: "card:delete"; data: CardDeleteEventData }
   | { type: "card:column"; data: CardColumnEventData };
+
+export interface PresenceTarget {
+  table: "cards" | "columns";
+  id: string;
+}
+
+// Presence is one connection in a board's room, focus and editing are gone once their heartbeat lapses
+export interface Presence {
+  user_id: string;
+  name?: string;
+  focus?: PresenceTarget;
+  editing?: PresenceTarget;
+  idle: boolean;
+  last_seen: string;
+}
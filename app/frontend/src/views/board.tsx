@@ -53,13 +53,10 @@ import {
   DialogHeader,
   DialogTitle,
 } from "~/components/ui/dialog";
-import { EventsEmit, EventsOn } from "../../wailsjs/runtime/runtime";
+import { EventsOn } from "../../wailsjs/runtime/runtime";
 import { useCollaborationStore } from "~/stores/collab-store";
-import {
-  CollabMessage,
-  wsService,
-  type CollabResponse,
-} from "~/lib/websocket-service";
+import { CardPresence } from "~/components/connected-users";
+import { wsService, type CollabResponse } from "~/lib/websocket-service";
 import type {
   BoardEventData,
   ColumnEventData,
@@ -127,7 +124,7 @@ export default function KanbanView() {
   >(null);
 
   const { currentBoard, setCurrentBoard } = useBoardStore();
-  const { roomId } = useCollaborationStore();
+  const { roomId, setFocus, setEditing } = useCollaborationStore();
   const {
     isOpen: isCommandPaletteOpen,
     open: openCommandPalette,
@@ -189,12 +186,12 @@ export default function KanbanView() {
     if (!roomId) return;
 
     const unsubscribe = wsService.onMessage((message: CollabResponse) => {
-      if ("data" in message && message.data) {
+      if ("seq" in message && "data" in message) {
         try {
           const eventType = message.type;
-          const eventData = JSON.parse(message.data);
+          const eventData = message.data as any;
 
-          console.log("Received WebSocket event:", eventType, eventData);
+          console.log("Received WebSocket event:", eventType, message.seq, eventData);
 
           switch (eventType) {
             case "board:data":
@@ -233,6 +230,26 @@ export default function KanbanView() {
     return () => unsubscribe();
   }, [roomId]);
 
+  // what the room sees this user doing, the store keeps it alive with heartbeats
+  const selectedCardId = selectedCard?.id;
+  useEffect(() => {
+    setFocus(
+      isCardDialogOpen && selectedCardId
+        ? { table: "cards", id: selectedCardId }
+        : null
+    );
+  }, [isCardDialogOpen, selectedCardId]);
+
+  useEffect(() => {
+    if ((isEditingTitle || isEditingDescription) && selectedCardId) {
+      setEditing({ table: "cards", id: selectedCardId });
+    } else if (editingColumnId) {
+      setEditing({ table: "columns", id: editingColumnId });
+    } else {
+      setEditing(null);
+    }
+  }, [isEditingTitle, isEditingDescription, selectedCardId, editingColumnId]);
+
   const handleRemoteBoardUpdate = (data: BoardEventData) => {
     if (currentBoard && currentBoard.id === data.id) {
       setCurrentBoard({
@@ -415,17 +432,7 @@ export default function KanbanView() {
                 index: cardIndex,
               };
 
-              const data = JSON.stringify(payload);
-
-              const msg: CollabMessage = {
-                action: "broadcast",
-                roomId: roomId,
-                data: JSON.stringify(payload),
-                type: "card:column",
-              };
-
-              wsService.send(msg);
-              EventsEmit("card:column", data);
+              await wsService.sendEvent("card:column", payload);
             }
           } catch (err) {
             console.error("Failed to update card column", err);
@@ -476,15 +483,7 @@ export default function KanbanView() {
           },
         };
 
-        const msg: CollabMessage = {
-          action: "broadcast",
-          roomId: roomId,
-          data: JSON.stringify(payload),
-          type: "card:create",
-        };
-
-        wsService.send(msg);
-        EventsEmit("card:create", JSON.stringify(payload));
+        await wsService.sendEvent("card:create", payload);
       }
 
       fetchBoard();
@@ -516,15 +515,7 @@ export default function KanbanView() {
         updated_at: updatedAt,
       };
 
-      const msg: CollabMessage = {
-        action: "broadcast",
-        roomId: roomId,
-        data: JSON.stringify(payload),
-        type: "column:create",
-      };
-
-      wsService.send(msg);
-      EventsEmit("column:create", JSON.stringify(payload));
+      await wsService.sendEvent("column:create", payload);
 
       fetchBoard();
     } catch (err) {
@@ -557,17 +548,7 @@ export default function KanbanView() {
         // TODO: handle editing column created_at & updated_at
       };
 
-      const data = JSON.stringify(payload);
-
-      const msg: CollabMessage = {
-        action: "broadcast",
-        roomId: roomId,
-        data: JSON.stringify(payload),
-        type: "column:data",
-      };
-
-      wsService.send(msg);
-      EventsEmit("column:data", data);
+      await wsService.sendEvent("column:data", payload);
     } catch (err) {
       console.error("Failed to update column", err);
     }
@@ -587,15 +568,7 @@ export default function KanbanView() {
         position: column?.position ?? 0,
       };
 
-      const msg: CollabMessage = {
-        action: "broadcast",
-        roomId: roomId,
-        data: JSON.stringify(payload),
-        type: "column:delete",
-      };
-
-      wsService.send(msg);
-      EventsEmit("column:delete", JSON.stringify(payload));
+      await wsService.sendEvent("column:delete", payload);
 
       fetchBoard();
     } catch (err) {
@@ -637,15 +610,7 @@ export default function KanbanView() {
         },
       };
 
-      const msg: CollabMessage = {
-        action: "broadcast",
-        roomId: roomId,
-        data: JSON.stringify(payload),
-        type: "card:delete",
-      };
-
-      wsService.send(msg);
-      EventsEmit("card:delete", JSON.stringify(payload));
+      await wsService.sendEvent("card:delete", payload);
 
       fetchBoard();
     } catch (err) {
@@ -702,18 +667,7 @@ export default function KanbanView() {
           },
         };
 
-        const data = JSON.stringify(payload);
-
-        const msg: CollabMessage = {
-          action: "broadcast",
-          roomId: roomId,
-          data: JSON.stringify(payload),
-          type: "card:data",
-        };
-
-        wsService.send(msg);
-
-        EventsEmit("card:data", data);
+        await wsService.sendEvent("card:data", payload);
       }
 
       setSelectedCard({ ...selectedCard, name: editingTitle });
@@ -762,18 +716,7 @@ export default function KanbanView() {
           },
         };
 
-        const data = JSON.stringify(payload);
-
-        const msg: CollabMessage = {
-          action: "broadcast",
-          roomId: roomId,
-          data: JSON.stringify(payload),
-          type: "card:data",
-        };
-
-        wsService.send(msg);
-
-        EventsEmit("card:data", data);
+        await wsService.sendEvent("card:data", payload);
       }
     } catch (err) {
       console.error("Failed to update description", err);
@@ -1018,6 +961,7 @@ export default function KanbanView() {
                                   <p className="m-0 flex-1 font-medium text-sm">
                                     {feature.name}
                                   </p>
+                                  <CardPresence cardId={feature.id} />
                                 </div>
 
                                 {feature.description && (
@@ -4,6 +4,10 @@ import {types} from '../models';
 import {query} from '../models';
 import {frontend} from '../models';
 import {main} from '../models';
+import {sync_engine} from '../models';
+import {lan} from '../models';
+
+export function AcceptBoardInvite(arg1:string):Promise<void>;
 
 export function CheckAccessibilityPermission():Promise<number>;
 
@@ -23,6 +27,10 @@ export function DeleteCard(arg1:string):Promise<void>;
 
 export function DeleteColumn(arg1:string):Promise<void>;
 
+export function DiscoverLanDevices():Promise<Array<lan.Announcement>>;
+
+export function EnableEncryption(arg1:string):Promise<void>;
+
 export function GetBoardByID(arg1:string):Promise<types.ExportedBoard>;
 
 export function GetBoards(arg1:number,arg2:number):Promise<Array<types.ExportedBoard>>;
@@ -37,12 +45,16 @@ export function GetColumn(arg1:string):Promise<types.ExportedColumn>;
 
 export function GetCurrentBoardId():Promise<string>;
 
+export function GetDeviceID():Promise<string>;
+
 export function GetLoginToken():Promise<string>;
 
 export function GetPlatformInfo():Promise<Record<string, any>>;
 
 export function GetSettings():Promise<query.Setting>;
 
+export function GetSyncStatus():Promise<sync_engine.SyncStatus>;
+
 export function GetTranscriptionByID(arg1:string):Promise<types.ExportedTranscription>;
 
 export function GetTranscriptions(arg1:string,arg2:number,arg3:number):Promise<Array<types.ExportedTranscription>>;
@@ -51,22 +63,44 @@ export function GetWebURL():Promise<string>;
 
 export function Greet(arg1:string):Promise<string>;
 
+export function HostLanSync():Promise<string>;
+
 export function ImportNewBoard(arg1:string):Promise<void>;
 
 export function InstallUpdate(arg1:types.AppVersion):Promise<void>;
 
+export function IsEncryptionEnabled():Promise<boolean>;
+
 export function ListCardsByColumn(arg1:string):Promise<Array<types.ExportedCard>>;
 
 export function ListColumnsByBoard(arg1:string):Promise<Array<types.ExportedColumn>>;
 
+export function ListDevices():Promise<Array<types.Device>>;
+
+export function ListLanPeers():Promise<Array<types.Device>>;
+
+export function ListSyncConflicts():Promise<Array<types.SyncConflict>>;
+
+export function ListTrash():Promise<Array<types.TrashItem>>;
+
 export function OpenAccessibilitySettings():Promise<void>;
 
 export function OpenFileDialog(arg1:string,arg2:Array<frontend.FileFilter>):Promise<string>;
 
 export function OpenMicrophoneSettings():Promise<void>;
 
+export function PairLanDevice(arg1:string,arg2:string):Promise<query.Setting>;
+
+export function PlanSync(arg1:string):Promise<types.SyncPlan>;
+
 export function ReadAudioFile(arg1:string):Promise<main.AudioResponse>;
 
+export function ReapplyConflict(arg1:string):Promise<void>;
+
+export function RecordEvent(arg1:string,arg2:string,arg3:string):Promise<types.EventStamp>;
+
+export function RemoveLanPeer(arg1:string):Promise<void>;
+
 export function ReprocessTranscription(arg1:string,arg2:string,arg3:string):Promise<void>;
 
 export function RequestAccessibilityPermission():Promise<void>;
@@ -75,12 +109,20 @@ export function RequestMicrophonePermission():Promise<boolean>;
 
 export function RestartApp():Promise<void>;
 
+export function RestoreFromTrash(arg1:string,arg2:string):Promise<void>;
+
+export function RevokeDevice(arg1:string):Promise<void>;
+
 export function SaveSettings(arg1:string,arg2:any,arg3:any,arg4:any):Promise<query.Setting>;
 
+export function SaveSyncBackend(arg1:string,arg2:string,arg3:any,arg4:any):Promise<query.Setting>;
+
 export function SetCurrentBoardId(arg1:string):Promise<void>;
 
 export function SetLoginToken(arg1:string):Promise<void>;
 
+export function SyncNow():Promise<void>;
+
 export function UpdateBoard(arg1:string,arg2:string):Promise<types.ExportedBoard>;
 
 export function UpdateCard(arg1:string,arg2:string,arg3:string):Promise<types.ExportedCard>;
@@ -2,6 +2,10 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AcceptBoardInvite(arg1) {
+  return window['go']['main']['App']['AcceptBoardInvite'](arg1);
+}
+
 export function CheckAccessibilityPermission() {
   return window['go']['main']['App']['CheckAccessibilityPermission']();
 }
@@ -38,6 +42,14 @@ export function DeleteColumn(arg1) {
   return window['go']['main']['App']['DeleteColumn'](arg1);
 }
 
+export function DiscoverLanDevices() {
+  return window['go']['main']['App']['DiscoverLanDevices']();
+}
+
+export function EnableEncryption(arg1) {
+  return window['go']['main']['App']['EnableEncryption'](arg1);
+}
+
 export function GetBoardByID(arg1) {
   return window['go']['main']['App']['GetBoardByID'](arg1);
 }
@@ -66,6 +78,10 @@ export function GetCurrentBoardId() {
   return window['go']['main']['App']['GetCurrentBoardId']();
 }
 
+export function GetDeviceID() {
+  return window['go']['main']['App']['GetDeviceID']();
+}
+
 export function GetLoginToken() {
   return window['go']['main']['App']['GetLoginToken']();
 }
@@ -78,6 +94,10 @@ export function GetSettings() {
   return window['go']['main']['App']['GetSettings']();
 }
 
+export function GetSyncStatus() {
+  return window['go']['main']['App']['GetSyncStatus']();
+}
+
 export function GetTranscriptionByID(arg1) {
   return window['go']['main']['App']['GetTranscriptionByID'](arg1);
 }
@@ -94,6 +114,10 @@ export function Greet(arg1) {
   return window['go']['main']['App']['Greet'](arg1);
 }
 
+export function HostLanSync() {
+  return window['go']['main']['App']['HostLanSync']();
+}
+
 export function ImportNewBoard(arg1) {
   return window['go']['main']['App']['ImportNewBoard'](arg1);
 }
@@ -102,6 +126,10 @@ export function InstallUpdate(arg1) {
   return window['go']['main']['App']['InstallUpdate'](arg1);
 }
 
+export function IsEncryptionEnabled() {
+  return window['go']['main']['App']['IsEncryptionEnabled']();
+}
+
 export function ListCardsByColumn(arg1) {
   return window['go']['main']['App']['ListCardsByColumn'](arg1);
 }
@@ -110,6 +138,22 @@ export function ListColumnsByBoard(arg1) {
   return window['go']['main']['App']['ListColumnsByBoard'](arg1);
 }
 
+export function ListDevices() {
+  return window['go']['main']['App']['ListDevices']();
+}
+
+export function ListLanPeers() {
+  return window['go']['main']['App']['ListLanPeers']();
+}
+
+export function ListSyncConflicts() {
+  return window['go']['main']['App']['ListSyncConflicts']();
+}
+
+export function ListTrash() {
+  return window['go']['main']['App']['ListTrash']();
+}
+
 export function OpenAccessibilitySettings() {
   return window['go']['main']['App']['OpenAccessibilitySettings']();
 }
@@ -122,10 +166,30 @@ export function OpenMicrophoneSettings() {
   return window['go']['main']['App']['OpenMicrophoneSettings']();
 }
 
+export function PairLanDevice(arg1, arg2) {
+  return window['go']['main']['App']['PairLanDevice'](arg1, arg2);
+}
+
+export function PlanSync(arg1) {
+  return window['go']['main']['App']['PlanSync'](arg1);
+}
+
 export function ReadAudioFile(arg1) {
   return window['go']['main']['App']['ReadAudioFile'](arg1);
 }
 
+export function ReapplyConflict(arg1) {
+  return window['go']['main']['App']['ReapplyConflict'](arg1);
+}
+
+export function RecordEvent(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RecordEvent'](arg1, arg2, arg3);
+}
+
+export function RemoveLanPeer(arg1) {
+  return window['go']['main']['App']['RemoveLanPeer'](arg1);
+}
+
 export function ReprocessTranscription(arg1, arg2, arg3) {
   return window['go']['main']['App']['ReprocessTranscription'](arg1, arg2, arg3);
 }
@@ -142,10 +206,22 @@ export function RestartApp() {
   return window['go']['main']['App']['RestartApp']();
 }
 
+export function RestoreFromTrash(arg1, arg2) {
+  return window['go']['main']['App']['RestoreFromTrash'](arg1, arg2);
+}
+
+export function RevokeDevice(arg1) {
+  return window['go']['main']['App']['RevokeDevice'](arg1);
+}
+
 export function SaveSettings(arg1, arg2, arg3, arg4) {
   return window['go']['main']['App']['SaveSettings'](arg1, arg2, arg3, arg4);
 }
 
+export function SaveSyncBackend(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['SaveSyncBackend'](arg1, arg2, arg3, arg4);
+}
+
 export function SetCurrentBoardId(arg1) {
   return window['go']['main']['App']['SetCurrentBoardId'](arg1);
 }
@@ -154,6 +230,10 @@ export function SetLoginToken(arg1) {
   return window['go']['main']['App']['SetLoginToken'](arg1);
 }
 
+export function SyncNow() {
+  return window['go']['main']['App']['SyncNow']();
+}
+
 export function UpdateBoard(arg1, arg2) {
   return window['go']['main']['App']['UpdateBoard'](arg1, arg2);
 }
@@ -17,6 +17,52 @@ export namespace frontend {
 
 }
 
+export namespace lan {
+	
+	export class Announcement {
+	    service: string;
+	    device_id: string;
+	    name: string;
+	    port: number;
+	    address?: string;
+	    // Go type: time
+	    seen_at?: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new Announcement(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.service = source["service"];
+	        this.device_id = source["device_id"];
+	        this.name = source["name"];
+	        this.port = source["port"];
+	        this.address = source["address"];
+	        this.seen_at = this.convertValues(source["seen_at"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
 export namespace main {
 	
 	export class AudioResponse {
@@ -44,6 +90,10 @@ export namespace query {
 	    OpenaiApiKey: sql.NullString;
 	    CreatedAt: sql.NullString;
 	    UpdatedAt: sql.NullString;
+	    SyncBackend: string;
+	    SyncLocation: sql.NullString;
+	    SyncAccessKey: sql.NullString;
+	    SyncSecretKey: sql.NullString;
 	
 	    static createFrom(source: any = {}) {
 	        return new Setting(source);
@@ -58,6 +108,10 @@ export namespace query {
 	        this.OpenaiApiKey = this.convertValues(source["OpenaiApiKey"], sql.NullString);
 	        this.CreatedAt = this.convertValues(source["CreatedAt"], sql.NullString);
 	        this.UpdatedAt = this.convertValues(source["UpdatedAt"], sql.NullString);
+	        this.SyncBackend = source["SyncBackend"];
+	        this.SyncLocation = this.convertValues(source["SyncLocation"], sql.NullString);
+	        this.SyncAccessKey = this.convertValues(source["SyncAccessKey"], sql.NullString);
+	        this.SyncSecretKey = this.convertValues(source["SyncSecretKey"], sql.NullString);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -100,6 +154,29 @@ export namespace sql {
 
 }
 
+export namespace sync_engine {
+	
+	export class SyncStatus {
+	    state: string;
+	    last_error?: string;
+	    last_synced_at?: number;
+	    next_retry_at?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.state = source["state"];
+	        this.last_error = source["last_error"];
+	        this.last_synced_at = source["last_synced_at"];
+	        this.next_retry_at = source["next_retry_at"];
+	    }
+	}
+
+}
+
 export namespace types {
 	
 	export class AppVersion {
@@ -120,6 +197,44 @@ export namespace types {
 	        this.sha256 = source["sha256"];
 	    }
 	}
+	export class Device {
+	    id: string;
+	    name: string;
+	    created_at: string;
+	    last_seen_at: string;
+	    revoked_at?: string;
+	    current: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Device(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.created_at = source["created_at"];
+	        this.last_seen_at = source["last_seen_at"];
+	        this.revoked_at = source["revoked_at"];
+	        this.current = source["current"];
+	    }
+	}
+	export class EventStamp {
+	    id: string;
+	    hlc: string;
+	    fields: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new EventStamp(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.hlc = source["hlc"];
+	        this.fields = source["fields"];
+	    }
+	}
 	export class ExportedBoard {
 	    id: string;
 	    name: string;
@@ -210,6 +325,140 @@ export namespace types {
 	        this.updated_at = source["updated_at"];
 	    }
 	}
+	export class OperationSync {
+	    id: string;
+	    table_name: string;
+	    record_id: string;
+	    operation_type: string;
+	    device_id: string;
+	    payload: string;
+	    created_at: string;
+	    updated_at: string;
+	    hlc: string;
+	    fields: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new OperationSync(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.table_name = source["table_name"];
+	        this.record_id = source["record_id"];
+	        this.operation_type = source["operation_type"];
+	        this.device_id = source["device_id"];
+	        this.payload = source["payload"];
+	        this.created_at = source["created_at"];
+	        this.updated_at = source["updated_at"];
+	        this.hlc = source["hlc"];
+	        this.fields = source["fields"];
+	    }
+	}
+	export class SyncConflict {
+	    id: string;
+	    table_name: string;
+	    record_id: string;
+	    local: OperationSync;
+	    remote: OperationSync;
+	    winner: string;
+	    reason: string;
+	    fields: string[];
+	    created_at: string;
+	    resolved_at?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncConflict(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.table_name = source["table_name"];
+	        this.record_id = source["record_id"];
+	        this.local = this.convertValues(source["local"], OperationSync);
+	        this.remote = this.convertValues(source["remote"], OperationSync);
+	        this.winner = source["winner"];
+	        this.reason = source["reason"];
+	        this.fields = source["fields"];
+	        this.created_at = source["created_at"];
+	        this.resolved_at = source["resolved_at"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SyncPlan {
+	    table_name: string;
+	    push: OperationSync[];
+	    pull: OperationSync[];
+	    conflicts: SyncConflict[];
+	    deletes: OperationSync[];
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncPlan(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.table_name = source["table_name"];
+	        this.push = this.convertValues(source["push"], OperationSync);
+	        this.pull = this.convertValues(source["pull"], OperationSync);
+	        this.conflicts = this.convertValues(source["conflicts"], SyncConflict);
+	        this.deletes = this.convertValues(source["deletes"], OperationSync);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class TrashItem {
+	    table_name: string;
+	    id: string;
+	    title: string;
+	    deleted_at: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TrashItem(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.table_name = source["table_name"];
+	        this.id = source["id"];
+	        this.title = source["title"];
+	        this.deleted_at = source["deleted_at"];
+	    }
+	}
 
 }
 
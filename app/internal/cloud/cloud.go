@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"seisami/app/internal/e2e"
 	"seisami/app/internal/repo"
 	"seisami/app/internal/repo/sqlc/query"
 	"seisami/app/types"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -20,6 +24,10 @@ type cloudFuncs struct {
 	ctx          context.Context
 	cloudApiUrl  string
 	httpClient   http.Client
+	// sent as X-Device-ID, read from app_meta on first use
+	deviceID string
+	// seals pushed ops when end to end encryption is on, see keys.go
+	keyring *e2e.Keyring
 }
 
 func NewCloudFuncs(repo repo.Repository, sessionToken string, ctx context.Context, cloudApiUrl string) *cloudFuncs {
@@ -31,6 +39,8 @@ func NewCloudFuncs(repo repo.Repository, sessionToken string, ctx context.Contex
 		ctx,
 		cloudApiUrl,
 		httpClient,
+		"",
+		nil,
 	}
 }
 
@@ -40,6 +50,7 @@ func (cf *cloudFuncs) GetAllOperations(tableName types.TableName, since int64) H
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "failed to get all operations",
 		}
 	}
@@ -49,10 +60,26 @@ func (cf *cloudFuncs) GetAllOperations(tableName types.TableName, since int64) H
 	}
 }
 
+// ErrUnreachable marks requests that never got a response, match it with errors.Is on HttpResponse.Err
+var ErrUnreachable = errors.New("cloud unreachable")
+
 type HttpResponse struct {
 	Message string `json:"message,omitempty"`
 	Data    any    `json:"data,omitempty"`
 	Error   string `json:"error,omitempty"`
+	// the error behind Error, when it came from one
+	err error
+}
+
+// Err is the error of a failed response with what caused it still wrapped, nil when it went through
+func (r HttpResponse) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.Error != "" {
+		return errors.New(r.Error)
+	}
+	return nil
 }
 
 func (cf *cloudFuncs) buildURL(path string) string {
@@ -95,10 +122,13 @@ func (cf *cloudFuncs) doJSONRequest(method, path string, payload any) (int, []by
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cf.sessionToken))
+	if deviceID := cf.getDeviceID(); deviceID != "" {
+		req.Header.Set("X-Device-ID", deviceID)
+	}
 
 	res, err := cf.httpClient.Do(req)
 	if err != nil {
-		return 0, nil, fmt.Errorf("execute request: %w", err)
+		return 0, nil, fmt.Errorf("execute request: %w: %v", ErrUnreachable, err)
 	}
 	defer res.Body.Close()
 
@@ -124,10 +154,29 @@ func (cf *cloudFuncs) postSyncResource(path string, payload any) error {
 }
 
 func (cf *cloudFuncs) PushRecord(payload types.OperationSync) HttpResponse {
-	status, resBody, err := cf.doJSONRequest(http.MethodPost, "/sync/upload", payload)
+	tableName, err := types.TableNameFromString(payload.TableName)
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
+			Message: "unable to sync data",
+		}
+	}
+
+	sealed, pending, err := cf.sealOps(tableName, []types.OperationSync{payload})
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to encrypt data",
+		}
+	}
+
+	status, resBody, err := cf.doJSONRequest(http.MethodPost, "/sync/upload", sealed[0])
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
 			Message: "unable to sync data",
 		}
 	}
@@ -138,6 +187,7 @@ func (cf *cloudFuncs) PushRecord(payload types.OperationSync) HttpResponse {
 			Message: "error syncing data",
 		}
 	}
+	cf.sharePendingKeys(pending)
 
 	return HttpResponse{
 		Error:   "",
@@ -146,25 +196,195 @@ func (cf *cloudFuncs) PushRecord(payload types.OperationSync) HttpResponse {
 	}
 }
 
-func (cf *cloudFuncs) PullRecord(tableName types.TableName, since int64) HttpResponse {
-	operations, err := cf.PullRecords(tableName, since)
+// LostBoard is the Data of a push the cloud refused because the account isn't on BoardID anymore
+type LostBoard struct {
+	BoardID string
+}
+
+// lostBoardError is a batch refused for a board the account lost, see LostBoard
+type lostBoardError struct {
+	boardID string
+	message string
+}
+
+func (e *lostBoardError) Error() string {
+	return fmt.Sprintf("api request failed with status %d: %s", http.StatusForbidden, e.message)
+}
+
+func (cf *cloudFuncs) syncBatch(req types.SyncBatchRequest) (types.SyncBatchResult, error) {
+	status, resBody, err := cf.doJSONRequest(http.MethodPost, "/sync/batch", req)
+	if err != nil {
+		return types.SyncBatchResult{}, fmt.Errorf("unable to sync batch: %w", err)
+	}
+
+	if status == http.StatusForbidden {
+		var refused struct {
+			Error   string `json:"error"`
+			BoardID string `json:"board_id"`
+		}
+		if json.Unmarshal(resBody, &refused) == nil && refused.BoardID != "" {
+			return types.SyncBatchResult{}, &lostBoardError{boardID: refused.BoardID, message: refused.Error}
+		}
+	}
+
+	if status != http.StatusOK {
+		return types.SyncBatchResult{}, fmt.Errorf("api request failed with status %d: %s", status, string(resBody))
+	}
+
+	var result types.SyncBatchResult
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return types.SyncBatchResult{}, fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	return result, nil
+}
+
+// PushBatch sends ops in one request, the server applies all of them except the ones it lists as rejected
+func (cf *cloudFuncs) PushBatch(tableName types.TableName, ops []types.OperationSync) HttpResponse {
+	sealed, pending, err := cf.sealOps(tableName, ops)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to encrypt batch",
+		}
+	}
+
+	result, err := cf.syncBatch(types.SyncBatchRequest{
+		TableName:  tableName.String(),
+		Operations: sealed,
+	})
+	var lost *lostBoardError
+	if errors.As(err, &lost) {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "lost access to board",
+			Data:    LostBoard{BoardID: lost.boardID},
+		}
+	}
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to push batch",
+		}
+	}
+	cf.sharePendingKeys(pending)
+
+	return HttpResponse{
+		Message: "batch synced successfully",
+		Data:    result,
+	}
+}
+
+// PullBatch returns at most q.Limit of the server's ops since the sync state, starting after q.Cursor
+func (cf *cloudFuncs) PullBatch(tableName types.TableName, q types.PullQuery) HttpResponse {
+	result, err := cf.syncBatch(types.SyncBatchRequest{
+		TableName: tableName.String(),
+		Since:     q.Since,
+		After:     q.After,
+		Cursor:    q.Cursor,
+		Limit:     q.Limit,
+		Summary:   q.Summary,
+	})
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
-			Message: "unable to pull record",
+			err:     err,
+			Message: "unable to pull batch",
+		}
+	}
+
+	return HttpResponse{
+		Message: "batch retrieved successfully",
+		Data:    result,
+	}
+}
+
+// PullRecord returns the latest op of one record since the sync state
+func (cf *cloudFuncs) PullRecord(tableName types.TableName, recordID string, since int64) HttpResponse {
+	resp := cf.PullRecordsPage(tableName, types.PullQuery{Since: since, RecordIDs: []string{recordID}})
+	if resp.Error != "" {
+		return resp
+	}
+
+	page := resp.Data.(types.SyncBatchResult)
+	for _, op := range page.Operations {
+		if op.RecordID == recordID {
+			return HttpResponse{
+				Message: "record retrieved successfully",
+				Data:    op,
+			}
+		}
+	}
+
+	return HttpResponse{
+		Error:   fmt.Sprintf("no operations available for record %s in table %s", recordID, tableName.String()),
+		Message: "no records found",
+	}
+}
+
+// PullRecordsPage returns one page of the server's ops, narrowed down to q.RecordIDs when set
+func (cf *cloudFuncs) PullRecordsPage(tableName types.TableName, q types.PullQuery) HttpResponse {
+	params := url.Values{}
+	params.Set("since", strconv.FormatInt(q.Since, 10))
+	if q.After != "" {
+		params.Set("after", q.After)
+	}
+	if len(q.RecordIDs) > 0 {
+		params.Set("record_ids", strings.Join(q.RecordIDs, ","))
+	}
+	if q.Cursor != "" {
+		params.Set("cursor", q.Cursor)
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Summary {
+		params.Set("summary", "true")
+	}
+
+	status, resBody, err := cf.doJSONRequest(http.MethodGet, fmt.Sprintf("/sync/pull/%s?%s", tableName.String(), params.Encode()), nil)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to pull records",
 		}
 	}
 
-	if len(operations) == 0 {
+	if status != http.StatusOK {
 		return HttpResponse{
-			Error:   fmt.Sprintf("no operations available for table %s", tableName.String()),
-			Message: "no records found",
+			Error:   string(resBody),
+			Message: fmt.Sprintf("api request failed with status %d", status),
 		}
 	}
 
+	var response struct {
+		Operations []types.OperationSync `json:"operations"`
+		NextCursor string                `json:"next_cursor"`
+		HasMore    bool                  `json:"has_more"`
+		Position   string                `json:"position"`
+	}
+
+	if err := json.Unmarshal(resBody, &response); err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to decode response",
+		}
+	}
+	cf.loadSealedBoardKeys(response.Operations)
+
 	return HttpResponse{
-		Message: "record retrieved successfully",
-		Data:    operations[0],
+		Message: "records retrieved successfully",
+		Data: types.SyncBatchResult{
+			Operations: response.Operations,
+			Cursor:     response.NextCursor,
+			HasMore:    response.HasMore,
+			Position:   response.Position,
+		},
 	}
 }
 
@@ -196,6 +416,7 @@ func (cf *cloudFuncs) PullRecordsV2(tableName types.TableName, since int64) Http
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to pull records",
 		}
 	}
@@ -216,6 +437,7 @@ func (cf *cloudFuncs) PullRecordsV2(tableName types.TableName, since int64) Http
 	if err := json.Unmarshal(resBody, &response); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to decode response",
 		}
 	}
@@ -231,6 +453,7 @@ func (cf *cloudFuncs) GetSyncState(tableName types.TableName) HttpResponse {
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to get sync state",
 		}
 	}
@@ -246,6 +469,7 @@ func (cf *cloudFuncs) GetSyncState(tableName types.TableName) HttpResponse {
 	if err := json.Unmarshal(resBody, &response); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to deserialize data",
 		}
 	}
@@ -254,6 +478,7 @@ func (cf *cloudFuncs) GetSyncState(tableName types.TableName) HttpResponse {
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to re-marshal data",
 		}
 	}
@@ -262,6 +487,7 @@ func (cf *cloudFuncs) GetSyncState(tableName types.TableName) HttpResponse {
 	if err := json.Unmarshal(dataBytes, &syncState); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to decode sync state",
 		}
 	}
@@ -282,6 +508,7 @@ func (cf *cloudFuncs) UpdateSyncState(state query.SyncState) HttpResponse {
 	if err := cf.postSyncResource("/sync/state", payload); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to update sync state",
 		}
 	}
@@ -295,6 +522,7 @@ func (cf *cloudFuncs) UpsertBoard(board types.ExportedBoard) HttpResponse {
 	if err := cf.postSyncResource("/sync/board", board); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to upsert board",
 		}
 	}
@@ -308,6 +536,7 @@ func (cf *cloudFuncs) UpsertColumn(column types.ExportedColumn) HttpResponse {
 	if err := cf.postSyncResource("/sync/column", column); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to upsert column",
 		}
 	}
@@ -321,6 +550,7 @@ func (cf *cloudFuncs) UpsertCard(card types.ExportedCard) HttpResponse {
 	if err := cf.postSyncResource("/sync/card", card); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to upsert card",
 		}
 	}
@@ -334,6 +564,7 @@ func (cf *cloudFuncs) InitializeSyncStateForUser() HttpResponse {
 	if err := cf.postSyncResource("/sync/init", nil); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to init sync state",
 		}
 	}
@@ -353,12 +584,19 @@ Then when it has pulled all the data for a particular board, the user will now u
 I think this is perfect.
 */
 
-func (cf *cloudFuncs) ImportBoardData(boardId string) HttpResponse {
-	status, body, err := cf.doJSONRequest("GET", "/sync/export/"+boardId, nil)
+// ImportBoardData downloads a whole board, or with since > 0 only what changed after that board version
+func (cf *cloudFuncs) ImportBoardData(boardId string, since int64) HttpResponse {
+	path := "/sync/export/" + boardId
+	if since > 0 {
+		path += "?since=" + strconv.FormatInt(since, 10)
+	}
+
+	status, body, err := cf.doJSONRequest("GET", path, nil)
 
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to import board data",
 		}
 	}
@@ -368,6 +606,7 @@ func (cf *cloudFuncs) ImportBoardData(boardId string) HttpResponse {
 	if err = json.Unmarshal(body, &httpResp); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to unmarshal body",
 		}
 	}
@@ -383,16 +622,27 @@ func (cf *cloudFuncs) ImportBoardData(boardId string) HttpResponse {
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to re-marshal data",
 		}
 	}
 
+	dataBytes, err = cf.openExport(dataBytes)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to decrypt data",
+		}
+	}
+
 	var data types.ImportUserBoardData
 
 	err = json.Unmarshal(dataBytes, &data)
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to decode board data",
 		}
 	}
@@ -409,6 +659,7 @@ func (cf *cloudFuncs) ImportAllUserData() HttpResponse {
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to import user data",
 		}
 	}
@@ -418,6 +669,7 @@ func (cf *cloudFuncs) ImportAllUserData() HttpResponse {
 	if err = json.Unmarshal(body, &httpResp); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to unmarshal body",
 		}
 	}
@@ -433,16 +685,27 @@ func (cf *cloudFuncs) ImportAllUserData() HttpResponse {
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to re-marshal data",
 		}
 	}
 
+	dataBytes, err = cf.openExport(dataBytes)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to decrypt data",
+		}
+	}
+
 	var data types.ExportedData
 
 	err = json.Unmarshal(dataBytes, &data)
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to decode user data",
 		}
 	}
@@ -457,6 +720,7 @@ func (cf *cloudFuncs) InitCloud() HttpResponse {
 	if err := cf.postSyncResource("/init/cloud", nil); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to init cloud status",
 		}
 	}
@@ -472,6 +736,7 @@ func (cf *cloudFuncs) FetchAppVersion() HttpResponse {
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to fetch app version",
 		}
 	}
@@ -488,6 +753,7 @@ func (cf *cloudFuncs) FetchAppVersion() HttpResponse {
 	if err = json.Unmarshal(body, &httpResp); err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to unmarshal body",
 		}
 	}
@@ -496,6 +762,7 @@ func (cf *cloudFuncs) FetchAppVersion() HttpResponse {
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to re-marshal data",
 		}
 	}
@@ -506,6 +773,7 @@ func (cf *cloudFuncs) FetchAppVersion() HttpResponse {
 	if err != nil {
 		return HttpResponse{
 			Error:   err.Error(),
+			err:     err,
 			Message: "unable to decode app version",
 		}
 	}
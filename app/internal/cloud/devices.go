@@ -0,0 +1,111 @@
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"seisami/app/types"
+)
+
+// getDeviceID is this install's id, every request carries it so the cloud keeps a sync cursor per device
+func (cf *cloudFuncs) getDeviceID() string {
+	if cf.deviceID != "" || cf.repo == nil {
+		return cf.deviceID
+	}
+
+	deviceID, err := cf.repo.GetDeviceID()
+	if err != nil {
+		fmt.Printf("unable to get device id: %v\n", err)
+		return ""
+	}
+
+	cf.deviceID = deviceID
+	return deviceID
+}
+
+// RegisterDevice names this install in the user's device list, the cloud also registers it on the first sync
+func (cf *cloudFuncs) RegisterDevice(name string) HttpResponse {
+	payload := map[string]string{"id": cf.getDeviceID(), "name": name}
+
+	status, body, err := cf.doJSONRequest(http.MethodPost, "/devices", payload)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to register device",
+		}
+	}
+
+	if status != http.StatusOK {
+		return HttpResponse{
+			Error:   string(body),
+			Message: fmt.Sprintf("devices api returned status %d", status),
+		}
+	}
+
+	return HttpResponse{
+		Message: "device registered successfully",
+	}
+}
+
+func (cf *cloudFuncs) ListDevices() HttpResponse {
+	status, body, err := cf.doJSONRequest(http.MethodGet, "/devices", nil)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to list devices",
+		}
+	}
+
+	if status != http.StatusOK {
+		return HttpResponse{
+			Error:   string(body),
+			Message: fmt.Sprintf("devices api returned status %d", status),
+		}
+	}
+
+	var response struct {
+		Data []types.Device `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to decode devices",
+		}
+	}
+
+	for i := range response.Data {
+		response.Data[i].Current = response.Data[i].ID == cf.getDeviceID()
+	}
+
+	return HttpResponse{
+		Message: "devices retrieved successfully",
+		Data:    response.Data,
+	}
+}
+
+// RevokeDevice stops an install of this account from syncing, its ops already in the cloud stay
+func (cf *cloudFuncs) RevokeDevice(deviceID string) HttpResponse {
+	status, body, err := cf.doJSONRequest(http.MethodDelete, "/devices/"+url.PathEscape(deviceID), nil)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to revoke device",
+		}
+	}
+
+	if status != http.StatusOK {
+		return HttpResponse{
+			Error:   string(body),
+			Message: fmt.Sprintf("devices api returned status %d", status),
+		}
+	}
+
+	return HttpResponse{
+		Message: "device revoked successfully",
+	}
+}
@@ -7,9 +7,12 @@ import (
 
 type Cloud interface {
 	GetAllOperations(tableName types.TableName, since int64) HttpResponse
-	PullRecord(tableName types.TableName, since int64) HttpResponse
+	PullRecord(tableName types.TableName, recordID string, since int64) HttpResponse
+	PullRecordsPage(tableName types.TableName, q types.PullQuery) HttpResponse
 	PullRecords(tableName types.TableName, since int64) ([]types.OperationSync, error)
 	PushRecord(op types.OperationSync) HttpResponse
+	PushBatch(tableName types.TableName, ops []types.OperationSync) HttpResponse
+	PullBatch(tableName types.TableName, q types.PullQuery) HttpResponse
 	UpdateSyncState(state query.SyncState) HttpResponse
 	GetSyncState(tableName types.TableName) HttpResponse
 
@@ -18,11 +21,20 @@ type Cloud interface {
 	UpsertCard(types.ExportedCard) HttpResponse
 	InitializeSyncStateForUser() HttpResponse
 
-	ImportBoardData(boardId string) HttpResponse
+	ImportBoardData(boardId string, since int64) HttpResponse
 	UpdateSessionToken(token string)
 
 	InitCloud() HttpResponse
 	FetchAppVersion() HttpResponse
 
 	ImportAllUserData() HttpResponse
+
+	RegisterDevice(name string) HttpResponse
+	ListDevices() HttpResponse
+	RevokeDevice(deviceID string) HttpResponse
+
+	AcceptBoardInvite(token string) HttpResponse
+
+	GetUserKeys() HttpResponse
+	PutUserKeys(keys types.UserKeys) HttpResponse
 }
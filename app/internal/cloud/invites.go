@@ -0,0 +1,29 @@
+package cloud
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// AcceptBoardInvite makes the signed in user a member of the board an invite link was sent for
+func (cf *cloudFuncs) AcceptBoardInvite(token string) HttpResponse {
+	status, body, err := cf.doJSONRequest(http.MethodPost, "/board/invitations/accept", map[string]string{"token": token})
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to accept board invite",
+		}
+	}
+
+	if status != http.StatusOK {
+		return HttpResponse{
+			Error:   string(body),
+			Message: fmt.Sprintf("invitations api returned status %d", status),
+		}
+	}
+
+	return HttpResponse{
+		Message: "board invite accepted successfully",
+	}
+}
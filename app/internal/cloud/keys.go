@@ -0,0 +1,356 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"seisami/app/internal/e2e"
+	"seisami/app/internal/repo"
+	"seisami/app/types"
+)
+
+// with encryption on, the content fields of every op are sealed with its board's key right before the push and opened
+// by local.UpdateLocalDB after a pull. a board gets its key from the first encrypted member who pushes to it, until
+// every member has a keypair its ops go up in plaintext
+
+var errBoardKeyPending = errors.New("board is encrypted, waiting for a member to share its key with this account")
+
+// SetKeyring turns on sealing of pushed ops, a locked keyring pushes plaintext
+func (cf *cloudFuncs) SetKeyring(keyring *e2e.Keyring) {
+	cf.keyring = keyring
+}
+
+// GetUserKeys returns the user's uploaded keypair, Data is nil when encryption was never enabled
+func (cf *cloudFuncs) GetUserKeys() HttpResponse {
+	status, body, err := cf.doJSONRequest(http.MethodGet, "/keys", nil)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to get encryption keys",
+		}
+	}
+
+	if status == http.StatusNotFound {
+		return HttpResponse{
+			Message: "encryption is not enabled",
+		}
+	}
+
+	if status != http.StatusOK {
+		return HttpResponse{
+			Error:   string(body),
+			Message: fmt.Sprintf("keys api returned status %d", status),
+		}
+	}
+
+	var response struct {
+		Data types.UserKeys `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to decode encryption keys",
+		}
+	}
+
+	return HttpResponse{
+		Message: "encryption keys retrieved successfully",
+		Data:    response.Data,
+	}
+}
+
+func (cf *cloudFuncs) PutUserKeys(keys types.UserKeys) HttpResponse {
+	status, body, err := cf.doJSONRequest(http.MethodPut, "/keys", keys)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to save encryption keys",
+		}
+	}
+
+	if status != http.StatusOK {
+		return HttpResponse{
+			Error:   string(body),
+			Message: fmt.Sprintf("keys api returned status %d", status),
+		}
+	}
+
+	return HttpResponse{
+		Message: "encryption keys saved successfully",
+	}
+}
+
+// getBoardKeys returns false when the cloud doesn't know the board or doesn't count this user as a member
+func (cf *cloudFuncs) getBoardKeys(boardID string) (types.BoardKeys, bool, error) {
+	status, body, err := cf.doJSONRequest(http.MethodGet, "/board/"+url.PathEscape(boardID)+"/keys", nil)
+	if err != nil {
+		return types.BoardKeys{}, false, err
+	}
+
+	if status == http.StatusForbidden {
+		return types.BoardKeys{}, false, nil
+	}
+
+	if status != http.StatusOK {
+		return types.BoardKeys{}, false, fmt.Errorf("keys api returned status %d: %s", status, string(body))
+	}
+
+	var response struct {
+		Data types.BoardKeys `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return types.BoardKeys{}, false, fmt.Errorf("unable to decode board keys: %v", err)
+	}
+
+	return response.Data, true, nil
+}
+
+func (cf *cloudFuncs) putBoardKeys(boardID string, keys []types.WrappedBoardKey) error {
+	payload := map[string][]types.WrappedBoardKey{"keys": keys}
+
+	status, body, err := cf.doJSONRequest(http.MethodPut, "/board/"+url.PathEscape(boardID)+"/keys", payload)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("keys api returned status %d: %s", status, string(body))
+	}
+
+	return nil
+}
+
+// loadBoardKey unwraps the board key the cloud holds for this user, if there is one
+func (cf *cloudFuncs) loadBoardKey(boardID string) error {
+	if !cf.keyring.Unlocked() || cf.keyring.HasBoardKey(boardID) {
+		return nil
+	}
+
+	keys, ok, err := cf.getBoardKeys(boardID)
+	if err != nil || !ok || keys.WrappedKey == "" {
+		return err
+	}
+
+	return cf.keyring.UnwrapBoardKey(boardID, keys.WrappedKey)
+}
+
+// ensureBoardKey makes sure ops of boardID can be sealed and every member with a keypair can open them. ok is false
+// while a member can't receive a key yet, pending when the key can only be handed out after the push
+func (cf *cloudFuncs) ensureBoardKey(boardID string) (ok, pending bool, err error) {
+	keys, known, err := cf.getBoardKeys(boardID)
+	if err != nil {
+		return false, false, err
+	}
+
+	if !known {
+		if !cf.keyring.HasBoardKey(boardID) {
+			if err := cf.keyring.NewBoardKey(boardID); err != nil {
+				return false, false, err
+			}
+		}
+		return true, true, nil
+	}
+
+	encrypted := false
+	for _, member := range keys.Members {
+		encrypted = encrypted || member.HasKey
+	}
+
+	switch {
+	case keys.WrappedKey != "":
+		if !cf.keyring.HasBoardKey(boardID) {
+			if err := cf.keyring.UnwrapBoardKey(boardID, keys.WrappedKey); err != nil {
+				return false, false, err
+			}
+		}
+	case encrypted:
+		return false, false, errBoardKeyPending
+	default:
+		for _, member := range keys.Members {
+			if member.PublicKey == "" {
+				return false, false, nil
+			}
+		}
+		if !cf.keyring.HasBoardKey(boardID) {
+			if err := cf.keyring.NewBoardKey(boardID); err != nil {
+				return false, false, err
+			}
+		}
+	}
+
+	// hand the key to members who enabled encryption since it was made
+	var wraps []types.WrappedBoardKey
+	for _, member := range keys.Members {
+		if member.HasKey || member.PublicKey == "" {
+			continue
+		}
+
+		wrapped, err := cf.keyring.WrapBoardKey(boardID, member.PublicKey)
+		if err != nil {
+			return false, false, err
+		}
+		wraps = append(wraps, types.WrappedBoardKey{UserID: member.UserID, WrappedKey: wrapped})
+	}
+
+	if len(wraps) > 0 {
+		if err := cf.putBoardKeys(boardID, wraps); err != nil {
+			return false, false, fmt.Errorf("unable to share board key: %v", err)
+		}
+	}
+
+	return true, false, nil
+}
+
+func (cf *cloudFuncs) boardOf(tableName types.TableName, op types.OperationSync) (string, error) {
+	return BoardOf(cf.repo, tableName, op)
+}
+
+// BoardOf works out which board an op belongs to, cards only know their column
+func BoardOf(r repo.Repository, tableName types.TableName, op types.OperationSync) (string, error) {
+	if tableName == types.BoardTable {
+		return op.RecordID, nil
+	}
+
+	var record struct {
+		BoardID  string `json:"board_id"`
+		ColumnID string `json:"column_id"`
+	}
+	_ = json.Unmarshal([]byte(op.PayloadData), &record)
+
+	if record.BoardID != "" {
+		return record.BoardID, nil
+	}
+	if r == nil {
+		return "", fmt.Errorf("unable to tell which board %s %s belongs to", tableName, op.RecordID)
+	}
+
+	switch tableName {
+	case types.ColumnTable:
+		column, err := r.GetColumnWithTrashed(op.RecordID)
+		if err != nil {
+			return "", fmt.Errorf("unable to find column %s: %v", op.RecordID, err)
+		}
+		return column.BoardID, nil
+	case types.CardTable:
+		columnID := record.ColumnID
+		if columnID == "" {
+			card, err := r.GetCardWithTrashed(op.RecordID)
+			if err != nil {
+				return "", fmt.Errorf("unable to find card %s: %v", op.RecordID, err)
+			}
+			columnID = card.ColumnID
+		}
+
+		column, err := r.GetColumnWithTrashed(columnID)
+		if err != nil {
+			return "", fmt.Errorf("unable to find column %s: %v", columnID, err)
+		}
+		return column.BoardID, nil
+	}
+
+	return "", fmt.Errorf("unable to tell which board %s %s belongs to", tableName, op.RecordID)
+}
+
+// sealOps returns sealed copies of ops, the local op log stays readable. pending lists the boards whose keys are handed
+// out once the ops are in the cloud
+func (cf *cloudFuncs) sealOps(tableName types.TableName, ops []types.OperationSync) ([]types.OperationSync, []string, error) {
+	if !cf.keyring.Unlocked() {
+		return ops, nil, nil
+	}
+
+	sealed := make([]types.OperationSync, len(ops))
+	ready := make(map[string]bool)
+	var pending []string
+
+	for i, op := range ops {
+		sealed[i] = op
+		if !e2e.Sensitive(op.PayloadData) {
+			continue
+		}
+
+		boardID, err := cf.boardOf(tableName, op)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ok, checked := ready[boardID]
+		if !checked {
+			var isPending bool
+			ok, isPending, err = cf.ensureBoardKey(boardID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to get key of board %s: %v", boardID, err)
+			}
+			ready[boardID] = ok
+			if isPending {
+				pending = append(pending, boardID)
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		payload, err := cf.keyring.SealPayload(boardID, op.PayloadData)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to seal operation %s: %v", op.ID, err)
+		}
+		sealed[i].PayloadData = payload
+	}
+
+	return sealed, pending, nil
+}
+
+// sharePendingKeys hands out the keys of boards that only just reached the cloud
+func (cf *cloudFuncs) sharePendingKeys(boardIDs []string) {
+	for _, boardID := range boardIDs {
+		if _, _, err := cf.ensureBoardKey(boardID); err != nil {
+			fmt.Printf("unable to share key of board %s: %v\n", boardID, err)
+		}
+	}
+}
+
+// loadSealedBoardKeys fetches the keys needed to open pulled ops, ops that still can't be opened get parked locally
+func (cf *cloudFuncs) loadSealedBoardKeys(ops []types.OperationSync) {
+	if !cf.keyring.Unlocked() {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, op := range ops {
+		for _, boardID := range e2e.SealedBoards(op.PayloadData) {
+			if seen[boardID] {
+				continue
+			}
+			seen[boardID] = true
+
+			if err := cf.loadBoardKey(boardID); err != nil {
+				fmt.Printf("unable to load key of board %s: %v\n", boardID, err)
+			}
+		}
+	}
+}
+
+// openExport decrypts sealed values of exported data before it's decoded
+func (cf *cloudFuncs) openExport(data []byte) ([]byte, error) {
+	payload := string(data)
+	if !e2e.Sealed(payload) {
+		return data, nil
+	}
+
+	for _, boardID := range e2e.SealedBoards(payload) {
+		if err := cf.loadBoardKey(boardID); err != nil {
+			return nil, err
+		}
+	}
+
+	opened, err := cf.keyring.OpenPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(opened), nil
+}
@@ -0,0 +1,114 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is the little a storage needs to offer to sync through it, keys are slash separated paths
+type ObjectStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put replaces the whole object, readers never see a partly written one
+	Put(ctx context.Context, key string, data []byte) error
+	// List returns every key under prefix, a prefix is a directory so it ends with a slash
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// folderStore keeps objects as files under a folder every device can reach, a network share or a synced folder
+type folderStore struct {
+	root string
+}
+
+func NewFolderStore(root string) (ObjectStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("sync folder is required")
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sync folder: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("sync folder %s is not a folder", root)
+	}
+
+	return &folderStore{root: root}, nil
+}
+
+func (f *folderStore) path(key string) string {
+	return filepath.Join(f.root, filepath.FromSlash(key))
+}
+
+func (f *folderStore) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+
+	return data, err
+}
+
+// Put writes next to the object and renames over it, so a device reading the folder never sees half of it
+func (f *folderStore) Put(_ context.Context, key string, data []byte) error {
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("unable to create folder for %s: %v", key, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %v", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write %s: %v", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write %s: %v", key, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to write %s: %v", key, err)
+	}
+
+	return nil
+}
+
+func (f *folderStore) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+
+	err := filepath.WalkDir(f.path(prefix), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %s: %v", prefix, err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,267 @@
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Store talks to any s3 compatible storage with path style urls and signature v4, three calls don't need an sdk
+
+type S3Config struct {
+	// Endpoint is the storage's base url, e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// ParseS3Location reads a bucket url like http://localhost:9000/seisami?region=us-east-1 into an S3Config
+func ParseS3Location(location, accessKey, secretKey string) (S3Config, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Host == "" {
+		return S3Config{}, fmt.Errorf("invalid bucket url %q", location)
+	}
+
+	bucket := strings.Trim(u.Path, "/")
+	if bucket == "" || strings.Contains(bucket, "/") {
+		return S3Config{}, fmt.Errorf("bucket url %q must end with the bucket name", location)
+	}
+
+	region := u.Query().Get("region")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return S3Config{
+		Endpoint:  u.Scheme + "://" + u.Host,
+		Bucket:    bucket,
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	}, nil
+}
+
+type s3Store struct {
+	cfg        S3Config
+	httpClient http.Client
+	now        func() time.Time
+}
+
+func NewS3Store(cfg S3Config) (ObjectStore, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket url is required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("access key & secret key are required")
+	}
+
+	return &s3Store{
+		cfg:        cfg,
+		httpClient: http.Client{Timeout: 30 * time.Second},
+		now:        time.Now,
+	}, nil
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	status, body, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	default:
+		return nil, fmt.Errorf("storage returned status %d for %s: %s", status, key, string(body))
+	}
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, data []byte) error {
+	status, body, err := s.do(ctx, http.MethodPut, key, nil, data)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("storage returned status %d for %s: %s", status, key, string(body))
+	}
+
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+
+	for {
+		params := url.Values{}
+		params.Set("list-type", "2")
+		params.Set("prefix", prefix)
+		if token != "" {
+			params.Set("continuation-token", token)
+		}
+
+		status, body, err := s.do(ctx, http.MethodGet, "", params, nil)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("storage returned status %d listing %s: %s", status, prefix, string(body))
+		}
+
+		var result listBucketResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("unable to decode listing of %s: %v", prefix, err)
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			sort.Strings(keys)
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *s3Store) do(ctx context.Context, method, key string, params url.Values, payload []byte) (int, []byte, error) {
+	path := "/" + s.cfg.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+
+	rawQuery := canonicalQuery(params)
+	target := s.cfg.Endpoint + uriEncode(path, false)
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, fmt.Errorf("prepare request: %w", err)
+	}
+	s.sign(req, path, rawQuery, payload)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("execute request: %w: %v", ErrUnreachable, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, nil, fmt.Errorf("read response body: %w", err)
+	}
+
+	return res.StatusCode, body, nil
+}
+
+// sign adds an aws signature v4 Authorization header, only host and the x-amz headers are signed
+func (s *s3Store) sign(req *http.Request, path, rawQuery string, payload []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(path, false),
+		rawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range params[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything but the unreserved characters the way signature v4 expects, slashes survive in paths
+func uriEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
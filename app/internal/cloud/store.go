@@ -0,0 +1,984 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"seisami/app/internal/hlc"
+	"seisami/app/internal/merge"
+	"seisami/app/internal/repo"
+	"seisami/app/internal/repo/sqlc/query"
+	"seisami/app/types"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// storeCloud syncs through a shared folder or an s3 compatible bucket instead of the server. nothing applies ops next
+// to the storage, so the op log itself is shared. a device only writes its own files and a segment counts once its
+// device's manifest lists it, readers keep how far into every manifest they pulled.
+//
+//	segments/<device>/<table>/<n>.json   the ops one push carried
+//	devices/<device>/manifest.json       the device's name and every segment it wrote
+//	devices/<device>/state/<table>.json  the device's sync state
+
+var errStoreUnsupported = errors.New("not available when syncing through your own storage")
+
+const storeTimeLayout = "2006-01-02 15:04:05"
+
+type storeManifest struct {
+	DeviceID  string         `json:"device_id"`
+	Name      string         `json:"name,omitempty"`
+	CreatedAt string         `json:"created_at"`
+	UpdatedAt string         `json:"updated_at"`
+	Segments  []storeSegment `json:"segments"`
+}
+
+type storeSegment struct {
+	Key       string `json:"key"`
+	TableName string `json:"table_name"`
+	Count     int    `json:"count"`
+}
+
+// storeState is a device's sync state for one table
+type storeState struct {
+	types.SyncStatePayload
+	// Read is how many segments of every other device's manifest were pulled and applied, by device id
+	Read map[string]int `json:"read,omitempty"`
+}
+
+// storePull is the segments one pull of a table reads, from the sync state up to the manifests as listed when it
+// started. the sync state only moves on once everything pulled is applied
+type storePull struct {
+	manifests []storeManifest
+	from      map[string]int
+	// cursors of the pages handed out, a page asked for after any other cursor belongs to another pull
+	cursors map[string]bool
+	// a pull resumed after a restart doesn't know which segments its earlier pages came from, it can't move Read on
+	resumed bool
+}
+
+func (p *storePull) read() map[string]int {
+	read := make(map[string]int, len(p.manifests))
+	for _, manifest := range p.manifests {
+		read[manifest.DeviceID] = len(manifest.Segments)
+	}
+
+	return read
+}
+
+type storeCloud struct {
+	store    ObjectStore
+	repo     repo.Repository
+	ctx      context.Context
+	deviceID string
+
+	mu sync.Mutex
+	// segments never change once listed, so every one is only downloaded once
+	segments map[string][]types.OperationSync
+	// records BootstrapCloud uploads, written as one segment per table by InitializeSyncStateForUser
+	bootstrap map[types.TableName][]types.OperationSync
+	// the pull of every table that hasn't been stored in the sync state yet
+	pulls map[types.TableName]*storePull
+}
+
+func NewStoreCloud(store ObjectStore, repo repo.Repository, ctx context.Context) *storeCloud {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &storeCloud{
+		store:     store,
+		repo:      repo,
+		ctx:       ctx,
+		segments:  make(map[string][]types.OperationSync),
+		bootstrap: make(map[types.TableName][]types.OperationSync),
+		pulls:     make(map[types.TableName]*storePull),
+	}
+}
+
+func (sc *storeCloud) getDeviceID() string {
+	if sc.deviceID != "" || sc.repo == nil {
+		return sc.deviceID
+	}
+
+	deviceID, err := sc.repo.GetDeviceID()
+	if err != nil {
+		fmt.Printf("unable to get device id: %v\n", err)
+		return ""
+	}
+
+	sc.deviceID = deviceID
+	return deviceID
+}
+
+func manifestKey(deviceID string) string {
+	return "devices/" + deviceID + "/manifest.json"
+}
+
+func stateKey(deviceID string, tableName types.TableName) string {
+	return "devices/" + deviceID + "/state/" + tableName.String() + ".json"
+}
+
+func (sc *storeCloud) getJSON(key string, v any) error {
+	data, err := sc.store.Get(sc.ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unable to decode %s: %v", key, err)
+	}
+
+	return nil
+}
+
+func (sc *storeCloud) putJSON(key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to encode %s: %v", key, err)
+	}
+
+	return sc.store.Put(sc.ctx, key, data)
+}
+
+// ownManifest is this device's manifest, a device that never pushed starts with an empty one
+func (sc *storeCloud) ownManifest() (storeManifest, error) {
+	deviceID := sc.getDeviceID()
+	if deviceID == "" {
+		return storeManifest{}, fmt.Errorf("device id is not set")
+	}
+
+	var manifest storeManifest
+	err := sc.getJSON(manifestKey(deviceID), &manifest)
+	if errors.Is(err, ErrObjectNotFound) {
+		now := time.Now().UTC().Format(storeTimeLayout)
+		return storeManifest{DeviceID: deviceID, CreatedAt: now, UpdatedAt: now}, nil
+	}
+
+	return manifest, err
+}
+
+func (sc *storeCloud) manifests() ([]storeManifest, error) {
+	keys, err := sc.store.List(sc.ctx, "devices/")
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []storeManifest
+	for _, key := range keys {
+		if !strings.HasSuffix(key, "/manifest.json") {
+			continue
+		}
+
+		var manifest storeManifest
+		if err := sc.getJSON(key, &manifest); err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	return manifests, nil
+}
+
+// appendSegment writes ops as this device's next segment, they only become visible once the manifest lists them
+func (sc *storeCloud) appendSegment(tableName types.TableName, ops []types.OperationSync) error {
+	if len(ops) == 0 {
+		return nil
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	manifest, err := sc.ownManifest()
+	if err != nil {
+		return err
+	}
+
+	segment := storeSegment{
+		Key:       fmt.Sprintf("segments/%s/%s/%010d.json", manifest.DeviceID, tableName.String(), len(manifest.Segments)+1),
+		TableName: tableName.String(),
+		Count:     len(ops),
+	}
+
+	stamped := make([]types.OperationSync, len(ops))
+	for i, op := range ops {
+		stamped[i] = op
+		if stamped[i].DeviceID == "" {
+			stamped[i].DeviceID = manifest.DeviceID
+		}
+	}
+
+	if err := sc.putJSON(segment.Key, stamped); err != nil {
+		return fmt.Errorf("unable to write segment: %v", err)
+	}
+
+	manifest.Segments = append(manifest.Segments, segment)
+	manifest.UpdatedAt = time.Now().UTC().Format(storeTimeLayout)
+	if err := sc.putJSON(manifestKey(manifest.DeviceID), manifest); err != nil {
+		return fmt.Errorf("unable to update manifest: %v", err)
+	}
+
+	sc.segments[segment.Key] = stamped
+	return nil
+}
+
+func (sc *storeCloud) readSegment(key string) ([]types.OperationSync, error) {
+	sc.mu.Lock()
+	ops, ok := sc.segments[key]
+	sc.mu.Unlock()
+	if ok {
+		return ops, nil
+	}
+
+	if err := sc.getJSON(key, &ops); err != nil {
+		return nil, err
+	}
+
+	sc.mu.Lock()
+	sc.segments[key] = ops
+	sc.mu.Unlock()
+	return ops, nil
+}
+
+// tableOps collects the ops of tableName in manifests' segments after the first from[device] of each, in clock order
+func (sc *storeCloud) tableOps(tableName types.TableName, manifests []storeManifest, from map[string]int, withOwn bool) ([]types.OperationSync, error) {
+	var ops []types.OperationSync
+	for _, manifest := range manifests {
+		if !withOwn && manifest.DeviceID == sc.getDeviceID() {
+			continue
+		}
+
+		for _, segment := range manifest.Segments[min(from[manifest.DeviceID], len(manifest.Segments)):] {
+			if segment.TableName != tableName.String() {
+				continue
+			}
+
+			segmentOps, err := sc.readSegment(segment.Key)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, segmentOps...)
+		}
+	}
+
+	sort.SliceStable(ops, func(i, j int) bool {
+		return compareStoreOps(ops[i], ops[j]) < 0
+	})
+	return ops, nil
+}
+
+func storeOpClock(op types.OperationSync) hlc.Timestamp {
+	if ts, err := hlc.Parse(op.HLC); err == nil {
+		return ts
+	}
+
+	t, err := time.Parse(storeTimeLayout, op.CreatedAt)
+	if err != nil {
+		return hlc.Timestamp{DeviceID: op.DeviceID}
+	}
+
+	return hlc.FromTime(t, op.DeviceID)
+}
+
+func compareStoreOps(a, b types.OperationSync) int {
+	if order := storeOpClock(a).Compare(storeOpClock(b)); order != 0 {
+		return order
+	}
+
+	return strings.Compare(a.ID, b.ID)
+}
+
+// latestOps keeps the latest op of every record, carrying the union of the fields every op on it touched
+// the way the server's pull does, since the latest op has to speak for the ones it hides
+func latestOps(tableName types.TableName, ops []types.OperationSync) []types.OperationSync {
+	latest := make(map[string]types.OperationSync)
+	fields := make(map[string][]string)
+	for _, op := range ops {
+		latest[op.RecordID] = op
+		fields[op.RecordID] = append(fields[op.RecordID], merge.Encode(op.Fields))
+	}
+
+	result := make([]types.OperationSync, 0, len(latest))
+	for recordID, op := range latest {
+		op.Fields = unionStoreFields(tableName, fields[recordID])
+		result = append(result, op)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return compareStoreOps(result[i], result[j]) < 0
+	})
+	return result
+}
+
+func unionStoreFields(tableName types.TableName, encoded []string) []string {
+	for i, e := range encoded {
+		if e == "null" {
+			encoded[i] = ""
+		}
+	}
+
+	union, err := merge.Union(tableName, encoded)
+	if err != nil {
+		return nil
+	}
+
+	return union
+}
+
+// storeCursor orders like compareStoreOps, ops without an hlc are placed by their created_at
+func storeCursor(op types.OperationSync) string {
+	return storeOpClock(op).String() + "|" + op.ID
+}
+
+// pageStoreOps narrows ops down to q's records and one page after its cursor, the same way the server pages a pull
+func pageStoreOps(ops []types.OperationSync, q types.PullQuery) types.SyncBatchResult {
+	wanted := make(map[string]bool, len(q.RecordIDs))
+	for _, id := range q.RecordIDs {
+		wanted[id] = true
+	}
+
+	page := types.SyncBatchResult{Operations: []types.OperationSync{}, Cursor: q.Cursor}
+	for _, op := range ops {
+		if q.Cursor != "" && storeCursor(op) <= q.Cursor {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[op.RecordID] {
+			continue
+		}
+		if q.Limit > 0 && len(page.Operations) == q.Limit {
+			page.HasMore = true
+			break
+		}
+
+		if q.Summary {
+			op.PayloadData = ""
+		}
+		page.Operations = append(page.Operations, op)
+		page.Cursor = storeCursor(op)
+	}
+
+	return page
+}
+
+func (sc *storeCloud) readState(tableName types.TableName) (storeState, error) {
+	state := storeState{SyncStatePayload: types.SyncStatePayload{TableName: tableName.String()}}
+
+	err := sc.getJSON(stateKey(sc.getDeviceID(), tableName), &state)
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return state, err
+	}
+
+	return state, nil
+}
+
+// newPull lists the manifests for a pull of tableName, it replaces whichever pull was in progress
+func (sc *storeCloud) newPull(tableName types.TableName, resumed bool) (*storePull, error) {
+	state, err := sc.readState(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := sc.manifests()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &storePull{manifests: manifests, from: state.Read, cursors: make(map[string]bool), resumed: resumed}
+	sc.mu.Lock()
+	sc.pulls[tableName] = p
+	sc.mu.Unlock()
+
+	return p, nil
+}
+
+// currentPull is the pull in progress for tableName, fetching records reads the segments its pages read
+func (sc *storeCloud) currentPull(tableName types.TableName) (*storePull, error) {
+	sc.mu.Lock()
+	p := sc.pulls[tableName]
+	sc.mu.Unlock()
+	if p != nil {
+		return p, nil
+	}
+
+	return sc.newPull(tableName, true)
+}
+
+// batchPull is the pull a PullBatch page belongs to, a first page starts a new pull and a page after a cursor this pull
+// didn't hand out is one resumed after a restart
+func (sc *storeCloud) batchPull(tableName types.TableName, cursor string) (*storePull, error) {
+	sc.mu.Lock()
+	p := sc.pulls[tableName]
+	sc.mu.Unlock()
+	if cursor != "" && p != nil && p.cursors[cursor] {
+		return p, nil
+	}
+
+	return sc.newPull(tableName, cursor != "")
+}
+
+// pull returns the latest op of every record changed in the segments p reads
+func (sc *storeCloud) pull(tableName types.TableName, p *storePull) ([]types.OperationSync, error) {
+	ops, err := sc.tableOps(tableName, p.manifests, p.from, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return latestOps(tableName, ops), nil
+}
+
+// pullCurrent is pull on the pull in progress
+func (sc *storeCloud) pullCurrent(tableName types.TableName) ([]types.OperationSync, error) {
+	p, err := sc.currentPull(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	return sc.pull(tableName, p)
+}
+
+func (sc *storeCloud) GetAllOperations(tableName types.TableName, since int64) HttpResponse {
+	ops, err := sc.PullRecords(tableName, since)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "failed to get all operations",
+		}
+	}
+
+	return HttpResponse{
+		Message: "operations retrieved successfully",
+		Data:    ops,
+	}
+}
+
+// PullRecords ignores since, the sync state says which segments are new
+func (sc *storeCloud) PullRecords(tableName types.TableName, since int64) ([]types.OperationSync, error) {
+	return sc.pullCurrent(tableName)
+}
+
+func (sc *storeCloud) PullRecord(tableName types.TableName, recordID string, since int64) HttpResponse {
+	ops, err := sc.pullCurrent(tableName)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to pull record",
+		}
+	}
+
+	for _, op := range ops {
+		if op.RecordID == recordID {
+			return HttpResponse{
+				Message: "record retrieved successfully",
+				Data:    op,
+			}
+		}
+	}
+
+	return HttpResponse{
+		Error:   fmt.Sprintf("no operations available for record %s in table %s", recordID, tableName.String()),
+		Message: "no records found",
+	}
+}
+
+func (sc *storeCloud) PullRecordsPage(tableName types.TableName, q types.PullQuery) HttpResponse {
+	ops, err := sc.pullCurrent(tableName)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to pull records",
+		}
+	}
+
+	return HttpResponse{
+		Message: "records retrieved successfully",
+		Data:    pageStoreOps(ops, q),
+	}
+}
+
+// PullBatch starts a new pull on its first page, later pages and their fetched records read the same segments
+func (sc *storeCloud) PullBatch(tableName types.TableName, q types.PullQuery) HttpResponse {
+	p, err := sc.batchPull(tableName, q.Cursor)
+	var ops []types.OperationSync
+	if err == nil {
+		ops, err = sc.pull(tableName, p)
+	}
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to pull batch",
+		}
+	}
+
+	page := pageStoreOps(ops, types.PullQuery{Cursor: q.Cursor, Limit: q.Limit, Summary: q.Summary})
+	sc.mu.Lock()
+	p.cursors[page.Cursor] = true
+	sc.mu.Unlock()
+
+	return HttpResponse{
+		Message: "records retrieved successfully",
+		Data:    page,
+	}
+}
+
+func (sc *storeCloud) PushRecord(op types.OperationSync) HttpResponse {
+	tableName, err := types.TableNameFromString(op.TableName)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to sync data",
+		}
+	}
+
+	return sc.PushBatch(tableName, []types.OperationSync{op})
+}
+
+// PushBatch appends ops as one segment, it's listed all at once or not at all
+func (sc *storeCloud) PushBatch(tableName types.TableName, ops []types.OperationSync) HttpResponse {
+	if err := sc.appendSegment(tableName, ops); err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to push batch",
+		}
+	}
+
+	return HttpResponse{
+		Message: "batch synced successfully",
+		Data:    types.SyncBatchResult{Applied: len(ops)},
+	}
+}
+
+func (sc *storeCloud) GetSyncState(tableName types.TableName) HttpResponse {
+	state, err := sc.readState(tableName)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to get sync state",
+		}
+	}
+
+	return HttpResponse{
+		Message: "sync state retrieved successfully",
+		Data:    query.SyncState(state.SyncStatePayload),
+	}
+}
+
+// UpdateSyncState is stored once a sync applied what it pulled, so it's also where Read moves on to what was pulled
+func (sc *storeCloud) UpdateSyncState(state query.SyncState) HttpResponse {
+	tableName, err := types.TableNameFromString(state.TableName)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to update sync state",
+		}
+	}
+
+	saved, err := sc.readState(tableName)
+	if err == nil {
+		sc.mu.Lock()
+		p := sc.pulls[tableName]
+		delete(sc.pulls, tableName)
+		sc.mu.Unlock()
+
+		next := storeState{SyncStatePayload: types.SyncStatePayload(state), Read: saved.Read}
+		if p != nil && !p.resumed {
+			next.Read = p.read()
+		}
+		err = sc.putJSON(stateKey(sc.getDeviceID(), tableName), next)
+	}
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to update sync state",
+		}
+	}
+
+	return HttpResponse{
+		Message: "sync state updated successfully",
+	}
+}
+
+// bootstrapOp turns a record BootstrapCloud uploads into an insert clocked at the record's last change, so it never
+// wins over edits other devices made since
+func (sc *storeCloud) bootstrapOp(tableName types.TableName, recordID, updatedAt string, record any) HttpResponse {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: fmt.Sprintf("unable to upsert %s", tableName.String()),
+		}
+	}
+
+	changed, err := time.Parse(storeTimeLayout, updatedAt)
+	if err != nil {
+		changed = time.Unix(0, 0)
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.bootstrap[tableName] = append(sc.bootstrap[tableName], types.OperationSync{
+		ID:            uuid.NewString(),
+		TableName:     tableName.String(),
+		RecordID:      recordID,
+		OperationType: types.InsertOperation.String(),
+		DeviceID:      sc.getDeviceID(),
+		PayloadData:   string(payload),
+		CreatedAt:     updatedAt,
+		UpdatedAt:     updatedAt,
+		HLC:           hlc.FromTime(changed, sc.getDeviceID()).String(),
+	})
+
+	return HttpResponse{
+		Message: fmt.Sprintf("%s upserted successfully", tableName.String()),
+	}
+}
+
+func (sc *storeCloud) UpsertBoard(board types.ExportedBoard) HttpResponse {
+	return sc.bootstrapOp(types.BoardTable, board.ID, board.UpdatedAt, board)
+}
+
+func (sc *storeCloud) UpsertColumn(column types.ExportedColumn) HttpResponse {
+	return sc.bootstrapOp(types.ColumnTable, column.ID, column.UpdatedAt, column)
+}
+
+func (sc *storeCloud) UpsertCard(card types.ExportedCard) HttpResponse {
+	return sc.bootstrapOp(types.CardTable, card.ID, card.UpdatedAt, card)
+}
+
+// InitializeSyncStateForUser ends a bootstrap, the records it uploaded are written out one segment per table
+func (sc *storeCloud) InitializeSyncStateForUser() HttpResponse {
+	sc.mu.Lock()
+	pending := sc.bootstrap
+	sc.bootstrap = make(map[types.TableName][]types.OperationSync)
+	sc.mu.Unlock()
+
+	for _, tableName := range []types.TableName{types.BoardTable, types.ColumnTable, types.CardTable, types.TranscriptionTable} {
+		if err := sc.appendSegment(tableName, pending[tableName]); err != nil {
+			return HttpResponse{
+				Error:   err.Error(),
+				err:     err,
+				Message: "unable to initialize sync state",
+			}
+		}
+	}
+
+	return HttpResponse{
+		Message: "sync state initialized successfully",
+	}
+}
+
+// storeRecord is a record rebuilt from its ops
+type storeRecord struct {
+	id        string
+	fields    merge.Fields
+	deleted   bool
+	createdAt string
+	updatedAt string
+}
+
+// replay folds every op of tableName, this device's included, into the records they describe now
+func (sc *storeCloud) replay(tableName types.TableName) ([]*storeRecord, error) {
+	manifests, err := sc.manifests()
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := sc.tableOps(tableName, manifests, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]*storeRecord)
+	var order []*storeRecord
+	for _, op := range ops {
+		record, ok := records[op.RecordID]
+		if !ok {
+			record = &storeRecord{id: op.RecordID, fields: make(merge.Fields), createdAt: op.CreatedAt}
+			records[op.RecordID] = record
+			order = append(order, record)
+		}
+		record.updatedAt = op.CreatedAt
+
+		switch op.OperationType {
+		case types.DeleteOperation.String():
+			record.deleted = true
+		case types.RestoreOperation.String():
+			record.deleted = false
+		default:
+			incoming, err := merge.Extract(tableName, op.PayloadData)
+			if err != nil {
+				fmt.Printf("skipping unreadable %s op %s: %v\n", tableName, op.ID, err)
+				continue
+			}
+
+			names := op.Fields
+			if op.OperationType == types.InsertOperation.String() {
+				names = nil
+			}
+			record.fields, _ = merge.Apply(tableName, record.fields, incoming, names, op.HLC, nil)
+		}
+	}
+
+	live := make([]*storeRecord, 0, len(order))
+	for _, record := range order {
+		if !record.deleted {
+			live = append(live, record)
+		}
+	}
+
+	return live, nil
+}
+
+// exportAll rebuilds every live record from the op log, in the shape the server exports them
+func (sc *storeCloud) exportAll() (types.ExportedData, error) {
+	var data types.ExportedData
+
+	boards, err := sc.replay(types.BoardTable)
+	if err != nil {
+		return data, err
+	}
+	for _, r := range boards {
+		data.Boards = append(data.Boards, types.ExportedBoard{
+			ID:        r.id,
+			Name:      r.fields.String("name"),
+			CreatedAt: r.createdAt,
+			UpdatedAt: r.updatedAt,
+		})
+	}
+
+	columns, err := sc.replay(types.ColumnTable)
+	if err != nil {
+		return data, err
+	}
+	for _, r := range columns {
+		data.Columns = append(data.Columns, types.ExportedColumn{
+			ID:        r.id,
+			BoardID:   r.fields.String("board_id"),
+			Name:      r.fields.String("name"),
+			Position:  r.fields.Int("position"),
+			CreatedAt: r.createdAt,
+			UpdatedAt: r.updatedAt,
+		})
+	}
+
+	cards, err := sc.replay(types.CardTable)
+	if err != nil {
+		return data, err
+	}
+	for _, r := range cards {
+		data.Cards = append(data.Cards, types.ExportedCard{
+			ID:          r.id,
+			ColumnID:    r.fields.String("column_id"),
+			Title:       r.fields.String("title"),
+			Description: r.fields.String("description"),
+			Attachments: r.fields.String("attachments"),
+			CreatedAt:   r.createdAt,
+			UpdatedAt:   r.updatedAt,
+		})
+	}
+
+	transcriptions, err := sc.replay(types.TranscriptionTable)
+	if err != nil {
+		return data, err
+	}
+	for _, r := range transcriptions {
+		data.Transcriptions = append(data.Transcriptions, types.ExportedTranscription{
+			ID:                r.id,
+			BoardID:           r.fields.String("board_id"),
+			Transcription:     r.fields.String("transcription"),
+			RecordingPath:     r.fields.String("recording_path"),
+			Intent:            r.fields.String("intent"),
+			AssistantResponse: r.fields.String("assistant_response"),
+			CreatedAt:         r.createdAt,
+			UpdatedAt:         r.updatedAt,
+		})
+	}
+
+	return data, nil
+}
+
+func (sc *storeCloud) ImportAllUserData() HttpResponse {
+	data, err := sc.exportAll()
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to import user data",
+		}
+	}
+
+	return HttpResponse{
+		Message: "user data imported successfully",
+		Data:    data,
+	}
+}
+
+// ImportBoardData always returns the whole board, storage keeps no board versions so since is ignored
+func (sc *storeCloud) ImportBoardData(boardId string, since int64) HttpResponse {
+	data, err := sc.exportAll()
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to import board data",
+		}
+	}
+
+	var board types.ImportUserBoardData
+	found := false
+	for _, b := range data.Boards {
+		if b.ID == boardId {
+			board.Board = b
+			found = true
+		}
+	}
+	if !found {
+		return HttpResponse{
+			Error:   fmt.Sprintf("board %s not found", boardId),
+			Message: "unable to import board data",
+		}
+	}
+
+	columnIDs := make(map[string]bool)
+	for _, c := range data.Columns {
+		if c.BoardID == boardId {
+			board.Columns = append(board.Columns, c)
+			columnIDs[c.ID] = true
+		}
+	}
+	for _, c := range data.Cards {
+		if columnIDs[c.ColumnID] {
+			board.Cards = append(board.Cards, c)
+		}
+	}
+	for _, t := range data.Transcriptions {
+		if t.BoardID == boardId {
+			board.Transcriptions = append(board.Transcriptions, t)
+		}
+	}
+
+	return HttpResponse{
+		Message: "board data imported successfully",
+		Data:    board,
+	}
+}
+
+func (sc *storeCloud) UpdateSessionToken(token string) {}
+
+// InitCloud checks the storage can be reached
+func (sc *storeCloud) InitCloud() HttpResponse {
+	if _, err := sc.store.List(sc.ctx, "devices/"); err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to reach sync storage",
+		}
+	}
+
+	return HttpResponse{
+		Message: "sync storage ready",
+	}
+}
+
+func (sc *storeCloud) FetchAppVersion() HttpResponse {
+	return HttpResponse{
+		Error:   errStoreUnsupported.Error(),
+		Message: "unable to fetch app version",
+	}
+}
+
+// RegisterDevice names this install in its manifest, which other devices list as the team's devices
+func (sc *storeCloud) RegisterDevice(name string) HttpResponse {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	manifest, err := sc.ownManifest()
+	if err == nil {
+		manifest.Name = name
+		manifest.UpdatedAt = time.Now().UTC().Format(storeTimeLayout)
+		err = sc.putJSON(manifestKey(manifest.DeviceID), manifest)
+	}
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to register device",
+		}
+	}
+
+	return HttpResponse{
+		Message: "device registered successfully",
+	}
+}
+
+func (sc *storeCloud) ListDevices() HttpResponse {
+	manifests, err := sc.manifests()
+	if err != nil {
+		return HttpResponse{
+			Error:   err.Error(),
+			err:     err,
+			Message: "unable to list devices",
+		}
+	}
+
+	devices := make([]types.Device, 0, len(manifests))
+	for _, m := range manifests {
+		devices = append(devices, types.Device{
+			ID:         m.DeviceID,
+			Name:       m.Name,
+			CreatedAt:  m.CreatedAt,
+			LastSeenAt: m.UpdatedAt,
+			Current:    m.DeviceID == sc.getDeviceID(),
+		})
+	}
+
+	return HttpResponse{
+		Message: "devices retrieved successfully",
+		Data:    devices,
+	}
+}
+
+// RevokeDevice can't be enforced, whoever can reach the storage can write to it
+func (sc *storeCloud) RevokeDevice(deviceID string) HttpResponse {
+	return HttpResponse{
+		Error:   errStoreUnsupported.Error(),
+		Message: "unable to revoke device",
+	}
+}
+
+// AcceptBoardInvite has nothing to accept, a storage folder is shared by handing out access to it
+func (sc *storeCloud) AcceptBoardInvite(token string) HttpResponse {
+	return HttpResponse{
+		Error:   errStoreUnsupported.Error(),
+		Message: "unable to accept board invite",
+	}
+}
+
+func (sc *storeCloud) GetUserKeys() HttpResponse {
+	return HttpResponse{
+		Message: "encryption is not enabled",
+	}
+}
+
+func (sc *storeCloud) PutUserKeys(keys types.UserKeys) HttpResponse {
+	return HttpResponse{
+		Error:   errStoreUnsupported.Error(),
+		Message: "unable to save encryption keys",
+	}
+}
+
+var _ Cloud = (*storeCloud)(nil)
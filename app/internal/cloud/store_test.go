@@ -0,0 +1,224 @@
+package cloud
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"seisami/app/internal/hlc"
+	"seisami/app/internal/repo/sqlc/query"
+	"seisami/app/types"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func storeCloudFor(t *testing.T, store ObjectStore, deviceID string) *storeCloud {
+	t.Helper()
+
+	sc := NewStoreCloud(store, nil, nil)
+	sc.deviceID = deviceID
+	return sc
+}
+
+func storeOp(id, table, recordID, opType, payload string, wall int64, deviceID string, fields []string) types.OperationSync {
+	return types.OperationSync{
+		ID:            id,
+		TableName:     table,
+		RecordID:      recordID,
+		OperationType: opType,
+		DeviceID:      deviceID,
+		PayloadData:   payload,
+		HLC:           hlc.Timestamp{WallTime: wall, DeviceID: deviceID}.String(),
+		Fields:        fields,
+	}
+}
+
+func TestStoreCloud(t *testing.T) {
+	t.Run("devices_pull_each_others_segments_but_not_their_own", func(t *testing.T) {
+		store, err := NewFolderStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFolderStore failed: %v", err)
+		}
+		a := storeCloudFor(t, store, "device-a")
+		b := storeCloudFor(t, store, "device-b")
+
+		resp := a.PushBatch(types.CardTable, []types.OperationSync{
+			storeOp("op-1", "cards", "card-1", "insert", `{"id":"card-1","column_id":"col-1","title":"Draft"}`, 1000, "device-a", nil),
+			storeOp("op-2", "cards", "card-2", "insert", `{"id":"card-2","column_id":"col-1","title":"Other"}`, 1001, "device-a", nil),
+		})
+		if resp.Error != "" {
+			t.Fatalf("PushBatch failed: %s", resp.Error)
+		}
+		resp = a.PushBatch(types.CardTable, []types.OperationSync{
+			storeOp("op-3", "cards", "card-1", "update", `{"id":"card-1","description":"Notes"}`, 1002, "device-a", []string{"description"}),
+		})
+		if resp.Error != "" {
+			t.Fatalf("PushBatch failed: %s", resp.Error)
+		}
+
+		own := a.PullBatch(types.CardTable, types.PullQuery{}).Data.(types.SyncBatchResult)
+		if len(own.Operations) != 0 {
+			t.Errorf("expected device-a not to pull its own ops, got %d", len(own.Operations))
+		}
+
+		first := b.PullBatch(types.CardTable, types.PullQuery{Limit: 1, Summary: true}).Data.(types.SyncBatchResult)
+		if len(first.Operations) != 1 || !first.HasMore || first.Operations[0].RecordID != "card-2" {
+			t.Fatalf("unexpected first page: %+v", first)
+		}
+		if first.Operations[0].PayloadData != "" {
+			t.Errorf("expected a summary page without payloads")
+		}
+
+		second := b.PullBatch(types.CardTable, types.PullQuery{Limit: 1, Cursor: first.Cursor}).Data.(types.SyncBatchResult)
+		if len(second.Operations) != 1 || second.HasMore {
+			t.Fatalf("unexpected second page: %+v", second)
+		}
+		latest := second.Operations[0]
+		if latest.ID != "op-3" || latest.Fields != nil {
+			t.Errorf("expected op-3 to speak for the insert it hides with every field, got %s %v", latest.ID, latest.Fields)
+		}
+	})
+
+	t.Run("board_import_replays_the_log", func(t *testing.T) {
+		store, err := NewFolderStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFolderStore failed: %v", err)
+		}
+		a := storeCloudFor(t, store, "device-a")
+		b := storeCloudFor(t, store, "device-b")
+
+		a.PushBatch(types.BoardTable, []types.OperationSync{
+			storeOp("b-1", "boards", "board-1", "insert", `{"id":"board-1","name":"Roadmap"}`, 1000, "device-a", nil),
+		})
+		a.PushBatch(types.ColumnTable, []types.OperationSync{
+			storeOp("c-1", "columns", "col-1", "insert", `{"id":"col-1","board_id":"board-1","name":"Todo","position":1}`, 1001, "device-a", nil),
+			storeOp("c-2", "columns", "col-2", "insert", `{"id":"col-2","board_id":"board-1","name":"Done","position":2}`, 1002, "device-a", nil),
+		})
+		b.PushBatch(types.ColumnTable, []types.OperationSync{
+			storeOp("c-3", "columns", "col-1", "update", `{"id":"col-1","name":"Backlog"}`, 1003, "device-b", []string{"name"}),
+			storeOp("c-4", "columns", "col-2", "delete", `{"id":"col-2"}`, 1004, "device-b", nil),
+		})
+
+		resp := a.ImportBoardData("board-1", 0)
+		if resp.Error != "" {
+			t.Fatalf("ImportBoardData failed: %s", resp.Error)
+		}
+
+		board := resp.Data.(types.ImportUserBoardData)
+		if board.Board.Name != "Roadmap" {
+			t.Errorf("expected board Roadmap, got %q", board.Board.Name)
+		}
+		if len(board.Columns) != 1 {
+			t.Fatalf("expected the deleted column to be left out, got %+v", board.Columns)
+		}
+		if col := board.Columns[0]; col.Name != "Backlog" || col.Position != 1 {
+			t.Errorf("expected col-1 renamed & still at position 1, got %+v", col)
+		}
+	})
+
+	t.Run("sync_state_is_kept_per_device", func(t *testing.T) {
+		store, err := NewFolderStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFolderStore failed: %v", err)
+		}
+		a := storeCloudFor(t, store, "device-a")
+		b := storeCloudFor(t, store, "device-b")
+
+		if resp := a.UpdateSyncState(query.SyncState{TableName: "boards", LastSyncedAt: 42}); resp.Error != "" {
+			t.Fatalf("UpdateSyncState failed: %s", resp.Error)
+		}
+
+		if state := a.GetSyncState(types.BoardTable).Data.(query.SyncState); state.LastSyncedAt != 42 {
+			t.Errorf("expected device-a's sync state to be kept, got %+v", state)
+		}
+		if state := b.GetSyncState(types.BoardTable).Data.(query.SyncState); state.LastSyncedAt != 0 {
+			t.Errorf("expected device-b not to share device-a's sync state, got %+v", state)
+		}
+	})
+}
+
+// fakeS3 keeps objects in memory and only answers signed requests, enough to drive the s3 store
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/") || r.Header.Get("x-amz-content-sha256") == "" {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/bucket/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPut && ok:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+	case r.Method == http.MethodGet && ok:
+		data, found := f.objects[key]
+		if !found {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		var result listBucketResult
+		for _, k := range keys {
+			result.Contents = append(result.Contents, struct {
+				Key string `xml:"Key"`
+			}{k})
+		}
+		xml.NewEncoder(w).Encode(result)
+	default:
+		http.Error(w, "unsupported", http.StatusBadRequest)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{objects: make(map[string][]byte)})
+	defer server.Close()
+
+	cfg, err := ParseS3Location(server.URL+"/bucket?region=eu-west-1", "access", "secret")
+	if err != nil {
+		t.Fatalf("ParseS3Location failed: %v", err)
+	}
+	if cfg.Region != "eu-west-1" || cfg.Bucket != "bucket" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	store, err := NewS3Store(cfg)
+	if err != nil {
+		t.Fatalf("NewS3Store failed: %v", err)
+	}
+	a := storeCloudFor(t, store, "device-a")
+	b := storeCloudFor(t, store, "device-b")
+
+	if resp := a.PushBatch(types.BoardTable, []types.OperationSync{
+		storeOp("b-1", "boards", "board-1", "insert", `{"id":"board-1","name":"Roadmap"}`, 1000, "device-a", nil),
+	}); resp.Error != "" {
+		t.Fatalf("PushBatch failed: %s", resp.Error)
+	}
+
+	page := b.PullBatch(types.BoardTable, types.PullQuery{}).Data.(types.SyncBatchResult)
+	if len(page.Operations) != 1 || page.Operations[0].ID != "b-1" {
+		t.Errorf("expected device-b to pull board-1 from the bucket, got %+v", page.Operations)
+	}
+
+	if _, err := store.Get(t.Context(), "missing.json"); err == nil || !strings.Contains(err.Error(), ErrObjectNotFound.Error()) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"sync"
@@ -13,12 +14,15 @@ import (
 )
 
 type SyncWebSocket struct {
-	conn            *websocket.Conn
-	onSyncUpdate    func(tableName string)
-	mu              sync.Mutex
-	ctx             context.Context
-	cloudApiUrl     string
-	sessionToken    string
+	conn           *websocket.Conn
+	onSyncUpdate   func(tableName string)
+	onBoardRemoved func(boardID string)
+	mu             sync.Mutex
+	ctx            context.Context
+	cloudApiUrl    string
+	sessionToken   string
+	// sent as X-Device-ID, the server keeps a socket per device
+	deviceID        string
 	isConnected     bool
 	shouldReconnect bool
 }
@@ -27,19 +31,28 @@ type SyncMessage struct {
 	Type      string `json:"type"`
 	TableName string `json:"table_name,omitempty"`
 	UserID    string `json:"user_id,omitempty"`
+	BoardID   string `json:"board_id,omitempty"`
 }
 
-func NewSyncWebSocket(ctx context.Context, cloudApiUrl, sessionToken string, onSyncUpdate func(string)) *SyncWebSocket {
+func NewSyncWebSocket(ctx context.Context, cloudApiUrl, sessionToken, deviceID string, onSyncUpdate func(string)) *SyncWebSocket {
 	ws := &SyncWebSocket{
 		onSyncUpdate:    onSyncUpdate,
 		ctx:             ctx,
 		cloudApiUrl:     cloudApiUrl,
 		sessionToken:    sessionToken,
+		deviceID:        deviceID,
 		shouldReconnect: true,
 	}
 	return ws
 }
 
+// OnBoardRemoved is called with every board the account lost access to, whether it was removed or left on another device
+func (sw *SyncWebSocket) OnBoardRemoved(fn func(boardID string)) {
+	sw.mu.Lock()
+	sw.onBoardRemoved = fn
+	sw.mu.Unlock()
+}
+
 func (sw *SyncWebSocket) Connect() error {
 	sw.mu.Lock()
 
@@ -70,7 +83,12 @@ func (sw *SyncWebSocket) Connect() error {
 
 	log.Printf("Connecting to sync WebSocket: %s", wsURL.String())
 
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL.String(), nil)
+	header := http.Header{}
+	if sw.deviceID != "" {
+		header.Set("X-Device-ID", sw.deviceID)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL.String(), header)
 	if err != nil {
 		sw.mu.Unlock()
 		return fmt.Errorf("failed to connect to sync WebSocket: %w", err)
@@ -147,6 +165,13 @@ func (sw *SyncWebSocket) readMessages() {
 		if msg.Type == "sync_update" && msg.TableName != "" && sw.onSyncUpdate != nil {
 			sw.onSyncUpdate(msg.TableName)
 		}
+
+		sw.mu.Lock()
+		onBoardRemoved := sw.onBoardRemoved
+		sw.mu.Unlock()
+		if msg.Type == "board_removed" && msg.BoardID != "" && onBoardRemoved != nil {
+			onBoardRemoved(msg.BoardID)
+		}
 	}
 }
 
@@ -0,0 +1,568 @@
+package e2e
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"seisami/app/types"
+	"strings"
+	"sync"
+)
+
+// end to end encryption is opt in. a user's private key is uploaded sealed with their passphrase and every encrypted
+// board has a random key wrapped for each member. only content fields are sealed, ids, positions and timestamps stay
+// readable for the server. a sealed value is "e2e:v1:<board id>:<base64 nonce+ciphertext>"
+
+const (
+	sealedPrefix = "e2e:v1:"
+	// pbkdf2 iterations for the passphrase key, OWASP's current recommendation for sha256
+	passphraseIterations = 600_000
+	keySize              = 32
+	saltSize             = 16
+	// what AES-GCM adds to every sealed value
+	nonceSize = 12
+	tagSize   = 16
+)
+
+// SealedFields are the payload keys whose string values get encrypted, wherever they appear in a payload
+var SealedFields = map[string]bool{
+	"name":               true,
+	"title":              true,
+	"description":        true,
+	"attachments":        true,
+	"transcription":      true,
+	"intent":             true,
+	"assistant_response": true,
+	"recording_path":     true,
+}
+
+var (
+	ErrLocked          = errors.New("encryption keys are locked")
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrMissingBoardKey = errors.New("missing board key")
+	errMalformedValue  = errors.New("malformed encrypted value")
+)
+
+// Keyring holds the unlocked private key and the board keys opened with it, a nil or locked keyring seals nothing
+type Keyring struct {
+	mu      sync.RWMutex
+	private *ecdh.PrivateKey
+	boards  map[string][]byte
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{boards: make(map[string][]byte)}
+}
+
+func (k *Keyring) Unlocked() bool {
+	if k == nil {
+		return false
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.private != nil
+}
+
+// Generate creates a new keypair for the user and returns it sealed with passphrase, ready to upload
+func (k *Keyring) Generate(passphrase string) (types.UserKeys, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return types.UserKeys{}, fmt.Errorf("unable to generate keypair: %v", err)
+	}
+
+	keys, err := sealPrivateKey(private, passphrase)
+	if err != nil {
+		return types.UserKeys{}, err
+	}
+
+	k.setPrivateKey(private)
+	return keys, nil
+}
+
+// Unlock opens the uploaded private key with passphrase
+func (k *Keyring) Unlock(keys types.UserKeys, passphrase string) error {
+	salt, err := base64.StdEncoding.DecodeString(keys.Salt)
+	if err != nil {
+		return fmt.Errorf("invalid salt: %v", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(keys.EncryptedPrivateKey)
+	if err != nil {
+		return fmt.Errorf("invalid encrypted private key: %v", err)
+	}
+
+	key, err := passphraseKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	raw, err := open(key, sealed, []byte(keys.PublicKey))
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+
+	private, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %v", err)
+	}
+	if base64.StdEncoding.EncodeToString(private.PublicKey().Bytes()) != keys.PublicKey {
+		return fmt.Errorf("private key doesn't match public key")
+	}
+
+	k.setPrivateKey(private)
+	return nil
+}
+
+// Restore unlocks the keyring with a private key kept by PrivateKey, so a device isn't asked for the passphrase again
+func (k *Keyring) Restore(encoded string) error {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %v", err)
+	}
+
+	private, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %v", err)
+	}
+
+	k.setPrivateKey(private)
+	return nil
+}
+
+// PrivateKey is the unlocked private key encoded for local storage, "" while locked
+func (k *Keyring) PrivateKey() string {
+	if !k.Unlocked() {
+		return ""
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return base64.StdEncoding.EncodeToString(k.private.Bytes())
+}
+
+func (k *Keyring) PublicKey() string {
+	if !k.Unlocked() {
+		return ""
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return base64.StdEncoding.EncodeToString(k.private.PublicKey().Bytes())
+}
+
+// Lock forgets the private key and every board key opened with it
+func (k *Keyring) Lock() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.private = nil
+	k.boards = make(map[string][]byte)
+}
+
+func (k *Keyring) setPrivateKey(private *ecdh.PrivateKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.private = private
+}
+
+func (k *Keyring) HasBoardKey(boardID string) bool {
+	if k == nil {
+		return false
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	_, ok := k.boards[boardID]
+	return ok
+}
+
+func (k *Keyring) boardKey(boardID string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.private == nil {
+		return nil, ErrLocked
+	}
+	key, ok := k.boards[boardID]
+	if !ok {
+		return nil, fmt.Errorf("%w for board %s", ErrMissingBoardKey, boardID)
+	}
+
+	return key, nil
+}
+
+// NewBoardKey gives a board that has none yet a fresh random key
+func (k *Keyring) NewBoardKey(boardID string) error {
+	if !k.Unlocked() {
+		return ErrLocked
+	}
+
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("unable to generate board key: %v", err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.boards[boardID] = key
+	return nil
+}
+
+// WrapBoardKey seals a board key for the member owning publicKey, only their private key can unwrap it
+func (k *Keyring) WrapBoardKey(boardID, publicKey string) (string, error) {
+	boardKey, err := k.boardKey(boardID)
+	if err != nil {
+		return "", err
+	}
+
+	rawPublic, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %v", err)
+	}
+	recipient, err := ecdh.X25519().NewPublicKey(rawPublic)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %v", err)
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate ephemeral key: %v", err)
+	}
+
+	key, err := wrappingKey(ephemeral, recipient, boardID)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(key, boardKey, []byte(boardID))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(append(ephemeral.PublicKey().Bytes(), sealed...)), nil
+}
+
+// UnwrapBoardKey opens the board key wrapped for this user and keeps it
+func (k *Keyring) UnwrapBoardKey(boardID, wrapped string) error {
+	if !k.Unlocked() {
+		return ErrLocked
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(raw) <= keySize {
+		return fmt.Errorf("invalid wrapped board key")
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(raw[:keySize])
+	if err != nil {
+		return fmt.Errorf("invalid wrapped board key: %v", err)
+	}
+
+	k.mu.RLock()
+	private := k.private
+	k.mu.RUnlock()
+
+	key, err := wrappingKey(private, ephemeral, boardID)
+	if err != nil {
+		return err
+	}
+
+	boardKey, err := open(key, raw[keySize:], []byte(boardID))
+	if err != nil {
+		return fmt.Errorf("unable to unwrap board key for %s: %v", boardID, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.boards[boardID] = boardKey
+	return nil
+}
+
+// SealPayload encrypts the sensitive fields of a json payload with the board's key
+func (k *Keyring) SealPayload(boardID, payload string) (string, error) {
+	key, err := k.boardKey(boardID)
+	if err != nil {
+		return "", err
+	}
+
+	return rewrite(payload, func(field, value string) (string, error) {
+		if !SealedFields[field] || value == "" || isSealed(field, value) {
+			return value, nil
+		}
+
+		sealed, err := seal(key, []byte(value), []byte(boardID))
+		if err != nil {
+			return "", err
+		}
+		return sealedPrefix + boardID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+	})
+}
+
+// OpenPayload decrypts every sealed value of a json payload, payloads without any come back untouched
+func (k *Keyring) OpenPayload(payload string) (string, error) {
+	if !Sealed(payload) {
+		return payload, nil
+	}
+	if !k.Unlocked() {
+		return "", ErrLocked
+	}
+
+	return rewrite(payload, func(field, value string) (string, error) {
+		if !SealedFields[field] {
+			return value, nil
+		}
+		boardID, sealed, ok := parseSealed(value)
+		if !ok {
+			return value, nil
+		}
+
+		key, err := k.boardKey(boardID)
+		if err != nil {
+			return "", err
+		}
+
+		plain, err := open(key, sealed, []byte(boardID))
+		if err != nil {
+			return "", fmt.Errorf("unable to decrypt value of board %s: %v", boardID, err)
+		}
+		return string(plain), nil
+	})
+}
+
+// Sealed reports whether a payload carries any encrypted value
+func Sealed(payload string) bool {
+	return len(SealedBoards(payload)) > 0
+}
+
+// SealedBoards lists the boards whose keys are needed to open a payload
+func SealedBoards(payload string) []string {
+	var boards []string
+	seen := make(map[string]bool)
+
+	_, _ = rewrite(payload, func(field, value string) (string, error) {
+		if !SealedFields[field] {
+			return value, nil
+		}
+		boardID, _, ok := parseSealed(value)
+		if ok && !seen[boardID] {
+			seen[boardID] = true
+			boards = append(boards, boardID)
+		}
+		return value, nil
+	})
+
+	return boards
+}
+
+// Sensitive reports whether a payload has anything SealPayload would encrypt
+func Sensitive(payload string) bool {
+	found := false
+	_, _ = rewrite(payload, func(field, value string) (string, error) {
+		if SealedFields[field] && value != "" && !isSealed(field, value) {
+			found = true
+		}
+		return value, nil
+	})
+
+	return found
+}
+
+func isSealed(field, value string) bool {
+	if !SealedFields[field] {
+		return false
+	}
+
+	_, _, ok := parseSealed(value)
+	return ok
+}
+
+// parseSealed splits a sealed value into its board id and what was sealed. anything that isn't exactly what SealPayload
+// writes is plain text, even when it starts like a sealed value
+func parseSealed(value string) (string, []byte, bool) {
+	rest, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		return "", nil, false
+	}
+
+	boardID, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", nil, false
+	}
+	if !validBoardID(boardID) {
+		return "", nil, false
+	}
+
+	sealed, err := base64.StdEncoding.Strict().DecodeString(encoded)
+	if err != nil || len(sealed) < nonceSize+tagSize {
+		return "", nil, false
+	}
+
+	return boardID, sealed, true
+}
+
+// validBoardID is whether id could be a board's id, letters, digits and dashes like a uuid
+func validBoardID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// rewrite passes every string value of a json document with the key it sits under to fn, and re-encodes the result
+func rewrite(payload string, fn func(field, value string) (string, error)) (string, error) {
+	if payload == "" {
+		return payload, nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(payload))
+	dec.UseNumber()
+
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return "", fmt.Errorf("invalid payload: %v", err)
+	}
+
+	doc, err := rewriteValue("", doc, fn)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return "", fmt.Errorf("unable to encode payload: %v", err)
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func rewriteValue(field string, value any, fn func(field, value string) (string, error)) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return fn(field, v)
+	case map[string]any:
+		for key, nested := range v {
+			rewritten, err := rewriteValue(key, nested, fn)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = rewritten
+		}
+		return v, nil
+	case []any:
+		for i, nested := range v {
+			rewritten, err := rewriteValue(field, nested, fn)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = rewritten
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+func sealPrivateKey(private *ecdh.PrivateKey, passphrase string) (types.UserKeys, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return types.UserKeys{}, fmt.Errorf("unable to generate salt: %v", err)
+	}
+
+	key, err := passphraseKey(passphrase, salt)
+	if err != nil {
+		return types.UserKeys{}, err
+	}
+
+	publicKey := base64.StdEncoding.EncodeToString(private.PublicKey().Bytes())
+	sealed, err := seal(key, private.Bytes(), []byte(publicKey))
+	if err != nil {
+		return types.UserKeys{}, err
+	}
+
+	return types.UserKeys{
+		PublicKey:           publicKey,
+		EncryptedPrivateKey: base64.StdEncoding.EncodeToString(sealed),
+		Salt:                base64.StdEncoding.EncodeToString(salt),
+	}, nil
+}
+
+func passphraseKey(passphrase string, salt []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is required")
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, passphraseIterations, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive passphrase key: %v", err)
+	}
+
+	return key, nil
+}
+
+func wrappingKey(private *ecdh.PrivateKey, public *ecdh.PublicKey, boardID string) ([]byte, error) {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, fmt.Errorf("unable to agree on wrapping key: %v", err)
+	}
+
+	key, err := hkdf.Key(sha256.New, shared, nil, "seisami board key "+boardID, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive wrapping key: %v", err)
+	}
+
+	return key, nil
+}
+
+// seal encrypts with AES-GCM and prepends the random nonce
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("unable to generate nonce: %v", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, sealed, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errMalformedValue
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
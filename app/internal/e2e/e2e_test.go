@@ -0,0 +1,185 @@
+package e2e
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func unlockedKeyring(t *testing.T, passphrase string) (*Keyring, string) {
+	t.Helper()
+
+	k := NewKeyring()
+	keys, err := k.Generate(passphrase)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	return k, keys.PublicKey
+}
+
+func TestKeyring(t *testing.T) {
+	t.Run("passphrase_unlocks_uploaded_keys", func(t *testing.T) {
+		k := NewKeyring()
+		keys, err := k.Generate("correct horse")
+		if err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+
+		other := NewKeyring()
+		if err := other.Unlock(keys, "wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+			t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+		}
+		if other.Unlocked() {
+			t.Fatal("keyring unlocked with the wrong passphrase")
+		}
+
+		if err := other.Unlock(keys, "correct horse"); err != nil {
+			t.Fatalf("unlock: %v", err)
+		}
+		if other.PublicKey() != keys.PublicKey {
+			t.Errorf("expected public key %s, got %s", keys.PublicKey, other.PublicKey())
+		}
+
+		restored := NewKeyring()
+		if err := restored.Restore(other.PrivateKey()); err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+		if restored.PublicKey() != keys.PublicKey {
+			t.Errorf("restored keyring has public key %s", restored.PublicKey())
+		}
+	})
+
+	t.Run("board_key_wrapped_for_a_member_opens_their_payloads", func(t *testing.T) {
+		alice, _ := unlockedKeyring(t, "alice")
+		bob, bobPublic := unlockedKeyring(t, "bob")
+
+		if err := alice.NewBoardKey("board-1"); err != nil {
+			t.Fatalf("new board key: %v", err)
+		}
+		wrapped, err := alice.WrapBoardKey("board-1", bobPublic)
+		if err != nil {
+			t.Fatalf("wrap: %v", err)
+		}
+
+		if err := bob.UnwrapBoardKey("board-2", wrapped); err == nil {
+			t.Fatal("a key wrapped for board-1 unwrapped as board-2")
+		}
+		if err := bob.UnwrapBoardKey("board-1", wrapped); err != nil {
+			t.Fatalf("unwrap: %v", err)
+		}
+
+		sealed, err := alice.SealPayload("board-1", `{"id":"card-1","title":"Ship it","position":2}`)
+		if err != nil {
+			t.Fatalf("seal: %v", err)
+		}
+
+		opened, err := bob.OpenPayload(sealed)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+
+		var card map[string]any
+		if err := json.Unmarshal([]byte(opened), &card); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if card["title"] != "Ship it" {
+			t.Errorf("expected title Ship it, got %v", card["title"])
+		}
+	})
+}
+
+func TestPayloads(t *testing.T) {
+	k, _ := unlockedKeyring(t, "passphrase")
+	if err := k.NewBoardKey("board-1"); err != nil {
+		t.Fatalf("new board key: %v", err)
+	}
+
+	t.Run("only_content_fields_are_sealed", func(t *testing.T) {
+		payload := `{"id":"card-1","column_id":"col-1","title":"Secret plan","description":"","position":3}`
+		if !Sensitive(payload) {
+			t.Fatal("expected payload to be sensitive")
+		}
+
+		sealed, err := k.SealPayload("board-1", payload)
+		if err != nil {
+			t.Fatalf("seal: %v", err)
+		}
+		if strings.Contains(sealed, "Secret plan") {
+			t.Fatalf("title leaked: %s", sealed)
+		}
+		if Sensitive(sealed) {
+			t.Error("sealed payload still reported as sensitive")
+		}
+		if got := SealedBoards(sealed); len(got) != 1 || got[0] != "board-1" {
+			t.Errorf("expected sealed boards [board-1], got %v", got)
+		}
+
+		var card map[string]any
+		if err := json.Unmarshal([]byte(sealed), &card); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if card["column_id"] != "col-1" || card["description"] != "" || card["position"] != float64(3) {
+			t.Errorf("structural fields changed: %v", card)
+		}
+	})
+
+	t.Run("nested_exports_open_in_place", func(t *testing.T) {
+		sealed, err := k.SealPayload("board-1", `{"board":{"id":"board-1","name":"Roadmap"},"cards":[{"title":"One"},{"title":"Two"}]}`)
+		if err != nil {
+			t.Fatalf("seal: %v", err)
+		}
+
+		opened, err := k.OpenPayload(sealed)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		if !strings.Contains(opened, `"name":"Roadmap"`) || !strings.Contains(opened, `"title":"Two"`) {
+			t.Errorf("unexpected opened payload: %s", opened)
+		}
+	})
+
+	t.Run("text_that_only_looks_sealed_stays_plain", func(t *testing.T) {
+		for _, payload := range []string{
+			`{"id":"e2e:v1:board-1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}`,
+			`{"name":"notes on e2e:v1: values"}`,
+			`{"name":"e2e:v1:board-1:not base64"}`,
+			`{"name":"e2e:v1:board-1:AAAA"}`,
+		} {
+			if Sealed(payload) {
+				t.Errorf("expected %s not to be sealed", payload)
+			}
+
+			opened, err := NewKeyring().OpenPayload(payload)
+			if err != nil || opened != payload {
+				t.Errorf("expected %s back untouched, got %q, %v", payload, opened, err)
+			}
+		}
+
+		sealed, err := k.SealPayload("board-1", `{"name":"e2e:v1:board-1:AAAA"}`)
+		if err != nil {
+			t.Fatalf("seal: %v", err)
+		}
+		if !Sealed(sealed) {
+			t.Errorf("expected a name that looks sealed to be sealed, got %s", sealed)
+		}
+	})
+
+	t.Run("locked_keyring_cannot_open_sealed_payloads", func(t *testing.T) {
+		sealed, err := k.SealPayload("board-1", `{"name":"Roadmap"}`)
+		if err != nil {
+			t.Fatalf("seal: %v", err)
+		}
+
+		if _, err := NewKeyring().OpenPayload(sealed); !errors.Is(err, ErrLocked) {
+			t.Errorf("expected ErrLocked, got %v", err)
+		}
+
+		plain := `{"name":"Roadmap"}`
+		opened, err := NewKeyring().OpenPayload(plain)
+		if err != nil || opened != plain {
+			t.Errorf("expected plaintext payload back untouched, got %q, %v", opened, err)
+		}
+	})
+}
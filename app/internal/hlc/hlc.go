@@ -0,0 +1,127 @@
+package hlc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a hybrid logical clock keeps the wall time in milliseconds while the machine clock moves forward and counts up when
+// two events share a millisecond or a device ahead of ours was seen. the device id breaks ties. timestamps are fixed
+// width strings so sqlite and postgres can order them with ORDER BY and MAX()
+
+const encodeFormat = "%015d:%010d:%s"
+
+type Timestamp struct {
+	WallTime int64
+	Counter  int64
+	DeviceID string
+}
+
+func (t Timestamp) String() string {
+	return fmt.Sprintf(encodeFormat, t.WallTime, t.Counter, t.DeviceID)
+}
+
+func (t Timestamp) IsZero() bool {
+	return t.WallTime == 0 && t.Counter == 0 && t.DeviceID == ""
+}
+
+// Compare returns -1 if t happened before other, 1 if after and 0 if both are the same timestamp
+func (t Timestamp) Compare(other Timestamp) int {
+	switch {
+	case t.WallTime != other.WallTime:
+		if t.WallTime < other.WallTime {
+			return -1
+		}
+		return 1
+	case t.Counter != other.Counter:
+		if t.Counter < other.Counter {
+			return -1
+		}
+		return 1
+	default:
+		return strings.Compare(t.DeviceID, other.DeviceID)
+	}
+}
+
+func Parse(value string) (Timestamp, error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 {
+		return Timestamp{}, fmt.Errorf("invalid hlc timestamp: %q", value)
+	}
+
+	wall, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid hlc wall time %q: %v", parts[0], err)
+	}
+
+	counter, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid hlc counter %q: %v", parts[1], err)
+	}
+
+	return Timestamp{WallTime: wall, Counter: counter, DeviceID: parts[2]}, nil
+}
+
+// FromTime is used for operations that were recorded before we had a clock, they only know their created_at
+func FromTime(t time.Time, deviceID string) Timestamp {
+	return Timestamp{WallTime: t.UnixMilli(), DeviceID: deviceID}
+}
+
+type Clock struct {
+	mu       sync.Mutex
+	last     Timestamp
+	deviceID string
+	now      func() time.Time
+}
+
+func NewClock(deviceID string) *Clock {
+	return &Clock{
+		deviceID: deviceID,
+		now:      time.Now,
+		last:     Timestamp{DeviceID: deviceID},
+	}
+}
+
+func (c *Clock) DeviceID() string {
+	return c.deviceID
+}
+
+// Now returns a timestamp that is strictly greater than anything this clock has produced or observed
+func (c *Clock) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wall := c.now().UnixMilli()
+	if wall > c.last.WallTime {
+		c.last = Timestamp{WallTime: wall, DeviceID: c.deviceID}
+	} else {
+		c.last = Timestamp{WallTime: c.last.WallTime, Counter: c.last.Counter + 1, DeviceID: c.deviceID}
+	}
+
+	return c.last
+}
+
+// Update moves the clock forward after receiving a timestamp from another device
+func (c *Clock) Update(remote Timestamp) Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wall := c.now().UnixMilli()
+
+	switch {
+	case wall > c.last.WallTime && wall > remote.WallTime:
+		c.last = Timestamp{WallTime: wall, DeviceID: c.deviceID}
+	case remote.WallTime > c.last.WallTime:
+		c.last = Timestamp{WallTime: remote.WallTime, Counter: remote.Counter + 1, DeviceID: c.deviceID}
+	case c.last.WallTime > remote.WallTime:
+		c.last = Timestamp{WallTime: c.last.WallTime, Counter: c.last.Counter + 1, DeviceID: c.deviceID}
+	default:
+		counter := max(c.last.Counter, remote.Counter)
+		c.last = Timestamp{WallTime: c.last.WallTime, Counter: counter + 1, DeviceID: c.deviceID}
+	}
+
+	return c.last
+}
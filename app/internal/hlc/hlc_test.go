@@ -0,0 +1,93 @@
+package hlc
+
+import (
+	"testing"
+	"time"
+)
+
+func fixedClock(deviceID string, now *time.Time) *Clock {
+	c := NewClock(deviceID)
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+func TestClock(t *testing.T) {
+	t.Run("same_millisecond_increments_counter", func(t *testing.T) {
+		now := time.UnixMilli(1_700_000_000_000)
+		c := fixedClock("device-a", &now)
+
+		first := c.Now()
+		second := c.Now()
+
+		if second.Compare(first) <= 0 {
+			t.Fatalf("expected %s to be after %s", second, first)
+		}
+		if second.Counter != 1 {
+			t.Errorf("expected counter 1, got %d", second.Counter)
+		}
+	})
+
+	t.Run("clock_going_backwards_stays_monotonic", func(t *testing.T) {
+		now := time.UnixMilli(1_700_000_000_000)
+		c := fixedClock("device-a", &now)
+
+		first := c.Now()
+		now = now.Add(-time.Minute)
+		second := c.Now()
+
+		if second.Compare(first) <= 0 {
+			t.Fatalf("expected %s to be after %s", second, first)
+		}
+	})
+
+	t.Run("update_moves_past_remote_clock_ahead", func(t *testing.T) {
+		now := time.UnixMilli(1_700_000_000_000)
+		c := fixedClock("device-a", &now)
+
+		remote := Timestamp{WallTime: now.Add(time.Hour).UnixMilli(), Counter: 3, DeviceID: "device-b"}
+		c.Update(remote)
+		local := c.Now()
+
+		if local.Compare(remote) <= 0 {
+			t.Fatalf("expected %s to be after remote %s", local, remote)
+		}
+	})
+
+	t.Run("device_id_breaks_ties", func(t *testing.T) {
+		a := Timestamp{WallTime: 10, Counter: 0, DeviceID: "device-a"}
+		b := Timestamp{WallTime: 10, Counter: 0, DeviceID: "device-b"}
+
+		if a.Compare(b) >= 0 || b.Compare(a) <= 0 {
+			t.Fatalf("expected device id to order equal wall/counter timestamps")
+		}
+	})
+}
+
+func TestEncoding(t *testing.T) {
+	t.Run("round_trip", func(t *testing.T) {
+		ts := Timestamp{WallTime: 1_700_000_000_123, Counter: 42, DeviceID: "a:b"}
+
+		parsed, err := Parse(ts.String())
+		if err != nil {
+			t.Fatalf("failed to parse: %v", err)
+		}
+		if parsed != ts {
+			t.Errorf("expected %+v, got %+v", ts, parsed)
+		}
+	})
+
+	t.Run("string_order_matches_compare", func(t *testing.T) {
+		earlier := Timestamp{WallTime: 999, Counter: 9, DeviceID: "z"}
+		later := Timestamp{WallTime: 1000, Counter: 0, DeviceID: "a"}
+
+		if earlier.String() >= later.String() {
+			t.Errorf("expected %s to sort before %s", earlier, later)
+		}
+	})
+
+	t.Run("invalid_value", func(t *testing.T) {
+		if _, err := Parse("2024-01-01 10:00:00"); err == nil {
+			t.Error("expected error parsing a non hlc value")
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package lan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// hosts broadcast a small announcement on the local network every few seconds, it carries nothing secret. pairing
+// decides who may sync
+
+const (
+	// DiscoveryPort is where announcements are broadcast
+	DiscoveryPort = 47231
+
+	announceInterval = 5 * time.Second
+	// a host that missed a few announcements in a row is gone
+	announceTTL = 3 * announceInterval
+
+	announceService = "seisami-lan"
+)
+
+type Announcement struct {
+	Service  string `json:"service"`
+	DeviceID string `json:"device_id"`
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	// host:port the announcement came from, filled in by whoever received it
+	Address string    `json:"address,omitempty"`
+	SeenAt  time.Time `json:"seen_at,omitempty"`
+}
+
+// Announce broadcasts a until ctx is done
+func Announce(ctx context.Context, a Announcement) {
+	a.Service = announceService
+	payload, err := json.Marshal(a)
+	if err != nil {
+		fmt.Printf("unable to encode lan announcement: %v\n", err)
+		return
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		fmt.Printf("unable to announce on the local network: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	target := &net.UDPAddr{IP: net.IPv4bcast, Port: DiscoveryPort}
+	ticker := time.NewTicker(announceInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := conn.WriteToUDP(payload, target); err != nil {
+			fmt.Printf("unable to announce on the local network: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Discovery keeps the hosts heard on the local network recently
+type Discovery struct {
+	deviceID string
+	now      func() time.Time
+	onFound  func(Announcement)
+
+	mu    sync.Mutex
+	hosts map[string]Announcement
+}
+
+// NewDiscovery ignores this device's own announcements, onFound runs for every announcement heard
+func NewDiscovery(deviceID string, onFound func(Announcement)) *Discovery {
+	if onFound == nil {
+		onFound = func(Announcement) {}
+	}
+
+	return &Discovery{
+		deviceID: deviceID,
+		now:      time.Now,
+		onFound:  onFound,
+		hosts:    make(map[string]Announcement),
+	}
+}
+
+// Listen collects announcements until ctx is done, only one process on a machine can listen at a time
+func (d *Discovery) Listen(ctx context.Context) error {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: DiscoveryPort})
+	if err != nil {
+		return fmt.Errorf("unable to listen for devices on the local network: %v", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					fmt.Printf("stopped listening for devices on the local network: %v\n", err)
+				}
+				return
+			}
+			d.observe(buf[:n], from)
+		}
+	}()
+
+	return nil
+}
+
+func (d *Discovery) observe(payload []byte, from *net.UDPAddr) {
+	var a Announcement
+	if err := json.Unmarshal(payload, &a); err != nil || a.Service != announceService {
+		return
+	}
+	if a.DeviceID == "" || a.DeviceID == d.deviceID || a.Port <= 0 {
+		return
+	}
+
+	a.Address = net.JoinHostPort(from.IP.String(), strconv.Itoa(a.Port))
+	a.SeenAt = d.now()
+
+	d.mu.Lock()
+	d.hosts[a.DeviceID] = a
+	d.mu.Unlock()
+
+	d.onFound(a)
+}
+
+// Hosts are the hosts heard from lately, by name
+func (d *Discovery) Hosts() []Announcement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hosts := make([]Announcement, 0, len(d.hosts))
+	for id, a := range d.hosts {
+		if d.now().Sub(a.SeenAt) > announceTTL {
+			delete(d.hosts, id)
+			continue
+		}
+		hosts = append(hosts, a)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Name != hosts[j].Name {
+			return hosts[i].Name < hosts[j].Name
+		}
+		return hosts[i].DeviceID < hosts[j].DeviceID
+	})
+
+	return hosts
+}
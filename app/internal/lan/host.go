@@ -0,0 +1,457 @@
+package lan
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"seisami/app/internal/cloud"
+	"seisami/app/internal/repo/sqlc/query"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a Host shares this device's sync folder with the devices that paired with it, they sync through it like through a
+// shared folder and the host applies nothing itself
+
+const (
+	// DefaultPort is where a host serves its folder, a fixed port so paired devices find it again after a restart
+	DefaultPort = 47232
+
+	pairingWindow      = 10 * time.Minute
+	maxPairingAttempts = 5
+	maxClockSkew       = 5 * time.Minute
+	maxBodySize        = 64 << 20
+)
+
+// PeerRegistry keeps the devices that paired with this host and the tokens they sign with
+type PeerRegistry interface {
+	PairLanPeer(deviceID, name, token string) error
+	GetLanPeer(deviceID string) (query.LanPeer, error)
+}
+
+// pairStartRequest opens an exchange, Share is the joining device's half of it
+type pairStartRequest struct {
+	DeviceID string `json:"device_id"`
+	Name     string `json:"name"`
+	Nonce    string `json:"nonce"`
+	Share    string `json:"share"`
+}
+
+type pairStartResponse struct {
+	DeviceID string `json:"device_id"`
+	Name     string `json:"name"`
+	Share    string `json:"share"`
+	// proves the host derived the same key, so knows the code
+	Confirm string `json:"confirm"`
+}
+
+type pairFinishRequest struct {
+	DeviceID string `json:"device_id"`
+	Nonce    string `json:"nonce"`
+	Confirm  string `json:"confirm"`
+}
+
+type pairFinishResponse struct {
+	// the token sealed with the key the exchange gave, hex
+	Token string `json:"token"`
+}
+
+// pairSession is an exchange the host answered and waits to see confirmed
+type pairSession struct {
+	deviceID string
+	name     string
+	secret   []byte
+}
+
+type listResponse struct {
+	Keys []string `json:"keys"`
+}
+
+type Host struct {
+	store    cloud.ObjectStore
+	peers    PeerRegistry
+	deviceID string
+	name     string
+	onChange func()
+	now      func() time.Time
+
+	mu        sync.Mutex
+	code      string
+	codeUntil time.Time
+	attempts  int
+	// exchanges of the open code by the joining device's nonce
+	sessions map[string]pairSession
+	// signatures of the requests let through, until their time is too far off to be let through again
+	seen map[string]time.Time
+}
+
+// NewHost shares store with paired devices, onChange runs whenever one of them finished a push
+func NewHost(store cloud.ObjectStore, peers PeerRegistry, deviceID, name string, onChange func()) *Host {
+	if onChange == nil {
+		onChange = func() {}
+	}
+
+	return &Host{
+		store:    store,
+		peers:    peers,
+		deviceID: deviceID,
+		name:     name,
+		onChange: onChange,
+		now:      time.Now,
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// OpenPairing returns a code that lets one device pair in the next 10 minutes, any earlier code stops working
+func (h *Host) OpenPairing() (string, error) {
+	code, err := newPairingCode()
+	if err != nil {
+		return "", err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.code = code
+	h.codeUntil = h.now().Add(pairingWindow)
+	h.attempts = 0
+	h.sessions = make(map[string]pairSession)
+
+	return code, nil
+}
+
+// startPairing answers a joining device's share with the host's. every exchange lets its starter check one guess of
+// the code, so a few of them close pairing whether confirmed or not
+func (h *Host) startPairing(req pairStartRequest) (pairStartResponse, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.code == "" || h.now().After(h.codeUntil) {
+		return pairStartResponse{}, fmt.Errorf("pairing is not open on this device")
+	}
+	if h.attempts >= maxPairingAttempts {
+		h.code = ""
+		return pairStartResponse{}, fmt.Errorf("pairing is not open on this device")
+	}
+	h.attempts++
+
+	share, err := newPairShare(h.code, req.DeviceID, req.Nonce)
+	if err != nil {
+		return pairStartResponse{}, err
+	}
+
+	hostShare := hex.EncodeToString(share.public)
+	secret, err := share.pairSecret(req.Share, req.Nonce, req.DeviceID, h.deviceID, req.Share, hostShare)
+	if err != nil {
+		return pairStartResponse{}, err
+	}
+
+	h.sessions[req.Nonce] = pairSession{deviceID: req.DeviceID, name: req.Name, secret: secret}
+	return pairStartResponse{
+		DeviceID: h.deviceID,
+		Name:     h.name,
+		Share:    hostShare,
+		Confirm:  pairConfirm(secret, "host"),
+	}, nil
+}
+
+// finishPairing takes the joining device's confirmation, the code pairs the first device that confirms only
+func (h *Host) finishPairing(req pairFinishRequest) (pairSession, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	session, ok := h.sessions[req.Nonce]
+	delete(h.sessions, req.Nonce)
+	if h.code == "" || h.now().After(h.codeUntil) {
+		return pairSession{}, fmt.Errorf("pairing is not open on this device")
+	}
+	if !ok || session.deviceID != req.DeviceID {
+		return pairSession{}, fmt.Errorf("no pairing was started")
+	}
+	if !pairConfirmed(session.secret, "joining", req.Confirm) {
+		return pairSession{}, fmt.Errorf("wrong pairing code")
+	}
+
+	h.code = ""
+	h.sessions = nil
+	return session, nil
+}
+
+func (h *Host) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /lan/v1/pair/start", h.handlePairStart)
+	mux.HandleFunc("POST /lan/v1/pair/finish", h.handlePairFinish)
+	mux.HandleFunc("GET /lan/v1/objects", h.authenticated(h.handleList))
+	mux.HandleFunc("GET /lan/v1/objects/{key...}", h.authenticated(h.handleGet))
+	mux.HandleFunc("PUT /lan/v1/objects/{key...}", h.authenticated(h.handlePut))
+	return mux
+}
+
+// Start serves the folder on port and announces it on the network until ctx is done
+func (h *Host) Start(ctx context.Context, port int) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return fmt.Errorf("unable to listen on port %d: %v", port, err)
+	}
+
+	server := &http.Server{Handler: h.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("lan sync host stopped: %v\n", err)
+		}
+	}()
+	go Announce(ctx, Announcement{DeviceID: h.deviceID, Name: h.name, Port: port})
+
+	return nil
+}
+
+func (h *Host) handlePairStart(w http.ResponseWriter, r *http.Request) {
+	var req pairStartRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "invalid pair request", http.StatusBadRequest)
+		return
+	}
+	if req.DeviceID == "" || req.Nonce == "" || req.Share == "" || req.DeviceID == h.deviceID {
+		http.Error(w, "invalid pair request", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.startPairing(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Host) handlePairFinish(w http.ResponseWriter, r *http.Request) {
+	var req pairFinishRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "invalid pair request", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.finishPairing(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		http.Error(w, "unable to pair", http.StatusInternalServerError)
+		return
+	}
+
+	sealed, err := seal(pairTokenKey(session.secret), []byte(token), []byte(session.deviceID))
+	if err != nil {
+		http.Error(w, "unable to pair", http.StatusInternalServerError)
+		return
+	}
+
+	name := session.name
+	if name == "" {
+		name = session.deviceID
+	}
+	if err := h.peers.PairLanPeer(session.deviceID, name, token); err != nil {
+		fmt.Printf("unable to pair device: %v\n", err)
+		http.Error(w, "unable to pair", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pairFinishResponse{Token: hex.EncodeToString(sealed)})
+}
+
+type peerRequest struct {
+	deviceID  string
+	token     string
+	signature string
+	body      []byte
+}
+
+// authenticated only lets signed requests from paired devices through, each once, and hands the handler the opened body
+func (h *Host) authenticated(next func(w http.ResponseWriter, r *http.Request, req peerRequest)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceID := r.Header.Get(headerDevice)
+		timestamp := r.Header.Get(headerTime)
+		nonce := r.Header.Get(headerNonce)
+		sig := r.Header.Get(headerSignature)
+		if deviceID == "" || timestamp == "" || nonce == "" || sig == "" {
+			http.Error(w, "unsigned request", http.StatusUnauthorized)
+			return
+		}
+
+		sentAt, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid request time", http.StatusUnauthorized)
+			return
+		}
+		if skew := h.now().Sub(time.Unix(sentAt, 0)); skew > maxClockSkew || skew < -maxClockSkew {
+			http.Error(w, "request time is too far off, check both devices clocks", http.StatusUnauthorized)
+			return
+		}
+
+		peer, err := h.peers.GetLanPeer(deviceID)
+		if err != nil {
+			http.Error(w, "device is not paired", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "unable to read request", http.StatusBadRequest)
+			return
+		}
+
+		expected := signature(peer.Token, r.Method, r.URL.EscapedPath(), r.URL.RawQuery, timestamp, nonce, body)
+		if !hmac.Equal([]byte(expected), []byte(sig)) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if !h.firstSeen(sig, time.Unix(sentAt, 0).Add(maxClockSkew)) {
+			http.Error(w, "request was already sent", http.StatusUnauthorized)
+			return
+		}
+
+		if len(body) > 0 {
+			body, err = open(bodyKey(peer.Token), body, []byte(r.Method+" "+r.URL.EscapedPath()))
+			if err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		next(w, r, peerRequest{deviceID: deviceID, token: peer.Token, signature: sig, body: body})
+	}
+}
+
+// firstSeen remembers sig until it expires and reports whether it wasn't seen before, a repeat is a replay
+func (h *Host) firstSeen(sig string, expires time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	for seen, until := range h.seen {
+		if now.After(until) {
+			delete(h.seen, seen)
+		}
+	}
+
+	if _, ok := h.seen[sig]; ok {
+		return false
+	}
+	h.seen[sig] = expires
+	return true
+}
+
+// reply seals the response to the request it answers, so an old response can't be passed off as a new one
+func (h *Host) reply(w http.ResponseWriter, req peerRequest, data []byte) {
+	sealed, err := seal(bodyKey(req.token), data, []byte(req.signature))
+	if err != nil {
+		http.Error(w, "unable to seal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(sealed)
+}
+
+// validKey keeps keys inside the folder, no absolute paths and no climbing out of it
+func validKey(key string) bool {
+	if key == "" || strings.Contains(key, "\\") {
+		return false
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writableBy is what a paired device may write: its own segments, manifest and sync state, like on any storage
+func writableBy(deviceID, key string) bool {
+	return strings.HasPrefix(key, "segments/"+deviceID+"/") || strings.HasPrefix(key, "devices/"+deviceID+"/")
+}
+
+func (h *Host) handleGet(w http.ResponseWriter, r *http.Request, req peerRequest) {
+	key := r.PathValue("key")
+	if !validKey(key) {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.store.Get(r.Context(), key)
+	if errors.Is(err, cloud.ErrObjectNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.reply(w, req, data)
+}
+
+func (h *Host) handlePut(w http.ResponseWriter, r *http.Request, req peerRequest) {
+	key := r.PathValue("key")
+	if !validKey(key) {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+	if !writableBy(req.deviceID, key) {
+		http.Error(w, "a device can only write its own files", http.StatusForbidden)
+		return
+	}
+
+	if err := h.store.Put(r.Context(), key, req.body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// a push is done once its segment is listed in the manifest
+	if strings.HasSuffix(key, "/manifest.json") {
+		go h.onChange()
+	}
+
+	h.reply(w, req, nil)
+}
+
+func (h *Host) handleList(w http.ResponseWriter, r *http.Request, req peerRequest) {
+	prefix := r.URL.Query().Get("prefix")
+	if !validKey(strings.TrimSuffix(prefix, "/")) {
+		http.Error(w, "invalid prefix", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := h.store.List(r.Context(), prefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(listResponse{Keys: keys})
+	if err != nil {
+		http.Error(w, "unable to encode listing", http.StatusInternalServerError)
+		return
+	}
+
+	h.reply(w, req, data)
+}
@@ -0,0 +1,250 @@
+package lan
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"seisami/app/internal/cloud"
+	"seisami/app/internal/repo/sqlc/query"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryPeers struct {
+	mu    sync.Mutex
+	peers map[string]query.LanPeer
+}
+
+func (m *memoryPeers) PairLanPeer(deviceID, name, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.peers[deviceID] = query.LanPeer{DeviceID: deviceID, Name: name, Token: token}
+	return nil
+}
+
+func (m *memoryPeers) GetLanPeer(deviceID string) (query.LanPeer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peer, ok := m.peers[deviceID]
+	if !ok {
+		return query.LanPeer{}, sql.ErrNoRows
+	}
+	return peer, nil
+}
+
+func newTestHost(t *testing.T) (*Host, *memoryPeers, string) {
+	t.Helper()
+
+	store, err := cloud.NewFolderStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFolderStore failed: %v", err)
+	}
+
+	peers := &memoryPeers{peers: make(map[string]query.LanPeer)}
+	host := NewHost(store, peers, "host-device", "Studio", nil)
+	server := httptest.NewServer(host.Handler())
+	t.Cleanup(server.Close)
+
+	return host, peers, strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestPair(t *testing.T) {
+	t.Run("pairs_with_the_code_the_host_shows", func(t *testing.T) {
+		host, peers, address := newTestHost(t)
+		code, err := host.OpenPairing()
+		if err != nil {
+			t.Fatalf("OpenPairing failed: %v", err)
+		}
+
+		pairing, err := Pair(t.Context(), address, "laptop", "Laptop", strings.ToLower(code))
+		if err != nil {
+			t.Fatalf("Pair failed: %v", err)
+		}
+		if pairing.DeviceID != "host-device" || pairing.Name != "Studio" {
+			t.Errorf("unexpected pairing: %+v", pairing)
+		}
+
+		peer, err := peers.GetLanPeer("laptop")
+		if err != nil || peer.Token != pairing.Token {
+			t.Errorf("expected the host to keep the token it handed out, got %+v (%v)", peer, err)
+		}
+
+		if _, err := Pair(t.Context(), address, "phone", "Phone", code); err == nil {
+			t.Errorf("expected a code to pair one device only")
+		}
+	})
+
+	t.Run("wrong_codes_close_pairing", func(t *testing.T) {
+		host, _, address := newTestHost(t)
+		code, err := host.OpenPairing()
+		if err != nil {
+			t.Fatalf("OpenPairing failed: %v", err)
+		}
+
+		for range maxPairingAttempts {
+			if _, err := Pair(t.Context(), address, "laptop", "Laptop", "AAAA-AAAA"); err == nil {
+				t.Fatalf("expected a wrong code to be refused")
+			}
+		}
+
+		if _, err := Pair(t.Context(), address, "laptop", "Laptop", code); err == nil || !strings.Contains(err.Error(), "not open") {
+			t.Errorf("expected pairing to close after too many wrong codes, got %v", err)
+		}
+	})
+
+	t.Run("a_wrong_code_gets_no_token", func(t *testing.T) {
+		host, peers, address := newTestHost(t)
+		if _, err := host.OpenPairing(); err != nil {
+			t.Fatalf("OpenPairing failed: %v", err)
+		}
+
+		// walk both steps by hand with a guessed code, the host must refuse to finish instead of sealing a token
+		nonce := "00112233445566778899aabbccddeeff"
+		share, err := newPairShare("AAAA-AAAA", "laptop", nonce)
+		if err != nil {
+			t.Fatalf("newPairShare failed: %v", err)
+		}
+		joiningShare := hex.EncodeToString(share.public)
+
+		var started pairStartResponse
+		if err := postPair(t.Context(), address, "start", pairStartRequest{DeviceID: "laptop", Name: "Laptop", Nonce: nonce, Share: joiningShare}, &started); err != nil {
+			t.Fatalf("start failed: %v", err)
+		}
+		secret, err := share.pairSecret(started.Share, nonce, "laptop", started.DeviceID, joiningShare, started.Share)
+		if err != nil {
+			t.Fatalf("pairSecret failed: %v", err)
+		}
+		if pairConfirmed(secret, "host", started.Confirm) {
+			t.Errorf("expected the host's confirmation not to match a wrong code")
+		}
+
+		var finished pairFinishResponse
+		err = postPair(t.Context(), address, "finish", pairFinishRequest{DeviceID: "laptop", Nonce: nonce, Confirm: pairConfirm(secret, "joining")}, &finished)
+		if err == nil || finished.Token != "" {
+			t.Errorf("expected finishing with a wrong code to be refused, got %+v", finished)
+		}
+		if _, err := peers.GetLanPeer("laptop"); err == nil {
+			t.Errorf("expected no peer to be stored")
+		}
+	})
+
+	t.Run("expired_code_is_refused", func(t *testing.T) {
+		host, _, address := newTestHost(t)
+		code, err := host.OpenPairing()
+		if err != nil {
+			t.Fatalf("OpenPairing failed: %v", err)
+		}
+		host.now = func() time.Time { return time.Now().Add(pairingWindow + time.Minute) }
+
+		if _, err := Pair(t.Context(), address, "laptop", "Laptop", code); err == nil {
+			t.Errorf("expected an expired code to be refused")
+		}
+	})
+}
+
+func TestPeerStore(t *testing.T) {
+	host, peers, address := newTestHost(t)
+	code, err := host.OpenPairing()
+	if err != nil {
+		t.Fatalf("OpenPairing failed: %v", err)
+	}
+	pairing, err := Pair(t.Context(), address, "laptop", "Laptop", code)
+	if err != nil {
+		t.Fatalf("Pair failed: %v", err)
+	}
+
+	store, err := NewPeerStore(address, "laptop", pairing.Token)
+	if err != nil {
+		t.Fatalf("NewPeerStore failed: %v", err)
+	}
+
+	if err := store.Put(t.Context(), "segments/laptop/cards/0000000001.json", []byte(`[{"id":"op-1"}]`)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	data, err := store.Get(t.Context(), "segments/laptop/cards/0000000001.json")
+	if err != nil || string(data) != `[{"id":"op-1"}]` {
+		t.Errorf("expected the segment back, got %q (%v)", data, err)
+	}
+
+	keys, err := store.List(t.Context(), "segments/")
+	if err != nil || len(keys) != 1 || keys[0] != "segments/laptop/cards/0000000001.json" {
+		t.Errorf("unexpected listing %v (%v)", keys, err)
+	}
+
+	if _, err := store.Get(t.Context(), "devices/laptop/manifest.json"); !errors.Is(err, cloud.ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+
+	if err := store.Put(t.Context(), "segments/host-device/cards/0000000001.json", []byte(`[]`)); err == nil {
+		t.Errorf("expected a device not to be able to write another device's files")
+	}
+	if _, err := store.Get(t.Context(), "segments/../../etc/passwd"); err == nil {
+		t.Errorf("expected keys outside the folder to be refused")
+	}
+
+	// the same signed request sent a second time, as someone who saw it go past could
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := signature(pairing.Token, http.MethodGet, "/lan/v1/objects", "prefix=segments%2F", timestamp, "abc123", nil)
+	send := func() int {
+		req, err := http.NewRequest(http.MethodGet, "http://"+address+"/lan/v1/objects?prefix=segments%2F", nil)
+		if err != nil {
+			t.Fatalf("NewRequest failed: %v", err)
+		}
+		req.Header.Set(headerDevice, "laptop")
+		req.Header.Set(headerTime, timestamp)
+		req.Header.Set(headerNonce, "abc123")
+		req.Header.Set(headerSignature, sig)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if status := send(); status != http.StatusOK {
+		t.Errorf("expected the first request through, got %d", status)
+	}
+	if status := send(); status != http.StatusUnauthorized {
+		t.Errorf("expected a replayed request to be refused, got %d", status)
+	}
+
+	stranger, err := NewPeerStore(address, "laptop", strings.Repeat("0", 64))
+	if err != nil {
+		t.Fatalf("NewPeerStore failed: %v", err)
+	}
+	if _, err := stranger.List(t.Context(), "segments/"); err == nil {
+		t.Errorf("expected a request signed with the wrong token to be refused")
+	}
+
+	delete(peers.peers, "laptop")
+	if _, err := store.List(t.Context(), "segments/"); err == nil {
+		t.Errorf("expected a removed device to be refused")
+	}
+}
+
+func TestDiscoveryObserve(t *testing.T) {
+	var found []Announcement
+	d := NewDiscovery("laptop", func(a Announcement) { found = append(found, a) })
+	from := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 50000}
+
+	d.observe([]byte(`{"service":"seisami-lan","device_id":"laptop","name":"Laptop","port":47232}`), from)
+	d.observe([]byte(`{"service":"other","device_id":"printer","port":9100}`), from)
+	d.observe([]byte(`{"service":"seisami-lan","device_id":"host-device","name":"Studio","port":47232}`), from)
+
+	hosts := d.Hosts()
+	if len(hosts) != 1 || hosts[0].Address != "192.168.1.20:47232" || len(found) != 1 {
+		t.Fatalf("expected only the studio host to be found, got %+v", hosts)
+	}
+
+	d.now = func() time.Time { return time.Now().Add(announceTTL + time.Second) }
+	if hosts := d.Hosts(); len(hosts) != 0 {
+		t.Errorf("expected a host that stopped announcing to be forgotten, got %+v", hosts)
+	}
+}
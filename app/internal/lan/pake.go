@@ -0,0 +1,152 @@
+package lan
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// pairing runs CPace over X25519, both devices map the code to a curve point and use it as the Diffie-Hellman base.
+// an eavesdropper can't check guesses of the code and each exchange checks one, so the host counts exchanges
+
+var (
+	fieldPrime  = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	montgomeryA = big.NewInt(486662)
+)
+
+// pairInput joins parts with their lengths in front, so no two different inputs hash the same
+func pairInput(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(part)))
+		out = append(out, part...)
+	}
+
+	return out
+}
+
+// isSquare is Euler's criterion mod the field prime
+func isSquare(v *big.Int) bool {
+	if v.Sign() == 0 {
+		return true
+	}
+
+	exp := new(big.Int).Rsh(new(big.Int).Sub(fieldPrime, big.NewInt(1)), 1)
+	return new(big.Int).Exp(v, exp, fieldPrime).Cmp(big.NewInt(1)) == 0
+}
+
+// elligator2 maps a field element to the u coordinate of a curve25519 point, map_to_curve_elligator2 of RFC 9380
+func elligator2(r *big.Int) *big.Int {
+	p := fieldPrime
+	minusOne := new(big.Int).Sub(p, big.NewInt(1))
+
+	tv1 := new(big.Int).Mul(r, r)
+	tv1.Lsh(tv1, 1).Mod(tv1, p)
+	if tv1.Cmp(minusOne) == 0 {
+		tv1.SetInt64(0)
+	}
+
+	den := new(big.Int).Add(tv1, big.NewInt(1))
+	x1 := new(big.Int).Neg(montgomeryA)
+	x1.Mul(x1, new(big.Int).ModInverse(den, p)).Mod(x1, p)
+
+	// gx1 = x1^3 + A*x1^2 + x1
+	gx1 := new(big.Int).Add(x1, montgomeryA)
+	gx1.Mul(gx1, x1).Add(gx1, big.NewInt(1)).Mul(gx1, x1).Mod(gx1, p)
+	if isSquare(gx1) {
+		return x1
+	}
+
+	x2 := new(big.Int).Neg(x1)
+	return x2.Sub(x2, montgomeryA).Mod(x2, p)
+}
+
+// pairGenerator is the base point both devices derive from the code and the joining device's session
+func pairGenerator(code, deviceID, nonce string) (*ecdh.PublicKey, error) {
+	sum := sha512.Sum512(pairInput([]byte("seisami lan pair generator"), []byte(normalizeCode(code)), []byte(deviceID), []byte(nonce)))
+	r := new(big.Int).SetBytes(sum[:])
+	u := elligator2(r.Mod(r, fieldPrime)).FillBytes(make([]byte, 32))
+
+	// X25519 wants the coordinate little endian
+	for i, j := 0, len(u)-1; i < j; i, j = i+1, j-1 {
+		u[i], u[j] = u[j], u[i]
+	}
+
+	return ecdh.X25519().NewPublicKey(u)
+}
+
+// pairShare is one device's half of the exchange
+type pairShare struct {
+	private *ecdh.PrivateKey
+	public  []byte
+}
+
+func newPairShare(code, deviceID, nonce string) (pairShare, error) {
+	generator, err := pairGenerator(code, deviceID, nonce)
+	if err != nil {
+		return pairShare{}, fmt.Errorf("unable to derive pairing point: %v", err)
+	}
+
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return pairShare{}, fmt.Errorf("unable to generate pairing key: %v", err)
+	}
+
+	public, err := private.ECDH(generator)
+	if err != nil {
+		return pairShare{}, fmt.Errorf("unable to derive pairing share: %v", err)
+	}
+
+	return pairShare{private: private, public: public}, nil
+}
+
+// pairSecret is the key both devices end up with, bound to everything the exchange carried. the shares are hex as sent
+func (s pairShare) pairSecret(peerShare, nonce, joiningDevice, hostDevice, joiningShare, hostShare string) ([]byte, error) {
+	raw, err := hex.DecodeString(peerShare)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pairing share: %v", err)
+	}
+
+	peer, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pairing share: %v", err)
+	}
+
+	// fails on low order shares, which would give a key that doesn't depend on the code
+	shared, err := s.private.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pairing share: %v", err)
+	}
+
+	sum := sha256.Sum256(pairInput(
+		[]byte("seisami lan pair key"),
+		shared,
+		[]byte(nonce),
+		[]byte(joiningDevice),
+		[]byte(hostDevice),
+		[]byte(joiningShare),
+		[]byte(hostShare),
+	))
+	return sum[:], nil
+}
+
+// pairConfirm proves to the other device that side derived the same key, each side signs its own label
+func pairConfirm(secret []byte, side string) string {
+	return hex.EncodeToString(mac(string(secret), "confirm\n"+side))
+}
+
+// pairConfirmed compares a confirmation in constant time
+func pairConfirmed(secret []byte, side, confirm string) bool {
+	return hmac.Equal([]byte(pairConfirm(secret, side)), []byte(confirm))
+}
+
+// pairTokenKey seals the token the host hands out once the joining device confirmed
+func pairTokenKey(secret []byte) []byte {
+	return mac(string(secret), "token")
+}
@@ -0,0 +1,270 @@
+package lan
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"seisami/app/internal/cloud"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pairing is what a device keeps after pairing with a host, the token signs every request it sends there
+type Pairing struct {
+	DeviceID string
+	Name     string
+	Token    string
+}
+
+var httpClient = http.Client{Timeout: 30 * time.Second}
+
+// Pair asks the host at address (host:port) to let this device sync through it, code is the one the host shows
+func Pair(ctx context.Context, address, deviceID, name, code string) (Pairing, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return Pairing{}, fmt.Errorf("unable to pair: %v", err)
+	}
+
+	share, err := newPairShare(code, deviceID, nonce)
+	if err != nil {
+		return Pairing{}, fmt.Errorf("unable to pair: %v", err)
+	}
+	joiningShare := hex.EncodeToString(share.public)
+
+	var started pairStartResponse
+	err = postPair(ctx, address, "start", pairStartRequest{
+		DeviceID: deviceID,
+		Name:     name,
+		Nonce:    nonce,
+		Share:    joiningShare,
+	}, &started)
+	if err != nil {
+		return Pairing{}, err
+	}
+
+	secret, err := share.pairSecret(started.Share, nonce, deviceID, started.DeviceID, joiningShare, started.Share)
+	if err != nil {
+		return Pairing{}, fmt.Errorf("invalid pair response: %v", err)
+	}
+
+	// the host only derives the same key with the same code, so its confirmation is also how it proves who it is
+	if !pairConfirmed(secret, "host", started.Confirm) {
+		return Pairing{}, fmt.Errorf("wrong pairing code, or the device at %s isn't the one showing it", address)
+	}
+
+	var finished pairFinishResponse
+	err = postPair(ctx, address, "finish", pairFinishRequest{
+		DeviceID: deviceID,
+		Nonce:    nonce,
+		Confirm:  pairConfirm(secret, "joining"),
+	}, &finished)
+	if err != nil {
+		return Pairing{}, err
+	}
+
+	sealed, err := hex.DecodeString(finished.Token)
+	if err != nil {
+		return Pairing{}, fmt.Errorf("invalid pair response: %v", err)
+	}
+
+	token, err := open(pairTokenKey(secret), sealed, []byte(deviceID))
+	if err != nil {
+		return Pairing{}, fmt.Errorf("invalid pair response: %v", err)
+	}
+
+	return Pairing{DeviceID: started.DeviceID, Name: started.Name, Token: string(token)}, nil
+}
+
+// postPair sends one step of pairing to the host and decodes its answer into resp
+func postPair(ctx context.Context, address, step string, payload, resp any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("unable to encode pair request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+address+"/lan/v1/pair/"+step, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("prepare request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach %s: %v", address, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<16))
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("pairing refused: %s", strings.TrimSpace(string(body)))
+	}
+
+	if err := json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("unable to decode pair response: %v", err)
+	}
+
+	return nil
+}
+
+// PeerStore is the folder a paired host shares, reached over the network
+type PeerStore struct {
+	deviceID string
+	token    string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	address string
+}
+
+func NewPeerStore(address, deviceID, token string) (*PeerStore, error) {
+	if address == "" {
+		return nil, fmt.Errorf("paired device address is required")
+	}
+	if deviceID == "" || token == "" {
+		return nil, fmt.Errorf("this device is not paired")
+	}
+
+	return &PeerStore{
+		address:  address,
+		deviceID: deviceID,
+		token:    token,
+		now:      time.Now,
+	}, nil
+}
+
+func (p *PeerStore) Address() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.address
+}
+
+// SetAddress follows the host to where it is now, its address changes when the network hands it a new one
+func (p *PeerStore) SetAddress(address string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.address = address
+}
+
+func (p *PeerStore) Get(ctx context.Context, key string) ([]byte, error) {
+	status, body, err := p.do(ctx, http.MethodGet, "/lan/v1/objects/"+key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", cloud.ErrObjectNotFound, key)
+	default:
+		return nil, fmt.Errorf("paired device returned status %d for %s: %s", status, key, string(body))
+	}
+}
+
+func (p *PeerStore) Put(ctx context.Context, key string, data []byte) error {
+	status, body, err := p.do(ctx, http.MethodPut, "/lan/v1/objects/"+key, nil, data)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("paired device returned status %d for %s: %s", status, key, string(body))
+	}
+
+	return nil
+}
+
+func (p *PeerStore) List(ctx context.Context, prefix string) ([]string, error) {
+	params := url.Values{}
+	params.Set("prefix", prefix)
+
+	status, body, err := p.do(ctx, http.MethodGet, "/lan/v1/objects", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("paired device returned status %d listing %s: %s", status, prefix, string(body))
+	}
+
+	var result listResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unable to decode listing of %s: %v", prefix, err)
+	}
+
+	return result.Keys, nil
+}
+
+// do sends a signed request with a sealed body and opens the response, an error response comes back as plain text
+func (p *PeerStore) do(ctx context.Context, method, path string, params url.Values, data []byte) (int, []byte, error) {
+	escaped := (&url.URL{Path: path}).EscapedPath()
+	rawQuery := params.Encode()
+
+	var payload []byte
+	if data != nil {
+		sealed, err := seal(bodyKey(p.token), data, []byte(method+" "+escaped))
+		if err != nil {
+			return 0, nil, err
+		}
+		payload = sealed
+	}
+
+	target := "http://" + p.Address() + escaped
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, fmt.Errorf("prepare request: %w", err)
+	}
+
+	nonce, err := randomHex(16)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to generate nonce: %v", err)
+	}
+
+	timestamp := strconv.FormatInt(p.now().Unix(), 10)
+	sig := signature(p.token, method, escaped, rawQuery, timestamp, nonce, payload)
+	req.Header.Set(headerDevice, p.deviceID)
+	req.Header.Set(headerTime, timestamp)
+	req.Header.Set(headerNonce, nonce)
+	req.Header.Set(headerSignature, sig)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("execute request: %w: %v", cloud.ErrUnreachable, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return res.StatusCode, nil, fmt.Errorf("read response body: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, bytes.TrimSpace(body), nil
+	}
+
+	if len(body) == 0 {
+		return res.StatusCode, nil, nil
+	}
+
+	opened, err := open(bodyKey(p.token), body, []byte(sig))
+	if err != nil {
+		return res.StatusCode, nil, fmt.Errorf("paired device sent a response that doesn't belong to this request: %v", err)
+	}
+
+	return res.StatusCode, opened, nil
+}
+
+var _ cloud.ObjectStore = (*PeerStore)(nil)
@@ -11,4 +11,8 @@ type Local interface {
 	UpdateSyncState(state query.SyncState) error
 	// This would be an upsert query
 	UpdateLocalDB(op types.OperationSync) error
+	// ApplyBatch applies ops and moves the pull cursor of tableName in one transaction, all or nothing
+	ApplyBatch(tableName types.TableName, ops []types.OperationSync, cursor string) error
+	// RetryParked applies the ops parked for a missing parent that can go in now
+	RetryParked() (int, error)
 }
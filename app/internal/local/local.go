@@ -2,28 +2,59 @@ package local
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"seisami/app/internal/e2e"
+	"seisami/app/internal/merge"
 	"seisami/app/internal/repo"
 	"seisami/app/internal/repo/sqlc/query"
 	"seisami/app/types"
+	"sort"
 )
 
+// ErrMissingParent means an op points at a board or column that hasn't been pulled yet, it can be retried later
+var ErrMissingParent = errors.New("parent record missing")
+
+// ErrSealed means an op is end to end encrypted and this device can't open it yet, it's parked like a missing parent
+var ErrSealed = errors.New("payload is encrypted")
+
 type localFuncs struct {
 	repo repo.Repository
+	// opens end to end encrypted payloads, nil when encryption isn't set up
+	keyring *e2e.Keyring
 }
 
 func NewLocalFuncs(repo repo.Repository) localFuncs {
 	return localFuncs{
 		repo,
+		nil,
 	}
 }
 
+// WithKeyring decrypts the ops it applies with keyring
+func (lf localFuncs) WithKeyring(keyring *e2e.Keyring) localFuncs {
+	lf.keyring = keyring
+	return lf
+}
+
+// scoped runs against tx instead of the repo it was made with
+func (lf localFuncs) scoped(tx repo.Repository) localFuncs {
+	lf.repo = tx
+	return lf
+}
+
 func (lf localFuncs) GetAllOperations(tableName types.TableName) ([]types.OperationSync, error) {
 	ops, err := lf.repo.GetAllOperations(tableName)
 	if err != nil {
 		return nil, err
 	}
 
+	// only the latest op of a record gets synced, so it has to carry every field changed since the last sync
+	pending, err := lf.repo.GetPendingOperationFields(tableName)
+	if err != nil {
+		return nil, err
+	}
+
 	var operationPayload = make([]types.OperationSync, 0)
 
 	for _, op := range ops {
@@ -36,7 +67,14 @@ func (lf localFuncs) GetAllOperations(tableName types.TableName) ([]types.Operat
 			PayloadData:   op.Payload,
 			CreatedAt:     op.CreatedAt.String,
 			UpdatedAt:     op.UpdatedAt.String,
+			HLC:           op.Hlc,
+		}
+
+		fields, err := merge.Union(tableName, append(pending[op.RecordID], op.Fields))
+		if err != nil {
+			return nil, fmt.Errorf("invalid fields on operation %s: %v", op.ID, err)
 		}
+		payload.Fields = fields
 
 		operationPayload = append(operationPayload, payload)
 	}
@@ -51,6 +89,14 @@ func (lf localFuncs) UpdateLocalDB(op types.OperationSync) error {
 		return fmt.Errorf("invalid table name: %v", err)
 	}
 
+	if e2e.Sealed(op.PayloadData) {
+		opened, err := lf.keyring.OpenPayload(op.PayloadData)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrSealed, err)
+		}
+		op.PayloadData = opened
+	}
+
 	switch tableName {
 	case types.BoardTable:
 		return lf.updateBoardFromOperation(op)
@@ -65,6 +111,118 @@ func (lf localFuncs) UpdateLocalDB(op types.OperationSync) error {
 	}
 }
 
+// ApplyBatch applies a page of pulled ops and stores its cursor in one transaction, so a failed page is pulled again.
+// ops whose parent hasn't arrived are parked for RetryParked
+func (lf localFuncs) ApplyBatch(tableName types.TableName, ops []types.OperationSync, cursor string) error {
+	return lf.repo.InTx(func(tx repo.Repository) error {
+		scoped := lf.scoped(tx)
+
+		for _, op := range ops {
+			if err := scoped.applyOrPark(op); err != nil {
+				return fmt.Errorf("unable to apply operation %s: %v", op.ID, err)
+			}
+		}
+
+		return tx.SetPullCursor(tableName, cursor)
+	})
+}
+
+// RetryParked gives every parked op another go, parents first and in clock order. it returns how many still wait
+func (lf localFuncs) RetryParked() (int, error) {
+	parked, err := lf.repo.GetParkedOperations()
+	if err != nil {
+		return 0, err
+	}
+
+	ops := make([]types.OperationSync, 0, len(parked))
+	for _, p := range parked {
+		var op types.OperationSync
+		if err := json.Unmarshal([]byte(p.Operation), &op); err != nil {
+			return 0, fmt.Errorf("invalid parked operation %s: %v", p.ID, err)
+		}
+		ops = append(ops, op)
+	}
+	sortByDependency(ops)
+
+	waiting := 0
+	for _, op := range ops {
+		// each op gets its own transaction, one that still fails mustn't roll back the ones before it
+		applyErr := lf.repo.InTx(func(tx repo.Repository) error {
+			if err := lf.scoped(tx).UpdateLocalDB(op); err != nil {
+				return err
+			}
+			return tx.DeleteParkedOperation(op.ID)
+		})
+		if applyErr == nil {
+			continue
+		}
+
+		waiting++
+		if err := lf.repo.ParkOperation(op, applyErr.Error()); err != nil {
+			return waiting, err
+		}
+	}
+
+	return waiting, nil
+}
+
+// applyOrPark applies op, parking it instead when its parent is missing
+func (lf localFuncs) applyOrPark(op types.OperationSync) error {
+	err := lf.UpdateLocalDB(op)
+	if errors.Is(err, ErrMissingParent) || errors.Is(err, ErrSealed) {
+		fmt.Printf("parking operation %s: %v\n", op.ID, err)
+		return lf.repo.ParkOperation(op, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	if op.OperationType == types.DeleteOperation.String() {
+		tableName, err := types.TableNameFromString(op.TableName)
+		if err != nil {
+			return err
+		}
+		return lf.repo.DeleteParkedOperations(tableName, op.RecordID)
+	}
+
+	return nil
+}
+
+// sortByDependency orders ops parents first (the table constants are declared in that order), then by clock
+func sortByDependency(ops []types.OperationSync) {
+	rank := func(op types.OperationSync) types.TableName {
+		tableName, _ := types.TableNameFromString(op.TableName)
+		return tableName
+	}
+
+	sort.SliceStable(ops, func(i, j int) bool {
+		if rank(ops[i]) != rank(ops[j]) {
+			return rank(ops[i]) < rank(ops[j])
+		}
+		return ops[i].HLC < ops[j].HLC
+	})
+}
+
+// requireParent fails with ErrMissingParent when the board or column a record belongs to isn't here yet
+func (lf localFuncs) requireParent(parent types.TableName, id string) error {
+	if id == "" {
+		return nil
+	}
+
+	var err error
+	switch parent {
+	case types.BoardTable:
+		_, err = lf.repo.GetBoardWithTrashed(id)
+	case types.ColumnTable:
+		_, err = lf.repo.GetColumnWithTrashed(id)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s %s", ErrMissingParent, parent, id)
+	}
+
+	return nil
+}
+
 func (lf localFuncs) UpdateSyncState(state query.SyncState) error {
 	tableName, err := types.TableNameFromString(state.TableName)
 	if err != nil {
@@ -82,24 +240,33 @@ func (lf localFuncs) UpsertSyncState(state query.SyncState) error {
 }
 
 func (lf localFuncs) updateBoardFromOperation(op types.OperationSync) error {
-	var payload struct {
-		ID        string `json:"id"`
-		Name      string `json:"name"`
-		CreatedAt string `json:"created_at"`
-		UpdatedAt string `json:"updated_at"`
-	}
-
-	if err := json.Unmarshal([]byte(op.PayloadData), &payload); err != nil {
-		return fmt.Errorf("failed to unmarshal board payload: %v", err)
-	}
-
 	switch op.OperationType {
 	case "insert", "update":
+		var current merge.Fields
+		existing, err := lf.repo.GetBoardWithTrashed(op.RecordID)
+		if err == nil {
+			current = merge.FromBoard(existing)
+		}
 
-		_, err := lf.repo.ImportBoard(payload.ID, payload.Name, payload.CreatedAt, payload.UpdatedAt)
-		return err
-	case "delete":
-		return lf.repo.DeleteBoard(payload.ID)
+		merged, applied, err := lf.mergeOperation(types.BoardTable, current, op)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return nil
+		}
+
+		createdAt, updatedAt := operationTimestamps(op)
+		if current != nil && existing.CreatedAt.Valid {
+			createdAt = existing.CreatedAt.String
+		}
+
+		if _, err := lf.repo.ImportBoard(op.RecordID, merged.String("name"), createdAt, updatedAt); err != nil {
+			return err
+		}
+		return lf.recordFieldClocks(types.BoardTable, op, merged, applied)
+	case "delete", "restore":
+		return lf.applyTombstone(types.BoardTable, op)
 	default:
 		return fmt.Errorf("unsupported operation type: %s", op.OperationType)
 	}
@@ -107,83 +274,245 @@ func (lf localFuncs) updateBoardFromOperation(op types.OperationSync) error {
 
 func (lf localFuncs) updateColumnFromOperation(op types.OperationSync) error {
 	fmt.Println("performing column operation")
-	var payload struct {
-		ID        string `json:"id"`
-		BoardID   string `json:"board_id"`
-		Name      string `json:"name"`
-		Position  int64  `json:"position"`
-		CreatedAt string `json:"created_at"`
-		UpdatedAt string `json:"updated_at"`
-	}
-
-	if err := json.Unmarshal([]byte(op.PayloadData), &payload); err != nil {
-		return fmt.Errorf("failed to unmarshal column payload: %v", err)
-	}
 
 	switch op.OperationType {
 	case "insert", "update":
-		fmt.Println("ookay it's creating the column")
-		_, err := lf.repo.ImportColumn(payload.ID, payload.BoardID, payload.Name, payload.Position, payload.CreatedAt, payload.UpdatedAt)
-		return err
-	case "delete":
-		return lf.repo.DeleteColumn(payload.ID)
+		var current merge.Fields
+		existing, err := lf.repo.GetColumnWithTrashed(op.RecordID)
+		if err == nil {
+			current = merge.FromColumn(existing)
+		}
+
+		merged, applied, err := lf.mergeOperation(types.ColumnTable, current, op)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return nil
+		}
+
+		createdAt, updatedAt := operationTimestamps(op)
+		if current != nil && existing.CreatedAt.Valid {
+			createdAt = existing.CreatedAt.String
+		}
+
+		if err := lf.requireParent(types.BoardTable, merged.String("board_id")); err != nil {
+			return err
+		}
+
+		_, err = lf.repo.ImportColumn(op.RecordID, merged.String("board_id"), merged.String("name"), merged.Int("position"), createdAt, updatedAt)
+		if err != nil {
+			return err
+		}
+		return lf.recordFieldClocks(types.ColumnTable, op, merged, applied)
+	case "delete", "restore":
+		return lf.applyTombstone(types.ColumnTable, op)
 	default:
 		return fmt.Errorf("unsupported operation type: %s", op.OperationType)
 	}
 }
 
 func (lf localFuncs) updateCardFromOperation(op types.OperationSync) error {
-	var payload struct {
-		ID          string `json:"id"`
-		ColumnID    string `json:"column_id"`
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		Attachments string `json:"attachments"`
-		CreatedAt   string `json:"created_at"`
-		UpdatedAt   string `json:"updated_at"`
-	}
-
-	if err := json.Unmarshal([]byte(op.PayloadData), &payload); err != nil {
-		return fmt.Errorf("failed to unmarshal card payload: %v", err)
-	}
-
 	fmt.Println("updatin card table")
 
 	switch op.OperationType {
-	case "insert", "update":
-		_, err := lf.repo.ImportCard(payload.ID, payload.ColumnID, payload.Title, payload.Description, payload.Attachments, payload.CreatedAt, payload.UpdatedAt)
-		return err
-	case "delete":
-		return lf.repo.DeleteCard(payload.ID)
-	case "update-card-column":
-		_, err := lf.repo.UpdateCardColumn(payload.ID, payload.ColumnID)
-		return err
+	case "insert", "update", "update-card-column":
+		var current merge.Fields
+		existing, err := lf.repo.GetCardWithTrashed(op.RecordID)
+		if err == nil {
+			current = merge.FromCard(existing)
+		}
+
+		if current == nil && op.OperationType == "update-card-column" {
+			return fmt.Errorf("unable to move card (%s), it doesn't exist locally", op.RecordID)
+		}
+
+		merged, applied, err := lf.mergeOperation(types.CardTable, current, op)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return nil
+		}
+
+		createdAt, updatedAt := operationTimestamps(op)
+		if current != nil && existing.CreatedAt.Valid {
+			createdAt = existing.CreatedAt.String
+		}
+
+		if err := lf.requireParent(types.ColumnTable, merged.String("column_id")); err != nil {
+			return err
+		}
+
+		_, err = lf.repo.ImportCard(op.RecordID, merged.String("column_id"), merged.String("title"), merged.String("description"), merged.String("attachments"), createdAt, updatedAt)
+		if err != nil {
+			return err
+		}
+		return lf.recordFieldClocks(types.CardTable, op, merged, applied)
+	case "delete", "restore":
+		return lf.applyTombstone(types.CardTable, op)
 	default:
 		return fmt.Errorf("unsupported operation type: %s", op.OperationType)
 	}
 }
 
 func (lf localFuncs) updateTranscriptionFromOperation(op types.OperationSync) error {
-	var payload struct {
-		ID                string `json:"id"`
-		BoardID           string `json:"board_id"`
-		Transcription     string `json:"transcription"`
-		RecordingPath     string `json:"recording_path"`
-		Intent            string `json:"intent"`
-		AssistantResponse string `json:"assistant_response"`
-		CreatedAt         string `json:"created_at"`
-		UpdatedAt         string `json:"updated_at"`
+	switch op.OperationType {
+	case "insert", "update":
+		var current merge.Fields
+		existing, err := lf.repo.GetTranscriptionByID(op.RecordID)
+		if err == nil {
+			current = merge.FromTranscription(existing)
+		}
+
+		merged, applied, err := lf.mergeOperation(types.TranscriptionTable, current, op)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return nil
+		}
+
+		createdAt, updatedAt := operationTimestamps(op)
+		if current != nil && existing.CreatedAt.Valid {
+			createdAt = existing.CreatedAt.String
+		}
+
+		if err := lf.requireParent(types.BoardTable, merged.String("board_id")); err != nil {
+			return err
+		}
+
+		_, err = lf.repo.ImportTranscription(
+			op.RecordID,
+			merged.String("board_id"),
+			merged.String("transcription"),
+			merged.String("recording_path"),
+			merged.String("intent"),
+			merged.String("assistant_response"),
+			createdAt,
+			updatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		return lf.recordFieldClocks(types.TranscriptionTable, op, merged, applied)
+	case "delete", "restore":
+		return lf.applyTombstone(types.TranscriptionTable, op)
+	default:
+		return fmt.Errorf("unsupported operation type: %s for transcriptions", op.OperationType)
 	}
+}
 
-	if err := json.Unmarshal([]byte(op.PayloadData), &payload); err != nil {
-		return fmt.Errorf("failed to unmarshal transcription payload: %v", err)
+// applyTombstone moves a record into the trash or back out. a delete or restore older than the last one applied here is
+// dropped, edits made while in the trash still merge
+func (lf localFuncs) applyTombstone(table types.TableName, op types.OperationSync) error {
+	clocks, err := lf.repo.GetFieldClocks(table, op.RecordID)
+	if err != nil {
+		return err
+	}
+	for _, clock := range clocks {
+		if clock.Field == merge.TombstoneField && !merge.Newer(op.HLC, clock.Hlc) {
+			return nil
+		}
 	}
 
-	switch op.OperationType {
-	case "insert", "update":
-		_, err := lf.repo.ImportTranscription(payload.ID, payload.BoardID, payload.Transcription, payload.RecordingPath, payload.Intent, payload.AssistantResponse, payload.CreatedAt, payload.UpdatedAt)
+	del, restore := lf.tombstoneFuncs(table)
+	if del == nil {
+		return fmt.Errorf("unsupported table: %s", table)
+	}
+
+	apply := del
+	if op.OperationType == types.RestoreOperation.String() {
+		apply = restore
+	}
+	if err := apply(op.RecordID); err != nil {
 		return err
+	}
+
+	if op.HLC == "" {
+		return nil
+	}
+	return lf.repo.UpsertFieldClock(table, op.RecordID, merge.TombstoneField, op.HLC, op.OperationType)
+}
+
+func (lf localFuncs) tombstoneFuncs(table types.TableName) (del, restore func(id string) error) {
+	switch table {
+	case types.BoardTable:
+		return lf.repo.DeleteBoard, lf.repo.RestoreBoard
+	case types.ColumnTable:
+		return lf.repo.DeleteColumn, lf.repo.RestoreColumn
+	case types.CardTable:
+		return lf.repo.DeleteCard, lf.repo.RestoreCard
+	case types.TranscriptionTable:
+		return lf.repo.DeleteTranscription, lf.repo.RestoreTranscription
 	default:
-		return fmt.Errorf("unsupported operation type: %s for transcriptions", op.OperationType)
+		return nil, nil
+	}
+}
+
+// mergeOperation applies the fields of op that are newer than what last wrote them locally on top of current.
+// current is nil when the record doesn't exist here yet, in that case everything the op carries is taken.
+func (lf localFuncs) mergeOperation(table types.TableName, current merge.Fields, op types.OperationSync) (merge.Fields, []string, error) {
+	incoming, err := merge.Extract(table, op.PayloadData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if current == nil {
+		merged, applied := merge.Apply(table, merge.Fields{}, incoming, nil, op.HLC, nil)
+		return merged, applied, nil
+	}
+
+	clocks, err := lf.repo.GetFieldClocks(table, op.RecordID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	known := make(map[string]string, len(clocks))
+	for _, clock := range clocks {
+		known[clock.Field] = clock.Hlc
+	}
+
+	merged, applied := merge.Apply(table, current, incoming, op.Fields, op.HLC, known)
+	return merged, applied, nil
+}
+
+func (lf localFuncs) recordFieldClocks(table types.TableName, op types.OperationSync, merged merge.Fields, applied []string) error {
+	if op.HLC == "" {
+		return nil
+	}
+
+	for _, name := range applied {
+		if err := lf.repo.UpsertFieldClock(table, op.RecordID, name, op.HLC, merge.Encode(merged[name])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func operationTimestamps(op types.OperationSync) (string, string) {
+	var payload struct {
+		CreatedAt string `json:"created_at"`
+		UpdatedAt string `json:"updated_at"`
+		Card      struct {
+			CreatedAt string `json:"created_at"`
+			UpdatedAt string `json:"updated_at"`
+		} `json:"card"`
+	}
+
+	_ = json.Unmarshal([]byte(op.PayloadData), &payload)
+
+	createdAt := firstNonEmpty(payload.CreatedAt, payload.Card.CreatedAt, op.CreatedAt)
+	updatedAt := firstNonEmpty(payload.UpdatedAt, payload.Card.UpdatedAt, op.UpdatedAt, createdAt)
+	return createdAt, updatedAt
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
 	}
+	return ""
 }
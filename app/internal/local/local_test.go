@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"seisami/app/internal/e2e"
+	"seisami/app/internal/hlc"
 	"seisami/app/internal/repo"
 	"seisami/app/types"
 	"testing"
@@ -411,6 +413,128 @@ func TestLocal(t *testing.T) {
 		}
 	})
 
+	t.Run("update_local_db_card_concurrent_field_edits", func(t *testing.T) {
+		repo := setupTestDB(t)
+		lf := NewLocalFuncs(repo)
+
+		board, err := repo.CreateBoard("Test Board")
+		if err != nil {
+			t.Fatalf("CreateBoard failed: %v", err)
+		}
+
+		column, err := repo.CreateColumn(board.ID, "To Do")
+		if err != nil {
+			t.Fatalf("CreateColumn failed: %v", err)
+		}
+
+		card, err := repo.CreateCard(column.ID, "Original", "Original description")
+		if err != nil {
+			t.Fatalf("CreateCard failed: %v", err)
+		}
+
+		cardEvent := func(title, description string) string {
+			var event types.CardEvent
+			event.Column.ID = column.ID
+			event.Card.ID = card.ID
+			event.Card.Name = title
+			event.Card.Description = description
+			b, err := json.Marshal(event)
+			if err != nil {
+				t.Fatalf("failed to marshal card event: %v", err)
+			}
+			return string(b)
+		}
+
+		insertOp, err := repo.CreateOperation(types.CardTable, card.ID, cardEvent("Original", "Original description"), types.InsertOperation)
+		if err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+
+		// a teammate edited the description after seeing our insert, concurrently with our title edit
+		remote, err := hlc.Parse(insertOp.Hlc)
+		if err != nil {
+			t.Fatalf("failed to parse hlc: %v", err)
+		}
+		remote.Counter++
+		remote.DeviceID = "device-b"
+		remoteHLC := remote.String()
+
+		if _, err := repo.UpdateCard(card.ID, "Renamed locally", "Original description"); err != nil {
+			t.Fatalf("UpdateCard failed: %v", err)
+		}
+		localOp, err := repo.CreateOperation(types.CardTable, card.ID, cardEvent("Renamed locally", "Original description"), types.UpdateOperation)
+		if err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+
+		if localOp.Fields != `["title"]` {
+			t.Fatalf("expected local op to only change title, got '%s'", localOp.Fields)
+		}
+
+		err = lf.UpdateLocalDB(types.OperationSync{
+			ID:            "remote-op",
+			TableName:     "cards",
+			RecordID:      card.ID,
+			OperationType: "update",
+			PayloadData:   cardEvent("Original", "Edited remotely"),
+			HLC:           remoteHLC,
+			Fields:        []string{"description"},
+		})
+		if err != nil {
+			t.Fatalf("UpdateLocalDB failed: %v", err)
+		}
+
+		merged, err := repo.GetCard(card.ID)
+		if err != nil {
+			t.Fatalf("GetCard failed: %v", err)
+		}
+
+		if merged.Title != "Renamed locally" {
+			t.Errorf("expected local title to survive, got '%s'", merged.Title)
+		}
+		if merged.Description.String != "Edited remotely" {
+			t.Errorf("expected remote description to survive, got '%s'", merged.Description.String)
+		}
+	})
+
+	t.Run("update_local_db_stale_field_is_ignored", func(t *testing.T) {
+		repo := setupTestDB(t)
+		lf := NewLocalFuncs(repo)
+
+		board, err := repo.CreateBoard("Local Name")
+		if err != nil {
+			t.Fatalf("CreateBoard failed: %v", err)
+		}
+
+		payload, _ := json.Marshal(map[string]string{"id": board.ID, "name": "Local Name"})
+		if _, err := repo.CreateOperation(types.BoardTable, board.ID, string(payload), types.UpdateOperation); err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+
+		stalePayload, _ := json.Marshal(map[string]string{"id": board.ID, "name": "Stale Name"})
+		err = lf.UpdateLocalDB(types.OperationSync{
+			ID:            "stale-op",
+			TableName:     "boards",
+			RecordID:      board.ID,
+			OperationType: "update",
+			PayloadData:   string(stalePayload),
+			HLC:           "000000000000001:0000000000:device-b",
+			Fields:        []string{"name"},
+		})
+		if err != nil {
+			t.Fatalf("UpdateLocalDB failed: %v", err)
+		}
+
+		got, err := repo.GetBoard(board.ID)
+		if err != nil {
+			t.Fatalf("GetBoard failed: %v", err)
+		}
+
+		if got.Name != "Local Name" {
+			t.Errorf("expected newer local name to win, got '%s'", got.Name)
+		}
+	})
+
 	t.Run("update_local_db_invalid_table", func(t *testing.T) {
 		repo := setupTestDB(t)
 		lf := NewLocalFuncs(repo)
@@ -445,4 +569,249 @@ func TestLocal(t *testing.T) {
 		}
 	})
 
+	t.Run("apply_batch_failing_half_way_applies_nothing", func(t *testing.T) {
+		repo := setupTestDB(t)
+		lf := NewLocalFuncs(repo)
+
+		if err := repo.SetPullCursor(types.BoardTable, "page-1"); err != nil {
+			t.Fatalf("SetPullCursor failed: %v", err)
+		}
+
+		ops := []types.OperationSync{
+			{ID: "op-1", TableName: "boards", RecordID: "board-1", OperationType: "insert", PayloadData: `{"id":"board-1","name":"First"}`},
+			{ID: "op-2", TableName: "boards", RecordID: "board-2", OperationType: "insert", PayloadData: "invalid json"},
+			{ID: "op-3", TableName: "boards", RecordID: "board-3", OperationType: "insert", PayloadData: `{"id":"board-3","name":"Third"}`},
+		}
+
+		if err := lf.ApplyBatch(types.BoardTable, ops, "page-2"); err == nil {
+			t.Fatalf("expected the second op to fail the batch")
+		}
+
+		for _, id := range []string{"board-1", "board-3"} {
+			if _, err := repo.GetBoard(id); err == nil {
+				t.Errorf("expected %s to be rolled back", id)
+			}
+		}
+
+		cursor, err := repo.GetPullCursor(types.BoardTable)
+		if err != nil {
+			t.Fatalf("GetPullCursor failed: %v", err)
+		}
+		if cursor != "page-1" {
+			t.Errorf("expected the cursor to stay at page-1, got %q", cursor)
+		}
+
+		// the same page pulled again once the bad op is fixed goes through whole
+		ops[1].PayloadData = `{"id":"board-2","name":"Second"}`
+		if err := lf.ApplyBatch(types.BoardTable, ops, "page-2"); err != nil {
+			t.Fatalf("ApplyBatch failed: %v", err)
+		}
+
+		for _, id := range []string{"board-1", "board-2", "board-3"} {
+			if _, err := repo.GetBoard(id); err != nil {
+				t.Errorf("expected %s to be applied: %v", id, err)
+			}
+		}
+		if cursor, _ := repo.GetPullCursor(types.BoardTable); cursor != "page-2" {
+			t.Errorf("expected the cursor to move to page-2, got %q", cursor)
+		}
+	})
+
+	t.Run("op_with_missing_parent_is_parked_until_it_arrives", func(t *testing.T) {
+		repo := setupTestDB(t)
+		lf := NewLocalFuncs(repo)
+
+		card := types.OperationSync{
+			ID:            "op-card",
+			TableName:     "cards",
+			RecordID:      "card-1",
+			OperationType: "insert",
+			PayloadData:   `{"id":"card-1","column_id":"column-1","title":"Early card"}`,
+		}
+		column := types.OperationSync{
+			ID:            "op-column",
+			TableName:     "columns",
+			RecordID:      "column-1",
+			OperationType: "insert",
+			PayloadData:   `{"id":"column-1","board_id":"board-1","name":"To Do"}`,
+		}
+
+		// the card's column isn't here yet, the page still goes through
+		if err := lf.ApplyBatch(types.CardTable, []types.OperationSync{card}, ""); err != nil {
+			t.Fatalf("ApplyBatch failed: %v", err)
+		}
+		if _, err := repo.GetCard("card-1"); err == nil {
+			t.Fatalf("expected the card to wait for its column")
+		}
+
+		// neither has its parent, both stay parked
+		if err := lf.ApplyBatch(types.ColumnTable, []types.OperationSync{column}, ""); err != nil {
+			t.Fatalf("ApplyBatch failed: %v", err)
+		}
+		waiting, err := lf.RetryParked()
+		if err != nil {
+			t.Fatalf("RetryParked failed: %v", err)
+		}
+		if waiting != 2 {
+			t.Fatalf("expected 2 parked ops, got %d", waiting)
+		}
+
+		board := types.OperationSync{
+			ID:            "op-board",
+			TableName:     "boards",
+			RecordID:      "board-1",
+			OperationType: "insert",
+			PayloadData:   `{"id":"board-1","name":"Board"}`,
+		}
+		if err := lf.ApplyBatch(types.BoardTable, []types.OperationSync{board}, ""); err != nil {
+			t.Fatalf("ApplyBatch failed: %v", err)
+		}
+
+		// the column goes in before the card that waits on it
+		waiting, err = lf.RetryParked()
+		if err != nil {
+			t.Fatalf("RetryParked failed: %v", err)
+		}
+		if waiting != 0 {
+			t.Errorf("expected nothing left parked, got %d", waiting)
+		}
+
+		got, err := repo.GetCard("card-1")
+		if err != nil {
+			t.Fatalf("expected the parked card to be applied: %v", err)
+		}
+		if got.ColumnID != "column-1" {
+			t.Errorf("expected card in column-1, got '%s'", got.ColumnID)
+		}
+
+		parked, err := repo.GetParkedOperations()
+		if err != nil {
+			t.Fatalf("GetParkedOperations failed: %v", err)
+		}
+		if len(parked) != 0 {
+			t.Errorf("expected the queue to be empty, got %d", len(parked))
+		}
+	})
+
+	t.Run("sealed_op_is_parked_until_the_board_key_arrives", func(t *testing.T) {
+		repo := setupTestDB(t)
+
+		sender, receiver := e2e.NewKeyring(), e2e.NewKeyring()
+		if _, err := sender.Generate("sender"); err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		receiverKeys, err := receiver.Generate("receiver")
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+
+		if err := sender.NewBoardKey("board-1"); err != nil {
+			t.Fatalf("NewBoardKey failed: %v", err)
+		}
+		payload, err := sender.SealPayload("board-1", `{"id":"board-1","name":"Secret board"}`)
+		if err != nil {
+			t.Fatalf("SealPayload failed: %v", err)
+		}
+
+		lf := NewLocalFuncs(repo).WithKeyring(receiver)
+		op := types.OperationSync{
+			ID:            "op-board",
+			TableName:     "boards",
+			RecordID:      "board-1",
+			OperationType: "insert",
+			PayloadData:   payload,
+		}
+		if err := lf.ApplyBatch(types.BoardTable, []types.OperationSync{op}, ""); err != nil {
+			t.Fatalf("ApplyBatch failed: %v", err)
+		}
+		if _, err := repo.GetBoard("board-1"); err == nil {
+			t.Fatal("expected the sealed board to be parked")
+		}
+
+		wrapped, err := sender.WrapBoardKey("board-1", receiverKeys.PublicKey)
+		if err != nil {
+			t.Fatalf("WrapBoardKey failed: %v", err)
+		}
+		if err := receiver.UnwrapBoardKey("board-1", wrapped); err != nil {
+			t.Fatalf("UnwrapBoardKey failed: %v", err)
+		}
+
+		waiting, err := lf.RetryParked()
+		if err != nil {
+			t.Fatalf("RetryParked failed: %v", err)
+		}
+		if waiting != 0 {
+			t.Fatalf("expected nothing left parked, got %d", waiting)
+		}
+
+		board, err := repo.GetBoard("board-1")
+		if err != nil {
+			t.Fatalf("expected the board to be applied: %v", err)
+		}
+		if board.Name != "Secret board" {
+			t.Errorf("expected decrypted name 'Secret board', got '%s'", board.Name)
+		}
+	})
+
+	t.Run("stale_delete_does_not_undo_a_newer_restore", func(t *testing.T) {
+		repo := setupTestDB(t)
+		lf := NewLocalFuncs(repo)
+
+		board, err := repo.CreateBoard("Board")
+		if err != nil {
+			t.Fatalf("failed to create board: %v", err)
+		}
+
+		clock := func(wall int64, device string) string {
+			return hlc.Timestamp{WallTime: wall, DeviceID: device}.String()
+		}
+
+		ops := []types.OperationSync{
+			{ID: "op-delete", TableName: "boards", RecordID: board.ID, OperationType: "delete", HLC: clock(1000, "device-a")},
+			{ID: "op-restore", TableName: "boards", RecordID: board.ID, OperationType: "restore", HLC: clock(2000, "device-b")},
+		}
+		for _, op := range ops {
+			if err := lf.UpdateLocalDB(op); err != nil {
+				t.Fatalf("UpdateLocalDB failed: %v", err)
+			}
+		}
+
+		// another device deleted the board before the restore but only syncs now
+		stale := types.OperationSync{ID: "op-stale", TableName: "boards", RecordID: board.ID, OperationType: "delete", HLC: clock(1500, "device-c")}
+		if err := lf.UpdateLocalDB(stale); err != nil {
+			t.Fatalf("UpdateLocalDB failed: %v", err)
+		}
+
+		got, err := repo.GetBoard(board.ID)
+		if err != nil {
+			t.Fatalf("failed to get board: %v", err)
+		}
+		if got.DeletedAt.Valid {
+			t.Errorf("expected the board to stay restored")
+		}
+
+		// edits made while it's in the trash still land
+		newer := types.OperationSync{ID: "op-delete-2", TableName: "boards", RecordID: board.ID, OperationType: "delete", HLC: clock(3000, "device-a")}
+		update := types.OperationSync{
+			ID:            "op-update",
+			TableName:     "boards",
+			RecordID:      board.ID,
+			OperationType: "update",
+			PayloadData:   `{"name":"Renamed"}`,
+			HLC:           clock(4000, "device-b"),
+		}
+		for _, op := range []types.OperationSync{newer, update} {
+			if err := lf.UpdateLocalDB(op); err != nil {
+				t.Fatalf("UpdateLocalDB failed: %v", err)
+			}
+		}
+
+		got, err = repo.GetBoardWithTrashed(board.ID)
+		if err != nil {
+			t.Fatalf("failed to get board: %v", err)
+		}
+		if !got.DeletedAt.Valid || got.Name != "Renamed" {
+			t.Errorf("expected a renamed board still in the trash, got %q (deleted: %v)", got.Name, got.DeletedAt.Valid)
+		}
+	})
 }
@@ -0,0 +1,256 @@
+package merge
+
+import (
+	"encoding/json"
+	"fmt"
+	"seisami/app/internal/repo/sqlc/query"
+	"seisami/app/types"
+)
+
+// every field of a record keeps the hlc of the last op that wrote it, so concurrent edits merge field by field and a
+// title edit here and a description edit there both survive. Extract turns any event shape into column names
+
+type Fields map[string]any
+
+var tableFields = map[types.TableName][]string{
+	types.BoardTable:         {"name"},
+	types.ColumnTable:        {"board_id", "name", "position"},
+	types.CardTable:          {"column_id", "title", "description", "attachments"},
+	types.TranscriptionTable: {"board_id", "transcription", "recording_path", "intent", "assistant_response"},
+}
+
+// TombstoneField is the pseudo field whose clock orders the deletes and restores of a record, payloads never carry it
+const TombstoneField = "deleted_at"
+
+// TableFields are the mergeable columns of a table, ids and timestamps are never merged
+func TableFields(table types.TableName) []string {
+	return tableFields[table]
+}
+
+func (f Fields) String(name string) string {
+	switch v := f[name].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (f Fields) Int(name string) int64 {
+	switch v := f[name].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// Encode is what gets stored next to a field clock, it's compared to spot which fields an op actually changed
+func Encode(value any) string {
+	switch v := value.(type) {
+	case int64:
+		value = float64(v)
+	case int:
+		value = float64(v)
+	}
+
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+func Extract(table types.TableName, payload string) (Fields, error) {
+	switch table {
+	case types.BoardTable:
+		return extractFlat(payload, TableFields(table))
+	case types.ColumnTable:
+		return extractFlat(payload, TableFields(table))
+	case types.CardTable:
+		return extractCard(payload)
+	case types.TranscriptionTable:
+		return extractFlat(payload, TableFields(table))
+	default:
+		return nil, fmt.Errorf("unsupported table: %s", table)
+	}
+}
+
+func extractFlat(payload string, names []string) (Fields, error) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(payload), &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %v", err)
+	}
+
+	fields := make(Fields)
+	for _, name := range names {
+		if v, ok := raw[name]; ok {
+			fields[name] = v
+		}
+	}
+
+	return fields, nil
+}
+
+func extractCard(payload string) (Fields, error) {
+	var p struct {
+		// local import payload
+		ColumnID    *string `json:"column_id"`
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Attachments *string `json:"attachments"`
+
+		// card:create / card:data event
+		Column *struct {
+			ID string `json:"id"`
+		} `json:"column"`
+		Card *struct {
+			Name        *string `json:"name"`
+			Description *string `json:"description"`
+			ColumnID    *string `json:"column_id"`
+		} `json:"card"`
+
+		// card:column event
+		NewColumn *struct {
+			ID string `json:"id"`
+		} `json:"new_column"`
+	}
+
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal card payload: %v", err)
+	}
+
+	fields := make(Fields)
+	set := func(name string, v *string) {
+		if v != nil {
+			fields[name] = *v
+		}
+	}
+
+	set("column_id", p.ColumnID)
+	set("title", p.Title)
+	set("description", p.Description)
+	set("attachments", p.Attachments)
+
+	if p.Card != nil {
+		set("title", p.Card.Name)
+		set("description", p.Card.Description)
+		set("column_id", p.Card.ColumnID)
+	}
+	if p.Column != nil && p.Column.ID != "" {
+		fields["column_id"] = p.Column.ID
+	}
+	if p.NewColumn != nil && p.NewColumn.ID != "" {
+		fields["column_id"] = p.NewColumn.ID
+	}
+
+	return fields, nil
+}
+
+// Changed returns the fields of next whose value differs from what we last knew, in table column order
+func Changed(table types.TableName, known map[string]string, next Fields) []string {
+	changed := make([]string, 0)
+	for _, name := range TableFields(table) {
+		v, ok := next[name]
+		if !ok {
+			continue
+		}
+		if prev, seen := known[name]; !seen || prev != Encode(v) {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
+
+// Union combines the encoded fields column of several ops on one record, any op that touched the whole record wins
+func Union(table types.TableName, encoded []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, e := range encoded {
+		if e == "" {
+			return nil, nil
+		}
+
+		var names []string
+		if err := json.Unmarshal([]byte(e), &names); err != nil {
+			return nil, fmt.Errorf("invalid operation fields %q: %v", e, err)
+		}
+		for _, name := range names {
+			seen[name] = true
+		}
+	}
+
+	union := make([]string, 0, len(seen))
+	for _, name := range TableFields(table) {
+		if seen[name] {
+			union = append(union, name)
+		}
+	}
+
+	return union, nil
+}
+
+// Apply merges incoming into current, a field the op touched is taken when its clock is newer than the field's. ops
+// without an hlc fall back to last writer wins, nil names means the op touched every field
+func Apply(table types.TableName, current, incoming Fields, names []string, opHLC string, clocks map[string]string) (Fields, []string) {
+	if names == nil {
+		names = TableFields(table)
+	}
+
+	merged := make(Fields, len(current))
+	for k, v := range current {
+		merged[k] = v
+	}
+
+	applied := make([]string, 0, len(names))
+	for _, name := range names {
+		v, ok := incoming[name]
+		if !ok {
+			continue
+		}
+
+		if !Newer(opHLC, clocks[name]) {
+			continue
+		}
+
+		merged[name] = v
+		applied = append(applied, name)
+	}
+
+	return merged, applied
+}
+
+// Newer reports whether an op at opHLC beats the clock that last wrote a field, ops without an hlc always do
+func Newer(opHLC, clock string) bool {
+	return opHLC == "" || clock < opHLC
+}
+
+func FromBoard(b query.Board) Fields {
+	return Fields{"name": b.Name}
+}
+
+func FromColumn(c query.Column) Fields {
+	return Fields{"board_id": c.BoardID, "name": c.Name, "position": c.Position}
+}
+
+func FromCard(c query.Card) Fields {
+	return Fields{
+		"column_id":   c.ColumnID,
+		"title":       c.Title,
+		"description": c.Description.String,
+		"attachments": c.Attachments.String,
+	}
+}
+
+func FromTranscription(t query.Transcription) Fields {
+	return Fields{
+		"board_id":           t.BoardID,
+		"transcription":      t.Transcription,
+		"recording_path":     t.RecordingPath.String,
+		"intent":             t.Intent.String,
+		"assistant_response": t.AssistantResponse.String,
+	}
+}
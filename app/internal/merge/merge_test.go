@@ -0,0 +1,95 @@
+package merge
+
+import (
+	"reflect"
+	"seisami/app/types"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	t.Run("card_event_payload", func(t *testing.T) {
+		payload := `{"column":{"id":"col-1"},"Card":{"id":"card-1","name":"Title","description":"Desc"}}`
+
+		fields, err := Extract(types.CardTable, payload)
+		if err != nil {
+			t.Fatalf("Extract failed: %v", err)
+		}
+
+		if fields.String("title") != "Title" || fields.String("description") != "Desc" || fields.String("column_id") != "col-1" {
+			t.Errorf("unexpected fields: %+v", fields)
+		}
+	})
+
+	t.Run("card_column_payload", func(t *testing.T) {
+		payload := `{"card_id":"card-1","old_column":{"id":"col-1"},"new_column":{"id":"col-2"}}`
+
+		fields, err := Extract(types.CardTable, payload)
+		if err != nil {
+			t.Fatalf("Extract failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(fields, Fields{"column_id": "col-2"}) {
+			t.Errorf("expected only column_id, got %+v", fields)
+		}
+	})
+
+	t.Run("column_payload", func(t *testing.T) {
+		fields, err := Extract(types.ColumnTable, `{"id":"col-1","board_id":"b-1","name":"Done","position":3,"room_id":"r"}`)
+		if err != nil {
+			t.Fatalf("Extract failed: %v", err)
+		}
+
+		if fields.Int("position") != 3 || fields.String("name") != "Done" {
+			t.Errorf("unexpected fields: %+v", fields)
+		}
+		if _, ok := fields["room_id"]; ok {
+			t.Errorf("expected non column keys to be dropped")
+		}
+	})
+}
+
+func TestApply(t *testing.T) {
+	current := Fields{"column_id": "col-1", "title": "Local title", "description": "Old"}
+	incoming := Fields{"column_id": "col-1", "title": "Old title", "description": "Remote"}
+	clocks := map[string]string{
+		"title":       "000000000000020:0000000000:a",
+		"description": "000000000000005:0000000000:a",
+	}
+
+	t.Run("only_touched_and_newer_fields_apply", func(t *testing.T) {
+		merged, applied := Apply(types.CardTable, current, incoming, []string{"title", "description"}, "000000000000010:0000000000:b", clocks)
+
+		if merged.String("title") != "Local title" {
+			t.Errorf("expected newer local title to stay, got %s", merged.String("title"))
+		}
+		if merged.String("description") != "Remote" {
+			t.Errorf("expected remote description, got %s", merged.String("description"))
+		}
+		if !reflect.DeepEqual(applied, []string{"description"}) {
+			t.Errorf("unexpected applied fields: %v", applied)
+		}
+	})
+
+	t.Run("ops_without_clock_overwrite", func(t *testing.T) {
+		merged, _ := Apply(types.CardTable, current, incoming, nil, "", clocks)
+
+		if merged.String("title") != "Old title" {
+			t.Errorf("expected legacy op to overwrite title, got %s", merged.String("title"))
+		}
+	})
+
+	t.Run("union_of_pending_fields", func(t *testing.T) {
+		union, err := Union(types.CardTable, []string{`["description"]`, `["title"]`, `["description"]`})
+		if err != nil {
+			t.Fatalf("Union failed: %v", err)
+		}
+		if !reflect.DeepEqual(union, []string{"title", "description"}) {
+			t.Errorf("unexpected union: %v", union)
+		}
+
+		all, err := Union(types.CardTable, []string{`["title"]`, ""})
+		if err != nil || all != nil {
+			t.Errorf("expected whole record op to win, got %v (%v)", all, err)
+		}
+	})
+}
@@ -3,25 +3,37 @@ package repo
 import (
 	"seisami/app/internal/repo/sqlc/query"
 	"seisami/app/types"
+	"time"
 )
 
 type Repository interface {
+	InTx(fn func(tx Repository) error) error
+
 	CreateBoard(name string) (query.Board, error)
 	DeleteBoard(id string) error
+	RestoreBoard(id string) error
+	// ArchiveBoard hides a board the account lost access to, no operation is recorded since nothing of it syncs anymore
+	ArchiveBoard(id string) error
+	ArchivedBoardIDs() (map[string]bool, error)
 	GetBoard(id string) (query.Board, error)
+	GetBoardWithTrashed(id string) (query.Board, error)
 	// will update this later to include query params
 	GetAllBoards(page int64, pageSize int64) ([]query.Board, error)
 	UpdateBoard(id string, name string) (query.Board, error)
 
 	CreateColumn(boardId string, columnName string) (query.Column, error)
 	DeleteColumn(id string) error
+	RestoreColumn(id string) error
 	GetColumn(id string) (query.Column, error)
+	GetColumnWithTrashed(id string) (query.Column, error)
 	ListColumnsByBoard(boardId string) ([]query.Column, error)
 	UpdateColumn(id string, name string) (query.Column, error)
 
 	CreateCard(columnId string, title string, description string) (query.Card, error)
 	DeleteCard(id string) error
+	RestoreCard(id string) error
 	GetCard(id string) (query.Card, error)
+	GetCardWithTrashed(id string) (query.Card, error)
 	ListCardsByColumn(columnId string) ([]query.Card, error)
 	UpdateCard(id string, title string, description string) (query.Card, error)
 	UpdateCardColumn(CardId string, columnId string) (query.Card, error)
@@ -29,19 +41,47 @@ type Repository interface {
 	AddTransscription(boardId string, transcription string, recordingPath string) (query.Transcription, error)
 	GetTranscriptions(boardId string, page, pageSize int64) ([]query.Transcription, error)
 	GetTranscriptionByID(transcriptionId string) (query.Transcription, error)
+	DeleteTranscription(transcriptionId string) error
+	RestoreTranscription(transcriptionId string) error
 	UpdateTranscriptionIntent(transcriptionId string, intent string) error
 	UpdateTranscriptionResponse(transcriptionId string, response string) error
 
 	GetSettings() (query.Setting, error)
 	CreateOrUpdateSettings(transcriptionMethod string, whisperBinaryPath *string, whisperModelPath *string, openaiApiKey *string) (query.Setting, error)
+	SetSyncBackend(backend, location string, accessKey, secretKey *string) (query.Setting, error)
 
 	SearchColumnsByBoardAndName(boardId, searchQuery string) ([]query.Column, error)
 
 	CreateOperation(tableName types.TableName, recordId, payload string, opType types.Operation) (query.Operation, error)
+	CreateOperationWithID(id string, tableName types.TableName, recordId, payload string, opType types.Operation) (query.Operation, error)
+	CreateFieldsOperation(tableName types.TableName, recordId, payload string, fields []string) (query.Operation, error)
+	OnOperationCreated(fn func(tableName types.TableName))
+	ObserveHLC(remote string) error
+	GetFieldClocks(tableName types.TableName, recordId string) ([]query.FieldClock, error)
+	UpsertFieldClock(tableName types.TableName, recordId, field, hlc, value string) error
 	GetAllOperations(tableName types.TableName) ([]query.Operation, error)
+	GetPendingOperationFields(tableName types.TableName) (map[string][]string, error)
+	CompactOperations(tableName types.TableName) (int64, error)
 	UpsertSyncState(tableName types.TableName, lastOpID string, lastSyncedAt int64) error
 	GetSyncState(tableName types.TableName) (query.SyncState, error)
 	UpdateSyncState(tableName types.TableName, lastOpID string, lastSyncedAt int64) error
+	GetPullCursor(tableName types.TableName) (string, error)
+	SetPullCursor(tableName types.TableName, cursor string) error
+	GetPullPosition(tableName types.TableName) (string, error)
+	SetPullPosition(tableName types.TableName, position string) error
+	GetBoardVersion(boardID string) (int64, error)
+	SetBoardVersion(boardID string, version int64) error
+	ParkOperation(op types.OperationSync, reason string) error
+	GetParkedOperations() ([]query.ParkedOperation, error)
+	DeleteParkedOperation(id string) error
+	DeleteParkedOperations(tableName types.TableName, recordId string) error
+	CreateSyncConflict(conflict types.SyncConflict) error
+	ListSyncConflicts() ([]types.SyncConflict, error)
+	GetSyncConflict(id string) (types.SyncConflict, error)
+	ResolveSyncConflict(id string) error
+
+	ListTrash() ([]types.TrashItem, error)
+	PurgeTombstones(before time.Time) (int64, error)
 
 	ExportAllData() (*types.ExportedData, error)
 
@@ -52,4 +92,13 @@ type Repository interface {
 
 	GetLocalVersion() (string, error)
 	UpdateLocalVersion(version string) error
+
+	GetDeviceID() (string, error)
+	GetPrivateKey() (string, error)
+	SetPrivateKey(key string) error
+
+	PairLanPeer(deviceID, name, token string) error
+	GetLanPeer(deviceID string) (query.LanPeer, error)
+	ListLanPeers() ([]query.LanPeer, error)
+	RemoveLanPeer(deviceID string) error
 }
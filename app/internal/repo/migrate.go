@@ -0,0 +1,47 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sqlite has no ADD COLUMN IF NOT EXISTS, so every migration runs on each startup and a duplicate column error means
+// it's applied already
+
+var migrations = []string{
+	`ALTER TABLE operations ADD COLUMN hlc TEXT NOT NULL DEFAULT ''`,
+	// operations recorded before the clock existed only know their created_at (seconds)
+	`UPDATE operations
+	 SET hlc = printf('%015d:%010d:%s', CAST(strftime('%s', created_at) AS INTEGER) * 1000, 0, COALESCE(device_id, ''))
+	 WHERE hlc = ''`,
+	`CREATE INDEX IF NOT EXISTS operations_record_hlc_idx ON operations(record_id, hlc)`,
+	`ALTER TABLE operations ADD COLUMN fields TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE boards ADD COLUMN deleted_at TEXT`,
+	`ALTER TABLE "columns" ADD COLUMN deleted_at TEXT`,
+	`ALTER TABLE cards ADD COLUMN deleted_at TEXT`,
+	`ALTER TABLE transcriptions ADD COLUMN deleted_at TEXT`,
+	`ALTER TABLE settings ADD COLUMN sync_backend TEXT NOT NULL DEFAULT 'cloud'`,
+	`ALTER TABLE settings ADD COLUMN sync_location TEXT`,
+	`ALTER TABLE settings ADD COLUMN sync_access_key TEXT`,
+	`ALTER TABLE settings ADD COLUMN sync_secret_key TEXT`,
+	`ALTER TABLE boards ADD COLUMN archived_at TEXT`,
+}
+
+func Migrate(ctx context.Context, db *sql.DB) error {
+	for _, stmt := range migrations {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			if strings.Contains(err.Error(), "duplicate column name") {
+				continue
+			}
+			// schema.sql creates missing tables with every column already, there is nothing to add
+			if strings.Contains(err.Error(), "no such table") {
+				continue
+			}
+			return fmt.Errorf("unable to run migration (%s): %v", stmt, err)
+		}
+	}
+
+	return nil
+}
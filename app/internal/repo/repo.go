@@ -3,10 +3,16 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"seisami/app/internal/hlc"
+	"seisami/app/internal/merge"
 	"seisami/app/internal/repo/sqlc/query"
 	"seisami/app/types"
+	"strconv"
+	"sync"
+	"time"
 
 	_ "embed"
 
@@ -18,19 +24,71 @@ import (
 var Schema string
 
 type repo struct {
+	// db is nil for a repo scoped to a transaction by InTx
+	db      *sql.DB
 	queries *query.Queries
 	ctx     context.Context
+
+	*shared
+}
+
+// shared is the state a repo hands down to the repos InTx scopes to a transaction, so they write with the same clock
+type shared struct {
+	clockMu sync.Mutex
+	clock   *hlc.Clock
+
+	hookMu      sync.RWMutex
+	onOperation func(tableName types.TableName)
 }
 
 func NewRepo(db *sql.DB, ctx context.Context) *repo {
 	queries := query.New(db)
 
 	return &repo{
-		queries,
-		ctx,
+		db:      db,
+		queries: queries,
+		ctx:     ctx,
+		shared:  &shared{},
 	}
 }
 
+// InTx runs fn as one unit of work, everything written through tx is committed together once fn returns nil
+// and rolled back if it returns an error. Calling it on a repo that's already scoped to a transaction just joins it.
+func (r *repo) InTx(fn func(tx Repository) error) error {
+	return r.inTx(func(tx *repo) error {
+		return fn(tx)
+	})
+}
+
+func (r *repo) inTx(fn func(tx *repo) error) error {
+	if r.db == nil {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(r.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %v", err)
+	}
+	// a no-op once committed, it only matters when fn fails or panics
+	defer tx.Rollback()
+
+	scoped := &repo{
+		queries: r.queries.WithTx(tx),
+		ctx:     r.ctx,
+		shared:  r.shared,
+	}
+
+	if err := fn(scoped); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
 func (r *repo) GetBoard(boardId string) (query.Board, error) {
 	board, err := r.queries.GetBoard(r.ctx, boardId)
 	if err != nil {
@@ -40,6 +98,16 @@ func (r *repo) GetBoard(boardId string) (query.Board, error) {
 	return board, nil
 }
 
+// GetBoardWithTrashed is GetBoard for a board that may be in the trash
+func (r *repo) GetBoardWithTrashed(boardId string) (query.Board, error) {
+	board, err := r.queries.GetBoardWithTrashed(r.ctx, boardId)
+	if err != nil {
+		return query.Board{}, fmt.Errorf("error occured fetching board: (%s)... %v", boardId, err)
+	}
+
+	return board, nil
+}
+
 func (r *repo) CreateBoard(name string) (query.Board, error) {
 	id := uuid.New().String()
 	board, err := r.queries.CreateBoard(r.ctx, query.CreateBoardParams{ID: id, Name: name})
@@ -59,6 +127,36 @@ func (r *repo) DeleteBoard(boardId string) error {
 	return nil
 }
 
+func (r *repo) RestoreBoard(boardId string) error {
+	if err := r.queries.RestoreBoard(r.ctx, boardId); err != nil {
+		return fmt.Errorf("error occured restoring board: (%s)...%v", boardId, err)
+	}
+
+	return nil
+}
+
+func (r *repo) ArchiveBoard(boardId string) error {
+	if err := r.queries.ArchiveBoard(r.ctx, boardId); err != nil {
+		return fmt.Errorf("error occured archiving board: (%s)...%v", boardId, err)
+	}
+
+	return nil
+}
+
+func (r *repo) ArchivedBoardIDs() (map[string]bool, error) {
+	ids, err := r.queries.ListArchivedBoardIDs(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error occured listing archived boards: %v", err)
+	}
+
+	archived := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		archived[id] = true
+	}
+
+	return archived, nil
+}
+
 func (r *repo) GetAllBoards(page int64, pageSize int64) ([]query.Board, error) {
 	boards, err := r.queries.ListBoards(r.ctx, query.ListBoardsParams{Limit: 10, Offset: (page - 1) * pageSize})
 	if err != nil {
@@ -104,6 +202,13 @@ func (r *repo) DeleteColumn(columnId string) error {
 	return nil
 }
 
+func (r *repo) RestoreColumn(columnId string) error {
+	if err := r.queries.RestoreColumn(r.ctx, columnId); err != nil {
+		return fmt.Errorf("error restoring column: %v", err)
+	}
+	return nil
+}
+
 func (r *repo) GetColumn(columnId string) (query.Column, error) {
 	column, err := r.queries.GetColumn(r.ctx, columnId)
 	if err != nil {
@@ -112,6 +217,15 @@ func (r *repo) GetColumn(columnId string) (query.Column, error) {
 	return column, nil
 }
 
+// GetColumnWithTrashed is GetColumn for a column that may be in the trash
+func (r *repo) GetColumnWithTrashed(columnId string) (query.Column, error) {
+	column, err := r.queries.GetColumnWithTrashed(r.ctx, columnId)
+	if err != nil {
+		return query.Column{}, fmt.Errorf("error getting column: %v", err)
+	}
+	return column, nil
+}
+
 func (r *repo) ListColumnsByBoard(boardId string) ([]query.Column, error) {
 	columns, err := r.queries.ListColumnsByBoard(r.ctx, boardId)
 	if err != nil {
@@ -163,6 +277,13 @@ func (r *repo) DeleteCard(cardId string) error {
 	return nil
 }
 
+func (r *repo) RestoreCard(cardId string) error {
+	if err := r.queries.RestoreCard(r.ctx, cardId); err != nil {
+		return fmt.Errorf("error restoring card: %v", err)
+	}
+	return nil
+}
+
 func (r *repo) GetCard(cardId string) (query.Card, error) {
 	card, err := r.queries.GetCard(r.ctx, cardId)
 	if err != nil {
@@ -171,6 +292,15 @@ func (r *repo) GetCard(cardId string) (query.Card, error) {
 	return card, nil
 }
 
+// GetCardWithTrashed is GetCard for a card that may be in the trash
+func (r *repo) GetCardWithTrashed(cardId string) (query.Card, error) {
+	card, err := r.queries.GetCardWithTrashed(r.ctx, cardId)
+	if err != nil {
+		return query.Card{}, fmt.Errorf("error getting card: %v", err)
+	}
+	return card, nil
+}
+
 func (r *repo) ListCardsByColumn(columnId string) ([]query.Card, error) {
 	cards, err := r.queries.ListCardsByColumn(r.ctx, columnId)
 	if err != nil {
@@ -247,6 +377,22 @@ func (r *repo) GetTranscriptionByID(transcriptionId string) (query.Transcription
 	return transcription, nil
 }
 
+func (r *repo) DeleteTranscription(transcriptionId string) error {
+	if err := r.queries.DeleteTranscription(r.ctx, transcriptionId); err != nil {
+		return fmt.Errorf("unable to delete transcription: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repo) RestoreTranscription(transcriptionId string) error {
+	if err := r.queries.RestoreTranscription(r.ctx, transcriptionId); err != nil {
+		return fmt.Errorf("unable to restore transcription: %w", err)
+	}
+
+	return nil
+}
+
 func (r *repo) UpdateTranscriptionIntent(transcriptionId string, intent string) error {
 	_, err := r.queries.UpdateTranscriptionIntent(r.ctx, query.UpdateTranscriptionIntentParams{
 		ID: transcriptionId,
@@ -282,6 +428,7 @@ func (r *repo) GetSettings() (query.Setting, error) {
 			return query.Setting{
 				ID:                  1,
 				TranscriptionMethod: "cloud",
+				SyncBackend:         "cloud",
 			}, nil
 		}
 		return query.Setting{}, fmt.Errorf("unable to get settings: %w", err)
@@ -323,6 +470,29 @@ func (r *repo) CreateOrUpdateSettings(transcriptionMethod string, whisperBinaryP
 	})
 }
 
+// SetSyncBackend picks what the sync engine syncs through, the app applies it on its next start
+func (r *repo) SetSyncBackend(backend, location string, accessKey, secretKey *string) (query.Setting, error) {
+	var access, secret sql.NullString
+	if accessKey != nil {
+		access = sql.NullString{String: *accessKey, Valid: true}
+	}
+	if secretKey != nil {
+		secret = sql.NullString{String: *secretKey, Valid: true}
+	}
+
+	settings, err := r.queries.UpdateSyncBackend(r.ctx, query.UpdateSyncBackendParams{
+		SyncBackend:   backend,
+		SyncLocation:  sql.NullString{String: location, Valid: location != ""},
+		SyncAccessKey: access,
+		SyncSecretKey: secret,
+	})
+	if err != nil {
+		return query.Setting{}, fmt.Errorf("unable to save sync backend: %w", err)
+	}
+
+	return settings, nil
+}
+
 func (r *repo) SearchColumnsByBoardAndName(boardId, searchQuery string) ([]query.Column, error) {
 	columns, err := r.queries.SearchColumnsByBoardAndName(r.ctx, query.SearchColumnsByBoardAndNameParams{
 		BoardID: boardId,
@@ -348,22 +518,206 @@ func (r *repo) SearchColumnsByBoardAndName(boardId, searchQuery string) ([]query
 */
 
 func (r *repo) CreateOperation(tableName types.TableName, recordId, payload string, opType types.Operation) (query.Operation, error) {
-	id := uuid.New().String()
+	return r.CreateOperationWithID(uuid.New().String(), tableName, recordId, payload, opType)
+}
+
+// CreateOperationWithID is CreateOperation for an op whose id was handed out already, like one sent to a room
+func (r *repo) CreateOperationWithID(id string, tableName types.TableName, recordId, payload string, opType types.Operation) (query.Operation, error) {
+	fields, values := r.changedFields(tableName, recordId, payload, opType)
+	return r.createOperation(id, tableName, recordId, payload, opType, fields, values)
+}
+
+// CreateFieldsOperation writes an update op that only changes fields, whatever else payload holds is left alone
+func (r *repo) CreateFieldsOperation(tableName types.TableName, recordId, payload string, fields []string) (query.Operation, error) {
+	values, err := merge.Extract(tableName, payload)
+	if err != nil {
+		return query.Operation{}, fmt.Errorf("unable to extract fields from %s payload: %v", tableName, err)
+	}
+
+	return r.createOperation(uuid.New().String(), tableName, recordId, payload, types.UpdateOperation, fields, values)
+}
+
+func (r *repo) createOperation(id string, tableName types.TableName, recordId, payload string, opType types.Operation, fields []string, values merge.Fields) (query.Operation, error) {
+	clock, err := r.getClock()
+	if err != nil {
+		return query.Operation{}, err
+	}
+
+	ts := clock.Now().String()
+
+	encodedFields := ""
+	if fields != nil {
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return query.Operation{}, fmt.Errorf("unable to encode operation fields: %v", err)
+		}
+		encodedFields = string(b)
+	}
+
 	operation, err := r.queries.CreateOperation(r.ctx, query.CreateOperationParams{
 		ID:            id,
 		OperationType: opType.String(),
 		TableName:     tableName.String(),
 		RecordID:      recordId,
+		DeviceID:      sql.NullString{String: clock.DeviceID(), Valid: true},
 		Payload:       payload,
+		Hlc:           ts,
+		Fields:        encodedFields,
 	})
 
 	if err != nil {
 		return query.Operation{}, fmt.Errorf("unable to create operation: %v", err)
 	}
 
+	written := fields
+	if written == nil {
+		written = merge.TableFields(tableName)
+	}
+
+	for _, name := range written {
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := r.UpsertFieldClock(tableName, recordId, name, ts, merge.Encode(v)); err != nil {
+			return query.Operation{}, err
+		}
+	}
+
+	// deletes and restores are ordered by their own clock, a stale delete mustn't undo a newer restore or the reverse
+	if opType == types.DeleteOperation || opType == types.RestoreOperation {
+		if err := r.UpsertFieldClock(tableName, recordId, merge.TombstoneField, ts, opType.String()); err != nil {
+			return query.Operation{}, err
+		}
+	}
+
+	r.hookMu.RLock()
+	onOperation := r.onOperation
+	r.hookMu.RUnlock()
+	if onOperation != nil {
+		onOperation(tableName)
+	}
+
 	return operation, nil
 }
 
+// OnOperationCreated registers fn to be called after every operation written, it must not block
+func (r *repo) OnOperationCreated(fn func(tableName types.TableName)) {
+	r.hookMu.Lock()
+	defer r.hookMu.Unlock()
+
+	r.onOperation = fn
+}
+
+// changedFields works out which fields an op touched by comparing its payload to the last value we know for each field,
+// a nil slice means every field (inserts and payloads we can't read)
+func (r *repo) changedFields(tableName types.TableName, recordId, payload string, opType types.Operation) ([]string, merge.Fields) {
+	if opType == types.DeleteOperation || opType == types.RestoreOperation {
+		return nil, nil
+	}
+
+	values, err := merge.Extract(tableName, payload)
+	if err != nil {
+		fmt.Printf("unable to extract fields from %s payload: %v\n", tableName, err)
+		return nil, nil
+	}
+
+	switch opType {
+	case types.UpdateCardColumn:
+		return []string{"column_id"}, values
+	case types.UpdateOperation:
+		known, err := r.GetFieldClocks(tableName, recordId)
+		if err != nil {
+			fmt.Println(err)
+			return nil, values
+		}
+
+		current := make(map[string]string, len(known))
+		for _, clock := range known {
+			current[clock.Field] = clock.Value
+		}
+
+		return merge.Changed(tableName, current, values), values
+	default:
+		return nil, values
+	}
+}
+
+func (r *repo) GetFieldClocks(tableName types.TableName, recordId string) ([]query.FieldClock, error) {
+	clocks, err := r.queries.GetFieldClocks(r.ctx, query.GetFieldClocksParams{
+		TableName: tableName.String(),
+		RecordID:  recordId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get field clocks: %v", err)
+	}
+
+	return clocks, nil
+}
+
+func (r *repo) UpsertFieldClock(tableName types.TableName, recordId, field, hlc, value string) error {
+	err := r.queries.UpsertFieldClock(r.ctx, query.UpsertFieldClockParams{
+		TableName: tableName.String(),
+		RecordID:  recordId,
+		Field:     field,
+		Hlc:       hlc,
+		Value:     value,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to upsert field clock: %v", err)
+	}
+
+	return nil
+}
+
+// the clock is created lazily because it needs the device id and the latest hlc we've persisted,
+// so a restart never hands out a timestamp lower than one already written
+func (r *repo) getClock() (*hlc.Clock, error) {
+	r.clockMu.Lock()
+	defer r.clockMu.Unlock()
+
+	if r.clock != nil {
+		return r.clock, nil
+	}
+
+	deviceID, err := r.GetDeviceID()
+	if err != nil {
+		return nil, err
+	}
+
+	clock := hlc.NewClock(deviceID)
+
+	latest, err := r.queries.GetLatestOperationHLC(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get latest operation hlc: %v", err)
+	}
+
+	if latest != "" {
+		if ts, err := hlc.Parse(latest); err == nil {
+			clock.Update(ts)
+		}
+	}
+
+	r.clock = clock
+	return clock, nil
+}
+
+// ObserveHLC advances the local clock past an operation received from another device
+func (r *repo) ObserveHLC(remote string) error {
+	ts, err := hlc.Parse(remote)
+	if err != nil {
+		return err
+	}
+
+	clock, err := r.getClock()
+	if err != nil {
+		return err
+	}
+
+	clock.Update(ts)
+	return nil
+}
+
 // Operations has to be uploaded to the cloud
 
 /* we're out of version if local sync_state last_synced_at or last_synced_op_id is not the same with cloud sync_state
@@ -391,7 +745,7 @@ then the one with shorter length is inner & i check if it exist in the one with
 or how tf do i do this, im confused
 */
 
-// the timestamp validation with sync is in the sqlc query
+// ops are pending when their clock is after the op the cloud last acknowledged, the check is in the sqlc query
 func (r *repo) GetAllOperations(tableName types.TableName) ([]query.Operation, error) {
 	ops, err := r.queries.GetAllOperations(r.ctx, query.GetAllOperationsParams{TableName: tableName.String(), TableName_2: tableName.String(), TableName_3: tableName.String()})
 	if err != nil {
@@ -401,6 +755,47 @@ func (r *repo) GetAllOperations(tableName types.TableName) ([]query.Operation, e
 	return ops, nil
 }
 
+// CompactOperations drops acknowledged ops of tableName that a later acknowledged op of the same record supersedes,
+// pending ops stay. it returns how many rows were removed
+func (r *repo) CompactOperations(tableName types.TableName) (int64, error) {
+	acked, err := r.queries.GetAcknowledgedOperationHLC(r.ctx, tableName.String())
+	if errors.Is(err, sql.ErrNoRows) || acked == "" {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to get acknowledged operation: %v", err)
+	}
+
+	removed, err := r.queries.CompactOperations(r.ctx, query.CompactOperationsParams{
+		TableName: tableName.String(),
+		Hlc:       acked,
+		Hlc_2:     acked,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to compact operations: %v", err)
+	}
+
+	return removed, nil
+}
+
+// GetPendingOperationFields returns the fields of every op after the last acknowledged one, keyed by record
+func (r *repo) GetPendingOperationFields(tableName types.TableName) (map[string][]string, error) {
+	rows, err := r.queries.GetPendingOperationFields(r.ctx, query.GetPendingOperationFieldsParams{
+		TableName:   tableName.String(),
+		TableName_2: tableName.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get pending operation fields: %v", err)
+	}
+
+	pending := make(map[string][]string)
+	for _, row := range rows {
+		pending[row.RecordID] = append(pending[row.RecordID], row.Fields)
+	}
+
+	return pending, nil
+}
+
 func (r *repo) UpsertSyncState(tableName types.TableName, lastOpID string, lastSyncedAt int64) error {
 	return r.queries.UpsertSyncState(r.ctx, query.UpsertSyncStateParams{
 		TableName:      tableName.String(),
@@ -619,3 +1014,381 @@ func (r *repo) GetLocalVersion() (string, error) {
 	return localVersion, nil
 
 }
+
+// GetPullCursor is where an interrupted pull of tableName stopped, empty when the last pull finished
+func (r *repo) GetPullCursor(tableName types.TableName) (string, error) {
+	meta, err := r.queries.GetAppMeta(r.ctx, "pull_cursor:"+tableName.String())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to get pull cursor: %v", err)
+	}
+
+	return meta.String, nil
+}
+
+func (r *repo) SetPullCursor(tableName types.TableName, cursor string) error {
+	err := r.queries.UpsertAppMeta(r.ctx, query.UpsertAppMetaParams{
+		Key:   "pull_cursor:" + tableName.String(),
+		Value: sql.NullString{String: cursor, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to store pull cursor: %v", err)
+	}
+
+	return nil
+}
+
+// GetPullPosition is the op log position the last finished pull of tableName ended on, empty before the first one
+func (r *repo) GetPullPosition(tableName types.TableName) (string, error) {
+	meta, err := r.queries.GetAppMeta(r.ctx, "pull_position:"+tableName.String())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to get pull position: %v", err)
+	}
+
+	return meta.String, nil
+}
+
+func (r *repo) SetPullPosition(tableName types.TableName, position string) error {
+	err := r.queries.UpsertAppMeta(r.ctx, query.UpsertAppMetaParams{
+		Key:   "pull_position:" + tableName.String(),
+		Value: sql.NullString{String: position, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to store pull position: %v", err)
+	}
+
+	return nil
+}
+
+// GetBoardVersion is the cloud version of boardID this device last imported, 0 when it never imported the board
+func (r *repo) GetBoardVersion(boardID string) (int64, error) {
+	meta, err := r.queries.GetAppMeta(r.ctx, "board_version:"+boardID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("unable to get board version: %v", err)
+	}
+
+	version, err := strconv.ParseInt(meta.String, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid board version %q: %v", meta.String, err)
+	}
+
+	return version, nil
+}
+
+func (r *repo) SetBoardVersion(boardID string, version int64) error {
+	err := r.queries.UpsertAppMeta(r.ctx, query.UpsertAppMetaParams{
+		Key:   "board_version:" + boardID,
+		Value: sql.NullString{String: strconv.FormatInt(version, 10), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to store board version: %v", err)
+	}
+
+	return nil
+}
+
+// ParkOperation keeps a pulled op that can't be applied yet, parking it again counts another failed attempt
+func (r *repo) ParkOperation(op types.OperationSync, reason string) error {
+	encoded, err := json.Marshal(op)
+	if err != nil {
+		return fmt.Errorf("unable to encode parked operation: %v", err)
+	}
+
+	err = r.queries.ParkOperation(r.ctx, query.ParkOperationParams{
+		ID:        op.ID,
+		TableName: op.TableName,
+		RecordID:  op.RecordID,
+		Operation: string(encoded),
+		LastError: reason,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to park operation: %v", err)
+	}
+
+	return nil
+}
+
+func (r *repo) GetParkedOperations() ([]query.ParkedOperation, error) {
+	parked, err := r.queries.ListParkedOperations(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get parked operations: %v", err)
+	}
+
+	return parked, nil
+}
+
+func (r *repo) DeleteParkedOperation(id string) error {
+	if err := r.queries.DeleteParkedOperation(r.ctx, id); err != nil {
+		return fmt.Errorf("unable to delete parked operation: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteParkedOperations drops every parked op of a record, once it's deleted they'd only bring it back
+func (r *repo) DeleteParkedOperations(tableName types.TableName, recordId string) error {
+	err := r.queries.DeleteParkedOperationsByRecord(r.ctx, query.DeleteParkedOperationsByRecordParams{
+		TableName: tableName.String(),
+		RecordID:  recordId,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete parked operations: %v", err)
+	}
+
+	return nil
+}
+
+func (r *repo) CreateSyncConflict(conflict types.SyncConflict) error {
+	local, err := json.Marshal(conflict.Local)
+	if err != nil {
+		return fmt.Errorf("unable to encode local operation: %v", err)
+	}
+	remote, err := json.Marshal(conflict.Remote)
+	if err != nil {
+		return fmt.Errorf("unable to encode remote operation: %v", err)
+	}
+
+	fields := ""
+	if conflict.Fields != nil {
+		b, err := json.Marshal(conflict.Fields)
+		if err != nil {
+			return fmt.Errorf("unable to encode conflict fields: %v", err)
+		}
+		fields = string(b)
+	}
+
+	id := conflict.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	err = r.queries.CreateSyncConflict(r.ctx, query.CreateSyncConflictParams{
+		ID:              id,
+		TableName:       conflict.TableName,
+		RecordID:        conflict.RecordID,
+		LocalOperation:  string(local),
+		RemoteOperation: string(remote),
+		Winner:          conflict.Winner,
+		Reason:          conflict.Reason,
+		Fields:          fields,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to record sync conflict: %v", err)
+	}
+
+	return nil
+}
+
+func (r *repo) ListSyncConflicts() ([]types.SyncConflict, error) {
+	rows, err := r.queries.ListSyncConflicts(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list sync conflicts: %v", err)
+	}
+
+	conflicts := make([]types.SyncConflict, 0, len(rows))
+	for _, row := range rows {
+		conflict, err := decodeSyncConflict(row)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	return conflicts, nil
+}
+
+func (r *repo) GetSyncConflict(id string) (types.SyncConflict, error) {
+	row, err := r.queries.GetSyncConflict(r.ctx, id)
+	if err != nil {
+		return types.SyncConflict{}, fmt.Errorf("unable to get sync conflict (%s): %v", id, err)
+	}
+
+	return decodeSyncConflict(row)
+}
+
+func (r *repo) ResolveSyncConflict(id string) error {
+	if err := r.queries.ResolveSyncConflict(r.ctx, id); err != nil {
+		return fmt.Errorf("unable to resolve sync conflict: %v", err)
+	}
+
+	return nil
+}
+
+func decodeSyncConflict(row query.SyncConflict) (types.SyncConflict, error) {
+	conflict := types.SyncConflict{
+		ID:         row.ID,
+		TableName:  row.TableName,
+		RecordID:   row.RecordID,
+		Winner:     row.Winner,
+		Reason:     row.Reason,
+		CreatedAt:  row.CreatedAt.String,
+		ResolvedAt: row.ResolvedAt.String,
+	}
+
+	if err := json.Unmarshal([]byte(row.LocalOperation), &conflict.Local); err != nil {
+		return types.SyncConflict{}, fmt.Errorf("invalid local operation on conflict %s: %v", row.ID, err)
+	}
+	if err := json.Unmarshal([]byte(row.RemoteOperation), &conflict.Remote); err != nil {
+		return types.SyncConflict{}, fmt.Errorf("invalid remote operation on conflict %s: %v", row.ID, err)
+	}
+	if row.Fields != "" {
+		if err := json.Unmarshal([]byte(row.Fields), &conflict.Fields); err != nil {
+			return types.SyncConflict{}, fmt.Errorf("invalid fields on conflict %s: %v", row.ID, err)
+		}
+	}
+
+	return conflict, nil
+}
+
+func (r *repo) ListTrash() ([]types.TrashItem, error) {
+	rows, err := r.queries.ListTrash(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list trash: %v", err)
+	}
+
+	items := make([]types.TrashItem, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, types.TrashItem{
+			TableName: row.TableName,
+			ID:        row.ID,
+			Title:     row.Title,
+			DeletedAt: row.DeletedAt.String,
+		})
+	}
+
+	return items, nil
+}
+
+// PurgeTombstones hard deletes records trashed before the cutoff and whatever sits inside them, children first in one
+// transaction. it returns how many rows were removed
+func (r *repo) PurgeTombstones(before time.Time) (int64, error) {
+	cutoff := sql.NullString{String: before.UTC().Format(time.DateTime), Valid: true}
+
+	var purged int64
+	err := r.inTx(func(tx *repo) error {
+		q := tx.queries
+
+		steps := []func() (int64, error){
+			func() (int64, error) {
+				return q.PurgeCards(r.ctx, query.PurgeCardsParams{DeletedAt: cutoff, DeletedAt_2: cutoff, DeletedAt_3: cutoff})
+			},
+			func() (int64, error) {
+				return q.PurgeTranscriptions(r.ctx, query.PurgeTranscriptionsParams{DeletedAt: cutoff, DeletedAt_2: cutoff})
+			},
+			func() (int64, error) {
+				return q.PurgeColumns(r.ctx, query.PurgeColumnsParams{DeletedAt: cutoff, DeletedAt_2: cutoff})
+			},
+			func() (int64, error) {
+				return q.PurgeBoards(r.ctx, cutoff)
+			},
+		}
+
+		for _, step := range steps {
+			n, err := step()
+			if err != nil {
+				return fmt.Errorf("unable to purge tombstones: %v", err)
+			}
+			purged += n
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+func (r *repo) GetDeviceID() (string, error) {
+	meta, err := r.queries.GetAppMeta(r.ctx, "device_id")
+	if err == nil && meta.String != "" {
+		return meta.String, nil
+	}
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("unable to get device id: %v", err)
+	}
+
+	deviceID := uuid.New().String()
+	if err := r.queries.UpsertAppMeta(r.ctx, query.UpsertAppMetaParams{
+		Key:   "device_id",
+		Value: sql.NullString{String: deviceID, Valid: true},
+	}); err != nil {
+		return "", fmt.Errorf("unable to store device id: %v", err)
+	}
+
+	return deviceID, nil
+}
+
+// GetPrivateKey is this device's unlocked end to end encryption key, empty until encryption is enabled here
+func (r *repo) GetPrivateKey() (string, error) {
+	meta, err := r.queries.GetAppMeta(r.ctx, "e2e_private_key")
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to get private key: %v", err)
+	}
+
+	return meta.String, nil
+}
+
+func (r *repo) SetPrivateKey(key string) error {
+	err := r.queries.UpsertAppMeta(r.ctx, query.UpsertAppMetaParams{
+		Key:   "e2e_private_key",
+		Value: sql.NullString{String: key, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to store private key: %v", err)
+	}
+
+	return nil
+}
+
+func (r *repo) PairLanPeer(deviceID, name, token string) error {
+	err := r.queries.UpsertLanPeer(r.ctx, query.UpsertLanPeerParams{
+		DeviceID: deviceID,
+		Name:     name,
+		Token:    token,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to pair device (%s): %v", deviceID, err)
+	}
+
+	return nil
+}
+
+func (r *repo) GetLanPeer(deviceID string) (query.LanPeer, error) {
+	peer, err := r.queries.GetLanPeer(r.ctx, deviceID)
+	if err != nil {
+		return query.LanPeer{}, fmt.Errorf("unable to get paired device (%s): %w", deviceID, err)
+	}
+
+	return peer, nil
+}
+
+func (r *repo) ListLanPeers() ([]query.LanPeer, error) {
+	peers, err := r.queries.ListLanPeers(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list paired devices: %v", err)
+	}
+
+	return peers, nil
+}
+
+func (r *repo) RemoveLanPeer(deviceID string) error {
+	if err := r.queries.DeleteLanPeer(r.ctx, deviceID); err != nil {
+		return fmt.Errorf("unable to remove paired device (%s): %v", deviceID, err)
+	}
+
+	return nil
+}
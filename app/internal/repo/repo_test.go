@@ -8,8 +8,11 @@ import (
 	"seisami/app/internal/repo/sqlc/query"
 	"seisami/app/types"
 	"testing"
+	"time"
 
 	_ "embed"
+
+	"github.com/google/uuid"
 )
 
 func setupTestDB(t *testing.T) *repo {
@@ -871,6 +874,30 @@ func TestOperations(t *testing.T) {
 		}
 	})
 
+	t.Run("create_operation_with_id", func(t *testing.T) {
+		repo := setupTestDB(t)
+
+		board, err := repo.CreateBoard("Test Board")
+		if err != nil {
+			t.Fatalf("failed to create board: %v", err)
+		}
+
+		// the id the board's room already has for this change
+		id := uuid.New().String()
+		operation, err := repo.CreateOperationWithID(id, types.BoardTable, board.ID, `{"name":"Renamed"}`, types.UpdateOperation)
+		if err != nil {
+			t.Fatalf("failed to create operation: %v", err)
+		}
+
+		if operation.ID != id {
+			t.Errorf("expected operation id '%s', got '%s'", id, operation.ID)
+		}
+
+		if operation.Hlc == "" {
+			t.Errorf("expected the operation to be stamped by the clock")
+		}
+	})
+
 	t.Run("get_all_operations", func(t *testing.T) {
 		repo := setupTestDB(t)
 
@@ -896,8 +923,13 @@ func TestOperations(t *testing.T) {
 			t.Fatalf("failed to get operations: %v", err)
 		}
 
-		if len(operations) != 3 {
-			t.Errorf("expected 3 operations, got %d", len(operations))
+		// all three ops land in the same second, the hlc still picks the last one written for the record
+		if len(operations) != 1 {
+			t.Fatalf("expected 1 operation, got %d", len(operations))
+		}
+
+		if operations[0].Payload != `{"name":"Board 2"}` {
+			t.Errorf("expected latest operation payload, got '%s'", operations[0].Payload)
 		}
 	})
 
@@ -1074,6 +1106,84 @@ func TestOperations(t *testing.T) {
 			t.Fatalf("expected payload UpdatedAt %s, got %s", payload.UpdatedAt, gottenPayload.UpdatedAt)
 		}
 	})
+
+	t.Run("ops_after_the_acknowledged_op_stay_pending_in_the_same_second", func(t *testing.T) {
+		repo := setupTestDB(t)
+
+		acked, err := repo.CreateOperation(types.BoardTable, "board-1", `{"name":"Acked"}`, types.UpdateOperation)
+		if err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+		// the sync finished right after, a wall clock cutoff would hide anything else written this second
+		if err := repo.UpsertSyncState(types.BoardTable, acked.ID, time.Now().Unix()+1); err != nil {
+			t.Fatalf("UpsertSyncState failed: %v", err)
+		}
+
+		pending, err := repo.CreateOperation(types.BoardTable, "board-2", `{"name":"Pending"}`, types.UpdateOperation)
+		if err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+
+		ops, err := repo.GetAllOperations(types.BoardTable)
+		if err != nil {
+			t.Fatalf("GetAllOperations failed: %v", err)
+		}
+		if len(ops) != 1 || ops[0].ID != pending.ID {
+			t.Fatalf("expected only %s to be pending, got %+v", pending.ID, ops)
+		}
+
+		fields, err := repo.GetPendingOperationFields(types.BoardTable)
+		if err != nil {
+			t.Fatalf("GetPendingOperationFields failed: %v", err)
+		}
+		if _, ok := fields["board-1"]; ok || len(fields["board-2"]) != 1 {
+			t.Fatalf("expected only board-2 fields to be pending, got %v", fields)
+		}
+	})
+
+	t.Run("compaction_keeps_latest_acknowledged_and_pending_ops", func(t *testing.T) {
+		repo := setupTestDB(t)
+
+		var acked query.Operation
+		for i := range 3 {
+			op, err := repo.CreateOperation(types.BoardTable, "board-1", fmt.Sprintf(`{"name":"Board %d"}`, i), types.UpdateOperation)
+			if err != nil {
+				t.Fatalf("failed to create operation: %v", err)
+			}
+			acked = op
+		}
+		if _, err := repo.CreateOperation(types.BoardTable, "board-2", `{"name":"Other"}`, types.InsertOperation); err != nil {
+			t.Fatalf("failed to create operation: %v", err)
+		}
+
+		// nothing is acknowledged before the first sync
+		if removed, err := repo.CompactOperations(types.BoardTable); err != nil || removed != 0 {
+			t.Fatalf("expected nothing compacted, got %d (%v)", removed, err)
+		}
+
+		if err := repo.UpsertSyncState(types.BoardTable, acked.ID, 1735725600); err != nil {
+			t.Fatalf("failed to upsert sync state: %v", err)
+		}
+		if _, err := repo.CreateOperation(types.BoardTable, "board-1", `{"name":"Pending"}`, types.UpdateOperation); err != nil {
+			t.Fatalf("failed to create operation: %v", err)
+		}
+
+		removed, err := repo.CompactOperations(types.BoardTable)
+		if err != nil {
+			t.Fatalf("CompactOperations failed: %v", err)
+		}
+		if removed != 2 {
+			t.Errorf("expected the 2 superseded ops to be removed, got %d", removed)
+		}
+
+		var left int
+		if err := repo.db.QueryRow(`SELECT COUNT(*) FROM operations`).Scan(&left); err != nil {
+			t.Fatalf("failed to count operations: %v", err)
+		}
+		if left != 3 {
+			t.Errorf("expected the acknowledged, the other record's & the pending op to be kept, got %d", left)
+		}
+	})
 }
 
 func TestSyncState(t *testing.T) {
@@ -1159,6 +1269,90 @@ func TestSyncState(t *testing.T) {
 	})
 }
 
+func TestTrash(t *testing.T) {
+	t.Run("list_restore_and_purge", func(t *testing.T) {
+		repo := setupTestDB(t)
+
+		board, err := repo.CreateBoard("Old Board")
+		if err != nil {
+			t.Fatalf("failed to create board: %v", err)
+		}
+		column, err := repo.CreateColumn(board.ID, "To Do")
+		if err != nil {
+			t.Fatalf("failed to create column: %v", err)
+		}
+		card, err := repo.CreateCard(column.ID, "Card", "")
+		if err != nil {
+			t.Fatalf("failed to create card: %v", err)
+		}
+		kept, err := repo.CreateBoard("Kept Board")
+		if err != nil {
+			t.Fatalf("failed to create board: %v", err)
+		}
+
+		if err := repo.DeleteCard(card.ID); err != nil {
+			t.Fatalf("failed to delete card: %v", err)
+		}
+		if err := repo.DeleteBoard(board.ID); err != nil {
+			t.Fatalf("failed to delete board: %v", err)
+		}
+
+		if _, err := repo.GetCard(card.ID); err == nil {
+			t.Errorf("expected GetCard to skip the trashed card")
+		}
+		if trashed, err := repo.GetCardWithTrashed(card.ID); err != nil || !trashed.DeletedAt.Valid {
+			t.Errorf("expected the trashed card with its tombstone, got %+v (%v)", trashed, err)
+		}
+
+		trash, err := repo.ListTrash()
+		if err != nil {
+			t.Fatalf("failed to list trash: %v", err)
+		}
+		if len(trash) != 2 {
+			t.Fatalf("expected 2 records in the trash, got %d", len(trash))
+		}
+
+		boards, err := repo.GetAllBoards(1, 10)
+		if err != nil {
+			t.Fatalf("failed to get boards: %v", err)
+		}
+		if len(boards) != 1 || boards[0].ID != kept.ID {
+			t.Errorf("expected only the kept board to be listed, got %d boards", len(boards))
+		}
+
+		if err := repo.RestoreCard(card.ID); err != nil {
+			t.Fatalf("failed to restore card: %v", err)
+		}
+		cards, err := repo.ListCardsByColumn(column.ID)
+		if err != nil {
+			t.Fatalf("failed to list cards: %v", err)
+		}
+		if len(cards) != 1 {
+			t.Errorf("expected the restored card to be listed, got %d cards", len(cards))
+		}
+
+		// nothing has outlived a cutoff in the past
+		if purged, err := repo.PurgeTombstones(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+			t.Fatalf("expected nothing purged, got %d (%v)", purged, err)
+		}
+
+		// the board goes with the column and card inside it, restored or not
+		purged, err := repo.PurgeTombstones(time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("failed to purge tombstones: %v", err)
+		}
+		if purged != 3 {
+			t.Errorf("expected 3 records purged, got %d", purged)
+		}
+		if _, err := repo.GetCard(card.ID); err == nil {
+			t.Errorf("expected the card to be purged with its board")
+		}
+		if _, err := repo.GetBoard(kept.ID); err != nil {
+			t.Errorf("expected the kept board to survive: %v", err)
+		}
+	})
+}
+
 func TestAppVersion(t *testing.T) {
 	t.Run("get_local_version_default", func(t *testing.T) {
 		repo := setupTestDB(t)
@@ -1448,3 +1642,51 @@ func TestImportData(t *testing.T) {
 		}
 	})
 }
+
+func TestMigrate(t *testing.T) {
+	t.Run("backfills_hlc_for_legacy_operations", func(t *testing.T) {
+		db, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatalf("failed to open db: %v", err)
+		}
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		// operations table as it was created before the hlc column existed
+		if _, err := db.Exec(`CREATE TABLE operations (
+			id TEXT PRIMARY KEY,
+			"table_name" TEXT NOT NULL,
+			record_id TEXT NOT NULL,
+			operation_type TEXT NOT NULL,
+			device_id TEXT,
+			payload TEXT NOT NULL,
+			created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+			updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+		)`); err != nil {
+			t.Fatalf("failed to create legacy table: %v", err)
+		}
+
+		if _, err := db.Exec(`INSERT INTO operations (id, table_name, record_id, operation_type, device_id, payload, created_at)
+			VALUES ('op-1', 'boards', 'board-1', 'insert', 'device-a', '{}', '2025-01-01 10:00:00')`); err != nil {
+			t.Fatalf("failed to insert legacy operation: %v", err)
+		}
+
+		// running twice must be a no-op the second time, it runs on every startup
+		for i := 0; i < 2; i++ {
+			if err := Migrate(context.Background(), db); err != nil {
+				t.Fatalf("failed to migrate (run %d): %v", i+1, err)
+			}
+		}
+
+		var hlc string
+		if err := db.QueryRow(`SELECT hlc FROM operations WHERE id = 'op-1'`).Scan(&hlc); err != nil {
+			t.Fatalf("failed to read hlc: %v", err)
+		}
+
+		if hlc != "001735725600000:0000000000:device-a" {
+			t.Errorf("unexpected backfilled hlc '%s'", hlc)
+		}
+	})
+}
@@ -4,11 +4,12 @@
 
 -- name: GetBoard :one
 SELECT * FROM boards
-WHERE id = ?
+WHERE id = ? AND deleted_at IS NULL
 LIMIT 1;
 
 -- name: ListBoards :many
 SELECT * FROM boards
+WHERE deleted_at IS NULL AND archived_at IS NULL
 ORDER BY created_at ASC
 LIMIT ? OFFSET ?;
 
@@ -25,8 +26,18 @@ WHERE id = ?
 RETURNING *;
 
 -- name: DeleteBoard :exec
-DELETE FROM boards
-WHERE id = ?;
+UPDATE boards
+SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL;
+
+-- name: ArchiveBoard :exec
+UPDATE boards
+SET archived_at = datetime('now')
+WHERE id = ? AND archived_at IS NULL;
+
+-- name: ListArchivedBoardIDs :many
+SELECT id FROM boards
+WHERE archived_at IS NOT NULL;
 
 -- 
 -- Columns Functionality
@@ -34,12 +45,12 @@ WHERE id = ?;
 
 -- name: GetColumn :one
 SELECT * FROM columns
-WHERE id = ?
+WHERE id = ? AND deleted_at IS NULL
 LIMIT 1;
 
 -- name: ListColumnsByBoard :many
 SELECT * FROM columns
-WHERE board_id = ?
+WHERE board_id = ? AND deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: CreateColumn :one
@@ -55,8 +66,9 @@ WHERE id = ?
 RETURNING *;
 
 -- name: DeleteColumn :exec
-DELETE FROM columns
-WHERE id = ?;
+UPDATE columns
+SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL;
 
 -- 
 -- Transcriptions Functionality
@@ -69,11 +81,12 @@ LIMIT 1;
 
 -- name: ListTranscriptionsByBoard :many
 SELECT * FROM transcriptions
-WHERE board_id = ?
+WHERE board_id = ? AND deleted_at IS NULL
 ORDER BY created_at DESC;
 
 -- name: ListAllTranscriptions :many
 SELECT * FROM transcriptions
+WHERE deleted_at IS NULL
 ORDER BY created_at DESC
 LIMIT ? OFFSET ?;
 
@@ -97,8 +110,9 @@ WHERE id = ?
 RETURNING *;
 
 -- name: DeleteTranscription :exec
-DELETE FROM transcriptions
-WHERE id = ?;
+UPDATE transcriptions
+SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL;
 
 
 -- name: GetTranscriptionByRecordingPath :one
@@ -130,6 +144,17 @@ SET transcription_method = ?,
 WHERE id = 1
 RETURNING *;
 
+-- name: UpdateSyncBackend :one
+INSERT INTO settings (id, sync_backend, sync_location, sync_access_key, sync_secret_key)
+VALUES (1, ?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE
+SET sync_backend = excluded.sync_backend,
+    sync_location = excluded.sync_location,
+    sync_access_key = excluded.sync_access_key,
+    sync_secret_key = excluded.sync_secret_key,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
 
 -- 
 -- Cards Functionality
@@ -137,12 +162,12 @@ RETURNING *;
 
 -- name: GetCard :one
 SELECT * FROM cards
-WHERE id = ?
+WHERE id = ? AND deleted_at IS NULL
 LIMIT 1;
 
 -- name: ListCardsByColumn :many
 SELECT * FROM cards
-WHERE column_id = ?
+WHERE column_id = ? AND deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: CreateCard :one
@@ -166,15 +191,91 @@ WHERE id = ?
 RETURNING *;
 
 -- name: DeleteCard :exec
-DELETE FROM cards
-WHERE id = ?;
+UPDATE cards
+SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL;
 
 
 -- name: SearchColumnsByBoardAndName :many
 SELECT *
 FROM "columns"
 WHERE board_id = ?
-  AND name LIKE '%' || ? || '%' COLLATE NOCASE;
+  AND name LIKE '%' || ? || '%' COLLATE NOCASE
+  AND deleted_at IS NULL;
+
+-- 
+-- Trash Functionality
+--
+
+-- sync and restore work on records in the trash too, the Get queries above skip them
+-- name: GetBoardWithTrashed :one
+SELECT * FROM boards
+WHERE id = ?
+LIMIT 1;
+
+-- name: GetColumnWithTrashed :one
+SELECT * FROM columns
+WHERE id = ?
+LIMIT 1;
+
+-- name: GetCardWithTrashed :one
+SELECT * FROM cards
+WHERE id = ?
+LIMIT 1;
+
+-- name: RestoreBoard :exec
+UPDATE boards
+SET deleted_at = NULL
+WHERE id = ?;
+
+-- name: RestoreColumn :exec
+UPDATE columns
+SET deleted_at = NULL
+WHERE id = ?;
+
+-- name: RestoreCard :exec
+UPDATE cards
+SET deleted_at = NULL
+WHERE id = ?;
+
+-- name: RestoreTranscription :exec
+UPDATE transcriptions
+SET deleted_at = NULL
+WHERE id = ?;
+
+-- name: ListTrash :many
+SELECT 'boards' AS table_name, id, name AS title, deleted_at FROM boards WHERE deleted_at IS NOT NULL
+UNION ALL
+SELECT 'columns' AS table_name, id, name AS title, deleted_at FROM columns WHERE deleted_at IS NOT NULL
+UNION ALL
+SELECT 'cards' AS table_name, id, title, deleted_at FROM cards WHERE deleted_at IS NOT NULL
+UNION ALL
+SELECT 'transcriptions' AS table_name, id, transcription AS title, deleted_at FROM transcriptions WHERE deleted_at IS NOT NULL
+ORDER BY deleted_at DESC;
+
+-- records inside a board or column being purged go with it, the cascades aren't enforced here
+-- name: PurgeCards :execrows
+DELETE FROM cards
+WHERE deleted_at < ?
+   OR column_id IN (
+       SELECT c.id FROM columns c
+       WHERE c.deleted_at < ?
+          OR c.board_id IN (SELECT b.id FROM boards b WHERE b.deleted_at < ?)
+   );
+
+-- name: PurgeColumns :execrows
+DELETE FROM columns
+WHERE deleted_at < ?
+   OR board_id IN (SELECT b.id FROM boards b WHERE b.deleted_at < ?);
+
+-- name: PurgeTranscriptions :execrows
+DELETE FROM transcriptions
+WHERE deleted_at < ?
+   OR board_id IN (SELECT b.id FROM boards b WHERE b.deleted_at < ?);
+
+-- name: PurgeBoards :execrows
+DELETE FROM boards
+WHERE deleted_at < ?;
 
 -- 
 -- Export/Sync Functionality
@@ -182,17 +283,23 @@ WHERE board_id = ?
 
 -- name: ListAllColumns :many
 SELECT * FROM columns
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: ListAllCards :many
 SELECT * FROM cards
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: CreateOperation :one
-INSERT INTO operations (id, table_name, record_id, operation_type, payload)
-VALUES (?, ?, ?, ?, ?)
+INSERT INTO operations (id, table_name, record_id, operation_type, device_id, payload, hlc, fields)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
+-- name: GetLatestOperationHLC :one
+SELECT CAST(COALESCE(MAX(hlc), '') AS TEXT) AS hlc
+FROM operations;
+
 --  GetAllOperations The one below is faster & better
 -- SELECT * FROM operations
 -- WHERE created_at > (SELECT last_synced_at FROM sync_state WHERE sync_state."table_name" = ?)
@@ -202,21 +309,51 @@ RETURNING *;
 SELECT o.*
 FROM operations AS o
 JOIN (
-    SELECT inner_op.record_id, MAX(inner_op.created_at) AS max_created_at
+    SELECT inner_op.record_id, MAX(inner_op.hlc) AS max_hlc
     FROM operations AS inner_op
-    WHERE CAST(strftime('%s', inner_op.created_at) AS INTEGER) > COALESCE((
-        SELECT last_synced_at
+    WHERE inner_op.hlc > COALESCE((
+        SELECT acked.hlc
         FROM sync_state
+        JOIN operations AS acked ON acked.id = sync_state.last_synced_op_id
         WHERE sync_state.table_name = ?
-    ), 0)
+    ), '')
     AND inner_op.table_name = ?
     GROUP BY inner_op.record_id
 ) latest
 ON o.record_id = latest.record_id
-AND o.created_at = latest.max_created_at
+AND o.hlc = latest.max_hlc
 AND o.table_name = ?
-ORDER BY o.created_at ASC;
-
+ORDER BY o.hlc ASC;
+
+-- name: GetPendingOperationFields :many
+SELECT record_id, fields
+FROM operations
+WHERE hlc > COALESCE((
+    SELECT acked.hlc
+    FROM sync_state
+    JOIN operations AS acked ON acked.id = sync_state.last_synced_op_id
+    WHERE sync_state.table_name = ?
+), '')
+AND table_name = ?;
+
+-- name: GetAcknowledgedOperationHLC :one
+SELECT o.hlc
+FROM operations o
+JOIN sync_state ss ON ss.last_synced_op_id = o.id
+WHERE ss."table_name" = ?;
+
+-- superseded = a later op of the same record that the cloud has acknowledged too
+-- name: CompactOperations :execrows
+DELETE FROM operations
+WHERE "table_name" = ?
+  AND hlc <= ?
+  AND EXISTS (
+      SELECT 1 FROM operations newer
+      WHERE newer."table_name" = operations."table_name"
+        AND newer.record_id = operations.record_id
+        AND newer.hlc > operations.hlc
+        AND newer.hlc <= ?
+  );
 
 -- name: UpsertSyncState :exec
 INSERT INTO sync_state (table_name, last_synced_at, last_synced_op_id)
@@ -244,7 +381,8 @@ INSERT INTO boards (id, name, created_at, updated_at)
 VALUES (?, ?, ?, ?)
 ON CONFLICT(id) DO UPDATE SET
     name = excluded.name,
-    updated_at = excluded.updated_at
+    updated_at = excluded.updated_at,
+    archived_at = NULL
 RETURNING *;
 
 -- name: ImportColumn :one
@@ -280,6 +418,54 @@ ON CONFLICT(id) DO UPDATE SET
     updated_at = excluded.updated_at
 RETURNING *;
 
+-- name: GetFieldClocks :many
+SELECT * FROM field_clocks
+WHERE table_name = ? AND record_id = ?;
+
+-- name: UpsertFieldClock :exec
+INSERT INTO field_clocks (table_name, record_id, field, hlc, value)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(table_name, record_id, field) DO UPDATE SET
+    hlc = excluded.hlc,
+    value = excluded.value
+WHERE excluded.hlc >= field_clocks.hlc;
+
+-- name: CreateSyncConflict :exec
+INSERT INTO sync_conflicts (id, table_name, record_id, local_operation, remote_operation, winner, reason, fields)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListSyncConflicts :many
+SELECT * FROM sync_conflicts
+ORDER BY created_at DESC;
+
+-- name: GetSyncConflict :one
+SELECT * FROM sync_conflicts
+WHERE id = ?;
+
+-- name: ResolveSyncConflict :exec
+UPDATE sync_conflicts
+SET resolved_at = datetime('now')
+WHERE id = ?;
+
+-- name: ParkOperation :exec
+INSERT INTO parked_operations (id, table_name, record_id, operation, last_error)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET
+    attempts = parked_operations.attempts + 1,
+    last_error = excluded.last_error;
+
+-- name: ListParkedOperations :many
+SELECT * FROM parked_operations
+ORDER BY parked_at ASC;
+
+-- name: DeleteParkedOperation :exec
+DELETE FROM parked_operations
+WHERE id = ?;
+
+-- name: DeleteParkedOperationsByRecord :exec
+DELETE FROM parked_operations
+WHERE table_name = ? AND record_id = ?;
+
 -- name: UpsertAppMeta :exec
 INSERT INTO app_meta (key, value)
 VALUES (?, ?)
@@ -288,4 +474,24 @@ SET value = EXCLUDED.value;
 
 -- name: GetAppMeta :one
 SELECT value FROM app_meta
-WHERE key = ?;
\ No newline at end of file
+WHERE key = ?;
+
+-- name: UpsertLanPeer :exec
+INSERT INTO lan_peers (device_id, name, token)
+VALUES (?, ?, ?)
+ON CONFLICT(device_id) DO UPDATE SET
+    name = excluded.name,
+    token = excluded.token,
+    paired_at = CURRENT_TIMESTAMP;
+
+-- name: GetLanPeer :one
+SELECT * FROM lan_peers
+WHERE device_id = ?;
+
+-- name: ListLanPeers :many
+SELECT * FROM lan_peers
+ORDER BY paired_at ASC;
+
+-- name: DeleteLanPeer :exec
+DELETE FROM lan_peers
+WHERE device_id = ?;
@@ -14,10 +14,12 @@ type AppMetum struct {
 }
 
 type Board struct {
-	ID        string
-	Name      string
-	CreatedAt sql.NullString
-	UpdatedAt sql.NullString
+	ID         string
+	Name       string
+	CreatedAt  sql.NullString
+	UpdatedAt  sql.NullString
+	DeletedAt  sql.NullString
+	ArchivedAt sql.NullString
 }
 
 type Card struct {
@@ -28,6 +30,7 @@ type Card struct {
 	Attachments sql.NullString
 	CreatedAt   sql.NullString
 	UpdatedAt   sql.NullString
+	DeletedAt   sql.NullString
 }
 
 type Column struct {
@@ -37,6 +40,22 @@ type Column struct {
 	Position  int64
 	CreatedAt sql.NullString
 	UpdatedAt sql.NullString
+	DeletedAt sql.NullString
+}
+
+type FieldClock struct {
+	TableName string
+	RecordID  string
+	Field     string
+	Hlc       string
+	Value     string
+}
+
+type LanPeer struct {
+	DeviceID string
+	Name     string
+	Token    string
+	PairedAt sql.NullString
 }
 
 type Operation struct {
@@ -48,6 +67,18 @@ type Operation struct {
 	Payload       string
 	CreatedAt     sql.NullString
 	UpdatedAt     sql.NullString
+	Hlc           string
+	Fields        string
+}
+
+type ParkedOperation struct {
+	ID        string
+	TableName string
+	RecordID  string
+	Operation string
+	Attempts  int64
+	LastError string
+	ParkedAt  sql.NullString
 }
 
 type Setting struct {
@@ -58,6 +89,23 @@ type Setting struct {
 	OpenaiApiKey        sql.NullString
 	CreatedAt           sql.NullString
 	UpdatedAt           sql.NullString
+	SyncBackend         string
+	SyncLocation        sql.NullString
+	SyncAccessKey       sql.NullString
+	SyncSecretKey       sql.NullString
+}
+
+type SyncConflict struct {
+	ID              string
+	TableName       string
+	RecordID        string
+	LocalOperation  string
+	RemoteOperation string
+	Winner          string
+	Reason          string
+	Fields          string
+	CreatedAt       sql.NullString
+	ResolvedAt      sql.NullString
 }
 
 type SyncState struct {
@@ -75,4 +123,5 @@ type Transcription struct {
 	AssistantResponse sql.NullString
 	CreatedAt         sql.NullString
 	UpdatedAt         sql.NullString
+	DeletedAt         sql.NullString
 }
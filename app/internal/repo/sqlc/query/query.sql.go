@@ -10,10 +10,49 @@ import (
 	"database/sql"
 )
 
+const archiveBoard = `-- name: ArchiveBoard :exec
+UPDATE boards
+SET archived_at = datetime('now')
+WHERE id = ? AND archived_at IS NULL
+`
+
+func (q *Queries) ArchiveBoard(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, archiveBoard, id)
+	return err
+}
+
+const compactOperations = `-- name: CompactOperations :execrows
+DELETE FROM operations
+WHERE "table_name" = ?
+  AND hlc <= ?
+  AND EXISTS (
+      SELECT 1 FROM operations newer
+      WHERE newer."table_name" = operations."table_name"
+        AND newer.record_id = operations.record_id
+        AND newer.hlc > operations.hlc
+        AND newer.hlc <= ?
+  )
+`
+
+type CompactOperationsParams struct {
+	TableName string
+	Hlc       string
+	Hlc_2     string
+}
+
+// superseded = a later op of the same record that the cloud has acknowledged too
+func (q *Queries) CompactOperations(ctx context.Context, arg CompactOperationsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, compactOperations, arg.TableName, arg.Hlc, arg.Hlc_2)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createBoard = `-- name: CreateBoard :one
 INSERT INTO boards (id, name)
 VALUES (?, ?)
-RETURNING id, name, created_at, updated_at
+RETURNING id, name, created_at, updated_at, deleted_at, archived_at
 `
 
 type CreateBoardParams struct {
@@ -29,6 +68,8 @@ func (q *Queries) CreateBoard(ctx context.Context, arg CreateBoardParams) (Board
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.ArchivedAt,
 	)
 	return i, err
 }
@@ -36,7 +77,7 @@ func (q *Queries) CreateBoard(ctx context.Context, arg CreateBoardParams) (Board
 const createCard = `-- name: CreateCard :one
 INSERT INTO cards (id, column_id, title, description, attachments)
 VALUES (?, ?, ?, ?, ?)
-RETURNING id, column_id, title, description, attachments, created_at, updated_at
+RETURNING id, column_id, title, description, attachments, created_at, updated_at, deleted_at
 `
 
 type CreateCardParams struct {
@@ -64,6 +105,7 @@ func (q *Queries) CreateCard(ctx context.Context, arg CreateCardParams) (Card, e
 		&i.Attachments,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -71,7 +113,7 @@ func (q *Queries) CreateCard(ctx context.Context, arg CreateCardParams) (Card, e
 const createColumn = `-- name: CreateColumn :one
 INSERT INTO columns (id, board_id, name, position)
 VALUES (?, ?, ?, ?)
-RETURNING id, board_id, name, position, created_at, updated_at
+RETURNING id, board_id, name, position, created_at, updated_at, deleted_at
 `
 
 type CreateColumnParams struct {
@@ -96,14 +138,15 @@ func (q *Queries) CreateColumn(ctx context.Context, arg CreateColumnParams) (Col
 		&i.Position,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const createOperation = `-- name: CreateOperation :one
-INSERT INTO operations (id, table_name, record_id, operation_type, payload)
-VALUES (?, ?, ?, ?, ?)
-RETURNING id, table_name, record_id, operation_type, device_id, payload, created_at, updated_at
+INSERT INTO operations (id, table_name, record_id, operation_type, device_id, payload, hlc, fields)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, table_name, record_id, operation_type, device_id, payload, created_at, updated_at, hlc, fields
 `
 
 type CreateOperationParams struct {
@@ -111,7 +154,10 @@ type CreateOperationParams struct {
 	TableName     string
 	RecordID      string
 	OperationType string
+	DeviceID      sql.NullString
 	Payload       string
+	Hlc           string
+	Fields        string
 }
 
 func (q *Queries) CreateOperation(ctx context.Context, arg CreateOperationParams) (Operation, error) {
@@ -120,7 +166,10 @@ func (q *Queries) CreateOperation(ctx context.Context, arg CreateOperationParams
 		arg.TableName,
 		arg.RecordID,
 		arg.OperationType,
+		arg.DeviceID,
 		arg.Payload,
+		arg.Hlc,
+		arg.Fields,
 	)
 	var i Operation
 	err := row.Scan(
@@ -132,6 +181,8 @@ func (q *Queries) CreateOperation(ctx context.Context, arg CreateOperationParams
 		&i.Payload,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Hlc,
+		&i.Fields,
 	)
 	return i, err
 }
@@ -139,7 +190,7 @@ func (q *Queries) CreateOperation(ctx context.Context, arg CreateOperationParams
 const createSettings = `-- name: CreateSettings :one
 INSERT INTO settings (id, transcription_method, whisper_binary_path, whisper_model_path, openai_api_key)
 VALUES (1, ?, ?, ?, ?)
-RETURNING id, transcription_method, whisper_binary_path, whisper_model_path, openai_api_key, created_at, updated_at
+RETURNING id, transcription_method, whisper_binary_path, whisper_model_path, openai_api_key, created_at, updated_at, sync_backend, sync_location, sync_access_key, sync_secret_key
 `
 
 type CreateSettingsParams struct {
@@ -165,14 +216,48 @@ func (q *Queries) CreateSettings(ctx context.Context, arg CreateSettingsParams)
 		&i.OpenaiApiKey,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SyncBackend,
+		&i.SyncLocation,
+		&i.SyncAccessKey,
+		&i.SyncSecretKey,
 	)
 	return i, err
 }
 
+const createSyncConflict = `-- name: CreateSyncConflict :exec
+INSERT INTO sync_conflicts (id, table_name, record_id, local_operation, remote_operation, winner, reason, fields)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type CreateSyncConflictParams struct {
+	ID              string
+	TableName       string
+	RecordID        string
+	LocalOperation  string
+	RemoteOperation string
+	Winner          string
+	Reason          string
+	Fields          string
+}
+
+func (q *Queries) CreateSyncConflict(ctx context.Context, arg CreateSyncConflictParams) error {
+	_, err := q.db.ExecContext(ctx, createSyncConflict,
+		arg.ID,
+		arg.TableName,
+		arg.RecordID,
+		arg.LocalOperation,
+		arg.RemoteOperation,
+		arg.Winner,
+		arg.Reason,
+		arg.Fields,
+	)
+	return err
+}
+
 const createTranscription = `-- name: CreateTranscription :one
 INSERT INTO transcriptions (id, board_id, transcription, recording_path, intent, assistant_response)
 VALUES (?, ?, ?, ?, ?, ?)
-RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at
+RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at
 `
 
 type CreateTranscriptionParams struct {
@@ -203,13 +288,15 @@ func (q *Queries) CreateTranscription(ctx context.Context, arg CreateTranscripti
 		&i.AssistantResponse,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const deleteBoard = `-- name: DeleteBoard :exec
-DELETE FROM boards
-WHERE id = ?
+UPDATE boards
+SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL
 `
 
 func (q *Queries) DeleteBoard(ctx context.Context, id string) error {
@@ -218,8 +305,9 @@ func (q *Queries) DeleteBoard(ctx context.Context, id string) error {
 }
 
 const deleteCard = `-- name: DeleteCard :exec
-DELETE FROM cards
-WHERE id = ?
+UPDATE cards
+SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL
 `
 
 func (q *Queries) DeleteCard(ctx context.Context, id string) error {
@@ -228,8 +316,9 @@ func (q *Queries) DeleteCard(ctx context.Context, id string) error {
 }
 
 const deleteColumn = `-- name: DeleteColumn :exec
-DELETE FROM columns
-WHERE id = ?
+UPDATE columns
+SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL
 `
 
 func (q *Queries) DeleteColumn(ctx context.Context, id string) error {
@@ -237,35 +326,86 @@ func (q *Queries) DeleteColumn(ctx context.Context, id string) error {
 	return err
 }
 
-const deleteTranscription = `-- name: DeleteTranscription :exec
-DELETE FROM transcriptions
+const deleteLanPeer = `-- name: DeleteLanPeer :exec
+DELETE FROM lan_peers
+WHERE device_id = ?
+`
+
+func (q *Queries) DeleteLanPeer(ctx context.Context, deviceID string) error {
+	_, err := q.db.ExecContext(ctx, deleteLanPeer, deviceID)
+	return err
+}
+
+const deleteParkedOperation = `-- name: DeleteParkedOperation :exec
+DELETE FROM parked_operations
 WHERE id = ?
 `
 
+func (q *Queries) DeleteParkedOperation(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteParkedOperation, id)
+	return err
+}
+
+const deleteParkedOperationsByRecord = `-- name: DeleteParkedOperationsByRecord :exec
+DELETE FROM parked_operations
+WHERE table_name = ? AND record_id = ?
+`
+
+type DeleteParkedOperationsByRecordParams struct {
+	TableName string
+	RecordID  string
+}
+
+func (q *Queries) DeleteParkedOperationsByRecord(ctx context.Context, arg DeleteParkedOperationsByRecordParams) error {
+	_, err := q.db.ExecContext(ctx, deleteParkedOperationsByRecord, arg.TableName, arg.RecordID)
+	return err
+}
+
+const deleteTranscription = `-- name: DeleteTranscription :exec
+UPDATE transcriptions
+SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL
+`
+
 func (q *Queries) DeleteTranscription(ctx context.Context, id string) error {
 	_, err := q.db.ExecContext(ctx, deleteTranscription, id)
 	return err
 }
 
+const getAcknowledgedOperationHLC = `-- name: GetAcknowledgedOperationHLC :one
+SELECT o.hlc
+FROM operations o
+JOIN sync_state ss ON ss.last_synced_op_id = o.id
+WHERE ss."table_name" = ?
+`
+
+func (q *Queries) GetAcknowledgedOperationHLC(ctx context.Context, tableName string) (string, error) {
+	row := q.db.QueryRowContext(ctx, getAcknowledgedOperationHLC, tableName)
+	var hlc string
+	err := row.Scan(&hlc)
+	return hlc, err
+}
+
 const getAllOperations = `-- name: GetAllOperations :many
 
-SELECT o.id, o.table_name, o.record_id, o.operation_type, o.device_id, o.payload, o.created_at, o.updated_at
+SELECT o.id, o.table_name, o.record_id, o.operation_type, o.device_id, o.payload, o.created_at, o.updated_at, o.hlc, o.fields
 FROM operations AS o
 JOIN (
-    SELECT inner_op.record_id, MAX(inner_op.created_at) AS max_created_at
+    SELECT inner_op.record_id, MAX(inner_op.hlc) AS max_hlc
     FROM operations AS inner_op
-    WHERE CAST(strftime('%s', inner_op.created_at) AS INTEGER) > COALESCE((
-        SELECT last_synced_at
+    WHERE inner_op.hlc > COALESCE((
+        SELECT acked.hlc
         FROM sync_state
+        JOIN operations AS acked ON acked.id = sync_state.last_synced_op_id
         WHERE sync_state.table_name = ?
-    ), 0)
+    ), '')
     AND inner_op.table_name = ?
     GROUP BY inner_op.record_id
 ) latest
 ON o.record_id = latest.record_id
-AND o.created_at = latest.max_created_at
+AND o.hlc = latest.max_hlc
 AND o.table_name = ?
-ORDER BY o.created_at ASC
+ORDER BY o.hlc ASC
 `
 
 type GetAllOperationsParams struct {
@@ -297,6 +437,8 @@ func (q *Queries) GetAllOperations(ctx context.Context, arg GetAllOperationsPara
 			&i.Payload,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Hlc,
+			&i.Fields,
 		); err != nil {
 			return nil, err
 		}
@@ -325,8 +467,8 @@ func (q *Queries) GetAppMeta(ctx context.Context, key string) (sql.NullString, e
 
 const getBoard = `-- name: GetBoard :one
 
-SELECT id, name, created_at, updated_at FROM boards
-WHERE id = ?
+SELECT id, name, created_at, updated_at, deleted_at, archived_at FROM boards
+WHERE id = ? AND deleted_at IS NULL
 LIMIT 1
 `
 
@@ -339,14 +481,37 @@ func (q *Queries) GetBoard(ctx context.Context, id string) (Board, error) {
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.ArchivedAt,
+	)
+	return i, err
+}
+
+const getBoardWithTrashed = `-- name: GetBoardWithTrashed :one
+SELECT id, name, created_at, updated_at, deleted_at, archived_at FROM boards
+WHERE id = ?
+LIMIT 1
+`
+
+// sync and restore work on records in the trash too, the Get queries above skip them
+func (q *Queries) GetBoardWithTrashed(ctx context.Context, id string) (Board, error) {
+	row := q.db.QueryRowContext(ctx, getBoardWithTrashed, id)
+	var i Board
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.ArchivedAt,
 	)
 	return i, err
 }
 
 const getCard = `-- name: GetCard :one
 
-SELECT id, column_id, title, description, attachments, created_at, updated_at FROM cards
-WHERE id = ?
+SELECT id, column_id, title, description, attachments, created_at, updated_at, deleted_at FROM cards
+WHERE id = ? AND deleted_at IS NULL
 LIMIT 1
 `
 
@@ -362,14 +527,37 @@ func (q *Queries) GetCard(ctx context.Context, id string) (Card, error) {
 		&i.Attachments,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getCardWithTrashed = `-- name: GetCardWithTrashed :one
+SELECT id, column_id, title, description, attachments, created_at, updated_at, deleted_at FROM cards
+WHERE id = ?
+LIMIT 1
+`
+
+func (q *Queries) GetCardWithTrashed(ctx context.Context, id string) (Card, error) {
+	row := q.db.QueryRowContext(ctx, getCardWithTrashed, id)
+	var i Card
+	err := row.Scan(
+		&i.ID,
+		&i.ColumnID,
+		&i.Title,
+		&i.Description,
+		&i.Attachments,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getColumn = `-- name: GetColumn :one
 
-SELECT id, board_id, name, position, created_at, updated_at FROM columns
-WHERE id = ?
+SELECT id, board_id, name, position, created_at, updated_at, deleted_at FROM columns
+WHERE id = ? AND deleted_at IS NULL
 LIMIT 1
 `
 
@@ -384,13 +572,148 @@ func (q *Queries) GetColumn(ctx context.Context, id string) (Column, error) {
 		&i.Position,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getColumnWithTrashed = `-- name: GetColumnWithTrashed :one
+SELECT id, board_id, name, position, created_at, updated_at, deleted_at FROM columns
+WHERE id = ?
+LIMIT 1
+`
+
+func (q *Queries) GetColumnWithTrashed(ctx context.Context, id string) (Column, error) {
+	row := q.db.QueryRowContext(ctx, getColumnWithTrashed, id)
+	var i Column
+	err := row.Scan(
+		&i.ID,
+		&i.BoardID,
+		&i.Name,
+		&i.Position,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const getFieldClocks = `-- name: GetFieldClocks :many
+SELECT table_name, record_id, field, hlc, value FROM field_clocks
+WHERE table_name = ? AND record_id = ?
+`
+
+type GetFieldClocksParams struct {
+	TableName string
+	RecordID  string
+}
+
+func (q *Queries) GetFieldClocks(ctx context.Context, arg GetFieldClocksParams) ([]FieldClock, error) {
+	rows, err := q.db.QueryContext(ctx, getFieldClocks, arg.TableName, arg.RecordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FieldClock
+	for rows.Next() {
+		var i FieldClock
+		if err := rows.Scan(
+			&i.TableName,
+			&i.RecordID,
+			&i.Field,
+			&i.Hlc,
+			&i.Value,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLanPeer = `-- name: GetLanPeer :one
+SELECT device_id, name, token, paired_at FROM lan_peers
+WHERE device_id = ?
+`
+
+func (q *Queries) GetLanPeer(ctx context.Context, deviceID string) (LanPeer, error) {
+	row := q.db.QueryRowContext(ctx, getLanPeer, deviceID)
+	var i LanPeer
+	err := row.Scan(
+		&i.DeviceID,
+		&i.Name,
+		&i.Token,
+		&i.PairedAt,
+	)
+	return i, err
+}
+
+const getLatestOperationHLC = `-- name: GetLatestOperationHLC :one
+SELECT CAST(COALESCE(MAX(hlc), '') AS TEXT) AS hlc
+FROM operations
+`
+
+func (q *Queries) GetLatestOperationHLC(ctx context.Context) (string, error) {
+	row := q.db.QueryRowContext(ctx, getLatestOperationHLC)
+	var hlc string
+	err := row.Scan(&hlc)
+	return hlc, err
+}
+
+const getPendingOperationFields = `-- name: GetPendingOperationFields :many
+SELECT record_id, fields
+FROM operations
+WHERE hlc > COALESCE((
+    SELECT acked.hlc
+    FROM sync_state
+    JOIN operations AS acked ON acked.id = sync_state.last_synced_op_id
+    WHERE sync_state.table_name = ?
+), '')
+AND table_name = ?
+`
+
+type GetPendingOperationFieldsParams struct {
+	TableName   string
+	TableName_2 string
+}
+
+type GetPendingOperationFieldsRow struct {
+	RecordID string
+	Fields   string
+}
+
+func (q *Queries) GetPendingOperationFields(ctx context.Context, arg GetPendingOperationFieldsParams) ([]GetPendingOperationFieldsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPendingOperationFields, arg.TableName, arg.TableName_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPendingOperationFieldsRow
+	for rows.Next() {
+		var i GetPendingOperationFieldsRow
+		if err := rows.Scan(&i.RecordID, &i.Fields); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSettings = `-- name: GetSettings :one
 
-SELECT id, transcription_method, whisper_binary_path, whisper_model_path, openai_api_key, created_at, updated_at FROM settings
+SELECT id, transcription_method, whisper_binary_path, whisper_model_path, openai_api_key, created_at, updated_at, sync_backend, sync_location, sync_access_key, sync_secret_key FROM settings
 WHERE id = 1
 LIMIT 1
 `
@@ -407,6 +730,33 @@ func (q *Queries) GetSettings(ctx context.Context) (Setting, error) {
 		&i.OpenaiApiKey,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SyncBackend,
+		&i.SyncLocation,
+		&i.SyncAccessKey,
+		&i.SyncSecretKey,
+	)
+	return i, err
+}
+
+const getSyncConflict = `-- name: GetSyncConflict :one
+SELECT id, table_name, record_id, local_operation, remote_operation, winner, reason, fields, created_at, resolved_at FROM sync_conflicts
+WHERE id = ?
+`
+
+func (q *Queries) GetSyncConflict(ctx context.Context, id string) (SyncConflict, error) {
+	row := q.db.QueryRowContext(ctx, getSyncConflict, id)
+	var i SyncConflict
+	err := row.Scan(
+		&i.ID,
+		&i.TableName,
+		&i.RecordID,
+		&i.LocalOperation,
+		&i.RemoteOperation,
+		&i.Winner,
+		&i.Reason,
+		&i.Fields,
+		&i.CreatedAt,
+		&i.ResolvedAt,
 	)
 	return i, err
 }
@@ -427,7 +777,7 @@ func (q *Queries) GetSyncState(ctx context.Context, tableName string) (SyncState
 
 const getTranscription = `-- name: GetTranscription :one
 
-SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at FROM transcriptions
+SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at FROM transcriptions
 WHERE id = ?
 LIMIT 1
 `
@@ -445,12 +795,13 @@ func (q *Queries) GetTranscription(ctx context.Context, id string) (Transcriptio
 		&i.AssistantResponse,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getTranscriptionByRecordingPath = `-- name: GetTranscriptionByRecordingPath :one
-SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at FROM transcriptions
+SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at FROM transcriptions
 where recording_path = ? AND board_id = ?
 `
 
@@ -471,6 +822,7 @@ func (q *Queries) GetTranscriptionByRecordingPath(ctx context.Context, arg GetTr
 		&i.AssistantResponse,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -481,8 +833,9 @@ INSERT INTO boards (id, name, created_at, updated_at)
 VALUES (?, ?, ?, ?)
 ON CONFLICT(id) DO UPDATE SET
     name = excluded.name,
-    updated_at = excluded.updated_at
-RETURNING id, name, created_at, updated_at
+    updated_at = excluded.updated_at,
+    archived_at = NULL
+RETURNING id, name, created_at, updated_at, deleted_at, archived_at
 `
 
 type ImportBoardParams struct {
@@ -506,6 +859,8 @@ func (q *Queries) ImportBoard(ctx context.Context, arg ImportBoardParams) (Board
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.ArchivedAt,
 	)
 	return i, err
 }
@@ -519,7 +874,7 @@ ON CONFLICT(id) DO UPDATE SET
     description = excluded.description,
     attachments = excluded.attachments,
     updated_at = excluded.updated_at
-RETURNING id, column_id, title, description, attachments, created_at, updated_at
+RETURNING id, column_id, title, description, attachments, created_at, updated_at, deleted_at
 `
 
 type ImportCardParams struct {
@@ -551,6 +906,7 @@ func (q *Queries) ImportCard(ctx context.Context, arg ImportCardParams) (Card, e
 		&i.Attachments,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -563,7 +919,7 @@ ON CONFLICT(id) DO UPDATE SET
     name = excluded.name,
     position = excluded.position,
     updated_at = excluded.updated_at
-RETURNING id, board_id, name, position, created_at, updated_at
+RETURNING id, board_id, name, position, created_at, updated_at, deleted_at
 `
 
 type ImportColumnParams struct {
@@ -592,6 +948,7 @@ func (q *Queries) ImportColumn(ctx context.Context, arg ImportColumnParams) (Col
 		&i.Position,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -606,7 +963,7 @@ ON CONFLICT(id) DO UPDATE SET
     intent = excluded.intent,
     assistant_response = excluded.assistant_response,
     updated_at = excluded.updated_at
-RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at
+RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at
 `
 
 type ImportTranscriptionParams struct {
@@ -641,12 +998,14 @@ func (q *Queries) ImportTranscription(ctx context.Context, arg ImportTranscripti
 		&i.AssistantResponse,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const listAllCards = `-- name: ListAllCards :many
-SELECT id, column_id, title, description, attachments, created_at, updated_at FROM cards
+SELECT id, column_id, title, description, attachments, created_at, updated_at, deleted_at FROM cards
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -667,6 +1026,7 @@ func (q *Queries) ListAllCards(ctx context.Context) ([]Card, error) {
 			&i.Attachments,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -683,7 +1043,8 @@ func (q *Queries) ListAllCards(ctx context.Context) ([]Card, error) {
 
 const listAllColumns = `-- name: ListAllColumns :many
 
-SELECT id, board_id, name, position, created_at, updated_at FROM columns
+SELECT id, board_id, name, position, created_at, updated_at, deleted_at FROM columns
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -704,6 +1065,7 @@ func (q *Queries) ListAllColumns(ctx context.Context) ([]Column, error) {
 			&i.Position,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -719,7 +1081,8 @@ func (q *Queries) ListAllColumns(ctx context.Context) ([]Column, error) {
 }
 
 const listAllTranscriptions = `-- name: ListAllTranscriptions :many
-SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at FROM transcriptions
+SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at FROM transcriptions
+WHERE deleted_at IS NULL
 ORDER BY created_at DESC
 LIMIT ? OFFSET ?
 `
@@ -747,6 +1110,7 @@ func (q *Queries) ListAllTranscriptions(ctx context.Context, arg ListAllTranscri
 			&i.AssistantResponse,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -761,8 +1125,37 @@ func (q *Queries) ListAllTranscriptions(ctx context.Context, arg ListAllTranscri
 	return items, nil
 }
 
+const listArchivedBoardIDs = `-- name: ListArchivedBoardIDs :many
+SELECT id FROM boards
+WHERE archived_at IS NOT NULL
+`
+
+func (q *Queries) ListArchivedBoardIDs(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listArchivedBoardIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listBoards = `-- name: ListBoards :many
-SELECT id, name, created_at, updated_at FROM boards
+SELECT id, name, created_at, updated_at, deleted_at, archived_at FROM boards
+WHERE deleted_at IS NULL AND archived_at IS NULL
 ORDER BY created_at ASC
 LIMIT ? OFFSET ?
 `
@@ -786,6 +1179,8 @@ func (q *Queries) ListBoards(ctx context.Context, arg ListBoardsParams) ([]Board
 			&i.Name,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.ArchivedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -801,8 +1196,8 @@ func (q *Queries) ListBoards(ctx context.Context, arg ListBoardsParams) ([]Board
 }
 
 const listCardsByColumn = `-- name: ListCardsByColumn :many
-SELECT id, column_id, title, description, attachments, created_at, updated_at FROM cards
-WHERE column_id = ?
+SELECT id, column_id, title, description, attachments, created_at, updated_at, deleted_at FROM cards
+WHERE column_id = ? AND deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -823,6 +1218,7 @@ func (q *Queries) ListCardsByColumn(ctx context.Context, columnID string) ([]Car
 			&i.Attachments,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -838,8 +1234,8 @@ func (q *Queries) ListCardsByColumn(ctx context.Context, columnID string) ([]Car
 }
 
 const listColumnsByBoard = `-- name: ListColumnsByBoard :many
-SELECT id, board_id, name, position, created_at, updated_at FROM columns
-WHERE board_id = ?
+SELECT id, board_id, name, position, created_at, updated_at, deleted_at FROM columns
+WHERE board_id = ? AND deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -859,6 +1255,161 @@ func (q *Queries) ListColumnsByBoard(ctx context.Context, boardID string) ([]Col
 			&i.Position,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLanPeers = `-- name: ListLanPeers :many
+SELECT device_id, name, token, paired_at FROM lan_peers
+ORDER BY paired_at ASC
+`
+
+func (q *Queries) ListLanPeers(ctx context.Context) ([]LanPeer, error) {
+	rows, err := q.db.QueryContext(ctx, listLanPeers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LanPeer
+	for rows.Next() {
+		var i LanPeer
+		if err := rows.Scan(
+			&i.DeviceID,
+			&i.Name,
+			&i.Token,
+			&i.PairedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listParkedOperations = `-- name: ListParkedOperations :many
+SELECT id, table_name, record_id, operation, attempts, last_error, parked_at FROM parked_operations
+ORDER BY parked_at ASC
+`
+
+func (q *Queries) ListParkedOperations(ctx context.Context) ([]ParkedOperation, error) {
+	rows, err := q.db.QueryContext(ctx, listParkedOperations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ParkedOperation
+	for rows.Next() {
+		var i ParkedOperation
+		if err := rows.Scan(
+			&i.ID,
+			&i.TableName,
+			&i.RecordID,
+			&i.Operation,
+			&i.Attempts,
+			&i.LastError,
+			&i.ParkedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSyncConflicts = `-- name: ListSyncConflicts :many
+SELECT id, table_name, record_id, local_operation, remote_operation, winner, reason, fields, created_at, resolved_at FROM sync_conflicts
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListSyncConflicts(ctx context.Context) ([]SyncConflict, error) {
+	rows, err := q.db.QueryContext(ctx, listSyncConflicts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SyncConflict
+	for rows.Next() {
+		var i SyncConflict
+		if err := rows.Scan(
+			&i.ID,
+			&i.TableName,
+			&i.RecordID,
+			&i.LocalOperation,
+			&i.RemoteOperation,
+			&i.Winner,
+			&i.Reason,
+			&i.Fields,
+			&i.CreatedAt,
+			&i.ResolvedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrash = `-- name: ListTrash :many
+SELECT 'boards' AS table_name, id, name AS title, deleted_at FROM boards WHERE deleted_at IS NOT NULL
+UNION ALL
+SELECT 'columns' AS table_name, id, name AS title, deleted_at FROM columns WHERE deleted_at IS NOT NULL
+UNION ALL
+SELECT 'cards' AS table_name, id, title, deleted_at FROM cards WHERE deleted_at IS NOT NULL
+UNION ALL
+SELECT 'transcriptions' AS table_name, id, transcription AS title, deleted_at FROM transcriptions WHERE deleted_at IS NOT NULL
+ORDER BY deleted_at DESC
+`
+
+type ListTrashRow struct {
+	TableName string
+	ID        string
+	Title     string
+	DeletedAt sql.NullString
+}
+
+func (q *Queries) ListTrash(ctx context.Context) ([]ListTrashRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTrash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTrashRow
+	for rows.Next() {
+		var i ListTrashRow
+		if err := rows.Scan(
+			&i.TableName,
+			&i.ID,
+			&i.Title,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -874,8 +1425,8 @@ func (q *Queries) ListColumnsByBoard(ctx context.Context, boardID string) ([]Col
 }
 
 const listTranscriptionsByBoard = `-- name: ListTranscriptionsByBoard :many
-SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at FROM transcriptions
-WHERE board_id = ?
+SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at FROM transcriptions
+WHERE board_id = ? AND deleted_at IS NULL
 ORDER BY created_at DESC
 `
 
@@ -897,6 +1448,7 @@ func (q *Queries) ListTranscriptionsByBoard(ctx context.Context, boardID string)
 			&i.AssistantResponse,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -911,11 +1463,170 @@ func (q *Queries) ListTranscriptionsByBoard(ctx context.Context, boardID string)
 	return items, nil
 }
 
+const parkOperation = `-- name: ParkOperation :exec
+INSERT INTO parked_operations (id, table_name, record_id, operation, last_error)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET
+    attempts = parked_operations.attempts + 1,
+    last_error = excluded.last_error
+`
+
+type ParkOperationParams struct {
+	ID        string
+	TableName string
+	RecordID  string
+	Operation string
+	LastError string
+}
+
+func (q *Queries) ParkOperation(ctx context.Context, arg ParkOperationParams) error {
+	_, err := q.db.ExecContext(ctx, parkOperation,
+		arg.ID,
+		arg.TableName,
+		arg.RecordID,
+		arg.Operation,
+		arg.LastError,
+	)
+	return err
+}
+
+const purgeBoards = `-- name: PurgeBoards :execrows
+DELETE FROM boards
+WHERE deleted_at < ?
+`
+
+func (q *Queries) PurgeBoards(ctx context.Context, deletedAt sql.NullString) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeBoards, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const purgeCards = `-- name: PurgeCards :execrows
+DELETE FROM cards
+WHERE deleted_at < ?
+   OR column_id IN (
+       SELECT c.id FROM columns c
+       WHERE c.deleted_at < ?
+          OR c.board_id IN (SELECT b.id FROM boards b WHERE b.deleted_at < ?)
+   )
+`
+
+type PurgeCardsParams struct {
+	DeletedAt   sql.NullString
+	DeletedAt_2 sql.NullString
+	DeletedAt_3 sql.NullString
+}
+
+// records inside a board or column being purged go with it, the cascades aren't enforced here
+func (q *Queries) PurgeCards(ctx context.Context, arg PurgeCardsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeCards, arg.DeletedAt, arg.DeletedAt_2, arg.DeletedAt_3)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const purgeColumns = `-- name: PurgeColumns :execrows
+DELETE FROM columns
+WHERE deleted_at < ?
+   OR board_id IN (SELECT b.id FROM boards b WHERE b.deleted_at < ?)
+`
+
+type PurgeColumnsParams struct {
+	DeletedAt   sql.NullString
+	DeletedAt_2 sql.NullString
+}
+
+func (q *Queries) PurgeColumns(ctx context.Context, arg PurgeColumnsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeColumns, arg.DeletedAt, arg.DeletedAt_2)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const purgeTranscriptions = `-- name: PurgeTranscriptions :execrows
+DELETE FROM transcriptions
+WHERE deleted_at < ?
+   OR board_id IN (SELECT b.id FROM boards b WHERE b.deleted_at < ?)
+`
+
+type PurgeTranscriptionsParams struct {
+	DeletedAt   sql.NullString
+	DeletedAt_2 sql.NullString
+}
+
+func (q *Queries) PurgeTranscriptions(ctx context.Context, arg PurgeTranscriptionsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeTranscriptions, arg.DeletedAt, arg.DeletedAt_2)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const resolveSyncConflict = `-- name: ResolveSyncConflict :exec
+UPDATE sync_conflicts
+SET resolved_at = datetime('now')
+WHERE id = ?
+`
+
+func (q *Queries) ResolveSyncConflict(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, resolveSyncConflict, id)
+	return err
+}
+
+const restoreBoard = `-- name: RestoreBoard :exec
+UPDATE boards
+SET deleted_at = NULL
+WHERE id = ?
+`
+
+func (q *Queries) RestoreBoard(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, restoreBoard, id)
+	return err
+}
+
+const restoreCard = `-- name: RestoreCard :exec
+UPDATE cards
+SET deleted_at = NULL
+WHERE id = ?
+`
+
+func (q *Queries) RestoreCard(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, restoreCard, id)
+	return err
+}
+
+const restoreColumn = `-- name: RestoreColumn :exec
+UPDATE columns
+SET deleted_at = NULL
+WHERE id = ?
+`
+
+func (q *Queries) RestoreColumn(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, restoreColumn, id)
+	return err
+}
+
+const restoreTranscription = `-- name: RestoreTranscription :exec
+UPDATE transcriptions
+SET deleted_at = NULL
+WHERE id = ?
+`
+
+func (q *Queries) RestoreTranscription(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, restoreTranscription, id)
+	return err
+}
+
 const searchColumnsByBoardAndName = `-- name: SearchColumnsByBoardAndName :many
-SELECT id, board_id, name, position, created_at, updated_at
+SELECT id, board_id, name, position, created_at, updated_at, deleted_at
 FROM "columns"
 WHERE board_id = ?
   AND name LIKE '%' || ? || '%' COLLATE NOCASE
+  AND deleted_at IS NULL
 `
 
 type SearchColumnsByBoardAndNameParams struct {
@@ -939,6 +1650,7 @@ func (q *Queries) SearchColumnsByBoardAndName(ctx context.Context, arg SearchCol
 			&i.Position,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -958,7 +1670,7 @@ UPDATE boards
 SET name = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, name, created_at, updated_at
+RETURNING id, name, created_at, updated_at, deleted_at, archived_at
 `
 
 type UpdateBoardParams struct {
@@ -974,6 +1686,8 @@ func (q *Queries) UpdateBoard(ctx context.Context, arg UpdateBoardParams) (Board
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.ArchivedAt,
 	)
 	return i, err
 }
@@ -985,7 +1699,7 @@ SET title = ?,
     attachments = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, column_id, title, description, attachments, created_at, updated_at
+RETURNING id, column_id, title, description, attachments, created_at, updated_at, deleted_at
 `
 
 type UpdateCardParams struct {
@@ -1011,6 +1725,7 @@ func (q *Queries) UpdateCard(ctx context.Context, arg UpdateCardParams) (Card, e
 		&i.Attachments,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -1019,7 +1734,7 @@ const updateCardColumn = `-- name: UpdateCardColumn :one
 UPDATE cards
 SET column_id = ?
 WHERE id = ?
-RETURNING id, column_id, title, description, attachments, created_at, updated_at
+RETURNING id, column_id, title, description, attachments, created_at, updated_at, deleted_at
 `
 
 type UpdateCardColumnParams struct {
@@ -1038,6 +1753,7 @@ func (q *Queries) UpdateCardColumn(ctx context.Context, arg UpdateCardColumnPara
 		&i.Attachments,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -1047,7 +1763,7 @@ UPDATE columns
 SET "name" = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, board_id, name, position, created_at, updated_at
+RETURNING id, board_id, name, position, created_at, updated_at, deleted_at
 `
 
 type UpdateColumnParams struct {
@@ -1065,6 +1781,7 @@ func (q *Queries) UpdateColumn(ctx context.Context, arg UpdateColumnParams) (Col
 		&i.Position,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -1077,7 +1794,7 @@ SET transcription_method = ?,
     openai_api_key = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = 1
-RETURNING id, transcription_method, whisper_binary_path, whisper_model_path, openai_api_key, created_at, updated_at
+RETURNING id, transcription_method, whisper_binary_path, whisper_model_path, openai_api_key, created_at, updated_at, sync_backend, sync_location, sync_access_key, sync_secret_key
 `
 
 type UpdateSettingsParams struct {
@@ -1103,6 +1820,53 @@ func (q *Queries) UpdateSettings(ctx context.Context, arg UpdateSettingsParams)
 		&i.OpenaiApiKey,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SyncBackend,
+		&i.SyncLocation,
+		&i.SyncAccessKey,
+		&i.SyncSecretKey,
+	)
+	return i, err
+}
+
+const updateSyncBackend = `-- name: UpdateSyncBackend :one
+INSERT INTO settings (id, sync_backend, sync_location, sync_access_key, sync_secret_key)
+VALUES (1, ?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE
+SET sync_backend = excluded.sync_backend,
+    sync_location = excluded.sync_location,
+    sync_access_key = excluded.sync_access_key,
+    sync_secret_key = excluded.sync_secret_key,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING id, transcription_method, whisper_binary_path, whisper_model_path, openai_api_key, created_at, updated_at, sync_backend, sync_location, sync_access_key, sync_secret_key
+`
+
+type UpdateSyncBackendParams struct {
+	SyncBackend   string
+	SyncLocation  sql.NullString
+	SyncAccessKey sql.NullString
+	SyncSecretKey sql.NullString
+}
+
+func (q *Queries) UpdateSyncBackend(ctx context.Context, arg UpdateSyncBackendParams) (Setting, error) {
+	row := q.db.QueryRowContext(ctx, updateSyncBackend,
+		arg.SyncBackend,
+		arg.SyncLocation,
+		arg.SyncAccessKey,
+		arg.SyncSecretKey,
+	)
+	var i Setting
+	err := row.Scan(
+		&i.ID,
+		&i.TranscriptionMethod,
+		&i.WhisperBinaryPath,
+		&i.WhisperModelPath,
+		&i.OpenaiApiKey,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SyncBackend,
+		&i.SyncLocation,
+		&i.SyncAccessKey,
+		&i.SyncSecretKey,
 	)
 	return i, err
 }
@@ -1129,7 +1893,7 @@ UPDATE transcriptions
 SET intent = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at
+RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at
 `
 
 type UpdateTranscriptionIntentParams struct {
@@ -1149,6 +1913,7 @@ func (q *Queries) UpdateTranscriptionIntent(ctx context.Context, arg UpdateTrans
 		&i.AssistantResponse,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -1158,7 +1923,7 @@ UPDATE transcriptions
 SET assistant_response = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at
+RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at
 `
 
 type UpdateTranscriptionResponseParams struct {
@@ -1178,6 +1943,7 @@ func (q *Queries) UpdateTranscriptionResponse(ctx context.Context, arg UpdateTra
 		&i.AssistantResponse,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -1199,6 +1965,54 @@ func (q *Queries) UpsertAppMeta(ctx context.Context, arg UpsertAppMetaParams) er
 	return err
 }
 
+const upsertFieldClock = `-- name: UpsertFieldClock :exec
+INSERT INTO field_clocks (table_name, record_id, field, hlc, value)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(table_name, record_id, field) DO UPDATE SET
+    hlc = excluded.hlc,
+    value = excluded.value
+WHERE excluded.hlc >= field_clocks.hlc
+`
+
+type UpsertFieldClockParams struct {
+	TableName string
+	RecordID  string
+	Field     string
+	Hlc       string
+	Value     string
+}
+
+func (q *Queries) UpsertFieldClock(ctx context.Context, arg UpsertFieldClockParams) error {
+	_, err := q.db.ExecContext(ctx, upsertFieldClock,
+		arg.TableName,
+		arg.RecordID,
+		arg.Field,
+		arg.Hlc,
+		arg.Value,
+	)
+	return err
+}
+
+const upsertLanPeer = `-- name: UpsertLanPeer :exec
+INSERT INTO lan_peers (device_id, name, token)
+VALUES (?, ?, ?)
+ON CONFLICT(device_id) DO UPDATE SET
+    name = excluded.name,
+    token = excluded.token,
+    paired_at = CURRENT_TIMESTAMP
+`
+
+type UpsertLanPeerParams struct {
+	DeviceID string
+	Name     string
+	Token    string
+}
+
+func (q *Queries) UpsertLanPeer(ctx context.Context, arg UpsertLanPeerParams) error {
+	_, err := q.db.ExecContext(ctx, upsertLanPeer, arg.DeviceID, arg.Name, arg.Token)
+	return err
+}
+
 const upsertSyncState = `-- name: UpsertSyncState :exec
 INSERT INTO sync_state (table_name, last_synced_at, last_synced_op_id)
 VALUES (?, ?, ?)
@@ -3,7 +3,9 @@ CREATE TABLE IF NOT EXISTS boards (
     id TEXT PRIMARY KEY,
     name TEXT NOT NULL,
     created_at TEXT DEFAULT (datetime('now')),
-    updated_at TEXT DEFAULT (datetime('now'))
+    updated_at TEXT DEFAULT (datetime('now')),
+    deleted_at TEXT, -- tombstone, set while the board sits in the trash
+    archived_at TEXT -- set once the account lost access to a shared board, it stays on disk but stops syncing
 );
 
 -- 2. Column Table
@@ -14,6 +16,7 @@ CREATE TABLE IF NOT EXISTS "columns" (
     position INTEGER NOT NULL,
     created_at TEXT DEFAULT (datetime('now')),
     updated_at TEXT DEFAULT (datetime('now')),
+    deleted_at TEXT,
     FOREIGN KEY (board_id) REFERENCES boards(id) ON DELETE CASCADE
 );
 
@@ -43,6 +46,7 @@ CREATE TABLE IF NOT EXISTS transcriptions (
     assistant_response TEXT,
     created_at TEXT DEFAULT (datetime('now')),
     updated_at TEXT DEFAULT (datetime('now')),
+    deleted_at TEXT,
     FOREIGN KEY (board_id) REFERENCES boards(id) ON DELETE CASCADE
 );
 
@@ -54,7 +58,11 @@ CREATE TABLE IF NOT EXISTS settings (
     whisper_model_path TEXT,
     openai_api_key TEXT,
     created_at TEXT DEFAULT (datetime('now')),
-    updated_at TEXT DEFAULT (datetime('now'))
+    updated_at TEXT DEFAULT (datetime('now')),
+    sync_backend TEXT NOT NULL DEFAULT 'cloud', -- 'cloud', 'folder', 's3'
+    sync_location TEXT, -- the shared folder, or the bucket url of an s3 compatible storage
+    sync_access_key TEXT,
+    sync_secret_key TEXT
 );
 
 DROP TABLE tickets;
@@ -68,6 +76,7 @@ CREATE TABLE IF NOT EXISTS cards (
     attachments TEXT,
     created_at TEXT DEFAULT (datetime('now')),
     updated_at TEXT DEFAULT (datetime('now')),
+    deleted_at TEXT,
     FOREIGN KEY (column_id) REFERENCES columns(id) ON DELETE CASCADE
 );
 
@@ -104,10 +113,55 @@ CREATE TABLE IF NOT EXISTS operations (
   "table_name" TEXT NOT NULL,
   record_id TEXT NOT NULL,
   operation_type TEXT NOT NULL,
-  device_id TEXT, -- not really useful for single user
+  device_id TEXT, -- the install that made the op, the cloud never pulls a device its own ops back
   payload TEXT NOT NULL,
   created_at TEXT DEFAULT CURRENT_TIMESTAMP,
-  updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+  updated_at TEXT DEFAULT CURRENT_TIMESTAMP,
+  hlc TEXT NOT NULL DEFAULT '', -- hybrid logical clock, wall_ms:counter:device_id
+  fields TEXT NOT NULL DEFAULT '' -- json array of the fields the op changed, empty means every field
+);
+
+-- the hlc and value of the last op that wrote each field of a record
+CREATE TABLE IF NOT EXISTS field_clocks (
+  "table_name" TEXT NOT NULL,
+  record_id TEXT NOT NULL,
+  field TEXT NOT NULL,
+  hlc TEXT NOT NULL,
+  value TEXT NOT NULL,
+  PRIMARY KEY ("table_name", record_id, field)
+);
+
+-- pulled ops whose parent record hasn't arrived yet, retried on every sync pass
+CREATE TABLE IF NOT EXISTS parked_operations (
+  id TEXT PRIMARY KEY,
+  "table_name" TEXT NOT NULL,
+  record_id TEXT NOT NULL,
+  operation TEXT NOT NULL, -- the op as it was pulled, json
+  attempts INTEGER NOT NULL DEFAULT 1,
+  last_error TEXT NOT NULL DEFAULT '',
+  parked_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+-- records both this device and the cloud changed, with the version sync kept and the one it threw away
+CREATE TABLE IF NOT EXISTS sync_conflicts (
+  id TEXT PRIMARY KEY,
+  "table_name" TEXT NOT NULL,
+  record_id TEXT NOT NULL,
+  local_operation TEXT NOT NULL, -- the local op, json
+  remote_operation TEXT NOT NULL, -- the cloud op, json
+  winner TEXT NOT NULL, -- 'local' or 'remote'
+  reason TEXT NOT NULL,
+  fields TEXT NOT NULL DEFAULT '', -- json array of the contested fields, empty means the whole record
+  created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+  resolved_at TEXT -- set once the losing version has been re-applied
+);
+
+-- devices on the local network that paired with this one to sync through it, token signs their requests
+CREATE TABLE IF NOT EXISTS lan_peers (
+  device_id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  token TEXT NOT NULL,
+  paired_at TEXT DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE IF NOT EXISTS sync_state (
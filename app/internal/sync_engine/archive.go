@@ -0,0 +1,50 @@
+package sync_engine
+
+import (
+	"fmt"
+	"seisami/app/internal/cloud"
+	"seisami/app/types"
+)
+
+// a board the account was removed from or left is archived, it stays on disk but leaves the board list and its ops
+// aren't pushed anymore. importing it again after a new invite brings it back
+
+// ArchiveBoard stops syncing boardID and hides its local copy, a board archived already is left as it is
+func (s *SyncEngine) ArchiveBoard(boardID string) error {
+	// the cloud tells a device about every board it lost each time it connects
+	if archived, err := s.repo.ArchivedBoardIDs(); err == nil && archived[boardID] {
+		return nil
+	}
+
+	if err := s.repo.ArchiveBoard(boardID); err != nil {
+		errMsg := fmt.Sprintf("failed to archive board: %v", err)
+		s.emitError("board:archive_error", errMsg)
+		return fmt.Errorf("%s", errMsg)
+	}
+
+	s.emitSuccess("board:archived", map[string]string{"boardId": boardID})
+	return nil
+}
+
+// withoutArchivedBoards leaves out the ops of archived boards, an op whose board is unknown is left to the cloud
+func (s *SyncEngine) withoutArchivedBoards(tableName types.TableName, ops []types.OperationSync) []types.OperationSync {
+	archived, err := s.repo.ArchivedBoardIDs()
+	if err != nil {
+		fmt.Printf("unable to list archived boards: %v\n", err)
+		return ops
+	}
+	if len(archived) == 0 {
+		return ops
+	}
+
+	kept := ops[:0:0]
+	for _, op := range ops {
+		boardID, err := cloud.BoardOf(s.repo, tableName, op)
+		if err == nil && archived[boardID] {
+			continue
+		}
+		kept = append(kept, op)
+	}
+
+	return kept
+}
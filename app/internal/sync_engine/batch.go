@@ -0,0 +1,234 @@
+package sync_engine
+
+import (
+	"errors"
+	"fmt"
+	"seisami/app/types"
+	"sort"
+)
+
+// BatchConfig controls how many operations travel in one request to /sync/batch
+type BatchConfig struct {
+	PushChunkSize int
+	PullChunkSize int
+}
+
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		PushChunkSize: 200,
+		PullChunkSize: 500,
+	}
+}
+
+// SetBatchConfig overrides the chunk sizes, anything <= 0 keeps the default
+func (s *SyncEngine) SetBatchConfig(cfg BatchConfig) {
+	defaults := DefaultBatchConfig()
+	if cfg.PushChunkSize <= 0 {
+		cfg.PushChunkSize = defaults.PushChunkSize
+	}
+	if cfg.PullChunkSize <= 0 {
+		cfg.PullChunkSize = defaults.PullChunkSize
+	}
+
+	s.batch = cfg
+}
+
+// recordsPerPull keeps the record ids of one pull well below the url length proxies accept
+const recordsPerPull = 100
+
+type pullResult struct {
+	// summaries of every cloud op seen, payloads left out
+	cloudOps []types.OperationSync
+	// local ops of records the cloud also changed, they still have to be pushed
+	push []types.OperationSync
+	// summaries of the cloud ops planned to be applied locally
+	apply []types.OperationSync
+	// conflicts merging apply would journal, only worked out on a dry run
+	conflicts []types.SyncConflict
+	seen      map[string]bool
+	pulled    bool
+}
+
+// pullChanges walks the cloud's op summaries since the last sync a page at a time, planSync picks the records to fetch.
+// a page is applied with its cursor in one transaction, so an interrupted pull resumes after it. a dry run only plans
+func (s *SyncEngine) pullChanges(tableName types.TableName, since int64, localLatest map[string]types.OperationSync, silent, dryRun bool) (pullResult, error) {
+	result := pullResult{seen: make(map[string]bool)}
+
+	cursor, err := s.repo.GetPullCursor(tableName)
+	if err != nil {
+		return result, err
+	}
+
+	after, err := s.repo.GetPullPosition(tableName)
+	if err != nil {
+		return result, err
+	}
+
+	for {
+		resp := s.cloud.PullBatch(tableName, types.PullQuery{
+			After:   after,
+			Since:   since,
+			Cursor:  cursor,
+			Limit:   s.batch.PullChunkSize,
+			Summary: true,
+		})
+		if resp.Error != "" {
+			return result, resp.Err()
+		}
+
+		page, ok := resp.Data.(types.SyncBatchResult)
+		if !ok {
+			return result, fmt.Errorf("invalid response data type")
+		}
+		result.cloudOps = append(result.cloudOps, page.Operations...)
+
+		cloudLatest := latestByRecord(page.Operations)
+		pageLocal := make(map[string]types.OperationSync)
+		for recordID := range cloudLatest {
+			result.seen[recordID] = true
+			if op, ok := localLatest[recordID]; ok {
+				pageLocal[recordID] = op
+			}
+		}
+
+		push, apply := planSync(pageLocal, cloudLatest)
+		result.push = append(result.push, push...)
+		result.apply = append(result.apply, apply...)
+
+		// a cursor that doesn't move would loop forever
+		done := !page.HasMore || page.Cursor == cursor
+		next := page.Cursor
+		if done {
+			next = ""
+		}
+
+		if dryRun {
+			result.conflicts = append(result.conflicts, plannedConflicts(tableName, pageLocal, apply)...)
+			if done {
+				return result, nil
+			}
+			cursor = next
+			continue
+		}
+
+		recordIDs := make([]string, 0, len(apply))
+		for _, op := range apply {
+			recordIDs = append(recordIDs, op.RecordID)
+		}
+
+		ops, err := s.fetchRecords(tableName, after, since, recordIDs)
+		if err != nil {
+			return result, err
+		}
+
+		if err := s.local.ApplyBatch(tableName, ops, next); err != nil {
+			errMsg := fmt.Sprintf("error updating local db: %v", err)
+			fmt.Println(errMsg)
+			if !silent {
+				s.emitError("sync:local_update_error", errMsg)
+			}
+			return result, errors.New(errMsg)
+		}
+
+		for _, operation := range ops {
+			s.observeClock(operation)
+		}
+		s.recordConflicts(tableName, pageLocal, latestByRecord(ops))
+		result.pulled = result.pulled || len(ops) > 0
+
+		if done {
+			// stored after the last page is applied, a pull interrupted in between starts from the previous position
+			// again and applies ops it already has, which changes nothing
+			if page.Position != "" && page.Position != after {
+				if err := s.repo.SetPullPosition(tableName, page.Position); err != nil {
+					return result, err
+				}
+			}
+			return result, nil
+		}
+		cursor = next
+	}
+}
+
+// fetchRecords downloads the full latest op of exactly recordIDs, in clock order
+func (s *SyncEngine) fetchRecords(tableName types.TableName, after string, since int64, recordIDs []string) ([]types.OperationSync, error) {
+	ops := make([]types.OperationSync, 0, len(recordIDs))
+
+	for start := 0; start < len(recordIDs); start += recordsPerPull {
+		ids := recordIDs[start:min(start+recordsPerPull, len(recordIDs))]
+		cursor := ""
+
+		for {
+			resp := s.cloud.PullRecordsPage(tableName, types.PullQuery{
+				After:     after,
+				Since:     since,
+				RecordIDs: ids,
+				Cursor:    cursor,
+				Limit:     s.batch.PullChunkSize,
+			})
+			if resp.Error != "" {
+				return nil, resp.Err()
+			}
+
+			page, ok := resp.Data.(types.SyncBatchResult)
+			if !ok {
+				return nil, fmt.Errorf("invalid response data type")
+			}
+			ops = append(ops, page.Operations...)
+
+			if !page.HasMore || page.Cursor == cursor {
+				break
+			}
+			cursor = page.Cursor
+		}
+	}
+
+	sortOps(ops)
+	return ops, nil
+}
+
+// planSync decides what happens to every record changed since the last sync. local only changes are pushed, cloud only
+// ones applied and a record both sides changed is merged field by field. both lists come back in clock order
+func planSync(localLatest, cloudLatest map[string]types.OperationSync) (push, apply []types.OperationSync) {
+	for recordId := range unionKeys(localLatest, cloudLatest) {
+		localOp, hasLocal := localLatest[recordId]
+		cloudOp, hasCloud := cloudLatest[recordId]
+
+		switch {
+		case !hasLocal:
+			apply = append(apply, cloudOp)
+		case !hasCloud:
+			push = append(push, localOp)
+		case localOp.ID == cloudOp.ID:
+			// already in sync
+		default:
+			push = append(push, localOp)
+			apply = append(apply, cloudOp)
+		}
+	}
+
+	sortOps(push)
+	sortOps(apply)
+
+	return push, apply
+}
+
+func sortOps(ops []types.OperationSync) {
+	sort.Slice(ops, func(i, j int) bool {
+		return compareOps(ops[i], ops[j]) < 0
+	})
+}
+
+func chunkOps(ops []types.OperationSync, size int) [][]types.OperationSync {
+	if size <= 0 {
+		size = len(ops)
+	}
+
+	var chunks [][]types.OperationSync
+	for start := 0; start < len(ops); start += size {
+		end := min(start+size, len(ops))
+		chunks = append(chunks, ops[start:end])
+	}
+
+	return chunks
+}
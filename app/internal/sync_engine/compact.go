@@ -0,0 +1,49 @@
+package sync_engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// a sync only needs a record's latest op and what's still pending, so acknowledged ops older than that are compacted
+// away on startup and periodically
+
+// CompactInterval is how often the op log is compacted while the app runs
+const CompactInterval = time.Hour
+
+// Compact collapses the acknowledged ops of every table down to the latest per record and returns how many rows went
+func (s *SyncEngine) Compact() (int64, error) {
+	var removed int64
+	for _, tableName := range syncOrder {
+		n, err := s.repo.CompactOperations(tableName)
+		if err != nil {
+			return removed, fmt.Errorf("[LOCAL] failed to compact %s operations: %v", tableName, err)
+		}
+		removed += n
+	}
+
+	return removed, nil
+}
+
+// RunCompaction compacts right away and then every interval until ctx is done, each run is emitted as "sync:compacted"
+func (s *SyncEngine) RunCompaction(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := s.Compact()
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Printf("compacted the op log, %d operations removed\n", removed)
+			s.emitSuccess("sync:compacted", map[string]int64{"removed": removed})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
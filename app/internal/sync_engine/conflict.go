@@ -0,0 +1,171 @@
+package sync_engine
+
+import (
+	"fmt"
+	"seisami/app/internal/local"
+	"seisami/app/internal/merge"
+	"seisami/app/internal/repo"
+	"seisami/app/types"
+	"strings"
+)
+
+// fields both sides changed since the last sync go to the newer op, those are the conflicts. each is journaled with
+// both versions so the losing one can be brought back
+
+// detectConflict works out what merging remote into a record that also changed locally throws away,
+// ok is false when the two ops touched different fields and both survive
+func detectConflict(tableName types.TableName, localOp, remoteOp types.OperationSync) (types.SyncConflict, bool) {
+	contested := contestedFields(tableName, localOp, remoteOp)
+	if len(contested) == 0 {
+		return types.SyncConflict{}, false
+	}
+
+	conflict := types.SyncConflict{
+		TableName: tableName.String(),
+		RecordID:  remoteOp.RecordID,
+		Local:     localOp,
+		Remote:    remoteOp,
+		Winner:    types.ConflictRemote,
+	}
+	if len(contested) < len(opFields(tableName, localOp)) || len(contested) < len(opFields(tableName, remoteOp)) {
+		conflict.Fields = contested
+	}
+
+	newer, older := remoteOp, localOp
+	if compareOps(localOp, remoteOp) > 0 {
+		conflict.Winner = types.ConflictLocal
+		newer, older = localOp, remoteOp
+	}
+
+	clock := "hlc"
+	if newer.HLC == "" || older.HLC == "" {
+		clock = "created_at"
+	}
+	conflict.Reason = fmt.Sprintf("%s op has the newer %s for %s", conflict.Winner, clock, strings.Join(contested, ", "))
+
+	return conflict, true
+}
+
+// opFields is what an op wrote, deletes and restores only move the record in and out of the trash
+func opFields(tableName types.TableName, op types.OperationSync) []string {
+	switch op.OperationType {
+	case types.DeleteOperation.String(), types.RestoreOperation.String():
+		return []string{merge.TombstoneField}
+	}
+
+	if op.Fields == nil {
+		return merge.TableFields(tableName)
+	}
+	return op.Fields
+}
+
+func contestedFields(tableName types.TableName, localOp, remoteOp types.OperationSync) []string {
+	touched := make(map[string]bool)
+	for _, name := range opFields(tableName, localOp) {
+		touched[name] = true
+	}
+
+	var contested []string
+	for _, name := range opFields(tableName, remoteOp) {
+		if touched[name] {
+			contested = append(contested, name)
+		}
+	}
+
+	return contested
+}
+
+// plannedConflicts is what recordConflicts would journal for apply, worked out from op summaries alone
+func plannedConflicts(tableName types.TableName, localLatest map[string]types.OperationSync, apply []types.OperationSync) []types.SyncConflict {
+	var conflicts []types.SyncConflict
+	for _, remoteOp := range apply {
+		localOp, ok := localLatest[remoteOp.RecordID]
+		if !ok || localOp.ID == remoteOp.ID {
+			continue
+		}
+
+		if conflict, ok := detectConflict(tableName, localOp, remoteOp); ok {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return conflicts
+}
+
+// recordConflicts journals every pulled op that collided with a local change to the same record
+func (s *SyncEngine) recordConflicts(tableName types.TableName, localLatest, pulled map[string]types.OperationSync) {
+	for recordID, remoteOp := range pulled {
+		localOp, ok := localLatest[recordID]
+		if !ok || localOp.ID == remoteOp.ID {
+			continue
+		}
+
+		// the journal keeps readable versions, a device that can't open the op yet has nothing to show
+		opened, err := s.keyring.OpenPayload(remoteOp.PayloadData)
+		if err != nil {
+			fmt.Printf("unable to open conflicting op on %s %s: %v\n", tableName, remoteOp.RecordID, err)
+			continue
+		}
+		remoteOp.PayloadData = opened
+
+		conflict, ok := detectConflict(tableName, localOp, remoteOp)
+		if !ok {
+			continue
+		}
+
+		if err := s.repo.CreateSyncConflict(conflict); err != nil {
+			fmt.Printf("unable to record conflict on %s %s: %v\n", tableName, remoteOp.RecordID, err)
+			continue
+		}
+		s.emitSuccess("sync:conflict", conflict)
+	}
+}
+
+// ReapplyConflictLoser writes the contested fields of the version sync threw away as a new op, which wins everywhere
+// once it syncs
+func (s *SyncEngine) ReapplyConflictLoser(id string) error {
+	conflict, err := s.repo.GetSyncConflict(id)
+	if err != nil {
+		return err
+	}
+	if conflict.ResolvedAt != "" {
+		return fmt.Errorf("conflict %s was already resolved", id)
+	}
+
+	tableName, err := types.TableNameFromString(conflict.TableName)
+	if err != nil {
+		return err
+	}
+
+	loser := conflict.Local
+	if conflict.Winner == types.ConflictLocal {
+		loser = conflict.Remote
+	}
+
+	opType, err := types.OperationFromString(loser.OperationType)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.InTx(func(tx repo.Repository) error {
+		// without a clock it overrides the winner's fields, CreateOperation then stamps them with a fresh one
+		apply := loser
+		apply.HLC = ""
+		apply.Fields = conflict.Fields
+		if err := local.NewLocalFuncs(tx).WithKeyring(s.keyring).UpdateLocalDB(apply); err != nil {
+			return fmt.Errorf("unable to re-apply %s version: %v", loser.DeviceID, err)
+		}
+
+		// only the contested fields go back, the winner's other edits stay
+		if conflict.Fields != nil {
+			_, err = tx.CreateFieldsOperation(tableName, conflict.RecordID, loser.PayloadData, conflict.Fields)
+		} else {
+			_, err = tx.CreateOperation(tableName, conflict.RecordID, loser.PayloadData, opType)
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.ResolveSyncConflict(id)
+	})
+}
@@ -0,0 +1,105 @@
+package sync_engine
+
+import (
+	"fmt"
+	"seisami/app/types"
+)
+
+// a sync pass covers every table at once since a card needs its column and a column its board. tables are pulled
+// parents first and ops missing a parent are parked, parked ops are retried, then inserts and updates are pushed
+// parents first and deletes children first. a table's sync state only moves once all of its pushes went through
+
+// syncOrder is the dependency order of the tables, parents before their children
+var syncOrder = []types.TableName{types.BoardTable, types.ColumnTable, types.CardTable, types.TranscriptionTable}
+
+// SyncTables syncs tables (all of them when empty) in one dependency ordered pass
+func (s *SyncEngine) SyncTables(tables []types.TableName, silent bool) error {
+	tables = dependencyOrder(tables)
+
+	synced := make([]tableSync, 0, len(tables))
+	for _, tableName := range tables {
+		fmt.Println("syncing data for table: ", tableName.String())
+		if !silent {
+			s.emitSuccess("sync:started", map[string]string{"table": tableName.String()})
+		}
+
+		ts, err := s.pullTable(tableName, silent, false)
+		if err != nil {
+			return err
+		}
+		synced = append(synced, ts)
+	}
+
+	waiting, err := s.local.RetryParked()
+	if err != nil {
+		return fmt.Errorf("[LOCAL] failed to retry parked operations: %v", err)
+	}
+	if waiting > 0 {
+		fmt.Printf("operations still waiting for their parent: %d\n", waiting)
+	}
+
+	// a table whose push failed keeps its ops pending, the other tables still finish
+	var pushErr error
+	pushed := make(map[types.TableName]bool, len(synced))
+	failed := make(map[types.TableName]bool, len(synced))
+	for _, ts := range synced {
+		upserts, _ := splitDeletes(ts.toPush)
+		ok, err := s.pushOps(ts.tableName, upserts, silent)
+		if err != nil {
+			failed[ts.tableName] = true
+			pushErr = err
+		}
+		pushed[ts.tableName] = ok
+	}
+
+	for i := len(synced) - 1; i >= 0; i-- {
+		ts := synced[i]
+		_, deletes := splitDeletes(ts.toPush)
+		ok, err := s.pushOps(ts.tableName, deletes, silent)
+		if err != nil {
+			failed[ts.tableName] = true
+			pushErr = err
+		}
+		pushed[ts.tableName] = pushed[ts.tableName] || ok
+	}
+
+	for _, ts := range synced {
+		s.finishTable(ts, pushed[ts.tableName] && !failed[ts.tableName], silent)
+	}
+
+	return pushErr
+}
+
+// dependencyOrder puts tables in the order they have to sync in, parents first
+func dependencyOrder(tables []types.TableName) []types.TableName {
+	if len(tables) == 0 {
+		return syncOrder
+	}
+
+	wanted := make(map[types.TableName]bool, len(tables))
+	for _, tableName := range tables {
+		wanted[tableName] = true
+	}
+
+	ordered := make([]types.TableName, 0, len(wanted))
+	for _, tableName := range syncOrder {
+		if wanted[tableName] {
+			ordered = append(ordered, tableName)
+		}
+	}
+
+	return ordered
+}
+
+// splitDeletes separates deletes from the other ops, keeping the order of both
+func splitDeletes(ops []types.OperationSync) (upserts, deletes []types.OperationSync) {
+	for _, op := range ops {
+		if op.OperationType == types.DeleteOperation.String() {
+			deletes = append(deletes, op)
+			continue
+		}
+		upserts = append(upserts, op)
+	}
+
+	return upserts, deletes
+}
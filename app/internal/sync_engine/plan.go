@@ -0,0 +1,39 @@
+package sync_engine
+
+import (
+	"seisami/app/types"
+)
+
+// Plan reports what SyncData would do to tableName now, it runs the same pull and planning as a dry run
+func (s *SyncEngine) Plan(tableName types.TableName) (types.SyncPlan, error) {
+	ts, err := s.pullTable(tableName, true, true)
+	if err != nil {
+		return types.SyncPlan{}, err
+	}
+
+	plan := types.SyncPlan{
+		TableName: tableName.String(),
+		Push:      nonNil(ts.toPush),
+		Pull:      nonNil(ts.toApply),
+		Conflicts: ts.conflicts,
+		Deletes:   []types.OperationSync{},
+	}
+	if plan.Conflicts == nil {
+		plan.Conflicts = []types.SyncConflict{}
+	}
+
+	for _, op := range append(plan.Push, plan.Pull...) {
+		if op.OperationType == types.DeleteOperation.String() {
+			plan.Deletes = append(plan.Deletes, op)
+		}
+	}
+
+	return plan, nil
+}
+
+func nonNil(ops []types.OperationSync) []types.OperationSync {
+	if ops == nil {
+		return []types.OperationSync{}
+	}
+	return ops
+}
@@ -0,0 +1,276 @@
+package sync_engine
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"seisami/app/internal/cloud"
+	"seisami/app/types"
+	"sync"
+	"time"
+)
+
+// the scheduler owns every sync. op log writes sync their table after a short debounce, never later than MaxWait
+// after the first one. failed syncs retry with backoff and jitter, queued tables sync together in dependency order
+
+type SyncState string
+
+const (
+	SyncIdle    SyncState = "idle"
+	SyncSyncing SyncState = "syncing"
+	SyncOffline SyncState = "offline"
+	SyncError   SyncState = "error"
+)
+
+type SyncStatus struct {
+	State        SyncState `json:"state"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastSyncedAt int64     `json:"last_synced_at,omitempty"`
+	NextRetryAt  int64     `json:"next_retry_at,omitempty"`
+}
+
+type SchedulerConfig struct {
+	Debounce time.Duration
+	// MaxWait caps how long triggers that keep coming push a sync back
+	MaxWait    time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func DefaultSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		Debounce:   2 * time.Second,
+		MaxWait:    10 * time.Second,
+		MinBackoff: 5 * time.Second,
+		MaxBackoff: 5 * time.Minute,
+	}
+}
+
+type Scheduler struct {
+	cfg      SchedulerConfig
+	syncFn   func(tables []types.TableName) error
+	onStatus func(SyncStatus)
+	enabled  func() bool
+
+	mu      sync.Mutex
+	status  SyncStatus
+	pending map[types.TableName]bool
+	attempt int
+
+	wake chan struct{}
+	now  chan struct{}
+}
+
+func NewScheduler(engine *SyncEngine, cfg SchedulerConfig) *Scheduler {
+	return newScheduler(cfg, func(tables []types.TableName) error {
+		if err := engine.SyncTables(tables, true); err != nil {
+			return err
+		}
+
+		for _, tableName := range tables {
+			engine.emitSuccess("sync:table_updated", map[string]string{"table": tableName.String()})
+		}
+		return nil
+	}, func(status SyncStatus) {
+		engine.emitSuccess("sync:status", status)
+	})
+}
+
+func newScheduler(cfg SchedulerConfig, syncFn func([]types.TableName) error, onStatus func(SyncStatus)) *Scheduler {
+	defaults := DefaultSchedulerConfig()
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = defaults.Debounce
+	}
+	if cfg.MaxWait < cfg.Debounce {
+		cfg.MaxWait = max(defaults.MaxWait, cfg.Debounce)
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaults.MinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = cfg.MinBackoff
+	}
+
+	return &Scheduler{
+		cfg:      cfg,
+		syncFn:   syncFn,
+		onStatus: onStatus,
+		status:   SyncStatus{State: SyncIdle},
+		pending:  make(map[types.TableName]bool),
+		wake:     make(chan struct{}, 1),
+		now:      make(chan struct{}, 1),
+	}
+}
+
+// SetEnabled gates syncing (e.g. on being logged in), while disabled triggers are kept for later
+func (s *Scheduler) SetEnabled(enabled func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enabled = enabled
+}
+
+// Start runs the scheduler until ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	go s.run(ctx)
+}
+
+// Trigger queues tables for the next sync, no tables means all of them
+func (s *Scheduler) Trigger(tables ...types.TableName) {
+	if len(tables) == 0 {
+		tables = syncOrder
+	}
+
+	s.mu.Lock()
+	for _, table := range tables {
+		s.pending[table] = true
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SyncNow syncs every table right away, skipping the debounce and any pending backoff
+func (s *Scheduler) SyncNow() {
+	s.mu.Lock()
+	for _, table := range syncOrder {
+		s.pending[table] = true
+	}
+	s.attempt = 0
+	s.mu.Unlock()
+
+	select {
+	case s.now <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) Status() SyncStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.status
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	timer := time.NewTimer(s.cfg.Debounce)
+	timer.Stop()
+
+	// when the sync of the first trigger since the last one has to run, however many triggers follow
+	var deadline time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+
+		case <-s.wake:
+			s.mu.Lock()
+			backingOff := s.attempt > 0
+			s.mu.Unlock()
+
+			// the retry timer is already armed, the table just rides along with it
+			if backingOff {
+				continue
+			}
+
+			if deadline.IsZero() {
+				deadline = time.Now().Add(s.cfg.MaxWait)
+			}
+			timer.Reset(min(s.cfg.Debounce, time.Until(deadline)))
+
+		case <-s.now:
+			timer.Reset(0)
+
+		case <-timer.C:
+			deadline = time.Time{}
+			if retry, ok := s.runPending(); !ok {
+				timer.Reset(retry)
+			}
+		}
+	}
+}
+
+// runPending syncs every queued table, on failure it returns how long to wait before trying again
+func (s *Scheduler) runPending() (time.Duration, bool) {
+	s.mu.Lock()
+	if s.enabled != nil && !s.enabled() {
+		s.mu.Unlock()
+		return 0, true
+	}
+
+	tables := make([]types.TableName, 0, len(s.pending))
+	for _, table := range syncOrder {
+		if s.pending[table] {
+			tables = append(tables, table)
+		}
+	}
+	s.pending = make(map[types.TableName]bool)
+	s.mu.Unlock()
+
+	if len(tables) == 0 {
+		return 0, true
+	}
+
+	s.setStatus(SyncStatus{State: SyncSyncing, LastSyncedAt: s.Status().LastSyncedAt})
+
+	// the queued tables go as one pass, so a card never goes up before the column it was added to
+	lastErr := s.syncFn(tables)
+
+	s.mu.Lock()
+	lastSyncedAt := s.status.LastSyncedAt
+	if lastErr == nil {
+		s.attempt = 0
+		s.mu.Unlock()
+
+		s.setStatus(SyncStatus{State: SyncIdle, LastSyncedAt: time.Now().Unix()})
+		return 0, true
+	}
+
+	for _, table := range tables {
+		s.pending[table] = true
+	}
+	s.attempt++
+	retry := s.backoff(s.attempt)
+	s.mu.Unlock()
+
+	state := SyncError
+	if errors.Is(lastErr, cloud.ErrUnreachable) {
+		state = SyncOffline
+	}
+
+	s.setStatus(SyncStatus{
+		State:        state,
+		LastError:    lastErr.Error(),
+		LastSyncedAt: lastSyncedAt,
+		NextRetryAt:  time.Now().Add(retry).Unix(),
+	})
+
+	return retry, false
+}
+
+// backoff doubles with every failed attempt up to MaxBackoff, half of it is jitter so devices don't retry in lockstep
+func (s *Scheduler) backoff(attempt int) time.Duration {
+	delay := s.cfg.MinBackoff
+	for i := 1; i < attempt && delay < s.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, s.cfg.MaxBackoff)
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+func (s *Scheduler) setStatus(status SyncStatus) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+
+	if s.onStatus != nil {
+		s.onStatus(status)
+	}
+}
@@ -0,0 +1,168 @@
+package sync_engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seisami/app/internal/cloud"
+	"seisami/app/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	calls    []types.TableName
+	passes   int
+	statuses []SyncState
+	failures int
+	done     chan struct{}
+}
+
+func (r *recorder) sync(tables []types.TableName) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.passes++
+	r.calls = append(r.calls, tables...)
+	if r.failures > 0 {
+		r.failures--
+		return fmt.Errorf("[CLOUD] failed to pull operations: execute request: %w: dial tcp: connection refused", cloud.ErrUnreachable)
+	}
+
+	return nil
+}
+
+func (r *recorder) status(status SyncStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statuses = append(r.statuses, status.State)
+	if status.State == SyncIdle {
+		select {
+		case r.done <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *recorder) wait(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-r.done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("scheduler never went idle")
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("debounce_coalesces_triggers", func(t *testing.T) {
+		r := &recorder{done: make(chan struct{}, 1)}
+		s := newScheduler(SchedulerConfig{Debounce: 20 * time.Millisecond}, r.sync, r.status)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s.Start(ctx)
+
+		for range 5 {
+			s.Trigger(types.CardTable)
+		}
+		s.Trigger(types.BoardTable)
+		r.wait(t)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.passes != 1 || len(r.calls) != 2 || r.calls[0] != types.BoardTable || r.calls[1] != types.CardTable {
+			t.Errorf("expected one pass syncing boards then cards, got %d passes over %v", r.passes, r.calls)
+		}
+	})
+
+	t.Run("steady_triggers_sync_by_max_wait", func(t *testing.T) {
+		r := &recorder{done: make(chan struct{}, 1)}
+		s := newScheduler(SchedulerConfig{Debounce: 50 * time.Millisecond, MaxWait: 200 * time.Millisecond}, r.sync, r.status)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s.Start(ctx)
+
+		// a trigger every 10ms never leaves the debounce quiet
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			for {
+				s.Trigger(types.CardTable)
+				select {
+				case <-stop:
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		}()
+
+		r.wait(t)
+	})
+
+	t.Run("failures_back_off_until_online", func(t *testing.T) {
+		r := &recorder{done: make(chan struct{}, 1), failures: 2}
+		s := newScheduler(SchedulerConfig{Debounce: time.Millisecond, MinBackoff: 10 * time.Millisecond}, r.sync, r.status)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s.Start(ctx)
+
+		s.Trigger(types.ColumnTable)
+		r.wait(t)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if len(r.calls) != 3 {
+			t.Errorf("expected 2 failed attempts & 1 retry that succeeds, got %d", len(r.calls))
+		}
+
+		offline := 0
+		for _, state := range r.statuses {
+			if state == SyncOffline {
+				offline++
+			}
+		}
+		if offline != 2 {
+			t.Errorf("expected to report offline twice, got %v", r.statuses)
+		}
+		if status := s.Status(); status.State != SyncIdle || status.LastError != "" {
+			t.Errorf("expected idle without error, got %+v", status)
+		}
+	})
+
+	t.Run("other_errors_report_error", func(t *testing.T) {
+		var got SyncStatus
+		s := newScheduler(SchedulerConfig{}, func([]types.TableName) error {
+			return errors.New("api request failed with status 500")
+		}, func(status SyncStatus) {
+			got = status
+		})
+
+		s.Trigger(types.BoardTable)
+		if _, ok := s.runPending(); ok {
+			t.Fatalf("expected the sync to be retried")
+		}
+
+		if got.State != SyncError || got.LastError == "" {
+			t.Errorf("expected error status, got %+v", got)
+		}
+	})
+
+	t.Run("backoff_grows_with_jitter_up_to_max", func(t *testing.T) {
+		s := newScheduler(SchedulerConfig{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}, nil, nil)
+
+		for attempt, ceiling := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 40: 10 * time.Second} {
+			delay := s.backoff(attempt)
+			if delay < ceiling/2 || delay > ceiling {
+				t.Errorf("attempt %d: expected delay in [%v, %v], got %v", attempt, ceiling/2, ceiling, delay)
+			}
+		}
+	})
+}
@@ -2,14 +2,16 @@ package sync_engine
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"seisami/app/internal/cloud"
+	"seisami/app/internal/e2e"
+	"seisami/app/internal/hlc"
 	"seisami/app/internal/local"
 	"seisami/app/internal/repo"
 	"seisami/app/internal/repo/sqlc/query"
 	"seisami/app/types"
+	"strings"
 	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
@@ -24,6 +26,9 @@ type SyncEngine struct {
 	cloud cloud.Cloud
 	repo  repo.Repository
 	ctx   context.Context
+	batch BatchConfig
+	// opens pulled ops that were end to end encrypted, nil until encryption is set up
+	keyring *e2e.Keyring
 }
 
 func NewSyncEngine(repo repo.Repository, cloud cloud.Cloud, ctx context.Context) *SyncEngine {
@@ -34,9 +39,16 @@ func NewSyncEngine(repo repo.Repository, cloud cloud.Cloud, ctx context.Context)
 		cloud: cloud,
 		repo:  repo,
 		ctx:   ctx,
+		batch: DefaultBatchConfig(),
 	}
 }
 
+// SetKeyring lets the engine open end to end encrypted ops, both when applying and when journaling conflicts
+func (s *SyncEngine) SetKeyring(keyring *e2e.Keyring) {
+	s.keyring = keyring
+	s.local = local.NewLocalFuncs(s.repo).WithKeyring(keyring)
+}
+
 func (s *SyncEngine) emitError(event string, message string) {
 	if s.ctx != nil {
 		runtime.EventsEmit(s.ctx, event, message)
@@ -51,6 +63,17 @@ func (s *SyncEngine) emitSuccess(event string, data interface{}) {
 
 const layout = "2006-01-02 15:04:05"
 
+// observeClock keeps local ops created after a pull ordered after whatever we just received
+func (s *SyncEngine) observeClock(op types.OperationSync) {
+	if op.HLC == "" {
+		return
+	}
+
+	if err := s.repo.ObserveHLC(op.HLC); err != nil {
+		fmt.Printf("unable to observe hlc of operation %s: %v\n", op.ID, err)
+	}
+}
+
 /*
 if i pass in alot of ops, then for a particular record,
 it has a create operation initially, then a user updates the same record & delete eventually,
@@ -71,19 +94,51 @@ func (s *SyncEngine) SyncData(tableName types.TableName, silent bool) error {
 		s.emitSuccess("sync:started", map[string]string{"table": tableName.String()})
 	}
 
+	ts, err := s.pullTable(tableName, silent, false)
+	if err != nil {
+		return err
+	}
+
+	pushed, err := s.pushOps(tableName, ts.toPush, silent)
+	if err != nil {
+		// the sync state stays where it is so ops that didn't make it up are picked up again when the sync is retried
+		return err
+	}
+
+	s.finishTable(ts, pushed, silent)
+	return nil
+}
+
+// tableSync is what pulling a table left for the rest of its sync
+type tableSync struct {
+	tableName types.TableName
+	localOps  []types.OperationSync
+	cloudOps  []types.OperationSync
+	toPush    []types.OperationSync
+	toApply   []types.OperationSync
+	conflicts []types.SyncConflict
+	pulled    bool
+}
+
+// pullTable applies the cloud's changes to tableName and works out which local ops still have to be pushed,
+// a dry run only works both out
+func (s *SyncEngine) pullTable(tableName types.TableName, silent, dryRun bool) (tableSync, error) {
+	ts := tableSync{tableName: tableName}
+
 	localOps, err := s.local.GetAllOperations(tableName)
 	if err != nil {
 		errMsg := fmt.Sprintf("[LOCAL] failed to get operations: %v", err)
 		if !silent {
 			s.emitError("sync:error", errMsg)
 		}
-		return errors.New(errMsg)
+		return ts, errors.New(errMsg)
 	}
+	ts.localOps = localOps
 
 	// get the local synced state firstly
 	var since int64 = 0
 	syncState, err := s.repo.GetSyncState(tableName)
-	if err != nil {
+	if err != nil && !dryRun {
 		s.local.UpsertSyncState(query.SyncState{
 			TableName:    tableName.String(),
 			LastSyncedAt: 0,
@@ -94,184 +149,114 @@ func (s *SyncEngine) SyncData(tableName types.TableName, silent bool) error {
 		since = syncState.LastSyncedAt
 	}
 
-	cloudResp := s.cloud.GetAllOperations(tableName, since)
-	if cloudResp.Error != "" {
-		errMsg := fmt.Sprintf("[CLOUD] failed to get operations: %s", cloudResp.Error)
+	localLatest := latestByRecord(localOps)
+
+	result, err := s.pullChanges(tableName, since, localLatest, silent, dryRun)
+	if err != nil {
+		err = fmt.Errorf("[CLOUD] failed to pull operations: %w", err)
 		if !silent {
-			s.emitError("sync:error", errMsg)
+			s.emitError("sync:error", err.Error())
 		}
-		return errors.New(errMsg)
+		return ts, err
 	}
+	ts.cloudOps = result.cloudOps
+	ts.toApply = result.apply
+	ts.conflicts = result.conflicts
+	ts.pulled = result.pulled
 
-	cloudOps, ok := cloudResp.Data.([]types.OperationSync)
-	if !ok {
-		errMsg := "[CLOUD] invalid response data type"
-		if !silent {
-			s.emitError("sync:error", errMsg)
+	// records the cloud hasn't seen since the last sync only exist locally
+	toPush := result.push
+	for recordID, op := range localLatest {
+		if !result.seen[recordID] {
+			toPush = append(toPush, op)
 		}
-		return errors.New(errMsg)
 	}
+	toPush = s.withoutArchivedBoards(tableName, toPush)
+	sortOps(toPush)
+	fmt.Printf("records to push: %d\n", len(toPush))
+	ts.toPush = toPush
 
-	localLatest := latestByRecord(localOps)
-	cloudLatest := latestByRecord(cloudOps)
-
-	var pushed, pulled bool
-
-	for recordId := range unionKeys(localLatest, cloudLatest) {
-		localOp, hasLocal := localLatest[recordId]
-		cloudOp, hasCloud := cloudLatest[recordId]
-
-		switch {
-		case !hasLocal:
-			// new record exists in cloud, pull it
-			fmt.Println("new record exists in cloud, pulling it: ", recordId)
-			pullResp := s.cloud.PullRecord(tableName, since)
-			if pullResp.Error != "" {
-				errMsg := fmt.Sprintf("error pulling record from cloud: %s", pullResp.Error)
-				fmt.Println(errMsg)
-				if !silent {
-					s.emitError("sync:pull_error", errMsg)
-				}
-				continue
-			}
+	return ts, nil
+}
 
-			operation, ok := pullResp.Data.(types.OperationSync)
-			if !ok {
-				errMsg := "invalid pull response data type"
-				fmt.Println(errMsg)
-				if !silent {
-					s.emitError("sync:pull_error", errMsg)
-				}
-				continue
-			}
+// pushOps uploads ops in chunks and returns the last failure. ops the server rejects are reported and skipped
+func (s *SyncEngine) pushOps(tableName types.TableName, ops []types.OperationSync, silent bool) (bool, error) {
+	var pushed bool
+	var pushErr error
 
-			// after pulling record from cloud, you update it local db
-			fmt.Println("updating local db with new record pulled")
-			if err := s.local.UpdateLocalDB(operation); err != nil {
-				errMsg := fmt.Sprintf("error updating local db: %v", err)
-				fmt.Println(errMsg)
-				if !silent {
-					s.emitError("sync:local_update_error", errMsg)
-				}
-				continue
-			}
-			pulled = true
-
-		case !hasCloud:
-			// new record exists locally, push it to cloud
-			fmt.Println("new record exists locally, pushing it to cloud: ", recordId)
-			pushResp := s.cloud.PushRecord(localOp)
-			if pushResp.Error != "" {
-				errMsg := fmt.Sprintf("push error: %s", pushResp.Error)
-				fmt.Println(errMsg)
-				if !silent {
-					s.emitError("sync:push_error", errMsg)
-				}
-				continue
-			}
-			pushed = true
-
-		default:
-			// both exists
-			fmt.Println("both records exist, comparing timestamps")
-			localTime, err := time.Parse(layout, localOp.CreatedAt)
-			if err != nil {
-				fmt.Printf("error parsing local createdAt: %v\n", err)
-				continue
+	for _, chunk := range chunkOps(ops, s.batch.PushChunkSize) {
+		pushResp := s.pushChunk(tableName, chunk)
+		if pushResp.Error != "" {
+			pushErr = fmt.Errorf("push error: %w", pushResp.Err())
+			fmt.Println(pushErr)
+			if !silent {
+				s.emitError("sync:push_error", pushErr.Error())
 			}
+			continue
+		}
+		pushed = true
 
-			cloudTime, err := time.Parse(layout, cloudOp.CreatedAt)
-			if err != nil {
-				fmt.Printf("error parsing cloud createdAt: %v\n", err)
-				continue
+		result, _ := pushResp.Data.(types.SyncBatchResult)
+		for _, rejected := range result.Rejected {
+			errMsg := fmt.Sprintf("push rejected operation %s: %s", rejected.ID, rejected.Error)
+			fmt.Println(errMsg)
+			if !silent {
+				s.emitError("sync:push_error", errMsg)
 			}
+		}
+	}
 
-			localTs := localTime.Unix()
-			cloudTs := cloudTime.Unix()
-
-			switch {
-			case localTs > cloudTs:
-				fmt.Println("local record is newer, pushing to cloud")
-				// local record is newer, push to cloud
-				pushResp := s.cloud.PushRecord(localOp)
-				if pushResp.Error != "" {
-					errMsg := fmt.Sprintf("[Push error]: %s", pushResp.Error)
-					fmt.Println(errMsg)
-					if !silent {
-						s.emitError("sync:push_error", errMsg)
-					}
-					continue
-				}
-				pushed = true
-
-			case cloudTs > localTs:
-				fmt.Println("cloud record is newer, pulling to local")
-				// cloud record is newer, pull
-				pullResp := s.cloud.PullRecord(tableName, since)
-				if pullResp.Error != "" {
-					errMsg := fmt.Sprintf("error pulling from cloud: %s", pullResp.Error)
-					fmt.Println(errMsg)
-					if !silent {
-						s.emitError("sync:pull_error", errMsg)
-					}
-					continue
-				}
+	return pushed, pushErr
+}
 
-				operation, ok := pullResp.Data.(types.OperationSync)
-				if !ok {
-					errMsg := "invalid pull response data type"
-					fmt.Println(errMsg)
-					if !silent {
-						s.emitError("sync:pull_error", errMsg)
-					}
-					continue
-				}
+// pushChunk pushes ops in one batch. a batch refused over a board the account lost archives it and pushes the rest
+func (s *SyncEngine) pushChunk(tableName types.TableName, ops []types.OperationSync) cloud.HttpResponse {
+	lost := make(map[string]bool)
 
-				if err := s.local.UpdateLocalDB(operation); err != nil {
-					errMsg := fmt.Sprintf("error updating local db: %v", err)
-					fmt.Println(errMsg)
-					if !silent {
-						s.emitError("sync:local_update_error", errMsg)
-					}
-					continue
-				}
-				pulled = true
+	for {
+		pushResp := s.cloud.PushBatch(tableName, ops)
+		board, ok := pushResp.Data.(cloud.LostBoard)
+		if pushResp.Error == "" || !ok || lost[board.BoardID] {
+			return pushResp
+		}
+		lost[board.BoardID] = true
 
-			default:
+		fmt.Printf("Access to board %s was lost, archiving it\n", board.BoardID)
+		if err := s.ArchiveBoard(board.BoardID); err != nil {
+			return pushResp
+		}
 
-			}
+		ops = s.withoutArchivedBoards(tableName, ops)
+		if len(ops) == 0 {
+			return cloud.HttpResponse{Message: "nothing left to push"}
 		}
 	}
+}
+
+// finishTable advances the local and cloud sync state once everything pulled is applied and all pending is pushed
+func (s *SyncEngine) finishTable(ts tableSync, pushed bool, silent bool) {
+	tableName := ts.tableName
+	localOps, pulled := ts.localOps, ts.pulled
 
 	fmt.Printf("Pushed State: %v, Pulled State: %v\n", pushed, pulled)
 
+	// the acknowledged op is the newest local op the cloud has, everything written after it is still pending.
+	// Ops written while this sync ran have a later clock than the ones it read, so they stay pending
+	ackedOpID := ""
+	if state, err := s.repo.GetSyncState(tableName); err == nil {
+		ackedOpID = state.LastSyncedOpID
+	}
+	if pushed && len(localOps) > 0 {
+		ackedOpID = latestOp(localOps).ID
+	}
+
 	if pushed {
 		fmt.Printf("\n\n<-------Pushing New Data To Cloud ----------->\n\n")
 
-		lastOpID := ""
-		if len(localOps) > 0 {
-
-			var latestOp types.OperationSync
-			var latestTime int64
-
-			for _, op := range localOps {
-				t, err := time.Parse(layout, op.CreatedAt)
-				if err != nil {
-					continue
-				}
-				ts := t.Unix()
-				if ts > latestTime {
-					latestTime = ts
-					latestOp = op
-				}
-			}
-			lastOpID = latestOp.ID
-		}
-
 		syncState := query.SyncState{
 			TableName:      tableName.String(),
 			LastSyncedAt:   time.Now().Unix(),
-			LastSyncedOpID: lastOpID,
+			LastSyncedOpID: ackedOpID,
 		}
 
 		if err := s.local.UpsertSyncState(syncState); err != nil {
@@ -307,54 +292,27 @@ func (s *SyncEngine) SyncData(tableName types.TableName, silent bool) error {
 				s.emitError("sync:state_error", errMsg)
 			}
 		} else {
-			lastOpID := ""
-			if len(cloudOps) > 0 {
-
-				var latestOp types.OperationSync
-				var latestTime int64
-
-				for _, op := range cloudOps {
-					t, err := time.Parse(layout, op.CreatedAt)
-					if err != nil {
-						continue
-					}
-					ts := t.Unix()
-					if ts > latestTime {
-						latestTime = ts
-						latestOp = op
-					}
-				}
-				lastOpID = latestOp.ID
-			}
-
+			// pulled ops aren't in the local log, the acknowledgement stays on our own op
 			syncState := query.SyncState{
 				TableName:      tableName.String(),
 				LastSyncedAt:   time.Now().Unix(),
-				LastSyncedOpID: lastOpID,
+				LastSyncedOpID: ackedOpID,
 			}
 
-			if !ok {
-				errMsg := "invalid sync state response data type"
+			if err := s.local.UpdateSyncState(syncState); err != nil {
+				errMsg := fmt.Sprintf("error updating local sync state: %v", err)
 				fmt.Println(errMsg)
 				if !silent {
 					s.emitError("sync:state_error", errMsg)
 				}
-			} else {
-				if err := s.local.UpdateSyncState(syncState); err != nil {
-					errMsg := fmt.Sprintf("error updating local sync state: %v", err)
-					fmt.Println(errMsg)
-					if !silent {
-						s.emitError("sync:state_error", errMsg)
-					}
-				}
+			}
 
-				updateResp := s.cloud.UpdateSyncState(syncState)
-				if updateResp.Error != "" {
-					errMsg := fmt.Sprintf("error updating cloud sync state: %s", updateResp.Error)
-					fmt.Println(errMsg)
-					if !silent {
-						s.emitError("sync:state_error", errMsg)
-					}
+			updateResp := s.cloud.UpdateSyncState(syncState)
+			if updateResp.Error != "" {
+				errMsg := fmt.Sprintf("error updating cloud sync state: %s", updateResp.Error)
+				fmt.Println(errMsg)
+				if !silent {
+					s.emitError("sync:state_error", errMsg)
 				}
 			}
 		}
@@ -367,8 +325,6 @@ func (s *SyncEngine) SyncData(tableName types.TableName, silent bool) error {
 			"pulled": pulled,
 		})
 	}
-
-	return nil
 }
 
 func (s *SyncEngine) BootstrapCloud() error {
@@ -489,10 +445,22 @@ func (s *SyncEngine) BootstrapCloud() error {
 	return nil
 }
 
+// ImportNewBoard pulls a shared board into the local db, after the first import only what changed since the version
+// imported last. an import is applied all or nothing
 func (s *SyncEngine) ImportNewBoard(boardID string) error {
 	s.emitSuccess("import:started", map[string]string{"boardId": boardID})
 
-	boardResp := s.cloud.ImportBoardData(boardID)
+	var since int64
+	if _, err := s.repo.GetBoardWithTrashed(boardID); err == nil {
+		since, err = s.repo.GetBoardVersion(boardID)
+		if err != nil {
+			errMsg := fmt.Sprintf("failed to read local board version: %v", err)
+			s.emitError("import:error", errMsg)
+			return errors.New(errMsg)
+		}
+	}
+
+	boardResp := s.cloud.ImportBoardData(boardID, since)
 	if boardResp.Error != "" {
 		errMsg := fmt.Sprintf("failed to fetch board data from cloud: %s", boardResp.Error)
 		s.emitError("import:error", errMsg)
@@ -506,30 +474,50 @@ func (s *SyncEngine) ImportNewBoard(boardID string) error {
 		return errors.New(errMsg)
 	}
 
-	bByte, _ := json.MarshalIndent(boardData, "", " ")
-	fmt.Println(string(bByte))
-
-	existingBoard, err := s.repo.GetBoard(boardData.Board.ID)
-	if err == nil && existingBoard.ID != "" {
-		errMsg := fmt.Sprintf("board '%s' already exists locally", boardData.Board.Name)
+	if err := s.repo.InTx(func(tx repo.Repository) error {
+		return s.applyBoardImport(tx, boardData)
+	}); err != nil {
+		errMsg := fmt.Sprintf("failed to import board: %v", err)
 		s.emitError("import:error", errMsg)
 		return errors.New(errMsg)
 	}
 
-	_, err = s.repo.ImportBoard(
+	successMsg := fmt.Sprintf("Successfully imported board %s at version %d with %d columns, %d cards, %d transcriptions & %d removals",
+		boardData.Board.ID,
+		boardData.Version,
+		len(boardData.Columns),
+		len(boardData.Cards),
+		len(boardData.Transcriptions),
+		len(boardData.Removed),
+	)
+	fmt.Println(successMsg)
+	s.emitSuccess("import:completed", map[string]interface{}{
+		"boardId":        boardData.Board.ID,
+		"boardName":      boardData.Board.Name,
+		"columnsCount":   len(boardData.Columns),
+		"cardsCount":     len(boardData.Cards),
+		"transcriptions": len(boardData.Transcriptions),
+		"removedCount":   len(boardData.Removed),
+		"incremental":    boardData.Since > 0,
+	})
+
+	return nil
+}
+
+// applyBoardImport upserts a board snapshot or delta, drops what the cloud removed and remembers the version it reached
+func (s *SyncEngine) applyBoardImport(tx repo.Repository, boardData types.ImportUserBoardData) error {
+	_, err := tx.ImportBoard(
 		boardData.Board.ID,
 		boardData.Board.Name,
 		boardData.Board.CreatedAt,
 		boardData.Board.UpdatedAt,
 	)
 	if err != nil {
-		errMsg := fmt.Sprintf("failed to import board: %v", err)
-		s.emitError("import:error", errMsg)
-		return errors.New(errMsg)
+		return err
 	}
 
 	for _, col := range boardData.Columns {
-		_, err = s.repo.ImportColumn(
+		column, err := tx.ImportColumn(
 			col.ID,
 			col.BoardID,
 			col.Name,
@@ -537,34 +525,38 @@ func (s *SyncEngine) ImportNewBoard(boardID string) error {
 			col.CreatedAt,
 			col.UpdatedAt,
 		)
+		if err == nil && column.DeletedAt.Valid {
+			err = tx.RestoreColumn(col.ID)
+		}
 		if err != nil {
 			errMsg := fmt.Sprintf("failed to import column %s: %v", col.ID, err)
-			fmt.Println(errMsg)
 			s.emitError("import:column_error", errMsg)
-			continue
+			return errors.New(errMsg)
 		}
 	}
 
-	for _, card := range boardData.Cards {
-		_, err = s.repo.ImportCard(
-			card.ID,
-			card.ColumnID,
-			card.Title,
-			card.Description,
-			card.Attachments,
-			card.CreatedAt,
-			card.UpdatedAt,
+	for _, c := range boardData.Cards {
+		card, err := tx.ImportCard(
+			c.ID,
+			c.ColumnID,
+			c.Title,
+			c.Description,
+			c.Attachments,
+			c.CreatedAt,
+			c.UpdatedAt,
 		)
+		if err == nil && card.DeletedAt.Valid {
+			err = tx.RestoreCard(c.ID)
+		}
 		if err != nil {
-			errMsg := fmt.Sprintf("failed to import card %s: %v", card.ID, err)
-			fmt.Println(errMsg)
+			errMsg := fmt.Sprintf("failed to import card %s: %v", c.ID, err)
 			s.emitError("import:card_error", errMsg)
-			continue
+			return errors.New(errMsg)
 		}
 	}
 
 	for _, t := range boardData.Transcriptions {
-		_, err = s.repo.ImportTranscription(
+		transcription, err := tx.ImportTranscription(
 			t.ID,
 			t.BoardID,
 			t.Transcription,
@@ -574,65 +566,83 @@ func (s *SyncEngine) ImportNewBoard(boardID string) error {
 			t.CreatedAt,
 			t.UpdatedAt,
 		)
+		if err == nil && transcription.DeletedAt.Valid {
+			err = tx.RestoreTranscription(t.ID)
+		}
 		if err != nil {
 			errMsg := fmt.Sprintf("failed to import transcription %s: %v", t.ID, err)
-			fmt.Println(errMsg)
 			s.emitError("import:transcription_error", errMsg)
-			continue
+			return errors.New(errMsg)
 		}
 	}
 
-	successMsg := fmt.Sprintf("Successfully imported board %s with %d columns, %d cards, and %d transcriptions",
-		boardData.Board.ID,
-		len(boardData.Columns),
-		len(boardData.Cards),
-		len(boardData.Transcriptions),
-	)
-	fmt.Println(successMsg)
-	s.emitSuccess("import:completed", map[string]interface{}{
-		"boardId":        boardData.Board.ID,
-		"boardName":      boardData.Board.Name,
-		"columnsCount":   len(boardData.Columns),
-		"cardsCount":     len(boardData.Cards),
-		"transcriptions": len(boardData.Transcriptions),
-	})
+	for _, removed := range boardData.Removed {
+		tableName, err := types.TableNameFromString(removed.TableName)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		switch tableName {
+		case types.ColumnTable:
+			err = tx.DeleteColumn(removed.ID)
+		case types.CardTable:
+			err = tx.DeleteCard(removed.ID)
+		case types.TranscriptionTable:
+			err = tx.DeleteTranscription(removed.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove %s %s: %v", tableName, removed.ID, err)
+		}
+	}
+
+	return tx.SetBoardVersion(boardData.Board.ID, boardData.Version)
 }
 
 func latestByRecord(ops []types.OperationSync) map[string]types.OperationSync {
 	m := make(map[string]types.OperationSync)
 	for _, op := range ops {
-
-		t, err := time.Parse(layout, op.CreatedAt)
-		if err != nil {
-			fmt.Printf("unable to parse created_at to time layout: %v", err)
-			continue
-		}
-
-		createdAt := t.Unix()
-
 		existing, ok := m[op.RecordID]
-
-		if !ok {
+		if !ok || compareOps(op, existing) > 0 {
 			m[op.RecordID] = op
-			continue
 		}
+	}
 
-		existingTime, err := time.Parse(layout, existing.CreatedAt)
-		if err != nil {
-			fmt.Printf("unable to parse existing created_at into time layout: %v", err)
-			continue
+	return m
+}
+
+func latestOp(ops []types.OperationSync) types.OperationSync {
+	var latest types.OperationSync
+	for i, op := range ops {
+		if i == 0 || compareOps(op, latest) > 0 {
+			latest = op
 		}
+	}
 
-		existingAt := existingTime.Unix()
+	return latest
+}
 
-		if createdAt > existingAt {
-			m[op.RecordID] = op
-		}
+// opTimestamp falls back to created_at for operations written before every op carried a hybrid logical clock
+func opTimestamp(op types.OperationSync) hlc.Timestamp {
+	if ts, err := hlc.Parse(op.HLC); err == nil {
+		return ts
 	}
 
-	return m
+	t, err := time.Parse(layout, op.CreatedAt)
+	if err != nil {
+		fmt.Printf("operation %s has neither a valid hlc nor created_at: %v\n", op.ID, err)
+		return hlc.Timestamp{DeviceID: op.DeviceID}
+	}
+
+	return hlc.FromTime(t, op.DeviceID)
+}
+
+func compareOps(a, b types.OperationSync) int {
+	if order := opTimestamp(a).Compare(opTimestamp(b)); order != 0 {
+		return order
+	}
+
+	// same clock reading from the same device can only be the same op, the id keeps it deterministic anyway
+	return strings.Compare(a.ID, b.ID)
 }
 
 func unionKeys(a, b map[string]types.OperationSync) map[string]struct{} {
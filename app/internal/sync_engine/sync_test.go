@@ -1,9 +1,857 @@
 package sync_engine
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"seisami/app/internal/cloud"
+	"seisami/app/internal/hlc"
+	"seisami/app/internal/repo"
+	"seisami/app/internal/repo/sqlc/query"
+	"seisami/app/types"
 	"testing"
+	"time"
 )
 
 func TestGetAllOperations(t *testing.T) {
 
 }
+
+func TestLatestByRecord(t *testing.T) {
+	t.Run("same_second_edits_use_the_clock", func(t *testing.T) {
+		// both devices wrote within the same second, created_at alone can't tell them apart
+		first := types.OperationSync{
+			ID:        "op-1",
+			RecordID:  "card-1",
+			DeviceID:  "device-b",
+			CreatedAt: "2025-01-01 10:00:00",
+			HLC:       hlc.Timestamp{WallTime: 1735725600100, DeviceID: "device-b"}.String(),
+		}
+		second := types.OperationSync{
+			ID:        "op-2",
+			RecordID:  "card-1",
+			DeviceID:  "device-a",
+			CreatedAt: "2025-01-01 10:00:00",
+			HLC:       hlc.Timestamp{WallTime: 1735725600100, Counter: 1, DeviceID: "device-a"}.String(),
+		}
+
+		for _, ops := range [][]types.OperationSync{{first, second}, {second, first}} {
+			latest := latestByRecord(ops)
+			if latest["card-1"].ID != "op-2" {
+				t.Errorf("expected op-2 to win regardless of order, got %s", latest["card-1"].ID)
+			}
+		}
+	})
+
+	t.Run("lagging_wall_clock_still_orders_after_observed_op", func(t *testing.T) {
+		// device-a observed device-b's op so its next edit is ordered after it even though its own clock lags
+		remote := hlc.Timestamp{WallTime: time.Now().Add(time.Hour).UnixMilli(), DeviceID: "device-b"}
+		clock := hlc.NewClock("device-a")
+		observed := clock.Update(remote)
+
+		ops := []types.OperationSync{
+			{ID: "remote", RecordID: "board-1", HLC: remote.String()},
+			{ID: "local", RecordID: "board-1", HLC: observed.String()},
+		}
+
+		if latest := latestByRecord(ops)["board-1"]; latest.ID != "local" {
+			t.Errorf("expected local op to win, got %s", latest.ID)
+		}
+	})
+
+	t.Run("legacy_ops_fall_back_to_created_at", func(t *testing.T) {
+		ops := []types.OperationSync{
+			{ID: "newer", RecordID: "column-1", CreatedAt: "2025-01-01 10:00:05"},
+			{ID: "older", RecordID: "column-1", CreatedAt: "2025-01-01 10:00:00"},
+		}
+
+		if latest := latestByRecord(ops)["column-1"]; latest.ID != "newer" {
+			t.Errorf("expected newer legacy op to win, got %s", latest.ID)
+		}
+	})
+}
+
+// pagedCloud serves ops the way /sync/batch and /sync/pull page them, failAfter > 0 breaks the pull after that many
+type pagedCloud struct {
+	cloud.Cloud
+	ops       []types.OperationSync
+	cursors   []string
+	recordIDs [][]string
+	failAfter int
+	pushed    []string
+	// position the server hands out once a pull is done and the positions pulls asked to start after
+	position string
+	afters   []string
+	// boards the account isn't on anymore, a batch with any of their ops is refused whole
+	lost map[string]bool
+	// records whose ops the server can't apply, the rest of their batch still lands
+	rejected map[string]bool
+}
+
+func (p *pagedCloud) page(q types.PullQuery) types.SyncBatchResult {
+	wanted := make(map[string]bool)
+	for _, id := range q.RecordIDs {
+		wanted[id] = true
+	}
+
+	result := types.SyncBatchResult{Cursor: q.Cursor, Position: q.After}
+	if p.position != "" {
+		result.Position = p.position
+	}
+	for _, op := range p.ops {
+		if q.Cursor != "" && op.HLC <= q.Cursor {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[op.RecordID] {
+			continue
+		}
+		if len(result.Operations) == q.Limit {
+			result.HasMore = true
+			break
+		}
+		if q.Summary {
+			op.PayloadData = ""
+		}
+		result.Operations = append(result.Operations, op)
+		result.Cursor = op.HLC
+	}
+
+	return result
+}
+
+func (p *pagedCloud) PullBatch(tableName types.TableName, q types.PullQuery) cloud.HttpResponse {
+	p.cursors = append(p.cursors, q.Cursor)
+	p.afters = append(p.afters, q.After)
+	if p.failAfter > 0 && len(p.cursors) > p.failAfter {
+		return cloud.HttpResponse{Error: "connection reset"}
+	}
+
+	return cloud.HttpResponse{Data: p.page(q)}
+}
+
+func (p *pagedCloud) PullRecordsPage(tableName types.TableName, q types.PullQuery) cloud.HttpResponse {
+	p.recordIDs = append(p.recordIDs, q.RecordIDs)
+	return cloud.HttpResponse{Data: p.page(q)}
+}
+
+func (p *pagedCloud) PushBatch(tableName types.TableName, ops []types.OperationSync) cloud.HttpResponse {
+	for _, op := range ops {
+		if boardID, _ := cloud.BoardOf(nil, tableName, op); p.lost[boardID] {
+			return cloud.HttpResponse{Error: "not allowed on this board", Data: cloud.LostBoard{BoardID: boardID}}
+		}
+	}
+
+	var result types.SyncBatchResult
+	for _, op := range ops {
+		if p.rejected[op.RecordID] {
+			result.Rejected = append(result.Rejected, types.RejectedOperation{ID: op.ID, Error: "bad payload"})
+			continue
+		}
+		p.pushed = append(p.pushed, op.OperationType+" "+op.RecordID)
+		result.Applied++
+	}
+
+	return cloud.HttpResponse{Data: result}
+}
+
+func (p *pagedCloud) UpdateSyncState(state query.SyncState) cloud.HttpResponse {
+	return cloud.HttpResponse{}
+}
+
+func (p *pagedCloud) GetSyncState(tableName types.TableName) cloud.HttpResponse {
+	return cloud.HttpResponse{}
+}
+
+func boardOps(n int) []types.OperationSync {
+	ops := make([]types.OperationSync, 0, n)
+	for i := range n {
+		id := fmt.Sprintf("board-%d", i)
+		ops = append(ops, types.OperationSync{
+			ID:            fmt.Sprintf("op-%d", i),
+			TableName:     types.BoardTable.String(),
+			RecordID:      id,
+			OperationType: "insert",
+			PayloadData:   fmt.Sprintf(`{"id":%q,"name":"Board %d"}`, id, i),
+			HLC:           hlc.Timestamp{WallTime: int64(1000 + i), DeviceID: "device-b"}.String(),
+		})
+	}
+
+	return ops
+}
+
+func setupTestEngine(t *testing.T, remote cloud.Cloud) (*SyncEngine, repo.Repository) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	if _, err := db.Exec(repo.Schema); err != nil {
+		t.Fatalf("failed to exec schema: %v", err)
+	}
+
+	r := repo.NewRepo(db, context.Background())
+	return NewSyncEngine(r, remote, nil), r
+}
+
+func TestBatchSync(t *testing.T) {
+	t.Run("fetch_pulls_exactly_the_planned_records", func(t *testing.T) {
+		remote := &pagedCloud{ops: boardOps(5)}
+		engine := &SyncEngine{cloud: remote}
+		engine.SetBatchConfig(BatchConfig{PullChunkSize: 1})
+
+		ops, err := engine.fetchRecords(types.BoardTable, "", 0, []string{"board-1", "board-3"})
+		if err != nil {
+			t.Fatalf("fetchRecords failed: %v", err)
+		}
+
+		if len(ops) != 2 || ops[0].RecordID != "board-1" || ops[1].RecordID != "board-3" {
+			t.Errorf("unexpected ops: %+v", ops)
+		}
+		if ops[0].PayloadData == "" {
+			t.Errorf("expected fetched ops to carry their payload")
+		}
+		for _, ids := range remote.recordIDs {
+			if len(ids) != 2 {
+				t.Errorf("expected every request to ask for the 2 planned records, got %v", ids)
+			}
+		}
+	})
+
+	t.Run("interrupted_pull_resumes_after_last_page", func(t *testing.T) {
+		remote := &pagedCloud{ops: boardOps(5), failAfter: 2}
+		engine, r := setupTestEngine(t, remote)
+		engine.SetBatchConfig(BatchConfig{PullChunkSize: 2})
+
+		if _, err := engine.pullChanges(types.BoardTable, 0, nil, true, false); err == nil {
+			t.Fatalf("expected the third page to fail")
+		}
+
+		cursor, err := r.GetPullCursor(types.BoardTable)
+		if err != nil || cursor == "" {
+			t.Fatalf("expected a stored cursor, got %q (%v)", cursor, err)
+		}
+		if _, err := r.GetBoard("board-3"); err != nil {
+			t.Errorf("expected the second page to be applied: %v", err)
+		}
+
+		remote.failAfter = 0
+		remote.cursors = nil
+
+		result, err := engine.pullChanges(types.BoardTable, 0, nil, true, false)
+		if err != nil {
+			t.Fatalf("pullChanges failed: %v", err)
+		}
+
+		if remote.cursors[0] != cursor {
+			t.Errorf("expected the pull to resume from %q, started from %q", cursor, remote.cursors[0])
+		}
+		if len(result.cloudOps) != 1 {
+			t.Errorf("expected only the last op to be pulled again, got %d", len(result.cloudOps))
+		}
+		if _, err := r.GetBoard("board-4"); err != nil {
+			t.Errorf("expected the last page to be applied: %v", err)
+		}
+		if cursor, _ := r.GetPullCursor(types.BoardTable); cursor != "" {
+			t.Errorf("expected the cursor to be cleared, got %q", cursor)
+		}
+	})
+
+	t.Run("finished_pull_continues_after_its_position", func(t *testing.T) {
+		remote := &pagedCloud{ops: boardOps(3), position: "board-1:42"}
+		engine, r := setupTestEngine(t, remote)
+		engine.SetBatchConfig(BatchConfig{PullChunkSize: 2})
+
+		if _, err := engine.pullChanges(types.BoardTable, 0, nil, true, false); err != nil {
+			t.Fatalf("pullChanges failed: %v", err)
+		}
+		for _, after := range remote.afters {
+			if after != "" {
+				t.Errorf("expected the first pull to start from the beginning, got %q", after)
+			}
+		}
+
+		if position, err := r.GetPullPosition(types.BoardTable); err != nil || position != "board-1:42" {
+			t.Fatalf("expected the position to be stored, got %q (%v)", position, err)
+		}
+
+		remote.afters = nil
+		if _, err := engine.pullChanges(types.BoardTable, 0, nil, true, false); err != nil {
+			t.Fatalf("pullChanges failed: %v", err)
+		}
+		if len(remote.afters) == 0 || remote.afters[0] != "board-1:42" {
+			t.Errorf("expected the next pull to start after the stored position, got %v", remote.afters)
+		}
+	})
+
+	t.Run("plan_pushes_local_and_applies_cloud_changes", func(t *testing.T) {
+		localLatest := map[string]types.OperationSync{
+			"card-1": {ID: "local-1", RecordID: "card-1", HLC: "000000000000002:0000000000:a"},
+			"card-2": {ID: "shared", RecordID: "card-2", HLC: "000000000000001:0000000000:a"},
+			"card-3": {ID: "local-3", RecordID: "card-3", HLC: "000000000000001:0000000000:a"},
+		}
+		cloudLatest := map[string]types.OperationSync{
+			"card-2": {ID: "shared", RecordID: "card-2", HLC: "000000000000001:0000000000:a"},
+			"card-3": {ID: "cloud-3", RecordID: "card-3", HLC: "000000000000003:0000000000:b"},
+			"card-4": {ID: "cloud-4", RecordID: "card-4", HLC: "000000000000004:0000000000:b"},
+		}
+
+		push, apply := planSync(localLatest, cloudLatest)
+
+		if len(push) != 2 || push[0].ID != "local-3" || push[1].ID != "local-1" {
+			t.Errorf("unexpected push plan: %+v", push)
+		}
+		if len(apply) != 2 || apply[0].ID != "cloud-3" || apply[1].ID != "cloud-4" {
+			t.Errorf("unexpected apply plan: %+v", apply)
+		}
+	})
+
+	t.Run("chunks_keep_every_op", func(t *testing.T) {
+		ops := make([]types.OperationSync, 5)
+
+		chunks := chunkOps(ops, 2)
+		if len(chunks) != 3 || len(chunks[2]) != 1 {
+			t.Errorf("unexpected chunks: %d", len(chunks))
+		}
+		if len(chunkOps(nil, 2)) != 0 {
+			t.Errorf("expected no chunks for no ops")
+		}
+	})
+}
+
+func TestSyncPass(t *testing.T) {
+	t.Run("parents_pushed_first_and_deletes_children_first", func(t *testing.T) {
+		remote := &pagedCloud{}
+		engine, r := setupTestEngine(t, remote)
+
+		local := []struct {
+			table    types.TableName
+			recordID string
+			opType   types.Operation
+		}{
+			{types.CardTable, "card-2", types.DeleteOperation},
+			{types.CardTable, "card-1", types.InsertOperation},
+			{types.ColumnTable, "column-2", types.DeleteOperation},
+			{types.ColumnTable, "column-1", types.InsertOperation},
+			{types.BoardTable, "board-1", types.InsertOperation},
+		}
+		for _, op := range local {
+			if _, err := r.CreateOperation(op.table, op.recordID, "{}", op.opType); err != nil {
+				t.Fatalf("CreateOperation failed: %v", err)
+			}
+		}
+
+		if err := engine.SyncTables([]types.TableName{types.CardTable, types.BoardTable, types.ColumnTable}, true); err != nil {
+			t.Fatalf("SyncTables failed: %v", err)
+		}
+
+		expected := []string{"insert board-1", "insert column-1", "insert card-1", "delete card-2", "delete column-2"}
+		if fmt.Sprint(remote.pushed) != fmt.Sprint(expected) {
+			t.Errorf("expected pushes %v, got %v", expected, remote.pushed)
+		}
+	})
+
+	t.Run("rejected_op_doesnt_hold_back_the_rest", func(t *testing.T) {
+		remote := &pagedCloud{rejected: map[string]bool{"board-1": true}}
+		engine, r := setupTestEngine(t, remote)
+
+		for _, id := range []string{"board-1", "board-2"} {
+			if _, err := r.CreateOperation(types.BoardTable, id, "{}", types.InsertOperation); err != nil {
+				t.Fatalf("CreateOperation failed: %v", err)
+			}
+		}
+
+		if err := engine.SyncTables([]types.TableName{types.BoardTable}, true); err != nil {
+			t.Fatalf("SyncTables failed: %v", err)
+		}
+		if fmt.Sprint(remote.pushed) != "[insert board-2]" {
+			t.Errorf("expected board-2 to be pushed, got %v", remote.pushed)
+		}
+
+		// the rejected op isn't sent again, the table moved past it
+		remote.pushed = nil
+		if err := engine.SyncTables([]types.TableName{types.BoardTable}, true); err != nil {
+			t.Fatalf("SyncTables failed: %v", err)
+		}
+		pending, err := r.GetAllOperations(types.BoardTable)
+		if err != nil {
+			t.Fatalf("GetAllOperations failed: %v", err)
+		}
+		if len(remote.pushed) != 0 || len(pending) != 0 {
+			t.Errorf("expected nothing left to push, pushed %v with %d pending", remote.pushed, len(pending))
+		}
+	})
+}
+
+func TestConflicts(t *testing.T) {
+	t.Run("only_fields_both_sides_touched_conflict", func(t *testing.T) {
+		localOp := types.OperationSync{ID: "local", RecordID: "card-1", OperationType: "update", Fields: []string{"title"}, HLC: "000000000000002:0000000000:a"}
+		remoteOp := types.OperationSync{ID: "remote", RecordID: "card-1", OperationType: "update", Fields: []string{"description"}, HLC: "000000000000001:0000000000:b"}
+
+		if _, ok := detectConflict(types.CardTable, localOp, remoteOp); ok {
+			t.Errorf("expected edits to different fields not to conflict")
+		}
+
+		remoteOp.Fields = []string{"title", "description"}
+		conflict, ok := detectConflict(types.CardTable, localOp, remoteOp)
+		if !ok {
+			t.Fatalf("expected edits to the same field to conflict")
+		}
+		if conflict.Winner != types.ConflictLocal {
+			t.Errorf("expected the newer local op to win, got %s", conflict.Winner)
+		}
+		if fmt.Sprint(conflict.Fields) != "[title]" {
+			t.Errorf("expected only title to be contested, got %v", conflict.Fields)
+		}
+
+		remoteOp.OperationType = "delete"
+		if _, ok := detectConflict(types.CardTable, localOp, remoteOp); ok {
+			t.Errorf("expected a delete not to conflict with a field edit")
+		}
+	})
+
+	t.Run("pull_journals_conflict_and_loser_can_be_reapplied", func(t *testing.T) {
+		remote := &pagedCloud{}
+		engine, r := setupTestEngine(t, remote)
+
+		board, err := r.CreateBoard("Original")
+		if err != nil {
+			t.Fatalf("CreateBoard failed: %v", err)
+		}
+		if _, err := r.UpdateBoard(board.ID, "Local"); err != nil {
+			t.Fatalf("UpdateBoard failed: %v", err)
+		}
+		if _, err := r.CreateOperation(types.BoardTable, board.ID, fmt.Sprintf(`{"id":%q,"name":"Local"}`, board.ID), types.UpdateOperation); err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+
+		remote.ops = []types.OperationSync{{
+			ID:            "remote-op",
+			TableName:     types.BoardTable.String(),
+			RecordID:      board.ID,
+			OperationType: "update",
+			PayloadData:   fmt.Sprintf(`{"id":%q,"name":"Remote"}`, board.ID),
+			HLC:           hlc.Timestamp{WallTime: time.Now().Add(time.Hour).UnixMilli(), DeviceID: "device-b"}.String(),
+			Fields:        []string{"name"},
+		}}
+
+		localOps, err := engine.local.GetAllOperations(types.BoardTable)
+		if err != nil {
+			t.Fatalf("GetAllOperations failed: %v", err)
+		}
+		if _, err := engine.pullChanges(types.BoardTable, 0, latestByRecord(localOps), true, false); err != nil {
+			t.Fatalf("pullChanges failed: %v", err)
+		}
+
+		conflicts, err := r.ListSyncConflicts()
+		if err != nil {
+			t.Fatalf("ListSyncConflicts failed: %v", err)
+		}
+		if len(conflicts) != 1 || conflicts[0].Winner != types.ConflictRemote {
+			t.Fatalf("expected one conflict won by the remote op, got %+v", conflicts)
+		}
+		if got, _ := r.GetBoard(board.ID); got.Name != "Remote" {
+			t.Fatalf("expected the remote name to win, got %q", got.Name)
+		}
+
+		if err := engine.ReapplyConflictLoser(conflicts[0].ID); err != nil {
+			t.Fatalf("ReapplyConflictLoser failed: %v", err)
+		}
+		if got, _ := r.GetBoard(board.ID); got.Name != "Local" {
+			t.Errorf("expected the local name to be re-applied, got %q", got.Name)
+		}
+
+		resolved, err := r.GetSyncConflict(conflicts[0].ID)
+		if err != nil || resolved.ResolvedAt == "" {
+			t.Errorf("expected the conflict to be resolved: %+v (%v)", resolved, err)
+		}
+		if err := engine.ReapplyConflictLoser(conflicts[0].ID); err == nil {
+			t.Errorf("expected a resolved conflict not to be re-applied twice")
+		}
+	})
+
+	t.Run("reapplied_loser_keeps_the_winners_other_fields", func(t *testing.T) {
+		remote := &pagedCloud{}
+		engine, r := setupTestEngine(t, remote)
+
+		board, err := r.CreateBoard("Board")
+		if err != nil {
+			t.Fatalf("CreateBoard failed: %v", err)
+		}
+		column, err := r.CreateColumn(board.ID, "To Do")
+		if err != nil {
+			t.Fatalf("CreateColumn failed: %v", err)
+		}
+		card, err := r.CreateCard(column.ID, "Original", "Original description")
+		if err != nil {
+			t.Fatalf("CreateCard failed: %v", err)
+		}
+		cardPayload := func(title, description string) string {
+			return fmt.Sprintf(`{"column_id":%q,"title":%q,"description":%q,"attachments":""}`, column.ID, title, description)
+		}
+		inserted, err := r.CreateOperation(types.CardTable, card.ID, cardPayload("Original", "Original description"), types.InsertOperation)
+		if err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+		if err := r.UpsertSyncState(types.CardTable, inserted.ID, 0); err != nil {
+			t.Fatalf("UpsertSyncState failed: %v", err)
+		}
+
+		// this device only renamed the card
+		if _, err := r.UpdateCard(card.ID, "Local", "Original description"); err != nil {
+			t.Fatalf("UpdateCard failed: %v", err)
+		}
+		if _, err := r.CreateOperation(types.CardTable, card.ID, cardPayload("Local", "Original description"), types.UpdateOperation); err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+
+		// the other device renamed it too and rewrote the description, its op is newer
+		remote.ops = []types.OperationSync{{
+			ID:            "remote-op",
+			TableName:     types.CardTable.String(),
+			RecordID:      card.ID,
+			OperationType: "update",
+			PayloadData:   cardPayload("Remote", "Remote description"),
+			HLC:           hlc.Timestamp{WallTime: time.Now().Add(time.Hour).UnixMilli(), DeviceID: "device-b"}.String(),
+			Fields:        []string{"title", "description"},
+		}}
+
+		localOps, err := engine.local.GetAllOperations(types.CardTable)
+		if err != nil {
+			t.Fatalf("GetAllOperations failed: %v", err)
+		}
+		if _, err := engine.pullChanges(types.CardTable, 0, latestByRecord(localOps), true, false); err != nil {
+			t.Fatalf("pullChanges failed: %v", err)
+		}
+
+		conflicts, err := r.ListSyncConflicts()
+		if err != nil {
+			t.Fatalf("ListSyncConflicts failed: %v", err)
+		}
+		if len(conflicts) != 1 || fmt.Sprint(conflicts[0].Fields) != "[title]" {
+			t.Fatalf("expected one conflict over the title, got %+v", conflicts)
+		}
+
+		if err := engine.ReapplyConflictLoser(conflicts[0].ID); err != nil {
+			t.Fatalf("ReapplyConflictLoser failed: %v", err)
+		}
+
+		got, err := r.GetCard(card.ID)
+		if err != nil {
+			t.Fatalf("GetCard failed: %v", err)
+		}
+		if got.Title != "Local" {
+			t.Errorf("expected the local title to be re-applied, got %q", got.Title)
+		}
+		if got.Description.String != "Remote description" {
+			t.Errorf("expected the remote description to stay, got %q", got.Description.String)
+		}
+
+		ops, err := r.GetAllOperations(types.CardTable)
+		if err != nil {
+			t.Fatalf("GetAllOperations failed: %v", err)
+		}
+		if len(ops) != 1 || ops[0].OperationType != "update" || ops[0].Fields != `["title"]` {
+			t.Errorf("expected the re-applied op to only write the title, got %+v", ops)
+		}
+	})
+}
+
+// exportCloud serves /sync/export of a single board, changes are what a request with since > 0 gets back
+type exportCloud struct {
+	cloud.Cloud
+	snapshot types.ImportUserBoardData
+	changes  types.ImportUserBoardData
+	since    []int64
+}
+
+func (e *exportCloud) ImportBoardData(boardId string, since int64) cloud.HttpResponse {
+	e.since = append(e.since, since)
+	if since > 0 {
+		return cloud.HttpResponse{Data: e.changes}
+	}
+
+	return cloud.HttpResponse{Data: e.snapshot}
+}
+
+func TestImportNewBoard(t *testing.T) {
+	t.Run("rejoining_imports_only_changes_since_the_stored_version", func(t *testing.T) {
+		board := types.ExportedBoard{ID: "board-1", Name: "Roadmap", CreatedAt: "2025-01-01 10:00:00", UpdatedAt: "2025-01-01 10:00:00"}
+		remote := &exportCloud{
+			snapshot: types.ImportUserBoardData{
+				Board: board,
+				Columns: []types.ExportedColumn{
+					{ID: "col-1", BoardID: "board-1", Name: "Todo", Position: 1, CreatedAt: "2025-01-01 10:00:00", UpdatedAt: "2025-01-01 10:00:00"},
+					{ID: "col-2", BoardID: "board-1", Name: "Done", Position: 2, CreatedAt: "2025-01-01 10:00:00", UpdatedAt: "2025-01-01 10:00:00"},
+				},
+				Version: 3,
+			},
+			changes: types.ImportUserBoardData{
+				Board: board,
+				Columns: []types.ExportedColumn{
+					{ID: "col-1", BoardID: "board-1", Name: "Backlog", Position: 1, CreatedAt: "2025-01-01 10:00:00", UpdatedAt: "2025-01-02 10:00:00"},
+				},
+				Removed: []types.RemovedRecord{{TableName: types.ColumnTable.String(), ID: "col-2"}},
+				Version: 5,
+				Since:   3,
+			},
+		}
+		engine, r := setupTestEngine(t, remote)
+
+		if err := engine.ImportNewBoard("board-1"); err != nil {
+			t.Fatalf("first import failed: %v", err)
+		}
+		if err := engine.ImportNewBoard("board-1"); err != nil {
+			t.Fatalf("second import failed: %v", err)
+		}
+
+		if len(remote.since) != 2 || remote.since[0] != 0 || remote.since[1] != 3 {
+			t.Errorf("expected a full import then one since version 3, got %v", remote.since)
+		}
+		if version, _ := r.GetBoardVersion("board-1"); version != 5 {
+			t.Errorf("expected board version 5, got %d", version)
+		}
+		if column, err := r.GetColumn("col-1"); err != nil || column.Name != "Backlog" {
+			t.Errorf("expected col-1 renamed to Backlog, got %+v (%v)", column, err)
+		}
+		if column, err := r.GetColumn("col-2"); err == nil && !column.DeletedAt.Valid {
+			t.Errorf("expected col-2 to be removed")
+		}
+	})
+}
+
+func TestArchiveBoard(t *testing.T) {
+	t.Run("archived_boards_stop_pushing_until_imported_again", func(t *testing.T) {
+		remote := &pagedCloud{}
+		engine, r := setupTestEngine(t, remote)
+
+		kept, _ := r.CreateBoard("Mine")
+		removed, _ := r.CreateBoard("Shared")
+		column, err := r.CreateColumn(removed.ID, "Todo")
+		if err != nil {
+			t.Fatalf("CreateColumn failed: %v", err)
+		}
+		for _, op := range []struct {
+			table    types.TableName
+			recordID string
+			payload  string
+		}{
+			{types.BoardTable, kept.ID, "{}"},
+			{types.BoardTable, removed.ID, "{}"},
+			{types.ColumnTable, column.ID, fmt.Sprintf(`{"id":%q,"board_id":%q}`, column.ID, removed.ID)},
+		} {
+			if _, err := r.CreateOperation(op.table, op.recordID, op.payload, types.InsertOperation); err != nil {
+				t.Fatalf("CreateOperation failed: %v", err)
+			}
+		}
+
+		if err := engine.ArchiveBoard(removed.ID); err != nil {
+			t.Fatalf("ArchiveBoard failed: %v", err)
+		}
+		if err := engine.SyncTables([]types.TableName{types.BoardTable, types.ColumnTable}, true); err != nil {
+			t.Fatalf("SyncTables failed: %v", err)
+		}
+
+		expected := []string{"insert " + kept.ID}
+		if fmt.Sprint(remote.pushed) != fmt.Sprint(expected) {
+			t.Errorf("expected pushes %v, got %v", expected, remote.pushed)
+		}
+
+		boards, _ := r.GetAllBoards(1, 10)
+		if len(boards) != 1 || boards[0].ID != kept.ID {
+			t.Errorf("expected only %s to be listed, got %+v", kept.ID, boards)
+		}
+
+		if _, err := r.ImportBoard(removed.ID, "Shared", "2025-01-01 10:00:00", "2025-01-01 10:00:00"); err != nil {
+			t.Fatalf("ImportBoard failed: %v", err)
+		}
+		if archived, _ := r.ArchivedBoardIDs(); archived[removed.ID] {
+			t.Errorf("expected importing the board to bring it back")
+		}
+	})
+
+	t.Run("board_lost_while_away_is_archived_when_the_cloud_refuses_it", func(t *testing.T) {
+		remote := &pagedCloud{}
+		engine, r := setupTestEngine(t, remote)
+
+		kept, _ := r.CreateBoard("Mine")
+		removed, _ := r.CreateBoard("Shared")
+		remote.lost = map[string]bool{removed.ID: true}
+		for _, board := range []query.Board{kept, removed} {
+			if _, err := r.CreateOperation(types.BoardTable, board.ID, "{}", types.InsertOperation); err != nil {
+				t.Fatalf("CreateOperation failed: %v", err)
+			}
+		}
+
+		if err := engine.SyncTables([]types.TableName{types.BoardTable}, true); err != nil {
+			t.Fatalf("SyncTables failed: %v", err)
+		}
+
+		expected := []string{"insert " + kept.ID}
+		if fmt.Sprint(remote.pushed) != fmt.Sprint(expected) {
+			t.Errorf("expected the rest of the batch to go through, got %v", remote.pushed)
+		}
+		if archived, _ := r.ArchivedBoardIDs(); !archived[removed.ID] {
+			t.Errorf("expected %s to be archived", removed.ID)
+		}
+	})
+}
+
+func TestPlan(t *testing.T) {
+	t.Run("dry_run_changes_nothing_and_matches_the_sync", func(t *testing.T) {
+		remote := &pagedCloud{}
+		engine, r := setupTestEngine(t, remote)
+
+		edited, err := r.CreateBoard("Original")
+		if err != nil {
+			t.Fatalf("CreateBoard failed: %v", err)
+		}
+		if _, err := r.CreateOperation(types.BoardTable, edited.ID, fmt.Sprintf(`{"id":%q,"name":"Local"}`, edited.ID), types.UpdateOperation); err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+		deleted, err := r.CreateBoard("Stale")
+		if err != nil {
+			t.Fatalf("CreateBoard failed: %v", err)
+		}
+
+		later := hlc.Timestamp{WallTime: time.Now().Add(time.Hour).UnixMilli(), DeviceID: "device-b"}
+		remote.ops = append(boardOps(1),
+			types.OperationSync{
+				ID:            "remote-edit",
+				TableName:     types.BoardTable.String(),
+				RecordID:      edited.ID,
+				OperationType: "update",
+				PayloadData:   fmt.Sprintf(`{"id":%q,"name":"Remote"}`, edited.ID),
+				HLC:           later.String(),
+				Fields:        []string{"name"},
+			},
+			types.OperationSync{
+				ID:            "remote-delete",
+				TableName:     types.BoardTable.String(),
+				RecordID:      deleted.ID,
+				OperationType: "delete",
+				PayloadData:   fmt.Sprintf(`{"id":%q}`, deleted.ID),
+				HLC:           hlc.Timestamp{WallTime: later.WallTime + 1, DeviceID: "device-b"}.String(),
+			},
+		)
+
+		plan, err := engine.Plan(types.BoardTable)
+		if err != nil {
+			t.Fatalf("Plan failed: %v", err)
+		}
+
+		if len(plan.Push) != 1 || plan.Push[0].RecordID != edited.ID {
+			t.Errorf("expected the local edit to be pushed, got %+v", plan.Push)
+		}
+		if len(plan.Pull) != 3 {
+			t.Errorf("expected 3 records to be pulled, got %+v", plan.Pull)
+		}
+		if len(plan.Conflicts) != 1 || plan.Conflicts[0].RecordID != edited.ID {
+			t.Errorf("expected one conflict on the edited board, got %+v", plan.Conflicts)
+		}
+		if len(plan.Deletes) != 1 || plan.Deletes[0].RecordID != deleted.ID {
+			t.Errorf("expected the stale board to be deleted, got %+v", plan.Deletes)
+		}
+
+		if _, err := r.GetBoard("board-0"); err == nil {
+			t.Errorf("expected the dry run not to apply cloud changes")
+		}
+		if got, _ := r.GetBoard(edited.ID); got.Name != "Original" {
+			t.Errorf("expected the dry run not to merge, got %q", got.Name)
+		}
+		if conflicts, _ := r.ListSyncConflicts(); len(conflicts) != 0 {
+			t.Errorf("expected the dry run not to journal conflicts, got %d", len(conflicts))
+		}
+		if _, err := r.GetSyncState(types.BoardTable); err == nil {
+			t.Errorf("expected the dry run not to create a sync state")
+		}
+		if len(remote.pushed) != 0 {
+			t.Errorf("expected the dry run not to push, got %v", remote.pushed)
+		}
+
+		if err := engine.SyncData(types.BoardTable, true); err != nil {
+			t.Fatalf("SyncData failed: %v", err)
+		}
+
+		if len(remote.pushed) != 1 || remote.pushed[0] != "update "+edited.ID {
+			t.Errorf("expected the sync to push what was planned, got %v", remote.pushed)
+		}
+		if conflicts, _ := r.ListSyncConflicts(); len(conflicts) != len(plan.Conflicts) {
+			t.Errorf("expected the sync to journal the %d planned conflicts, got %d", len(plan.Conflicts), len(conflicts))
+		}
+		if got, err := r.GetBoard(deleted.ID); err == nil && !got.DeletedAt.Valid {
+			t.Errorf("expected the sync to delete the stale board")
+		}
+	})
+}
+
+// storeEngine is a device syncing through folder the way the app sets it up, with the storage backend as its cloud
+func storeEngine(t *testing.T, folder string) (*SyncEngine, repo.Repository) {
+	t.Helper()
+
+	engine, r := setupTestEngine(t, nil)
+	store, err := cloud.NewFolderStore(folder)
+	if err != nil {
+		t.Fatalf("NewFolderStore failed: %v", err)
+	}
+	engine.cloud = cloud.NewStoreCloud(store, r, context.Background())
+
+	return engine, r
+}
+
+func TestStoreBackend(t *testing.T) {
+	t.Run("segments_reach_a_device_whose_clock_runs_ahead", func(t *testing.T) {
+		folder := t.TempDir()
+		a, ra := storeEngine(t, folder)
+		b, rb := storeEngine(t, folder)
+
+		// device-b's clock is an hour ahead, so its last sync looks later than anything device-a writes next
+		if err := rb.UpsertSyncState(types.BoardTable, "", time.Now().Add(time.Hour).Unix()); err != nil {
+			t.Fatalf("UpsertSyncState failed: %v", err)
+		}
+		if err := b.SyncTables([]types.TableName{types.BoardTable}, true); err != nil {
+			t.Fatalf("device-b sync failed: %v", err)
+		}
+
+		board, err := ra.CreateBoard("Roadmap")
+		if err != nil {
+			t.Fatalf("CreateBoard failed: %v", err)
+		}
+		payload := fmt.Sprintf(`{"id":%q,"name":"Roadmap"}`, board.ID)
+		if _, err := ra.CreateOperation(types.BoardTable, board.ID, payload, types.InsertOperation); err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+		if err := a.SyncTables([]types.TableName{types.BoardTable}, true); err != nil {
+			t.Fatalf("device-a sync failed: %v", err)
+		}
+
+		if err := b.SyncTables([]types.TableName{types.BoardTable}, true); err != nil {
+			t.Fatalf("device-b sync failed: %v", err)
+		}
+		if got, err := rb.GetBoard(board.ID); err != nil || got.Name != "Roadmap" {
+			t.Fatalf("expected device-b to pull the board, got %+v (%v)", got, err)
+		}
+
+		// the next sync only reads what device-a wrote since. the local op log tells ops apart from the last sync by
+		// the second, so device-a's last sync is moved back to let an edit made within the same second through
+		if err := ra.UpsertSyncState(types.BoardTable, "", time.Now().Add(-time.Minute).Unix()); err != nil {
+			t.Fatalf("UpsertSyncState failed: %v", err)
+		}
+		payload = fmt.Sprintf(`{"id":%q,"name":"Launch"}`, board.ID)
+		if _, err := ra.CreateOperation(types.BoardTable, board.ID, payload, types.UpdateOperation); err != nil {
+			t.Fatalf("CreateOperation failed: %v", err)
+		}
+		if err := a.SyncTables([]types.TableName{types.BoardTable}, true); err != nil {
+			t.Fatalf("device-a sync failed: %v", err)
+		}
+		if err := b.SyncTables([]types.TableName{types.BoardTable}, true); err != nil {
+			t.Fatalf("device-b sync failed: %v", err)
+		}
+		if got, err := rb.GetBoard(board.ID); err != nil || got.Name != "Launch" {
+			t.Errorf("expected device-b to pull the rename, got %+v (%v)", got, err)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"seisami/app/internal/cloud"
+	"seisami/app/internal/lan"
+	"seisami/app/internal/repo/sqlc/query"
+	"seisami/app/types"
+	"seisami/app/utils"
+)
+
+// LAN sync needs no account, one desktop hosts a sync folder and the others pair with it. settings keep which side
+// this device is on
+
+// deviceName is how this install shows up to other devices, after the machine
+func deviceName() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "desktop"
+	}
+
+	return name
+}
+
+func lanSyncDir() string {
+	return filepath.Join(utils.GetAppDataDir(), "lan-sync")
+}
+
+func openLanFolder() (cloud.ObjectStore, error) {
+	if err := os.MkdirAll(lanSyncDir(), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create lan sync folder: %v", err)
+	}
+
+	return cloud.NewFolderStore(lanSyncDir())
+}
+
+// openLanStore is the folder this device hosts or the one it paired with
+func (a *App) openLanStore(settings query.Setting) (cloud.ObjectStore, error) {
+	if settings.SyncLocation.String == "" {
+		return openLanFolder()
+	}
+
+	deviceID, err := a.repository.GetDeviceID()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := lan.NewPeerStore(settings.SyncLocation.String, deviceID, settings.SyncSecretKey.String)
+	if err != nil {
+		return nil, err
+	}
+
+	a.lanPeerStore = store
+	return store, nil
+}
+
+// startLan serves the folder when this device hosts, or keeps track of the host's address when it paired with one
+func (a *App) startLan() {
+	settings, err := a.repository.GetSettings()
+	if err != nil || settings.SyncBackend != syncBackendLan {
+		return
+	}
+
+	if settings.SyncLocation.String == "" {
+		if _, err := a.startLanHost(); err != nil {
+			fmt.Printf("unable to host lan sync: %v\n", err)
+		}
+		return
+	}
+
+	if _, err := a.startLanDiscovery(); err != nil {
+		fmt.Printf("unable to follow the paired device: %v\n", err)
+	}
+}
+
+func (a *App) startLanHost() (*lan.Host, error) {
+	a.lanMu.Lock()
+	defer a.lanMu.Unlock()
+
+	if a.lanHost != nil {
+		return a.lanHost, nil
+	}
+
+	store, err := openLanFolder()
+	if err != nil {
+		return nil, err
+	}
+
+	deviceID, err := a.repository.GetDeviceID()
+	if err != nil {
+		return nil, err
+	}
+
+	host := lan.NewHost(store, a.repository, deviceID, deviceName(), func() {
+		a.syncScheduler.Trigger()
+	})
+	if err := host.Start(a.ctx, lan.DefaultPort); err != nil {
+		return nil, err
+	}
+
+	a.lanHost = host
+	return host, nil
+}
+
+func (a *App) startLanDiscovery() (*lan.Discovery, error) {
+	a.lanMu.Lock()
+	defer a.lanMu.Unlock()
+
+	if a.lanDiscovery != nil {
+		return a.lanDiscovery, nil
+	}
+
+	deviceID, err := a.repository.GetDeviceID()
+	if err != nil {
+		return nil, err
+	}
+
+	discovery := lan.NewDiscovery(deviceID, a.followLanHost)
+	if err := discovery.Listen(a.ctx); err != nil {
+		return nil, err
+	}
+
+	a.lanDiscovery = discovery
+	return discovery, nil
+}
+
+// followLanHost moves sync to where the paired host announces itself when the network gave it a new address
+func (a *App) followLanHost(found lan.Announcement) {
+	if a.lanPeerStore == nil || a.lanPeerStore.Address() == found.Address {
+		return
+	}
+
+	settings, err := a.repository.GetSettings()
+	if err != nil || settings.SyncAccessKey.String != found.DeviceID {
+		return
+	}
+
+	a.lanPeerStore.SetAddress(found.Address)
+	if _, err := a.repository.SetSyncBackend(syncBackendLan, found.Address, &settings.SyncAccessKey.String, &settings.SyncSecretKey.String); err != nil {
+		fmt.Printf("unable to save the paired device's new address: %v\n", err)
+	}
+}
+
+// HostLanSync makes this device the LAN host and returns the code a device pairs with, a new call replaces the code.
+// the device syncs through its own folder from its next start
+func (a *App) HostLanSync() (string, error) {
+	host, err := a.startLanHost()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := a.repository.SetSyncBackend(syncBackendLan, "", nil, nil); err != nil {
+		return "", err
+	}
+
+	return host.OpenPairing()
+}
+
+// DiscoverLanDevices are the devices hosting lan sync heard on the network lately, call it again to refresh
+func (a *App) DiscoverLanDevices() ([]lan.Announcement, error) {
+	discovery, err := a.startLanDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	return discovery.Hosts(), nil
+}
+
+// PairLanDevice pairs with the host at address using the code it shows, the device syncs through it from next start
+func (a *App) PairLanDevice(address string, code string) (query.Setting, error) {
+	deviceID, err := a.repository.GetDeviceID()
+	if err != nil {
+		return query.Setting{}, err
+	}
+
+	pairing, err := lan.Pair(a.ctx, address, deviceID, deviceName(), code)
+	if err != nil {
+		return query.Setting{}, err
+	}
+
+	return a.repository.SetSyncBackend(syncBackendLan, address, &pairing.DeviceID, &pairing.Token)
+}
+
+// ListLanPeers is every device that paired with this one
+func (a *App) ListLanPeers() ([]types.Device, error) {
+	peers, err := a.repository.ListLanPeers()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]types.Device, 0, len(peers))
+	for _, peer := range peers {
+		devices = append(devices, types.Device{
+			ID:        peer.DeviceID,
+			Name:      peer.Name,
+			CreatedAt: peer.PairedAt.String,
+		})
+	}
+
+	return devices, nil
+}
+
+// RemoveLanPeer stops a paired device from syncing through this one, it has to pair again to come back
+func (a *App) RemoveLanPeer(deviceID string) error {
+	return a.repository.RemoveLanPeer(deviceID)
+}
@@ -122,6 +122,7 @@ func handleDeepLink(app *App, deepLink string) {
 			go func() {
 				wailsRuntime.EventsEmit(ctx, "board:import_request", map[string]string{
 					"board_id": boardID,
+					"invite":   query.Get("invite"),
 				})
 			}()
 		}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"seisami/app/internal/repo/sqlc/query"
 	"seisami/app/types"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
@@ -84,277 +85,106 @@ func (a *App) handleMutations() {
 			}(a.ctx, data)
 		}
 	})
+}
 
-	runtime.EventsOn(a.ctx, "board:data", func(optionalData ...any) {
-		if len(optionalData) > 0 {
-			data, ok := optionalData[0].(string)
-			if !ok {
-				fmt.Println("board:data event received invalid data type")
-				return
-			}
-
-			go func(ctx context.Context, payload string) {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					var boardData map[string]interface{}
-					if err := json.Unmarshal([]byte(payload), &boardData); err != nil {
-						fmt.Printf("unable to unmarshal board data: %v\n", err)
-						return
-					}
-
-					boardID, ok := boardData["id"].(string)
-					if !ok || boardID == "" {
-						fmt.Println("board:data event missing board id")
-						return
-					}
-
-					_, err := a.repository.CreateOperation(types.BoardTable, boardID, payload, types.UpdateOperation)
-					if err != nil {
-						fmt.Printf("unable to update board operation: %v\n", err)
-						return
-					}
-
-				}
-			}(a.ctx, data)
+// RecordEvent stores the op of an event the frontend is about to send to the room under the envelope id, so the op the
+// server stores from the room and the one pushed later are the same
+func (a *App) RecordEvent(eventType, payload, id string) (types.EventStamp, error) {
+	op, err := a.recordEvent(eventType, payload, id)
+	if err != nil {
+		return types.EventStamp{}, err
+	}
+
+	stamp := types.EventStamp{ID: op.ID, HLC: op.Hlc}
+	if op.Fields != "" {
+		if err := json.Unmarshal([]byte(op.Fields), &stamp.Fields); err != nil {
+			return types.EventStamp{}, fmt.Errorf("unable to decode operation fields: %v", err)
 		}
-	})
-
-	// column name updatedd....
-	runtime.EventsOn(a.ctx, "column:data", func(optionalData ...any) {
-		if len(optionalData) > 0 {
-			var columnData types.ColumnEvent
-			data, ok := optionalData[0].(string)
-
-			if ok {
-				if err := json.Unmarshal([]byte(data), &columnData); err != nil {
-					// TODO: emit error
-					fmt.Printf("unable to unmarshal json: %v\n", err)
-					return
-				}
-			} else {
-				fmt.Printf("couldnt parse data structure")
-				return
-			}
-
-			columnBytes, err := json.Marshal(columnData)
-			if err != nil {
-				fmt.Println("unable to serialize column data: ", err)
-				return
-			}
+	}
 
-			go func(ctx context.Context, column types.ColumnEvent) {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-
-					_, err := a.repository.CreateOperation(types.ColumnTable, columnData.ID, string(columnBytes), types.UpdateOperation)
-					if err != nil {
-						fmt.Println(err)
-						return
-					}
-
-				}
-			}(a.ctx, columnData)
+	return stamp, nil
+}
 
+// recordEvent stores the op eventType with payload stands for, the same op a REST push of the change sends
+func (a *App) recordEvent(eventType, payload, id string) (query.Operation, error) {
+	switch eventType {
+	case "board:data":
+		var boardData map[string]interface{}
+		if err := json.Unmarshal([]byte(payload), &boardData); err != nil {
+			return query.Operation{}, fmt.Errorf("unable to unmarshal board data: %v", err)
 		}
-	})
-
-	runtime.EventsOn(a.ctx, "column:create", func(optionalData ...any) {
-		if len(optionalData) > 0 {
-			var columnData types.ColumnEvent
-			data, ok := optionalData[0].(string)
-			if ok {
-				if err := json.Unmarshal([]byte(data), &columnData); err != nil {
-					fmt.Printf("unable to unmarshal json: %v\n", err)
-					return
-				}
-			} else {
-				fmt.Printf("couldnt parse data structure")
-				return
-			}
-
-			go func(ctx context.Context, payload string, column types.ColumnEvent) {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					_, err := a.repository.CreateOperation(types.ColumnTable, column.ID, payload, types.InsertOperation)
-					if err != nil {
-						fmt.Println(err)
-					}
-				}
-			}(a.ctx, data, columnData)
 
+		boardID, ok := boardData["id"].(string)
+		if !ok || boardID == "" {
+			return query.Operation{}, fmt.Errorf("board:data event missing board id")
 		}
-	})
 
-	runtime.EventsOn(a.ctx, "column:delete", func(optionalData ...any) {
-		if len(optionalData) > 0 {
-			var columnData types.ColumnDeleteEvent
-			data, ok := optionalData[0].(string)
-			if ok {
-				if err := json.Unmarshal([]byte(data), &columnData); err != nil {
-					fmt.Printf("unable to unmarshal json: %v\n", err)
-					return
-				}
-			} else {
-				fmt.Printf("couldnt parse data structure")
-				return
-			}
-
-			go func(ctx context.Context, payload string, column types.ColumnDeleteEvent) {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					_, err := a.repository.CreateOperation(types.ColumnTable, column.ID, payload, types.DeleteOperation)
-					if err != nil {
-						fmt.Println(err)
-					}
-				}
-			}(a.ctx, data, columnData)
+		return a.repository.CreateOperationWithID(id, types.BoardTable, boardID, payload, types.UpdateOperation)
 
+	case "column:data", "column:create":
+		var columnData types.ColumnEvent
+		if err := json.Unmarshal([]byte(payload), &columnData); err != nil {
+			return query.Operation{}, fmt.Errorf("unable to unmarshal json: %v", err)
 		}
-	})
-
-	runtime.EventsOn(a.ctx, "card:data", func(optionalData ...interface{}) {
-		if len(optionalData) > 0 {
-			var cardData types.CardEvent
-			data, ok := optionalData[0].(string)
-
-			if ok {
-				if err := json.Unmarshal([]byte(data), &cardData); err != nil {
-					// TODO: emit error
-					fmt.Printf("unable to unmarshal json: %v\n", err)
-					return
-				}
-			} else {
-				fmt.Printf("couldnt parse data structure")
-				return
-			}
-
-			go func(ctx context.Context, column types.CardEvent) {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-
-					b, err := json.Marshal(cardData)
-					if err != nil {
-						fmt.Println("unable to serialize column data: ", err)
-						return
-					}
 
-					_, err = a.repository.CreateOperation(types.CardTable, cardData.Card.ID, string(b), types.UpdateOperation)
-					if err != nil {
-						fmt.Println(err)
-						return
-					}
+		if eventType == "column:create" {
+			return a.repository.CreateOperationWithID(id, types.ColumnTable, columnData.ID, payload, types.InsertOperation)
+		}
 
-				}
-			}(a.ctx, cardData)
+		columnBytes, err := json.Marshal(columnData)
+		if err != nil {
+			return query.Operation{}, fmt.Errorf("unable to serialize column data: %v", err)
 		}
-	})
 
-	runtime.EventsOn(a.ctx, "card:create", func(optionalData ...interface{}) {
-		if len(optionalData) > 0 {
-			var cardData types.CardEvent
-			data, ok := optionalData[0].(string)
+		return a.repository.CreateOperationWithID(id, types.ColumnTable, columnData.ID, string(columnBytes), types.UpdateOperation)
 
-			if ok {
-				if err := json.Unmarshal([]byte(data), &cardData); err != nil {
-					fmt.Printf("unable to unmarshal json: %v\n", err)
-					return
-				}
-			} else {
-				fmt.Printf("couldnt parse data structure")
-				return
-			}
-
-			go func(ctx context.Context, payload string, card types.CardEvent) {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					_, err := a.repository.CreateOperation(types.CardTable, card.Card.ID, payload, types.InsertOperation)
-					if err != nil {
-						fmt.Println(err)
-					}
-				}
-			}(a.ctx, data, cardData)
+	case "column:delete":
+		var columnData types.ColumnDeleteEvent
+		if err := json.Unmarshal([]byte(payload), &columnData); err != nil {
+			return query.Operation{}, fmt.Errorf("unable to unmarshal json: %v", err)
 		}
-	})
 
-	runtime.EventsOn(a.ctx, "card:delete", func(optionalData ...interface{}) {
-		if len(optionalData) > 0 {
-			var cardData types.CardDeleteEvent
-			data, ok := optionalData[0].(string)
+		return a.repository.CreateOperationWithID(id, types.ColumnTable, columnData.ID, payload, types.DeleteOperation)
 
-			if ok {
-				if err := json.Unmarshal([]byte(data), &cardData); err != nil {
-					fmt.Printf("unable to unmarshal json: %v\n", err)
-					return
-				}
-			} else {
-				fmt.Printf("couldnt parse data structure")
-				return
-			}
+	case "card:data", "card:create":
+		var cardData types.CardEvent
+		if err := json.Unmarshal([]byte(payload), &cardData); err != nil {
+			return query.Operation{}, fmt.Errorf("unable to unmarshal json: %v", err)
+		}
 
-			go func(ctx context.Context, payload string, card types.CardDeleteEvent) {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					_, err := a.repository.CreateOperation(types.CardTable, card.Card.ID, payload, types.DeleteOperation)
-					if err != nil {
-						fmt.Println(err)
-					}
-				}
-			}(a.ctx, data, cardData)
+		if eventType == "card:create" {
+			return a.repository.CreateOperationWithID(id, types.CardTable, cardData.Card.ID, payload, types.InsertOperation)
+		}
 
+		b, err := json.Marshal(cardData)
+		if err != nil {
+			return query.Operation{}, fmt.Errorf("unable to serialize card data: %v", err)
 		}
-	})
 
-	runtime.EventsOn(a.ctx, "card:column", func(optionalData ...interface{}) {
-		if len(optionalData) > 0 {
-			var cardColumnData types.CardColumnEvent
-			data, ok := optionalData[0].(string)
+		return a.repository.CreateOperationWithID(id, types.CardTable, cardData.Card.ID, string(b), types.UpdateOperation)
 
-			if ok {
-				if err := json.Unmarshal([]byte(data), &cardColumnData); err != nil {
-					// TODO: emit error
-					fmt.Printf("unable to unmarshal json: %v\n", err)
-					return
-				}
-			} else {
-				fmt.Printf("couldnt parse data structure")
-				return
-			}
+	case "card:delete":
+		var cardData types.CardDeleteEvent
+		if err := json.Unmarshal([]byte(payload), &cardData); err != nil {
+			return query.Operation{}, fmt.Errorf("unable to unmarshal json: %v", err)
+		}
 
-			go func(ctx context.Context, column types.CardColumnEvent) {
-				select {
-				case <-ctx.Done():
-					return
-				default:
+		return a.repository.CreateOperationWithID(id, types.CardTable, cardData.Card.ID, payload, types.DeleteOperation)
 
-					b, err := json.Marshal(cardColumnData)
-					if err != nil {
-						fmt.Println("unable to serialize column data: ", err)
-						return
-					}
+	case "card:column":
+		var cardColumnData types.CardColumnEvent
+		if err := json.Unmarshal([]byte(payload), &cardColumnData); err != nil {
+			return query.Operation{}, fmt.Errorf("unable to unmarshal json: %v", err)
+		}
 
-					_, err = a.repository.CreateOperation(types.CardTable, cardColumnData.CardID, string(b), types.UpdateCardColumn)
-					if err != nil {
-						fmt.Println(err)
-						return
-					}
+		b, err := json.Marshal(cardColumnData)
+		if err != nil {
+			return query.Operation{}, fmt.Errorf("unable to serialize column data: %v", err)
+		}
 
-				}
-			}(a.ctx, cardColumnData)
+		return a.repository.CreateOperationWithID(id, types.CardTable, cardColumnData.CardID, string(b), types.UpdateCardColumn)
 
-		}
-	})
+	default:
+		return query.Operation{}, fmt.Errorf("unknown event type %q", eventType)
+	}
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"seisami/app/internal/cloud"
+	"seisami/app/internal/repo/sqlc/query"
+	"time"
+)
+
+const (
+	syncBackendCloud  = "cloud"
+	syncBackendFolder = "folder"
+	syncBackendS3     = "s3"
+	syncBackendLan    = "lan"
+)
+
+// storagePollInterval is how often a device syncing through its own storage looks for other devices' changes,
+// nothing there can tell it like the cloud's websocket does
+const storagePollInterval = time.Minute
+
+func openSyncStore(backend, location, accessKey, secretKey string) (cloud.ObjectStore, error) {
+	switch backend {
+	case syncBackendFolder:
+		return cloud.NewFolderStore(location)
+	case syncBackendS3:
+		cfg, err := cloud.ParseS3Location(location, accessKey, secretKey)
+		if err != nil {
+			return nil, err
+		}
+		return cloud.NewS3Store(cfg)
+	default:
+		return nil, fmt.Errorf("unknown sync backend %q", backend)
+	}
+}
+
+// openSyncBackend is the storage the settings point sync at, nil when sync goes through the Seisami cloud
+func (a *App) openSyncBackend() (cloud.Cloud, error) {
+	settings, err := a.repository.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.SyncBackend == "" || settings.SyncBackend == syncBackendCloud {
+		return nil, nil
+	}
+
+	var store cloud.ObjectStore
+	if settings.SyncBackend == syncBackendLan {
+		store, err = a.openLanStore(settings)
+	} else {
+		store, err = openSyncStore(settings.SyncBackend, settings.SyncLocation.String, settings.SyncAccessKey.String, settings.SyncSecretKey.String)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cloud.NewStoreCloud(store, a.repository, a.ctx), nil
+}
+
+// SaveSyncBackend picks what sync goes through, "cloud", a shared "folder" or an "s3" bucket url like
+// http://localhost:9000/seisami?region=us-east-1. the storage has to be reachable, it's used from the next start
+func (a *App) SaveSyncBackend(backend string, location string, accessKey *string, secretKey *string) (query.Setting, error) {
+	if backend == syncBackendLan {
+		return query.Setting{}, fmt.Errorf("host lan sync or pair with a device on the network to sync over it")
+	}
+
+	if backend != syncBackendCloud {
+		var access, secret string
+		if accessKey != nil {
+			access = *accessKey
+		}
+		if secretKey != nil {
+			secret = *secretKey
+		}
+
+		store, err := openSyncStore(backend, location, access, secret)
+		if err != nil {
+			return query.Setting{}, err
+		}
+
+		ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
+		defer cancel()
+		if _, err := store.List(ctx, "devices/"); err != nil {
+			return query.Setting{}, fmt.Errorf("unable to reach sync storage: %v", err)
+		}
+	}
+
+	return a.repository.SetSyncBackend(backend, location, accessKey, secretKey)
+}
+
+// pollSyncStorage syncs every table on an interval, changes other devices leave in the storage arrive no other way
+func (a *App) pollSyncStorage() {
+	ticker := time.NewTicker(storagePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.syncScheduler.Trigger()
+		}
+	}
+}
@@ -75,6 +75,13 @@ type CardDeleteEvent struct {
 	} `json:"card"`
 }
 
+// EventStamp is the clock and changed fields of the op stored for an event, the room's copy of the event carries them
+type EventStamp struct {
+	ID     string   `json:"id"`
+	HLC    string   `json:"hlc"`
+	Fields []string `json:"fields"`
+}
+
 type Operation int
 
 const (
@@ -85,10 +92,29 @@ const (
 
 	// Higher Operations
 	UpdateCardColumn
+	// brings a deleted record back out of the trash
+	RestoreOperation
 )
 
 func (o Operation) String() string {
-	return [...]string{"insert", "update", "delete", "update-card-column"}[o-1]
+	return [...]string{"insert", "update", "delete", "update-card-column", "restore"}[o-1]
+}
+
+func OperationFromString(s string) (Operation, error) {
+	switch s {
+	case "insert":
+		return InsertOperation, nil
+	case "update":
+		return UpdateOperation, nil
+	case "delete":
+		return DeleteOperation, nil
+	case "update-card-column":
+		return UpdateCardColumn, nil
+	case "restore":
+		return RestoreOperation, nil
+	default:
+		return 0, fmt.Errorf("unknown operation type: %s", s)
+	}
 }
 
 type TableName int
@@ -128,6 +154,75 @@ type OperationSync struct {
 	PayloadData   string `json:"payload"`
 	CreatedAt     string `json:"created_at"`
 	UpdatedAt     string `json:"updated_at"`
+	HLC           string `json:"hlc"`
+	// the fields this op changed, nil means the whole record
+	Fields []string `json:"fields"`
+}
+
+const (
+	ConflictLocal  = "local"
+	ConflictRemote = "remote"
+)
+
+// SyncConflict is a record changed both here and in the cloud, Winner is the side kept for Fields, nil is all of them
+type SyncConflict struct {
+	ID         string        `json:"id"`
+	TableName  string        `json:"table_name"`
+	RecordID   string        `json:"record_id"`
+	Local      OperationSync `json:"local"`
+	Remote     OperationSync `json:"remote"`
+	Winner     string        `json:"winner"`
+	Reason     string        `json:"reason"`
+	Fields     []string      `json:"fields"`
+	CreatedAt  string        `json:"created_at"`
+	ResolvedAt string        `json:"resolved_at,omitempty"`
+}
+
+// SyncPlan is what syncing a table would do, Pull only carries op summaries and Deletes repeats both sides' deletes
+type SyncPlan struct {
+	TableName string          `json:"table_name"`
+	Push      []OperationSync `json:"push"`
+	Pull      []OperationSync `json:"pull"`
+	Conflicts []SyncConflict  `json:"conflicts"`
+	Deletes   []OperationSync `json:"deletes"`
+}
+
+type SyncBatchRequest struct {
+	TableName  string          `json:"table_name"`
+	Since      int64           `json:"since"`
+	After      string          `json:"after"`
+	Cursor     string          `json:"cursor"`
+	Limit      int             `json:"limit"`
+	Summary    bool            `json:"summary"`
+	Operations []OperationSync `json:"operations"`
+}
+
+// PullQuery selects which of the server's ops to pull, Cursor is opaque and comes from the previous page
+type PullQuery struct {
+	// After is the opaque position the last finished pull ended on, the server only falls back to Since without it
+	After     string
+	Since     int64
+	RecordIDs []string
+	Cursor    string
+	Limit     int
+	// Summary leaves payloads out
+	Summary bool
+}
+
+type SyncBatchResult struct {
+	Applied int `json:"applied"`
+	// Rejected are pushed ops the server can never apply, the rest of the batch landed
+	Rejected   []RejectedOperation `json:"rejected"`
+	Operations []OperationSync     `json:"operations"`
+	Cursor     string              `json:"cursor"`
+	HasMore    bool                `json:"has_more"`
+	// Position is how far the server's op log was pulled, empty from storage backends which have no op log
+	Position string `json:"position"`
+}
+
+type RejectedOperation struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
 }
 
 type SyncStatePayload struct {
@@ -180,11 +275,63 @@ type ExportedData struct {
 	Transcriptions []ExportedTranscription `json:"transcriptions"`
 }
 
+// TrashItem is a deleted record still waiting out the retention window, it can be restored until it's purged
+type TrashItem struct {
+	TableName string `json:"table_name"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	DeletedAt string `json:"deleted_at"`
+}
+
+// Device is an install signed in to the account, Current marks this one
+type Device struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	RevokedAt  string `json:"revoked_at,omitempty"`
+	Current    bool   `json:"current"`
+}
+
+// UserKeys is a user's end to end encryption keypair as the cloud stores it, the private key sealed with the passphrase
+type UserKeys struct {
+	PublicKey           string `json:"public_key"`
+	EncryptedPrivateKey string `json:"encrypted_private_key"`
+	Salt                string `json:"salt"`
+}
+
+type BoardKeyHolder struct {
+	UserID    string `json:"user_id"`
+	PublicKey string `json:"public_key,omitempty"`
+	HasKey    bool   `json:"has_key"`
+}
+
+// BoardKeys is the board key wrapped for this user, if they have it, and who else on the board can or does hold it
+type BoardKeys struct {
+	WrappedKey string           `json:"wrapped_key,omitempty"`
+	Members    []BoardKeyHolder `json:"members"`
+}
+
+type WrappedBoardKey struct {
+	UserID     string `json:"user_id"`
+	WrappedKey string `json:"wrapped_key"`
+}
+
+// ImportUserBoardData is a whole board, or only what changed after version Since when Since is set
 type ImportUserBoardData struct {
 	Board          ExportedBoard           `json:"board"`
 	Columns        []ExportedColumn        `json:"columns"`
 	Cards          []ExportedCard          `json:"cards"`
 	Transcriptions []ExportedTranscription `json:"transcriptions"`
+	Version        int64                   `json:"version"`
+	Since          int64                   `json:"since,omitempty"`
+	Removed        []RemovedRecord         `json:"removed,omitempty"`
+}
+
+// RemovedRecord is a record of an imported board that was deleted after the version the import started from
+type RemovedRecord struct {
+	TableName string `json:"table_name"`
+	ID        string `json:"id"`
 }
 
 type AppVersion struct {
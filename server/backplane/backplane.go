@@ -0,0 +1,110 @@
+package backplane
+
+import (
+	"context"
+	"sync"
+)
+
+// the backplane carries what one replica has to tell the clients of the others. delivery is at most once and a
+// replica doesn't hear its own messages, so only send what a client can catch up on by itself
+
+// Handler gets a payload another replica published, handlers of one replica are called one at a time
+type Handler func(payload []byte)
+
+type Backplane interface {
+	// Publish hands payload to every other replica subscribed to topic
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe calls handler with every payload another replica publishes on topic
+	Subscribe(topic string, handler Handler)
+}
+
+// Memory is a backplane inside one process, a single replica runs on one of its own and tests join several to a bus
+type Memory struct {
+	bus *memoryBus
+
+	mu       sync.Mutex
+	handlers map[string][]Handler
+	// delivered in order on the replica's own goroutine, like a listener connection would
+	queue []memoryMessage
+	ready chan struct{}
+}
+
+type memoryMessage struct {
+	topic   string
+	payload []byte
+}
+
+type memoryBus struct {
+	mu       sync.RWMutex
+	replicas []*Memory
+}
+
+func NewMemory() *Memory {
+	return (&memoryBus{}).join()
+}
+
+// Join is another replica on m's bus
+func (m *Memory) Join() *Memory {
+	return m.bus.join()
+}
+
+func (b *memoryBus) join() *Memory {
+	m := &Memory{bus: b, handlers: make(map[string][]Handler), ready: make(chan struct{}, 1)}
+	go m.run()
+
+	b.mu.Lock()
+	b.replicas = append(b.replicas, m)
+	b.mu.Unlock()
+
+	return m
+}
+
+func (m *Memory) Publish(ctx context.Context, topic string, payload []byte) error {
+	m.bus.mu.RLock()
+	defer m.bus.mu.RUnlock()
+
+	for _, r := range m.bus.replicas {
+		if r != m {
+			r.enqueue(memoryMessage{topic: topic, payload: payload})
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Subscribe(topic string, handler Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers[topic] = append(m.handlers[topic], handler)
+}
+
+func (m *Memory) enqueue(message memoryMessage) {
+	m.mu.Lock()
+	m.queue = append(m.queue, message)
+	m.mu.Unlock()
+
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Memory) run() {
+	for range m.ready {
+		m.mu.Lock()
+		queue := m.queue
+		m.queue = nil
+		m.mu.Unlock()
+
+		for _, message := range queue {
+			m.mu.Lock()
+			handlers := m.handlers[message.topic]
+			m.mu.Unlock()
+
+			for _, handler := range handlers {
+				handler(message.payload)
+			}
+		}
+	}
+}
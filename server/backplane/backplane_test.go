@@ -0,0 +1,171 @@
+package backplane
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// receiver collects what a replica gets on topic
+func receiver(b Backplane, topic string) chan []byte {
+	received := make(chan []byte, 16)
+	b.Subscribe(topic, func(payload []byte) {
+		received <- payload
+	})
+	return received
+}
+
+func expectPayload(t *testing.T, received chan []byte, want string) {
+	t.Helper()
+
+	select {
+	case payload := <-received:
+		if string(payload) != want {
+			t.Errorf("expected %d bytes starting %.20q, got %d starting %.20q", len(want), want, len(payload), payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected %.20q to get through", want)
+	}
+}
+
+func expectNothing(t *testing.T, received chan []byte) {
+	t.Helper()
+
+	select {
+	case payload := <-received:
+		t.Errorf("expected nothing, got %.20q", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// testReplicas checks a and b are two replicas on one backplane
+func testReplicas(t *testing.T, a, b Backplane) {
+	ctx := context.Background()
+	fromA, fromB := receiver(a, "rooms"), receiver(b, "rooms")
+	otherTopic := receiver(b, "sync")
+
+	t.Run("other_replica_hears", func(t *testing.T) {
+		if err := a.Publish(ctx, "rooms", []byte(`{"room_id":"board"}`)); err != nil {
+			t.Fatalf("unable to publish: %v", err)
+		}
+		expectPayload(t, fromB, `{"room_id":"board"}`)
+		expectNothing(t, fromA)
+		expectNothing(t, otherTopic)
+	})
+
+	t.Run("bigger_than_a_notification", func(t *testing.T) {
+		// multibyte text, a part boundary is bound to split a character
+		big := strings.Repeat("ünïcødé card description ", 2000)
+		if err := b.Publish(ctx, "rooms", []byte(big)); err != nil {
+			t.Fatalf("unable to publish: %v", err)
+		}
+		expectPayload(t, fromA, big)
+	})
+
+	t.Run("in_order", func(t *testing.T) {
+		for _, payload := range []string{"1", "2", "3"} {
+			if err := a.Publish(ctx, "rooms", []byte(payload)); err != nil {
+				t.Fatalf("unable to publish: %v", err)
+			}
+		}
+		for _, payload := range []string{"1", "2", "3"} {
+			expectPayload(t, fromB, payload)
+		}
+	})
+}
+
+func TestMemory(t *testing.T) {
+	a := NewMemory()
+	testReplicas(t, a, a.Join())
+}
+
+// two replicas against one database, run when DATABASE_URL points at one to use
+func TestPostgres(t *testing.T) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a channel of its own so replicas of a running server don't hear the test
+	channel := "backplane_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+
+	replica := func() *Postgres {
+		pool, err := pgxpool.New(ctx, url)
+		if err != nil {
+			t.Fatalf("unable to connect: %v", err)
+		}
+		t.Cleanup(pool.Close)
+
+		p := NewPostgres(pool, channel)
+		if err := p.Start(ctx); err != nil {
+			t.Fatalf("unable to start: %v", err)
+		}
+		return p
+	}
+
+	testReplicas(t, replica(), replica())
+}
+
+func TestAssemble(t *testing.T) {
+	sender, listener := NewPostgres(nil, Channel), NewPostgres(nil, Channel)
+	received := receiver(listener, "rooms")
+
+	big := strings.Repeat("ünïcødé", 3000)
+	notifications, err := sender.notifications("rooms", []byte(big))
+	if err != nil {
+		t.Fatalf("unable to encode: %v", err)
+	}
+	if len(notifications) < 2 {
+		t.Fatalf("expected the message to be split, got %d part", len(notifications))
+	}
+
+	now := time.Now()
+
+	t.Run("parts_make_the_message", func(t *testing.T) {
+		for _, n := range notifications {
+			if len(n) >= 8000 {
+				t.Errorf("expected a notification under 8000 bytes, got %d", len(n))
+			}
+			listener.handle(n, now)
+		}
+		expectPayload(t, received, big)
+		if len(listener.partial) != 0 {
+			t.Errorf("expected nothing left over, got %d partial messages", len(listener.partial))
+		}
+	})
+
+	t.Run("own_messages_ignored", func(t *testing.T) {
+		for _, n := range notifications {
+			sender.handle(n, now)
+		}
+		if len(sender.partial) != 0 {
+			t.Errorf("expected a replica to skip its own parts, got %d partial messages", len(sender.partial))
+		}
+	})
+
+	t.Run("incomplete_expires", func(t *testing.T) {
+		listener.handle(notifications[0], now)
+		if len(listener.partial) != 1 {
+			t.Fatalf("expected the first part to wait for the rest, got %d partial messages", len(listener.partial))
+		}
+
+		// the rest turning up that late starts over rather than completing what's stale
+		later := now.Add(partialTTL + time.Second)
+		listener.handle(notifications[len(notifications)-1], later)
+		expectNothing(t, received)
+
+		for _, partial := range listener.partial {
+			if partial.received != 1 || !partial.started.Equal(later) {
+				t.Errorf("expected the stale parts to be dropped, got %d parts from %v", partial.received, partial.started)
+			}
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package backplane
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Channel is the postgres channel replicas of the server talk on
+const Channel = "seisami_backplane"
+
+const (
+	// a notification's payload has to stay under 8000 bytes, a message bigger than a part goes out in several
+	partSize = 7000
+	// parts of a message come in one transaction, whatever's still incomplete after this never will be
+	partialTTL = time.Minute
+)
+
+// Postgres is a backplane over LISTEN/NOTIFY on the database every replica already shares
+type Postgres struct {
+	pool    *pgxpool.Pool
+	channel string
+	origin  string
+
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+
+	// only touched by the listener goroutine
+	partial map[string]*partialMessage
+}
+
+type notification struct {
+	Origin string `json:"origin"`
+	ID     string `json:"id"`
+	Part   int    `json:"part"`
+	Parts  int    `json:"parts"`
+	// base64 of the encoded message, or of its part, a multibyte character split in two isn't valid text
+	Data string `json:"data"`
+}
+
+type message struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+}
+
+type partialMessage struct {
+	parts    []string
+	received int
+	started  time.Time
+}
+
+func NewPostgres(pool *pgxpool.Pool, channel string) *Postgres {
+	return &Postgres{
+		pool:     pool,
+		channel:  channel,
+		origin:   uuid.NewString(),
+		handlers: make(map[string][]Handler),
+		partial:  make(map[string]*partialMessage),
+	}
+}
+
+// Start listens on its own connection until ctx is done, it returns once the first LISTEN went through so nothing
+// published after is missed, a connection lost later is reconnected
+func (p *Postgres) Start(ctx context.Context) error {
+	conn, err := p.listen(ctx)
+	if err != nil {
+		return err
+	}
+
+	go p.receive(ctx, conn)
+	return nil
+}
+
+func (p *Postgres) Publish(ctx context.Context, topic string, payload []byte) error {
+	notifications, err := p.notifications(topic, payload)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, n := range notifications {
+		if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", p.channel, n); err != nil {
+			return fmt.Errorf("unable to notify %s: %v", p.channel, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit notifications: %v", err)
+	}
+
+	return nil
+}
+
+// notifications are the payloads of the notifications a message goes out as, in order
+func (p *Postgres) notifications(topic string, payload []byte) ([]string, error) {
+	encoded, err := json.Marshal(message{Topic: topic, Payload: payload})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode message: %v", err)
+	}
+
+	data := base64.StdEncoding.EncodeToString(encoded)
+	parts := (len(data) + partSize - 1) / partSize
+	id := uuid.NewString()
+
+	notifications := make([]string, 0, parts)
+	for i := range parts {
+		n, err := json.Marshal(notification{
+			Origin: p.origin,
+			ID:     id,
+			Part:   i,
+			Parts:  parts,
+			Data:   data[i*partSize : min((i+1)*partSize, len(data))],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode notification: %v", err)
+		}
+		notifications = append(notifications, string(n))
+	}
+
+	return notifications, nil
+}
+
+func (p *Postgres) Subscribe(topic string, handler Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers[topic] = append(p.handlers[topic], handler)
+}
+
+// listen takes a connection out of the pool for good, a listening connection can't serve queries
+func (p *Postgres) listen(ctx context.Context) (*pgx.Conn, error) {
+	pooled, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire listener connection: %v", err)
+	}
+
+	conn := pooled.Hijack()
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{p.channel}.Sanitize()); err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("unable to listen on %s: %v", p.channel, err)
+	}
+
+	return conn, nil
+}
+
+func (p *Postgres) receive(ctx context.Context, conn *pgx.Conn) {
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err == nil {
+			p.handle(n.Payload, time.Now())
+			continue
+		}
+
+		conn.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("backplane listener lost its connection: %v", err)
+
+		// what's published until it's back is missed
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+
+			conn, err = p.listen(ctx)
+			if err == nil {
+				break
+			}
+			log.Printf("unable to reconnect backplane listener: %v", err)
+		}
+	}
+}
+
+func (p *Postgres) handle(raw string, now time.Time) {
+	var n notification
+	if err := json.Unmarshal([]byte(raw), &n); err != nil {
+		log.Printf("unreadable backplane notification: %v", err)
+		return
+	}
+
+	if n.Origin == p.origin {
+		return
+	}
+
+	data, ok := p.assemble(n, now)
+	if !ok {
+		return
+	}
+
+	encoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		log.Printf("unreadable backplane message %s: %v", n.ID, err)
+		return
+	}
+
+	var m message
+	if err := json.Unmarshal(encoded, &m); err != nil {
+		log.Printf("unreadable backplane message %s: %v", n.ID, err)
+		return
+	}
+
+	p.mu.RLock()
+	handlers := p.handlers[m.Topic]
+	p.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(m.Payload)
+	}
+}
+
+// assemble collects the parts of n's message, ok once the last one is in
+func (p *Postgres) assemble(n notification, now time.Time) (string, bool) {
+	if n.Parts <= 1 {
+		return n.Data, true
+	}
+
+	for id, partial := range p.partial {
+		if now.Sub(partial.started) > partialTTL {
+			delete(p.partial, id)
+		}
+	}
+
+	if n.Part < 0 || n.Part >= n.Parts {
+		log.Printf("backplane message %s has no part %d", n.ID, n.Part)
+		return "", false
+	}
+
+	partial, ok := p.partial[n.ID]
+	if !ok {
+		partial = &partialMessage{parts: make([]string, n.Parts), started: now}
+		p.partial[n.ID] = partial
+	}
+	if len(partial.parts) != n.Parts || partial.parts[n.Part] != "" {
+		return "", false
+	}
+
+	partial.parts[n.Part] = n.Data
+	partial.received++
+	if partial.received < n.Parts {
+		return "", false
+	}
+
+	delete(p.partial, n.ID)
+
+	return strings.Join(partial.parts, ""), true
+}
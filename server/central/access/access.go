@@ -0,0 +1,179 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seisami/server/centraldb"
+	"seisami/server/types"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// every record sits in a board, so access to it comes down to the user's role on that board. callers check here
+// before touching a record, the queries don't check again
+
+type Permission int
+
+const (
+	// Read sees a board and everything on it
+	Read Permission = iota + 1
+	// Comment talks about what's on a board without changing it
+	Comment
+	// Write changes what's on a board
+	Write
+	// Manage changes who is on a board and what they may do
+	Manage
+	// Own deletes and restores the board itself and appoints admins
+	Own
+)
+
+var (
+	ErrForbidden = errors.New("not allowed on this board")
+	ErrNotFound  = errors.New("record not found")
+)
+
+// NotMemberError is the ErrForbidden of a user who isn't on BoardID at all, a device still syncing it has lost it
+type NotMemberError struct {
+	UserID  uuid.UUID
+	BoardID uuid.UUID
+}
+
+func (e *NotMemberError) Error() string {
+	return fmt.Sprintf("%v: user %s is not a member of board %s", ErrForbidden, e.UserID, e.BoardID)
+}
+
+func (e *NotMemberError) Unwrap() error {
+	return ErrForbidden
+}
+
+// Store is the part of centraldb an Authorizer reads
+type Store interface {
+	GetBoardMemberRole(ctx context.Context, arg centraldb.GetBoardMemberRoleParams) (pgtype.Text, error)
+	GetRecordBoard(ctx context.Context, arg centraldb.GetRecordBoardParams) (pgtype.UUID, error)
+}
+
+// Record points at one row of a synced table
+type Record struct {
+	Table string
+	ID    string
+}
+
+type Authorizer struct {
+	store Store
+}
+
+func New(store Store) *Authorizer {
+	return &Authorizer{store: store}
+}
+
+// allows is what each role may do, every role may do what the roles below it may
+func allows(role string, p Permission) bool {
+	switch role {
+	case types.BoardOwnerRole.String():
+		return true
+	case types.BoardAdminRole.String():
+		return p <= Manage
+	case types.BoardEditorRole.String(), types.BoardMemberRole.String():
+		return p <= Write
+	case types.BoardCommenterRole.String():
+		return p <= Comment
+	case types.BoardViewerRole.String():
+		return p <= Read
+	default:
+		return false
+	}
+}
+
+// Role is userID's role on boardID, ErrForbidden when they aren't a member
+func (a *Authorizer) Role(ctx context.Context, userID, boardID uuid.UUID) (string, error) {
+	role, err := a.store.GetBoardMemberRole(ctx, centraldb.GetBoardMemberRoleParams{
+		BoardID: pgtype.UUID{Bytes: boardID, Valid: true},
+		UserID:  pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", &NotMemberError{UserID: userID, BoardID: boardID}
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to get board role: %v", err)
+	}
+
+	// the column defaults to member, a row without one is a plain member
+	if !role.Valid || role.String == "" {
+		return types.BoardMemberRole.String(), nil
+	}
+
+	return role.String, nil
+}
+
+// Board checks userID may do p on boardID
+func (a *Authorizer) Board(ctx context.Context, userID, boardID uuid.UUID, p Permission) error {
+	role, err := a.Role(ctx, userID, boardID)
+	if err != nil {
+		return err
+	}
+
+	if !allows(role, p) {
+		return fmt.Errorf("%w: %s of board %s can't do that", ErrForbidden, role, boardID)
+	}
+
+	return nil
+}
+
+// ManageMember checks userID may change or remove a member of boardID who has role. managers handle viewers,
+// commenters and editors, only the owner handles admins and nobody handles the owner
+func (a *Authorizer) ManageMember(ctx context.Context, userID, boardID uuid.UUID, role string) error {
+	need := Manage
+	switch role {
+	case types.BoardOwnerRole.String():
+		return fmt.Errorf("%w: the owner of board %s can't be changed", ErrForbidden, boardID)
+	case types.BoardAdminRole.String():
+		need = Own
+	}
+
+	return a.Board(ctx, userID, boardID, need)
+}
+
+// BoardOf is the board r sits in, ErrNotFound when there's no such record
+func (a *Authorizer) BoardOf(ctx context.Context, r Record) (uuid.UUID, error) {
+	boardID, err := a.store.GetRecordBoard(ctx, centraldb.GetRecordBoardParams{
+		TableName: r.Table,
+		RecordID:  r.ID,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("unable to find the board of %s %s: %v", r.Table, r.ID, err)
+	}
+	if !boardID.Valid {
+		return uuid.Nil, fmt.Errorf("%w: %s %s", ErrNotFound, r.Table, r.ID)
+	}
+
+	return boardID.Bytes, nil
+}
+
+// Record checks userID may do p on the board r sits in and returns that board
+func (a *Authorizer) Record(ctx context.Context, userID uuid.UUID, r Record, p Permission) (uuid.UUID, error) {
+	boardID, err := a.BoardOf(ctx, r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return boardID, a.Board(ctx, userID, boardID, p)
+}
+
+// Write checks userID may write r into parent. an existing record needs p on its current board and the parent has to
+// take writes too, a new record without a parent is a new board which anyone may create
+func (a *Authorizer) Write(ctx context.Context, userID uuid.UUID, r Record, parent *Record, p Permission) error {
+	_, err := a.Record(ctx, userID, r, p)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	if parent == nil {
+		return nil
+	}
+
+	_, err = a.Record(ctx, userID, *parent, Write)
+	return err
+}
@@ -0,0 +1,180 @@
+package access_test
+
+import (
+	"context"
+	"errors"
+	"seisami/server/central/access"
+	"seisami/server/central/access/accesstest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var (
+	owner     = uuid.New()
+	admin     = uuid.New()
+	editor    = uuid.New()
+	member    = uuid.New()
+	commenter = uuid.New()
+	viewer    = uuid.New()
+	outsider  = uuid.New()
+
+	board      = uuid.New()
+	otherBoard = uuid.New()
+)
+
+func newTestAuthorizer() *access.Authorizer {
+	return access.New(&accesstest.Store{
+		Roles: map[[2]uuid.UUID]string{
+			{board, owner}:       "owner",
+			{board, admin}:       "admin",
+			{board, editor}:      "editor",
+			{board, member}:      "member",
+			{board, commenter}:   "commenter",
+			{board, viewer}:      "viewer",
+			{otherBoard, member}: "",
+		},
+		Records: map[access.Record]uuid.UUID{
+			{Table: "boards", ID: board.String()}:      board,
+			{Table: "boards", ID: otherBoard.String()}: otherBoard,
+			{Table: "columns", ID: "todo"}:             board,
+			{Table: "columns", ID: "elsewhere"}:        otherBoard,
+			{Table: "cards", ID: "card-1"}:             board,
+		},
+	})
+}
+
+func TestBoard(t *testing.T) {
+	a := newTestAuthorizer()
+
+	tests := []struct {
+		name  string
+		user  uuid.UUID
+		board uuid.UUID
+		p     access.Permission
+		allow bool
+	}{
+		{"owner_reads", owner, board, access.Read, true},
+		{"owner_owns", owner, board, access.Own, true},
+		{"admin_manages", admin, board, access.Manage, true},
+		{"admin_cant_own", admin, board, access.Own, false},
+		{"editor_writes", editor, board, access.Write, true},
+		{"editor_cant_manage", editor, board, access.Manage, false},
+		{"member_reads", member, board, access.Read, true},
+		{"member_writes", member, board, access.Write, true},
+		{"member_cant_manage", member, board, access.Manage, false},
+		{"member_cant_own", member, board, access.Own, false},
+		{"commenter_comments", commenter, board, access.Comment, true},
+		{"commenter_cant_write", commenter, board, access.Write, false},
+		{"viewer_reads", viewer, board, access.Read, true},
+		{"viewer_cant_comment", viewer, board, access.Comment, false},
+		{"viewer_cant_write", viewer, board, access.Write, false},
+		{"role_less_member_writes", member, otherBoard, access.Write, true},
+		{"outsider_cant_read", outsider, board, access.Read, false},
+		{"outsider_cant_write", outsider, board, access.Write, false},
+		{"owner_of_one_board_cant_read_another", owner, otherBoard, access.Read, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.Board(context.Background(), tt.user, tt.board, tt.p)
+			if tt.allow && err != nil {
+				t.Errorf("expected access, got %v", err)
+			}
+			if !tt.allow && !errors.Is(err, access.ErrForbidden) {
+				t.Errorf("expected ErrForbidden, got %v", err)
+			}
+		})
+	}
+}
+
+func TestManageMember(t *testing.T) {
+	a := newTestAuthorizer()
+
+	tests := []struct {
+		name  string
+		user  uuid.UUID
+		role  string
+		allow bool
+	}{
+		{"owner_manages_admins", owner, "admin", true},
+		{"admin_manages_editors", admin, "editor", true},
+		{"admin_manages_viewers", admin, "viewer", true},
+		{"admin_cant_manage_admins", admin, "admin", false},
+		{"nobody_manages_the_owner", owner, "owner", false},
+		{"editor_cant_manage_viewers", editor, "viewer", false},
+		{"outsider_cant_manage", outsider, "viewer", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.ManageMember(context.Background(), tt.user, board, tt.role)
+			if tt.allow && err != nil {
+				t.Errorf("expected access, got %v", err)
+			}
+			if !tt.allow && !errors.Is(err, access.ErrForbidden) {
+				t.Errorf("expected ErrForbidden, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	a := newTestAuthorizer()
+
+	boardID, err := a.Record(context.Background(), member, access.Record{Table: "Cards", ID: "card-1"}, access.Write)
+	if err != nil || boardID != board {
+		t.Errorf("expected card-1 to resolve to its board, got %s (%v)", boardID, err)
+	}
+
+	_, err = a.Record(context.Background(), outsider, access.Record{Table: "cards", ID: "card-1"}, access.Read)
+	var notMember *access.NotMemberError
+	if !errors.Is(err, access.ErrForbidden) || !errors.As(err, &notMember) || notMember.BoardID != board {
+		t.Errorf("expected ErrForbidden naming the board, got %v", err)
+	}
+
+	if _, err := a.Record(context.Background(), viewer, access.Record{Table: "cards", ID: "card-1"}, access.Write); errors.As(err, &notMember) {
+		t.Errorf("expected a viewer to stay a member when refused, got %v", err)
+	}
+
+	if _, err := a.Record(context.Background(), owner, access.Record{Table: "cards", ID: "missing"}, access.Read); !errors.Is(err, access.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	a := newTestAuthorizer()
+
+	tests := []struct {
+		name   string
+		user   uuid.UUID
+		record access.Record
+		parent *access.Record
+		p      access.Permission
+		want   error
+	}{
+		{"anyone_creates_a_board", outsider, access.Record{Table: "boards", ID: uuid.NewString()}, nil, access.Write, nil},
+		{"member_adds_a_card", member, access.Record{Table: "cards", ID: "card-2"}, &access.Record{Table: "columns", ID: "todo"}, access.Write, nil},
+		{"member_moves_a_card_between_their_boards", member, access.Record{Table: "cards", ID: "card-1"}, &access.Record{Table: "columns", ID: "elsewhere"}, access.Write, nil},
+		{"outsider_cant_take_over_a_board", outsider, access.Record{Table: "boards", ID: board.String()}, nil, access.Write, access.ErrForbidden},
+		{"outsider_cant_add_to_a_board", outsider, access.Record{Table: "columns", ID: "new"}, &access.Record{Table: "boards", ID: board.String()}, access.Write, access.ErrForbidden},
+		{"outsider_cant_move_a_card_out", outsider, access.Record{Table: "cards", ID: "card-1"}, &access.Record{Table: "columns", ID: "theirs"}, access.Write, access.ErrForbidden},
+		{"owner_cant_move_a_card_into_a_board_they_arent_on", owner, access.Record{Table: "cards", ID: "card-1"}, &access.Record{Table: "columns", ID: "elsewhere"}, access.Write, access.ErrForbidden},
+		{"member_cant_delete_the_board", member, access.Record{Table: "boards", ID: board.String()}, nil, access.Own, access.ErrForbidden},
+		{"viewer_cant_add_a_card", viewer, access.Record{Table: "cards", ID: "card-2"}, &access.Record{Table: "columns", ID: "todo"}, access.Write, access.ErrForbidden},
+		{"commenter_cant_change_a_card", commenter, access.Record{Table: "cards", ID: "card-1"}, &access.Record{Table: "columns", ID: "todo"}, access.Write, access.ErrForbidden},
+		{"missing_parent", owner, access.Record{Table: "cards", ID: "card-2"}, &access.Record{Table: "columns", ID: "missing"}, access.Write, access.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.Write(context.Background(), tt.user, tt.record, tt.parent, tt.p)
+			if tt.want == nil && err != nil {
+				t.Errorf("expected the write to be allowed, got %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Package accesstest holds an in-memory membership store for tests of code that checks board access
+package accesstest
+
+import (
+	"context"
+	"seisami/server/central/access"
+	"seisami/server/centraldb"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Store answers the reads access.New needs from maps, a member with an empty role is on the board without a role
+type Store struct {
+	// roles by {board, user}
+	Roles   map[[2]uuid.UUID]string
+	Records map[access.Record]uuid.UUID
+}
+
+func (s *Store) GetBoardMemberRole(ctx context.Context, arg centraldb.GetBoardMemberRoleParams) (pgtype.Text, error) {
+	role, ok := s.Roles[[2]uuid.UUID{arg.BoardID.Bytes, arg.UserID.Bytes}]
+	if !ok {
+		return pgtype.Text{}, pgx.ErrNoRows
+	}
+	return pgtype.Text{String: role, Valid: role != ""}, nil
+}
+
+func (s *Store) GetRecordBoard(ctx context.Context, arg centraldb.GetRecordBoardParams) (pgtype.UUID, error) {
+	boardID, ok := s.Records[access.Record{Table: strings.ToLower(arg.TableName), ID: arg.RecordID}]
+	if !ok {
+		return pgtype.UUID{}, nil
+	}
+	return pgtype.UUID{Bytes: boardID, Valid: true}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"seisami/server/central/access"
 	"seisami/server/central/tools"
 	"seisami/server/centraldb"
 	"seisami/server/synchub"
@@ -12,17 +13,19 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/sashabaranov/go-openai"
 )
 
 type Action struct {
 	openAIAPIKey string
 	queries      *centraldb.Queries
+	access       *access.Authorizer
+	// hub tells the user's devices what the AI changed
+	hub *synchub.SyncHub
 }
 
-func NewAction(apiKey string, queries *centraldb.Queries) *Action {
-	return &Action{openAIAPIKey: apiKey, queries: queries}
+func NewAction(apiKey string, queries *centraldb.Queries, hub *synchub.SyncHub) *Action {
+	return &Action{openAIAPIKey: apiKey, queries: queries, access: access.New(queries), hub: hub}
 }
 
 // SSE event types
@@ -117,7 +120,7 @@ func (a *Action) ProcessTranscriptionWithSSE(ctx context.Context, userID uuid.UU
 		return nil, fmt.Errorf("invalid board ID: %w", err)
 	}
 
-	err = a.ensureBoardAccess(ctx, boardUUID, userID)
+	err = a.access.Board(ctx, userID, boardUUID, access.Write)
 	if err != nil {
 		return nil, fmt.Errorf("board access denied: %w", err)
 	}
@@ -133,11 +136,11 @@ func (a *Action) ProcessTranscriptionWithSSE(ctx context.Context, userID uuid.UU
 
 	openAiClient := openai.NewClient(a.openAIAPIKey)
 
-	toolsInstance := tools.NewTools(a.queries, ctx, userID, boardUUID)
+	toolsInstance := tools.NewTools(a.queries, a.access, ctx, userID, boardUUID)
 
 	toolsInstance.NotifySync = func(uid, tableName string) {
-		if hub := synchub.Get(); hub != nil {
-			hub.NotifyUserSync(uid, tableName)
+		if a.hub != nil {
+			a.hub.NotifyUserSync(uid, tableName)
 		}
 	}
 
@@ -276,20 +279,3 @@ func (a *Action) handleToolCallsWithSSE(ctx context.Context, client *openai.Clie
 
 	return currentMessage.Content, nil
 }
-
-// TODO: copied this from sync_service, unify things later
-func (a *Action) ensureBoardAccess(ctx context.Context, boardID, userID uuid.UUID) error {
-	hasAccess, err := a.queries.ValidateBoardAccess(ctx, centraldb.ValidateBoardAccessParams{
-		BoardID: pgtype.UUID{Bytes: boardID, Valid: true},
-		UserID:  pgtype.UUID{Bytes: userID, Valid: true},
-	})
-	if err != nil {
-		return fmt.Errorf("error validating board access: %v", err)
-	}
-
-	if !hasAccess {
-		return fmt.Errorf("user %s does not have access to board %s", userID, boardID)
-	}
-
-	return nil
-}
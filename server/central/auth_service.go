@@ -3,10 +3,12 @@ package central
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -24,6 +26,8 @@ var (
 	ErrUserNotFound         = errors.New("user not found")
 	ErrInvalidResetToken    = errors.New("invalid or expired reset token")
 	ErrInvalidOrExpiredCode = errors.New("invalid or expired code")
+	ErrSessionRevoked       = errors.New("session revoked")
+	ErrInvalidVerification  = errors.New("invalid or expired verification link")
 )
 
 type AuthService struct {
@@ -32,6 +36,9 @@ type AuthService struct {
 	jwtExpiration        time.Duration
 	resetTokenExpiration time.Duration
 	versionKey           string
+	verifyExpiration     time.Duration
+	publicURL            string
+	mailer               Mailer
 }
 
 type AuthResult struct {
@@ -47,6 +54,9 @@ func NewAuthService(queries *centraldb.Queries, cfg Config) *AuthService {
 		jwtExpiration:        cfg.JWTExpiration,
 		resetTokenExpiration: cfg.ResetTokenExpiration,
 		versionKey:           cfg.VERSION_SECURE_KEY,
+		verifyExpiration:     cfg.EmailVerificationExpiration,
+		publicURL:            cfg.PublicURL,
+		mailer:               newMailer(cfg),
 	}
 }
 
@@ -140,6 +150,61 @@ func (s *AuthService) ForgotPassword(ctx context.Context, email string) (string,
 	return token, expiresAt, nil
 }
 
+// SendEmailVerification mails userID a link that verifies the email their account has now, nothing when it's verified
+func (s *AuthService) SendEmailVerification(ctx context.Context, userID string) error {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user id: %w", err)
+	}
+
+	user, err := s.queries.GetUserByID(ctx, pgtype.UUID{Bytes: id, Valid: true})
+	if err != nil {
+		return fmt.Errorf("lookup user: %w", err)
+	}
+	if user.EmailVerifiedAt.Valid {
+		return nil
+	}
+
+	token, err := generateSecureCode(32)
+	if err != nil {
+		return fmt.Errorf("generate verification token: %w", err)
+	}
+	expiresAt := time.Now().Add(s.verifyExpiration)
+
+	err = s.queries.CreateEmailVerification(ctx, centraldb.CreateEmailVerificationParams{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("store verification token: %w", err)
+	}
+
+	link := s.publicURL + "/auth/verify-email?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Open this link to verify your email for Seisami:\n\n%s\n\nThe link works until %s.", link, expiresAt.UTC().Format(time.RFC1123))
+
+	return s.mailer.Send(ctx, user.Email, "Verify your email", body)
+}
+
+// VerifyEmail marks the email token was mailed to as verified
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	_, err := s.queries.VerifyEmail(ctx, hashToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidVerification
+	}
+	if err != nil {
+		return fmt.Errorf("verify email: %w", err)
+	}
+
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
 	user, err := s.queries.GetUserByResetToken(ctx, pgtype.Text{String: token, Valid: true})
 	if err != nil {
@@ -165,7 +230,9 @@ func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword stri
 }
 
 func (s *AuthService) generateToken(userID string) (string, error) {
+	// every token is a session of its own, revoking the device that holds it ends it
 	claims := jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
 		Subject:   userID,
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.jwtExpiration)),
@@ -175,6 +242,36 @@ func (s *AuthService) generateToken(userID string) (string, error) {
 	return token.SignedString(s.jwtSecret)
 }
 
+// verifyToken checks the token's signature and expiry, and that its session wasn't ended by revoking its device
+func (s *AuthService) verifyToken(ctx context.Context, tokenString string) (*jwt.RegisteredClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return s.jwtSecret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if claims.ID != "" {
+		revoked, err := s.queries.IsSessionRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, fmt.Errorf("lookup session: %w", err)
+		}
+		if revoked {
+			return nil, ErrSessionRevoked
+		}
+	}
+
+	return claims, nil
+}
+
 // uuidFromPgtype converts a pgtype.UUID to its string representation.
 func uuidFromPgtype(id pgtype.UUID) (string, error) {
 	if !id.Valid {
@@ -267,3 +364,9 @@ func (s *AuthService) GetUserIDFromContext(ctx context.Context) (string, error)
 	}
 	return userId, nil
 }
+
+// sessionIDFromContext is the session of the request's token, "" for tokens issued before sessions existed
+func sessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(SessionContextKey).(string)
+	return sessionID
+}
@@ -0,0 +1,121 @@
+package central
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"seisami/server/central/access"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// authorizeOperation checks userUUID may apply op before anything is written, on the record's board and on wherever
+// op puts it. deleting or restoring a whole board is for its owner
+func (s *SyncService) authorizeOperation(ctx context.Context, userUUID uuid.UUID, op SyncOperation) error {
+	record, parent, err := operationRecords(op)
+	if err != nil {
+		return err
+	}
+
+	need := access.Write
+	if record.Table == "boards" && isTombstoneOperation(op) {
+		need = access.Own
+	}
+
+	return s.access.Write(ctx, userUUID, record, parent, need)
+}
+
+func isTombstoneOperation(op SyncOperation) bool {
+	return strings.EqualFold(op.OperationType, "delete") || strings.EqualFold(op.OperationType, "restore")
+}
+
+// operationRecords reads the record op writes and the record it goes into out of op, the same way the handlers do
+func operationRecords(op SyncOperation) (access.Record, *access.Record, error) {
+	table := strings.ToLower(op.TableName)
+	record := access.Record{Table: table, ID: op.RecordID}
+
+	if isTombstoneOperation(op) {
+		return record, nil, nil
+	}
+
+	var parent access.Record
+	var err error
+	switch table {
+	case "boards":
+		var payload boardPayload
+		if strings.TrimSpace(op.Payload) != "" {
+			if err := json.Unmarshal([]byte(op.Payload), &payload); err != nil {
+				return record, nil, fmt.Errorf("decode board payload: %w", err)
+			}
+		}
+		if record.ID, err = payloadRecordID(op, payload.ID); err != nil {
+			return record, nil, err
+		}
+		return record, nil, nil
+
+	case "columns":
+		var payload columnPayload
+		if err := json.Unmarshal([]byte(op.Payload), &payload); err != nil {
+			return record, nil, fmt.Errorf("decode column payload: %w", err)
+		}
+		if record.ID, err = payloadRecordID(op, payload.ID); err != nil {
+			return record, nil, err
+		}
+		parent = access.Record{Table: "boards", ID: payload.BoardID}
+
+	case "cards":
+		if strings.EqualFold(op.OperationType, "update-card-column") {
+			var payload cardColumnPayload
+			if err := json.Unmarshal([]byte(op.Payload), &payload); err != nil {
+				return record, nil, fmt.Errorf("decode card column payload: %w", err)
+			}
+			if record.ID, err = payloadRecordID(op, payload.CardID); err != nil {
+				return record, nil, err
+			}
+			parent = access.Record{Table: "columns", ID: payload.NewColumn.ID}
+			break
+		}
+
+		var payload cardOperationPayload
+		if err := json.Unmarshal([]byte(op.Payload), &payload); err != nil {
+			return record, nil, fmt.Errorf("decode card payload: %w", err)
+		}
+		if record.ID, err = payloadRecordID(op, payload.Card.ID); err != nil {
+			return record, nil, err
+		}
+		parent = access.Record{Table: "columns", ID: payload.Column.ID}
+
+	case "transcriptions":
+		var payload transcriptionPayload
+		if err := json.Unmarshal([]byte(op.Payload), &payload); err != nil {
+			return record, nil, fmt.Errorf("decode transcription payload: %w", err)
+		}
+		if record.ID, err = payloadRecordID(op, payload.ID); err != nil {
+			return record, nil, err
+		}
+		parent = access.Record{Table: "boards", ID: payload.BoardID}
+
+	default:
+		return record, nil, fmt.Errorf("%w: %s", errUnsupportedTable, op.TableName)
+	}
+
+	// a payload that doesn't say where the record goes is refused by its handler, nothing is written
+	if parent.ID == "" {
+		return record, nil, nil
+	}
+
+	return record, &parent, nil
+}
+
+// payloadRecordID is the record a payload names, it has to be op's own or one record is checked and another written
+func payloadRecordID(op SyncOperation, payloadID string) (string, error) {
+	switch {
+	case payloadID == "":
+		return op.RecordID, nil
+	case op.RecordID == "" || op.RecordID == payloadID:
+		return payloadID, nil
+	default:
+		return "", fmt.Errorf("%w: op is for record %s but its payload is for %s", access.ErrForbidden, op.RecordID, payloadID)
+	}
+}
@@ -0,0 +1,305 @@
+package central
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"seisami/server/central/access"
+	"seisami/server/central/access/accesstest"
+	"seisami/server/types"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// the service below has no database, so a check that went missing panics on a nil pointer instead of passing
+
+var (
+	ownerID     = uuid.New()
+	adminID     = uuid.New()
+	memberID    = uuid.New()
+	commenterID = uuid.New()
+	viewerID    = uuid.New()
+	outsiderID  = uuid.New()
+
+	// sharedBoard is owned by ownerID and shared with someone of every other role, outsiderID only has their own board
+	sharedBoard   = uuid.New()
+	outsiderBoard = uuid.New()
+)
+
+const testTimestamp = "2025-01-01T00:00:00Z"
+
+func newAuthorizedService() *SyncService {
+	return &SyncService{access: access.New(&accesstest.Store{
+		Roles: map[[2]uuid.UUID]string{
+			{sharedBoard, ownerID}:      types.BoardOwnerRole.String(),
+			{sharedBoard, adminID}:      types.BoardAdminRole.String(),
+			{sharedBoard, memberID}:     types.BoardMemberRole.String(),
+			{sharedBoard, commenterID}:  types.BoardCommenterRole.String(),
+			{sharedBoard, viewerID}:     types.BoardViewerRole.String(),
+			{outsiderBoard, outsiderID}: types.BoardOwnerRole.String(),
+		},
+		Records: map[access.Record]uuid.UUID{
+			{Table: "boards", ID: sharedBoard.String()}:   sharedBoard,
+			{Table: "boards", ID: outsiderBoard.String()}: outsiderBoard,
+			{Table: "columns", ID: "shared-column"}:       sharedBoard,
+			{Table: "columns", ID: "outsider-column"}:     outsiderBoard,
+			{Table: "cards", ID: "shared-card"}:           sharedBoard,
+			{Table: "cards", ID: "outsider-card"}:         outsiderBoard,
+			{Table: "transcriptions", ID: "shared-note"}:  sharedBoard,
+		},
+	})}
+}
+
+func payload(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("unable to encode payload: %v", err)
+	}
+	return string(b)
+}
+
+func cardOp(t *testing.T, opType, cardID, columnID string) SyncOperation {
+	var p cardOperationPayload
+	p.Card.ID = cardID
+	p.Column.ID = columnID
+	return SyncOperation{ID: uuid.NewString(), TableName: "cards", RecordID: cardID, OperationType: opType, Payload: payload(t, p)}
+}
+
+func moveCardOp(t *testing.T, cardID, columnID string) SyncOperation {
+	var p cardColumnPayload
+	p.CardID = cardID
+	p.NewColumn.ID = columnID
+	return SyncOperation{ID: uuid.NewString(), TableName: "cards", RecordID: cardID, OperationType: "update-card-column", Payload: payload(t, p)}
+}
+
+func TestOperationAuthorization(t *testing.T) {
+	shared := sharedBoard.String()
+
+	boardOp := func(opType, boardID string) SyncOperation {
+		return SyncOperation{ID: uuid.NewString(), TableName: "boards", RecordID: boardID, OperationType: opType,
+			Payload: payload(t, boardPayload{ID: boardID, Name: "Roadmap", CreatedAt: testTimestamp, UpdatedAt: testTimestamp})}
+	}
+	columnOp := func(opType, columnID, boardID string) SyncOperation {
+		return SyncOperation{ID: uuid.NewString(), TableName: "columns", RecordID: columnID, OperationType: opType,
+			Payload: payload(t, columnPayload{ID: columnID, BoardID: boardID, Name: "Doing", CreatedAt: testTimestamp, UpdatedAt: testTimestamp})}
+	}
+	transcriptionOp := func(opType, id, boardID string) SyncOperation {
+		return SyncOperation{ID: uuid.NewString(), TableName: "transcriptions", RecordID: id, OperationType: opType,
+			Payload: payload(t, transcriptionPayload{ID: id, BoardID: boardID, CreatedAt: testTimestamp, UpdatedAt: testTimestamp})}
+	}
+	tombstone := func(table, opType, id string) SyncOperation {
+		return SyncOperation{ID: uuid.NewString(), TableName: table, RecordID: id, OperationType: opType}
+	}
+
+	tests := []struct {
+		name  string
+		user  uuid.UUID
+		op    SyncOperation
+		allow bool
+	}{
+		{"outsider_updates_board", outsiderID, boardOp("update", shared), false},
+		{"outsider_deletes_board", outsiderID, tombstone("boards", "delete", shared), false},
+		{"outsider_restores_board", outsiderID, tombstone("boards", "restore", shared), false},
+		{"outsider_inserts_column", outsiderID, columnOp("insert", "new-column", shared), false},
+		{"outsider_updates_column", outsiderID, columnOp("update", "shared-column", shared), false},
+		{"outsider_moves_column_to_their_board", outsiderID, columnOp("update", "shared-column", outsiderBoard.String()), false},
+		{"outsider_deletes_column", outsiderID, tombstone("columns", "delete", "shared-column"), false},
+		{"outsider_restores_column", outsiderID, tombstone("columns", "restore", "shared-column"), false},
+		{"outsider_inserts_card", outsiderID, cardOp(t, "insert", "new-card", "shared-column"), false},
+		{"outsider_updates_card", outsiderID, cardOp(t, "update", "shared-card", "shared-column"), false},
+		{"outsider_pulls_card_into_their_column", outsiderID, cardOp(t, "update", "shared-card", "outsider-column"), false},
+		{"outsider_moves_card", outsiderID, moveCardOp(t, "shared-card", "outsider-column"), false},
+		{"outsider_pushes_card_into_board", outsiderID, moveCardOp(t, "outsider-card", "shared-column"), false},
+		{"outsider_deletes_card", outsiderID, tombstone("cards", "delete", "shared-card"), false},
+		{"outsider_restores_card", outsiderID, tombstone("cards", "restore", "shared-card"), false},
+		{"outsider_inserts_transcription", outsiderID, transcriptionOp("insert", "new-note", shared), false},
+		{"outsider_updates_transcription", outsiderID, transcriptionOp("update", "shared-note", shared), false},
+		{"outsider_deletes_transcription", outsiderID, tombstone("transcriptions", "delete", "shared-note"), false},
+		{"outsider_restores_transcription", outsiderID, tombstone("transcriptions", "restore", "shared-note"), false},
+		{"member_deletes_board", memberID, tombstone("boards", "delete", shared), false},
+		{"member_restores_board", memberID, tombstone("boards", "restore", shared), false},
+		{"member_moves_card_out_of_board", memberID, moveCardOp(t, "shared-card", "outsider-column"), false},
+		{"viewer_updates_board", viewerID, boardOp("update", shared), false},
+		{"viewer_inserts_column", viewerID, columnOp("insert", "new-column", shared), false},
+		{"viewer_inserts_card", viewerID, cardOp(t, "insert", "new-card", "shared-column"), false},
+		{"viewer_moves_card", viewerID, moveCardOp(t, "shared-card", "shared-column"), false},
+		{"viewer_deletes_transcription", viewerID, tombstone("transcriptions", "delete", "shared-note"), false},
+		{"commenter_updates_card", commenterID, cardOp(t, "update", "shared-card", "shared-column"), false},
+		{"commenter_deletes_column", commenterID, tombstone("columns", "delete", "shared-column"), false},
+		{"admin_deletes_board", adminID, tombstone("boards", "delete", shared), false},
+		{"outsider_mismatched_record_id", outsiderID, func() SyncOperation {
+			op := cardOp(t, "update", "outsider-card", "outsider-column")
+			op.RecordID = "shared-card"
+			return op
+		}(), false},
+
+		{"outsider_creates_a_board", outsiderID, boardOp("insert", uuid.NewString()), true},
+		{"outsider_writes_their_own_board", outsiderID, cardOp(t, "update", "outsider-card", "outsider-column"), true},
+		{"member_updates_board", memberID, boardOp("update", shared), true},
+		{"member_inserts_card", memberID, cardOp(t, "insert", "new-card", "shared-column"), true},
+		{"member_moves_card", memberID, moveCardOp(t, "shared-card", "shared-column"), true},
+		{"member_deletes_column", memberID, tombstone("columns", "delete", "shared-column"), true},
+		{"admin_updates_card", adminID, cardOp(t, "update", "shared-card", "shared-column"), true},
+		{"owner_deletes_board", ownerID, tombstone("boards", "delete", shared), true},
+	}
+
+	s := newAuthorizedService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.allow {
+				if err := s.authorizeOperation(context.Background(), tt.user, tt.op); err != nil {
+					t.Errorf("expected the op to be allowed, got %v", err)
+				}
+				return
+			}
+
+			// through the same path an upload or a batch takes, nothing may be stored
+			_, err := s.applyOperation(context.Background(), tt.user.String(), tt.op)
+			if !errors.Is(err, access.ErrForbidden) {
+				t.Errorf("expected ErrForbidden, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEndpointAuthorization(t *testing.T) {
+	ctx := context.Background()
+	s := newAuthorizedService()
+	shared := sharedBoard.String()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"export_board", func() error {
+			_, err := s.ExportBoardData(ctx, outsiderID, shared, 0)
+			return err
+		}},
+		{"export_board_changes", func() error {
+			_, err := s.ExportBoardData(ctx, outsiderID, shared, 12)
+			return err
+		}},
+		{"upsert_board", func() error {
+			return s.upsertBoard(ctx, outsiderID, boardPayload{ID: shared, Name: "Mine now", CreatedAt: testTimestamp, UpdatedAt: testTimestamp})
+		}},
+		{"upsert_column", func() error {
+			return s.upsertColumn(ctx, outsiderID, columnPayload{ID: "new-column", BoardID: shared, CreatedAt: testTimestamp, UpdatedAt: testTimestamp})
+		}},
+		{"upsert_card", func() error {
+			return s.upsertCard(ctx, outsiderID, cardPayload{ID: "shared-card", ColumnID: "outsider-column", CreatedAt: testTimestamp, UpdatedAt: testTimestamp})
+		}},
+		{"upsert_transcription", func() error {
+			return s.upsertTranscription(ctx, outsiderID, transcriptionPayload{ID: "new-note", BoardID: shared, CreatedAt: testTimestamp, UpdatedAt: testTimestamp})
+		}},
+		{"outsider_invites", func() error {
+			_, err := s.inviteUserToBoard(ctx, outsiderID, boardMemberActionPayload{BoardID: shared, Email: "friend@example.com"})
+			return err
+		}},
+		{"member_invites", func() error {
+			_, err := s.inviteUserToBoard(ctx, memberID, boardMemberActionPayload{BoardID: shared, Email: "friend@example.com"})
+			return err
+		}},
+		{"outsider_removes_member", func() error {
+			return s.removeUserFromBoard(ctx, outsiderID, boardMemberActionPayload{BoardID: shared, UserID: memberID.String()})
+		}},
+		{"member_removes_owner", func() error {
+			return s.removeUserFromBoard(ctx, memberID, boardMemberActionPayload{BoardID: shared, UserID: ownerID.String()})
+		}},
+		{"admin_removes_owner", func() error {
+			return s.removeUserFromBoard(ctx, adminID, boardMemberActionPayload{BoardID: shared, UserID: ownerID.String()})
+		}},
+		{"admin_invites_admin", func() error {
+			_, err := s.inviteUserToBoard(ctx, adminID, boardMemberActionPayload{BoardID: shared, Email: "friend@example.com", Role: "admin"})
+			return err
+		}},
+		{"viewer_invites", func() error {
+			_, err := s.inviteUserToBoard(ctx, viewerID, boardMemberActionPayload{BoardID: shared, Email: "friend@example.com", Role: "viewer"})
+			return err
+		}},
+		{"member_lists_invitations", func() error {
+			_, err := s.listBoardInvitations(ctx, memberID, sharedBoard)
+			return err
+		}},
+		{"outsider_revokes_invitation", func() error {
+			return s.revokeBoardInvitation(ctx, outsiderID, sharedBoard, uuid.New())
+		}},
+		{"viewer_resends_invitation", func() error {
+			_, err := s.resendBoardInvitation(ctx, viewerID, sharedBoard, uuid.New())
+			return err
+		}},
+		{"admin_transfers_the_board", func() error {
+			return s.transferBoardOwnership(ctx, adminID, sharedBoard, memberID)
+		}},
+		{"outsider_takes_the_board", func() error {
+			return s.transferBoardOwnership(ctx, outsiderID, sharedBoard, outsiderID)
+		}},
+		{"outsider_leaves", func() error {
+			return s.leaveBoard(ctx, outsiderID, sharedBoard)
+		}},
+		{"editor_changes_a_role", func() error {
+			return s.setBoardMemberRole(ctx, memberID, sharedBoard, viewerID, "editor")
+		}},
+		{"admin_promotes_to_admin", func() error {
+			return s.setBoardMemberRole(ctx, adminID, sharedBoard, viewerID, "admin")
+		}},
+		{"admin_demotes_owner", func() error {
+			return s.setBoardMemberRole(ctx, adminID, sharedBoard, ownerID, "viewer")
+		}},
+		{"owner_demotes_themselves", func() error {
+			return s.setBoardMemberRole(ctx, ownerID, sharedBoard, ownerID, "editor")
+		}},
+		{"viewer_writes_board_keys", func() error {
+			return s.putBoardKeys(ctx, viewerID, sharedBoard, []types.WrappedBoardKey{{UserID: viewerID.String(), WrappedKey: "key"}})
+		}},
+		{"board_members", func() error {
+			_, err := s.getBoardMembers(ctx, sharedBoard, outsiderID)
+			return err
+		}},
+		{"board_metadata", func() error {
+			_, err := s.getBoardMetadata(ctx, sharedBoard, outsiderID)
+			return err
+		}},
+		{"board_keys", func() error {
+			_, err := s.getBoardKeys(ctx, outsiderID, sharedBoard)
+			return err
+		}},
+		{"put_board_keys", func() error {
+			return s.putBoardKeys(ctx, outsiderID, sharedBoard, []types.WrappedBoardKey{{UserID: outsiderID.String(), WrappedKey: "key"}})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, access.ErrForbidden) {
+				t.Errorf("expected ErrForbidden, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSetBoardMemberRoleRefusesUnknownRoles(t *testing.T) {
+	s := newAuthorizedService()
+
+	for _, role := range []string{"owner", "member", "superuser", ""} {
+		if err := s.setBoardMemberRole(context.Background(), ownerID, sharedBoard, viewerID, role); !errors.Is(err, errInvalidRole) {
+			t.Errorf("expected errInvalidRole for %q, got %v", role, err)
+		}
+	}
+}
+
+func TestOwnerKeepsTheBoard(t *testing.T) {
+	s := newAuthorizedService()
+	ctx := context.Background()
+
+	if err := s.leaveBoard(ctx, ownerID, sharedBoard); !errors.Is(err, errOwnerLeaving) {
+		t.Errorf("expected errOwnerLeaving, got %v", err)
+	}
+	if err := s.transferBoardOwnership(ctx, ownerID, sharedBoard, ownerID); !errors.Is(err, errTransferToSelf) {
+		t.Errorf("expected errTransferToSelf, got %v", err)
+	}
+	if err := s.transferBoardOwnership(ctx, ownerID, sharedBoard, outsiderID); !errors.Is(err, access.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for someone not on the board, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package central
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -14,6 +15,20 @@ type Config struct {
 	HTTPAddr             string
 	VERSION_SECURE_KEY   string
 	OpenAIAPIKey         string
+	// how long a soft deleted record stays restorable before it's purged
+	TombstoneRetention time.Duration
+	// how long an invite link works, resending it starts over
+	InviteExpiration time.Duration
+	// how long an email verification link works
+	EmailVerificationExpiration time.Duration
+	// where the server is reached from outside, links in mail point here
+	PublicURL string
+	// mail goes to the log when SMTPHost is empty
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
 }
 
 // LoadConfigFromEnv reads the required configuration from environment variables.
@@ -46,6 +61,43 @@ func LoadConfigFromEnv() (Config, error) {
 		resetTTL = dur
 	}
 
+	retention := 30 * 24 * time.Hour
+	if v := os.Getenv("TOMBSTONE_RETENTION"); v != "" {
+		dur, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TOMBSTONE_RETENTION: %w", err)
+		}
+		retention = dur
+	}
+
+	inviteTTL := 7 * 24 * time.Hour
+	if v := os.Getenv("BOARD_INVITE_TTL"); v != "" {
+		dur, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid BOARD_INVITE_TTL: %w", err)
+		}
+		inviteTTL = dur
+	}
+
+	verifyTTL := 48 * time.Hour
+	if v := os.Getenv("EMAIL_VERIFICATION_TTL"); v != "" {
+		dur, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid EMAIL_VERIFICATION_TTL: %w", err)
+		}
+		verifyTTL = dur
+	}
+
+	smtpPort := os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "Seisami <no-reply@seisami.app>"
+	}
+
 	versionKey := os.Getenv("VERSION_SECURE_KEY")
 	if versionKey == "" {
 		return Config{}, fmt.Errorf("VERSION_SECURE_KEY must be set")
@@ -56,6 +108,11 @@ func LoadConfigFromEnv() (Config, error) {
 		addr = "0.0.0.0:8080"
 	}
 
+	publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if publicURL == "" {
+		publicURL = "http://localhost:8080"
+	}
+
 	openAIKey := os.Getenv("OPENAI_API_KEY")
 	if openAIKey == "" {
 		return Config{}, fmt.Errorf("OPENAI_API_KEY must be set")
@@ -69,5 +126,15 @@ func LoadConfigFromEnv() (Config, error) {
 		HTTPAddr:             addr,
 		VERSION_SECURE_KEY:   versionKey,
 		OpenAIAPIKey:         openAIKey,
+		TombstoneRetention:   retention,
+		InviteExpiration:     inviteTTL,
+
+		EmailVerificationExpiration: verifyTTL,
+		PublicURL:                   publicURL,
+		SMTPHost:                    os.Getenv("SMTP_HOST"),
+		SMTPPort:                    smtpPort,
+		SMTPUsername:                os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:                os.Getenv("SMTP_PASSWORD"),
+		MailFrom:                    mailFrom,
 	}, nil
 }
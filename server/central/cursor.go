@@ -0,0 +1,163 @@
+package central
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// pull cursors are opaque to clients, they carry how far a pull got in every board's part of the op log so an
+// interrupted pull resumes where it stopped. a finished pull hands out its position the same way
+
+type PullQuery struct {
+	// After is the position the client's last finished pull ended on, empty when it never had one
+	After     string
+	Since     int64
+	RecordIDs []string
+	Cursor    string
+	Limit     int
+	// Summary leaves payloads out, enough for a client to decide what it needs
+	Summary bool
+	// DeviceID is the device pulling, its own ops aren't echoed back to it
+	DeviceID string
+}
+
+type PullPage struct {
+	Operations []SyncOperation `json:"operations"`
+	Cursor     string          `json:"cursor"`
+	HasMore    bool            `json:"has_more"`
+	// Position is how far every board's ops were handed out, the client's next pull starts after it
+	Position string `json:"position"`
+}
+
+var (
+	errInvalidCursor   = errors.New("invalid cursor")
+	errInvalidPosition = errors.New("invalid position")
+)
+
+// position maps a board id to the seq of its newest op a pull handed out
+type position map[string]int64
+
+func decodePosition(s string) (position, error) {
+	p := position{}
+	if s == "" {
+		return p, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return p, fmt.Errorf("%w: %v", errInvalidPosition, err)
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return position{}, fmt.Errorf("%w: %v", errInvalidPosition, err)
+	}
+	if p == nil {
+		return position{}, errInvalidPosition
+	}
+	if err := p.check(); err != nil {
+		return position{}, fmt.Errorf("%w: %v", errInvalidPosition, err)
+	}
+
+	return p, nil
+}
+
+func (p position) check() error {
+	for boardID := range p {
+		if _, err := uuid.Parse(boardID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p position) encode() string {
+	if len(p) == 0 {
+		return ""
+	}
+
+	b, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// advance moves every board of p to at least its seq in boards
+func (p position) advance(boards map[string]int64) {
+	for boardID, seq := range boards {
+		p[boardID] = max(p[boardID], seq)
+	}
+}
+
+// arrays splits p the way the op log queries take it, boards and their seqs side by side
+func (p position) arrays() ([]pgtype.UUID, []int64) {
+	boards := make([]pgtype.UUID, 0, len(p))
+	seqs := make([]int64, 0, len(p))
+	for boardID, seq := range p {
+		// decoding checked the ids
+		boards = append(boards, pgtype.UUID{Bytes: uuid.MustParse(boardID), Valid: true})
+		seqs = append(seqs, seq)
+	}
+
+	return boards, seqs
+}
+
+// cursors from before positions decode to none, which starts the pull over from the client's position
+type opCursor struct {
+	Position position `json:"p,omitempty"`
+}
+
+func encodeCursor(p position) string {
+	b, _ := json.Marshal(opCursor{Position: p})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(cursor string) (position, error) {
+	var c opCursor
+	if cursor == "" {
+		return position{}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return position{}, fmt.Errorf("%w: %v", errInvalidCursor, err)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return position{}, fmt.Errorf("%w: %v", errInvalidCursor, err)
+	}
+	if err := c.Position.check(); err != nil {
+		return position{}, fmt.Errorf("%w: %v", errInvalidCursor, err)
+	}
+	if c.Position == nil {
+		return position{}, nil
+	}
+
+	return c.Position, nil
+}
+
+// pageOperations hands out the ops a pull found from where it reached, it asked for one more than q.Limit
+// (0 = no limit) to tell whether more are left
+func pageOperations(ops []SyncOperation, q PullQuery, reached position) PullPage {
+	page := PullPage{Operations: []SyncOperation{}, Cursor: q.Cursor}
+
+	if q.Limit > 0 && len(ops) > q.Limit {
+		ops = ops[:q.Limit]
+		page.HasMore = true
+	}
+
+	for _, op := range ops {
+		if q.Summary {
+			op.Payload = ""
+		}
+		page.Operations = append(page.Operations, op)
+		reached.advance(op.boards)
+	}
+	if len(page.Operations) > 0 {
+		page.Cursor = encodeCursor(reached)
+	}
+	page.Position = reached.encode()
+
+	return page
+}
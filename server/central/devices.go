@@ -0,0 +1,184 @@
+package central
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"seisami/server/centraldb"
+	"seisami/server/types"
+	"seisami/server/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// every desktop sends its device id as X-Device-ID. the server keeps a sync cursor per device and never pulls a
+// device's own ops back to it. a device is tied to its token's session, revoking it ends the session
+
+const DeviceIDHeader = "X-Device-ID"
+
+const DeviceContextKey ContextKey = "device"
+
+// deviceSeenInterval is how stale a device's last seen time gets before a request refreshes it
+const deviceSeenInterval = 5 * time.Minute
+
+var errDeviceRevoked = errors.New("device revoked")
+
+// deviceIDFromContext is the device making the request
+func deviceIDFromContext(ctx context.Context) string {
+	deviceID, _ := ctx.Value(DeviceContextKey).(string)
+	return deviceID
+}
+
+// deviceMiddleware registers the calling device on first sight and refuses revoked ones, it runs after authMiddleware
+func deviceMiddleware(authService *AuthService, syncService *SyncService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.GetHeader(DeviceIDHeader)
+		if deviceID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing " + DeviceIDHeader + " header"})
+			c.Abort()
+			return
+		}
+
+		// tokens issued before sessions existed can't be revoked, their device has to sign in again
+		sessionID := sessionIDFromContext(c.Request.Context())
+		if sessionID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired, sign in again"})
+			c.Abort()
+			return
+		}
+
+		userID, err := authService.GetUserIDFromContext(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+
+		userUUID, err := uuid.Parse(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unable to parse id: " + err.Error()})
+			c.Abort()
+			return
+		}
+
+		err = syncService.seeDevice(c.Request.Context(), userUUID, deviceID, sessionID)
+		if errors.Is(err, errDeviceRevoked) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), DeviceContextKey, deviceID))
+		c.Next()
+	}
+}
+
+// seeDevice registers the device on first sight, after that it's only written when it signed in again or was last
+// seen before deviceSeenInterval
+func (s *SyncService) seeDevice(ctx context.Context, userUUID uuid.UUID, deviceID, sessionID string) error {
+	device, err := s.queries.GetDevice(ctx, centraldb.GetDeviceParams{
+		UserID: pgtype.UUID{Bytes: userUUID, Valid: true},
+		ID:     deviceID,
+	})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("unable to get device: %v", err)
+	case device.RevokedAt.Valid:
+		return errDeviceRevoked
+	case device.SessionID == sessionID && time.Since(device.LastSeenAt.Time) < deviceSeenInterval:
+		return nil
+	}
+
+	_, err = s.registerDevice(ctx, userUUID, deviceID, "", sessionID)
+	return err
+}
+
+// registerDevice records the device under sessionID or refreshes its last seen time, an empty name keeps the old one
+func (s *SyncService) registerDevice(ctx context.Context, userUUID uuid.UUID, deviceID, name, sessionID string) (types.Device, error) {
+	device, err := s.queries.UpsertDevice(ctx, centraldb.UpsertDeviceParams{
+		ID:        deviceID,
+		UserID:    pgtype.UUID{Bytes: userUUID, Valid: true},
+		Name:      name,
+		SessionID: sessionID,
+	})
+	if err != nil {
+		return types.Device{}, fmt.Errorf("unable to register device: %v", err)
+	}
+
+	if device.RevokedAt.Valid {
+		return types.Device{}, errDeviceRevoked
+	}
+
+	return toDevice(device), nil
+}
+
+func (s *SyncService) listDevices(ctx context.Context, userUUID uuid.UUID) ([]types.Device, error) {
+	rows, err := s.queries.ListDevices(ctx, pgtype.UUID{Bytes: userUUID, Valid: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list devices: %v", err)
+	}
+
+	devices := make([]types.Device, len(rows))
+	for i, row := range rows {
+		devices[i] = toDevice(row)
+	}
+
+	return devices, nil
+}
+
+// revokeDevice stops a device from syncing, ends its session and drops its cursors, it's false when the user has no
+// such active device
+func (s *SyncService) revokeDevice(ctx context.Context, userUUID uuid.UUID, deviceID string) (bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("unable to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+	userID := pgtype.UUID{Bytes: userUUID, Valid: true}
+
+	revoked, err := qtx.RevokeDevice(ctx, centraldb.RevokeDeviceParams{UserID: userID, ID: deviceID})
+	if err != nil {
+		return false, fmt.Errorf("unable to revoke device: %v", err)
+	}
+	if revoked == 0 {
+		return false, nil
+	}
+
+	err = qtx.DeleteDeviceSyncState(ctx, centraldb.DeleteDeviceSyncStateParams{UserID: userID, DeviceID: deviceID})
+	if err != nil {
+		return false, fmt.Errorf("unable to delete device sync state: %v", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("unable to commit device revoke: %v", err)
+	}
+
+	return true, nil
+}
+
+func toDevice(device centraldb.Device) types.Device {
+	d := types.Device{
+		ID:         device.ID,
+		Name:       device.Name,
+		CreatedAt:  utils.ConvertTimestamptzToLocal(device.CreatedAt),
+		LastSeenAt: utils.ConvertTimestamptzToLocal(device.LastSeenAt),
+	}
+	if device.RevokedAt.Valid {
+		d.RevokedAt = utils.ConvertTimestamptzToLocal(device.RevokedAt)
+	}
+
+	return d
+}
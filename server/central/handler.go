@@ -15,10 +15,10 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
+	"seisami/server/central/access"
 	"seisami/server/central/actions"
 	"seisami/server/centraldb"
 	"seisami/server/synchub"
@@ -30,29 +30,27 @@ type ContextKey string
 
 const UserContextKey ContextKey = "user"
 
-var wsHandler func(http.ResponseWriter, *http.Request)
-var roomManagerGetter func(string) ([]string, error)
+const SessionContextKey ContextKey = "session"
 
-func SetWebSocketHandler(handler func(http.ResponseWriter, *http.Request)) {
-	wsHandler = handler
+// Rooms is a replica's realtime rooms, /ws connections are handed to it once they're checked
+type Rooms interface {
+	HandleWebSocket(w http.ResponseWriter, r *http.Request)
+	// Presence is everyone in boardID's room
+	Presence(boardID string) ([]types.Presence, error)
 }
 
-func SetRoomManagerGetter(getter func(string) ([]string, error)) {
-	roomManagerGetter = getter
-}
-
-func NewRouter(authService *AuthService, syncService *SyncService, notifService *NotificationService, action *actions.Action) *gin.Engine {
+func NewRouter(authService *AuthService, syncService *SyncService, notifService *NotificationService, action *actions.Action, hub *synchub.SyncHub, rooms Rooms) *gin.Engine {
 	router := gin.Default()
 
 	corsMiddleware := cors.New(cors.Config{
 		AllowAllOrigins: true,
 		AllowMethods:    []string{"PUT", "PATCH", "GET", "POST", "DELETE", "OPTIONS"},
-		AllowHeaders:    []string{"Origin", "Content-Type", "Authorization", "Upgrade", "Connection"},
+		AllowHeaders:    []string{"Origin", "Content-Type", "Authorization", "Upgrade", "Connection", DeviceIDHeader},
 		MaxAge:          12 * 60 * 60,
 	})
 	router.Use(corsMiddleware)
 
-	h := &handler{authService: authService, syncService: syncService, notifService: notifService, action: action}
+	h := &handler{authService: authService, syncService: syncService, notifService: notifService, action: action, hub: hub, rooms: rooms}
 
 	router.GET("/ws", func(c *gin.Context) {
 
@@ -68,7 +66,7 @@ func NewRouter(authService *AuthService, syncService *SyncService, notifService
 			return
 		}
 
-		userID, err := validateToken(token, authService.jwtSecret)
+		claims, err := authService.verifyToken(c.Request.Context(), token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
 			return
@@ -80,21 +78,37 @@ func NewRouter(authService *AuthService, syncService *SyncService, notifService
 			return
 		}
 
+		userID := claims.Subject
 		userUUID, err := uuid.Parse(userID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID in token"})
 			return
 		}
 
-		if err := h.syncService.ensureBoardAccess(c, boardUUID, userUUID); err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		if err := h.syncService.access.Board(c, userUUID, boardUUID, access.Read); err != nil {
+			c.JSON(accessStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
+		// a browser can't set headers on a websocket, the desktop names its device here so the ops its events become
+		// are its own, the same as when it pushes them. A token from before sessions has no session to tie it to
+		if deviceID := c.Query("device_id"); deviceID != "" && claims.ID != "" {
+			err := h.syncService.seeDevice(c.Request.Context(), userUUID, deviceID, claims.ID)
+			if errors.Is(err, errDeviceRevoked) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.Request.Header.Set(DeviceIDHeader, deviceID)
+		}
+
 		c.Request.Header.Set("X-User-ID", userID)
 		c.Request.Header.Set("X-Board-ID", boardID)
-		if wsHandler != nil {
-			wsHandler(c.Writer, c.Request)
+		if h.rooms != nil {
+			h.rooms.HandleWebSocket(c.Writer, c.Request)
 		} else {
 			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WebSocket handler not available"})
 		}
@@ -107,11 +121,13 @@ func NewRouter(authService *AuthService, syncService *SyncService, notifService
 		auth.POST("/forgot-password", h.forgotPassword)
 		auth.POST("/reset-password", h.resetPassword)
 		auth.POST("/desktop/exchange", h.desktopExchange)
+		auth.GET("/verify-email", h.verifyEmail)
 
 		protected := auth.Group("")
 		protected.Use(authMiddleware(authService))
 		{
 			protected.GET("/desktop/start", h.desktopStart)
+			protected.POST("/verify-email/send", h.sendEmailVerification)
 		}
 	}
 
@@ -122,21 +138,22 @@ func NewRouter(authService *AuthService, syncService *SyncService, notifService
 			return
 		}
 
-		userID, err := validateToken(token, authService.jwtSecret)
+		claims, err := authService.verifyToken(c.Request.Context(), token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
 			return
 		}
 
-		h.handleSyncWebSocket(c.Writer, c.Request, userID)
+		h.handleSyncWebSocket(c.Writer, c.Request, claims.Subject, c.GetHeader("X-Device-ID"))
 	})
 
 	// Sync endpoints
 	sync := router.Group("/sync")
-	sync.Use(authMiddleware(authService))
+	sync.Use(authMiddleware(authService), deviceMiddleware(authService, syncService))
 	{
 		sync.POST("/init", h.initSyncState)
 		sync.POST("/upload", h.uploadData)
+		sync.POST("/batch", h.syncBatch)
 		sync.GET("/pull/:table", h.pullData)
 		sync.GET("/export", h.exportAllData)
 		sync.GET("/export/:boardId", h.exportData)
@@ -152,14 +169,39 @@ func NewRouter(authService *AuthService, syncService *SyncService, notifService
 		sync.GET("/state/:table", h.getSyncState)
 	}
 
+	devices := router.Group("/devices")
+	devices.Use(authMiddleware(authService))
+	{
+		devices.GET("", h.listDevices)
+		devices.POST("", h.registerDevice)
+		devices.DELETE("/:deviceId", h.revokeDevice)
+	}
+
+	keys := router.Group("/keys")
+	keys.Use(authMiddleware(authService))
+	{
+		keys.GET("", h.getUserKeys)
+		keys.PUT("", h.putUserKeys)
+	}
+
 	boardRts := router.Group("/board")
 	boardRts.Use(authMiddleware(authService))
 	{
 		boardRts.POST("/invite", h.inviteUser)
 		boardRts.POST("/remove", h.removeUserFromBoard)
+		boardRts.GET("/invitations", h.getPendingInvitations)
+		boardRts.POST("/invitations/accept", h.acceptInvitation)
 		boardRts.GET("/:boardId/members", h.getBoardMembers)
+		boardRts.PUT("/:boardId/members/:userId/role", h.setBoardMemberRole)
+		boardRts.POST("/:boardId/transfer", h.transferBoardOwnership)
+		boardRts.POST("/:boardId/leave", h.leaveBoard)
+		boardRts.GET("/:boardId/invitations", h.getBoardInvitations)
+		boardRts.DELETE("/:boardId/invitations/:invitationId", h.revokeInvitation)
+		boardRts.POST("/:boardId/invitations/:invitationId/resend", h.resendInvitation)
 		boardRts.GET("/:boardId/metadata", h.getBoardMetadata)
 		boardRts.GET("/:boardId/connected-users", h.getConnectedUsers)
+		boardRts.GET("/:boardId/keys", h.getBoardKeys)
+		boardRts.PUT("/:boardId/keys", h.putBoardKeys)
 	}
 
 	updates := router.Group("/updates")
@@ -200,31 +242,20 @@ func authMiddleware(service *AuthService) gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-
-		token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return service.jwtSecret, nil
-		})
-
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		claims, err := service.verifyToken(c.Request.Context(), parts[1])
+		if errors.Is(err, ErrSessionRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
-
-		claims, ok := token.Claims.(*jwt.RegisteredClaims)
-		if !ok || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			c.Abort()
 			return
 		}
 
-		userID := claims.Subject
-
-		c.Request = c.Request.WithContext(setUserContext(c.Request.Context(), &centraldb.User{ID: utils.StringToUUID(userID)}))
+		ctx := setUserContext(c.Request.Context(), &centraldb.User{ID: utils.StringToUUID(claims.Subject)})
+		c.Request = c.Request.WithContext(context.WithValue(ctx, SessionContextKey, claims.ID))
 		c.Next()
 	}
 }
@@ -238,6 +269,9 @@ type handler struct {
 	syncService  *SyncService
 	notifService *NotificationService
 	action       *actions.Action
+	// hub and rooms are the replica's, the sockets connected to it
+	hub   *synchub.SyncHub
+	rooms Rooms
 }
 
 type emailPasswordRequest struct {
@@ -269,9 +303,46 @@ func (h *handler) signup(c *gin.Context) {
 		return
 	}
 
+	// invites sent before the account existed wait for the account to verify its email, see pendingInvitations
+	if err := h.authService.SendEmailVerification(c.Request.Context(), result.UserID); err != nil {
+		log.Printf("unable to send email verification: %v", err)
+	}
+
 	c.JSON(http.StatusCreated, result)
 }
 
+func (h *handler) sendEmailVerification(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := h.authService.SendEmailVerification(c.Request.Context(), userID); err != nil {
+		log.Printf("unable to send email verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
+}
+
+// verifyEmail is where the link in the verification mail leads, it's opened in a browser
+func (h *handler) verifyEmail(c *gin.Context) {
+	err := h.authService.VerifyEmail(c.Request.Context(), c.Query("token"))
+	if errors.Is(err, ErrInvalidVerification) {
+		c.String(http.StatusBadRequest, "This link is invalid or has expired, you can ask Seisami for a new one.")
+		return
+	}
+	if err != nil {
+		log.Printf("unable to verify email: %v", err)
+		c.String(http.StatusInternalServerError, "Your email couldn't be verified, please try again.")
+		return
+	}
+
+	c.String(http.StatusOK, "Your email is verified, you can go back to Seisami.")
+}
+
 func (h *handler) signin(c *gin.Context) {
 	var req emailPasswordRequest
 	if err := c.BindJSON(&req); err != nil {
@@ -431,26 +502,6 @@ func (h *handler) desktopExchange(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"token": token})
 }
 
-func validateToken(tokenString string, jwtSecret []byte) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
-
-	if err != nil {
-		return "", fmt.Errorf("invalid token: %w", err)
-	}
-
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok || !token.Valid {
-		return "", fmt.Errorf("invalid token claims")
-	}
-
-	return claims.Subject, nil
-}
-
 func (h *handler) exportData(c *gin.Context) {
 
 	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
@@ -471,9 +522,19 @@ func (h *handler) exportData(c *gin.Context) {
 		return
 	}
 
-	data, err := h.syncService.ExportBoardData(c.Request.Context(), uid, boardID)
+	// a device that already has the board sends the version it has and only gets what changed since
+	var since int64
+	if v := c.Query("since"); v != "" {
+		since, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since parameter"})
+			return
+		}
+	}
+
+	data, err := h.syncService.ExportBoardData(c.Request.Context(), uid, boardID, since)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -533,16 +594,84 @@ func (h *handler) uploadData(c *gin.Context) {
 		return
 	}
 
-	if err := h.syncService.ProcessOperation(c.Request.Context(), userID, req); err != nil {
+	result, err := h.syncService.ProcessOperation(c.Request.Context(), userID, req)
+	if errors.Is(err, access.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		log.Printf("sync upload failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process sync operation"})
 		return
 	}
 
+	// a resent op answers the same as the first time it was sent
 	c.JSON(http.StatusCreated, gin.H{
 		"status":       "stored",
 		"record_id":    req.RecordID,
-		"operation_id": req.ID,
+		"operation_id": result.ID,
+		"seq":          result.Seq,
+	})
+}
+
+func (h *handler) syncBatch(c *gin.Context) {
+	if h.syncService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sync service unavailable"})
+		return
+	}
+
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req SyncBatchRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields", "data": err.Error()})
+		return
+	}
+
+	resp, err := h.syncService.ProcessBatch(c.Request.Context(), userID, req)
+	if errors.Is(err, errInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
+	if errors.Is(err, errInvalidPosition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after"})
+		return
+	}
+	// the batch is refused for one board, naming it lets a device that missed losing it archive it and push the rest
+	var notMember *access.NotMemberError
+	if errors.As(err, &notMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "board_id": notMember.BoardID.String()})
+		return
+	}
+	if errors.Is(err, access.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("sync batch failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process sync batch"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"table":      req.TableName,
+		"applied":    resp.Applied,
+		"rejected":   resp.Rejected,
+		"count":      len(resp.Operations),
+		"operations": resp.Operations,
+		"cursor":     resp.Cursor,
+		"has_more":   resp.HasMore,
+		"position":   resp.Position,
 	})
 }
 
@@ -612,7 +741,7 @@ func (h *handler) getSyncState(c *gin.Context) {
 		return
 	}
 
-	syncState, err := h.syncService.getSyncState(c, id, tableName)
+	syncState, err := h.syncService.getSyncState(c, id, deviceIDFromContext(c.Request.Context()), tableName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -642,7 +771,7 @@ func (h *handler) updateSyncState(c *gin.Context) {
 		return
 	}
 
-	err = h.syncService.updateSyncState(c, id, body)
+	err = h.syncService.updateSyncState(c, id, deviceIDFromContext(c.Request.Context()), body)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured updating sync state: " + err.Error()})
 		return
@@ -684,7 +813,7 @@ func (h *handler) upsertBoard(c *gin.Context) {
 
 	err = h.syncService.upsertBoard(c, id, payload)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -720,7 +849,7 @@ func (h *handler) upsertColumn(c *gin.Context) {
 
 	err = h.syncService.upsertColumn(c, id, payload)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -762,7 +891,7 @@ func (h *handler) upsertCard(c *gin.Context) {
 
 	err = h.syncService.upsertCard(c, id, payload)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -783,7 +912,7 @@ func (h *handler) initSyncState(c *gin.Context) {
 		return
 	}
 
-	err = h.syncService.initializeSyncState(c, id)
+	err = h.syncService.initializeSyncState(c, id, deviceIDFromContext(c.Request.Context()))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -819,7 +948,41 @@ func (h *handler) pullData(c *gin.Context) {
 		}
 	}
 
-	operations, err := h.syncService.PullOperations(c.Request.Context(), userID, tableName, sinceTimestamp)
+	var limit int
+	if l := c.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit parameter"})
+			return
+		}
+	}
+
+	var recordIDs []string
+	for _, ids := range c.QueryArray("record_ids") {
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				recordIDs = append(recordIDs, id)
+			}
+		}
+	}
+
+	page, err := h.syncService.PullOperationsPage(c.Request.Context(), userID, tableName, PullQuery{
+		After:     c.Query("after"),
+		Since:     sinceTimestamp,
+		RecordIDs: recordIDs,
+		Cursor:    c.Query("cursor"),
+		Limit:     limit,
+		Summary:   c.Query("summary") == "true",
+		DeviceID:  deviceIDFromContext(c.Request.Context()),
+	})
+	if errors.Is(err, errInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor parameter"})
+		return
+	}
+	if errors.Is(err, errInvalidPosition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after parameter"})
+		return
+	}
 	if err != nil {
 		log.Printf("sync pull failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to pull sync data"})
@@ -827,230 +990,795 @@ func (h *handler) pullData(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"table":      tableName,
-		"count":      len(operations),
-		"operations": operations,
+		"table":       tableName,
+		"count":       len(page.Operations),
+		"operations":  page.Operations,
+		"next_cursor": page.Cursor,
+		"has_more":    page.HasMore,
+		"position":    page.Position,
 	})
 }
 
-// Implement notification service for things like this
+type registerDeviceRequest struct {
+	ID   string `json:"id" validate:"required"`
+	Name string `json:"name"`
+}
 
-func (h *handler) inviteUser(c *gin.Context) {
+func (h *handler) registerDevice(c *gin.Context) {
 	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
 	if err != nil || userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	var payload boardMemberActionPayload
-
-	if err := c.BindJSON(&payload); err != nil {
+	var req registerDeviceRequest
+	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
 		return
 	}
 
 	validate := validator.New()
-	if err := validate.Struct(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields: " + err.Error()})
+	if err := validate.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields", "data": err.Error()})
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	id, err := uuid.Parse(userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to parse id: " + err.Error()})
 		return
 	}
 
-	invitee, err := h.syncService.inviteUserToBoard(c, userUUID, payload)
+	device, err := h.syncService.registerDevice(c.Request.Context(), id, req.ID, req.Name, sessionIDFromContext(c.Request.Context()))
+	if errors.Is(err, errDeviceRevoked) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	url := fmt.Sprintf("seisami://board/import?board_id=%s", payload.BoardID)
-
-	go func() {
-		fmt.Println("creating notification...")
-
-		err = h.notifService.createNotification(context.TODO(), invitee.ID.Bytes, "You have been invited to a board", "You have been invited to join the board", "in_app", url)
-		if err != nil {
-			log.Printf("failed to create notification: %v", err)
-		}
-	}()
-
-	c.JSON(http.StatusCreated, gin.H{"message": "successful"})
+	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": device})
 }
 
-func (h *handler) removeUserFromBoard(c *gin.Context) {
+func (h *handler) listDevices(c *gin.Context) {
 	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
 	if err != nil || userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	var payload boardMemberActionPayload
-
-	if err := c.BindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to parse id: " + err.Error()})
 		return
 	}
 
-	validate := validator.New()
-	if err := validate.Struct(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields: " + err.Error()})
+	devices, err := h.syncService.listDevices(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": devices})
+}
+
+func (h *handler) revokeDevice(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	err = h.syncService.removeUserFromBoard(c, userUUID, payload)
+	id, err := uuid.Parse(userID)
 	if err != nil {
-		fmt.Println(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to parse id: " + err.Error()})
 		return
 	}
 
-	userToRemove, err := uuid.Parse(payload.UserID)
+	revoked, err := h.syncService.revokeDevice(c.Request.Context(), id, c.Param("deviceId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
 		return
-
 	}
 
-	go func() {
-		fmt.Println("removing notification..")
-		err := h.notifService.createNotification(context.TODO(), userToRemove, "You have been removed from a board", "You have been removed from the board", "info", "")
-		if err != nil {
-			log.Printf("failed to create notification: %v", err)
-		}
-	}()
-
-	c.JSON(http.StatusCreated, gin.H{"message": "successful"})
-
+	c.JSON(http.StatusOK, gin.H{"message": "successful"})
 }
 
-func (h *handler) getBoardMembers(c *gin.Context) {
+func (h *handler) getUserKeys(c *gin.Context) {
 	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
 	if err != nil || userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	boardID := c.Param("boardId")
-	if boardID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "board id is required"})
-		return
-	}
-
-	userUUID, err := uuid.Parse(userID)
+	id, err := uuid.Parse(userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to parse id: " + err.Error()})
 		return
 	}
 
-	boardUUID, err := uuid.Parse(boardID)
+	keys, ok, err := h.syncService.getUserKeys(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse board id to uuid: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	boardMembers, err := h.syncService.getBoardMembers(c, boardUUID, userUUID)
-	if err != nil {
-		fmt.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "encryption is not enabled"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "successful", "data": boardMembers})
-
+	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": keys})
 }
 
-func (h *handler) getBoardMetadata(c *gin.Context) {
+func (h *handler) putUserKeys(c *gin.Context) {
 	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
 	if err != nil || userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	boardID := c.Param("boardId")
-	if boardID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "board id is required"})
+	var req types.UserKeys
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id: " + err.Error()})
+	validate := validator.New()
+	if err := validate.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields", "data": err.Error()})
 		return
 	}
 
-	boardUUID, err := uuid.Parse(boardID)
+	id, err := uuid.Parse(userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid board id: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to parse id: " + err.Error()})
 		return
 	}
 
-	metadata, err := h.syncService.getBoardMetadata(c, boardUUID, userUUID)
+	err = h.syncService.putUserKeys(c.Request.Context(), id, req)
+	if errors.Is(err, errKeyMismatch) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": metadata})
+	c.JSON(http.StatusOK, gin.H{"message": "successful"})
 }
 
-func (h *handler) getConnectedUsers(c *gin.Context) {
+type putBoardKeysRequest struct {
+	Keys []types.WrappedBoardKey `json:"keys" validate:"required,dive"`
+}
+
+func (h *handler) getBoardKeys(c *gin.Context) {
 	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
 	if err != nil || userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	boardID := c.Param("boardId")
-	if boardID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "board id is required"})
-		return
-	}
-
 	userUUID, err := uuid.Parse(userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
 		return
 	}
 
-	boardUUID, err := uuid.Parse(boardID)
+	boardUUID, err := uuid.Parse(c.Param("boardId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid board id: " + err.Error()})
-		return
-	}
-
-	// Ensure user has access to this board
-	if err := h.syncService.ensureBoardAccess(c, boardUUID, userUUID); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse board id to uuid: " + err.Error()})
 		return
 	}
 
-	// Get connected users from room manager
-	if roomManagerGetter == nil {
-		c.JSON(http.StatusOK, gin.H{"data": []string{}})
+	keys, err := h.syncService.getBoardKeys(c.Request.Context(), userUUID, boardUUID)
+	if errors.Is(err, errNotKeyHolder) || errors.Is(err, access.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return
 	}
-
-	connectedUserIDs, err := roomManagerGetter(boardID)
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"data": []string{}})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": connectedUserIDs})
+	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": keys})
 }
 
-func (h *handler) getLatestAppVersion(c *gin.Context) {
-
+func (h *handler) putBoardKeys(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req putBoardKeysRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields", "data": err.Error()})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	boardUUID, err := uuid.Parse(c.Param("boardId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse board id to uuid: " + err.Error()})
+		return
+	}
+
+	err = h.syncService.putBoardKeys(c.Request.Context(), userUUID, boardUUID, req.Keys)
+	if errors.Is(err, errNotKeyHolder) || errors.Is(err, errBoardKeyRequired) || errors.Is(err, access.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful"})
+}
+
+// Implement notification service for things like this
+
+func (h *handler) inviteUser(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var payload boardMemberActionPayload
+
+	if err := c.BindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields: " + err.Error()})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	sent, err := h.syncService.inviteUserToBoard(c, userUUID, payload)
+	if errors.Is(err, access.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errAlreadyMember) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.notifyInvite(sent)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "successful", "data": sent.Invitation})
+}
+
+// notifyInvite tells the recipient of sent about it when they have an account, everyone else finds it on signing up
+func (h *handler) notifyInvite(sent sentInvite) {
+	if !sent.Recipient.Valid {
+		return
+	}
+
+	go func() {
+		err := h.notifService.createNotification(context.TODO(), sent.Recipient.Bytes, "You have been invited to a board", "You have been invited to join the board", "in_app", sent.Link)
+		if err != nil {
+			log.Printf("failed to create notification: %v", err)
+		}
+	}()
+}
+
+func (h *handler) removeUserFromBoard(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var payload boardMemberActionPayload
+
+	if err := c.BindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields: " + err.Error()})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	err = h.syncService.removeUserFromBoard(c, userUUID, payload)
+	if errors.Is(err, access.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userToRemove, err := uuid.Parse(payload.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+
+	}
+
+	// the removed user's device would otherwise keep syncing a board it can no longer push to
+	if h.hub != nil {
+		h.hub.NotifyBoardRemoved(userToRemove.String(), payload.BoardID)
+	}
+
+	go func() {
+		fmt.Println("removing notification..")
+		err := h.notifService.createNotification(context.TODO(), userToRemove, "You have been removed from a board", "You have been removed from the board", "info", "")
+		if err != nil {
+			log.Printf("failed to create notification: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusCreated, gin.H{"message": "successful"})
+
+}
+
+type setBoardMemberRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+func (h *handler) setBoardMemberRole(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req setBoardMemberRoleRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields: " + err.Error()})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	boardUUID, err := uuid.Parse(c.Param("boardId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse board id to uuid: " + err.Error()})
+		return
+	}
+
+	memberUUID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse member id to uuid: " + err.Error()})
+		return
+	}
+
+	err = h.syncService.setBoardMemberRole(c.Request.Context(), userUUID, boardUUID, memberUUID, req.Role)
+	if errors.Is(err, errInvalidRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	go func() {
+		message := fmt.Sprintf("Your role on the board is now %s", req.Role)
+		err := h.notifService.createNotification(context.TODO(), memberUUID, "Your role on a board changed", message, "info", "")
+		if err != nil {
+			log.Printf("failed to create notification: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful"})
+}
+
+type transferBoardOwnershipRequest struct {
+	UserID string `json:"user_id" validate:"required"`
+}
+
+func (h *handler) transferBoardOwnership(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req transferBoardOwnershipRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields: " + err.Error()})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	boardUUID, err := uuid.Parse(c.Param("boardId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse board id to uuid: " + err.Error()})
+		return
+	}
+
+	newOwnerUUID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse new owner id to uuid: " + err.Error()})
+		return
+	}
+
+	err = h.syncService.transferBoardOwnership(c.Request.Context(), userUUID, boardUUID, newOwnerUUID)
+	if errors.Is(err, errTransferToSelf) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	go func() {
+		err := h.notifService.createNotification(context.TODO(), newOwnerUUID, "A board was handed over to you", "You are now the owner of the board", "info", "")
+		if err != nil {
+			log.Printf("failed to create notification: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful"})
+}
+
+func (h *handler) leaveBoard(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	boardUUID, err := uuid.Parse(c.Param("boardId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse board id to uuid: " + err.Error()})
+		return
+	}
+
+	err = h.syncService.leaveBoard(c.Request.Context(), userUUID, boardUUID)
+	if errors.Is(err, errOwnerLeaving) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// the user's other devices stop syncing the board too
+	if h.hub != nil {
+		h.hub.NotifyBoardRemoved(userID, boardUUID.String())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful"})
+}
+
+// invitationParams reads the user, the board and the invitation an invitations route is about, answering the request
+// itself when it can't
+func (h *handler) invitationParams(c *gin.Context) (userUUID, boardUUID, invitationUUID uuid.UUID, ok bool) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	userUUID, err = uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	boardUUID, err = uuid.Parse(c.Param("boardId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse board id to uuid: " + err.Error()})
+		return
+	}
+
+	if c.Param("invitationId") != "" {
+		invitationUUID, err = uuid.Parse(c.Param("invitationId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse invitation id to uuid: " + err.Error()})
+			return
+		}
+	}
+
+	return userUUID, boardUUID, invitationUUID, true
+}
+
+func (h *handler) getBoardInvitations(c *gin.Context) {
+	userUUID, boardUUID, _, ok := h.invitationParams(c)
+	if !ok {
+		return
+	}
+
+	invitations, err := h.syncService.listBoardInvitations(c.Request.Context(), userUUID, boardUUID)
+	if err != nil {
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": invitations})
+}
+
+func (h *handler) revokeInvitation(c *gin.Context) {
+	userUUID, boardUUID, invitationUUID, ok := h.invitationParams(c)
+	if !ok {
+		return
+	}
+
+	err := h.syncService.revokeBoardInvitation(c.Request.Context(), userUUID, boardUUID, invitationUUID)
+	if err != nil {
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful"})
+}
+
+func (h *handler) resendInvitation(c *gin.Context) {
+	userUUID, boardUUID, invitationUUID, ok := h.invitationParams(c)
+	if !ok {
+		return
+	}
+
+	sent, err := h.syncService.resendBoardInvitation(c.Request.Context(), userUUID, boardUUID, invitationUUID)
+	if err != nil {
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.notifyInvite(sent)
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": sent.Invitation})
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (h *handler) acceptInvitation(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req acceptInvitationRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fields: " + err.Error()})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	invitation, err := h.syncService.acceptBoardInvitation(c.Request.Context(), userUUID, req.Token)
+	switch {
+	case errors.Is(err, errInvalidInvite):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errInviteEmail):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": invitation})
+}
+
+func (h *handler) getPendingInvitations(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	invitations, err := h.syncService.pendingInvitations(c.Request.Context(), userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": invitations})
+}
+
+func (h *handler) getBoardMembers(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	boardID := c.Param("boardId")
+	if boardID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "board id is required"})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse user id to uuid: " + err.Error()})
+		return
+	}
+
+	boardUUID, err := uuid.Parse(boardID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "couldnt parse board id to uuid: " + err.Error()})
+		return
+	}
+
+	boardMembers, err := h.syncService.getBoardMembers(c, boardUUID, userUUID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "successful", "data": boardMembers})
+
+}
+
+func (h *handler) getBoardMetadata(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	boardID := c.Param("boardId")
+	if boardID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "board id is required"})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id: " + err.Error()})
+		return
+	}
+
+	boardUUID, err := uuid.Parse(boardID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid board id: " + err.Error()})
+		return
+	}
+
+	metadata, err := h.syncService.getBoardMetadata(c, boardUUID, userUUID)
+	if err != nil {
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "successful", "data": metadata})
+}
+
+func (h *handler) getConnectedUsers(c *gin.Context) {
+	userID, err := h.authService.GetUserIDFromContext(c.Request.Context())
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	boardID := c.Param("boardId")
+	if boardID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "board id is required"})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id: " + err.Error()})
+		return
+	}
+
+	boardUUID, err := uuid.Parse(boardID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid board id: " + err.Error()})
+		return
+	}
+
+	if err := h.syncService.access.Board(c, userUUID, boardUUID, access.Read); err != nil {
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get everyone's presence from room manager
+	if h.rooms == nil {
+		c.JSON(http.StatusOK, gin.H{"data": []types.Presence{}})
+		return
+	}
+
+	presence, err := h.rooms.Presence(boardID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"data": []types.Presence{}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": presence})
+}
+
+func (h *handler) getLatestAppVersion(c *gin.Context) {
+
 	version, err := h.syncService.getAppLatestVersion(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -1226,6 +1954,29 @@ func (h *handler) transcribeAndProcess(c *gin.Context) {
 		return
 	}
 
+	boardUUID, err := uuid.Parse(boardID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid board_id"})
+		return
+	}
+
+	// checked before the audio is transcribed, a stranger's board shouldn't cost a transcription
+	if err := h.syncService.access.Board(c.Request.Context(), userUUID, boardUUID, access.Write); err != nil {
+		c.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// the server can't read an encrypted board's cards, so it mustn't write plaintext ones into it either
+	encrypted, err := h.syncService.isBoardEncrypted(c.Request.Context(), boardID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if encrypted {
+		c.JSON(http.StatusForbidden, gin.H{"error": "AI processing is disabled for encrypted boards"})
+		return
+	}
+
 	file, _, err := c.Request.FormFile("audio")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "audio file is required"})
@@ -1294,28 +2045,56 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func (h *handler) handleSyncWebSocket(w http.ResponseWriter, r *http.Request, userID string) {
+// handleSyncWebSocket keeps deviceID's socket open for sync signals, it starts with the boards the user lost
+func (h *handler) handleSyncWebSocket(w http.ResponseWriter, r *http.Request, userID, deviceID string) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade sync websocket: %v", err)
 		return
 	}
 
-	hub := synchub.Get()
-	if hub == nil {
+	if h.hub == nil {
 		log.Println("Sync hub not initialized")
 		conn.Close()
 		return
 	}
 
+	// a device that was away when its user lost a board, or that only hears it now, archives the board straight away
+	if userUUID, err := uuid.Parse(userID); err == nil {
+		lost, err := h.syncService.lostBoards(r.Context(), userUUID)
+		if err != nil {
+			log.Printf("unable to list lost boards for user %s: %v", userID, err)
+		}
+		for _, boardID := range lost {
+			message := synchub.SyncMessage{Type: synchub.BoardRemovedMessage, UserID: userID, BoardID: boardID}
+			if err := conn.WriteJSON(message); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+
 	client := &synchub.SyncClient{
-		UserID: userID,
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
+		UserID:   userID,
+		DeviceID: deviceID,
+		Conn:     conn,
+		Send:     make(chan []byte, 256),
 	}
 
-	hub.Register(client)
+	h.hub.Register(client)
 
 	go client.WritePump()
-	go client.ReadPump(hub)
+	go client.ReadPump(h.hub)
+}
+
+// accessStatus is the status for an error that may have come from central/access
+func accessStatus(err error) int {
+	switch {
+	case errors.Is(err, access.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, access.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
 }
@@ -0,0 +1,379 @@
+package central
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+	"seisami/server/central/access"
+	"seisami/server/centraldb"
+	"seisami/server/types"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// an invite stays pending in board_invitations until whoever owns its email accepts it. its link is only mailed and
+// its token just names the invitation, whether it's still open is read from the row
+
+var (
+	errInvalidInvite = errors.New("invite is invalid or has expired")
+	errInviteEmail   = errors.New("invite was sent to a different email")
+	errAlreadyMember = errors.New("user is already a member of the board")
+)
+
+type inviteClaims struct {
+	BoardID string `json:"board_id"`
+	jwt.RegisteredClaims
+}
+
+type inviteSigner struct {
+	key []byte
+	ttl time.Duration
+}
+
+// newInviteSigner derives its key from secret, an invite token is never accepted as a login token or the reverse
+func newInviteSigner(secret string, ttl time.Duration) inviteSigner {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("board invitations"))
+	return inviteSigner{key: mac.Sum(nil), ttl: ttl}
+}
+
+func (s inviteSigner) sign(inv centraldb.BoardInvitation) (string, error) {
+	claims := inviteClaims{
+		BoardID: inv.BoardID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        inv.ID.String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(inv.ExpiresAt.Time),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.key)
+}
+
+// parse is the invitation id token was signed for
+func (s inviteSigner) parse(token string) (uuid.UUID, error) {
+	var claims inviteClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return s.key, nil
+	})
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w: %v", errInvalidInvite, err)
+	}
+
+	id, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w: %v", errInvalidInvite, err)
+	}
+
+	return id, nil
+}
+
+// inviteLink is the deep link the desktop app imports boardID from, accepting token first
+func inviteLink(boardID, token string) string {
+	query := url.Values{}
+	query.Set("board_id", boardID)
+	query.Set("invite", token)
+	return "seisami://board/import?" + query.Encode()
+}
+
+func exportInvitation(inv centraldb.BoardInvitation) types.BoardInvitation {
+	return types.BoardInvitation{
+		ID:        inv.ID.String(),
+		BoardID:   inv.BoardID.String(),
+		Email:     inv.Email,
+		Role:      inv.Role,
+		CreatedAt: inv.CreatedAt.Time.Format(time.RFC3339),
+		ExpiresAt: inv.ExpiresAt.Time.Format(time.RFC3339),
+		Expired:   !inv.ExpiresAt.Time.After(time.Now()),
+	}
+}
+
+// withLink is inv with a freshly signed link in it, only for whoever the invite was sent to
+func (s *SyncService) withLink(inv centraldb.BoardInvitation) (types.BoardInvitation, error) {
+	exported := exportInvitation(inv)
+
+	token, err := s.invites.sign(inv)
+	if err != nil {
+		return types.BoardInvitation{}, fmt.Errorf("unable to sign invite: %v", err)
+	}
+	exported.Link = inviteLink(exported.BoardID, token)
+
+	return exported, nil
+}
+
+// sentInvite is an invitation, its link and the account it went to. Recipient isn't valid until someone signs up with
+// its email and verifies it
+type sentInvite struct {
+	Invitation types.BoardInvitation
+	Link       string
+	Recipient  pgtype.UUID
+}
+
+// sendInvite mails inv's link to its email and returns it without the link, which is only for the mailbox's owner
+func (s *SyncService) sendInvite(ctx context.Context, inv centraldb.BoardInvitation, recipient pgtype.UUID) (sentInvite, error) {
+	invitation, err := s.withLink(inv)
+	if err != nil {
+		return sentInvite{}, err
+	}
+
+	body := fmt.Sprintf("You've been invited to a board on Seisami. Open this link on a computer with Seisami installed to join it:\n\n%s\n\nSign up with this email first if you don't have an account. The link works until %s.", invitation.Link, inv.ExpiresAt.Time.UTC().Format(time.RFC1123))
+	if err := s.mailer.Send(ctx, inv.Email, "You've been invited to a board", body); err != nil {
+		return sentInvite{}, err
+	}
+
+	sent := sentInvite{Invitation: invitation, Link: invitation.Link, Recipient: recipient}
+	sent.Invitation.Link = ""
+	return sent, nil
+}
+
+// inviteUserToBoard leaves an invite for payload.Email on the board, inviting the same email again renews the open one
+func (s *SyncService) inviteUserToBoard(ctx context.Context, userID uuid.UUID, payload boardMemberActionPayload) (sentInvite, error) {
+	boardID, err := uuid.Parse(payload.BoardID)
+	if err != nil {
+		return sentInvite{}, fmt.Errorf("unable to parse board id to uuid: %v", err)
+	}
+	// invites are editors unless they're asked to be something else
+	role := types.BoardEditorRole.String()
+	if payload.Role != "" {
+		role, err = assignableRole(payload.Role)
+		if err != nil {
+			return sentInvite{}, err
+		}
+	}
+
+	err = s.access.ManageMember(ctx, userID, boardID, role)
+	if err != nil {
+		return sentInvite{}, err
+	}
+
+	email := strings.TrimSpace(payload.Email)
+
+	var recipient pgtype.UUID
+	user, err := s.queries.GetUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		if user.EmailVerifiedAt.Valid {
+			recipient = user.ID
+		}
+		if _, err := s.access.Role(ctx, user.ID.Bytes, boardID); err == nil {
+			return sentInvite{}, errAlreadyMember
+		} else if !errors.Is(err, access.ErrForbidden) {
+			return sentInvite{}, err
+		}
+	case !errors.Is(err, pgx.ErrNoRows):
+		return sentInvite{}, fmt.Errorf("unable to get user by email %v: %v", email, err)
+	}
+
+	inv, err := s.queries.CreateBoardInvitation(ctx, centraldb.CreateBoardInvitationParams{
+		ID:        pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		BoardID:   pgtype.UUID{Bytes: boardID, Valid: true},
+		Email:     email,
+		Role:      role,
+		InvitedBy: pgtype.UUID{Bytes: userID, Valid: true},
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(s.invites.ttl), Valid: true},
+	})
+	if err != nil {
+		return sentInvite{}, fmt.Errorf("unable to invite member to board: %v", err)
+	}
+
+	return s.sendInvite(ctx, inv, recipient)
+}
+
+// listBoardInvitations is every invite on boardID nobody accepted or revoked yet, expired ones too for resending
+func (s *SyncService) listBoardInvitations(ctx context.Context, userID, boardID uuid.UUID) ([]types.BoardInvitation, error) {
+	if err := s.access.Board(ctx, userID, boardID, access.Manage); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.queries.ListBoardInvitations(ctx, pgtype.UUID{Bytes: boardID, Valid: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list board invitations: %v", err)
+	}
+
+	invitations := make([]types.BoardInvitation, 0, len(rows))
+	for _, row := range rows {
+		invitations = append(invitations, exportInvitation(row))
+	}
+
+	return invitations, nil
+}
+
+// boardInvitation is the open invitationID on boardID, userID has to be allowed to manage the role it hands out
+func (s *SyncService) boardInvitation(ctx context.Context, userID, boardID, invitationID uuid.UUID) (centraldb.BoardInvitation, error) {
+	if err := s.access.Board(ctx, userID, boardID, access.Manage); err != nil {
+		return centraldb.BoardInvitation{}, err
+	}
+
+	inv, err := s.queries.GetBoardInvitation(ctx, pgtype.UUID{Bytes: invitationID, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && inv.BoardID.Bytes != boardID) {
+		return centraldb.BoardInvitation{}, fmt.Errorf("%w: invitation %s", access.ErrNotFound, invitationID)
+	}
+	if err != nil {
+		return centraldb.BoardInvitation{}, fmt.Errorf("unable to get invitation: %v", err)
+	}
+
+	if err := s.access.ManageMember(ctx, userID, boardID, inv.Role); err != nil {
+		return centraldb.BoardInvitation{}, err
+	}
+
+	return inv, nil
+}
+
+// revokeBoardInvitation closes invitationID, its link stops working straight away
+func (s *SyncService) revokeBoardInvitation(ctx context.Context, userID, boardID, invitationID uuid.UUID) error {
+	if _, err := s.boardInvitation(ctx, userID, boardID, invitationID); err != nil {
+		return err
+	}
+
+	revoked, err := s.queries.RevokeBoardInvitation(ctx, centraldb.RevokeBoardInvitationParams{
+		ID:      pgtype.UUID{Bytes: invitationID, Valid: true},
+		BoardID: pgtype.UUID{Bytes: boardID, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to revoke invitation: %v", err)
+	}
+	if revoked == 0 {
+		return fmt.Errorf("%w: invitation %s is no longer pending", access.ErrNotFound, invitationID)
+	}
+
+	return nil
+}
+
+// resendBoardInvitation starts invitationID's expiry over and mails a new link for it
+func (s *SyncService) resendBoardInvitation(ctx context.Context, userID, boardID, invitationID uuid.UUID) (sentInvite, error) {
+	if _, err := s.boardInvitation(ctx, userID, boardID, invitationID); err != nil {
+		return sentInvite{}, err
+	}
+
+	inv, err := s.queries.RenewBoardInvitation(ctx, centraldb.RenewBoardInvitationParams{
+		ID:        pgtype.UUID{Bytes: invitationID, Valid: true},
+		BoardID:   pgtype.UUID{Bytes: boardID, Valid: true},
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(s.invites.ttl), Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sentInvite{}, fmt.Errorf("%w: invitation %s is no longer pending", access.ErrNotFound, invitationID)
+	}
+	if err != nil {
+		return sentInvite{}, fmt.Errorf("unable to renew invitation: %v", err)
+	}
+
+	var recipient pgtype.UUID
+	if user, err := s.queries.GetUserByEmail(ctx, inv.Email); err == nil && user.EmailVerifiedAt.Valid {
+		recipient = user.ID
+	}
+
+	return s.sendInvite(ctx, inv, recipient)
+}
+
+// acceptBoardInvitation makes userID a member of the board token invites them to, with the role it was sent with
+func (s *SyncService) acceptBoardInvitation(ctx context.Context, userID uuid.UUID, token string) (types.BoardInvitation, error) {
+	invitationID, err := s.invites.parse(token)
+	if err != nil {
+		return types.BoardInvitation{}, err
+	}
+
+	user, err := s.queries.GetUserByID(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return types.BoardInvitation{}, fmt.Errorf("unable to get user: %v", err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return types.BoardInvitation{}, fmt.Errorf("unable to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+
+	inv, err := qtx.GetBoardInvitation(ctx, pgtype.UUID{Bytes: invitationID, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.BoardInvitation{}, errInvalidInvite
+	}
+	if err != nil {
+		return types.BoardInvitation{}, fmt.Errorf("unable to get invitation: %v", err)
+	}
+	if !strings.EqualFold(inv.Email, user.Email) {
+		return types.BoardInvitation{}, errInviteEmail
+	}
+	// opening the same link again once it's accepted is fine, the import is what gets retried
+	if inv.AcceptedAt.Valid && inv.AcceptedBy == user.ID {
+		return exportInvitation(inv), nil
+	}
+
+	inv, err = qtx.AcceptBoardInvitation(ctx, centraldb.AcceptBoardInvitationParams{
+		ID:         inv.ID,
+		AcceptedBy: user.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.BoardInvitation{}, errInvalidInvite
+	}
+	if err != nil {
+		return types.BoardInvitation{}, fmt.Errorf("unable to accept invitation: %v", err)
+	}
+
+	err = qtx.InsertBoardMember(ctx, centraldb.InsertBoardMemberParams{
+		BoardID: inv.BoardID,
+		UserID:  user.ID,
+		Role:    pgtype.Text{String: inv.Role, Valid: true},
+	})
+	if err != nil {
+		return types.BoardInvitation{}, fmt.Errorf("unable to add member to board: %v", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return types.BoardInvitation{}, fmt.Errorf("unable to commit invitation: %v", err)
+	}
+
+	return exportInvitation(inv), nil
+}
+
+// pendingInvitations is every invite waiting on userID's email with its accept link, none until the email is verified
+func (s *SyncService) pendingInvitations(ctx context.Context, userID uuid.UUID) ([]types.BoardInvitation, error) {
+	user, err := s.queries.GetUserByID(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user: %v", err)
+	}
+	// anyone can sign up with an address they don't own, its invites would be theirs for the taking
+	if !user.EmailVerifiedAt.Valid {
+		return nil, nil
+	}
+
+	rows, err := s.queries.ListPendingInvitationsForEmail(ctx, user.Email)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pending invitations: %v", err)
+	}
+
+	invitations := make([]types.BoardInvitation, 0, len(rows))
+	for _, row := range rows {
+		invitation, err := s.withLink(centraldb.BoardInvitation{
+			ID:         row.ID,
+			BoardID:    row.BoardID,
+			Email:      row.Email,
+			Role:       row.Role,
+			InvitedBy:  row.InvitedBy,
+			CreatedAt:  row.CreatedAt,
+			ExpiresAt:  row.ExpiresAt,
+			AcceptedAt: row.AcceptedAt,
+			AcceptedBy: row.AcceptedBy,
+			RevokedAt:  row.RevokedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		invitation.BoardName = row.BoardName
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, nil
+}
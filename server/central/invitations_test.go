@@ -0,0 +1,112 @@
+package central
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"seisami/server/centraldb"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func testInvitation(expiresAt time.Time) centraldb.BoardInvitation {
+	return centraldb.BoardInvitation{
+		ID:        pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		BoardID:   pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email:     "friend@example.com",
+		Role:      "editor",
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	}
+}
+
+func TestInviteTokens(t *testing.T) {
+	signer := newInviteSigner("secret", time.Hour)
+	inv := testInvitation(time.Now().Add(time.Hour))
+
+	t.Run("round_trip", func(t *testing.T) {
+		token, err := signer.sign(inv)
+		if err != nil {
+			t.Fatalf("expected a token, got %v", err)
+		}
+		id, err := signer.parse(token)
+		if err != nil || id != inv.ID.Bytes {
+			t.Errorf("expected invitation %s, got %s (%v)", uuid.UUID(inv.ID.Bytes), id, err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		token, _ := signer.sign(inv)
+		if _, err := signer.parse(token + "x"); !errors.Is(err, errInvalidInvite) {
+			t.Errorf("expected errInvalidInvite, got %v", err)
+		}
+	})
+
+	t.Run("other_secret", func(t *testing.T) {
+		token, _ := newInviteSigner("other", time.Hour).sign(inv)
+		if _, err := signer.parse(token); !errors.Is(err, errInvalidInvite) {
+			t.Errorf("expected errInvalidInvite, got %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token, _ := signer.sign(testInvitation(time.Now().Add(-time.Minute)))
+		if _, err := signer.parse(token); !errors.Is(err, errInvalidInvite) {
+			t.Errorf("expected errInvalidInvite, got %v", err)
+		}
+	})
+
+	t.Run("login_token", func(t *testing.T) {
+		claims := jwt.RegisteredClaims{ID: uuid.NewString(), ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if _, err := signer.parse(token); !errors.Is(err, errInvalidInvite) {
+			t.Errorf("expected errInvalidInvite, got %v", err)
+		}
+	})
+}
+
+func TestInviteLink(t *testing.T) {
+	link, err := url.Parse(inviteLink("board-1", "a.b+c"))
+	if err != nil {
+		t.Fatalf("expected a link, got %v", err)
+	}
+	if link.Scheme != "seisami" || link.Host != "board" || link.Path != "/import" {
+		t.Errorf("expected seisami://board/import, got %s", link)
+	}
+	if link.Query().Get("board_id") != "board-1" || link.Query().Get("invite") != "a.b+c" {
+		t.Errorf("expected the board & the token in the query, got %s", link.RawQuery)
+	}
+}
+
+// sentMail keeps what would have been mailed
+type sentMail struct {
+	to, subject, body []string
+}
+
+func (m *sentMail) Send(ctx context.Context, to, subject, body string) error {
+	m.to, m.subject, m.body = append(m.to, to), append(m.subject, subject), append(m.body, body)
+	return nil
+}
+
+// the link goes to the invited mailbox only, the inviter gets the invitation without it
+func TestSendInvite(t *testing.T) {
+	mailer := &sentMail{}
+	s := &SyncService{invites: newInviteSigner("secret", time.Hour), mailer: mailer}
+	inv := testInvitation(time.Now().Add(time.Hour))
+
+	sent, err := s.sendInvite(context.Background(), inv, pgtype.UUID{})
+	if err != nil {
+		t.Fatalf("expected the invite to be sent, got %v", err)
+	}
+
+	if sent.Invitation.Link != "" {
+		t.Errorf("expected no link for the inviter, got %s", sent.Invitation.Link)
+	}
+	if len(mailer.to) != 1 || mailer.to[0] != inv.Email || !strings.Contains(mailer.body[0], sent.Link) {
+		t.Errorf("expected the link to be mailed to %s, got %+v", inv.Email, mailer)
+	}
+}
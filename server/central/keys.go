@@ -0,0 +1,182 @@
+package central
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seisami/server/central/access"
+	"seisami/server/centraldb"
+	"seisami/server/types"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// the server only keeps the keys and sealed values the desktop app uploads, it can't open them. that's why the AI
+// endpoints refuse encrypted boards
+
+// boardKeys tells whether a board is encrypted, the queries answer it
+type boardKeys interface {
+	IsBoardEncrypted(ctx context.Context, boardID pgtype.UUID) (bool, error)
+}
+
+var (
+	errKeyMismatch      = errors.New("a different public key is already registered for this user")
+	errNotKeyHolder     = errors.New("not a member of this board")
+	errBoardKeyRequired = errors.New("only a member holding the board key can share it")
+)
+
+// getUserKeys returns false when the user never enabled encryption
+func (s *SyncService) getUserKeys(ctx context.Context, userUUID uuid.UUID) (types.UserKeys, bool, error) {
+	keys, err := s.queries.GetUserKeys(ctx, pgtype.UUID{Bytes: userUUID, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.UserKeys{}, false, nil
+	}
+	if err != nil {
+		return types.UserKeys{}, false, fmt.Errorf("unable to get user keys: %v", err)
+	}
+
+	return types.UserKeys{
+		PublicKey:           keys.PublicKey,
+		EncryptedPrivateKey: keys.EncryptedPrivateKey,
+		Salt:                keys.Salt,
+	}, true, nil
+}
+
+// putUserKeys registers the user's keypair or re-seals its private key under a new passphrase
+func (s *SyncService) putUserKeys(ctx context.Context, userUUID uuid.UUID, keys types.UserKeys) error {
+	n, err := s.queries.UpsertUserKeys(ctx, centraldb.UpsertUserKeysParams{
+		UserID:              pgtype.UUID{Bytes: userUUID, Valid: true},
+		PublicKey:           keys.PublicKey,
+		EncryptedPrivateKey: keys.EncryptedPrivateKey,
+		Salt:                keys.Salt,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save user keys: %v", err)
+	}
+	if n == 0 {
+		return errKeyMismatch
+	}
+
+	return nil
+}
+
+func (s *SyncService) boardKeyHolders(ctx context.Context, q *centraldb.Queries, boardUUID uuid.UUID) ([]centraldb.ListBoardKeyHoldersRow, error) {
+	holders, err := q.ListBoardKeyHolders(ctx, pgtype.UUID{Bytes: boardUUID, Valid: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list board key holders: %v", err)
+	}
+
+	return holders, nil
+}
+
+func findKeyHolder(holders []centraldb.ListBoardKeyHoldersRow, userID string) (centraldb.ListBoardKeyHoldersRow, bool) {
+	for _, holder := range holders {
+		if holder.UserID.String() == userID {
+			return holder, true
+		}
+	}
+
+	return centraldb.ListBoardKeyHoldersRow{}, false
+}
+
+func (s *SyncService) getBoardKeys(ctx context.Context, userUUID, boardUUID uuid.UUID) (types.BoardKeys, error) {
+	if err := s.access.Board(ctx, userUUID, boardUUID, access.Read); err != nil {
+		return types.BoardKeys{}, err
+	}
+
+	holders, err := s.boardKeyHolders(ctx, s.queries, boardUUID)
+	if err != nil {
+		return types.BoardKeys{}, err
+	}
+
+	me, ok := findKeyHolder(holders, userUUID.String())
+	if !ok {
+		return types.BoardKeys{}, errNotKeyHolder
+	}
+
+	keys := types.BoardKeys{
+		WrappedKey: me.WrappedKey,
+		Members:    make([]types.BoardKeyHolder, len(holders)),
+	}
+	for i, holder := range holders {
+		keys.Members[i] = types.BoardKeyHolder{
+			UserID:    holder.UserID.String(),
+			PublicKey: holder.PublicKey,
+			HasKey:    holder.WrappedKey != "",
+		}
+	}
+
+	return keys, nil
+}
+
+// putBoardKeys stores the board key wrapped for some members. the first one makes the board encrypted, after that only
+// a key holder can hand it on and a member's wrapped key never changes
+func (s *SyncService) putBoardKeys(ctx context.Context, userUUID, boardUUID uuid.UUID, keys []types.WrappedBoardKey) error {
+	if err := s.access.Board(ctx, userUUID, boardUUID, access.Write); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+
+	holders, err := s.boardKeyHolders(ctx, qtx, boardUUID)
+	if err != nil {
+		return err
+	}
+
+	me, ok := findKeyHolder(holders, userUUID.String())
+	if !ok {
+		return errNotKeyHolder
+	}
+
+	encrypted, err := qtx.IsBoardEncrypted(ctx, pgtype.UUID{Bytes: boardUUID, Valid: true})
+	if err != nil {
+		return fmt.Errorf("unable to check board encryption: %v", err)
+	}
+	if encrypted && me.WrappedKey == "" {
+		return errBoardKeyRequired
+	}
+
+	for _, key := range keys {
+		holder, ok := findKeyHolder(holders, key.UserID)
+		if !ok {
+			return fmt.Errorf("user %s is %w", key.UserID, errNotKeyHolder)
+		}
+
+		err := qtx.UpsertBoardKey(ctx, centraldb.UpsertBoardKeyParams{
+			BoardID:    pgtype.UUID{Bytes: boardUUID, Valid: true},
+			UserID:     holder.UserID,
+			WrappedKey: key.WrappedKey,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to save board key: %v", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit board keys: %v", err)
+	}
+
+	return nil
+}
+
+func (s *SyncService) isBoardEncrypted(ctx context.Context, boardID string) (bool, error) {
+	boardUUID, err := uuid.Parse(boardID)
+	if err != nil {
+		return false, fmt.Errorf("invalid board id: %v", err)
+	}
+
+	encrypted, err := s.keys.IsBoardEncrypted(ctx, pgtype.UUID{Bytes: boardUUID, Valid: true})
+	if err != nil {
+		return false, fmt.Errorf("unable to check board encryption: %v", err)
+	}
+
+	return encrypted, nil
+}
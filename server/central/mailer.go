@@ -0,0 +1,67 @@
+package central
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends plain text mail, the only way the server reaches someone's mailbox
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// newMailer sends through cfg's SMTP server, without one mail only goes to the log
+func newMailer(cfg Config) Mailer {
+	if cfg.SMTPHost == "" {
+		return logMailer{}
+	}
+
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	return smtpMailer{addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort), from: cfg.MailFrom, auth: auth}
+}
+
+func (m smtpMailer) Send(ctx context.Context, to, subject, body string) error {
+	addr, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid email %q: %v", to, err)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + addr.Address,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{addr.Address}, []byte(msg)); err != nil {
+		return fmt.Errorf("unable to send mail: %v", err)
+	}
+
+	return nil
+}
+
+// logMailer is for servers without SMTP, like a local one, whoever runs it reads the mail in its log
+type logMailer struct{}
+
+func (logMailer) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("no SMTP server configured, mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
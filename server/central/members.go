@@ -0,0 +1,186 @@
+package central
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seisami/server/central/access"
+	"seisami/server/centraldb"
+	"seisami/server/types"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// everyone on a board has one role, viewer, commenter, editor, admin or owner. central/access enforces them, the
+// functions here only change who has which
+
+var (
+	errInvalidRole    = errors.New("role must be viewer, commenter, editor or admin")
+	errOwnerLeaving   = errors.New("the owner has to transfer the board before leaving it")
+	errTransferToSelf = errors.New("the board already belongs to you")
+)
+
+// assignableRole is role when someone may be given it, owners change by transfer and nobody is made a plain member
+func assignableRole(role string) (string, error) {
+	parsed, ok := types.ParseBoardRole(role)
+	if !ok || parsed == types.BoardOwnerRole || parsed == types.BoardMemberRole {
+		return "", fmt.Errorf("%w, got %q", errInvalidRole, role)
+	}
+
+	return parsed.String(), nil
+}
+
+// memberRole is memberID's role on boardID, ErrNotFound when they aren't on it
+func (s *SyncService) memberRole(ctx context.Context, memberID, boardID uuid.UUID) (string, error) {
+	role, err := s.access.Role(ctx, memberID, boardID)
+	if errors.Is(err, access.ErrForbidden) {
+		return "", fmt.Errorf("%w: user %s is not a member of board %s", access.ErrNotFound, memberID, boardID)
+	}
+
+	return role, err
+}
+
+// setBoardMemberRole gives memberID role on boardID, userID has to be allowed to manage them both before and after
+func (s *SyncService) setBoardMemberRole(ctx context.Context, userID, boardID, memberID uuid.UUID, role string) error {
+	role, err := assignableRole(role)
+	if err != nil {
+		return err
+	}
+
+	// who is on a board is only told to those who manage it
+	if err := s.access.Board(ctx, userID, boardID, access.Manage); err != nil {
+		return err
+	}
+
+	current, err := s.memberRole(ctx, memberID, boardID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.access.ManageMember(ctx, userID, boardID, current); err != nil {
+		return err
+	}
+	if err := s.access.ManageMember(ctx, userID, boardID, role); err != nil {
+		return err
+	}
+
+	updated, err := s.queries.UpdateBoardMemberRole(ctx, centraldb.UpdateBoardMemberRoleParams{
+		BoardID: pgtype.UUID{Bytes: boardID, Valid: true},
+		UserID:  pgtype.UUID{Bytes: memberID, Valid: true},
+		Role:    pgtype.Text{String: role, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to change board role: %v", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w: user %s is not a member of board %s", access.ErrNotFound, memberID, boardID)
+	}
+
+	return nil
+}
+
+// transferBoardOwnership makes newOwnerID, who has to be on the board already, its owner and leaves userID an admin
+func (s *SyncService) transferBoardOwnership(ctx context.Context, userID, boardID, newOwnerID uuid.UUID) error {
+	if err := s.access.Board(ctx, userID, boardID, access.Own); err != nil {
+		return err
+	}
+
+	if newOwnerID == userID {
+		return errTransferToSelf
+	}
+
+	if _, err := s.memberRole(ctx, newOwnerID, boardID); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+
+	board := pgtype.UUID{Bytes: boardID, Valid: true}
+	if _, err := qtx.SetBoardOwner(ctx, centraldb.SetBoardOwnerParams{
+		ID:     board,
+		UserID: pgtype.UUID{Bytes: newOwnerID, Valid: true},
+	}); err != nil {
+		return fmt.Errorf("unable to change board owner: %v", err)
+	}
+
+	roles := []struct {
+		userID uuid.UUID
+		role   types.BoardRole
+	}{
+		{newOwnerID, types.BoardOwnerRole},
+		{userID, types.BoardAdminRole},
+	}
+	for _, r := range roles {
+		_, err := qtx.UpdateBoardMemberRole(ctx, centraldb.UpdateBoardMemberRoleParams{
+			BoardID: board,
+			UserID:  pgtype.UUID{Bytes: r.userID, Valid: true},
+			Role:    pgtype.Text{String: r.role.String(), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to change board role: %v", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit ownership transfer: %v", err)
+	}
+
+	return nil
+}
+
+// leaveBoard takes userID off boardID, the owner can't leave a board without an owner behind
+func (s *SyncService) leaveBoard(ctx context.Context, userID, boardID uuid.UUID) error {
+	role, err := s.access.Role(ctx, userID, boardID)
+	if err != nil {
+		return err
+	}
+
+	if role == types.BoardOwnerRole.String() {
+		return errOwnerLeaving
+	}
+
+	err = s.queries.RemoveBoardMember(ctx, centraldb.RemoveBoardMemberParams{
+		BoardID: pgtype.UUID{Bytes: boardID, Valid: true},
+		UserID:  pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to leave board: %v", err)
+	}
+
+	return s.recordLostBoard(ctx, userID, boardID)
+}
+
+// recordLostBoard keeps boardID for userID's devices that weren't there when they lost it, see lostBoards
+func (s *SyncService) recordLostBoard(ctx context.Context, userID, boardID uuid.UUID) error {
+	err := s.queries.RecordLostBoard(ctx, centraldb.RecordLostBoardParams{
+		UserID:  pgtype.UUID{Bytes: userID, Valid: true},
+		BoardID: pgtype.UUID{Bytes: boardID, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to record lost board: %v", err)
+	}
+
+	return nil
+}
+
+// lostBoards is every board userID was removed from or left and isn't back on, a device archives them when it connects
+func (s *SyncService) lostBoards(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	rows, err := s.queries.ListLostBoards(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list lost boards: %v", err)
+	}
+
+	boardIDs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		boardIDs = append(boardIDs, uuid.UUID(row.Bytes).String())
+	}
+
+	return boardIDs, nil
+}
@@ -0,0 +1,165 @@
+package central
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"seisami/server/centraldb"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// a field from an incoming op is only written when the op is newer than the field's clock in field_clocks, so
+// concurrent edits to different fields of a card both survive
+
+var cardFields = []string{"column_id", "title", "description", "attachments"}
+
+// tombstoneField is the pseudo field whose clock orders the deletes and restores of a record, payloads never carry it
+const tombstoneField = "deleted_at"
+
+func encodeFields(names []string) string {
+	if names == nil {
+		return ""
+	}
+
+	b, _ := json.Marshal(names)
+	return string(b)
+}
+
+// unionFields combines the stored fields of several ops on one record, an op that touched the whole record wins
+func unionFields(encoded []string) ([]string, error) {
+	seen := make(map[string]bool)
+	union := make([]string, 0)
+
+	for _, e := range encoded {
+		if e == "" {
+			return nil, nil
+		}
+
+		var names []string
+		if err := json.Unmarshal([]byte(e), &names); err != nil {
+			return nil, fmt.Errorf("invalid operation fields %q: %v", e, err)
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				union = append(union, name)
+			}
+		}
+	}
+
+	return union, nil
+}
+
+func touchesField(names []string, field string) bool {
+	if names == nil {
+		return true
+	}
+
+	for _, name := range names {
+		if name == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shouldApplyField reports whether op may write field, ops without an hlc keep the old last writer wins
+func shouldApplyField(op SyncOperation, clocks map[string]string, field string) bool {
+	if !touchesField(op.Fields, field) {
+		return false
+	}
+
+	return op.HLC == "" || clocks[field] < op.HLC
+}
+
+// applyTombstone runs apply (a soft delete or a restore) unless a newer delete or restore of the record already landed,
+// so a delete an offline device only syncs now can't hide a record that has been restored since
+func (s *SyncService) applyTombstone(ctx context.Context, op SyncOperation, apply func() error) error {
+	clocks, err := s.fieldClocks(ctx, op.TableName, op.RecordID)
+	if err != nil {
+		return err
+	}
+	if op.HLC != "" && clocks[tombstoneField] >= op.HLC {
+		return nil
+	}
+
+	if err := apply(); err != nil {
+		return err
+	}
+
+	if op.HLC == "" {
+		return nil
+	}
+	return s.recordFieldClocks(ctx, op, op.RecordID, []string{tombstoneField})
+}
+
+func (s *SyncService) fieldClocks(ctx context.Context, tableName, recordID string) (map[string]string, error) {
+	rows, err := s.queries.GetFieldClocks(ctx, centraldb.GetFieldClocksParams{
+		TableName: tableName,
+		RecordID:  recordID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get field clocks: %v", err)
+	}
+
+	clocks := make(map[string]string, len(rows))
+	for _, row := range rows {
+		clocks[row.Field] = row.Hlc
+	}
+
+	return clocks, nil
+}
+
+func (s *SyncService) recordFieldClocks(ctx context.Context, op SyncOperation, recordID string, names []string) error {
+	for _, name := range names {
+		err := s.queries.UpsertFieldClock(ctx, centraldb.UpsertFieldClockParams{
+			TableName: op.TableName,
+			RecordID:  recordID,
+			Field:     name,
+			Hlc:       op.HLC,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to record field clock: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// pendingFields unions the fields of every op on the records since the client last synced, only the latest op per
+// record is pulled so it has to speak for the ones it hides. The pulling device's own ops are left out like they are
+// from the pull.
+func (s *SyncService) pendingFields(ctx context.Context, userUUID uuid.UUID, tableName string, recordIDs []string, after position, since int64, deviceID string) (map[string][]string, error) {
+	boards, seqs := after.arrays()
+	rows, err := s.queries.ListOperationFieldsAfterPosition(ctx, centraldb.ListOperationFieldsAfterPositionParams{
+		RecordIds:      recordIDs,
+		PositionBoards: boards,
+		PositionSeqs:   seqs,
+		Since:          since,
+		TableName:      tableName,
+		DeviceID:       pgtype.Text{String: deviceID, Valid: true},
+		UserID:         pgtype.UUID{Bytes: userUUID, Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get operation fields: %v", err)
+	}
+
+	encoded := make(map[string][]string)
+	for _, row := range rows {
+		encoded[row.RecordID] = append(encoded[row.RecordID], row.Fields)
+	}
+
+	fields := make(map[string][]string, len(encoded))
+	for recordID, e := range encoded {
+		union, err := unionFields(e)
+		if err != nil {
+			return nil, err
+		}
+		fields[recordID] = union
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,278 @@
+package central
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"seisami/server/central/access"
+	"seisami/server/types"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// a board's room on /ws speaks a versioned protocol. an event is checked, turned into the op a REST push would be and
+// stored through ProcessOperation, only then it's sent on with its seq. events on encrypted boards are only relayed
+// and comments are never stored
+
+var (
+	errProtocolVersion = errors.New("unsupported protocol version")
+	errInvalidEvent    = errors.New("invalid event")
+	errUnknownEvent    = errors.New("unknown event type")
+	errOtherBoard      = errors.New("event is for another board")
+)
+
+// DecodeEnvelope reads a message sent to a room, anything but a complete envelope of this version is refused
+func DecodeEnvelope(message []byte) (types.Envelope, error) {
+	var env types.Envelope
+	if err := json.Unmarshal(message, &env); err != nil {
+		return env, fmt.Errorf("%w: %v", errInvalidEvent, err)
+	}
+
+	if env.V != types.RealtimeVersion {
+		return env, fmt.Errorf("%w %d, expected %d", errProtocolVersion, env.V, types.RealtimeVersion)
+	}
+
+	if err := validator.New().Struct(&env); err != nil {
+		return env, fmt.Errorf("%w: %v", errInvalidEvent, err)
+	}
+
+	return env, nil
+}
+
+// decodeEvent reads data into event and checks it against event's validate tags
+func decodeEvent(data json.RawMessage, event any) error {
+	if err := json.Unmarshal(data, event); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidEvent, err)
+	}
+
+	if err := validator.New().Struct(event); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidEvent, err)
+	}
+
+	return nil
+}
+
+// eventOperation is the op env stands for, its payload is the checked event which is also what the room gets
+func eventOperation(env types.Envelope) (SyncOperation, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	op := SyncOperation{ID: env.ID, HLC: env.HLC, Fields: env.Fields, CreatedAt: now, UpdatedAt: now}
+
+	var event any
+	switch env.Type {
+	case "board:data":
+		var e types.BoardEvent
+		if err := decodeEvent(env.Data, &e); err != nil {
+			return op, err
+		}
+		op.TableName, op.RecordID, op.OperationType = "boards", e.ID, "update"
+		event = e
+
+	case "column:create", "column:data":
+		var e types.ColumnEvent
+		if err := decodeEvent(env.Data, &e); err != nil {
+			return op, err
+		}
+		op.TableName, op.RecordID, op.OperationType = "columns", e.ID, "update"
+		if env.Type == "column:create" {
+			op.OperationType = "insert"
+		}
+		event = e
+
+	case "column:delete":
+		var e types.ColumnDeleteEvent
+		if err := decodeEvent(env.Data, &e); err != nil {
+			return op, err
+		}
+		op.TableName, op.RecordID, op.OperationType = "columns", e.ID, "delete"
+		event = e
+
+	case "card:create", "card:data":
+		var e types.CardEvent
+		if err := decodeEvent(env.Data, &e); err != nil {
+			return op, err
+		}
+		if e.Card.ColumnID == "" {
+			e.Card.ColumnID = e.Column.ID
+		}
+		if e.Card.ColumnID != e.Column.ID {
+			return op, fmt.Errorf("%w: card %s is in column %s, not %s", errInvalidEvent, e.Card.ID, e.Card.ColumnID, e.Column.ID)
+		}
+		op.TableName, op.RecordID, op.OperationType = "cards", e.Card.ID, "update"
+		if env.Type == "card:create" {
+			op.OperationType = "insert"
+		}
+		event = e
+
+	case "card:delete":
+		var e types.CardDeleteEvent
+		if err := decodeEvent(env.Data, &e); err != nil {
+			return op, err
+		}
+		op.TableName, op.RecordID, op.OperationType = "cards", e.Card.ID, "delete"
+		event = e
+
+	case "card:column":
+		var e types.CardColumnEvent
+		if err := decodeEvent(env.Data, &e); err != nil {
+			return op, err
+		}
+		op.TableName, op.RecordID, op.OperationType = "cards", e.CardID, "update-card-column"
+		event = e
+
+	default:
+		return op, fmt.Errorf("%w: %q", errUnknownEvent, env.Type)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return op, fmt.Errorf("unable to encode event: %v", err)
+	}
+	op.Payload = string(payload)
+
+	return op, nil
+}
+
+// inBoard checks op only touches boardID, a room hears about its own board and nothing else
+func (s *SyncService) inBoard(ctx context.Context, userID, boardID uuid.UUID, op SyncOperation) error {
+	record, parent, err := operationRecords(op)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidEvent, err)
+	}
+
+	// where the record ends up, a card moved in from another board is news for the room it arrives in
+	target := record
+	if parent != nil {
+		target = *parent
+	}
+
+	var recordBoard uuid.UUID
+	if target.Table == "boards" {
+		recordBoard, err = uuid.Parse(target.ID)
+		if err != nil {
+			return fmt.Errorf("%w: board id %q", errInvalidEvent, target.ID)
+		}
+	} else {
+		recordBoard, err = s.access.Record(ctx, userID, target, access.Read)
+		if err != nil {
+			return err
+		}
+	}
+
+	if recordBoard != boardID {
+		return errOtherBoard
+	}
+
+	return nil
+}
+
+// ProcessEvent stores env, sent by userID to boardID's room, and returns it the way the rest of the room gets it. On an
+// encrypted board it's checked but not stored, and has no seq
+func (s *SyncService) ProcessEvent(ctx context.Context, userID, boardID uuid.UUID, env types.Envelope) (types.RoomEvent, error) {
+	event := types.RoomEvent{V: types.RealtimeVersion, ID: env.ID, Type: env.Type, From: userID.String()}
+
+	op, err := eventOperation(env)
+	if err != nil {
+		return event, err
+	}
+
+	if err := s.inBoard(ctx, userID, boardID, op); err != nil {
+		return event, err
+	}
+
+	encrypted, err := s.isBoardEncrypted(ctx, boardID.String())
+	if err != nil {
+		return event, err
+	}
+	if encrypted {
+		if err := s.authorizeOperation(ctx, userID, op); err != nil {
+			return event, err
+		}
+		event.Data = json.RawMessage(op.Payload)
+		return event, nil
+	}
+
+	result, err := s.ProcessOperation(ctx, userID.String(), op)
+	if err != nil {
+		return event, err
+	}
+
+	event.Seq = result.Seq
+	event.Data = json.RawMessage(op.Payload)
+
+	return event, nil
+}
+
+// ProcessComment checks userID may comment on boardID and on the card the comment is about, it's returned the way the
+// rest of the room gets it and has no seq as it isn't stored
+func (s *SyncService) ProcessComment(ctx context.Context, userID, boardID uuid.UUID, env types.Envelope) (types.RoomEvent, error) {
+	event := types.RoomEvent{V: types.RealtimeVersion, ID: env.ID, Type: env.Type, From: userID.String()}
+
+	var comment types.CommentEvent
+	if err := decodeEvent(env.Data, &comment); err != nil {
+		return event, err
+	}
+
+	if err := s.access.Board(ctx, userID, boardID, access.Comment); err != nil {
+		return event, err
+	}
+
+	if comment.CardID != "" {
+		cardBoard, err := s.access.Record(ctx, userID, access.Record{Table: "cards", ID: comment.CardID}, access.Comment)
+		if err != nil {
+			return event, err
+		}
+		if cardBoard != boardID {
+			return event, errOtherBoard
+		}
+	}
+
+	data, err := json.Marshal(comment)
+	if err != nil {
+		return event, fmt.Errorf("unable to encode comment: %v", err)
+	}
+	event.Data = data
+
+	return event, nil
+}
+
+// ProcessPresence reads a presence heartbeat userID sent to boardID's room, only those who may change the board show as
+// editing something on it, anyone else's heartbeat still counts without it
+func (s *SyncService) ProcessPresence(ctx context.Context, userID, boardID uuid.UUID, env types.Envelope) (types.PresenceEvent, error) {
+	var event types.PresenceEvent
+	if err := decodeEvent(env.Data, &event); err != nil {
+		return event, err
+	}
+
+	if err := s.access.Board(ctx, userID, boardID, access.Read); err != nil {
+		return event, err
+	}
+
+	if event.Editing != nil {
+		err := s.access.Board(ctx, userID, boardID, access.Write)
+		if errors.Is(err, access.ErrForbidden) {
+			event.Editing = nil
+		} else if err != nil {
+			return event, err
+		}
+	}
+
+	return event, nil
+}
+
+// EventError is what the sender of a refused envelope is told, a failure on the server's side stays in its log
+func EventError(err error) string {
+	known := []error{
+		errProtocolVersion, errInvalidEvent, errUnknownEvent, errOtherBoard,
+		errUnsupportedOperation, access.ErrForbidden, access.ErrNotFound,
+	}
+	for _, k := range known {
+		if errors.Is(err, k) {
+			return err.Error()
+		}
+	}
+
+	return "unable to store event"
+}
@@ -0,0 +1,247 @@
+package central
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"seisami/server/central/access"
+	"seisami/server/types"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func envelope(eventType, data string) types.Envelope {
+	return types.Envelope{V: types.RealtimeVersion, ID: uuid.NewString(), Type: eventType, Data: json.RawMessage(data)}
+}
+
+// stamped is env with the clock and fields of the sender's own copy of its op
+func stamped(env types.Envelope, hlc string, fields ...string) types.Envelope {
+	env.HLC, env.Fields = hlc, fields
+	return env
+}
+
+func TestDecodeEnvelope(t *testing.T) {
+	id := uuid.NewString()
+
+	tests := []struct {
+		name    string
+		message string
+		want    error
+	}{
+		{"envelope", `{"v":1,"id":"` + id + `","type":"card:data","data":{}}`, nil},
+		{"legacy_broadcast", `{"action":"broadcast","roomId":"room","type":"card:data","data":"{}"}`, errProtocolVersion},
+		{"newer_version", `{"v":2,"id":"` + id + `","type":"card:data","data":{}}`, errProtocolVersion},
+		{"missing_id", `{"v":1,"type":"card:data","data":{}}`, errInvalidEvent},
+		{"id_isnt_a_uuid", `{"v":1,"id":"1","type":"card:data","data":{}}`, errInvalidEvent},
+		{"missing_data", `{"v":1,"id":"` + id + `","type":"card:data"}`, errInvalidEvent},
+		{"not_json", `card:data`, errInvalidEvent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeEnvelope([]byte(tt.message))
+			if tt.want == nil && err != nil {
+				t.Errorf("expected the envelope to decode, got %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestEventOperation(t *testing.T) {
+	board := sharedBoard.String()
+	card := `{"column":{"id":"todo","board_id":"` + board + `"},"card":{"id":"card-1","name":"Ship it","column_id":"todo"}}`
+
+	tests := []struct {
+		name      string
+		env       types.Envelope
+		table     string
+		opType    string
+		recordID  string
+		wantError error
+	}{
+		{"board_renamed", envelope("board:data", `{"id":"`+board+`","name":"Roadmap"}`), "boards", "update", board, nil},
+		{"column_created", envelope("column:create", `{"id":"todo","board_id":"`+board+`","name":"Todo","position":0}`), "columns", "insert", "todo", nil},
+		{"column_renamed", envelope("column:data", `{"id":"todo","board_id":"`+board+`","name":"Doing","position":1}`), "columns", "update", "todo", nil},
+		{"column_deleted", envelope("column:delete", `{"id":"todo","board_id":"`+board+`"}`), "columns", "delete", "todo", nil},
+		{"card_created", envelope("card:create", card), "cards", "insert", "card-1", nil},
+		{"card_edited", envelope("card:data", card), "cards", "update", "card-1", nil},
+		{"card_deleted", envelope("card:delete", `{"column":{"id":"todo"},"card":{"id":"card-1"}}`), "cards", "delete", "card-1", nil},
+		{"card_renamed_with_its_clock", stamped(envelope("card:data", card), "1700000000000-0-device", "name"), "cards", "update", "card-1", nil},
+		{"card_moved", envelope("card:column", `{"card_id":"card-1","old_column":null,"new_column":{"id":"done"}}`), "cards", "update-card-column", "card-1", nil},
+
+		{"unknown_type", envelope("card:explode", card), "", "", "", errUnknownEvent},
+		{"board_without_name", envelope("board:data", `{"id":"`+board+`"}`), "", "", "", errInvalidEvent},
+		{"column_of_no_board", envelope("column:create", `{"id":"todo","name":"Todo"}`), "", "", "", errInvalidEvent},
+		{"negative_position", envelope("column:data", `{"id":"todo","board_id":"`+board+`","name":"Todo","position":-1}`), "", "", "", errInvalidEvent},
+		{"card_without_id", envelope("card:data", `{"column":{"id":"todo"},"card":{"name":"Ship it"}}`), "", "", "", errInvalidEvent},
+		{"card_in_two_columns", envelope("card:data", `{"column":{"id":"todo"},"card":{"id":"card-1","name":"Ship it","column_id":"done"}}`), "", "", "", errInvalidEvent},
+		{"move_nowhere", envelope("card:column", `{"card_id":"card-1","new_column":{}}`), "", "", "", errInvalidEvent},
+		{"wrong_shape", envelope("card:data", `"card-1"`), "", "", "", errInvalidEvent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, err := eventOperation(tt.env)
+			if tt.wantError != nil {
+				if !errors.Is(err, tt.wantError) {
+					t.Errorf("expected %v, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected an op, got %v", err)
+			}
+
+			if op.ID != tt.env.ID || op.TableName != tt.table || op.OperationType != tt.opType || op.RecordID != tt.recordID {
+				t.Errorf("expected %s %s of %s with the envelope's id, got %+v", tt.opType, tt.table, tt.recordID, op)
+			}
+
+			if op.HLC != tt.env.HLC || len(op.Fields) != len(tt.env.Fields) {
+				t.Errorf("expected the sender's clock & fields, got %q %v", op.HLC, op.Fields)
+			}
+
+			// the op carries what a push of the same change would, the handlers read it back the same way
+			if _, _, err := operationRecords(op); err != nil {
+				t.Errorf("expected the payload to decode, got %v", err)
+			}
+		})
+	}
+}
+
+// a room only hears about its own board, an event for any other is refused before anything is stored
+func TestEventsStayInTheirRoom(t *testing.T) {
+	s := newAuthorizedService()
+	ctx := context.Background()
+	theirs := outsiderBoard.String()
+
+	tests := []struct {
+		name string
+		user uuid.UUID
+		env  types.Envelope
+		want error
+	}{
+		{"renames_another_board", outsiderID, envelope("board:data", `{"id":"`+theirs+`","name":"Mine"}`), errOtherBoard},
+		{"adds_a_column_elsewhere", outsiderID, envelope("column:create", `{"id":"new","board_id":"`+theirs+`","name":"Mine","position":0}`), errOtherBoard},
+		{"edits_a_card_elsewhere", outsiderID, envelope("card:data", `{"column":{"id":"outsider-column"},"card":{"id":"outsider-card","name":"Mine"}}`), errOtherBoard},
+		{"deletes_a_card_elsewhere", outsiderID, envelope("card:delete", `{"column":{"id":"outsider-column"},"card":{"id":"outsider-card"}}`), errOtherBoard},
+		{"moves_a_card_out", memberID, envelope("card:column", `{"card_id":"shared-card","new_column":{"id":"outsider-column"}}`), access.ErrForbidden},
+		{"edits_a_missing_column", memberID, envelope("column:delete", `{"id":"missing","board_id":"`+sharedBoard.String()+`"}`), access.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ProcessEvent(ctx, tt.user, sharedBoard, tt.env)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// encryptedBoards answers which boards are encrypted from a set
+type encryptedBoards map[uuid.UUID]bool
+
+func (e encryptedBoards) IsBoardEncrypted(ctx context.Context, boardID pgtype.UUID) (bool, error) {
+	return e[uuid.UUID(boardID.Bytes)], nil
+}
+
+// an event on an encrypted board is passed on to the room but never stored, the service has no database to store it in
+func TestEncryptedBoardEvents(t *testing.T) {
+	s := newAuthorizedService()
+	s.keys = encryptedBoards{sharedBoard: true}
+	ctx := context.Background()
+	card := envelope("card:data", `{"column":{"id":"shared-column"},"card":{"id":"shared-card","name":"Secret plan"}}`)
+
+	event, err := s.ProcessEvent(ctx, memberID, sharedBoard, card)
+	if err != nil {
+		t.Fatalf("expected the event to be passed on, got %v", err)
+	}
+	if event.Seq != 0 || !strings.Contains(string(event.Data), "Secret plan") {
+		t.Errorf("expected the event for the room without a seq, got %+v", event)
+	}
+
+	if _, err := s.ProcessEvent(ctx, viewerID, sharedBoard, card); !errors.Is(err, access.ErrForbidden) {
+		t.Errorf("expected a viewer's event to be refused, got %v", err)
+	}
+}
+
+func TestEventError(t *testing.T) {
+	if msg := EventError(errors.New("pq: connection reset")); msg != "unable to store event" {
+		t.Errorf("expected server failures to stay private, got %q", msg)
+	}
+
+	if msg := EventError(errOtherBoard); msg != errOtherBoard.Error() {
+		t.Errorf("expected the sender to be told why, got %q", msg)
+	}
+}
+
+func TestProcessPresence(t *testing.T) {
+	s := newAuthorizedService()
+	ctx := context.Background()
+	editing := `{"focus":{"table":"cards","id":"shared-card"},"editing":{"table":"cards","id":"shared-card"}}`
+
+	event, err := s.ProcessPresence(ctx, memberID, sharedBoard, envelope(types.PresenceMessage, editing))
+	if err != nil || event.Editing == nil {
+		t.Errorf("expected a member to show as editing, got %+v (%v)", event, err)
+	}
+
+	// a viewer is still there, only not editing anything
+	event, err = s.ProcessPresence(ctx, viewerID, sharedBoard, envelope(types.PresenceMessage, editing))
+	if err != nil || event.Editing != nil || event.Focus == nil {
+		t.Errorf("expected a viewer's heartbeat without editing, got %+v (%v)", event, err)
+	}
+
+	if _, err := s.ProcessPresence(ctx, outsiderID, sharedBoard, envelope(types.PresenceMessage, editing)); !errors.Is(err, access.ErrForbidden) {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+
+	if _, err := s.ProcessPresence(ctx, memberID, sharedBoard, envelope(types.PresenceMessage, `{"focus":{"table":"boards","id":"x"}}`)); !errors.Is(err, errInvalidEvent) {
+		t.Errorf("expected errInvalidEvent, got %v", err)
+	}
+}
+
+func TestProcessComment(t *testing.T) {
+	s := newAuthorizedService()
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		user uuid.UUID
+		data string
+		want error
+	}{
+		{"commenter_comments", commenterID, `{"body":"Ship it"}`, nil},
+		{"commenter_comments_on_a_card", commenterID, `{"card_id":"shared-card","body":"Ship it"}`, nil},
+		{"member_comments", memberID, `{"body":"Ship it"}`, nil},
+		{"viewer_cant_comment", viewerID, `{"body":"Ship it"}`, access.ErrForbidden},
+		{"outsider_cant_comment", outsiderID, `{"body":"Ship it"}`, access.ErrForbidden},
+		{"comment_on_a_card_elsewhere", outsiderID, `{"card_id":"outsider-card","body":"Mine"}`, access.ErrForbidden},
+		{"comment_on_a_missing_card", commenterID, `{"card_id":"missing","body":"Ship it"}`, access.ErrNotFound},
+		{"empty_comment", commenterID, `{"body":""}`, errInvalidEvent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := s.ProcessComment(ctx, tt.user, sharedBoard, envelope(types.CommentMessage, tt.data))
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Errorf("expected %v, got %v", tt.want, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected the comment to be said, got %v", err)
+			}
+
+			if event.From != tt.user.String() || event.Seq != 0 || len(event.Data) == 0 {
+				t.Errorf("expected an unstored comment from %s, got %+v", tt.user, event)
+			}
+		})
+	}
+}
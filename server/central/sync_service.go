@@ -1,9 +1,9 @@
 package central
 
-// TODO: implement soft delete for sync operations instead
 // this service talks directly to the DB, which doesnt really make sense, there should be an intermediary, fix later
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -11,18 +11,24 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"seisami/server/central/access"
 	"seisami/server/centraldb"
+	"seisami/server/hlc"
 	"seisami/server/types"
 	"seisami/server/utils"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -31,11 +37,24 @@ type SyncService struct {
 	pool         *pgxpool.Pool
 	queries      *centraldb.Queries
 	openAIAPIKey string
+	access       *access.Authorizer
+	invites      inviteSigner
+	keys         boardKeys
+	mailer       Mailer
 }
 
-func NewSyncService(pool *pgxpool.Pool, queries *centraldb.Queries, openAIAPIKey string) *SyncService {
+func NewSyncService(pool *pgxpool.Pool, queries *centraldb.Queries, cfg Config) *SyncService {
 
-	return &SyncService{pool, queries, openAIAPIKey}
+	return &SyncService{pool, queries, cfg.OpenAIAPIKey, access.New(queries), newInviteSigner(cfg.JWTSecret, cfg.InviteExpiration), queries, newMailer(cfg)}
+}
+
+// withTx runs the service's queries and its access checks in tx, so a batch sees the boards it created itself
+func (s *SyncService) withTx(tx pgx.Tx) *SyncService {
+	txService := *s
+	txService.queries = s.queries.WithTx(tx)
+	txService.access = access.New(txService.queries)
+	txService.keys = txService.queries
+	return &txService
 }
 
 type SyncOperation struct {
@@ -47,6 +66,37 @@ type SyncOperation struct {
 	Payload       string `json:"payload"`
 	CreatedAt     string `json:"created_at"`
 	UpdatedAt     string `json:"updated_at"`
+	HLC           string `json:"hlc"`
+	// Fields the op changed, nil means the whole record
+	Fields []string `json:"fields"`
+	// Seq is where the op's record last changed in the op log, pulls page by it
+	Seq int64 `json:"seq,omitempty"`
+	// boards maps every board the pulled record's ops were in to the newest of their seqs
+	boards map[string]int64
+}
+
+// SyncBatchRequest pushes many ops in one round trip and pulls back a page of the server's ops after Cursor
+type SyncBatchRequest struct {
+	TableName  string          `json:"table_name" validate:"required"`
+	Since      int64           `json:"since"`
+	After      string          `json:"after"`
+	Cursor     string          `json:"cursor"`
+	Limit      int             `json:"limit"`
+	Summary    bool            `json:"summary"`
+	Operations []SyncOperation `json:"operations" validate:"dive"`
+}
+
+type SyncBatchResponse struct {
+	Applied int `json:"applied"`
+	// Rejected are the ops the server refused, the rest of the batch landed without them
+	Rejected []RejectedOperation `json:"rejected"`
+	PullPage
+}
+
+// RejectedOperation is an op of a batch that can't be applied, resending it won't change that
+type RejectedOperation struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
 }
 
 type SyncStatus struct {
@@ -69,24 +119,206 @@ var (
 	errUnsupportedOperation = errors.New("unsupported sync operation")
 )
 
-func (s *SyncService) ProcessOperation(ctx context.Context, userID string, op SyncOperation) error {
+// OperationResult is what storing an op came to, an op sent again gets the same result back
+type OperationResult struct {
+	ID  string `json:"operation_id"`
+	Seq int64  `json:"seq"`
+}
+
+// ProcessOperation applies an op and logs it in one transaction. a retried op id gets the original result back
+func (s *SyncService) ProcessOperation(ctx context.Context, userID string, op SyncOperation) (OperationResult, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return OperationResult{}, fmt.Errorf("unable to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := s.withTx(tx).applyOperation(ctx, userID, op)
+	if err != nil {
+		return result, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return result, fmt.Errorf("unable to commit operation: %v", err)
+	}
+
+	return result, nil
+}
+
+// applyOperation has to run inside a transaction, the locks it takes are held until that ends
+func (s *SyncService) applyOperation(ctx context.Context, userID string, op SyncOperation) (OperationResult, error) {
+	result := OperationResult{ID: op.ID}
+
 	userUUID, err := uuid.Parse(userID)
 	if err != nil {
-		return fmt.Errorf("invalid user id: %w", err)
+		return result, fmt.Errorf("invalid user id: %w", err)
+	}
+
+	if op.DeviceID == "" {
+		op.DeviceID = deviceIDFromContext(ctx)
+	}
+
+	// checked before the op log too, a resent op of someone else's board doesn't even learn it was stored
+	if err := s.authorizeOperation(ctx, userUUID, op); err != nil {
+		return result, err
+	}
+
+	// a retry racing the first attempt waits here and then finds the op stored
+	if err := s.queries.LockOperation(ctx, op.ID); err != nil {
+		return result, fmt.Errorf("unable to lock operation: %v", err)
+	}
+
+	seq, err := s.queries.GetOperationSeq(ctx, op.ID)
+	if err == nil {
+		result.Seq = seq
+		return result, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return result, fmt.Errorf("unable to look up operation: %v", err)
+	}
+
+	// clients that predate the clock send no hlc, the server stamps those so every stored op is ordered
+	if ts, err := hlc.Parse(op.HLC); err == nil {
+		hlc.Observe(ts)
+	} else {
+		op.HLC = hlc.Now().String()
 	}
 
 	switch strings.ToLower(op.TableName) {
 	case "boards":
-		return s.handleBoardOperation(ctx, userUUID, op)
+		err = s.handleBoardOperation(ctx, userUUID, op)
 	case "columns":
-		return s.handleColumnOperation(ctx, userUUID, op)
+		err = s.handleColumnOperation(ctx, userUUID, op)
 	case "cards":
-		return s.handleCardOperation(ctx, userUUID, op)
+		err = s.handleCardOperation(ctx, userUUID, op)
 	case "transcriptions":
-		return s.handleTranscriptionOperation(ctx, userUUID, op)
+		err = s.handleTranscriptionOperation(ctx, userUUID, op)
 	default:
-		return fmt.Errorf("%w: %s", errUnsupportedTable, op.TableName)
+		err = fmt.Errorf("%w: %s", errUnsupportedTable, op.TableName)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.Seq, err = s.queries.GetOperationSeq(ctx, op.ID)
+	if err != nil {
+		return result, fmt.Errorf("unable to look up stored operation: %v", err)
 	}
+
+	return result, nil
+}
+
+// ProcessBatch applies a batch in one transaction, an op the server can't apply is rolled back alone and listed in
+// Rejected. Limit caps how many ops after Cursor come back, 0 only pushes
+func (s *SyncService) ProcessBatch(ctx context.Context, userID string, req SyncBatchRequest) (SyncBatchResponse, error) {
+	resp := SyncBatchResponse{Rejected: []RejectedOperation{}, PullPage: PullPage{Operations: []SyncOperation{}, Cursor: req.Cursor}}
+
+	if len(req.Operations) > 0 {
+		tx, err := s.pool.Begin(ctx)
+		if err != nil {
+			return resp, fmt.Errorf("unable to begin transaction: %v", err)
+		}
+		defer tx.Rollback(ctx)
+
+		if err := s.withTx(tx).lockBatchBoards(ctx, req.Operations); err != nil {
+			return resp, err
+		}
+
+		for _, op := range req.Operations {
+			// a savepoint per op, rolling one back keeps what the others wrote
+			savepoint, err := tx.Begin(ctx)
+			if err != nil {
+				return resp, fmt.Errorf("unable to begin savepoint: %v", err)
+			}
+
+			_, opErr := s.withTx(savepoint).applyOperation(ctx, userID, op)
+			if opErr != nil && !rejectable(ctx, opErr) {
+				return resp, fmt.Errorf("operation %s: %w", op.ID, opErr)
+			}
+			if opErr != nil {
+				if err := savepoint.Rollback(ctx); err != nil {
+					return resp, fmt.Errorf("unable to roll back operation %s: %v", op.ID, err)
+				}
+				log.Printf("rejected operation %s: %v", op.ID, opErr)
+				resp.Rejected = append(resp.Rejected, RejectedOperation{ID: op.ID, Error: opErr.Error()})
+				continue
+			}
+
+			if err := savepoint.Commit(ctx); err != nil {
+				return resp, fmt.Errorf("unable to release savepoint: %v", err)
+			}
+			resp.Applied++
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return resp, fmt.Errorf("unable to commit batch: %v", err)
+		}
+	}
+
+	if req.Limit <= 0 {
+		return resp, nil
+	}
+
+	page, err := s.PullOperationsPage(ctx, userID, req.TableName, PullQuery{
+		Since:    req.Since,
+		After:    req.After,
+		Cursor:   req.Cursor,
+		Limit:    req.Limit,
+		Summary:  req.Summary,
+		DeviceID: deviceIDFromContext(ctx),
+	})
+	if err != nil {
+		return resp, err
+	}
+	resp.PullPage = page
+
+	return resp, nil
+}
+
+// lockBatchBoards takes the op log locks of the boards ops write to in order. boards the batch creates itself are
+// locked when their op is stored, nothing else writes to them yet
+func (s *SyncService) lockBatchBoards(ctx context.Context, ops []SyncOperation) error {
+	var boards []uuid.UUID
+	for _, op := range ops {
+		record, parent, err := operationRecords(op)
+		if err != nil {
+			// rejected once it's applied
+			continue
+		}
+
+		for _, r := range []*access.Record{&record, parent} {
+			if r == nil {
+				continue
+			}
+
+			boardID, err := s.access.BoardOf(ctx, *r)
+			if errors.Is(err, access.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			boards = append(boards, boardID)
+		}
+	}
+
+	slices.SortFunc(boards, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	for _, boardID := range slices.Compact(boards) {
+		if err := s.queries.LockBoardOperationLog(ctx, pgtype.UUID{Bytes: boardID, Valid: true}); err != nil {
+			return fmt.Errorf("unable to lock operation log: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// rejectable is whether op failing with err is the op's own fault. Lost access and a request that went away aren't
+func rejectable(ctx context.Context, err error) bool {
+	if errors.Is(err, access.ErrForbidden) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	return ctx.Err() == nil
 }
 
 func (s *SyncService) handleBoardOperation(ctx context.Context, userUUID uuid.UUID, op SyncOperation) error {
@@ -143,7 +375,7 @@ func (s *SyncService) handleBoardOperation(ctx context.Context, userUUID uuid.UU
 			return fmt.Errorf("unable to upsert board: %v", err)
 		}
 
-	case "delete":
+	case "delete", "restore":
 		boardID, err := uuid.Parse(op.RecordID)
 		if err != nil {
 			return fmt.Errorf("unable to parse data type into uuid: %v", err)
@@ -153,12 +385,12 @@ func (s *SyncService) handleBoardOperation(ctx context.Context, userUUID uuid.UU
 			Bytes: boardID,
 			Valid: true,
 		}
-		err = s.queries.SyncDeleteBoard(ctx, centraldb.SyncDeleteBoardParams{
-			ID: id,
-			UserID: pgtype.UUID{
-				Bytes: userUUID,
-				Valid: true,
-			},
+
+		err = s.applyTombstone(ctx, op, func() error {
+			if strings.EqualFold(op.OperationType, "restore") {
+				return s.queries.SyncRestoreBoard(ctx, id)
+			}
+			return s.queries.SyncDeleteBoard(ctx, id)
 		})
 
 		if err != nil {
@@ -169,28 +401,7 @@ func (s *SyncService) handleBoardOperation(ctx context.Context, userUUID uuid.UU
 		return fmt.Errorf("%w: %s on boards", errUnsupportedOperation, op.OperationType)
 	}
 
-	err := s.queries.CreateOperation(ctx, centraldb.CreateOperationParams{
-		ID:            op.ID,
-		TableName:     op.TableName,
-		RecordID:      op.RecordID,
-		OperationType: op.OperationType,
-		DeviceID: pgtype.Text{
-			String: op.DeviceID,
-			Valid:  true,
-		},
-		Payload: op.Payload,
-		CreatedAt: pgtype.Text{
-			String: op.CreatedAt,
-			Valid:  true,
-		},
-		UpdatedAt: pgtype.Text{
-			String: op.UpdatedAt,
-			Valid:  true,
-		},
-	})
-
-	return err
-
+	return s.recordOperation(ctx, userUUID, op)
 }
 
 func (s *SyncService) handleColumnOperation(ctx context.Context, userUUID uuid.UUID, op SyncOperation) error {
@@ -218,11 +429,6 @@ func (s *SyncService) handleColumnOperation(ctx context.Context, userUUID uuid.U
 			return fmt.Errorf("unable to parse board id into uuid: %v", err)
 		}
 
-		err = s.ensureBoardAccess(ctx, boardID, userUUID)
-		if err != nil {
-			return err
-		}
-
 		id := pgtype.UUID{
 			Bytes: boardID,
 			Valid: true,
@@ -246,13 +452,12 @@ func (s *SyncService) handleColumnOperation(ctx context.Context, userUUID uuid.U
 		if err != nil {
 			return err
 		}
-	case "delete":
-		err := s.queries.SyncDeleteColumn(ctx, centraldb.SyncDeleteColumnParams{
-			ID: op.RecordID,
-			UserID: pgtype.UUID{
-				Bytes: userUUID,
-				Valid: true,
-			},
+	case "delete", "restore":
+		err := s.applyTombstone(ctx, op, func() error {
+			if strings.EqualFold(op.OperationType, "restore") {
+				return s.queries.SyncRestoreColumn(ctx, op.RecordID)
+			}
+			return s.queries.SyncDeleteColumn(ctx, op.RecordID)
 		})
 
 		if err != nil {
@@ -263,26 +468,7 @@ func (s *SyncService) handleColumnOperation(ctx context.Context, userUUID uuid.U
 		return fmt.Errorf("%w: %s on columns", errUnsupportedOperation, op.OperationType)
 	}
 
-	err := s.queries.CreateOperation(ctx, centraldb.CreateOperationParams{
-		ID:            op.ID,
-		TableName:     op.TableName,
-		RecordID:      op.RecordID,
-		OperationType: op.OperationType,
-		DeviceID: pgtype.Text{
-			String: op.DeviceID,
-			Valid:  true,
-		},
-		Payload: op.Payload,
-		CreatedAt: pgtype.Text{
-			String: op.CreatedAt,
-			Valid:  true,
-		},
-		UpdatedAt: pgtype.Text{
-			String: op.UpdatedAt,
-			Valid:  true,
-		},
-	})
-	return err
+	return s.recordOperation(ctx, userUUID, op)
 }
 
 func (s *SyncService) handleCardOperation(ctx context.Context, userUUID uuid.UUID, op SyncOperation) error {
@@ -315,25 +501,10 @@ func (s *SyncService) handleCardOperation(ctx context.Context, userUUID uuid.UUI
 			return fmt.Errorf("card payload missing column id")
 		}
 
-		column, err := s.queries.GetColumnByID(ctx, payload.Column.ID)
-		if err != nil {
-			return fmt.Errorf("card with column id (%s) doesnt exist: %v", payload.Column.ID, err)
-		}
-
-		boardID, err := uuid.FromBytes(column.BoardID.Bytes[:])
-		if err != nil {
-			return fmt.Errorf("unable to parse board id into uuid: %v", err)
-		}
-
-		err = s.ensureBoardAccess(ctx, boardID, userUUID)
-		if err != nil {
-			return err
-		}
-
 		createdAt := selectTimestamp(payload.Card.CreatedAt, op.CreatedAt)
 		updatedAt := selectTimestamp(payload.Card.UpdatedAt, op.UpdatedAt)
 
-		err = s.queries.SyncUpsertCard(ctx, centraldb.SyncUpsertCardParams{
+		params := centraldb.SyncUpsertCardParams{
 			ID:       cardID,
 			ColumnID: columnID,
 			Title:    payload.Card.Name,
@@ -350,18 +521,64 @@ func (s *SyncService) handleCardOperation(ctx context.Context, userUUID uuid.UUI
 				Valid: true,
 			},
 			// TODO: fix when attachments is working
-		})
+		}
 
+		applied := cardFields
+
+		existing, err := s.queries.GetCardByID(ctx, cardID)
+		switch {
+		case err == nil:
+			clocks, err := s.fieldClocks(ctx, op.TableName, cardID)
+			if err != nil {
+				return err
+			}
+
+			// start from what is stored and only take the fields this op changed and is newest for
+			params.ColumnID = existing.ColumnID
+			params.Title = existing.Title
+			params.Description = existing.Description
+			params.Attachments = existing.Attachments
+			params.CreatedAt = existing.CreatedAt
+
+			applied = make([]string, 0, len(cardFields))
+			for _, field := range cardFields {
+				if !shouldApplyField(op, clocks, field) {
+					continue
+				}
+
+				switch field {
+				case "column_id":
+					params.ColumnID = columnID
+				case "title":
+					params.Title = payload.Card.Name
+				case "description":
+					params.Description = pgtype.Text{String: payload.Card.Description, Valid: true}
+				default:
+					// attachments never travel in card events
+					continue
+				}
+				applied = append(applied, field)
+			}
+		case errors.Is(err, pgx.ErrNoRows):
+		default:
+			return fmt.Errorf("unable to get card: %v", err)
+		}
+
+		err = s.queries.SyncUpsertCard(ctx, params)
 		if err != nil {
 			return err
 		}
-	case "delete":
-		err := s.queries.SyncDeleteCard(ctx, centraldb.SyncDeleteCardParams{
-			ID: op.RecordID,
-			UserID: pgtype.UUID{
-				Bytes: userUUID,
-				Valid: true,
-			},
+
+		err = s.recordFieldClocks(ctx, op, cardID, applied)
+		if err != nil {
+			return err
+		}
+	case "delete", "restore":
+		err := s.applyTombstone(ctx, op, func() error {
+			if strings.EqualFold(op.OperationType, "restore") {
+				return s.queries.SyncRestoreCard(ctx, op.RecordID)
+			}
+			return s.queries.SyncDeleteCard(ctx, op.RecordID)
 		})
 
 		if err != nil {
@@ -385,65 +602,39 @@ func (s *SyncService) handleCardOperation(ctx context.Context, userUUID uuid.UUI
 			return fmt.Errorf("card column payload missing identifiers")
 		}
 
-		// if err := s.ensureColumnOwnership(ctx, payload.NewColumn.ID, userUUID); err != nil {
-		// 	return err
-		// }
-
-		column, err := s.queries.GetColumnByID(ctx, payload.NewColumn.ID)
-		if err != nil {
-			return fmt.Errorf("card with column id (%s) doesnt exist: %v", payload.NewColumn.ID, err)
-		}
-
-		boardID, err := uuid.FromBytes(column.BoardID.Bytes[:])
-		if err != nil {
-			return fmt.Errorf("unable to parse board id into uuid: %v", err)
-		}
-
-		err = s.ensureBoardAccess(ctx, boardID, userUUID)
+		clocks, err := s.fieldClocks(ctx, op.TableName, payload.CardID)
 		if err != nil {
 			return err
 		}
 
-		updatedAt := selectTimestamp(op.UpdatedAt, op.CreatedAt)
-
-		err = s.queries.SyncUpdateCardColumn(ctx, centraldb.SyncUpdateCardColumnParams{
-			ColumnID: payload.NewColumn.ID,
-			UpdatedAt: pgtype.Timestamptz{
-				Time:  updatedAt,
-				Valid: true,
-			},
-			ID:     payload.CardID,
-			UserID: pgtype.UUID{Bytes: userUUID, Valid: true},
-		})
+		// a newer move already landed, keep the op in the log but leave the card where it is
+		if op.HLC == "" || clocks["column_id"] < op.HLC {
+			updatedAt := selectTimestamp(op.UpdatedAt, op.CreatedAt)
+
+			err = s.queries.SyncUpdateCardColumn(ctx, centraldb.SyncUpdateCardColumnParams{
+				ColumnID: payload.NewColumn.ID,
+				UpdatedAt: pgtype.Timestamptz{
+					Time:  updatedAt,
+					Valid: true,
+				},
+				ID: payload.CardID,
+			})
+
+			if err != nil {
+				return err
+			}
 
-		if err != nil {
-			return err
+			err = s.recordFieldClocks(ctx, op, payload.CardID, []string{"column_id"})
+			if err != nil {
+				return err
+			}
 		}
 
 	default:
 		return fmt.Errorf("%w: %s on cards", errUnsupportedOperation, op.OperationType)
 	}
 
-	err := s.queries.CreateOperation(ctx, centraldb.CreateOperationParams{
-		ID:            op.ID,
-		TableName:     op.TableName,
-		RecordID:      op.RecordID,
-		OperationType: op.OperationType,
-		DeviceID: pgtype.Text{
-			String: op.DeviceID,
-			Valid:  true,
-		},
-		Payload: op.Payload,
-		CreatedAt: pgtype.Text{
-			String: op.CreatedAt,
-			Valid:  true,
-		},
-		UpdatedAt: pgtype.Text{
-			String: op.UpdatedAt,
-			Valid:  true,
-		},
-	})
-	return err
+	return s.recordOperation(ctx, userUUID, op)
 }
 
 func (s *SyncService) handleTranscriptionOperation(ctx context.Context, userUUID uuid.UUID, op SyncOperation) error {
@@ -463,7 +654,7 @@ func (s *SyncService) handleTranscriptionOperation(ctx context.Context, userUUID
 			return fmt.Errorf("transcription payload missing identifiers")
 		}
 
-		boardID, err := uuid.Parse(payload.ID)
+		boardID, err := uuid.Parse(payload.BoardID)
 		if err != nil {
 			return fmt.Errorf("unable to convert string to uuid: %v", err)
 		}
@@ -504,24 +695,38 @@ func (s *SyncService) handleTranscriptionOperation(ctx context.Context, userUUID
 			return err
 		}
 
-	case "delete":
-		err := s.queries.SyncDeleteTranscription(ctx, centraldb.SyncDeleteTranscriptionParams{
-			ID: op.RecordID,
-			UserID: pgtype.UUID{
-				Bytes: userUUID,
-				Valid: true,
-			},
+	case "delete", "restore":
+		err := s.applyTombstone(ctx, op, func() error {
+			if strings.EqualFold(op.OperationType, "restore") {
+				return s.queries.SyncRestoreTranscription(ctx, op.RecordID)
+			}
+			return s.queries.SyncDeleteTranscription(ctx, op.RecordID)
 		})
 		if err != nil {
 			return err
 		}
-
-		return err
 	default:
 		return fmt.Errorf("%w: %s on transcriptions", errUnsupportedOperation, op.OperationType)
 	}
 
-	err := s.queries.CreateOperation(ctx, centraldb.CreateOperationParams{
+	return s.recordOperation(ctx, userUUID, op)
+}
+
+// recordOperation adds an applied op to the op log, the lock on its board's ops is held until the transaction ends
+func (s *SyncService) recordOperation(ctx context.Context, userUUID uuid.UUID, op SyncOperation) error {
+	boardID, err := s.queries.GetRecordBoard(ctx, centraldb.GetRecordBoardParams{
+		TableName: op.TableName,
+		RecordID:  op.RecordID,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("unable to look up operation board: %v", err)
+	}
+
+	if err := s.queries.LockBoardOperationLog(ctx, boardID); err != nil {
+		return fmt.Errorf("unable to lock operation log: %v", err)
+	}
+
+	return s.queries.CreateOperation(ctx, centraldb.CreateOperationParams{
 		ID:            op.ID,
 		TableName:     op.TableName,
 		RecordID:      op.RecordID,
@@ -539,91 +744,96 @@ func (s *SyncService) handleTranscriptionOperation(ctx context.Context, userUUID
 			String: op.UpdatedAt,
 			Valid:  true,
 		},
+		Hlc:    op.HLC,
+		Fields: encodeFields(op.Fields),
+		UserID: pgtype.UUID{
+			Bytes: userUUID,
+			Valid: true,
+		},
 	})
-
-	return err
 }
 
-func (s *SyncService) PullOperations(ctx context.Context, userID, tableName string, since int64) ([]SyncOperation, error) {
+// PullOperationsPage returns a page of the latest op of every record changed after the client's position, leaving
+// out the device's own ops. clients without a position narrow the pull by since
+func (s *SyncService) PullOperationsPage(ctx context.Context, userID, tableName string, q PullQuery) (PullPage, error) {
 	userUUID, err := uuid.Parse(userID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user id: %w", err)
+		return PullPage{}, fmt.Errorf("invalid user id: %w", err)
+	}
+
+	after, err := decodePosition(q.After)
+	if err != nil {
+		return PullPage{}, err
 	}
 
-	validTables := map[string]bool{
-		"boards": true, "columns": true, "cards": true, "transcriptions": true,
+	reached, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return PullPage{}, err
 	}
-	if !validTables[strings.ToLower(tableName)] {
-		return nil, fmt.Errorf("invalid table name: %s", tableName)
+	reached.advance(after)
+
+	// a position already says where the client is, the timestamp is only there for clients that don't have one
+	since := q.Since
+	if q.After != "" {
+		since = 0
 	}
 
 	switch strings.ToLower(tableName) {
-	case "boards":
-		s.pullBoardOperations(ctx, userUUID, since)
-	case "columns":
-		return s.pullColumnOperations(ctx, userUUID, since)
-	case "cards":
-		return s.pullCardOperations(ctx, userUUID, since)
+	case "boards", "columns", "cards":
+		operations, err := s.pullTableOperations(ctx, userUUID, strings.ToLower(tableName), q, after, reached, since)
+		if err != nil {
+			return PullPage{}, err
+		}
+		return pageOperations(operations, q, reached), nil
 	case "transcriptions":
-
+		return pageOperations(nil, q, reached), nil
 	default:
-		return nil, fmt.Errorf("unsupported table: %s", tableName)
+		return PullPage{}, fmt.Errorf("invalid table name: %s", tableName)
 	}
-
-	return []SyncOperation{}, nil
 }
 
-func (s *SyncService) pullBoardOperations(ctx context.Context, userUUID uuid.UUID, since int64) ([]SyncOperation, error) {
-	userOperations, err := s.queries.GetAllOperationsSinceClient(ctx, centraldb.GetAllOperationsSinceClientParams{
-		TableName:   "boards",
-		UserID:      pgtype.UUID{Bytes: userUUID, Valid: true},
-		ToTimestamp: float64(since),
+// pullTableOperations lists one more record than q.Limit after reached, their fields are collected from the client's
+// position on so a record that changed again mid pull still carries what changed before
+func (s *SyncService) pullTableOperations(ctx context.Context, userUUID uuid.UUID, tableName string, q PullQuery, after, reached position, since int64) ([]SyncOperation, error) {
+	// a limit too big for the database is no limit
+	var limit int32
+	if q.Limit > 0 && q.Limit < math.MaxInt32 {
+		limit = int32(q.Limit) + 1
+	}
+
+	boards, seqs := reached.arrays()
+	userOperations, err := s.queries.ListOperationsAfterPosition(ctx, centraldb.ListOperationsAfterPositionParams{
+		PositionBoards: boards,
+		PositionSeqs:   seqs,
+		Since:          since,
+		TableName:      tableName,
+		DeviceID:       pgtype.Text{String: q.DeviceID, Valid: true},
+		UserID:         pgtype.UUID{Bytes: userUUID, Valid: true},
+		RecordIds:      q.RecordIDs,
+		RowLimit:       limit,
 	})
-
 	if err != nil {
-		fmt.Println("Board error: ", err)
-		return nil, fmt.Errorf("unable to get board operations: %v", err)
+		return nil, fmt.Errorf("unable to get %s operations: %v", tableName, err)
 	}
 
-	var operations []SyncOperation
-
+	recordIDs := make([]string, 0, len(userOperations))
 	for _, userOp := range userOperations {
-		var op = SyncOperation{
-			ID:            userOp.ID,
-			TableName:     userOp.TableName,
-			RecordID:      userOp.RecordID,
-			OperationType: userOp.OperationType,
-			DeviceID:      userOp.DeviceID.String,
-			Payload:       userOp.Payload,
-			CreatedAt:     userOp.CreatedAt.String,
-			UpdatedAt:     userOp.UpdatedAt.String,
-		}
-
-		operations = append(operations, op)
+		recordIDs = append(recordIDs, userOp.RecordID)
 	}
 
-	// b, _ := json.MarshalIndent(operations, "", " ")
-	// fmt.Println(string(b))
-
-	return operations, nil
-}
-
-func (s *SyncService) pullColumnOperations(ctx context.Context, userUUID uuid.UUID, since int64) ([]SyncOperation, error) {
-
-	userOperations, err := s.queries.GetAllOperationsSinceClient(ctx, centraldb.GetAllOperationsSinceClientParams{
-		TableName:   "columns",
-		UserID:      pgtype.UUID{Bytes: userUUID, Valid: true},
-		ToTimestamp: float64(since),
-	})
-
+	fields, err := s.pendingFields(ctx, userUUID, tableName, recordIDs, after, since, q.DeviceID)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get all operations: %v", err)
+		return nil, err
 	}
 
-	var operations []SyncOperation
-
+	operations := make([]SyncOperation, 0, len(userOperations))
 	for _, userOp := range userOperations {
-		var op = SyncOperation{
+		boardSeqs := make(map[string]int64, len(userOp.BoardIds))
+		for i, boardID := range userOp.BoardIds {
+			boardSeqs[uuid.UUID(boardID.Bytes).String()] = userOp.BoardSeqs[i]
+		}
+
+		operations = append(operations, SyncOperation{
 			ID:            userOp.ID,
 			TableName:     userOp.TableName,
 			RecordID:      userOp.RecordID,
@@ -632,43 +842,47 @@ func (s *SyncService) pullColumnOperations(ctx context.Context, userUUID uuid.UU
 			Payload:       userOp.Payload,
 			CreatedAt:     userOp.CreatedAt.String,
 			UpdatedAt:     userOp.UpdatedAt.String,
-		}
-
-		operations = append(operations, op)
+			HLC:           userOp.Hlc,
+			Fields:        fields[userOp.RecordID],
+			Seq:           userOp.MaxSeq,
+			boards:        boardSeqs,
+		})
 	}
 
 	return operations, nil
 }
 
-func (s *SyncService) pullCardOperations(ctx context.Context, userUUID uuid.UUID, since int64) ([]SyncOperation, error) {
-	userOperations, err := s.queries.GetAllOperationsSinceClient(ctx, centraldb.GetAllOperationsSinceClientParams{
-		TableName:   "cards",
-		UserID:      pgtype.UUID{Bytes: userUUID, Valid: true},
-		ToTimestamp: float64(since),
-	})
-
+// PurgeTombstones hard deletes every record soft deleted before the cutoff, children first in one transaction, and
+// returns how many rows were removed
+func (s *SyncService) PurgeTombstones(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get all operations: %v", err)
+		return 0, fmt.Errorf("unable to begin transaction: %v", err)
 	}
+	defer tx.Rollback(ctx)
 
-	var operations []SyncOperation
+	queries := s.queries.WithTx(tx)
+	cutoff := pgtype.Timestamptz{Time: before, Valid: true}
 
-	for _, userOp := range userOperations {
-		var op = SyncOperation{
-			ID:            userOp.ID,
-			TableName:     userOp.TableName,
-			RecordID:      userOp.RecordID,
-			OperationType: userOp.OperationType,
-			DeviceID:      userOp.DeviceID.String,
-			Payload:       userOp.Payload,
-			CreatedAt:     userOp.CreatedAt.String,
-			UpdatedAt:     userOp.UpdatedAt.String,
+	var purged int64
+	for _, purge := range []func(context.Context, pgtype.Timestamptz) (int64, error){
+		queries.PurgeCards,
+		queries.PurgeTranscriptions,
+		queries.PurgeColumns,
+		queries.PurgeBoards,
+	} {
+		n, err := purge(ctx, cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("unable to purge tombstones: %v", err)
 		}
+		purged += n
+	}
 
-		operations = append(operations, op)
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("unable to commit purge: %v", err)
 	}
 
-	return operations, nil
+	return purged, nil
 }
 
 func (s *SyncService) initCloud(ctx context.Context, userUUID uuid.UUID) error {
@@ -711,6 +925,10 @@ func (s *SyncService) upsertBoard(ctx context.Context, userUUID uuid.UUID, board
 		return fmt.Errorf("unable to parse data type into uuid: %v", err)
 	}
 
+	if err := s.access.Write(ctx, userUUID, access.Record{Table: "boards", ID: board.ID}, nil, access.Write); err != nil {
+		return err
+	}
+
 	id := pgtype.UUID{
 		Bytes: boardID,
 		Valid: true,
@@ -753,8 +971,7 @@ func (s *SyncService) upsertColumn(ctx context.Context, userUUID uuid.UUID, colu
 		return fmt.Errorf("unable to parse board id into uuid: %v", err)
 	}
 
-	// TODO: errors should be returned as a value so it can return different error codes
-	if err := s.ensureBoardAccess(ctx, boardID, userUUID); err != nil {
+	if err := s.access.Write(ctx, userUUID, access.Record{Table: "columns", ID: column.ID}, &access.Record{Table: "boards", ID: column.BoardID}, access.Write); err != nil {
 		return err
 	}
 
@@ -795,17 +1012,7 @@ func (s *SyncService) upsertCard(ctx context.Context, userUUID uuid.UUID, card c
 		return fmt.Errorf("unable to parse card updated_at value %q", card.UpdatedAt)
 	}
 
-	column, err := s.queries.GetColumnByID(ctx, card.ColumnID)
-	if err != nil {
-		return fmt.Errorf("card with column id (%s) doesnt exist: %v", card.ColumnID, err)
-	}
-
-	boardID, err := uuid.FromBytes(column.BoardID.Bytes[:])
-	if err != nil {
-		return fmt.Errorf("unable to parse board id into uuid: %v", err)
-	}
-
-	if err := s.ensureBoardAccess(ctx, boardID, userUUID); err != nil {
+	if err := s.access.Write(ctx, userUUID, access.Record{Table: "cards", ID: card.ID}, &access.Record{Table: "columns", ID: card.ColumnID}, access.Write); err != nil {
 		return err
 	}
 
@@ -855,7 +1062,7 @@ func (s *SyncService) upsertTranscription(ctx context.Context, userUUID uuid.UUI
 		return fmt.Errorf("unable to parse board id into uuid: %w", err)
 	}
 
-	if err := s.ensureBoardAccess(ctx, boardID, userUUID); err != nil {
+	if err := s.access.Write(ctx, userUUID, access.Record{Table: "transcriptions", ID: transcription.ID}, &access.Record{Table: "boards", ID: transcription.BoardID}, access.Write); err != nil {
 		return err
 	}
 
@@ -899,17 +1106,21 @@ func (s *SyncService) upsertTranscription(ctx context.Context, userUUID uuid.UUI
 	return nil
 }
 
-func (s *SyncService) initializeSyncState(ctx context.Context, userUUID uuid.UUID) error {
-	return s.queries.InitializeSyncStateForUser(ctx, pgtype.UUID{Bytes: userUUID, Valid: true})
+func (s *SyncService) initializeSyncState(ctx context.Context, userUUID uuid.UUID, deviceID string) error {
+	return s.queries.InitializeSyncStateForUser(ctx, centraldb.InitializeSyncStateForUserParams{
+		UserID:   pgtype.UUID{Bytes: userUUID, Valid: true},
+		DeviceID: deviceID,
+	})
 }
 
-func (s *SyncService) getSyncState(ctx context.Context, userUUID uuid.UUID, tableName string) (types.SyncStatePayload, error) {
+func (s *SyncService) getSyncState(ctx context.Context, userUUID uuid.UUID, deviceID, tableName string) (types.SyncStatePayload, error) {
 	syncState, err := s.queries.GetSyncState(ctx, centraldb.GetSyncStateParams{
 		TableName: tableName,
 		UserID: pgtype.UUID{
 			Bytes: userUUID,
 			Valid: true,
 		},
+		DeviceID: deviceID,
 	})
 
 	if err != nil {
@@ -927,24 +1138,7 @@ func (s *SyncService) getSyncState(ctx context.Context, userUUID uuid.UUID, tabl
 	return resp, nil
 }
 
-// TODO: errors should be returned as a value so it can return different error codes
-func (s *SyncService) ensureBoardAccess(ctx context.Context, boardID, userID uuid.UUID) error {
-	hasAccess, err := s.queries.ValidateBoardAccess(ctx, centraldb.ValidateBoardAccessParams{
-		BoardID: pgtype.UUID{Bytes: boardID, Valid: true},
-		UserID:  pgtype.UUID{Bytes: userID, Valid: true},
-	})
-	if err != nil {
-		return fmt.Errorf("error validating board access: %v", err)
-	}
-
-	if !hasAccess {
-		return fmt.Errorf("user %s does not have access to board %s", userID, boardID)
-	}
-
-	return nil
-}
-
-func (s *SyncService) updateSyncState(ctx context.Context, userUUID uuid.UUID, payload types.SyncStatePayload) error {
+func (s *SyncService) updateSyncState(ctx context.Context, userUUID uuid.UUID, deviceID string, payload types.SyncStatePayload) error {
 	err := s.queries.UpdateSyncState(ctx, centraldb.UpdateSyncStateParams{
 		UserID: pgtype.UUID{
 			Bytes: userUUID,
@@ -956,6 +1150,7 @@ func (s *SyncService) updateSyncState(ctx context.Context, userUUID uuid.UUID, p
 			Valid:  true,
 		},
 		TableName: payload.TableName,
+		DeviceID:  deviceID,
 	})
 	if err != nil {
 		return fmt.Errorf("error occured updating sync state: %v", err)
@@ -965,62 +1160,27 @@ func (s *SyncService) updateSyncState(ctx context.Context, userUUID uuid.UUID, p
 }
 
 // These functions are not to be in sync service
-func (s *SyncService) inviteUserToBoard(ctx context.Context, userID uuid.UUID, payload boardMemberActionPayload) (centraldb.User, error) {
+func (s *SyncService) removeUserFromBoard(ctx context.Context, userUUID uuid.UUID, payload boardMemberActionPayload) error {
 	boardID, err := uuid.Parse(payload.BoardID)
 	if err != nil {
-		return centraldb.User{}, fmt.Errorf("unable to parse board id to uuid: %v", err)
-	}
-	err = s.ensureBoardOwner(ctx, boardID, userID)
-	if err != nil {
-		return centraldb.User{}, err
-	}
-
-	user, err := s.queries.GetUserByEmail(ctx, payload.Email)
-	if err != nil {
-		return centraldb.User{}, fmt.Errorf("unable to get user by email %v: %v", payload.Email, err.Error())
-	}
-
-	id := pgtype.UUID{
-		Bytes: boardID,
-		Valid: true,
+		return fmt.Errorf("unable to parse board id to uuid: %v", err)
 	}
 
-	_, err = s.queries.GetBoardByID(ctx, id)
-	if err != nil {
-		return centraldb.User{}, fmt.Errorf("unable to get board with id %s: %v", payload.BoardID, err)
+	if err := s.access.Board(ctx, userUUID, boardID, access.Manage); err != nil {
+		return err
 	}
 
-	err = s.queries.InsertBoardMember(ctx, centraldb.InsertBoardMemberParams{
-		Role: pgtype.Text{
-			String: types.BoardMemberRole.String(),
-			Valid:  true,
-		},
-		UserID: user.ID,
-		BoardID: pgtype.UUID{
-			Bytes: boardID,
-			Valid: true,
-		},
-	})
-
+	userToRemoveID, err := uuid.Parse(payload.UserID)
 	if err != nil {
-		return centraldb.User{}, fmt.Errorf("unable to invite member to board: %v", err)
+		return err
 	}
 
-	return user, nil
-}
-
-func (s *SyncService) removeUserFromBoard(ctx context.Context, userUUID uuid.UUID, payload boardMemberActionPayload) error {
-	boardID, err := uuid.Parse(payload.BoardID)
+	role, err := s.memberRole(ctx, userToRemoveID, boardID)
 	if err != nil {
-		return fmt.Errorf("unable to parse board id to uuid: %v", err)
-	}
-
-	if err := s.ensureBoardOwner(ctx, boardID, userUUID); err != nil {
 		return err
 	}
 
-	userToRemoveID, err := uuid.Parse(payload.UserID)
-	if err != nil {
+	if err := s.access.ManageMember(ctx, userUUID, boardID, role); err != nil {
 		return err
 	}
 
@@ -1044,11 +1204,11 @@ func (s *SyncService) removeUserFromBoard(ctx context.Context, userUUID uuid.UUI
 		return fmt.Errorf("unable to remove user from board: %v", err)
 	}
 
-	return nil
+	return s.recordLostBoard(ctx, userToRemoveID, boardID)
 }
 
 func (s *SyncService) getBoardMembers(ctx context.Context, boardID, userId uuid.UUID) ([]types.BoardMember, error) {
-	if err := s.ensureBoardAccess(ctx, boardID, userId); err != nil {
+	if err := s.access.Board(ctx, userId, boardID, access.Read); err != nil {
 		return nil, err
 	}
 
@@ -1078,7 +1238,7 @@ func (s *SyncService) getBoardMembers(ctx context.Context, boardID, userId uuid.
 }
 
 func (s *SyncService) getBoardMetadata(ctx context.Context, boardID, userID uuid.UUID) (*types.BoardMetadata, error) {
-	if err := s.ensureBoardAccess(ctx, boardID, userID); err != nil {
+	if err := s.access.Board(ctx, userID, boardID, access.Read); err != nil {
 		return nil, err
 	}
 
@@ -1098,24 +1258,9 @@ func (s *SyncService) getBoardMetadata(ctx context.Context, boardID, userID uuid
 	}, nil
 }
 
-func (s *SyncService) ensureBoardOwner(ctx context.Context, boardID, userID uuid.UUID) error {
-	isOwner, err := s.queries.EnsureBoardOwner(ctx, centraldb.EnsureBoardOwnerParams{
-		BoardID: pgtype.UUID{Bytes: boardID, Valid: true},
-		UserID:  pgtype.UUID{Bytes: userID, Valid: true},
-	})
-
-	if err != nil {
-		return fmt.Errorf("error checking board ownership: %v", err)
-	}
-
-	if !isOwner {
-		return fmt.Errorf("user %s is not the owner of board %s", userID, boardID)
-	}
-
-	return nil
-}
-
-func (s *SyncService) ExportBoardData(ctx context.Context, userID uuid.UUID, boardID string) (*types.ExportedData, error) {
+// ExportBoardData returns a board with its columns, cards and transcriptions. with since > 0 only what changed after
+// that version comes back with what was removed, unless the board never reached it
+func (s *SyncService) ExportBoardData(ctx context.Context, userID uuid.UUID, boardID string, since int64) (*types.ExportedData, error) {
 	fmt.Println("exportig cloud board")
 
 	boardUUID, err := uuid.Parse(boardID)
@@ -1123,6 +1268,10 @@ func (s *SyncService) ExportBoardData(ctx context.Context, userID uuid.UUID, boa
 		return nil, fmt.Errorf("unable to parse data type into uuid: %v", err)
 	}
 
+	if err := s.access.Board(ctx, userID, boardUUID, access.Read); err != nil {
+		return nil, err
+	}
+
 	boardId := pgtype.UUID{
 		Bytes: boardUUID,
 		Valid: true,
@@ -1133,6 +1282,29 @@ func (s *SyncService) ExportBoardData(ctx context.Context, userID uuid.UUID, boa
 		return nil, fmt.Errorf("unable to fetch board with id (%s): %v", boardID, err)
 	}
 
+	// read before the records, a change landing in between is sent again next time instead of being skipped
+	version, err := s.queries.GetBoardVersion(ctx, boardId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch board version with id (%s): %v", boardID, err)
+	}
+
+	exportedBoard := types.ExportedBoard{
+		ID:        board.ID.String(),
+		Name:      board.Name,
+		CreatedAt: utils.ConvertTimestamptzToLocal(board.CreatedAt),
+		UpdatedAt: utils.ConvertTimestamptzToLocal(board.UpdatedAt),
+	}
+
+	if since > 0 && since <= version {
+		data, err := s.exportBoardChanges(ctx, boardId, since)
+		if err != nil {
+			return nil, err
+		}
+		data.Board = exportedBoard
+		data.Version = version
+		return data, nil
+	}
+
 	columns, err := s.queries.GetBoardColumns(ctx, boardId)
 
 	fmt.Println("fetched columns: ", len(columns))
@@ -1141,6 +1313,83 @@ func (s *SyncService) ExportBoardData(ctx context.Context, userID uuid.UUID, boa
 		return nil, fmt.Errorf("unable to fetch board columns with id (%s): %v", boardID, err)
 	}
 
+	cards, err := s.queries.ListBoardsCards(ctx, centraldb.ListBoardsCardsParams{
+		UserID:  board.UserID,
+		BoardID: boardId,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch board cards with id %s boards: %v", boardID, err)
+	}
+
+	transcriptions, err := s.queries.ListBoardTranscriptions(ctx, centraldb.ListBoardTranscriptionsParams{
+		BoardID: boardId,
+		Limit:   1000,
+		Offset:  0,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error exporting transcriptions: %v", err)
+	}
+
+	return &types.ExportedData{
+		Board:          exportedBoard,
+		Columns:        exportColumns(columns),
+		Cards:          exportCards(cards),
+		Transcriptions: exportTranscriptions(boardId, transcriptions),
+		Version:        version,
+	}, nil
+}
+
+// exportBoardChanges is what was written to a board after version since
+func (s *SyncService) exportBoardChanges(ctx context.Context, boardId pgtype.UUID, since int64) (*types.ExportedData, error) {
+	columns, err := s.queries.ListBoardColumnsChangedSince(ctx, centraldb.ListBoardColumnsChangedSinceParams{
+		BoardID: boardId,
+		Version: since,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch changed columns: %v", err)
+	}
+
+	cards, err := s.queries.ListBoardCardsChangedSince(ctx, centraldb.ListBoardCardsChangedSinceParams{
+		BoardID: boardId,
+		Version: since,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch changed cards: %v", err)
+	}
+
+	transcriptions, err := s.queries.ListBoardTranscriptionsChangedSince(ctx, centraldb.ListBoardTranscriptionsChangedSinceParams{
+		BoardID: boardId,
+		Version: since,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch changed transcriptions: %v", err)
+	}
+
+	removals, err := s.queries.ListBoardRemovalsSince(ctx, centraldb.ListBoardRemovalsSinceParams{
+		BoardID: boardId,
+		Version: since,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch removed records: %v", err)
+	}
+
+	removed := make([]types.RemovedRecord, len(removals))
+	for i, r := range removals {
+		removed[i] = types.RemovedRecord{TableName: r.TableName, ID: r.RecordID}
+	}
+
+	return &types.ExportedData{
+		Columns:        exportColumns(columns),
+		Cards:          exportCards(cards),
+		Transcriptions: exportTranscriptions(boardId, transcriptions),
+		Since:          since,
+		Removed:        removed,
+	}, nil
+}
+
+func exportColumns(columns []centraldb.Column) []types.ExportedColumn {
 	exportedColumns := make([]types.ExportedColumn, len(columns))
 	for i, c := range columns {
 		exportedColumns[i] = types.ExportedColumn{
@@ -1153,15 +1402,10 @@ func (s *SyncService) ExportBoardData(ctx context.Context, userID uuid.UUID, boa
 		}
 	}
 
-	cards, err := s.queries.ListBoardsCards(ctx, centraldb.ListBoardsCardsParams{
-		UserID:  board.UserID,
-		BoardID: boardId,
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("unable to fetch board cards with id %s boards: %v", boardID, err)
-	}
+	return exportedColumns
+}
 
+func exportCards(cards []centraldb.Card) []types.ExportedCard {
 	exportedCards := make([]types.ExportedCard, len(cards))
 	for i, card := range cards {
 		exportedCards[i] = types.ExportedCard{
@@ -1175,19 +1419,10 @@ func (s *SyncService) ExportBoardData(ctx context.Context, userID uuid.UUID, boa
 		}
 	}
 
-	transcriptions, err := s.queries.ListBoardTranscriptions(ctx, centraldb.ListBoardTranscriptionsParams{
-		Limit:  1000,
-		Offset: 0,
-		ID:     boardId,
-		UserID: pgtype.UUID{
-			Bytes: userID,
-			Valid: true,
-		}})
-
-	if err != nil {
-		return nil, fmt.Errorf("error exporting transcriptions: %v", err)
-	}
+	return exportedCards
+}
 
+func exportTranscriptions(boardId pgtype.UUID, transcriptions []centraldb.Transcription) []types.ExportedTranscription {
 	exportedTranscriptions := make([]types.ExportedTranscription, len(transcriptions))
 	for i, t := range transcriptions {
 		exportedTranscriptions[i] = types.ExportedTranscription{
@@ -1202,19 +1437,7 @@ func (s *SyncService) ExportBoardData(ctx context.Context, userID uuid.UUID, boa
 		}
 	}
 
-	exportedBoard := types.ExportedBoard{
-		ID:        board.ID.String(),
-		Name:      board.Name,
-		CreatedAt: utils.ConvertTimestamptzToLocal(board.CreatedAt),
-		UpdatedAt: utils.ConvertTimestamptzToLocal(board.UpdatedAt),
-	}
-
-	return &types.ExportedData{
-		Board:          exportedBoard,
-		Columns:        exportedColumns,
-		Cards:          exportedCards,
-		Transcriptions: exportedTranscriptions,
-	}, nil
+	return exportedTranscriptions
 }
 
 func (s *SyncService) ExportAllData(ctx context.Context, userUUID uuid.UUID) (*types.ExportedAllData, error) {
@@ -1512,4 +1735,6 @@ type boardMemberActionPayload struct {
 	Email   string `json:"email"`
 	BoardID string `json:"board_id" validate:"required"`
 	UserID  string `json:"user_id"`
+	// Role an invite gets, editor when empty
+	Role string `json:"role,omitempty"`
 }
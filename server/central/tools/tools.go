@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"seisami/server/central/access"
 	"seisami/server/centraldb"
+	"seisami/server/hlc"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,15 +22,18 @@ type Tools struct {
 	openAiTools   []openai.Tool
 	ctx           context.Context
 	queries       *centraldb.Queries
+	access        *access.Authorizer
 	userID        uuid.UUID
 	boardID       uuid.UUID
 	toolsRegistry map[string]ToolHandler
 	NotifySync    func(userID, tableName string)
 }
 
-func NewTools(queries *centraldb.Queries, ctx context.Context, userID, boardID uuid.UUID) *Tools {
+// NewTools acts for userID, every tool checks with authorizer that userID may touch what the model asked for
+func NewTools(queries *centraldb.Queries, authorizer *access.Authorizer, ctx context.Context, userID, boardID uuid.UUID) *Tools {
 	t := &Tools{
 		queries:       queries,
+		access:        authorizer,
 		ctx:           ctx,
 		userID:        userID,
 		boardID:       boardID,
@@ -105,6 +110,10 @@ func (t *Tools) HandleListColumns() {
 			targetBoardID = parsed
 		}
 
+		if err := t.access.Board(ctx, userID, targetBoardID, access.Read); err != nil {
+			return "", err
+		}
+
 		columns, err := queries.GetBoardColumns(ctx, pgtype.UUID{Bytes: targetBoardID, Valid: true})
 		if err != nil {
 			return "", err
@@ -153,6 +162,10 @@ func (t *Tools) HandleCreateColumn() {
 			targetBoardID = parsed
 		}
 
+		if err := t.access.Board(ctx, userID, targetBoardID, access.Write); err != nil {
+			return "", err
+		}
+
 		// Get max position
 		columns, err := queries.GetBoardColumns(ctx, pgtype.UUID{Bytes: targetBoardID, Valid: true})
 		if err != nil {
@@ -205,6 +218,7 @@ func (t *Tools) HandleCreateColumn() {
 			Payload:       string(payload),
 			CreatedAt:     pgtype.Text{String: now.Format("2006-01-02 15:04:05"), Valid: true},
 			UpdatedAt:     pgtype.Text{String: now.Format("2006-01-02 15:04:05"), Valid: true},
+			Hlc:           hlc.Now().String(),
 		})
 
 		t.NotifySync(userID.String(), "columns")
@@ -248,6 +262,10 @@ func (t *Tools) HandleCreateCard() {
 			return "", err
 		}
 
+		if _, err := t.access.Record(ctx, userID, access.Record{Table: "columns", ID: params.ColumnID}, access.Write); err != nil {
+			return "", err
+		}
+
 		id := uuid.New().String()
 		now := time.Now()
 
@@ -289,6 +307,7 @@ func (t *Tools) HandleCreateCard() {
 			Payload:       string(payload),
 			CreatedAt:     pgtype.Text{String: now.Format("2006-01-02 15:04:05"), Valid: true},
 			UpdatedAt:     pgtype.Text{String: now.Format("2006-01-02 15:04:05"), Valid: true},
+			Hlc:           hlc.Now().String(),
 		})
 
 		t.NotifySync(userID.String(), "cards")
@@ -335,6 +354,10 @@ func (t *Tools) HandleUpdateCard() {
 			return "", err
 		}
 
+		if _, err := t.access.Record(ctx, userID, access.Record{Table: "cards", ID: params.CardID}, access.Write); err != nil {
+			return "", err
+		}
+
 		now := time.Now()
 
 		err := queries.SyncUpsertCard(ctx, centraldb.SyncUpsertCardParams{
@@ -366,6 +389,7 @@ func (t *Tools) HandleUpdateCard() {
 			Payload:       string(payload),
 			CreatedAt:     pgtype.Text{String: now.Format("2006-01-02 15:04:05"), Valid: true},
 			UpdatedAt:     pgtype.Text{String: now.Format("2006-01-02 15:04:05"), Valid: true},
+			Hlc:           hlc.Now().String(),
 		})
 
 		t.NotifySync(userID.String(), "cards")
@@ -411,6 +435,14 @@ func (t *Tools) HandleMoveCard() {
 			return "", err
 		}
 
+		// the card and the column it goes to, a card can't be pulled out of a board nor pushed into one
+		if _, err := t.access.Record(ctx, userID, access.Record{Table: "cards", ID: params.CardID}, access.Write); err != nil {
+			return "", err
+		}
+		if _, err := t.access.Record(ctx, userID, access.Record{Table: "columns", ID: params.ColumnID}, access.Write); err != nil {
+			return "", err
+		}
+
 		now := time.Now()
 
 		err := queries.SyncUpdateCardColumn(ctx, centraldb.SyncUpdateCardColumnParams{
@@ -441,6 +473,7 @@ func (t *Tools) HandleMoveCard() {
 			Payload:       string(payload),
 			CreatedAt:     pgtype.Text{String: now.Format("2006-01-02 15:04:05"), Valid: true},
 			UpdatedAt:     pgtype.Text{String: now.Format("2006-01-02 15:04:05"), Valid: true},
+			Hlc:           hlc.Now().String(),
 		})
 
 		t.NotifySync(userID.String(), "cards")
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"seisami/server/central/access"
+	"seisami/server/central/access/accesstest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+// the model runs for the user on their own board but names records of a board they aren't on, no query may run
+func TestToolsStayOnTheUsersBoards(t *testing.T) {
+	user, stranger, viewer := uuid.New(), uuid.New(), uuid.New()
+	ownBoard, strangersBoard := uuid.New(), uuid.New()
+
+	authorizer := access.New(&accesstest.Store{
+		Roles: map[[2]uuid.UUID]string{
+			{ownBoard, user}:           "owner",
+			{strangersBoard, stranger}: "owner",
+			{strangersBoard, viewer}:   "viewer",
+		},
+		Records: map[access.Record]uuid.UUID{
+			{Table: "columns", ID: "own-column"}:       ownBoard,
+			{Table: "columns", ID: "strangers-column"}: strangersBoard,
+			{Table: "cards", ID: "own-card"}:           ownBoard,
+			{Table: "cards", ID: "strangers-card"}:     strangersBoard,
+		},
+	})
+	tools := NewTools(nil, authorizer, context.Background(), user, ownBoard)
+
+	tests := []struct {
+		tool string
+		args string
+	}{
+		{"list_columns_by_board", `{"board_id":"` + strangersBoard.String() + `"}`},
+		{"create_column", `{"board_id":"` + strangersBoard.String() + `","column_name":"Mine"}`},
+		{"create_card", `{"column_id":"strangers-column","title":"Mine"}`},
+		{"update_card", `{"card_id":"strangers-card","title":"Mine"}`},
+		{"move_card", `{"card_id":"strangers-card","column_id":"own-column"}`},
+		{"move_card", `{"card_id":"own-card","column_id":"strangers-column"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			_, err := tools.ExecuteTool(openai.ToolCall{Function: openai.FunctionCall{Name: tt.tool, Arguments: tt.args}})
+			if !errors.Is(err, access.ErrForbidden) {
+				t.Errorf("expected ErrForbidden for %s, got %v", tt.args, err)
+			}
+		})
+	}
+
+	// a viewer's assistant may look at the board but not change it
+	viewersTools := NewTools(nil, authorizer, context.Background(), viewer, strangersBoard)
+	for _, tt := range tests[1:] {
+		t.Run("viewer_"+tt.tool, func(t *testing.T) {
+			args := strings.ReplaceAll(tt.args, "own-", "strangers-")
+			_, err := viewersTools.ExecuteTool(openai.ToolCall{Function: openai.FunctionCall{Name: tt.tool, Arguments: args}})
+			if !errors.Is(err, access.ErrForbidden) {
+				t.Errorf("expected ErrForbidden for %s, got %v", args, err)
+			}
+		})
+	}
+}
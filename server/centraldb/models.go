@@ -23,6 +23,34 @@ type Board struct {
 	Name      string
 	CreatedAt pgtype.Timestamptz
 	UpdatedAt pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
+}
+
+type BoardChange struct {
+	BoardID   pgtype.UUID
+	TableName string
+	RecordID  string
+	Version   int64
+}
+
+type BoardInvitation struct {
+	ID         pgtype.UUID
+	BoardID    pgtype.UUID
+	Email      string
+	Role       string
+	InvitedBy  pgtype.UUID
+	CreatedAt  pgtype.Timestamptz
+	ExpiresAt  pgtype.Timestamptz
+	AcceptedAt pgtype.Timestamptz
+	AcceptedBy pgtype.UUID
+	RevokedAt  pgtype.Timestamptz
+}
+
+type BoardKey struct {
+	BoardID    pgtype.UUID
+	UserID     pgtype.UUID
+	WrappedKey string
+	CreatedAt  pgtype.Timestamptz
 }
 
 type BoardMember struct {
@@ -32,6 +60,18 @@ type BoardMember struct {
 	JoinedAt pgtype.Timestamptz
 }
 
+type BoardRemoval struct {
+	BoardID   pgtype.UUID
+	TableName string
+	RecordID  string
+	Version   int64
+}
+
+type BoardVersion struct {
+	BoardID pgtype.UUID
+	Version int64
+}
+
 type Card struct {
 	ID          string
 	ColumnID    string
@@ -40,6 +80,7 @@ type Card struct {
 	Attachments pgtype.Text
 	CreatedAt   pgtype.Timestamptz
 	UpdatedAt   pgtype.Timestamptz
+	DeletedAt   pgtype.Timestamptz
 }
 
 type Column struct {
@@ -49,6 +90,7 @@ type Column struct {
 	Position  int32
 	CreatedAt pgtype.Timestamptz
 	UpdatedAt pgtype.Timestamptz
+	DeletedAt pgtype.Timestamptz
 }
 
 type DesktopLoginCode struct {
@@ -60,6 +102,37 @@ type DesktopLoginCode struct {
 	UsedAt    pgtype.Timestamptz
 }
 
+type Device struct {
+	ID         string
+	UserID     pgtype.UUID
+	Name       string
+	CreatedAt  pgtype.Timestamptz
+	LastSeenAt pgtype.Timestamptz
+	RevokedAt  pgtype.Timestamptz
+	SessionID  string
+}
+
+type EmailVerification struct {
+	TokenHash string
+	UserID    pgtype.UUID
+	Email     string
+	ExpiresAt pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
+type FieldClock struct {
+	TableName string
+	RecordID  string
+	Field     string
+	Hlc       string
+}
+
+type LostBoard struct {
+	UserID  pgtype.UUID
+	BoardID pgtype.UUID
+	LostAt  pgtype.Timestamptz
+}
+
 type Notification struct {
 	ID        pgtype.UUID
 	UserID    pgtype.UUID
@@ -80,6 +153,20 @@ type Operation struct {
 	Payload       string
 	CreatedAt     pgtype.Text
 	UpdatedAt     pgtype.Text
+	Hlc           string
+	Fields        string
+	Seq           int64
+	UserID        pgtype.UUID
+	BoardID       pgtype.UUID
+}
+
+type OperationSequence struct {
+	Scope string
+	Seq   int64
+}
+
+type SchemaMigration struct {
+	Name string
 }
 
 type SyncState struct {
@@ -87,6 +174,7 @@ type SyncState struct {
 	TableName      string
 	LastSyncedAt   int64
 	LastSyncedOpID pgtype.Text
+	DeviceID       string
 }
 
 type Transcription struct {
@@ -98,6 +186,7 @@ type Transcription struct {
 	AssistantResponse pgtype.Text
 	CreatedAt         pgtype.Timestamptz
 	UpdatedAt         pgtype.Timestamptz
+	DeletedAt         pgtype.Timestamptz
 }
 
 type User struct {
@@ -109,4 +198,14 @@ type User struct {
 	ResetToken          pgtype.Text
 	ResetTokenExpiresAt pgtype.Timestamptz
 	CloudInitialized    pgtype.Bool
+	EmailVerifiedAt     pgtype.Timestamptz
+}
+
+type UserKey struct {
+	UserID              pgtype.UUID
+	PublicKey           string
+	EncryptedPrivateKey string
+	Salt                string
+	CreatedAt           pgtype.Timestamptz
+	UpdatedAt           pgtype.Timestamptz
 }
@@ -11,6 +11,40 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const acceptBoardInvitation = `-- name: AcceptBoardInvitation :one
+UPDATE board_invitations
+SET accepted_at = NOW(), accepted_by = $2
+WHERE id = $1
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
+RETURNING id, board_id, email, role, invited_by, created_at, expires_at, accepted_at, accepted_by, revoked_at
+`
+
+type AcceptBoardInvitationParams struct {
+	ID         pgtype.UUID
+	AcceptedBy pgtype.UUID
+}
+
+// an invite is used once, the update only matches while it's still open
+func (q *Queries) AcceptBoardInvitation(ctx context.Context, arg AcceptBoardInvitationParams) (BoardInvitation, error) {
+	row := q.db.QueryRow(ctx, acceptBoardInvitation, arg.ID, arg.AcceptedBy)
+	var i BoardInvitation
+	err := row.Scan(
+		&i.ID,
+		&i.BoardID,
+		&i.Email,
+		&i.Role,
+		&i.InvitedBy,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.AcceptedAt,
+		&i.AcceptedBy,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
 const consumeDesktopLoginCode = `-- name: ConsumeDesktopLoginCode :one
 UPDATE desktop_login_codes
 SET used_at = NOW()
@@ -89,7 +123,7 @@ const createBoard = `-- name: CreateBoard :one
 
 INSERT INTO boards (id, user_id, name, created_at, updated_at)
 VALUES ($1, $2, $3, $4, $5)
-RETURNING id, user_id, name, created_at, updated_at
+RETURNING id, user_id, name, created_at, updated_at, deleted_at
 `
 
 type CreateBoardParams struct {
@@ -116,6 +150,51 @@ func (q *Queries) CreateBoard(ctx context.Context, arg CreateBoardParams) (Board
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const createBoardInvitation = `-- name: CreateBoardInvitation :one
+INSERT INTO board_invitations (id, board_id, email, role, invited_by, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (board_id, lower(email)) WHERE accepted_at IS NULL AND revoked_at IS NULL DO UPDATE SET
+    role = EXCLUDED.role,
+    invited_by = EXCLUDED.invited_by,
+    expires_at = EXCLUDED.expires_at
+RETURNING id, board_id, email, role, invited_by, created_at, expires_at, accepted_at, accepted_by, revoked_at
+`
+
+type CreateBoardInvitationParams struct {
+	ID        pgtype.UUID
+	BoardID   pgtype.UUID
+	Email     string
+	Role      string
+	InvitedBy pgtype.UUID
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreateBoardInvitation(ctx context.Context, arg CreateBoardInvitationParams) (BoardInvitation, error) {
+	row := q.db.QueryRow(ctx, createBoardInvitation,
+		arg.ID,
+		arg.BoardID,
+		arg.Email,
+		arg.Role,
+		arg.InvitedBy,
+		arg.ExpiresAt,
+	)
+	var i BoardInvitation
+	err := row.Scan(
+		&i.ID,
+		&i.BoardID,
+		&i.Email,
+		&i.Role,
+		&i.InvitedBy,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.AcceptedAt,
+		&i.AcceptedBy,
+		&i.RevokedAt,
 	)
 	return i, err
 }
@@ -123,7 +202,7 @@ func (q *Queries) CreateBoard(ctx context.Context, arg CreateBoardParams) (Board
 const createCard = `-- name: CreateCard :one
 INSERT INTO cards (id, column_id, title, description, attachments, created_at, updated_at)
 VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, column_id, title, description, attachments, created_at, updated_at
+RETURNING id, column_id, title, description, attachments, created_at, updated_at, deleted_at
 `
 
 type CreateCardParams struct {
@@ -155,6 +234,7 @@ func (q *Queries) CreateCard(ctx context.Context, arg CreateCardParams) (Card, e
 		&i.Attachments,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -162,7 +242,7 @@ func (q *Queries) CreateCard(ctx context.Context, arg CreateCardParams) (Card, e
 const createColumn = `-- name: CreateColumn :one
 INSERT INTO columns (id, board_id, name, position, created_at, updated_at)
 VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, board_id, name, position, created_at, updated_at
+RETURNING id, board_id, name, position, created_at, updated_at, deleted_at
 `
 
 type CreateColumnParams struct {
@@ -191,6 +271,7 @@ func (q *Queries) CreateColumn(ctx context.Context, arg CreateColumnParams) (Col
 		&i.Position,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -227,6 +308,28 @@ func (q *Queries) CreateDesktopLoginCode(ctx context.Context, arg CreateDesktopL
 	return i, err
 }
 
+const createEmailVerification = `-- name: CreateEmailVerification :exec
+INSERT INTO email_verifications (token_hash, user_id, email, expires_at)
+VALUES ($1, $2, $3, $4)
+`
+
+type CreateEmailVerificationParams struct {
+	TokenHash string
+	UserID    pgtype.UUID
+	Email     string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreateEmailVerification(ctx context.Context, arg CreateEmailVerificationParams) error {
+	_, err := q.db.Exec(ctx, createEmailVerification,
+		arg.TokenHash,
+		arg.UserID,
+		arg.Email,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
 const createNotification = `-- name: CreateNotification :one
 INSERT INTO notifications (id, user_id, title, message, type, target, read)
 VALUES ($1, $2, $3, $4, $5, $6, $7)
@@ -268,17 +371,34 @@ func (q *Queries) CreateNotification(ctx context.Context, arg CreateNotification
 }
 
 const createOperation = `-- name: CreateOperation :exec
+WITH record_board AS (
+    SELECT (
+        CASE lower($2::TEXT)
+            WHEN 'boards' THEN (SELECT b.id FROM boards AS b WHERE b.id::TEXT = $3::TEXT)
+            WHEN 'columns' THEN (SELECT c.board_id FROM columns AS c WHERE c.id::TEXT = $3::TEXT)
+            WHEN 'cards' THEN (
+                SELECT c.board_id FROM cards AS ca
+                JOIN columns AS c ON c.id = ca.column_id
+                WHERE ca.id::TEXT = $3::TEXT
+            )
+            WHEN 'transcriptions' THEN (SELECT t.board_id FROM transcriptions AS t WHERE t.id::TEXT = $3::TEXT)
+        END
+    )::UUID AS board_id
+), next_seq AS (
+    INSERT INTO operation_sequences (scope, seq)
+    SELECT COALESCE('board:' || board_id::TEXT, 'user:' || COALESCE($11::UUID::TEXT, '')), 1
+    FROM record_board
+    ON CONFLICT (scope) DO UPDATE SET seq = operation_sequences.seq + 1
+    RETURNING seq
+)
 INSERT INTO operations (
-    id, table_name, record_id, operation_type, device_id, payload, created_at, updated_at
+    id, table_name, record_id, operation_type, device_id, payload, created_at, updated_at, hlc, fields, user_id, board_id,
+    seq
 )
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-ON CONFLICT (id) DO UPDATE SET
-    table_name = EXCLUDED.table_name,
-    record_id = EXCLUDED.record_id,
-    operation_type = EXCLUDED.operation_type,
-    device_id = EXCLUDED.device_id,
-    payload = EXCLUDED.payload,
-    updated_at = EXCLUDED.updated_at
+VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, (SELECT board_id FROM record_board), (SELECT seq FROM next_seq)
+)
+ON CONFLICT (id) DO NOTHING
 `
 
 type CreateOperationParams struct {
@@ -290,8 +410,14 @@ type CreateOperationParams struct {
 	Payload       string
 	CreatedAt     pgtype.Text
 	UpdatedAt     pgtype.Text
+	Hlc           string
+	Fields        string
+	UserID        pgtype.UUID
 }
 
+// the op is stored after its record was written, so the record leads to its board. it takes the next number of its
+// board, or of its user when it has none. an op id is only ever stored once, a resent op is answered from the op log
+// before it gets here
 func (q *Queries) CreateOperation(ctx context.Context, arg CreateOperationParams) error {
 	_, err := q.db.Exec(ctx, createOperation,
 		arg.ID,
@@ -302,6 +428,9 @@ func (q *Queries) CreateOperation(ctx context.Context, arg CreateOperationParams
 		arg.Payload,
 		arg.CreatedAt,
 		arg.UpdatedAt,
+		arg.Hlc,
+		arg.Fields,
+		arg.UserID,
 	)
 	return err
 }
@@ -309,7 +438,7 @@ func (q *Queries) CreateOperation(ctx context.Context, arg CreateOperationParams
 const createTranscription = `-- name: CreateTranscription :one
 INSERT INTO transcriptions (id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at)
 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at
+RETURNING id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at
 `
 
 type CreateTranscriptionParams struct {
@@ -344,6 +473,7 @@ func (q *Queries) CreateTranscription(ctx context.Context, arg CreateTranscripti
 		&i.AssistantResponse,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -351,7 +481,7 @@ func (q *Queries) CreateTranscription(ctx context.Context, arg CreateTranscripti
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, email, password_hash)
 VALUES ($1, $2, $3)
-RETURNING id, email, password_hash, created_at, updated_at, reset_token, reset_token_expires_at, cloud_initialized
+RETURNING id, email, password_hash, created_at, updated_at, reset_token, reset_token_expires_at, cloud_initialized, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -372,10 +502,27 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.ResetToken,
 		&i.ResetTokenExpiresAt,
 		&i.CloudInitialized,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const deleteDeviceSyncState = `-- name: DeleteDeviceSyncState :exec
+DELETE FROM sync_state
+WHERE user_id = $1
+  AND device_id = $2
+`
+
+type DeleteDeviceSyncStateParams struct {
+	UserID   pgtype.UUID
+	DeviceID string
+}
+
+func (q *Queries) DeleteDeviceSyncState(ctx context.Context, arg DeleteDeviceSyncStateParams) error {
+	_, err := q.db.Exec(ctx, deleteDeviceSyncState, arg.UserID, arg.DeviceID)
+	return err
+}
+
 const deleteExpiredDesktopCodes = `-- name: DeleteExpiredDesktopCodes :exec
 DELETE FROM desktop_login_codes
 WHERE expires_at < NOW()
@@ -387,34 +534,13 @@ func (q *Queries) DeleteExpiredDesktopCodes(ctx context.Context) error {
 	return err
 }
 
-const ensureBoardOwner = `-- name: EnsureBoardOwner :one
-SELECT EXISTS (
-  SELECT 1
-  FROM board_members
-  WHERE board_id = $1
-    AND user_id = $2
-    AND role = 'owner'
-) AS is_owner
-`
-
-type EnsureBoardOwnerParams struct {
-	BoardID pgtype.UUID
-	UserID  pgtype.UUID
-}
-
-func (q *Queries) EnsureBoardOwner(ctx context.Context, arg EnsureBoardOwnerParams) (bool, error) {
-	row := q.db.QueryRow(ctx, ensureBoardOwner, arg.BoardID, arg.UserID)
-	var is_owner bool
-	err := row.Scan(&is_owner)
-	return is_owner, err
-}
-
 const getAllCards = `-- name: GetAllCards :many
-SELECT ca.id, ca.column_id, ca.title, ca.description, ca.attachments, ca.created_at, ca.updated_at
+SELECT ca.id, ca.column_id, ca.title, ca.description, ca.attachments, ca.created_at, ca.updated_at, ca.deleted_at
 FROM cards ca
 JOIN columns col ON ca.column_id = col.id
 JOIN boards b ON col.board_id = b.id
 WHERE b.user_id = $1
+  AND ca.deleted_at IS NULL
 ORDER BY ca.created_at ASC
 `
 
@@ -435,6 +561,7 @@ func (q *Queries) GetAllCards(ctx context.Context, userID pgtype.UUID) ([]Card,
 			&i.Attachments,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -447,10 +574,10 @@ func (q *Queries) GetAllCards(ctx context.Context, userID pgtype.UUID) ([]Card,
 }
 
 const getAllColumns = `-- name: GetAllColumns :many
-SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at 
+SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at, c.deleted_at 
   FROM columns c
   JOIN boards b ON b.id = c.board_id
-  WHERE b.user_id = $1 ORDER BY c.created_at ASC
+  WHERE b.user_id = $1 AND c.deleted_at IS NULL ORDER BY c.created_at ASC
 `
 
 func (q *Queries) GetAllColumns(ctx context.Context, userID pgtype.UUID) ([]Column, error) {
@@ -469,6 +596,7 @@ func (q *Queries) GetAllColumns(ctx context.Context, userID pgtype.UUID) ([]Colu
 			&i.Position,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -481,7 +609,7 @@ func (q *Queries) GetAllColumns(ctx context.Context, userID pgtype.UUID) ([]Colu
 }
 
 const getAllOperations = `-- name: GetAllOperations :many
-SELECT o.id, o.table_name, o.record_id, o.operation_type, o.device_id, o.payload, o.created_at, o.updated_at
+SELECT o.id, o.table_name, o.record_id, o.operation_type, o.device_id, o.payload, o.created_at, o.updated_at, o.hlc, o.fields, o.seq, o.user_id, o.board_id
 FROM operations AS o
 JOIN (
     SELECT inner_op.record_id, MAX(inner_op.created_at) AS max_created_at
@@ -494,6 +622,7 @@ JOIN (
         FROM sync_state AS ss
         WHERE ss."table_name" = $1
           AND ss."user_id" = $4
+          AND ss.device_id = ''
     )
     AND inner_op."table_name" = $2
     GROUP BY inner_op.record_id
@@ -538,61 +667,11 @@ func (q *Queries) GetAllOperations(ctx context.Context, arg GetAllOperationsPara
 			&i.Payload,
 			&i.CreatedAt,
 			&i.UpdatedAt,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
-const getAllOperationsSinceClient = `-- name: GetAllOperationsSinceClient :many
-SELECT o.id, o.table_name, o.record_id, o.operation_type, o.device_id, o.payload, o.created_at, o.updated_at
-FROM operations AS o
-JOIN (
-    SELECT record_id, MAX(created_at) AS max_created_at
-    FROM operations inner_op
-    WHERE inner_op.created_at > to_char(to_timestamp($1), 'YYYY-MM-DD HH24:MI:SS')
-      AND inner_op."table_name" = $2
-    GROUP BY record_id
-) AS latest
-  ON o.record_id = latest.record_id
- AND o.created_at = latest.max_created_at
- AND o."table_name" = $2
-JOIN cards AS ca ON ca.id = o.record_id
-JOIN columns AS c ON c.id = ca.column_id
-JOIN boards AS b ON b.id = c.board_id
-WHERE b.user_id = $3
-ORDER BY o.created_at ASC
-`
-
-type GetAllOperationsSinceClientParams struct {
-	ToTimestamp float64
-	TableName   string
-	UserID      pgtype.UUID
-}
-
-func (q *Queries) GetAllOperationsSinceClient(ctx context.Context, arg GetAllOperationsSinceClientParams) ([]Operation, error) {
-	rows, err := q.db.Query(ctx, getAllOperationsSinceClient, arg.ToTimestamp, arg.TableName, arg.UserID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Operation
-	for rows.Next() {
-		var i Operation
-		if err := rows.Scan(
-			&i.ID,
-			&i.TableName,
-			&i.RecordID,
-			&i.OperationType,
-			&i.DeviceID,
-			&i.Payload,
-			&i.CreatedAt,
-			&i.UpdatedAt,
+			&i.Hlc,
+			&i.Fields,
+			&i.Seq,
+			&i.UserID,
+			&i.BoardID,
 		); err != nil {
 			return nil, err
 		}
@@ -605,10 +684,11 @@ func (q *Queries) GetAllOperationsSinceClient(ctx context.Context, arg GetAllOpe
 }
 
 const getAllTranscriptions = `-- name: GetAllTranscriptions :many
-SELECT t.id, t.board_id, t.transcription, t.recording_path, t.intent, t.assistant_response, t.created_at, t.updated_at
+SELECT t.id, t.board_id, t.transcription, t.recording_path, t.intent, t.assistant_response, t.created_at, t.updated_at, t.deleted_at
 FROM transcriptions t
 JOIN boards b ON t.board_id = b.id
 WHERE b.user_id = $1
+  AND t.deleted_at IS NULL
 ORDER BY t.created_at DESC
 `
 
@@ -630,6 +710,7 @@ func (q *Queries) GetAllTranscriptions(ctx context.Context, userID pgtype.UUID)
 			&i.AssistantResponse,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -642,7 +723,7 @@ func (q *Queries) GetAllTranscriptions(ctx context.Context, userID pgtype.UUID)
 }
 
 const getBoardByID = `-- name: GetBoardByID :one
-SELECT id, user_id, name, created_at, updated_at FROM boards
+SELECT id, user_id, name, created_at, updated_at, deleted_at FROM boards
 WHERE id = $1
 `
 
@@ -655,14 +736,16 @@ func (q *Queries) GetBoardByID(ctx context.Context, id pgtype.UUID) (Board, erro
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getBoardColumns = `-- name: GetBoardColumns :many
-SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at
+SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at, c.deleted_at
 FROM columns c
 WHERE c.board_id = $1
+  AND c.deleted_at IS NULL
 ORDER BY c.created_at ASC
 `
 
@@ -682,6 +765,7 @@ func (q *Queries) GetBoardColumns(ctx context.Context, boardID pgtype.UUID) ([]C
 			&i.Position,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -693,6 +777,47 @@ func (q *Queries) GetBoardColumns(ctx context.Context, boardID pgtype.UUID) ([]C
 	return items, nil
 }
 
+const getBoardInvitation = `-- name: GetBoardInvitation :one
+SELECT id, board_id, email, role, invited_by, created_at, expires_at, accepted_at, accepted_by, revoked_at FROM board_invitations
+WHERE id = $1
+`
+
+func (q *Queries) GetBoardInvitation(ctx context.Context, id pgtype.UUID) (BoardInvitation, error) {
+	row := q.db.QueryRow(ctx, getBoardInvitation, id)
+	var i BoardInvitation
+	err := row.Scan(
+		&i.ID,
+		&i.BoardID,
+		&i.Email,
+		&i.Role,
+		&i.InvitedBy,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.AcceptedAt,
+		&i.AcceptedBy,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getBoardMemberRole = `-- name: GetBoardMemberRole :one
+SELECT role FROM board_members
+WHERE board_id = $1
+  AND user_id = $2
+`
+
+type GetBoardMemberRoleParams struct {
+	BoardID pgtype.UUID
+	UserID  pgtype.UUID
+}
+
+func (q *Queries) GetBoardMemberRole(ctx context.Context, arg GetBoardMemberRoleParams) (pgtype.Text, error) {
+	row := q.db.QueryRow(ctx, getBoardMemberRole, arg.BoardID, arg.UserID)
+	var role pgtype.Text
+	err := row.Scan(&role)
+	return role, err
+}
+
 const getBoardMembers = `-- name: GetBoardMembers :many
 SELECT u.id, u.email, u.password_hash, u.created_at, u.updated_at, u.reset_token, u.reset_token_expires_at, u.cloud_initialized, bm.role, bm.joined_at
 FROM board_members bm
@@ -752,11 +877,11 @@ SELECT
     b.created_at,
     b.updated_at,
     b.user_id,
-    (SELECT COUNT(*) FROM columns c WHERE c.board_id = b.id) AS columns_count,
+    (SELECT COUNT(*) FROM columns c WHERE c.board_id = b.id AND c.deleted_at IS NULL) AS columns_count,
     (SELECT COUNT(*) FROM cards ca 
      JOIN columns col ON ca.column_id = col.id 
-     WHERE col.board_id = b.id) AS cards_count,
-    (SELECT COUNT(*) FROM transcriptions t WHERE t.board_id = b.id) AS transcriptions_count
+     WHERE col.board_id = b.id AND ca.deleted_at IS NULL) AS cards_count,
+    (SELECT COUNT(*) FROM transcriptions t WHERE t.board_id = b.id AND t.deleted_at IS NULL) AS transcriptions_count
 FROM boards b
 WHERE b.id = $1
 `
@@ -789,8 +914,9 @@ func (q *Queries) GetBoardMetadata(ctx context.Context, id pgtype.UUID) (GetBoar
 }
 
 const getBoardTranscriptions = `-- name: GetBoardTranscriptions :many
-SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at FROM transcriptions
+SELECT id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at, deleted_at FROM transcriptions
 WHERE board_id = $1
+  AND deleted_at IS NULL
 ORDER BY created_at DESC
 `
 
@@ -812,6 +938,7 @@ func (q *Queries) GetBoardTranscriptions(ctx context.Context, boardID pgtype.UUI
 			&i.AssistantResponse,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -823,11 +950,27 @@ func (q *Queries) GetBoardTranscriptions(ctx context.Context, boardID pgtype.UUI
 	return items, nil
 }
 
+const getBoardVersion = `-- name: GetBoardVersion :one
+SELECT COALESCE((
+  SELECT version FROM board_versions
+  WHERE board_id = $1
+), 0)::BIGINT AS version
+`
+
+// the number of changes made to a board and everything in it, 0 for boards untouched since versions were introduced
+func (q *Queries) GetBoardVersion(ctx context.Context, boardID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, getBoardVersion, boardID)
+	var version int64
+	err := row.Scan(&version)
+	return version, err
+}
+
 const getBoardsForUser = `-- name: GetBoardsForUser :many
-SELECT b.id, b.user_id, b.name, b.created_at, b.updated_at
+SELECT b.id, b.user_id, b.name, b.created_at, b.updated_at, b.deleted_at
 FROM boards b
 JOIN board_members bm ON bm.board_id = b.id
 WHERE bm.user_id = $1
+  AND b.deleted_at IS NULL
 ORDER BY b.created_at DESC
 `
 
@@ -846,6 +989,7 @@ func (q *Queries) GetBoardsForUser(ctx context.Context, userID pgtype.UUID) ([]B
 			&i.Name,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -857,6 +1001,27 @@ func (q *Queries) GetBoardsForUser(ctx context.Context, userID pgtype.UUID) ([]B
 	return items, nil
 }
 
+const getCardByID = `-- name: GetCardByID :one
+SELECT id, column_id, title, description, attachments, created_at, updated_at, deleted_at FROM cards
+WHERE id = $1
+`
+
+func (q *Queries) GetCardByID(ctx context.Context, id string) (Card, error) {
+	row := q.db.QueryRow(ctx, getCardByID, id)
+	var i Card
+	err := row.Scan(
+		&i.ID,
+		&i.ColumnID,
+		&i.Title,
+		&i.Description,
+		&i.Attachments,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const getCloudInitStatus = `-- name: GetCloudInitStatus :one
 SELECT cloud_initialized 
 FROM "users"
@@ -871,7 +1036,7 @@ func (q *Queries) GetCloudInitStatus(ctx context.Context, id pgtype.UUID) (pgtyp
 }
 
 const getColumnByID = `-- name: GetColumnByID :one
-SELECT id, board_id, name, position, created_at, updated_at FROM columns
+SELECT id, board_id, name, position, created_at, updated_at, deleted_at FROM columns
 WHERE id = $1
 `
 
@@ -885,13 +1050,15 @@ func (q *Queries) GetColumnByID(ctx context.Context, id string) (Column, error)
 		&i.Position,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getColumnCards = `-- name: GetColumnCards :many
-SELECT id, column_id, title, description, attachments, created_at, updated_at FROM cards
+SELECT id, column_id, title, description, attachments, created_at, updated_at, deleted_at FROM cards
 WHERE column_id = $1
+  AND deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -912,6 +1079,7 @@ func (q *Queries) GetColumnCards(ctx context.Context, columnID string) ([]Card,
 			&i.Attachments,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -943,6 +1111,67 @@ func (q *Queries) GetDesktopLoginCode(ctx context.Context, code string) (Desktop
 	return i, err
 }
 
+const getDevice = `-- name: GetDevice :one
+SELECT id, user_id, name, created_at, last_seen_at, revoked_at, session_id FROM devices
+WHERE user_id = $1
+  AND id = $2
+`
+
+type GetDeviceParams struct {
+	UserID pgtype.UUID
+	ID     string
+}
+
+func (q *Queries) GetDevice(ctx context.Context, arg GetDeviceParams) (Device, error) {
+	row := q.db.QueryRow(ctx, getDevice, arg.UserID, arg.ID)
+	var i Device
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.RevokedAt,
+		&i.SessionID,
+	)
+	return i, err
+}
+
+const getFieldClocks = `-- name: GetFieldClocks :many
+SELECT table_name, record_id, field, hlc FROM field_clocks
+WHERE "table_name" = $1 AND record_id = $2
+`
+
+type GetFieldClocksParams struct {
+	TableName string
+	RecordID  string
+}
+
+func (q *Queries) GetFieldClocks(ctx context.Context, arg GetFieldClocksParams) ([]FieldClock, error) {
+	rows, err := q.db.Query(ctx, getFieldClocks, arg.TableName, arg.RecordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FieldClock
+	for rows.Next() {
+		var i FieldClock
+		if err := rows.Scan(
+			&i.TableName,
+			&i.RecordID,
+			&i.Field,
+			&i.Hlc,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getLatestAppVersion = `-- name: GetLatestAppVersion :one
 SELECT id, version, url, notes, sha256, created_at
 FROM app_versions
@@ -1007,34 +1236,78 @@ func (q *Queries) GetNotificationsForUser(ctx context.Context, arg GetNotificati
 	return items, nil
 }
 
+const getOperationSeq = `-- name: GetOperationSeq :one
+SELECT seq FROM operations
+WHERE id = $1
+`
+
+func (q *Queries) GetOperationSeq(ctx context.Context, id string) (int64, error) {
+	row := q.db.QueryRow(ctx, getOperationSeq, id)
+	var seq int64
+	err := row.Scan(&seq)
+	return seq, err
+}
+
+const getRecordBoard = `-- name: GetRecordBoard :one
+SELECT (
+    CASE lower($1::TEXT)
+        WHEN 'boards' THEN (SELECT b.id FROM boards AS b WHERE b.id::TEXT = $2::TEXT)
+        WHEN 'columns' THEN (SELECT c.board_id FROM columns AS c WHERE c.id = $2::TEXT)
+        WHEN 'cards' THEN (
+            SELECT c.board_id FROM cards AS ca
+            JOIN columns AS c ON c.id = ca.column_id
+            WHERE ca.id = $2::TEXT
+        )
+        WHEN 'transcriptions' THEN (SELECT t.board_id FROM transcriptions AS t WHERE t.id = $2::TEXT)
+    END
+)::UUID AS board_id
+`
+
+type GetRecordBoardParams struct {
+	TableName string
+	RecordID  string
+}
+
+// the board a record of any synced table sits in, null when there's no such record
+func (q *Queries) GetRecordBoard(ctx context.Context, arg GetRecordBoardParams) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, getRecordBoard, arg.TableName, arg.RecordID)
+	var board_id pgtype.UUID
+	err := row.Scan(&board_id)
+	return board_id, err
+}
+
 const getSyncState = `-- name: GetSyncState :one
-SELECT ss.user_id, ss.table_name, ss.last_synced_at, ss.last_synced_op_id
+SELECT ss.user_id, ss.table_name, ss.last_synced_at, ss.last_synced_op_id, ss.device_id
 FROM sync_state ss
 WHERE ss.table_name = $1
   AND ss.user_id = $2
+  AND ss.device_id = $3
 LIMIT 1
 `
 
 type GetSyncStateParams struct {
 	TableName string
 	UserID    pgtype.UUID
+	DeviceID  string
 }
 
 func (q *Queries) GetSyncState(ctx context.Context, arg GetSyncStateParams) (SyncState, error) {
-	row := q.db.QueryRow(ctx, getSyncState, arg.TableName, arg.UserID)
+	row := q.db.QueryRow(ctx, getSyncState, arg.TableName, arg.UserID, arg.DeviceID)
 	var i SyncState
 	err := row.Scan(
 		&i.UserID,
 		&i.TableName,
 		&i.LastSyncedAt,
 		&i.LastSyncedOpID,
+		&i.DeviceID,
 	)
 	return i, err
 }
 
 const getUserBoards = `-- name: GetUserBoards :many
-SELECT id, user_id, name, created_at, updated_at FROM boards
+SELECT id, user_id, name, created_at, updated_at, deleted_at FROM boards
 WHERE user_id = $1
+  AND deleted_at IS NULL
 ORDER BY created_at DESC
 `
 
@@ -1053,6 +1326,7 @@ func (q *Queries) GetUserBoards(ctx context.Context, userID pgtype.UUID) ([]Boar
 			&i.Name,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1065,7 +1339,7 @@ func (q *Queries) GetUserBoards(ctx context.Context, userID pgtype.UUID) ([]Boar
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, password_hash, created_at, updated_at, reset_token, reset_token_expires_at, cloud_initialized
+SELECT id, email, password_hash, created_at, updated_at, reset_token, reset_token_expires_at, cloud_initialized, email_verified_at
 FROM users
 WHERE email = $1
 `
@@ -1082,12 +1356,13 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.ResetToken,
 		&i.ResetTokenExpiresAt,
 		&i.CloudInitialized,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, password_hash, created_at, updated_at, reset_token, reset_token_expires_at, cloud_initialized
+SELECT id, email, password_hash, created_at, updated_at, reset_token, reset_token_expires_at, cloud_initialized, email_verified_at
 FROM users
 WHERE id = $1
 `
@@ -1104,12 +1379,13 @@ func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
 		&i.ResetToken,
 		&i.ResetTokenExpiresAt,
 		&i.CloudInitialized,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserByResetToken = `-- name: GetUserByResetToken :one
-SELECT id, email, password_hash, created_at, updated_at, reset_token, reset_token_expires_at, cloud_initialized
+SELECT id, email, password_hash, created_at, updated_at, reset_token, reset_token_expires_at, cloud_initialized, email_verified_at
 FROM users
 WHERE reset_token = $1
   AND reset_token_expires_at > NOW()
@@ -1127,6 +1403,26 @@ func (q *Queries) GetUserByResetToken(ctx context.Context, resetToken pgtype.Tex
 		&i.ResetToken,
 		&i.ResetTokenExpiresAt,
 		&i.CloudInitialized,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserKeys = `-- name: GetUserKeys :one
+SELECT user_id, public_key, encrypted_private_key, salt, created_at, updated_at FROM user_keys
+WHERE user_id = $1
+`
+
+func (q *Queries) GetUserKeys(ctx context.Context, userID pgtype.UUID) (UserKey, error) {
+	row := q.db.QueryRow(ctx, getUserKeys, userID)
+	var i UserKey
+	err := row.Scan(
+		&i.UserID,
+		&i.PublicKey,
+		&i.EncryptedPrivateKey,
+		&i.Salt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
@@ -1143,18 +1439,23 @@ func (q *Queries) InitCloud(ctx context.Context, id pgtype.UUID) error {
 }
 
 const initializeSyncStateForUser = `-- name: InitializeSyncStateForUser :exec
-INSERT INTO sync_state (user_id, table_name, last_synced_at, last_synced_op_id)
+INSERT INTO sync_state (user_id, device_id, table_name, last_synced_at, last_synced_op_id)
 VALUES 
-    ($1, 'boards', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
-    ($1, 'columns', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
-    ($1, 'cards', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
-    ($1, 'transcriptions', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL)
-ON CONFLICT (user_id, table_name)
+    ($1, $2, 'boards', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
+    ($1, $2, 'columns', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
+    ($1, $2, 'cards', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
+    ($1, $2, 'transcriptions', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL)
+ON CONFLICT (user_id, device_id, table_name)
 DO NOTHING
 `
 
-func (q *Queries) InitializeSyncStateForUser(ctx context.Context, userID pgtype.UUID) error {
-	_, err := q.db.Exec(ctx, initializeSyncStateForUser, userID)
+type InitializeSyncStateForUserParams struct {
+	UserID   pgtype.UUID
+	DeviceID string
+}
+
+func (q *Queries) InitializeSyncStateForUser(ctx context.Context, arg InitializeSyncStateForUserParams) error {
+	_, err := q.db.Exec(ctx, initializeSyncStateForUser, arg.UserID, arg.DeviceID)
 	return err
 }
 
@@ -1175,6 +1476,35 @@ func (q *Queries) InsertBoardMember(ctx context.Context, arg InsertBoardMemberPa
 	return err
 }
 
+const isBoardEncrypted = `-- name: IsBoardEncrypted :one
+SELECT EXISTS (
+  SELECT 1 FROM board_keys
+  WHERE board_id = $1
+) AS encrypted
+`
+
+func (q *Queries) IsBoardEncrypted(ctx context.Context, boardID pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, isBoardEncrypted, boardID)
+	var encrypted bool
+	err := row.Scan(&encrypted)
+	return encrypted, err
+}
+
+const isSessionRevoked = `-- name: IsSessionRevoked :one
+SELECT EXISTS (
+    SELECT 1 FROM devices
+    WHERE session_id = $1
+      AND revoked_at IS NOT NULL
+)
+`
+
+func (q *Queries) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	row := q.db.QueryRow(ctx, isSessionRevoked, sessionID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
 const isUserMemberOfBoard = `-- name: IsUserMemberOfBoard :one
 SELECT EXISTS (
   SELECT 1 FROM board_members
@@ -1195,9 +1525,10 @@ func (q *Queries) IsUserMemberOfBoard(ctx context.Context, arg IsUserMemberOfBoa
 }
 
 const listAllColumns = `-- name: ListAllColumns :many
-SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at FROM columns c
+SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at, c.deleted_at FROM columns c
   JOIN boards b
     ON b.user_id = $1
+WHERE c.deleted_at IS NULL
 ORDER BY c.created_at ASC
 `
 
@@ -1217,6 +1548,7 @@ func (q *Queries) ListAllColumns(ctx context.Context, userID pgtype.UUID) ([]Col
 			&i.Position,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1228,24 +1560,190 @@ func (q *Queries) ListAllColumns(ctx context.Context, userID pgtype.UUID) ([]Col
 	return items, nil
 }
 
-const listBoardMembers = `-- name: ListBoardMembers :many
-SELECT bm.board_id, bm.user_id, bm.role, bm.joined_at, u.email
-FROM board_members bm
-JOIN users u ON u.id = bm.user_id
-WHERE bm.board_id = $1
-ORDER BY bm.joined_at DESC
+const listBoardCardsChangedSince = `-- name: ListBoardCardsChangedSince :many
+SELECT ca.id, ca.column_id, ca.title, ca.description, ca.attachments, ca.created_at, ca.updated_at, ca.deleted_at
+FROM cards ca
+JOIN board_changes bc ON bc."table_name" = 'cards' AND bc.record_id = ca.id
+WHERE bc.board_id = $1 AND bc.version > $2
+  AND ca.deleted_at IS NULL
+ORDER BY ca.created_at ASC
 `
 
-type ListBoardMembersRow struct {
-	BoardID  pgtype.UUID
-	UserID   pgtype.UUID
-	Role     pgtype.Text
-	JoinedAt pgtype.Timestamptz
-	Email    string
+type ListBoardCardsChangedSinceParams struct {
+	BoardID pgtype.UUID
+	Version int64
 }
 
-func (q *Queries) ListBoardMembers(ctx context.Context, boardID pgtype.UUID) ([]ListBoardMembersRow, error) {
-	rows, err := q.db.Query(ctx, listBoardMembers, boardID)
+func (q *Queries) ListBoardCardsChangedSince(ctx context.Context, arg ListBoardCardsChangedSinceParams) ([]Card, error) {
+	rows, err := q.db.Query(ctx, listBoardCardsChangedSince, arg.BoardID, arg.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Card
+	for rows.Next() {
+		var i Card
+		if err := rows.Scan(
+			&i.ID,
+			&i.ColumnID,
+			&i.Title,
+			&i.Description,
+			&i.Attachments,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBoardColumnsChangedSince = `-- name: ListBoardColumnsChangedSince :many
+SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at, c.deleted_at
+FROM columns c
+JOIN board_changes bc ON bc."table_name" = 'columns' AND bc.record_id = c.id
+WHERE bc.board_id = $1 AND bc.version > $2
+  AND c.deleted_at IS NULL
+ORDER BY c.created_at ASC
+`
+
+type ListBoardColumnsChangedSinceParams struct {
+	BoardID pgtype.UUID
+	Version int64
+}
+
+func (q *Queries) ListBoardColumnsChangedSince(ctx context.Context, arg ListBoardColumnsChangedSinceParams) ([]Column, error) {
+	rows, err := q.db.Query(ctx, listBoardColumnsChangedSince, arg.BoardID, arg.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Column
+	for rows.Next() {
+		var i Column
+		if err := rows.Scan(
+			&i.ID,
+			&i.BoardID,
+			&i.Name,
+			&i.Position,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBoardInvitations = `-- name: ListBoardInvitations :many
+SELECT id, board_id, email, role, invited_by, created_at, expires_at, accepted_at, accepted_by, revoked_at FROM board_invitations
+WHERE board_id = $1
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL
+ORDER BY created_at DESC
+`
+
+// open invites of a board, expired ones too so they can be resent
+func (q *Queries) ListBoardInvitations(ctx context.Context, boardID pgtype.UUID) ([]BoardInvitation, error) {
+	rows, err := q.db.Query(ctx, listBoardInvitations, boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BoardInvitation
+	for rows.Next() {
+		var i BoardInvitation
+		if err := rows.Scan(
+			&i.ID,
+			&i.BoardID,
+			&i.Email,
+			&i.Role,
+			&i.InvitedBy,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.AcceptedAt,
+			&i.AcceptedBy,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBoardKeyHolders = `-- name: ListBoardKeyHolders :many
+SELECT u.id AS user_id,
+       COALESCE(uk.public_key, '') AS public_key,
+       COALESCE(bk.wrapped_key, '') AS wrapped_key
+FROM users u
+LEFT JOIN user_keys uk ON uk.user_id = u.id
+LEFT JOIN board_keys bk ON bk.board_id = $1 AND bk.user_id = u.id
+WHERE u.id IN (
+    SELECT b.user_id FROM boards b WHERE b.id = $1
+    UNION
+    SELECT bm.user_id FROM board_members bm WHERE bm.board_id = $1
+)
+`
+
+type ListBoardKeyHoldersRow struct {
+	UserID     pgtype.UUID
+	PublicKey  string
+	WrappedKey string
+}
+
+// the owner and every member of a board, with their public key and the board key wrapped for them if they have one
+func (q *Queries) ListBoardKeyHolders(ctx context.Context, boardID pgtype.UUID) ([]ListBoardKeyHoldersRow, error) {
+	rows, err := q.db.Query(ctx, listBoardKeyHolders, boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBoardKeyHoldersRow
+	for rows.Next() {
+		var i ListBoardKeyHoldersRow
+		if err := rows.Scan(&i.UserID, &i.PublicKey, &i.WrappedKey); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBoardMembers = `-- name: ListBoardMembers :many
+SELECT bm.board_id, bm.user_id, bm.role, bm.joined_at, u.email
+FROM board_members bm
+JOIN users u ON u.id = bm.user_id
+WHERE bm.board_id = $1
+ORDER BY bm.joined_at DESC
+`
+
+type ListBoardMembersRow struct {
+	BoardID  pgtype.UUID
+	UserID   pgtype.UUID
+	Role     pgtype.Text
+	JoinedAt pgtype.Timestamptz
+	Email    string
+}
+
+func (q *Queries) ListBoardMembers(ctx context.Context, boardID pgtype.UUID) ([]ListBoardMembersRow, error) {
+	rows, err := q.db.Query(ctx, listBoardMembers, boardID)
 	if err != nil {
 		return nil, err
 	}
@@ -1270,29 +1768,75 @@ func (q *Queries) ListBoardMembers(ctx context.Context, boardID pgtype.UUID) ([]
 	return items, nil
 }
 
+const listBoardRemovalsSince = `-- name: ListBoardRemovalsSince :many
+SELECT removed."table_name", removed.record_id
+FROM (
+  SELECT bc."table_name", bc.record_id, bc.version
+  FROM board_changes bc
+  LEFT JOIN columns c ON bc."table_name" = 'columns' AND c.id = bc.record_id
+  LEFT JOIN cards ca ON bc."table_name" = 'cards' AND ca.id = bc.record_id
+  LEFT JOIN transcriptions t ON bc."table_name" = 'transcriptions' AND t.id = bc.record_id
+  WHERE bc.board_id = $1 AND bc.version > $2
+    AND bc."table_name" <> 'boards'
+    AND (
+      COALESCE(c.id, ca.id, t.id) IS NULL
+      OR COALESCE(c.deleted_at, ca.deleted_at, t.deleted_at) IS NOT NULL
+    )
+  UNION ALL
+  SELECT br."table_name", br.record_id, br.version
+  FROM board_removals br
+  WHERE br.board_id = $1 AND br.version > $2
+) removed
+ORDER BY removed.version ASC
+`
+
+type ListBoardRemovalsSinceParams struct {
+	BoardID pgtype.UUID
+	Version int64
+}
+
+type ListBoardRemovalsSinceRow struct {
+	TableName string
+	RecordID  string
+}
+
+// records of a board deleted, purged or moved to another board since a version, a delta import has to drop them locally
+func (q *Queries) ListBoardRemovalsSince(ctx context.Context, arg ListBoardRemovalsSinceParams) ([]ListBoardRemovalsSinceRow, error) {
+	rows, err := q.db.Query(ctx, listBoardRemovalsSince, arg.BoardID, arg.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBoardRemovalsSinceRow
+	for rows.Next() {
+		var i ListBoardRemovalsSinceRow
+		if err := rows.Scan(&i.TableName, &i.RecordID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listBoardTranscriptions = `-- name: ListBoardTranscriptions :many
-SELECT t.id, t.board_id, t.transcription, t.recording_path, t.intent, t.assistant_response, t.created_at, t.updated_at FROM transcriptions t
-  JOIN boards b
-    ON b.user_id = $1
-WHERE b.id = $2
+SELECT t.id, t.board_id, t.transcription, t.recording_path, t.intent, t.assistant_response, t.created_at, t.updated_at, t.deleted_at FROM transcriptions t
+WHERE t.board_id = $1
+  AND t.deleted_at IS NULL
 ORDER BY t.created_at DESC
-LIMIT $3 OFFSET $4
+LIMIT $2 OFFSET $3
 `
 
 type ListBoardTranscriptionsParams struct {
-	UserID pgtype.UUID
-	ID     pgtype.UUID
-	Limit  int32
-	Offset int32
+	BoardID pgtype.UUID
+	Limit   int32
+	Offset  int32
 }
 
 func (q *Queries) ListBoardTranscriptions(ctx context.Context, arg ListBoardTranscriptionsParams) ([]Transcription, error) {
-	rows, err := q.db.Query(ctx, listBoardTranscriptions,
-		arg.UserID,
-		arg.ID,
-		arg.Limit,
-		arg.Offset,
-	)
+	rows, err := q.db.Query(ctx, listBoardTranscriptions, arg.BoardID, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -1309,6 +1853,51 @@ func (q *Queries) ListBoardTranscriptions(ctx context.Context, arg ListBoardTran
 			&i.AssistantResponse,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBoardTranscriptionsChangedSince = `-- name: ListBoardTranscriptionsChangedSince :many
+SELECT t.id, t.board_id, t.transcription, t.recording_path, t.intent, t.assistant_response, t.created_at, t.updated_at, t.deleted_at
+FROM transcriptions t
+JOIN board_changes bc ON bc."table_name" = 'transcriptions' AND bc.record_id = t.id
+WHERE bc.board_id = $1 AND bc.version > $2
+  AND t.deleted_at IS NULL
+ORDER BY t.created_at DESC
+`
+
+type ListBoardTranscriptionsChangedSinceParams struct {
+	BoardID pgtype.UUID
+	Version int64
+}
+
+func (q *Queries) ListBoardTranscriptionsChangedSince(ctx context.Context, arg ListBoardTranscriptionsChangedSinceParams) ([]Transcription, error) {
+	rows, err := q.db.Query(ctx, listBoardTranscriptionsChangedSince, arg.BoardID, arg.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Transcription
+	for rows.Next() {
+		var i Transcription
+		if err := rows.Scan(
+			&i.ID,
+			&i.BoardID,
+			&i.Transcription,
+			&i.RecordingPath,
+			&i.Intent,
+			&i.AssistantResponse,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1321,8 +1910,8 @@ func (q *Queries) ListBoardTranscriptions(ctx context.Context, arg ListBoardTran
 }
 
 const listBoards = `-- name: ListBoards :many
-SELECT id, user_id, name, created_at, updated_at FROM boards
-  WHERE user_id = $1
+SELECT id, user_id, name, created_at, updated_at, deleted_at FROM boards
+  WHERE user_id = $1 AND deleted_at IS NULL
     ORDER BY created_at ASC
     LIMIT $2 OFFSET $3
 `
@@ -1339,15 +1928,315 @@ func (q *Queries) ListBoards(ctx context.Context, arg ListBoardsParams) ([]Board
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Board
+	var items []Board
+	for rows.Next() {
+		var i Board
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBoardsCards = `-- name: ListBoardsCards :many
+SELECT c.id, c.column_id, c.title, c.description, c.attachments, c.created_at, c.updated_at, c.deleted_at
+FROM cards c
+JOIN columns col ON c.column_id = col.id
+JOIN boards b ON col.board_id = b.id
+WHERE b.user_id = $1 AND col.board_id = $2
+  AND c.deleted_at IS NULL
+ORDER BY c.created_at ASC
+`
+
+type ListBoardsCardsParams struct {
+	UserID  pgtype.UUID
+	BoardID pgtype.UUID
+}
+
+func (q *Queries) ListBoardsCards(ctx context.Context, arg ListBoardsCardsParams) ([]Card, error) {
+	rows, err := q.db.Query(ctx, listBoardsCards, arg.UserID, arg.BoardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Card
+	for rows.Next() {
+		var i Card
+		if err := rows.Scan(
+			&i.ID,
+			&i.ColumnID,
+			&i.Title,
+			&i.Description,
+			&i.Attachments,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDevices = `-- name: ListDevices :many
+SELECT id, user_id, name, created_at, last_seen_at, revoked_at, session_id FROM devices
+WHERE user_id = $1
+ORDER BY last_seen_at DESC
+`
+
+func (q *Queries) ListDevices(ctx context.Context, userID pgtype.UUID) ([]Device, error) {
+	rows, err := q.db.Query(ctx, listDevices, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Device
+	for rows.Next() {
+		var i Device
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.LastSeenAt,
+			&i.RevokedAt,
+			&i.SessionID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLostBoards = `-- name: ListLostBoards :many
+SELECT lb.board_id
+FROM lost_boards lb
+WHERE lb.user_id = $1
+  AND NOT EXISTS (
+    SELECT 1 FROM board_members bm
+    WHERE bm.board_id = lb.board_id AND bm.user_id = lb.user_id
+  )
+ORDER BY lb.lost_at ASC
+`
+
+// boards the user lost and isn't back on
+func (q *Queries) ListLostBoards(ctx context.Context, userID pgtype.UUID) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, listLostBoards, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.UUID
+	for rows.Next() {
+		var board_id pgtype.UUID
+		if err := rows.Scan(&board_id); err != nil {
+			return nil, err
+		}
+		items = append(items, board_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOperationFieldsAfterPosition = `-- name: ListOperationFieldsAfterPosition :many
+SELECT o.record_id, o.fields
+FROM operations AS o
+WHERE o.record_id = ANY($1::TEXT[])
+  AND o.seq > COALESCE((
+    SELECT p.seq
+    FROM unnest($2::UUID[], $3::BIGINT[]) AS p(board_id, seq)
+    WHERE p.board_id = o.board_id
+  ), 0)
+  AND (
+    $4::BIGINT = 0
+    OR o.created_at > to_char(to_timestamp($4::BIGINT), 'YYYY-MM-DD HH24:MI:SS')
+  )
+  AND o."table_name" = $5
+  AND (COALESCE(o.device_id, '') = '' OR o.device_id <> $6)
+  AND o.board_id IN (
+    SELECT b.id FROM boards AS b WHERE b.user_id = $7
+    UNION
+    SELECT bm.board_id FROM board_members AS bm WHERE bm.user_id = $7
+  )
+`
+
+type ListOperationFieldsAfterPositionParams struct {
+	RecordIds      []string
+	PositionBoards []pgtype.UUID
+	PositionSeqs   []int64
+	Since          int64
+	TableName      string
+	DeviceID       pgtype.Text
+	UserID         pgtype.UUID
+}
+
+type ListOperationFieldsAfterPositionRow struct {
+	RecordID string
+	Fields   string
+}
+
+// the fields of every op on the records changed after the position, the pull hands out a record's latest op only
+func (q *Queries) ListOperationFieldsAfterPosition(ctx context.Context, arg ListOperationFieldsAfterPositionParams) ([]ListOperationFieldsAfterPositionRow, error) {
+	rows, err := q.db.Query(ctx, listOperationFieldsAfterPosition,
+		arg.RecordIds,
+		arg.PositionBoards,
+		arg.PositionSeqs,
+		arg.Since,
+		arg.TableName,
+		arg.DeviceID,
+		arg.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListOperationFieldsAfterPositionRow
+	for rows.Next() {
+		var i ListOperationFieldsAfterPositionRow
+		if err := rows.Scan(&i.RecordID, &i.Fields); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOperationsAfterPosition = `-- name: ListOperationsAfterPosition :many
+WITH matched AS (
+    SELECT inner_op.record_id, inner_op.board_id, MAX(inner_op.hlc) AS max_hlc, MAX(inner_op.seq) AS max_seq
+    FROM operations AS inner_op
+    WHERE inner_op.seq > COALESCE((
+        SELECT p.seq
+        FROM unnest($1::UUID[], $2::BIGINT[]) AS p(board_id, seq)
+        WHERE p.board_id = inner_op.board_id
+      ), 0)
+      AND (
+        $3::BIGINT = 0
+        OR inner_op.created_at > to_char(to_timestamp($3::BIGINT), 'YYYY-MM-DD HH24:MI:SS')
+      )
+      AND inner_op."table_name" = $4
+      AND (COALESCE(inner_op.device_id, '') = '' OR inner_op.device_id <> $5)
+      AND inner_op.board_id IN (
+        SELECT b.id FROM boards AS b WHERE b.user_id = $6
+        UNION
+        SELECT bm.board_id FROM board_members AS bm WHERE bm.user_id = $6
+      )
+      AND (
+        COALESCE(cardinality($7::TEXT[]), 0) = 0
+        OR inner_op.record_id = ANY($7::TEXT[])
+      )
+    GROUP BY inner_op.record_id, inner_op.board_id
+), latest AS (
+    SELECT record_id, MAX(max_hlc) AS max_hlc, MAX(max_seq) AS max_seq,
+        array_agg(board_id ORDER BY board_id) AS board_ids, array_agg(max_seq ORDER BY board_id) AS board_seqs
+    FROM matched
+    GROUP BY record_id
+    ORDER BY MAX(max_seq) ASC
+    LIMIT NULLIF($8::INT, 0)
+)
+SELECT o.id, o.table_name, o.record_id, o.operation_type, o.device_id, o.payload, o.created_at, o.updated_at, o.hlc, o.fields, o.seq, o.user_id, o.board_id, latest.max_seq::BIGINT AS max_seq, latest.board_ids::UUID[] AS board_ids,
+    latest.board_seqs::BIGINT[] AS board_seqs
+FROM operations AS o
+JOIN latest
+  ON o.record_id = latest.record_id
+ AND o.hlc = latest.max_hlc
+ AND o."table_name" = $4
+ORDER BY latest.max_seq ASC
+`
+
+type ListOperationsAfterPositionParams struct {
+	PositionBoards []pgtype.UUID
+	PositionSeqs   []int64
+	Since          int64
+	TableName      string
+	DeviceID       pgtype.Text
+	UserID         pgtype.UUID
+	RecordIds      []string
+	RowLimit       int32
+}
+
+type ListOperationsAfterPositionRow struct {
+	ID            string
+	TableName     string
+	RecordID      string
+	OperationType string
+	DeviceID      pgtype.Text
+	Payload       string
+	CreatedAt     pgtype.Text
+	UpdatedAt     pgtype.Text
+	Hlc           string
+	Fields        string
+	Seq           int64
+	UserID        pgtype.UUID
+	BoardID       pgtype.UUID
+	MaxSeq        int64
+	BoardIds      []pgtype.UUID
+	BoardSeqs     []int64
+}
+
+// one page of the latest op of every record the user can see that changed after the position, in the order of the
+// record's newest op after it, with the newest seq of every board those ops were in so the position can move on.
+// boards the position doesn't name start at the beginning, since only narrows pulls of clients that don't have a
+// position yet and no record_ids leave all records in, 0 skips either. row_limit 0 returns every record
+func (q *Queries) ListOperationsAfterPosition(ctx context.Context, arg ListOperationsAfterPositionParams) ([]ListOperationsAfterPositionRow, error) {
+	rows, err := q.db.Query(ctx, listOperationsAfterPosition,
+		arg.PositionBoards,
+		arg.PositionSeqs,
+		arg.Since,
+		arg.TableName,
+		arg.DeviceID,
+		arg.UserID,
+		arg.RecordIds,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListOperationsAfterPositionRow
 	for rows.Next() {
-		var i Board
+		var i ListOperationsAfterPositionRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.UserID,
-			&i.Name,
+			&i.TableName,
+			&i.RecordID,
+			&i.OperationType,
+			&i.DeviceID,
+			&i.Payload,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Hlc,
+			&i.Fields,
+			&i.Seq,
+			&i.UserID,
+			&i.BoardID,
+			&i.MaxSeq,
+			&i.BoardIds,
+			&i.BoardSeqs,
 		); err != nil {
 			return nil, err
 		}
@@ -1359,37 +2248,53 @@ func (q *Queries) ListBoards(ctx context.Context, arg ListBoardsParams) ([]Board
 	return items, nil
 }
 
-const listBoardsCards = `-- name: ListBoardsCards :many
-SELECT c.id, c.column_id, c.title, c.description, c.attachments, c.created_at, c.updated_at
-FROM cards c
-JOIN columns col ON c.column_id = col.id
-JOIN boards b ON col.board_id = b.id
-WHERE b.user_id = $1 AND col.board_id = $2
-ORDER BY c.created_at ASC
+const listPendingInvitationsForEmail = `-- name: ListPendingInvitationsForEmail :many
+SELECT bi.id, bi.board_id, bi.email, bi.role, bi.invited_by, bi.created_at, bi.expires_at, bi.accepted_at, bi.accepted_by, bi.revoked_at, b.name AS board_name
+FROM board_invitations bi
+JOIN boards b ON b.id = bi.board_id
+WHERE lower(bi.email) = lower($1::TEXT)
+  AND bi.accepted_at IS NULL
+  AND bi.revoked_at IS NULL
+  AND bi.expires_at > NOW()
+  AND b.deleted_at IS NULL
+ORDER BY bi.created_at DESC
 `
 
-type ListBoardsCardsParams struct {
-	UserID  pgtype.UUID
-	BoardID pgtype.UUID
-}
-
-func (q *Queries) ListBoardsCards(ctx context.Context, arg ListBoardsCardsParams) ([]Card, error) {
-	rows, err := q.db.Query(ctx, listBoardsCards, arg.UserID, arg.BoardID)
+type ListPendingInvitationsForEmailRow struct {
+	ID         pgtype.UUID
+	BoardID    pgtype.UUID
+	Email      string
+	Role       string
+	InvitedBy  pgtype.UUID
+	CreatedAt  pgtype.Timestamptz
+	ExpiresAt  pgtype.Timestamptz
+	AcceptedAt pgtype.Timestamptz
+	AcceptedBy pgtype.UUID
+	RevokedAt  pgtype.Timestamptz
+	BoardName  string
+}
+
+func (q *Queries) ListPendingInvitationsForEmail(ctx context.Context, email string) ([]ListPendingInvitationsForEmailRow, error) {
+	rows, err := q.db.Query(ctx, listPendingInvitationsForEmail, email)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Card
+	var items []ListPendingInvitationsForEmailRow
 	for rows.Next() {
-		var i Card
+		var i ListPendingInvitationsForEmailRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.ColumnID,
-			&i.Title,
-			&i.Description,
-			&i.Attachments,
+			&i.BoardID,
+			&i.Email,
+			&i.Role,
+			&i.InvitedBy,
 			&i.CreatedAt,
-			&i.UpdatedAt,
+			&i.ExpiresAt,
+			&i.AcceptedAt,
+			&i.AcceptedBy,
+			&i.RevokedAt,
+			&i.BoardName,
 		); err != nil {
 			return nil, err
 		}
@@ -1401,6 +2306,28 @@ func (q *Queries) ListBoardsCards(ctx context.Context, arg ListBoardsCardsParams
 	return items, nil
 }
 
+const lockBoardOperationLog = `-- name: LockBoardOperationLog :exec
+SELECT pg_advisory_xact_lock(hashtext('operations_seq:' || COALESCE($1::UUID::TEXT, '')))
+`
+
+// held until the transaction ends. a batch takes the locks of all the boards it writes up front in order, so two
+// batches on the same boards wait on each other instead of each holding a board's counter the other one needs
+func (q *Queries) LockBoardOperationLog(ctx context.Context, boardID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, lockBoardOperationLog, boardID)
+	return err
+}
+
+const lockOperation = `-- name: LockOperation :exec
+SELECT pg_advisory_xact_lock(hashtext('operation:' || $1::TEXT))
+`
+
+// held until the transaction ends, a resent op waits for the first attempt to commit or roll back before it checks
+// whether it was stored already
+func (q *Queries) LockOperation(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, lockOperation, id)
+	return err
+}
+
 const markNotificationAsRead = `-- name: MarkNotificationAsRead :exec
 UPDATE notifications
 SET read = TRUE
@@ -1418,6 +2345,75 @@ func (q *Queries) MarkNotificationAsRead(ctx context.Context, arg MarkNotificati
 	return err
 }
 
+const purgeBoards = `-- name: PurgeBoards :execrows
+DELETE FROM boards
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeBoards(ctx context.Context, deletedAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeBoards, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeCards = `-- name: PurgeCards :execrows
+DELETE FROM cards
+WHERE deleted_at < $1
+`
+
+// children are purged first, whatever is left inside a purged board or column goes with it through the cascades
+func (q *Queries) PurgeCards(ctx context.Context, deletedAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeCards, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeColumns = `-- name: PurgeColumns :execrows
+DELETE FROM columns
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeColumns(ctx context.Context, deletedAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeColumns, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeTranscriptions = `-- name: PurgeTranscriptions :execrows
+DELETE FROM transcriptions
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeTranscriptions(ctx context.Context, deletedAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeTranscriptions, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const recordLostBoard = `-- name: RecordLostBoard :exec
+INSERT INTO lost_boards (user_id, board_id)
+VALUES ($1, $2)
+ON CONFLICT (user_id, board_id) DO UPDATE SET lost_at = NOW()
+`
+
+type RecordLostBoardParams struct {
+	UserID  pgtype.UUID
+	BoardID pgtype.UUID
+}
+
+func (q *Queries) RecordLostBoard(ctx context.Context, arg RecordLostBoardParams) error {
+	_, err := q.db.Exec(ctx, recordLostBoard, arg.UserID, arg.BoardID)
+	return err
+}
+
 const removeBoardMember = `-- name: RemoveBoardMember :exec
 DELETE FROM board_members
 WHERE board_id = $1 AND user_id = $2
@@ -1433,6 +2429,103 @@ func (q *Queries) RemoveBoardMember(ctx context.Context, arg RemoveBoardMemberPa
 	return err
 }
 
+const renewBoardInvitation = `-- name: RenewBoardInvitation :one
+UPDATE board_invitations
+SET expires_at = $3
+WHERE id = $1
+  AND board_id = $2
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL
+RETURNING id, board_id, email, role, invited_by, created_at, expires_at, accepted_at, accepted_by, revoked_at
+`
+
+type RenewBoardInvitationParams struct {
+	ID        pgtype.UUID
+	BoardID   pgtype.UUID
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) RenewBoardInvitation(ctx context.Context, arg RenewBoardInvitationParams) (BoardInvitation, error) {
+	row := q.db.QueryRow(ctx, renewBoardInvitation, arg.ID, arg.BoardID, arg.ExpiresAt)
+	var i BoardInvitation
+	err := row.Scan(
+		&i.ID,
+		&i.BoardID,
+		&i.Email,
+		&i.Role,
+		&i.InvitedBy,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.AcceptedAt,
+		&i.AcceptedBy,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const revokeBoardInvitation = `-- name: RevokeBoardInvitation :execrows
+UPDATE board_invitations
+SET revoked_at = NOW()
+WHERE id = $1
+  AND board_id = $2
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL
+`
+
+type RevokeBoardInvitationParams struct {
+	ID      pgtype.UUID
+	BoardID pgtype.UUID
+}
+
+func (q *Queries) RevokeBoardInvitation(ctx context.Context, arg RevokeBoardInvitationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeBoardInvitation, arg.ID, arg.BoardID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeDevice = `-- name: RevokeDevice :execrows
+UPDATE devices
+SET revoked_at = NOW()
+WHERE user_id = $1
+  AND id = $2
+  AND revoked_at IS NULL
+`
+
+type RevokeDeviceParams struct {
+	UserID pgtype.UUID
+	ID     string
+}
+
+func (q *Queries) RevokeDevice(ctx context.Context, arg RevokeDeviceParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeDevice, arg.UserID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setBoardOwner = `-- name: SetBoardOwner :execrows
+UPDATE boards
+SET user_id = $2
+WHERE id = $1
+`
+
+type SetBoardOwnerParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+// boards.user_id is who pulls a board as its owner, board_members says the same through role
+func (q *Queries) SetBoardOwner(ctx context.Context, arg SetBoardOwnerParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setBoardOwner, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const setPasswordResetToken = `-- name: SetPasswordResetToken :exec
 UPDATE users
 SET reset_token = $2,
@@ -1453,78 +2546,56 @@ func (q *Queries) SetPasswordResetToken(ctx context.Context, arg SetPasswordRese
 }
 
 const syncDeleteBoard = `-- name: SyncDeleteBoard :exec
-DELETE FROM boards
+UPDATE boards
+SET deleted_at = NOW()
 WHERE id = $1
-  AND user_id = $2
+  AND deleted_at IS NULL
 `
 
-type SyncDeleteBoardParams struct {
-	ID     pgtype.UUID
-	UserID pgtype.UUID
-}
-
-func (q *Queries) SyncDeleteBoard(ctx context.Context, arg SyncDeleteBoardParams) error {
-	_, err := q.db.Exec(ctx, syncDeleteBoard, arg.ID, arg.UserID)
+// who may write a record is decided by central/access before any sync write runs, the writes only find the record
+func (q *Queries) SyncDeleteBoard(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, syncDeleteBoard, id)
 	return err
 }
 
 const syncDeleteCard = `-- name: SyncDeleteCard :exec
-DELETE FROM cards c
-USING columns col
-JOIN boards b ON b.id = col.board_id
-WHERE c.id = $1
-  AND c.column_id = col.id
-  AND b.user_id = $2
+UPDATE cards
+SET deleted_at = NOW()
+WHERE id = $1
+  AND deleted_at IS NULL
 `
 
-type SyncDeleteCardParams struct {
-	ID     string
-	UserID pgtype.UUID
-}
-
-func (q *Queries) SyncDeleteCard(ctx context.Context, arg SyncDeleteCardParams) error {
-	_, err := q.db.Exec(ctx, syncDeleteCard, arg.ID, arg.UserID)
+func (q *Queries) SyncDeleteCard(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, syncDeleteCard, id)
 	return err
 }
 
 const syncDeleteColumn = `-- name: SyncDeleteColumn :exec
-DELETE FROM columns c
-USING boards b
-WHERE c.id = $1
-  AND b.id = c.board_id
-  AND b.user_id = $2
+UPDATE columns
+SET deleted_at = NOW()
+WHERE id = $1
+  AND deleted_at IS NULL
 `
 
-type SyncDeleteColumnParams struct {
-	ID     string
-	UserID pgtype.UUID
-}
-
-func (q *Queries) SyncDeleteColumn(ctx context.Context, arg SyncDeleteColumnParams) error {
-	_, err := q.db.Exec(ctx, syncDeleteColumn, arg.ID, arg.UserID)
+func (q *Queries) SyncDeleteColumn(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, syncDeleteColumn, id)
 	return err
 }
 
 const syncDeleteTranscription = `-- name: SyncDeleteTranscription :exec
-DELETE FROM transcriptions t
-USING boards b
-WHERE t.id = $1
-  AND t.board_id = b.id
-  AND b.user_id = $2
+UPDATE transcriptions
+SET deleted_at = NOW()
+WHERE id = $1
+  AND deleted_at IS NULL
 `
 
-type SyncDeleteTranscriptionParams struct {
-	ID     string
-	UserID pgtype.UUID
-}
-
-func (q *Queries) SyncDeleteTranscription(ctx context.Context, arg SyncDeleteTranscriptionParams) error {
-	_, err := q.db.Exec(ctx, syncDeleteTranscription, arg.ID, arg.UserID)
+func (q *Queries) SyncDeleteTranscription(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, syncDeleteTranscription, id)
 	return err
 }
 
 const syncPullColumns = `-- name: SyncPullColumns :many
-SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at
+SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at, c.deleted_at
   FROM columns c
   JOIN boards b ON b.id = c.board_id
   WHERE b.user_id = $1
@@ -1546,6 +2617,7 @@ func (q *Queries) SyncPullColumns(ctx context.Context, userID pgtype.UUID) ([]Co
 			&i.Position,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1557,31 +2629,65 @@ func (q *Queries) SyncPullColumns(ctx context.Context, userID pgtype.UUID) ([]Co
 	return items, nil
 }
 
+const syncRestoreBoard = `-- name: SyncRestoreBoard :exec
+UPDATE boards
+SET deleted_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) SyncRestoreBoard(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, syncRestoreBoard, id)
+	return err
+}
+
+const syncRestoreCard = `-- name: SyncRestoreCard :exec
+UPDATE cards
+SET deleted_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) SyncRestoreCard(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, syncRestoreCard, id)
+	return err
+}
+
+const syncRestoreColumn = `-- name: SyncRestoreColumn :exec
+UPDATE columns
+SET deleted_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) SyncRestoreColumn(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, syncRestoreColumn, id)
+	return err
+}
+
+const syncRestoreTranscription = `-- name: SyncRestoreTranscription :exec
+UPDATE transcriptions
+SET deleted_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) SyncRestoreTranscription(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, syncRestoreTranscription, id)
+	return err
+}
+
 const syncUpdateCardColumn = `-- name: SyncUpdateCardColumn :exec
-UPDATE cards c
+UPDATE cards
 SET column_id = $1,
     updated_at = $2
-FROM columns col
-JOIN boards b ON b.id = col.board_id
-WHERE c.id = $3
-  AND col.id = $1
-  AND b.user_id = $4
+WHERE id = $3
 `
 
 type SyncUpdateCardColumnParams struct {
 	ColumnID  string
 	UpdatedAt pgtype.Timestamptz
 	ID        string
-	UserID    pgtype.UUID
 }
 
 func (q *Queries) SyncUpdateCardColumn(ctx context.Context, arg SyncUpdateCardColumnParams) error {
-	_, err := q.db.Exec(ctx, syncUpdateCardColumn,
-		arg.ColumnID,
-		arg.UpdatedAt,
-		arg.ID,
-		arg.UserID,
-	)
+	_, err := q.db.Exec(ctx, syncUpdateCardColumn, arg.ColumnID, arg.UpdatedAt, arg.ID)
 	return err
 }
 
@@ -1724,6 +2830,26 @@ func (q *Queries) SyncUpsertTranscription(ctx context.Context, arg SyncUpsertTra
 	return err
 }
 
+const updateBoardMemberRole = `-- name: UpdateBoardMemberRole :execrows
+UPDATE board_members
+SET role = $3
+WHERE board_id = $1 AND user_id = $2
+`
+
+type UpdateBoardMemberRoleParams struct {
+	BoardID pgtype.UUID
+	UserID  pgtype.UUID
+	Role    pgtype.Text
+}
+
+func (q *Queries) UpdateBoardMemberRole(ctx context.Context, arg UpdateBoardMemberRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateBoardMemberRole, arg.BoardID, arg.UserID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updatePassword = `-- name: UpdatePassword :exec
 UPDATE users
 SET password_hash = $2,
@@ -1748,6 +2874,7 @@ UPDATE sync_state
 SET last_synced_at = $1, last_synced_op_id = $2
 WHERE table_name = $3
   AND user_id = $4
+  AND device_id = $5
 `
 
 type UpdateSyncStateParams struct {
@@ -1755,6 +2882,7 @@ type UpdateSyncStateParams struct {
 	LastSyncedOpID pgtype.Text
 	TableName      string
 	UserID         pgtype.UUID
+	DeviceID       string
 }
 
 func (q *Queries) UpdateSyncState(ctx context.Context, arg UpdateSyncStateParams) error {
@@ -1763,14 +2891,99 @@ func (q *Queries) UpdateSyncState(ctx context.Context, arg UpdateSyncStateParams
 		arg.LastSyncedOpID,
 		arg.TableName,
 		arg.UserID,
+		arg.DeviceID,
 	)
 	return err
 }
 
-const upsertSyncState = `-- name: UpsertSyncState :exec
-INSERT INTO sync_state (table_name, last_synced_at, last_synced_op_id, user_id)
+const upsertBoardKey = `-- name: UpsertBoardKey :exec
+INSERT INTO board_keys (board_id, user_id, wrapped_key)
+VALUES ($1, $2, $3)
+ON CONFLICT (board_id, user_id) DO NOTHING
+`
+
+type UpsertBoardKeyParams struct {
+	BoardID    pgtype.UUID
+	UserID     pgtype.UUID
+	WrappedKey string
+}
+
+// a member keeps the first key wrapped for them, a board never switches keys under its members
+func (q *Queries) UpsertBoardKey(ctx context.Context, arg UpsertBoardKeyParams) error {
+	_, err := q.db.Exec(ctx, upsertBoardKey, arg.BoardID, arg.UserID, arg.WrappedKey)
+	return err
+}
+
+const upsertDevice = `-- name: UpsertDevice :one
+INSERT INTO devices (id, user_id, name, session_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, id) DO UPDATE SET
+    name = CASE WHEN EXCLUDED.name = '' THEN devices.name ELSE EXCLUDED.name END,
+    session_id = CASE
+        WHEN devices.revoked_at IS NULL AND EXCLUDED.session_id <> '' THEN EXCLUDED.session_id
+        ELSE devices.session_id
+    END,
+    last_seen_at = NOW()
+RETURNING id, user_id, name, created_at, last_seen_at, revoked_at, session_id
+`
+
+type UpsertDeviceParams struct {
+	ID        string
+	UserID    pgtype.UUID
+	Name      string
+	SessionID string
+}
+
+// an empty name keeps the one the device registered with, a revoked device keeps the session it was revoked with
+func (q *Queries) UpsertDevice(ctx context.Context, arg UpsertDeviceParams) (Device, error) {
+	row := q.db.QueryRow(ctx, upsertDevice,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.SessionID,
+	)
+	var i Device
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.RevokedAt,
+		&i.SessionID,
+	)
+	return i, err
+}
+
+const upsertFieldClock = `-- name: UpsertFieldClock :exec
+INSERT INTO field_clocks ("table_name", record_id, field, hlc)
 VALUES ($1, $2, $3, $4)
-ON CONFLICT(table_name, user_id)
+ON CONFLICT ("table_name", record_id, field) DO UPDATE SET
+    hlc = EXCLUDED.hlc
+WHERE field_clocks.hlc <= EXCLUDED.hlc
+`
+
+type UpsertFieldClockParams struct {
+	TableName string
+	RecordID  string
+	Field     string
+	Hlc       string
+}
+
+func (q *Queries) UpsertFieldClock(ctx context.Context, arg UpsertFieldClockParams) error {
+	_, err := q.db.Exec(ctx, upsertFieldClock,
+		arg.TableName,
+		arg.RecordID,
+		arg.Field,
+		arg.Hlc,
+	)
+	return err
+}
+
+const upsertSyncState = `-- name: UpsertSyncState :exec
+INSERT INTO sync_state (table_name, last_synced_at, last_synced_op_id, user_id, device_id)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT(user_id, device_id, table_name)
 DO UPDATE SET
   last_synced_at = EXCLUDED.last_synced_at,
   last_synced_op_id = EXCLUDED.last_synced_op_id
@@ -1781,6 +2994,7 @@ type UpsertSyncStateParams struct {
 	LastSyncedAt   int64
 	LastSyncedOpID pgtype.Text
 	UserID         pgtype.UUID
+	DeviceID       string
 }
 
 func (q *Queries) UpsertSyncState(ctx context.Context, arg UpsertSyncStateParams) error {
@@ -1789,27 +3003,61 @@ func (q *Queries) UpsertSyncState(ctx context.Context, arg UpsertSyncStateParams
 		arg.LastSyncedAt,
 		arg.LastSyncedOpID,
 		arg.UserID,
+		arg.DeviceID,
 	)
 	return err
 }
 
-const validateBoardAccess = `-- name: ValidateBoardAccess :one
-SELECT EXISTS (
-  SELECT 1
-  FROM board_members
-  WHERE board_id = $1
-    AND user_id = $2
-) AS has_access
+const upsertUserKeys = `-- name: UpsertUserKeys :execrows
+INSERT INTO user_keys (user_id, public_key, encrypted_private_key, salt)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET
+    encrypted_private_key = EXCLUDED.encrypted_private_key,
+    salt = EXCLUDED.salt,
+    updated_at = NOW()
+WHERE user_keys.public_key = EXCLUDED.public_key
 `
 
-type ValidateBoardAccessParams struct {
-	BoardID pgtype.UUID
-	UserID  pgtype.UUID
+type UpsertUserKeysParams struct {
+	UserID              pgtype.UUID
+	PublicKey           string
+	EncryptedPrivateKey string
+	Salt                string
+}
+
+// a new passphrase re-seals the same private key, the public key never changes or wrapped board keys would be lost
+func (q *Queries) UpsertUserKeys(ctx context.Context, arg UpsertUserKeysParams) (int64, error) {
+	result, err := q.db.Exec(ctx, upsertUserKeys,
+		arg.UserID,
+		arg.PublicKey,
+		arg.EncryptedPrivateKey,
+		arg.Salt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-func (q *Queries) ValidateBoardAccess(ctx context.Context, arg ValidateBoardAccessParams) (bool, error) {
-	row := q.db.QueryRow(ctx, validateBoardAccess, arg.BoardID, arg.UserID)
-	var has_access bool
-	err := row.Scan(&has_access)
-	return has_access, err
+const verifyEmail = `-- name: VerifyEmail :one
+WITH used AS (
+    DELETE FROM email_verifications AS ev
+    WHERE ev.token_hash = $1
+      AND ev.expires_at > NOW()
+    RETURNING ev.user_id, ev.email
+)
+UPDATE users AS u
+SET email_verified_at = COALESCE(u.email_verified_at, NOW())
+FROM used
+WHERE u.id = used.user_id
+  AND lower(u.email) = lower(used.email)
+RETURNING u.id
+`
+
+// a link is used once, it only verifies the email it was mailed to and only while the account still has that email
+func (q *Queries) VerifyEmail(ctx context.Context, tokenHash string) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, verifyEmail, tokenHash)
+	var id pgtype.UUID
+	err := row.Scan(&id)
+	return id, err
 }
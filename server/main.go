@@ -10,14 +10,18 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 
+	"seisami/server/backplane"
 	"seisami/server/central"
+	"seisami/server/central/access"
 	"seisami/server/central/actions"
 	"seisami/server/centraldb"
 	"seisami/server/client"
+	"seisami/server/room"
 	"seisami/server/room_manager"
 	"seisami/server/synchub"
 	"seisami/server/types"
@@ -26,7 +30,33 @@ import (
 // a client needs to create a room
 // then when a room has been created, client can join any room using the room id
 
-var roomManager *room_manager.RoomManager
+// a server is one replica's realtime side, its rooms and sync hub hear the other replicas over the backplane
+type server struct {
+	// rooms has the rooms of the clients connected to this replica
+	rooms *room_manager.RoomManager
+	// access checks every message a client sends to a room, a role can change while they're connected
+	access *access.Authorizer
+	// sync stores the events sent to a room, they land in the same op log REST sync reads
+	sync *central.SyncService
+	// hub holds the sync sockets of the devices connected to this replica
+	hub *synchub.SyncHub
+}
+
+func newServer(syncService *central.SyncService, authorizer *access.Authorizer, bp backplane.Backplane) *server {
+	s := &server{
+		rooms:  room_manager.NewRoomManager(bp),
+		access: authorizer,
+		sync:   syncService,
+		hub:    synchub.NewSyncHub(bp),
+	}
+	s.rooms.OnRemotePresence(func(boardId string) {
+		s.tellPresence(boardId, "")
+	})
+	go s.hub.Run()
+
+	return s
+}
+
 var wsUpgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -36,24 +66,14 @@ var wsUpgrader = websocket.Upgrader{
 	},
 }
 
-func init() {
-	roomManager = room_manager.NewRoomManager()
-	central.SetWebSocketHandler(HandleWebSocket)
-	central.SetRoomManagerGetter(getConnectedUsersInRoom)
-}
-
-func getConnectedUsersInRoom(boardID string) ([]string, error) {
-	room, err := roomManager.GetRoom(boardID)
+// Presence is everyone in boardID's room, on this replica and the others, whether or not any of them are connected here
+func (s *server) Presence(boardID string) ([]types.Presence, error) {
+	room, err := s.rooms.GetRoom(boardID)
 	if err != nil {
-		return []string{}, nil
+		return []types.Presence{}, nil
 	}
 
-	clients := room.GetClients()
-	userIDs := make([]string, len(clients))
-	for i, client := range clients {
-		userIDs[i] = client.GetId()
-	}
-	return userIDs, nil
+	return room.Presence(time.Now()), nil
 }
 
 func main() {
@@ -70,7 +90,7 @@ func main() {
 	select {}
 }
 
-func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+func (s *server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -92,10 +112,24 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userUUID, err := uuid.Parse(userId)
+	if err != nil {
+		log.Printf("WebSocket connection with invalid user id: %v", err)
+		conn.Close()
+		return
+	}
+
+	boardUUID, err := uuid.Parse(boardId)
+	if err != nil {
+		log.Printf("WebSocket connection with invalid board id: %v", err)
+		conn.Close()
+		return
+	}
+
 	cl := client.NewClient(conn, userId)
 	fmt.Println("New client connected:", cl.GetId())
 
-	err = roomManager.JoinOrCreateRoom(boardId, cl)
+	err = s.rooms.JoinOrCreateRoom(boardId, cl)
 	if err != nil {
 		log.Printf("Failed to join board room: %v", err)
 		conn.Close()
@@ -105,29 +139,109 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("Client %s joined board room: %s\n", cl.GetId(), boardId)
 
 	// Broadcast user joined event
-	broadcastUserListUpdate(boardId, "user_joined", userId)
+	s.broadcastUserListUpdate(boardId, "user_joined", userId)
 
-	go handleConn(cl, roomManager, boardId)
+	// the events a desktop sends are stored as its device's ops, like the ones it pushes
+	ctx := context.WithValue(context.Background(), central.DeviceContextKey, r.Header.Get(central.DeviceIDHeader))
+
+	go s.handleConn(ctx, cl, boardId, userUUID, boardUUID)
 }
 
-func broadcastUserListUpdate(boardId, eventType, userId string) {
-	userIDs, _ := getConnectedUsersInRoom(boardId)
+func (s *server) broadcastUserListUpdate(boardId, eventType, userId string) {
+	s.rooms.SharePresence(boardId)
+
+	presence, _ := s.Presence(boardId)
+
+	userIDs := make([]string, len(presence))
+	for i, p := range presence {
+		userIDs[i] = p.UserID
+	}
+
+	updateMsg := map[string]interface{}{
+		"type":     eventType,
+		"user_id":  userId,
+		"users":    userIDs,
+		"presence": presence,
+	}
+
+	jsonMsg, _ := json.Marshal(updateMsg)
+	s.rooms.BroadcastLocally(boardId, userId, jsonMsg)
+}
+
+// broadcastPresence tells a room everyone's presence, senderId's own clients are skipped as they know theirs
+func (s *server) broadcastPresence(boardId, senderId string) {
+	s.rooms.SharePresence(boardId)
+	s.tellPresence(boardId, senderId)
+}
+
+// tellPresence tells the room's clients on this replica everyone's presence, the other replicas tell theirs once they
+// get what this one shared
+func (s *server) tellPresence(boardId, senderId string) {
+	presence, _ := s.Presence(boardId)
 
 	updateMsg := map[string]interface{}{
-		"type":    eventType,
-		"user_id": userId,
-		"users":   userIDs,
+		"v":        types.RealtimeVersion,
+		"type":     types.PresenceMessage,
+		"presence": presence,
 	}
 
 	jsonMsg, _ := json.Marshal(updateMsg)
-	roomManager.BroadcastToRoom(boardId, userId, jsonMsg)
+	s.rooms.BroadcastLocally(boardId, senderId, jsonMsg)
+}
+
+// expirePresence ends the presence states nobody renewed in time and tells their rooms
+func (s *server) expirePresence(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, r := range s.rooms.Rooms() {
+			if r.ExpirePresence(now) {
+				s.broadcastPresence(r.GetRoomId(), "")
+			}
+		}
+	}
+}
+
+// sharePresence renews what the other replicas know of the clients here, they drop it once it's RemoteTTL old
+func (s *server) sharePresence(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, r := range s.rooms.Rooms() {
+			if r.ClientCount() > 0 {
+				s.rooms.SharePresence(r.GetRoomId())
+			}
+		}
+	}
 }
 
-func handleConn(c *client.Client, manager *room_manager.RoomManager, boardId string) {
+// updatePresence takes a presence heartbeat, it isn't stored anywhere so it gets no ack either
+func (s *server) updatePresence(ctx context.Context, c *client.Client, boardId string, userUUID, boardUUID uuid.UUID, env types.Envelope) error {
+	event, err := s.sync.ProcessPresence(ctx, userUUID, boardUUID, env)
+	if err != nil {
+		return err
+	}
+
+	r, err := s.rooms.GetRoom(boardId)
+	if err != nil {
+		return err
+	}
+
+	if err := r.UpdatePresence(c, event, time.Now()); err != nil {
+		return err
+	}
+
+	s.broadcastPresence(boardId, c.GetId())
+	return nil
+}
+
+func (s *server) handleConn(ctx context.Context, c *client.Client, boardId string, userUUID, boardUUID uuid.UUID) {
 	defer c.Close()
 	defer func() {
-		manager.LeaveRoomById(boardId, c)
-		broadcastUserListUpdate(boardId, "user_left", c.GetId())
+		s.rooms.LeaveRoomById(boardId, c)
+		s.broadcastUserListUpdate(boardId, "user_left", c.GetId())
 	}()
 
 	for {
@@ -137,32 +251,75 @@ func handleConn(c *client.Client, manager *room_manager.RoomManager, boardId str
 			return
 		}
 
-		var msg types.Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			fmt.Println("Invalid JSON:", err)
-			response := map[string]string{"error": "invalid JSON"}
-			jsonResp, _ := json.Marshal(response)
-			c.Send(jsonResp)
+		env, err := central.DecodeEnvelope(message)
+		if err != nil {
+			sendAck(c, types.Ack{Type: types.NackMessage, ID: env.ID, Error: err.Error()})
 			continue
 		}
 
-		switch msg.Action {
-		case "broadcast":
-			broadcastMsg := map[string]string{
-				"type": msg.Type,
-				"from": c.GetId(),
-				"data": msg.Data,
+		if env.Type == types.PresenceMessage {
+			err := s.updatePresence(ctx, c, boardId, userUUID, boardUUID, env)
+			if errors.Is(err, access.ErrForbidden) {
+				fmt.Println("Client no longer on board:", c.GetId())
+				return
 			}
+			if err != nil {
+				sendAck(c, types.Ack{Type: types.NackMessage, ID: env.ID, Error: central.EventError(err)})
+			}
+			continue
+		}
 
-			jsonMsg, _ := json.MarshalIndent(broadcastMsg, "", "  ")
+		var event types.RoomEvent
+		if env.Type == types.CommentMessage {
+			event, err = s.sync.ProcessComment(ctx, userUUID, boardUUID, env)
+		} else {
+			event, err = s.sync.ProcessEvent(ctx, userUUID, boardUUID, env)
+		}
+		if errors.Is(err, access.ErrForbidden) && s.access.Board(ctx, userUUID, boardUUID, access.Read) != nil {
+			// removed from the board while in its room
+			fmt.Println("Client no longer on board:", c.GetId())
+			return
+		}
+		if err != nil {
+			log.Printf("room event %s from %s refused: %v", env.ID, c.GetId(), err)
+			sendAck(c, types.Ack{Type: types.NackMessage, ID: env.ID, Error: central.EventError(err)})
+			continue
+		}
+
+		sendAck(c, types.Ack{Type: types.AckMessage, ID: event.ID, Seq: event.Seq})
+
+		jsonMsg, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("unable to encode room event: %v", err)
+			continue
+		}
+
+		s.rooms.BroadcastToRoom(boardId, c.GetId(), jsonMsg)
+	}
+}
 
-			manager.BroadcastToRoom(boardId, c.GetId(), jsonMsg)
+// sendAck answers the client about the envelope it sent
+func sendAck(c *client.Client, ack types.Ack) {
+	ack.V = types.RealtimeVersion
 
-		default:
-			response := map[string]string{"error": "unknown action"}
-			jsonResp, _ := json.Marshal(response)
-			c.Send(jsonResp)
+	jsonResp, _ := json.Marshal(ack)
+	c.Send(jsonResp)
+}
+
+// purgeTombstones empties the trash of records deleted longer than retention ago, at startup and then daily
+func purgeTombstones(syncService *central.SyncService, retention time.Duration) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		purged, err := syncService.PurgeTombstones(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("unable to purge tombstones: %v", err)
+		} else if purged > 0 {
+			log.Printf("purged %d soft deleted records", purged)
 		}
+
+		<-ticker.C
 	}
 }
 
@@ -188,22 +345,35 @@ func startCentralHTTPServer() (func(), error) {
 
 	queries := centraldb.New(pool)
 	authService := central.NewAuthService(queries, cfg)
-	syncService := central.NewSyncService(pool, queries, cfg.OpenAIAPIKey)
+	syncService := central.NewSyncService(pool, queries, cfg)
 	notifService := central.NewNotificationService(pool, queries)
-	action := actions.NewAction(cfg.OpenAIAPIKey, queries)
 
-	synchub.Init()
+	// replicas of the server pass on to each other what their clients have to hear, over the database they share
+	listenCtx, stopListening := context.WithCancel(ctx)
+	bp := backplane.NewPostgres(pool, backplane.Channel)
+	if err := bp.Start(listenCtx); err != nil {
+		stopListening()
+		pool.Close()
+		return nil, fmt.Errorf("unable to start backplane: %v", err)
+	}
+
+	srv := newServer(syncService, access.New(queries), bp)
+	action := actions.NewAction(cfg.OpenAIAPIKey, queries, srv.hub)
+
+	go srv.expirePresence(time.Second)
+	go srv.sharePresence(room.RemoteTTL / 3)
+	go purgeTombstones(syncService, cfg.TombstoneRetention)
 
-	router := central.NewRouter(authService, syncService, notifService, action)
+	router := central.NewRouter(authService, syncService, notifService, action, srv.hub, srv)
 
-	server := &http.Server{
+	httpServer := &http.Server{
 		Addr:    cfg.HTTPAddr,
 		Handler: router,
 	}
 
 	go func() {
-		log.Printf("Auth HTTP server listening on %s", server.Addr)
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Auth HTTP server listening on %s", httpServer.Addr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("auth HTTP server failed: %v", err)
 		}
 	}()
@@ -211,9 +381,10 @@ func startCentralHTTPServer() (func(), error) {
 	shutdown := func() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Printf("auth HTTP server shutdown error: %v", err)
 		}
+		stopListening()
 		pool.Close()
 	}
 
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"seisami/server/backplane"
+	"seisami/server/central"
+	"seisami/server/central/access"
+	"seisami/server/centraldb"
+	"seisami/server/synchub"
+	"seisami/server/types"
+)
+
+// joinRoom connects userID to boardID's room on s and waits until s has them in it
+func joinRoom(t *testing.T, s *server, userID, boardID uuid.UUID) *websocket.Conn {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(s.HandleWebSocket))
+	t.Cleanup(srv.Close)
+
+	// what central's /ws route sets once it checked the token
+	header := http.Header{"X-User-ID": {userID.String()}, "X-Board-ID": {boardID.String()}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if r, err := s.rooms.GetRoom(boardID.String()); err == nil && r.ClientCount() > 0 {
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to join the room", userID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectRoomMessage reads conn until a message of type want comes, skipping the room's presence updates
+func expectRoomMessage(t *testing.T, conn *websocket.Conn, want string) types.RoomEvent {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("expected %s, got %v", want, err)
+		}
+
+		var event types.RoomEvent
+		if err := json.Unmarshal(msg, &event); err != nil {
+			t.Fatalf("expected a room message, got %s", msg)
+		}
+		if event.Type == want {
+			return event
+		}
+	}
+}
+
+// two replicas of the server against one database, run when DATABASE_URL points at one to use
+func TestReplicas(t *testing.T) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a channel of its own so replicas of a running server don't hear the test
+	channel := "replicas_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+
+	var queries *centraldb.Queries
+	replica := func() *server {
+		pool, err := pgxpool.New(ctx, url)
+		if err != nil {
+			t.Fatalf("unable to connect: %v", err)
+		}
+		t.Cleanup(pool.Close)
+
+		if _, err := pool.Exec(ctx, schema); err != nil {
+			t.Fatalf("unable to create tables: %v", err)
+		}
+
+		bp := backplane.NewPostgres(pool, channel)
+		if err := bp.Start(ctx); err != nil {
+			t.Fatalf("unable to start: %v", err)
+		}
+
+		queries = centraldb.New(pool)
+		return newServer(central.NewSyncService(pool, queries, central.Config{}), access.New(queries), bp)
+	}
+	a, b := replica(), replica()
+
+	// alice owns a board she shares with bob
+	alice, bob, board := uuid.New(), uuid.New(), uuid.New()
+	for _, user := range []uuid.UUID{alice, bob} {
+		_, err := queries.CreateUser(ctx, centraldb.CreateUserParams{
+			ID:           pgtype.UUID{Bytes: user, Valid: true},
+			Email:        user.String() + "@example.com",
+			PasswordHash: "-",
+		})
+		if err != nil {
+			t.Fatalf("unable to create user: %v", err)
+		}
+	}
+
+	_, err := a.sync.ProcessOperation(ctx, alice.String(), central.SyncOperation{
+		ID:            uuid.NewString(),
+		TableName:     "boards",
+		RecordID:      board.String(),
+		OperationType: "insert",
+		Payload:       `{"id":"` + board.String() + `","name":"Roadmap"}`,
+	})
+	if err != nil {
+		t.Fatalf("unable to create board: %v", err)
+	}
+
+	err = queries.InsertBoardMember(ctx, centraldb.InsertBoardMemberParams{
+		BoardID: pgtype.UUID{Bytes: board, Valid: true},
+		UserID:  pgtype.UUID{Bytes: bob, Valid: true},
+		Role:    pgtype.Text{String: types.BoardEditorRole.String(), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("unable to share board: %v", err)
+	}
+
+	t.Run("room_broadcast", func(t *testing.T) {
+		there := joinRoom(t, b, bob, board)
+		here := joinRoom(t, a, alice, board)
+
+		id := uuid.NewString()
+		env := types.Envelope{V: types.RealtimeVersion, ID: id, Type: "board:data", Data: json.RawMessage(`{"id":"` + board.String() + `","name":"Launch"}`)}
+		if err := here.WriteJSON(env); err != nil {
+			t.Fatalf("unable to send: %v", err)
+		}
+
+		if ack := expectRoomMessage(t, here, types.AckMessage); ack.ID != id {
+			t.Errorf("expected the rename to be acked, got %+v", ack)
+		}
+
+		event := expectRoomMessage(t, there, "board:data")
+		if event.ID != id || event.From != alice.String() || event.Seq == 0 {
+			t.Errorf("expected alice's stored rename on the other replica, got %+v", event)
+		}
+	})
+
+	t.Run("rejected_op_keeps_the_rest_of_the_batch", func(t *testing.T) {
+		bad, good := uuid.NewString(), uuid.NewString()
+		resp, err := a.sync.ProcessBatch(ctx, alice.String(), central.SyncBatchRequest{
+			TableName: "boards",
+			Operations: []central.SyncOperation{
+				{ID: bad, TableName: "boards", RecordID: board.String(), OperationType: "update", Payload: `{"name":`},
+				{ID: good, TableName: "boards", RecordID: board.String(), OperationType: "update", Payload: `{"id":"` + board.String() + `","name":"Renamed"}`},
+			},
+		})
+		if err != nil {
+			t.Fatalf("expected the batch to go through, got %v", err)
+		}
+		if resp.Applied != 1 || len(resp.Rejected) != 1 || resp.Rejected[0].ID != bad {
+			t.Errorf("expected only %s to be rejected, got %+v", bad, resp)
+		}
+		if _, err := queries.GetOperationSeq(ctx, good); err != nil {
+			t.Errorf("expected %s to be stored: %v", good, err)
+		}
+	})
+
+	t.Run("card_moved_to_another_board_is_removed_from_the_first", func(t *testing.T) {
+		other, todo, done, card := uuid.New(), uuid.NewString(), uuid.NewString(), uuid.NewString()
+		apply := func(tableName, recordID, opType, payload string) {
+			t.Helper()
+			_, err := a.sync.ProcessOperation(ctx, alice.String(), central.SyncOperation{
+				ID:            uuid.NewString(),
+				TableName:     tableName,
+				RecordID:      recordID,
+				OperationType: opType,
+				Payload:       payload,
+			})
+			if err != nil {
+				t.Fatalf("unable to %s %s: %v", opType, tableName, err)
+			}
+		}
+
+		apply("boards", other.String(), "insert", `{"id":"`+other.String()+`","name":"Archive"}`)
+		apply("columns", todo, "insert", `{"id":"`+todo+`","board_id":"`+board.String()+`","name":"To Do"}`)
+		apply("columns", done, "insert", `{"id":"`+done+`","board_id":"`+other.String()+`","name":"Done"}`)
+		apply("cards", card, "insert", `{"column":{"id":"`+todo+`"},"card":{"id":"`+card+`","name":"Ship it"}}`)
+
+		version, err := queries.GetBoardVersion(ctx, pgtype.UUID{Bytes: board, Valid: true})
+		if err != nil {
+			t.Fatalf("unable to get board version: %v", err)
+		}
+
+		apply("cards", card, "update", `{"column":{"id":"`+done+`"},"card":{"id":"`+card+`","name":"Ship it"}}`)
+
+		data, err := a.sync.ExportBoardData(ctx, alice, board.String(), version)
+		if err != nil {
+			t.Fatalf("unable to export board: %v", err)
+		}
+		if len(data.Removed) != 1 || data.Removed[0].ID != card {
+			t.Errorf("expected the moved card to be removed from the board it left, got %+v", data.Removed)
+		}
+	})
+
+	t.Run("batches_on_the_same_boards_in_opposite_order", func(t *testing.T) {
+		other, first := uuid.New(), uuid.NewString()
+		_, err := a.sync.ProcessOperation(ctx, alice.String(), central.SyncOperation{
+			ID:            first,
+			TableName:     "boards",
+			RecordID:      other.String(),
+			OperationType: "insert",
+			Payload:       `{"id":"` + other.String() + `","name":"Backlog"}`,
+		})
+		if err != nil {
+			t.Fatalf("unable to create board: %v", err)
+		}
+		if seq, err := queries.GetOperationSeq(ctx, first); err != nil || seq != 1 {
+			t.Errorf("expected a new board's ops to be numbered from 1, got %d: %v", seq, err)
+		}
+
+		rename := func(boardID uuid.UUID, name string) central.SyncOperation {
+			return central.SyncOperation{
+				ID:            uuid.NewString(),
+				TableName:     "boards",
+				RecordID:      boardID.String(),
+				OperationType: "update",
+				Payload:       `{"id":"` + boardID.String() + `","name":"` + name + `"}`,
+			}
+		}
+
+		errs := make(chan error, 2)
+		for _, boards := range [][]uuid.UUID{{board, other}, {other, board}} {
+			go func() {
+				_, err := b.sync.ProcessBatch(ctx, alice.String(), central.SyncBatchRequest{
+					TableName:  "boards",
+					Operations: []central.SyncOperation{rename(boards[0], "One"), rename(boards[1], "Two")},
+				})
+				errs <- err
+			}()
+		}
+		for range 2 {
+			if err := <-errs; err != nil {
+				t.Errorf("expected both batches to go through, got %v", err)
+			}
+		}
+	})
+
+	t.Run("notify_user_sync", func(t *testing.T) {
+		device := &synchub.SyncClient{UserID: bob.String(), DeviceID: "laptop", Send: make(chan []byte, 16)}
+		b.hub.Register(device)
+
+		// the signal may go out before the other replica has the device, it's sent again until it arrives
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			a.hub.NotifyUserSync(bob.String(), "cards")
+
+			select {
+			case data := <-device.Send:
+				var message synchub.SyncMessage
+				if err := json.Unmarshal(data, &message); err != nil || message.Type != "sync_update" || message.TableName != "cards" {
+					t.Errorf("expected a cards sync_update, got %s", data)
+				}
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("expected the signal to reach bob's laptop on the other replica")
+			}
+		}
+	})
+}
@@ -5,29 +5,59 @@ import (
 	"fmt"
 	"slices"
 	"sync"
+	"time"
 
 	"seisami/server/client"
+	"seisami/server/types"
 
 	"github.com/google/uuid"
 )
 
+// presence states are kept until their ttl runs out unless a heartbeat renews them, a connection without a heartbeat
+// for IdleAfter shows as idle
+
+const (
+	FocusTTL   = 30 * time.Second
+	EditingTTL = 10 * time.Second
+	IdleAfter  = 2 * time.Minute
+	// a replica shares its presence well within this while it has clients in the room, one that stopped went away
+	RemoteTTL = FocusTTL
+)
+
+type presence struct {
+	name           string
+	focus          *types.PresenceTarget
+	focusExpires   time.Time
+	editing        *types.PresenceTarget
+	editingExpires time.Time
+	lastSeen       time.Time
+	idle           bool
+}
+
+type remotePresence struct {
+	presence []types.Presence
+	expires  time.Time
+}
+
 type Room struct {
-	id      string
-	clients []*client.Client
-	mu      sync.RWMutex
+	id       string
+	clients  []*client.Client
+	presence map[*client.Client]*presence
+	// what other replicas shared of their clients in this room, by replica
+	remote map[string]*remotePresence
+	mu     sync.RWMutex
 }
 
 func NewRoom() *Room {
-	return &Room{
-		id:      uuid.NewString(),
-		clients: make([]*client.Client, 0),
-	}
+	return NewRoomWithID(uuid.NewString())
 }
 
 func NewRoomWithID(id string) *Room {
 	return &Room{
-		id:      id,
-		clients: make([]*client.Client, 0),
+		id:       id,
+		clients:  make([]*client.Client, 0),
+		presence: make(map[*client.Client]*presence),
+		remote:   make(map[string]*remotePresence),
 	}
 }
 
@@ -44,6 +74,7 @@ func (r *Room) JoinRoom(client *client.Client) error {
 	}
 
 	r.clients = append(r.clients, client)
+	r.presence[client] = &presence{lastSeen: time.Now()}
 	return nil
 }
 
@@ -57,9 +88,128 @@ func (r *Room) LeaveRoom(client *client.Client) error {
 	}
 
 	r.clients = append(r.clients[:idx], r.clients[idx+1:]...)
+	delete(r.presence, client)
 	return nil
 }
 
+// UpdatePresence takes a heartbeat from c, the states it carries are renewed from now and the ones it leaves out end
+func (r *Room) UpdatePresence(c *client.Client, event types.PresenceEvent, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.presence[c]
+	if !ok {
+		return errors.New("user not in room")
+	}
+
+	if event.Name != "" {
+		p.name = event.Name
+	}
+	p.focus, p.focusExpires = event.Focus, now.Add(FocusTTL)
+	p.editing, p.editingExpires = event.Editing, now.Add(EditingTTL)
+	p.lastSeen = now
+	p.idle = false
+
+	return nil
+}
+
+// ExpirePresence ends every state nobody renewed by now, true when that changed anyone's presence
+func (r *Room) ExpirePresence(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := false
+	for _, p := range r.presence {
+		if p.focus != nil && !now.Before(p.focusExpires) {
+			p.focus = nil
+			changed = true
+		}
+		if p.editing != nil && !now.Before(p.editingExpires) {
+			p.editing = nil
+			changed = true
+		}
+		if !p.idle && now.Sub(p.lastSeen) >= IdleAfter {
+			p.idle = true
+			changed = true
+		}
+	}
+
+	for replica, remote := range r.remote {
+		if !now.Before(remote.expires) {
+			delete(r.remote, replica)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// SetRemotePresence takes what replica shared of its clients in the room as of now, an empty list means it has none
+// left, known is false when the replica wasn't sharing any before
+func (r *Room) SetRemotePresence(replica string, presence []types.Presence, now time.Time) (known bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, known = r.remote[replica]
+	if len(presence) == 0 {
+		delete(r.remote, replica)
+		return known
+	}
+
+	r.remote[replica] = &remotePresence{presence: presence, expires: now.Add(RemoteTTL)}
+	return known
+}
+
+// Presence is everyone in the room as of now, the clients of this replica in the order they joined and then everyone
+// another replica shared
+func (r *Room) Presence(now time.Time) []types.Presence {
+	list := r.LocalPresence(now)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	replicas := make([]string, 0, len(r.remote))
+	for replica, remote := range r.remote {
+		if now.Before(remote.expires) {
+			replicas = append(replicas, replica)
+		}
+	}
+	slices.Sort(replicas)
+
+	for _, replica := range replicas {
+		list = append(list, r.remote[replica].presence...)
+	}
+
+	return list
+}
+
+// LocalPresence is the clients connected to this replica as of now, in the order they joined
+func (r *Room) LocalPresence(now time.Time) []types.Presence {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]types.Presence, 0, len(r.clients))
+	for _, c := range r.clients {
+		p := r.presence[c]
+		entry := types.Presence{
+			UserID:   c.GetId(),
+			Name:     p.name,
+			Idle:     p.idle || now.Sub(p.lastSeen) >= IdleAfter,
+			LastSeen: p.lastSeen.UTC().Format(time.RFC3339),
+		}
+		// expired states are left out even before ExpirePresence got to them
+		if p.focus != nil && now.Before(p.focusExpires) {
+			entry.Focus = p.focus
+		}
+		if p.editing != nil && now.Before(p.editingExpires) {
+			entry.Editing = p.editing
+		}
+		list = append(list, entry)
+	}
+
+	return list
+}
+
 // Broadcast sends a message to all clients in the room.
 // You can adapt this based on your WebSocket or message system.
 func (r *Room) Broadcast(message []byte, senderId string) {
@@ -100,4 +250,6 @@ func (r *Room) CloseRoom() {
 	}
 
 	r.clients = nil
+	clear(r.presence)
+	clear(r.remote)
 }
@@ -0,0 +1,150 @@
+package room
+
+import (
+	"seisami/server/client"
+	"seisami/server/types"
+	"testing"
+	"time"
+)
+
+func TestPresence(t *testing.T) {
+	r := NewRoomWithID("board")
+	alice, bob := client.NewClient(nil, "alice"), client.NewClient(nil, "bob")
+	for _, c := range []*client.Client{alice, bob} {
+		if err := r.JoinRoom(c); err != nil {
+			t.Fatalf("unable to join room: %v", err)
+		}
+	}
+
+	// joining stamped the clients with the wall clock, everything after is measured from here
+	start := time.Now()
+
+	card := &types.PresenceTarget{Table: "cards", ID: "card-1"}
+	err := r.UpdatePresence(alice, types.PresenceEvent{Name: "Alice", Focus: card, Editing: card}, start)
+	if err != nil {
+		t.Fatalf("unable to update presence: %v", err)
+	}
+
+	t.Run("heartbeat_shows", func(t *testing.T) {
+		presence := r.Presence(start)
+		if len(presence) != 2 {
+			t.Fatalf("expected 2 people in the room, got %d", len(presence))
+		}
+		if presence[0].Name != "Alice" || presence[0].Focus == nil || presence[0].Editing == nil {
+			t.Errorf("expected alice focused on & editing card-1, got %+v", presence[0])
+		}
+		if presence[1].Focus != nil || presence[1].Editing != nil {
+			t.Errorf("expected bob to be doing nothing, got %+v", presence[1])
+		}
+	})
+
+	t.Run("editing_lapses_first", func(t *testing.T) {
+		now := start.Add(EditingTTL)
+		if !r.ExpirePresence(now) {
+			t.Errorf("expected the lapsed editing state to change the room")
+		}
+
+		alicePresence := r.Presence(now)[0]
+		if alicePresence.Editing != nil {
+			t.Errorf("expected editing to have expired, got %+v", alicePresence.Editing)
+		}
+		if alicePresence.Focus == nil {
+			t.Errorf("expected focus to outlive editing")
+		}
+		if r.ExpirePresence(now) {
+			t.Errorf("expected nothing more to expire")
+		}
+	})
+
+	t.Run("heartbeat_renews", func(t *testing.T) {
+		now := start.Add(FocusTTL - time.Second)
+		if err := r.UpdatePresence(alice, types.PresenceEvent{Focus: card}, now); err != nil {
+			t.Fatalf("unable to update presence: %v", err)
+		}
+
+		later := start.Add(FocusTTL + time.Second)
+		r.ExpirePresence(later)
+		alicePresence := r.Presence(later)[0]
+		if alicePresence.Focus == nil {
+			t.Errorf("expected the renewed focus to still be there")
+		}
+		if alicePresence.Name != "Alice" {
+			t.Errorf("expected a heartbeat without a name to keep it, got %q", alicePresence.Name)
+		}
+	})
+
+	t.Run("quiet_goes_idle", func(t *testing.T) {
+		now := start.Add(IdleAfter)
+		if !r.ExpirePresence(now) {
+			t.Errorf("expected bob going idle to change the room")
+		}
+
+		presence := r.Presence(now)
+		if !presence[1].Idle {
+			t.Errorf("expected bob to be idle, got %+v", presence[1])
+		}
+		if presence[0].Idle {
+			t.Errorf("expected alice, who sent a heartbeat since, to be active")
+		}
+
+		if err := r.UpdatePresence(bob, types.PresenceEvent{}, now); err != nil {
+			t.Fatalf("unable to update presence: %v", err)
+		}
+		if r.Presence(now)[1].Idle {
+			t.Errorf("expected a heartbeat to wake bob up")
+		}
+	})
+
+	t.Run("leaving_ends_presence", func(t *testing.T) {
+		if err := r.LeaveRoom(alice); err != nil {
+			t.Fatalf("unable to leave room: %v", err)
+		}
+
+		presence := r.Presence(start)
+		if len(presence) != 1 || presence[0].UserID != "bob" {
+			t.Errorf("expected only bob left, got %+v", presence)
+		}
+		if err := r.UpdatePresence(alice, types.PresenceEvent{}, start); err == nil {
+			t.Errorf("expected a heartbeat from outside the room to be refused")
+		}
+	})
+}
+
+func TestRemotePresence(t *testing.T) {
+	r := NewRoomWithID("board")
+	alice := client.NewClient(nil, "alice")
+	if err := r.JoinRoom(alice); err != nil {
+		t.Fatalf("unable to join room: %v", err)
+	}
+	start := time.Now()
+
+	if r.SetRemotePresence("replica-b", []types.Presence{{UserID: "bob"}}, start) {
+		t.Errorf("expected replica-b to be new to the room")
+	}
+	if !r.SetRemotePresence("replica-b", []types.Presence{{UserID: "bob"}}, start) {
+		t.Errorf("expected replica-b to be known once it shared")
+	}
+
+	t.Run("everyone_listed", func(t *testing.T) {
+		presence := r.Presence(start)
+		if len(presence) != 2 || presence[0].UserID != "alice" || presence[1].UserID != "bob" {
+			t.Errorf("expected alice then bob, got %+v", presence)
+		}
+		if local := r.LocalPresence(start); len(local) != 1 {
+			t.Errorf("expected only alice to be local, got %+v", local)
+		}
+	})
+
+	t.Run("silent_replica_expires", func(t *testing.T) {
+		now := start.Add(RemoteTTL)
+		if len(r.Presence(now)) != 1 {
+			t.Errorf("expected bob's stale presence to be left out")
+		}
+		if !r.ExpirePresence(now) {
+			t.Errorf("expected the replica going away to change the room")
+		}
+		if r.SetRemotePresence("replica-b", nil, now) {
+			t.Errorf("expected the expired replica to be forgotten")
+		}
+	})
+}
@@ -1,22 +1,67 @@
 package room_manager
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"log"
 	"sync"
+	"time"
 
+	"seisami/server/backplane"
 	"seisami/server/client"
 	"seisami/server/room"
+	"seisami/server/types"
+
+	"github.com/google/uuid"
+)
+
+// roomsTopic is where replicas tell each other what their rooms hear
+const roomsTopic = "rooms"
+
+const (
+	broadcastKind = "broadcast"
+	presenceKind  = "presence"
 )
 
+// roomMessage is what a replica tells the others about one of its rooms, a broadcast for their clients or the presence
+// of its own clients
+type roomMessage struct {
+	Kind     string           `json:"kind"`
+	Replica  string           `json:"replica"`
+	RoomID   string           `json:"room_id"`
+	SenderID string           `json:"sender_id,omitempty"`
+	Message  []byte           `json:"message,omitempty"`
+	Presence []types.Presence `json:"presence,omitempty"`
+}
+
 type RoomManager struct {
 	mu    sync.RWMutex
 	rooms map[string]*room.Room
+
+	backplane backplane.Backplane
+	replica   string
+	// called once a room's presence changed on another replica, to tell the clients here
+	onPresence func(roomId string)
 }
 
-func NewRoomManager() *RoomManager {
-	return &RoomManager{
-		rooms: make(map[string]*room.Room),
+func NewRoomManager(bp backplane.Backplane) *RoomManager {
+	m := &RoomManager{
+		rooms:     make(map[string]*room.Room),
+		backplane: bp,
+		replica:   uuid.NewString(),
 	}
+
+	bp.Subscribe(roomsTopic, m.receive)
+	return m
+}
+
+// OnRemotePresence sets what's done when another replica shared a change to the presence in one of the rooms here
+func (m *RoomManager) OnRemotePresence(fn func(roomId string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onPresence = fn
 }
 
 func (m *RoomManager) CreateRoom() *room.Room {
@@ -39,6 +84,18 @@ func (m *RoomManager) GetRoom(roomId string) (*room.Room, error) {
 	return room, nil
 }
 
+// Rooms is every room open right now
+func (m *RoomManager) Rooms() []*room.Room {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rooms := make([]*room.Room, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		rooms = append(rooms, r)
+	}
+	return rooms
+}
+
 func (m *RoomManager) DeleteRoom(roomId string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -96,7 +153,15 @@ func (m *RoomManager) LeaveRoomById(roomId string, c *client.Client) error {
 	return err
 }
 
+// BroadcastToRoom sends msg to everyone in the room but senderId, on every replica
 func (m *RoomManager) BroadcastToRoom(roomId, senderId string, msg []byte) error {
+	m.publish(roomMessage{Kind: broadcastKind, RoomID: roomId, SenderID: senderId, Message: msg})
+
+	return m.BroadcastLocally(roomId, senderId, msg)
+}
+
+// BroadcastLocally sends msg to everyone in the room but senderId who's connected to this replica
+func (m *RoomManager) BroadcastLocally(roomId, senderId string, msg []byte) error {
 	room, err := m.GetRoom(roomId)
 	if err != nil {
 		return err
@@ -105,3 +170,64 @@ func (m *RoomManager) BroadcastToRoom(roomId, senderId string, msg []byte) error
 	room.Broadcast(msg, senderId)
 	return nil
 }
+
+// SharePresence tells the other replicas the presence of the room's clients on this one
+func (m *RoomManager) SharePresence(roomId string) {
+	presence := []types.Presence{}
+	if r, err := m.GetRoom(roomId); err == nil {
+		presence = r.LocalPresence(time.Now())
+	}
+
+	m.publish(roomMessage{Kind: presenceKind, RoomID: roomId, Presence: presence})
+}
+
+func (m *RoomManager) publish(msg roomMessage) {
+	msg.Replica = m.replica
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("unable to encode room message: %v", err)
+		return
+	}
+
+	if err := m.backplane.Publish(context.Background(), roomsTopic, payload); err != nil {
+		log.Printf("unable to tell other replicas about room %s: %v", msg.RoomID, err)
+	}
+}
+
+// receive takes what another replica told about a room, presence is kept even for rooms nobody here is in
+func (m *RoomManager) receive(payload []byte) {
+	var msg roomMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Printf("unreadable room message: %v", err)
+		return
+	}
+
+	r, err := m.GetRoom(msg.RoomID)
+	if err != nil && msg.Kind == presenceKind && len(msg.Presence) > 0 {
+		r, err = m.GetOrCreateRoom(msg.RoomID), nil
+	}
+	if err != nil {
+		return
+	}
+
+	switch msg.Kind {
+	case broadcastKind:
+		r.Broadcast(msg.Message, msg.SenderID)
+
+	case presenceKind:
+		known := r.SetRemotePresence(msg.Replica, msg.Presence, time.Now())
+
+		// a replica new to the room hears back who's here rather than waiting for the next share
+		if !known && len(msg.Presence) > 0 && r.ClientCount() > 0 {
+			m.SharePresence(msg.RoomID)
+		}
+
+		m.mu.RLock()
+		onPresence := m.onPresence
+		m.mu.RUnlock()
+		if onPresence != nil {
+			onPresence(msg.RoomID)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package room_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"seisami/server/backplane"
+	"seisami/server/client"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connect is userId connected to a replica, the client the replica holds and the socket on the user's end
+func connect(t *testing.T, userId string) (*client.Client, *websocket.Conn) {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("unable to upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	userEnd, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	t.Cleanup(func() { userEnd.Close() })
+
+	return client.NewClient(<-conns, userId), userEnd
+}
+
+func expectMessage(t *testing.T, conn *websocket.Conn, want string) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("expected %s, got %v", want, err)
+	}
+	if string(msg) != want {
+		t.Errorf("expected %s, got %s", want, msg)
+	}
+}
+
+// two replicas of the server, a room's clients hear each other whichever one they're connected to
+func TestRoomsAcrossReplicas(t *testing.T) {
+	bus := backplane.NewMemory()
+	a, b := NewRoomManager(bus), NewRoomManager(bus.Join())
+
+	presenceChanged := make(chan string, 16)
+	b.OnRemotePresence(func(roomId string) {
+		presenceChanged <- roomId
+	})
+
+	alice, aliceEnd := connect(t, "alice")
+	bob, bobEnd := connect(t, "bob")
+	if err := a.JoinOrCreateRoom("board", alice); err != nil {
+		t.Fatalf("unable to join: %v", err)
+	}
+	if err := b.JoinOrCreateRoom("board", bob); err != nil {
+		t.Fatalf("unable to join: %v", err)
+	}
+
+	t.Run("broadcast_reaches_other_replica", func(t *testing.T) {
+		a.BroadcastToRoom("board", "alice", []byte(`{"type":"card:data"}`))
+		expectMessage(t, bobEnd, `{"type":"card:data"}`)
+
+		b.BroadcastToRoom("board", "bob", []byte(`{"type":"column:data"}`))
+		expectMessage(t, aliceEnd, `{"type":"column:data"}`)
+	})
+
+	t.Run("sender_still_skipped", func(t *testing.T) {
+		a.BroadcastToRoom("board", "bob", []byte(`{"from":"bob"}`))
+		a.BroadcastToRoom("board", "alice", []byte(`{"from":"alice"}`))
+		// bob's own message never came, the next one for him is alice's
+		expectMessage(t, bobEnd, `{"from":"alice"}`)
+	})
+
+	t.Run("presence_is_shared", func(t *testing.T) {
+		a.SharePresence("board")
+
+		select {
+		case roomId := <-presenceChanged:
+			if roomId != "board" {
+				t.Errorf("expected board's presence to change, got %s", roomId)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected b to hear of a's presence")
+		}
+
+		r, _ := b.GetRoom("board")
+		presence := r.Presence(time.Now())
+		if len(presence) != 2 || presence[0].UserID != "bob" || presence[1].UserID != "alice" {
+			t.Errorf("expected bob here & alice on the other replica, got %+v", presence)
+		}
+	})
+
+	t.Run("leaving_is_shared", func(t *testing.T) {
+		if err := a.LeaveRoomById("board", alice); err != nil {
+			t.Fatalf("unable to leave: %v", err)
+		}
+		a.SharePresence("board")
+		<-presenceChanged
+
+		r, _ := b.GetRoom("board")
+		presence := r.Presence(time.Now())
+		if len(presence) != 1 || presence[0].UserID != "bob" {
+			t.Errorf("expected only bob left, got %+v", presence)
+		}
+	})
+
+	t.Run("presence_kept_without_local_clients", func(t *testing.T) {
+		c := NewRoomManager(bus.Join())
+		heard := make(chan string, 16)
+		c.OnRemotePresence(func(roomId string) {
+			heard <- roomId
+		})
+
+		b.SharePresence("board")
+		select {
+		case <-heard:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected c to hear of b's presence")
+		}
+
+		r, err := c.GetRoom("board")
+		if err != nil {
+			t.Fatalf("expected c to keep the room's presence: %v", err)
+		}
+		if presence := r.Presence(time.Now()); len(presence) != 1 || presence[0].UserID != "bob" {
+			t.Errorf("expected bob on the other replica, got %+v", presence)
+		}
+	})
+}
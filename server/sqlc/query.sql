@@ -85,19 +85,21 @@ RETURNING *;
 -- name: GetUserBoards :many
 SELECT * FROM boards
 WHERE user_id = $1
+  AND deleted_at IS NULL
 ORDER BY created_at DESC;
 
 -- name: GetBoardColumns :many
 SELECT c.*
 FROM columns c
 WHERE c.board_id = $1
+  AND c.deleted_at IS NULL
 ORDER BY c.created_at ASC;
 
 -- name: GetAllColumns :many
 SELECT c.* 
   FROM columns c
   JOIN boards b ON b.id = c.board_id
-  WHERE b.user_id = $1 ORDER BY c.created_at ASC;
+  WHERE b.user_id = $1 AND c.deleted_at IS NULL ORDER BY c.created_at ASC;
 
 -- name: GetAllCards :many
 SELECT ca.*
@@ -105,6 +107,7 @@ FROM cards ca
 JOIN columns col ON ca.column_id = col.id
 JOIN boards b ON col.board_id = b.id
 WHERE b.user_id = $1
+  AND ca.deleted_at IS NULL
 ORDER BY ca.created_at ASC;
 
 -- name: GetAllTranscriptions :many
@@ -112,16 +115,19 @@ SELECT t.*
 FROM transcriptions t
 JOIN boards b ON t.board_id = b.id
 WHERE b.user_id = $1
+  AND t.deleted_at IS NULL
 ORDER BY t.created_at DESC;
 
 -- name: GetColumnCards :many
 SELECT * FROM cards
 WHERE column_id = $1
+  AND deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: GetBoardTranscriptions :many
 SELECT * FROM transcriptions
 WHERE board_id = $1
+  AND deleted_at IS NULL
 ORDER BY created_at DESC;
 
 ---- Operations -------
@@ -141,10 +147,12 @@ FROM board_insert
 WHERE was_inserted
 ON CONFLICT (board_id, user_id) DO NOTHING;
 
+-- who may write a record is decided by central/access before any sync write runs, the writes only find the record
 -- name: SyncDeleteBoard :exec
-DELETE FROM boards
+UPDATE boards
+SET deleted_at = NOW()
 WHERE id = $1
-  AND user_id = $2;
+  AND deleted_at IS NULL;
 
 -- name: SyncUpsertColumn :exec
 INSERT INTO columns (id, board_id, name, position, created_at, updated_at)
@@ -156,11 +164,10 @@ ON CONFLICT (id) DO UPDATE SET
     updated_at = EXCLUDED.updated_at;
 
 -- name: SyncDeleteColumn :exec
-DELETE FROM columns c
-USING boards b
-WHERE c.id = $1
-  AND b.id = c.board_id
-  AND b.user_id = $2;
+UPDATE columns
+SET deleted_at = NOW()
+WHERE id = $1
+  AND deleted_at IS NULL;
 
 -- name: SyncUpsertCard :exec
 INSERT INTO cards (id, column_id, title, description, attachments, created_at, updated_at)
@@ -173,25 +180,39 @@ ON CONFLICT (id) DO UPDATE SET
     updated_at = EXCLUDED.updated_at;
 
 -- name: SyncDeleteCard :exec
-DELETE FROM cards c
-USING columns col
-JOIN boards b ON b.id = col.board_id
-WHERE c.id = $1
-  AND c.column_id = col.id
-  AND b.user_id = $2;
+UPDATE cards
+SET deleted_at = NOW()
+WHERE id = $1
+  AND deleted_at IS NULL;
 
 -- name: SyncUpdateCardColumn :exec
-UPDATE cards c
+UPDATE cards
 SET column_id = $1,
     updated_at = $2
-FROM columns col
-JOIN boards b ON b.id = col.board_id
-WHERE c.id = $3
-  AND col.id = $1
-  AND b.user_id = $4;
+WHERE id = $3;
+
+-- name: SyncRestoreBoard :exec
+UPDATE boards
+SET deleted_at = NULL
+WHERE id = $1;
+
+-- name: SyncRestoreCard :exec
+UPDATE cards
+SET deleted_at = NULL
+WHERE id = $1;
+
+-- name: SyncRestoreColumn :exec
+UPDATE columns
+SET deleted_at = NULL
+WHERE id = $1;
+
+-- name: SyncRestoreTranscription :exec
+UPDATE transcriptions
+SET deleted_at = NULL
+WHERE id = $1;
 
 -- name: SyncPullColumns :many
-SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at
+SELECT c.id, c.board_id, c.name, c.position, c.created_at, c.updated_at, c.deleted_at
   FROM columns c
   JOIN boards b ON b.id = c.board_id
   WHERE b.user_id = $1;
@@ -211,6 +232,7 @@ JOIN (
         FROM sync_state AS ss
         WHERE ss."table_name" = $1
           AND ss."user_id" = $4
+          AND ss.device_id = ''
     )
     AND inner_op."table_name" = $2
     GROUP BY inner_op.record_id
@@ -223,31 +245,89 @@ JOIN boards AS b ON b.id = c.board_id
 WHERE b.user_id = $4
 ORDER BY o.created_at ASC;
 
--- name: GetAllOperationsSinceClient :many
-SELECT o.*
-FROM operations AS o
-JOIN (
-    SELECT record_id, MAX(created_at) AS max_created_at
-    FROM operations inner_op
-    WHERE inner_op.created_at > to_char(to_timestamp($1), 'YYYY-MM-DD HH24:MI:SS')
-      AND inner_op."table_name" = $2
+-- one page of the latest op of every record the user can see that changed after the position, in the order of the
+-- record's newest op after it, with the newest seq of every board those ops were in so the position can move on.
+-- boards the position doesn't name start at the beginning, since only narrows pulls of clients that don't have a
+-- position yet and no record_ids leave all records in, 0 skips either. row_limit 0 returns every record
+-- name: ListOperationsAfterPosition :many
+WITH matched AS (
+    SELECT inner_op.record_id, inner_op.board_id, MAX(inner_op.hlc) AS max_hlc, MAX(inner_op.seq) AS max_seq
+    FROM operations AS inner_op
+    WHERE inner_op.seq > COALESCE((
+        SELECT p.seq
+        FROM unnest(sqlc.arg(position_boards)::UUID[], sqlc.arg(position_seqs)::BIGINT[]) AS p(board_id, seq)
+        WHERE p.board_id = inner_op.board_id
+      ), 0)
+      AND (
+        sqlc.arg(since)::BIGINT = 0
+        OR inner_op.created_at > to_char(to_timestamp(sqlc.arg(since)::BIGINT), 'YYYY-MM-DD HH24:MI:SS')
+      )
+      AND inner_op."table_name" = sqlc.arg(table_name)
+      AND (COALESCE(inner_op.device_id, '') = '' OR inner_op.device_id <> sqlc.arg(device_id))
+      AND inner_op.board_id IN (
+        SELECT b.id FROM boards AS b WHERE b.user_id = sqlc.arg(user_id)
+        UNION
+        SELECT bm.board_id FROM board_members AS bm WHERE bm.user_id = sqlc.arg(user_id)
+      )
+      AND (
+        COALESCE(cardinality(sqlc.arg(record_ids)::TEXT[]), 0) = 0
+        OR inner_op.record_id = ANY(sqlc.arg(record_ids)::TEXT[])
+      )
+    GROUP BY inner_op.record_id, inner_op.board_id
+), latest AS (
+    SELECT record_id, MAX(max_hlc) AS max_hlc, MAX(max_seq) AS max_seq,
+        array_agg(board_id ORDER BY board_id) AS board_ids, array_agg(max_seq ORDER BY board_id) AS board_seqs
+    FROM matched
     GROUP BY record_id
-) AS latest
+    ORDER BY MAX(max_seq) ASC
+    LIMIT NULLIF(sqlc.arg(row_limit)::INT, 0)
+)
+SELECT o.*, latest.max_seq::BIGINT AS max_seq, latest.board_ids::UUID[] AS board_ids,
+    latest.board_seqs::BIGINT[] AS board_seqs
+FROM operations AS o
+JOIN latest
   ON o.record_id = latest.record_id
- AND o.created_at = latest.max_created_at
- AND o."table_name" = $2
-JOIN cards AS ca ON ca.id = o.record_id
-JOIN columns AS c ON c.id = ca.column_id
-JOIN boards AS b ON b.id = c.board_id
-WHERE b.user_id = $3
-ORDER BY o.created_at ASC;
-
+ AND o.hlc = latest.max_hlc
+ AND o."table_name" = sqlc.arg(table_name)
+ORDER BY latest.max_seq ASC;
 
+-- the fields of every op on the records changed after the position, the pull hands out a record's latest op only
+-- name: ListOperationFieldsAfterPosition :many
+SELECT o.record_id, o.fields
+FROM operations AS o
+WHERE o.record_id = ANY(sqlc.arg(record_ids)::TEXT[])
+  AND o.seq > COALESCE((
+    SELECT p.seq
+    FROM unnest(sqlc.arg(position_boards)::UUID[], sqlc.arg(position_seqs)::BIGINT[]) AS p(board_id, seq)
+    WHERE p.board_id = o.board_id
+  ), 0)
+  AND (
+    sqlc.arg(since)::BIGINT = 0
+    OR o.created_at > to_char(to_timestamp(sqlc.arg(since)::BIGINT), 'YYYY-MM-DD HH24:MI:SS')
+  )
+  AND o."table_name" = sqlc.arg(table_name)
+  AND (COALESCE(o.device_id, '') = '' OR o.device_id <> sqlc.arg(device_id))
+  AND o.board_id IN (
+    SELECT b.id FROM boards AS b WHERE b.user_id = sqlc.arg(user_id)
+    UNION
+    SELECT bm.board_id FROM board_members AS bm WHERE bm.user_id = sqlc.arg(user_id)
+  );
+
+-- name: GetFieldClocks :many
+SELECT * FROM field_clocks
+WHERE "table_name" = $1 AND record_id = $2;
+
+-- name: UpsertFieldClock :exec
+INSERT INTO field_clocks ("table_name", record_id, field, hlc)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT ("table_name", record_id, field) DO UPDATE SET
+    hlc = EXCLUDED.hlc
+WHERE field_clocks.hlc <= EXCLUDED.hlc;
 
 -- name: UpsertSyncState :exec
-INSERT INTO sync_state (table_name, last_synced_at, last_synced_op_id, user_id)
-VALUES ($1, $2, $3, $4)
-ON CONFLICT(table_name, user_id)
+INSERT INTO sync_state (table_name, last_synced_at, last_synced_op_id, user_id, device_id)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT(user_id, device_id, table_name)
 DO UPDATE SET
   last_synced_at = EXCLUDED.last_synced_at,
   last_synced_op_id = EXCLUDED.last_synced_op_id;
@@ -257,6 +337,7 @@ SELECT ss.*
 FROM sync_state ss
 WHERE ss.table_name = $1
   AND ss.user_id = $2
+  AND ss.device_id = $3
 LIMIT 1;
 
 
@@ -264,7 +345,50 @@ LIMIT 1;
 UPDATE sync_state
 SET last_synced_at = $1, last_synced_op_id = $2
 WHERE table_name = $3
-  AND user_id = $4;
+  AND user_id = $4
+  AND device_id = $5;
+
+-- an empty name keeps the one the device registered with, a revoked device keeps the session it was revoked with
+-- name: UpsertDevice :one
+INSERT INTO devices (id, user_id, name, session_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, id) DO UPDATE SET
+    name = CASE WHEN EXCLUDED.name = '' THEN devices.name ELSE EXCLUDED.name END,
+    session_id = CASE
+        WHEN devices.revoked_at IS NULL AND EXCLUDED.session_id <> '' THEN EXCLUDED.session_id
+        ELSE devices.session_id
+    END,
+    last_seen_at = NOW()
+RETURNING *;
+
+-- name: GetDevice :one
+SELECT * FROM devices
+WHERE user_id = $1
+  AND id = $2;
+
+-- name: IsSessionRevoked :one
+SELECT EXISTS (
+    SELECT 1 FROM devices
+    WHERE session_id = $1
+      AND revoked_at IS NOT NULL
+);
+
+-- name: ListDevices :many
+SELECT * FROM devices
+WHERE user_id = $1
+ORDER BY last_seen_at DESC;
+
+-- name: RevokeDevice :execrows
+UPDATE devices
+SET revoked_at = NOW()
+WHERE user_id = $1
+  AND id = $2
+  AND revoked_at IS NULL;
+
+-- name: DeleteDeviceSyncState :exec
+DELETE FROM sync_state
+WHERE user_id = $1
+  AND device_id = $2;
 
 -- name: InitCloud :exec
 UPDATE "users"
@@ -277,27 +401,61 @@ FROM "users"
 WHERE id = $1;
 
 -- name: InitializeSyncStateForUser :exec
-INSERT INTO sync_state (user_id, table_name, last_synced_at, last_synced_op_id)
+INSERT INTO sync_state (user_id, device_id, table_name, last_synced_at, last_synced_op_id)
 VALUES 
-    ($1, 'boards', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
-    ($1, 'columns', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
-    ($1, 'cards', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
-    ($1, 'transcriptions', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL)
-ON CONFLICT (user_id, table_name)
+    ($1, $2, 'boards', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
+    ($1, $2, 'columns', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
+    ($1, $2, 'cards', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL),
+    ($1, $2, 'transcriptions', EXTRACT(EPOCH FROM NOW())::BIGINT, NULL)
+ON CONFLICT (user_id, device_id, table_name)
 DO NOTHING;
 
+-- the op is stored after its record was written, so the record leads to its board. it takes the next number of its
+-- board, or of its user when it has none. an op id is only ever stored once, a resent op is answered from the op log
+-- before it gets here
 -- name: CreateOperation :exec
+WITH record_board AS (
+    SELECT (
+        CASE lower($2::TEXT)
+            WHEN 'boards' THEN (SELECT b.id FROM boards AS b WHERE b.id::TEXT = $3::TEXT)
+            WHEN 'columns' THEN (SELECT c.board_id FROM columns AS c WHERE c.id::TEXT = $3::TEXT)
+            WHEN 'cards' THEN (
+                SELECT c.board_id FROM cards AS ca
+                JOIN columns AS c ON c.id = ca.column_id
+                WHERE ca.id::TEXT = $3::TEXT
+            )
+            WHEN 'transcriptions' THEN (SELECT t.board_id FROM transcriptions AS t WHERE t.id::TEXT = $3::TEXT)
+        END
+    )::UUID AS board_id
+), next_seq AS (
+    INSERT INTO operation_sequences (scope, seq)
+    SELECT COALESCE('board:' || board_id::TEXT, 'user:' || COALESCE($11::UUID::TEXT, '')), 1
+    FROM record_board
+    ON CONFLICT (scope) DO UPDATE SET seq = operation_sequences.seq + 1
+    RETURNING seq
+)
 INSERT INTO operations (
-    id, table_name, record_id, operation_type, device_id, payload, created_at, updated_at
+    id, table_name, record_id, operation_type, device_id, payload, created_at, updated_at, hlc, fields, user_id, board_id,
+    seq
 )
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-ON CONFLICT (id) DO UPDATE SET
-    table_name = EXCLUDED.table_name,
-    record_id = EXCLUDED.record_id,
-    operation_type = EXCLUDED.operation_type,
-    device_id = EXCLUDED.device_id,
-    payload = EXCLUDED.payload,
-    updated_at = EXCLUDED.updated_at;
+VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, (SELECT board_id FROM record_board), (SELECT seq FROM next_seq)
+)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: GetOperationSeq :one
+SELECT seq FROM operations
+WHERE id = $1;
+
+-- held until the transaction ends, a resent op waits for the first attempt to commit or roll back before it checks
+-- whether it was stored already
+-- name: LockOperation :exec
+SELECT pg_advisory_xact_lock(hashtext('operation:' || sqlc.arg(id)::TEXT));
+
+-- held until the transaction ends. a batch takes the locks of all the boards it writes up front in order, so two
+-- batches on the same boards wait on each other instead of each holding a board's counter the other one needs
+-- name: LockBoardOperationLog :exec
+SELECT pg_advisory_xact_lock(hashtext('operations_seq:' || COALESCE(sqlc.narg(board_id)::UUID::TEXT, '')));
 
 -- name: SyncUpsertTranscription :exec
 INSERT INTO transcriptions (id, board_id, transcription, recording_path, intent, assistant_response, created_at, updated_at)
@@ -311,11 +469,27 @@ ON CONFLICT (id) DO UPDATE SET
     updated_at = EXCLUDED.updated_at;
 
 -- name: SyncDeleteTranscription :exec
-DELETE FROM transcriptions t
-USING boards b
-WHERE t.id = $1
-  AND t.board_id = b.id
-  AND b.user_id = $2;
+UPDATE transcriptions
+SET deleted_at = NOW()
+WHERE id = $1
+  AND deleted_at IS NULL;
+
+-- children are purged first, whatever is left inside a purged board or column goes with it through the cascades
+-- name: PurgeCards :execrows
+DELETE FROM cards
+WHERE deleted_at < $1;
+
+-- name: PurgeTranscriptions :execrows
+DELETE FROM transcriptions
+WHERE deleted_at < $1;
+
+-- name: PurgeColumns :execrows
+DELETE FROM columns
+WHERE deleted_at < $1;
+
+-- name: PurgeBoards :execrows
+DELETE FROM boards
+WHERE deleted_at < $1;
 
 -- name: InsertBoardMember :exec
 INSERT INTO board_members (board_id, user_id, role)
@@ -326,6 +500,111 @@ ON CONFLICT (board_id, user_id) DO NOTHING;
 DELETE FROM board_members
 WHERE board_id = $1 AND user_id = $2;
 
+-- name: RecordLostBoard :exec
+INSERT INTO lost_boards (user_id, board_id)
+VALUES ($1, $2)
+ON CONFLICT (user_id, board_id) DO UPDATE SET lost_at = NOW();
+
+-- boards the user lost and isn't back on
+-- name: ListLostBoards :many
+SELECT lb.board_id
+FROM lost_boards lb
+WHERE lb.user_id = $1
+  AND NOT EXISTS (
+    SELECT 1 FROM board_members bm
+    WHERE bm.board_id = lb.board_id AND bm.user_id = lb.user_id
+  )
+ORDER BY lb.lost_at ASC;
+
+-- name: UpdateBoardMemberRole :execrows
+UPDATE board_members
+SET role = $3
+WHERE board_id = $1 AND user_id = $2;
+
+-- boards.user_id is who pulls a board as its owner, board_members says the same through role
+-- name: SetBoardOwner :execrows
+UPDATE boards
+SET user_id = $2
+WHERE id = $1;
+
+-- name: CreateBoardInvitation :one
+INSERT INTO board_invitations (id, board_id, email, role, invited_by, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (board_id, lower(email)) WHERE accepted_at IS NULL AND revoked_at IS NULL DO UPDATE SET
+    role = EXCLUDED.role,
+    invited_by = EXCLUDED.invited_by,
+    expires_at = EXCLUDED.expires_at
+RETURNING *;
+
+-- name: GetBoardInvitation :one
+SELECT * FROM board_invitations
+WHERE id = $1;
+
+-- open invites of a board, expired ones too so they can be resent
+-- name: ListBoardInvitations :many
+SELECT * FROM board_invitations
+WHERE board_id = $1
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: ListPendingInvitationsForEmail :many
+SELECT bi.*, b.name AS board_name
+FROM board_invitations bi
+JOIN boards b ON b.id = bi.board_id
+WHERE lower(bi.email) = lower(sqlc.arg(email)::TEXT)
+  AND bi.accepted_at IS NULL
+  AND bi.revoked_at IS NULL
+  AND bi.expires_at > NOW()
+  AND b.deleted_at IS NULL
+ORDER BY bi.created_at DESC;
+
+-- name: RenewBoardInvitation :one
+UPDATE board_invitations
+SET expires_at = $3
+WHERE id = $1
+  AND board_id = $2
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeBoardInvitation :execrows
+UPDATE board_invitations
+SET revoked_at = NOW()
+WHERE id = $1
+  AND board_id = $2
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL;
+
+-- name: CreateEmailVerification :exec
+INSERT INTO email_verifications (token_hash, user_id, email, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- a link is used once, it only verifies the email it was mailed to and only while the account still has that email
+-- name: VerifyEmail :one
+WITH used AS (
+    DELETE FROM email_verifications AS ev
+    WHERE ev.token_hash = $1
+      AND ev.expires_at > NOW()
+    RETURNING ev.user_id, ev.email
+)
+UPDATE users AS u
+SET email_verified_at = COALESCE(u.email_verified_at, NOW())
+FROM used
+WHERE u.id = used.user_id
+  AND lower(u.email) = lower(used.email)
+RETURNING u.id;
+
+-- an invite is used once, the update only matches while it's still open
+-- name: AcceptBoardInvitation :one
+UPDATE board_invitations
+SET accepted_at = NOW(), accepted_by = $2
+WHERE id = $1
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
+
 -- name: GetBoardMembers :many
 SELECT u.*, bm.role, bm.joined_at
 FROM board_members bm
@@ -338,6 +617,7 @@ SELECT b.*
 FROM boards b
 JOIN board_members bm ON bm.board_id = b.id
 WHERE bm.user_id = $1
+  AND b.deleted_at IS NULL
 ORDER BY b.created_at DESC;
 
 -- name: IsUserMemberOfBoard :one
@@ -346,35 +626,42 @@ SELECT EXISTS (
   WHERE board_id = $1 AND user_id = $2
 ) AS is_member;
 
--- name: ValidateBoardAccess :one
-SELECT EXISTS (
-  SELECT 1
-  FROM board_members
-  WHERE board_id = $1
-    AND user_id = $2
-) AS has_access;
+-- name: GetBoardMemberRole :one
+SELECT role FROM board_members
+WHERE board_id = $1
+  AND user_id = $2;
+
+-- the board a record of any synced table sits in, null when there's no such record
+-- name: GetRecordBoard :one
+SELECT (
+    CASE lower(sqlc.arg(table_name)::TEXT)
+        WHEN 'boards' THEN (SELECT b.id FROM boards AS b WHERE b.id::TEXT = sqlc.arg(record_id)::TEXT)
+        WHEN 'columns' THEN (SELECT c.board_id FROM columns AS c WHERE c.id = sqlc.arg(record_id)::TEXT)
+        WHEN 'cards' THEN (
+            SELECT c.board_id FROM cards AS ca
+            JOIN columns AS c ON c.id = ca.column_id
+            WHERE ca.id = sqlc.arg(record_id)::TEXT
+        )
+        WHEN 'transcriptions' THEN (SELECT t.board_id FROM transcriptions AS t WHERE t.id = sqlc.arg(record_id)::TEXT)
+    END
+)::UUID AS board_id;
 
 -- name: GetColumnByID :one
 SELECT * FROM columns
 WHERE id = $1;
 
 
+-- name: GetCardByID :one
+SELECT * FROM cards
+WHERE id = $1;
+
 -- name: GetBoardByID :one
 SELECT * FROM boards
 WHERE id = $1;
 
--- name: EnsureBoardOwner :one
-SELECT EXISTS (
-  SELECT 1
-  FROM board_members
-  WHERE board_id = $1
-    AND user_id = $2
-    AND role = 'owner'
-) AS is_owner;
-
 -- name: ListBoards :many
 SELECT * FROM boards
-  WHERE user_id = $1
+  WHERE user_id = $1 AND deleted_at IS NULL
     ORDER BY created_at ASC
     LIMIT $2 OFFSET $3;
 
@@ -382,6 +669,7 @@ SELECT * FROM boards
 SELECT c.* FROM columns c
   JOIN boards b
     ON b.user_id = $1
+WHERE c.deleted_at IS NULL
 ORDER BY c.created_at ASC;
 
 -- name: ListBoardsCards :many
@@ -390,15 +678,15 @@ FROM cards c
 JOIN columns col ON c.column_id = col.id
 JOIN boards b ON col.board_id = b.id
 WHERE b.user_id = $1 AND col.board_id = $2
+  AND c.deleted_at IS NULL
 ORDER BY c.created_at ASC;
 
 -- name: ListBoardTranscriptions :many
 SELECT t.* FROM transcriptions t
-  JOIN boards b
-    ON b.user_id = $1
-WHERE b.id = $2
+WHERE t.board_id = $1
+  AND t.deleted_at IS NULL
 ORDER BY t.created_at DESC
-LIMIT $3 OFFSET $4;
+LIMIT $2 OFFSET $3;
 
 -- name: ListBoardMembers :many
 SELECT bm.*, u.email
@@ -414,11 +702,11 @@ SELECT
     b.created_at,
     b.updated_at,
     b.user_id,
-    (SELECT COUNT(*) FROM columns c WHERE c.board_id = b.id) AS columns_count,
+    (SELECT COUNT(*) FROM columns c WHERE c.board_id = b.id AND c.deleted_at IS NULL) AS columns_count,
     (SELECT COUNT(*) FROM cards ca 
      JOIN columns col ON ca.column_id = col.id 
-     WHERE col.board_id = b.id) AS cards_count,
-    (SELECT COUNT(*) FROM transcriptions t WHERE t.board_id = b.id) AS transcriptions_count
+     WHERE col.board_id = b.id AND ca.deleted_at IS NULL) AS cards_count,
+    (SELECT COUNT(*) FROM transcriptions t WHERE t.board_id = b.id AND t.deleted_at IS NULL) AS transcriptions_count
 FROM boards b
 WHERE b.id = $1;
 
@@ -456,3 +744,95 @@ SET read = TRUE
 WHERE id = $1
   AND user_id = $2;
 
+-- name: GetUserKeys :one
+SELECT * FROM user_keys
+WHERE user_id = $1;
+
+-- a new passphrase re-seals the same private key, the public key never changes or wrapped board keys would be lost
+-- name: UpsertUserKeys :execrows
+INSERT INTO user_keys (user_id, public_key, encrypted_private_key, salt)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET
+    encrypted_private_key = EXCLUDED.encrypted_private_key,
+    salt = EXCLUDED.salt,
+    updated_at = NOW()
+WHERE user_keys.public_key = EXCLUDED.public_key;
+
+-- the owner and every member of a board, with their public key and the board key wrapped for them if they have one
+-- name: ListBoardKeyHolders :many
+SELECT u.id AS user_id,
+       COALESCE(uk.public_key, '') AS public_key,
+       COALESCE(bk.wrapped_key, '') AS wrapped_key
+FROM users u
+LEFT JOIN user_keys uk ON uk.user_id = u.id
+LEFT JOIN board_keys bk ON bk.board_id = $1 AND bk.user_id = u.id
+WHERE u.id IN (
+    SELECT b.user_id FROM boards b WHERE b.id = $1
+    UNION
+    SELECT bm.user_id FROM board_members bm WHERE bm.board_id = $1
+);
+
+-- a member keeps the first key wrapped for them, a board never switches keys under its members
+-- name: UpsertBoardKey :exec
+INSERT INTO board_keys (board_id, user_id, wrapped_key)
+VALUES ($1, $2, $3)
+ON CONFLICT (board_id, user_id) DO NOTHING;
+
+-- name: IsBoardEncrypted :one
+SELECT EXISTS (
+  SELECT 1 FROM board_keys
+  WHERE board_id = $1
+) AS encrypted;
+
+-- the number of changes made to a board and everything in it, 0 for boards untouched since versions were introduced
+-- name: GetBoardVersion :one
+SELECT COALESCE((
+  SELECT version FROM board_versions
+  WHERE board_id = $1
+), 0)::BIGINT AS version;
+
+-- name: ListBoardColumnsChangedSince :many
+SELECT c.*
+FROM columns c
+JOIN board_changes bc ON bc."table_name" = 'columns' AND bc.record_id = c.id
+WHERE bc.board_id = $1 AND bc.version > $2
+  AND c.deleted_at IS NULL
+ORDER BY c.created_at ASC;
+
+-- name: ListBoardCardsChangedSince :many
+SELECT ca.*
+FROM cards ca
+JOIN board_changes bc ON bc."table_name" = 'cards' AND bc.record_id = ca.id
+WHERE bc.board_id = $1 AND bc.version > $2
+  AND ca.deleted_at IS NULL
+ORDER BY ca.created_at ASC;
+
+-- name: ListBoardTranscriptionsChangedSince :many
+SELECT t.*
+FROM transcriptions t
+JOIN board_changes bc ON bc."table_name" = 'transcriptions' AND bc.record_id = t.id
+WHERE bc.board_id = $1 AND bc.version > $2
+  AND t.deleted_at IS NULL
+ORDER BY t.created_at DESC;
+
+-- records of a board deleted, purged or moved to another board since a version, a delta import has to drop them locally
+-- name: ListBoardRemovalsSince :many
+SELECT removed."table_name", removed.record_id
+FROM (
+  SELECT bc."table_name", bc.record_id, bc.version
+  FROM board_changes bc
+  LEFT JOIN columns c ON bc."table_name" = 'columns' AND c.id = bc.record_id
+  LEFT JOIN cards ca ON bc."table_name" = 'cards' AND ca.id = bc.record_id
+  LEFT JOIN transcriptions t ON bc."table_name" = 'transcriptions' AND t.id = bc.record_id
+  WHERE bc.board_id = $1 AND bc.version > $2
+    AND bc."table_name" <> 'boards'
+    AND (
+      COALESCE(c.id, ca.id, t.id) IS NULL
+      OR COALESCE(c.deleted_at, ca.deleted_at, t.deleted_at) IS NOT NULL
+    )
+  UNION ALL
+  SELECT br."table_name", br.record_id, br.version
+  FROM board_removals br
+  WHERE br.board_id = $1 AND br.version > $2
+) removed
+ORDER BY removed.version ASC;
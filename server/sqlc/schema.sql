@@ -82,6 +82,223 @@ CREATE TABLE IF NOT EXISTS operations (
   updated_at TEXT DEFAULT CURRENT_TIMESTAMP
 );
 
+-- hybrid logical clock, wall_ms:counter:device_id. fixed width so it orders as text
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS hlc TEXT NOT NULL DEFAULT '';
+
+-- backfill for operations stored before the clock existed, they only know their created_at
+UPDATE operations
+SET hlc = lpad((EXTRACT(EPOCH FROM left(created_at, 19)::timestamp) * 1000)::bigint::text, 15, '0')
+    || ':' || lpad('0', 10, '0') || ':' || COALESCE(device_id, '')
+WHERE hlc = ''
+  AND created_at ~ '^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}';
+
+CREATE INDEX IF NOT EXISTS operations_table_record_hlc_idx ON operations("table_name", record_id, hlc);
+
+-- json array of the fields an op changed, empty means the whole record
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS fields TEXT NOT NULL DEFAULT '';
+
+-- ops are numbered per board, ops without a board per user who pushed them. a pull asks for everything after the
+-- number it saw last of each board instead of comparing timestamps. the counter row of a scope stays locked until the
+-- op commits, so a board's numbers commit in order and a pull can't move past one that commits later.
+-- board_id is the board the op's record sits in, pulls only see ops of boards the user owns or is a member of
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS seq BIGINT;
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS user_id UUID;
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS board_id UUID;
+
+-- the last number handed out in each scope, 'board:<id>' or 'user:<id>'
+CREATE TABLE IF NOT EXISTS operation_sequences (
+  scope TEXT PRIMARY KEY,
+  seq BIGINT NOT NULL
+);
+
+-- names of the one time migrations below that ran already
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  name TEXT PRIMARY KEY
+);
+
+-- scope ops stored before they knew their board and number them per scope, once. ops of records purged since stay
+-- unscoped and are never pulled again
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM schema_migrations WHERE name = 'operations_seq_per_board') THEN
+    UPDATE operations AS o
+    SET board_id = b.id, user_id = b.user_id
+    FROM boards AS b
+    WHERE o.board_id IS NULL AND o."table_name" = 'boards' AND b.id::TEXT = o.record_id;
+
+    UPDATE operations AS o
+    SET board_id = b.id, user_id = b.user_id
+    FROM columns AS c
+    JOIN boards AS b ON b.id = c.board_id
+    WHERE o.board_id IS NULL AND o."table_name" = 'columns' AND c.id::TEXT = o.record_id;
+
+    UPDATE operations AS o
+    SET board_id = b.id, user_id = b.user_id
+    FROM cards AS ca
+    JOIN columns AS c ON c.id = ca.column_id
+    JOIN boards AS b ON b.id = c.board_id
+    WHERE o.board_id IS NULL AND o."table_name" = 'cards' AND ca.id::TEXT = o.record_id;
+
+    UPDATE operations AS o
+    SET board_id = b.id, user_id = b.user_id
+    FROM transcriptions AS t
+    JOIN boards AS b ON b.id = t.board_id
+    WHERE o.board_id IS NULL AND o."table_name" = 'transcriptions' AND t.id::TEXT = o.record_id;
+
+    -- numbers from the old global sequence keep their order within a scope, ops without one go after them
+    ALTER TABLE operations ALTER COLUMN seq DROP DEFAULT;
+    DROP SEQUENCE IF EXISTS operations_seq_seq;
+    DROP INDEX IF EXISTS operations_seq_idx;
+
+    UPDATE operations AS o
+    SET seq = numbered.seq
+    FROM (
+      SELECT id, (SELECT COALESCE(MAX(seq), 0) FROM operations) + ROW_NUMBER() OVER (
+        PARTITION BY COALESCE('board:' || board_id::TEXT, 'user:' || COALESCE(user_id::TEXT, ''))
+        ORDER BY hlc, id
+      ) AS seq
+      FROM operations
+      WHERE seq IS NULL
+    ) AS numbered
+    WHERE o.id = numbered.id;
+
+    ALTER TABLE operations ALTER COLUMN seq SET NOT NULL;
+
+    INSERT INTO operation_sequences (scope, seq)
+    SELECT COALESCE('board:' || board_id::TEXT, 'user:' || COALESCE(user_id::TEXT, '')), MAX(seq)
+    FROM operations
+    GROUP BY 1
+    ON CONFLICT (scope) DO UPDATE SET seq = GREATEST(operation_sequences.seq, EXCLUDED.seq);
+
+    INSERT INTO schema_migrations (name) VALUES ('operations_seq_per_board');
+  END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS operations_board_table_seq_idx ON operations (board_id, "table_name", seq);
+
+-- hlc of the last op that wrote each field of a record
+CREATE TABLE IF NOT EXISTS field_clocks (
+  "table_name" TEXT NOT NULL,
+  record_id TEXT NOT NULL,
+  field TEXT NOT NULL,
+  hlc TEXT NOT NULL,
+  PRIMARY KEY ("table_name", record_id, field)
+);
+
+-- tombstones, a deleted record stays around so a stale update from an offline device can't bring it back
+ALTER TABLE boards ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE columns ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE transcriptions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- every board counts the changes made to it and to its columns, cards and transcriptions, board_changes keeps the
+-- version that last touched each record so a board can be re-imported from the version a device has instead of in full.
+-- triggers keep both up to date whichever path writes, sync ops, the initial upload or the ai tools
+CREATE TABLE IF NOT EXISTS board_versions (
+  board_id UUID PRIMARY KEY REFERENCES boards(id) ON DELETE CASCADE,
+  version BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS board_changes (
+  board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+  "table_name" TEXT NOT NULL,
+  record_id TEXT NOT NULL,
+  version BIGINT NOT NULL,
+  PRIMARY KEY ("table_name", record_id)
+);
+
+CREATE INDEX IF NOT EXISTS board_changes_board_version_idx ON board_changes (board_id, version);
+
+-- records that moved to another board, the board they left reports them removed at the version they left
+CREATE TABLE IF NOT EXISTS board_removals (
+  board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+  "table_name" TEXT NOT NULL,
+  record_id TEXT NOT NULL,
+  version BIGINT NOT NULL,
+  PRIMARY KEY (board_id, "table_name", record_id)
+);
+
+CREATE OR REPLACE FUNCTION record_board_change() RETURNS trigger AS $$
+DECLARE
+  changed RECORD;
+  changed_board UUID;
+  previous_board UUID;
+  next_version BIGINT;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    changed := OLD;
+    -- the parent column of a purged card may be gone already, the last change remembers the board
+    SELECT board_id INTO changed_board FROM board_changes
+    WHERE "table_name" = TG_TABLE_NAME AND record_id = OLD.id::TEXT;
+  ELSE
+    changed := NEW;
+    IF TG_TABLE_NAME = 'boards' THEN
+      changed_board := NEW.id;
+    ELSIF TG_TABLE_NAME = 'cards' THEN
+      SELECT board_id INTO changed_board FROM columns WHERE id = NEW.column_id;
+    ELSE
+      changed_board := NEW.board_id;
+    END IF;
+  END IF;
+
+  -- a purged board takes its versions with it
+  IF changed_board IS NULL OR NOT EXISTS (SELECT 1 FROM boards WHERE id = changed_board) THEN
+    RETURN NULL;
+  END IF;
+
+  -- a record that moved to another board is a removal for the board it left
+  IF TG_OP = 'UPDATE' THEN
+    SELECT board_id INTO previous_board FROM board_changes
+    WHERE "table_name" = TG_TABLE_NAME AND record_id = NEW.id::TEXT;
+
+    IF previous_board IS NOT NULL AND previous_board <> changed_board
+      AND EXISTS (SELECT 1 FROM boards WHERE id = previous_board) THEN
+      INSERT INTO board_versions (board_id, version)
+      VALUES (previous_board, 1)
+      ON CONFLICT (board_id) DO UPDATE SET version = board_versions.version + 1
+      RETURNING version INTO next_version;
+
+      INSERT INTO board_removals (board_id, "table_name", record_id, version)
+      VALUES (previous_board, TG_TABLE_NAME, NEW.id::TEXT, next_version)
+      ON CONFLICT (board_id, "table_name", record_id) DO UPDATE SET version = EXCLUDED.version;
+    END IF;
+
+    -- moved back, it's this board's record again
+    DELETE FROM board_removals
+    WHERE board_id = changed_board AND "table_name" = TG_TABLE_NAME AND record_id = NEW.id::TEXT;
+  END IF;
+
+  INSERT INTO board_versions (board_id, version)
+  VALUES (changed_board, 1)
+  ON CONFLICT (board_id) DO UPDATE SET version = board_versions.version + 1
+  RETURNING version INTO next_version;
+
+  INSERT INTO board_changes (board_id, "table_name", record_id, version)
+  VALUES (changed_board, TG_TABLE_NAME, changed.id::TEXT, next_version)
+  ON CONFLICT ("table_name", record_id) DO UPDATE SET
+    board_id = EXCLUDED.board_id,
+    version = EXCLUDED.version;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS boards_record_change ON boards;
+CREATE TRIGGER boards_record_change AFTER INSERT OR UPDATE ON boards
+  FOR EACH ROW EXECUTE FUNCTION record_board_change();
+
+DROP TRIGGER IF EXISTS columns_record_change ON columns;
+CREATE TRIGGER columns_record_change AFTER INSERT OR UPDATE OR DELETE ON columns
+  FOR EACH ROW EXECUTE FUNCTION record_board_change();
+
+DROP TRIGGER IF EXISTS cards_record_change ON cards;
+CREATE TRIGGER cards_record_change AFTER INSERT OR UPDATE OR DELETE ON cards
+  FOR EACH ROW EXECUTE FUNCTION record_board_change();
+
+DROP TRIGGER IF EXISTS transcriptions_record_change ON transcriptions;
+CREATE TRIGGER transcriptions_record_change AFTER INSERT OR UPDATE OR DELETE ON transcriptions
+  FOR EACH ROW EXECUTE FUNCTION record_board_change();
+
 CREATE TABLE IF NOT EXISTS sync_state (
   user_id UUID NOT NULL REFERENCES users(id),
   "table_name" TEXT NOT NULL,
@@ -90,6 +307,28 @@ CREATE TABLE IF NOT EXISTS sync_state (
   PRIMARY KEY (user_id, table_name)
 );
 
+-- every desktop install registers the id it keeps in its app_meta, revoked devices can't sync anymore
+CREATE TABLE IF NOT EXISTS devices (
+  id TEXT NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  revoked_at TIMESTAMPTZ,
+  PRIMARY KEY (user_id, id)
+);
+
+-- sync cursors are kept per device so two laptops on one account don't overwrite each other's,
+-- clients that don't send a device id share the '' row
+ALTER TABLE sync_state ADD COLUMN IF NOT EXISTS device_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE sync_state DROP CONSTRAINT IF EXISTS sync_state_pkey;
+CREATE UNIQUE INDEX IF NOT EXISTS sync_state_user_device_table_idx ON sync_state (user_id, device_id, "table_name");
+
+-- a device is tied to the session (the token's jti) it syncs with, revoking the device ends that session everywhere
+-- so neither the token nor a new device id registered with it gets back in
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS session_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS devices_revoked_session_idx ON devices (session_id) WHERE revoked_at IS NOT NULL;
+
 CREATE TABLE IF NOT EXISTS board_members (
   board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
   user_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -98,6 +337,46 @@ CREATE TABLE IF NOT EXISTS board_members (
   PRIMARY KEY (board_id, user_id)
 );
 
+-- boards a user was removed from or left, each of their devices is told on connecting until they're on the board again
+CREATE TABLE IF NOT EXISTS lost_boards (
+  user_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+  lost_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, board_id)
+);
+
+-- an invite waits here until its recipient accepts it, they don't need an account yet when it's sent
+CREATE TABLE IF NOT EXISTS board_invitations (
+  id          UUID PRIMARY KEY,
+  board_id    UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+  email       TEXT NOT NULL,
+  role        TEXT NOT NULL,
+  invited_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at  TIMESTAMPTZ NOT NULL,
+  accepted_at TIMESTAMPTZ,
+  accepted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  revoked_at  TIMESTAMPTZ
+);
+
+-- one open invite per address and board, inviting the same address again refreshes it
+CREATE UNIQUE INDEX IF NOT EXISTS board_invitations_open_idx
+  ON board_invitations (board_id, lower(email))
+  WHERE accepted_at IS NULL AND revoked_at IS NULL;
+
+-- set once the account follows the verification link mailed to its email, until then no invite is handed to it just
+-- because the email matches
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+-- a verification link mailed to the address an account had at the time, only the token's hash is kept
+CREATE TABLE IF NOT EXISTS email_verifications (
+  token_hash TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
 CREATE TABLE IF NOT EXISTS app_versions (
   id SERIAL PRIMARY KEY,
   version TEXT UNIQUE NOT NULL,
@@ -116,4 +395,24 @@ CREATE TABLE IF NOT EXISTS notifications (
   target TEXT,
   read BOOLEAN DEFAULT FALSE,
   created_at TIMESTAMPTZ DEFAULT now()
-);
\ No newline at end of file
+);
+
+-- end to end encryption, the server only ever holds public keys, a private key sealed with a key derived from the
+-- user's passphrase and board keys wrapped for each member
+CREATE TABLE IF NOT EXISTS user_keys (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  public_key TEXT NOT NULL,
+  encrypted_private_key TEXT NOT NULL,
+  salt TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- a board is encrypted once it has a key
+CREATE TABLE IF NOT EXISTS board_keys (
+  board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  wrapped_key TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (board_id, user_id)
+);
@@ -1,25 +1,38 @@
 package synchub
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"sync"
 	"time"
 
+	"seisami/server/backplane"
+
 	"github.com/gorilla/websocket"
 )
 
+// a signal for a user goes to every replica through the backplane and each sends it to the user's devices connected
+// there. a device that isn't connected catches up on its next pull
+
+// syncTopic is where replicas pass on signals for users
+const syncTopic = "sync"
+
 type SyncClient struct {
 	UserID string
-	Conn   *websocket.Conn
-	Send   chan []byte
+	// the device the socket is for, every device of a user gets its own signals
+	DeviceID string
+	Conn     *websocket.Conn
+	Send     chan []byte
 }
 
 type SyncHub struct {
-	clients    map[string]*SyncClient
+	// connected devices by user and device id
+	clients    map[string]map[string]*SyncClient
 	register   chan *SyncClient
 	unregister chan *SyncClient
 	broadcast  chan SyncMessage
+	backplane  backplane.Backplane
 	mu         sync.RWMutex
 }
 
@@ -27,16 +40,24 @@ type SyncMessage struct {
 	Type      string      `json:"type"`
 	TableName string      `json:"table_name,omitempty"`
 	UserID    string      `json:"user_id,omitempty"`
+	BoardID   string      `json:"board_id,omitempty"`
 	Data      interface{} `json:"data,omitempty"`
 }
 
-func NewSyncHub() *SyncHub {
-	return &SyncHub{
-		clients:    make(map[string]*SyncClient),
+// BoardRemovedMessage tells a device its user lost access to a board, it stops syncing the board and archives its copy
+const BoardRemovedMessage = "board_removed"
+
+func NewSyncHub(bp backplane.Backplane) *SyncHub {
+	h := &SyncHub{
+		clients:    make(map[string]map[string]*SyncClient),
 		register:   make(chan *SyncClient),
 		unregister: make(chan *SyncClient),
 		broadcast:  make(chan SyncMessage, 256),
+		backplane:  bp,
 	}
+
+	bp.Subscribe(syncTopic, h.receive)
+	return h
 }
 
 func (h *SyncHub) Run() {
@@ -44,57 +65,119 @@ func (h *SyncHub) Run() {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
-			h.clients[client.UserID] = client
+			devices, ok := h.clients[client.UserID]
+			if !ok {
+				devices = make(map[string]*SyncClient)
+				h.clients[client.UserID] = devices
+			}
+			// the same device connecting again replaces its old socket
+			if old, ok := devices[client.DeviceID]; ok && old != client {
+				close(old.Send)
+			}
+			devices[client.DeviceID] = client
 			h.mu.Unlock()
-			log.Printf("Sync client registered: %s", client.UserID)
+			log.Printf("Sync client registered: %s (device %s)", client.UserID, client.DeviceID)
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client.UserID]; ok {
-				delete(h.clients, client.UserID)
-				close(client.Send)
-			}
+			h.remove(client)
 			h.mu.Unlock()
-			log.Printf("Sync client unregistered: %s", client.UserID)
+			log.Printf("Sync client unregistered: %s (device %s)", client.UserID, client.DeviceID)
 
 		case message := <-h.broadcast:
-			h.mu.RLock()
-			client, ok := h.clients[message.UserID]
-			h.mu.RUnlock()
+			data := mustMarshal(message)
 
-			if ok {
+			h.mu.Lock()
+			for _, client := range h.clients[message.UserID] {
 				select {
-				case client.Send <- mustMarshal(message):
+				case client.Send <- data:
 				default:
-					h.mu.Lock()
-					delete(h.clients, client.UserID)
-					close(client.Send)
-					h.mu.Unlock()
+					// a device that can't keep up reconnects and catches up then
+					h.remove(client)
 				}
 			}
+			h.mu.Unlock()
 		}
 	}
 }
 
+// remove forgets client if it's still the socket kept for its device, h.mu has to be held
+func (h *SyncHub) remove(client *SyncClient) {
+	devices := h.clients[client.UserID]
+	if devices[client.DeviceID] != client {
+		return
+	}
+
+	delete(devices, client.DeviceID)
+	close(client.Send)
+	if len(devices) == 0 {
+		delete(h.clients, client.UserID)
+	}
+}
+
 func (h *SyncHub) NotifyUserSync(userID, tableName string) {
 	log.Printf("NotifyUserSync called: userID=%s, tableName=%s", userID, tableName)
 
+	message := SyncMessage{
+		Type:      "sync_update",
+		TableName: tableName,
+		UserID:    userID,
+	}
+
+	h.publish(message)
+	h.notify(message)
+}
+
+// NotifyBoardRemoved tells every device of userID connected now to stop syncing boardID, the caller stores the removal
+// for the others
+func (h *SyncHub) NotifyBoardRemoved(userID, boardID string) {
+	message := SyncMessage{
+		Type:    BoardRemovedMessage,
+		UserID:  userID,
+		BoardID: boardID,
+	}
+
+	h.publish(message)
+	h.notify(message)
+}
+
+// notify sends message to the user's devices connected here
+func (h *SyncHub) notify(message SyncMessage) {
 	h.mu.RLock()
-	_, exists := h.clients[userID]
+	_, exists := h.clients[message.UserID]
 	h.mu.RUnlock()
 
 	if !exists {
-		log.Printf("No WebSocket client found for user: %s", userID)
+		log.Printf("No WebSocket client found for user: %s", message.UserID)
 		return
 	}
 
-	log.Printf("Broadcasting sync update to user %s for table %s", userID, tableName)
+	log.Printf("Broadcasting %s to user %s", message.Type, message.UserID)
 
-	h.broadcast <- SyncMessage{
-		Type:      "sync_update",
-		TableName: tableName,
-		UserID:    userID,
+	h.broadcast <- message
+}
+
+func (h *SyncHub) publish(message SyncMessage) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("unable to encode sync message: %v", err)
+		return
 	}
+
+	if err := h.backplane.Publish(context.Background(), syncTopic, payload); err != nil {
+		log.Printf("unable to pass %s for user %s on to other replicas: %v", message.Type, message.UserID, err)
+	}
+}
+
+// receive takes a signal another replica passed on
+func (h *SyncHub) receive(payload []byte) {
+	var message SyncMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		log.Printf("unreadable sync message: %v", err)
+		return
+	}
+
+	h.notify(message)
 }
 
 func (h *SyncHub) Register(client *SyncClient) {
@@ -168,15 +251,3 @@ func mustMarshal(v interface{}) []byte {
 	}
 	return data
 }
-
-var globalHub *SyncHub
-
-func Init() *SyncHub {
-	globalHub = NewSyncHub()
-	go globalHub.Run()
-	return globalHub
-}
-
-func Get() *SyncHub {
-	return globalHub
-}
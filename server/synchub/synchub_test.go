@@ -0,0 +1,110 @@
+package synchub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"seisami/server/backplane"
+)
+
+// register connects client to hub and waits until hub sends to it
+func register(t *testing.T, hub *SyncHub, client *SyncClient) {
+	t.Helper()
+
+	hub.Register(client)
+	deadline := time.Now().Add(time.Second)
+	for {
+		hub.mu.RLock()
+		registered := hub.clients[client.UserID][client.DeviceID] == client
+		hub.mu.RUnlock()
+		if registered {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s of %s to register", client.DeviceID, client.UserID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func expectSync(t *testing.T, client *SyncClient, wantType string) SyncMessage {
+	t.Helper()
+
+	select {
+	case data := <-client.Send:
+		var message SyncMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatalf("expected a sync message, got %v", err)
+		}
+		if message.Type != wantType {
+			t.Errorf("expected %s, got %+v", wantType, message)
+		}
+		return message
+	case <-time.After(time.Second):
+		t.Fatalf("expected %s to get to %s", wantType, client.DeviceID)
+	}
+	return SyncMessage{}
+}
+
+// every device of the user hears about a removal, not only the one that connected last
+func TestBoardRemovalReachesEveryDevice(t *testing.T) {
+	hub := NewSyncHub(backplane.NewMemory())
+	go hub.Run()
+
+	laptop := &SyncClient{UserID: "user-1", DeviceID: "laptop", Send: make(chan []byte, 1)}
+	desktop := &SyncClient{UserID: "user-1", DeviceID: "desktop", Send: make(chan []byte, 1)}
+	register(t, hub, laptop)
+	register(t, hub, desktop)
+
+	hub.NotifyBoardRemoved("user-1", "board-1")
+
+	for _, client := range []*SyncClient{laptop, desktop} {
+		if message := expectSync(t, client, BoardRemovedMessage); message.BoardID != "board-1" {
+			t.Errorf("expected board-1 to be removed on %s, got %+v", client.DeviceID, message)
+		}
+	}
+
+	// the laptop connecting again replaces its socket, the desktop keeps its own
+	again := &SyncClient{UserID: "user-1", DeviceID: "laptop", Send: make(chan []byte, 1)}
+	register(t, hub, again)
+	if _, open := <-laptop.Send; open {
+		t.Errorf("expected the old laptop socket to be closed")
+	}
+
+	hub.NotifyUserSync("user-1", "cards")
+	expectSync(t, again, "sync_update")
+	expectSync(t, desktop, "sync_update")
+}
+
+// two replicas of the server, a signal gets to the devices whichever one they're connected to
+func TestSignalsAcrossReplicas(t *testing.T) {
+	bus := backplane.NewMemory()
+	a, b := NewSyncHub(bus), NewSyncHub(bus.Join())
+	go a.Run()
+	go b.Run()
+
+	t.Run("sync_update_reaches_other_replica", func(t *testing.T) {
+		client := &SyncClient{UserID: "user-1", DeviceID: "laptop", Send: make(chan []byte, 1)}
+		register(t, b, client)
+
+		a.NotifyUserSync("user-1", "cards")
+		if message := expectSync(t, client, "sync_update"); message.TableName != "cards" {
+			t.Errorf("expected cards to sync, got %+v", message)
+		}
+	})
+
+	t.Run("removal_reaches_devices_on_both_replicas", func(t *testing.T) {
+		onA := &SyncClient{UserID: "user-2", DeviceID: "laptop", Send: make(chan []byte, 1)}
+		onB := &SyncClient{UserID: "user-2", DeviceID: "desktop", Send: make(chan []byte, 1)}
+		register(t, a, onA)
+		register(t, b, onB)
+
+		a.NotifyBoardRemoved("user-2", "board-1")
+		for _, client := range []*SyncClient{onA, onB} {
+			if message := expectSync(t, client, BoardRemovedMessage); message.BoardID != "board-1" {
+				t.Errorf("expected board-1 to be removed on %s, got %+v", client.DeviceID, message)
+			}
+		}
+	})
+}
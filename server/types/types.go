@@ -1,10 +1,134 @@
 package types
 
-type Message struct {
-	Action string `json:"action" validate:"required"`
-	RoomID string `json:"roomId,omitempty"`
-	Data   string `json:"data,omitempty"`
-	Type   string `json:"type"`
+import "encoding/json"
+
+// RealtimeVersion is the version of the /ws protocol, envelopes of any other version are refused
+const RealtimeVersion = 1
+
+// Envelope is every message a client sends to its board's room, ID is the client's and also the id of the op it becomes
+type Envelope struct {
+	V    int             `json:"v"`
+	ID   string          `json:"id" validate:"required,uuid"`
+	Type string          `json:"type" validate:"required"`
+	Data json.RawMessage `json:"data" validate:"required"`
+	// HLC and Fields are those of the client's own copy of the op, a later push of it is then the op already stored
+	HLC    string   `json:"hlc,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// RoomEvent is an accepted envelope as the rest of the room gets it, Seq is where it landed in the op log
+type RoomEvent struct {
+	V    int             `json:"v"`
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	From string          `json:"from"`
+	Seq  int64           `json:"seq"`
+	Data json.RawMessage `json:"data"`
+}
+
+const (
+	AckMessage  = "ack"
+	NackMessage = "nack"
+)
+
+// Ack answers the sender of an envelope, an ack carries the seq it was stored at and a nack why it wasn't
+type Ack struct {
+	V     int    `json:"v"`
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"`
+	Seq   int64  `json:"seq,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// PresenceMessage is the envelope type of a presence heartbeat and of the room's answer listing everyone's presence
+const PresenceMessage = "presence"
+
+// CommentMessage is the envelope type of a comment, it's said to the room and not stored
+const CommentMessage = "comment"
+
+// CommentEvent is something said about a board, or one of its cards, in its room
+type CommentEvent struct {
+	CardID string `json:"card_id,omitempty"`
+	Body   string `json:"body" validate:"required,max=2000"`
+}
+
+// PresenceTarget is the card or column someone is looking at or editing
+type PresenceTarget struct {
+	Table string `json:"table" validate:"oneof=cards columns"`
+	ID    string `json:"id" validate:"required"`
+}
+
+// PresenceEvent is a presence heartbeat, the states it carries are renewed and the ones it leaves out end
+type PresenceEvent struct {
+	Name    string          `json:"name,omitempty" validate:"max=64"`
+	Focus   *PresenceTarget `json:"focus,omitempty"`
+	Editing *PresenceTarget `json:"editing,omitempty"`
+}
+
+// Presence is one connection in a board's room, states whose heartbeat lapsed are left out
+type Presence struct {
+	UserID   string          `json:"user_id"`
+	Name     string          `json:"name,omitempty"`
+	Focus    *PresenceTarget `json:"focus,omitempty"`
+	Editing  *PresenceTarget `json:"editing,omitempty"`
+	Idle     bool            `json:"idle"`
+	LastSeen string          `json:"last_seen"`
+}
+
+type BoardEvent struct {
+	ID        string `json:"id" validate:"required,uuid"`
+	Name      string `json:"name" validate:"required"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+type ColumnEvent struct {
+	ID        string `json:"id" validate:"required"`
+	BoardID   string `json:"board_id" validate:"required,uuid"`
+	Name      string `json:"name" validate:"required"`
+	Position  int32  `json:"position" validate:"gte=0"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+type ColumnDeleteEvent struct {
+	ID      string   `json:"id" validate:"required"`
+	BoardID string   `json:"board_id" validate:"required,uuid"`
+	CardIDs []string `json:"card_ids,omitempty"`
+}
+
+type EventColumn struct {
+	ID      string `json:"id" validate:"required"`
+	BoardID string `json:"board_id,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+type EventCard struct {
+	ID          string `json:"id" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	ColumnID    string `json:"column_id"`
+	Index       int    `json:"index"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+type CardEvent struct {
+	Column EventColumn `json:"column"`
+	Card   EventCard   `json:"card"`
+}
+
+type CardDeleteEvent struct {
+	Column EventColumn `json:"column"`
+	Card   struct {
+		ID string `json:"id" validate:"required"`
+	} `json:"card"`
+}
+
+type CardColumnEvent struct {
+	CardID    string       `json:"card_id" validate:"required"`
+	OldColumn *EventColumn `json:"old_column"`
+	NewColumn EventColumn  `json:"new_column"`
+	Index     int          `json:"index"`
 }
 
 type SyncBoard struct {
@@ -73,11 +197,27 @@ type BoardRole int
 
 const (
 	BoardOwnerRole BoardRole = iota + 1
+	// member is what everyone invited before roles got, it may do what an editor may
 	BoardMemberRole
+	BoardViewerRole
+	BoardCommenterRole
+	BoardEditorRole
+	BoardAdminRole
 )
 
 func (b BoardRole) String() string {
-	return [...]string{"owner", "member"}[b-1]
+	return [...]string{"owner", "member", "viewer", "commenter", "editor", "admin"}[b-1]
+}
+
+// ParseBoardRole is the role called s
+func ParseBoardRole(s string) (BoardRole, bool) {
+	for role := BoardOwnerRole; role <= BoardAdminRole; role++ {
+		if role.String() == s {
+			return role, true
+		}
+	}
+
+	return 0, false
 }
 
 type ExportedBoard struct {
@@ -117,11 +257,21 @@ type ExportedTranscription struct {
 	UpdatedAt         string `json:"updated_at"`
 }
 
+// ExportedData is a board's snapshot at Version, or only what changed after Since when Since is set
 type ExportedData struct {
 	Board          ExportedBoard           `json:"board"`
 	Columns        []ExportedColumn        `json:"columns"`
 	Cards          []ExportedCard          `json:"cards"`
 	Transcriptions []ExportedTranscription `json:"transcriptions"`
+	Version        int64                   `json:"version"`
+	Since          int64                   `json:"since,omitempty"`
+	Removed        []RemovedRecord         `json:"removed,omitempty"`
+}
+
+// RemovedRecord is a column, card or transcription deleted from a board since the version a delta starts at
+type RemovedRecord struct {
+	TableName string `json:"table_name"`
+	ID        string `json:"id"`
 }
 
 type ExportedAllData struct {
@@ -138,6 +288,19 @@ type BoardMember struct {
 	Email    string `json:"email"`
 }
 
+type BoardInvitation struct {
+	ID        string `json:"id"`
+	BoardID   string `json:"board_id"`
+	BoardName string `json:"board_name,omitempty"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+	Expired   bool   `json:"expired"`
+	// Link is the deep link that accepts the invite, only its recipient gets it
+	Link string `json:"link,omitempty"`
+}
+
 type BoardMetadata struct {
 	ID                  string `json:"id"`
 	Name                string `json:"name"`
@@ -148,6 +311,39 @@ type BoardMetadata struct {
 	TranscriptionsCount int    `json:"transcriptions_count"`
 }
 
+type Device struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	RevokedAt  string `json:"revoked_at,omitempty"`
+}
+
+// UserKeys is a user's end to end encryption keypair, the private key only ever leaves the desktop sealed with a key
+// derived from the user's passphrase
+type UserKeys struct {
+	PublicKey           string `json:"public_key" validate:"required"`
+	EncryptedPrivateKey string `json:"encrypted_private_key" validate:"required"`
+	Salt                string `json:"salt" validate:"required"`
+}
+
+type BoardKeyHolder struct {
+	UserID    string `json:"user_id"`
+	PublicKey string `json:"public_key,omitempty"`
+	HasKey    bool   `json:"has_key"`
+}
+
+// BoardKeys is the board key wrapped for the caller, if they have it, and who else on the board can or does hold it
+type BoardKeys struct {
+	WrappedKey string           `json:"wrapped_key,omitempty"`
+	Members    []BoardKeyHolder `json:"members"`
+}
+
+type WrappedBoardKey struct {
+	UserID     string `json:"user_id" validate:"required"`
+	WrappedKey string `json:"wrapped_key" validate:"required"`
+}
+
 type AppVersion struct {
 	Version string `json:"version"`
 	Notes   string `json:"notes"`